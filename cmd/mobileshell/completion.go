@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"mobileshell/internal/server"
+	"mobileshell/internal/workspace"
+
+	"github.com/spf13/cobra"
+)
+
+// completeWorkspaceIDs completes the IDs of the workspaces in the state directory.
+func completeWorkspaceIDs(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	workspaces := completionWorkspaces()
+	completions := make([]cobra.Completion, 0, len(workspaces))
+	for _, ws := range workspaces {
+		completions = append(completions, cobra.CompletionWithDesc(ws.ID, ws.Name))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProcessIDs completes the IDs of the processes in the state directory. If the
+// --workspace flag is set, only processes of this workspace are completed.
+func completeProcessIDs(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	workspaceID, _ := cmd.Flags().GetString("workspace")
+	return processCompletions(workspaceID), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeWorkspaceAndProcessIDs completes the arguments "workspace-id process-id".
+func completeWorkspaceAndProcessIDs(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		return completeWorkspaceIDs(cmd, args, toComplete)
+	case 1:
+		return processCompletions(args[0]), cobra.ShellCompDirectiveNoFileComp
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// processCompletions returns the IDs of the processes in the state directory, of all
+// workspaces if workspaceID is empty.
+func processCompletions(workspaceID string) []cobra.Completion {
+	var completions []cobra.Completion
+	for _, ws := range completionWorkspaces() {
+		if workspaceID != "" && ws.ID != workspaceID {
+			continue
+		}
+		processes, err := workspace.ListProcesses(ws)
+		if err != nil {
+			continue
+		}
+		for _, proc := range processes {
+			command := strings.Join(strings.Fields(proc.Command), " ")
+			completions = append(completions, cobra.CompletionWithDesc(proc.CommandId, fmt.Sprintf("%s: %s", ws.ID, command)))
+		}
+	}
+	return completions
+}
+
+// completionWorkspaces returns the workspaces of the state directory. Errors are ignored,
+// because there is no way to report them during shell completion.
+func completionWorkspaces() []*workspace.Workspace {
+	dir, err := server.GetStateDir(stateDir, false)
+	if err != nil {
+		return nil
+	}
+	workspaces, err := workspace.ListWorkspaces(dir)
+	if err != nil {
+		return nil
+	}
+	return workspaces
+}
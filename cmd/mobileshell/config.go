@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"mobileshell/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configFile string
+	listen     string
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with the config file of the server",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate FILE",
+	Short: "Check a config file",
+	Long: `Check a config file, without starting the server.
+
+Unknown keys, values of the wrong type and invalid settings are reported. The
+exit code is non-zero if the file is not valid.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := config.Load(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("%s is valid\n", args[0])
+		return nil
+	},
+}
+
+// runConfig returns the config of the run command: the config file of --config, or the
+// defaults, overridden by the flags which are set explicitly.
+func runConfig(cmd *cobra.Command) (config.Config, error) {
+	cfg := config.Default()
+	if configFile != "" {
+		var err error
+		if cfg, err = config.Load(configFile); err != nil {
+			return cfg, err
+		}
+	}
+	flags := cmd.Flags()
+	if flags.Changed("state-dir") {
+		cfg.StateDir = stateDir
+	}
+	if flags.Changed("listen") {
+		cfg.Listen = listen
+	}
+	if flags.Changed("port") {
+		cfg.Port = port
+	}
+	if flags.Changed("base-path") {
+		cfg.BasePath = basePath
+	}
+	if flags.Changed("widget-cors-origin") {
+		cfg.WidgetOrigins = widgetOrigins
+	}
+	if flags.Changed("trusted-proxy") {
+		cfg.TrustedProxies = trustedProxies
+	}
+	return cfg, cfg.Validate()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"mobileshell/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+var demoCmd = &cobra.Command{
+	Use:   "demo",
+	Short: "Start the MobileShell server in demo mode",
+	Long: `Start the MobileShell server in demo mode.
+
+The server uses a temporary state directory with demo workspaces and
+processes, which is removed when the server stops. Commands are not
+executed: each command completes at once with a canned output, and the
+interactive terminal is not available. The password is printed on start.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return server.RunDemo(port, debugHTML)
+	},
+}
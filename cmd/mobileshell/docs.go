@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+var manDir string
+
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate documentation",
+}
+
+var docsManCmd = &cobra.Command{
+	Use:   "man",
+	Short: "Generate man pages",
+	Long: `Generate man pages for all commands from the command tree.
+
+Example:
+  mobileshell docs man --dir /usr/local/share/man/man1`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := os.MkdirAll(manDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create man directory: %w", err)
+		}
+		header := &doc.GenManHeader{
+			Title:   "MOBILESHELL",
+			Section: "1",
+		}
+		if err := doc.GenManTree(rootCmd, header, manDir); err != nil {
+			return fmt.Errorf("failed to generate man pages: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Man pages written to %s\n", manDir)
+		return nil
+	},
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"mobileshell/internal/doctor"
+	"mobileshell/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the installation and the state directory",
+	Long: `Check the installation and the state directory.
+
+The report lists problems like wrong permissions of the state directory,
+orphaned process directories, malformed output logs, expired sessions, the
+versions of the embedded assets and the free disk space. The exit code is
+non-zero if a check failed.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := server.GetStateDir(stateDir, false)
+		if err != nil {
+			return err
+		}
+		report := doctor.Run(dir, server.StaticAssets())
+		printReport(os.Stdout, report)
+		if report.HasErrors() {
+			return fmt.Errorf("some checks failed")
+		}
+		return nil
+	},
+}
+
+// printReport writes one check per line. Multi-line messages and hints are indented.
+func printReport(w io.Writer, report doctor.Report) {
+	for _, check := range report.Checks {
+		message := strings.ReplaceAll(check.Message, "\n", "\n    ")
+		_, _ = fmt.Fprintf(w, "%-7s %s: %s\n", check.Status, check.Name, message)
+		if check.Hint != "" {
+			_, _ = fmt.Fprintf(w, "    hint: %s\n", check.Hint)
+		}
+	}
+}
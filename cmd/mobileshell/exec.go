@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"mobileshell/internal/auth"
+	"mobileshell/internal/remote"
+	"mobileshell/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	apiTokenUser          string
+	execServer            string
+	execToken             string
+	execWorkspace         string
+	execConfirmProduction bool
+)
+
+var addAPITokenCmd = &cobra.Command{
+	Use:   "add-api-token",
+	Short: "Create a token for the API and 'mobileshell exec'",
+	Long: `Create a token for the API and print it to stdout. Scripts and
+'mobileshell exec' pass it in the "Authorization: Bearer ..." header.
+
+The token acts as the user of --user, the default is the admin. Only its hash
+is stored in the api-tokens directory of the state directory. Delete the file
+to revoke the token.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRootUser(allowRoot); err != nil {
+			return err
+		}
+		dir, err := server.GetStateDir(stateDir, false)
+		if err != nil {
+			return err
+		}
+		token, err := auth.AddAPIToken(dir, apiTokenUser)
+		if err != nil {
+			return fmt.Errorf("add API token failed: %w", err)
+		}
+		fmt.Println(token)
+		fmt.Fprintln(os.Stderr, "API token added. It can't be shown again.")
+		return nil
+	},
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec --server URL --workspace ID -- command...",
+	Short: "Run a command on a MobileShell server",
+	Long: `Run a command in a workspace of a MobileShell server, print its stdout and
+stderr, and exit with its exit code.
+
+The token is an API token of the server, see 'mobileshell add-api-token'. Pass
+it with --token or in $MOBILESHELL_TOKEN, the environment variable does not show
+up in the process list. A single argument is run as a shell command line, like
+'make build && make test', several arguments get quoted.
+
+The command runs like one of the web UI and shows up there. Ctrl-C stops
+following the output, the command keeps running on the server.`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token := apiToken(execToken)
+		if execServer == "" || token == "" || execWorkspace == "" {
+			return fmt.Errorf("--server, --workspace and a token are required")
+		}
+		client := &remote.Client{URL: execServer, Token: token}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		code, err := client.Exec(ctx, remote.ExecOptions{
+			Workspace:         execWorkspace,
+			Command:           remote.JoinCommand(args),
+			ConfirmProduction: execConfirmProduction,
+		}, os.Stdout, os.Stderr)
+		if errors.Is(err, context.Canceled) {
+			return fmt.Errorf("stopped following the output, the command keeps running on the server")
+		}
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			os.Exit(code)
+		}
+		return nil
+	},
+}
+
+// apiToken returns the token of the --token flag, or of $MOBILESHELL_TOKEN.
+func apiToken(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	return os.Getenv("MOBILESHELL_TOKEN")
+}
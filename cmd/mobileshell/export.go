@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"mobileshell/internal/export"
+	"mobileshell/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportOptions export.Options
+	exportFrom    string
+	exportTo      string
+	exportOutput  string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the audit log or the command history",
+	Long: `Export the audit log or the command history as signed CSV or JSON.
+
+The audit log contains the processes of the workspaces: which command ran when,
+and how it ended. The history contains every submitted command. Use --from and
+--to (dates like 2006-01-02, both included) to export a date range, for example
+for a change-management or compliance review.
+
+The export is signed with a secret of the state directory. Check that it was not
+modified with 'mobileshell export verify FILE'.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := server.GetStateDir(stateDir, false)
+		if err != nil {
+			return err
+		}
+		opts := exportOptions
+		opts.From, opts.To, err = export.ParseRange(exportFrom, exportTo)
+		if err != nil {
+			return err
+		}
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if exportOutput != "" {
+			file, err := os.OpenFile(exportOutput, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = file.Close() }()
+			w = file
+		}
+		return export.Write(dir, w, opts)
+	},
+}
+
+var exportVerifyCmd = &cobra.Command{
+	Use:   "verify file",
+	Short: "Check the signature of an export",
+	Long: `Check the signature of an export which was created with 'mobileshell export' or
+the Settings page. The exit code is non-zero if the export was modified.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := server.GetStateDir(stateDir, false)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		if err := export.Verify(dir, data); err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		fmt.Printf("%s: signature is valid\n", args[0])
+		return nil
+	},
+}
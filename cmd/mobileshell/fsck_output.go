@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"mobileshell/pkg/outputlog"
+
+	"github.com/spf13/cobra"
+)
+
+var fsckOutputCmd = &cobra.Command{
+	Use:   "fsck-output file",
+	Short: "Check an output log for malformed records",
+	Long: `Check an output log for malformed records, for debugging corrupted logs.
+
+The stream names, timestamps, lengths and separators of all records are checked.
+Malformed regions are listed with their byte offset and size, the check continues
+with the next valid record. Compressed logs (output.log.gz) are read, too. The exit
+code is non-zero if the log has malformed records.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := outputlog.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+
+		report, err := outputlog.Validate(file)
+		if err != nil {
+			return err
+		}
+		printValidationReport(os.Stdout, report)
+		if !report.OK() {
+			return fmt.Errorf("%s: %d malformed regions", args[0], len(report.Problems))
+		}
+		return nil
+	},
+}
+
+// printValidationReport writes one line per malformed region and a summary.
+func printValidationReport(w io.Writer, report *outputlog.ValidationReport) {
+	for _, problem := range report.Problems {
+		_, _ = fmt.Fprintf(w, "offset %d: %v (%d bytes skipped)\n", problem.Offset, problem.Err, problem.Length)
+	}
+	_, _ = fmt.Fprintf(w, "%d valid records, %d bytes\n", report.Records, report.Bytes)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"mobileshell/internal/install"
+
+	"github.com/spf13/cobra"
+)
+
+var installOptions install.Options
+
+var installCmd = &cobra.Command{
+	Use:   "install host user",
+	Short: "Install or upgrade MobileShell on a server with ssh",
+	Long: `Install MobileShell on a server with ssh, as systemd service
+"<user>-mobileshell" which runs as the Linux user. The user gets created if it
+doesn't exist.
+
+The binary is built from the source directory for the platform of the server,
+which is detected with uname. Use --goos and --goarch to override it.
+
+Running it again upgrades the installation in place. The state directory
+/var/lib/mobileshell-<user>, with the passwords and the workspaces, is never
+touched. --upgrade only replaces the binary and restarts the service, and keeps
+a customized service file.
+
+The SSH login is root by default. Other users, see --ssh-user, need
+passwordless sudo on the server. Use --dry-run to inspect the server and print
+the planned steps without changing anything.`,
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := installOptions
+		opts.Host, opts.User = args[0], args[1]
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return install.Run(ctx, opts, os.Stdout)
+	},
+}
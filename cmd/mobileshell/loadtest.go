@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"mobileshell/internal/loadtest"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var loadtestOptions loadtest.Options
+
+var loadtestCmd = &cobra.Command{
+	Use:   "loadtest",
+	Short: "Simulate viewers and command submissions against a server (for development)",
+	Long: `Simulate viewers and command submissions against a running server.
+
+The load test logs in, submits --submissions commands at once to the workspace
+and lets --viewers viewers tail the processes like the Follow toggle of the
+process page. Each viewer also opens the WebSocket of the workspace page. The
+latency percentiles of the endpoints are printed when all processes completed
+or --duration is over. With --server-pid the CPU and memory usage of the server
+is sampled every second.
+
+The password is read from $MOBILESHELL_PASSWORD, or prompted for.
+
+Run it against a test server, the submitted commands really run.`,
+	Hidden:        true,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if loadtestOptions.Workspace == "" {
+			return fmt.Errorf("--workspace is required")
+		}
+		password := os.Getenv("MOBILESHELL_PASSWORD")
+		if password == "" {
+			fmt.Fprint(os.Stderr, "Password: ")
+			passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return fmt.Errorf("failed to read password: %w", err)
+			}
+			password = strings.TrimSpace(string(passwordBytes))
+		}
+		loadtestOptions.Password = password
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		report, err := loadtest.Run(ctx, loadtestOptions)
+		if err != nil {
+			return err
+		}
+		report.Print(os.Stdout)
+		return nil
+	},
+}
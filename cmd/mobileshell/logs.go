@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"mobileshell/internal/remote"
+	"mobileshell/internal/server"
+	"mobileshell/internal/workspace"
+	"mobileshell/pkg/outputlog"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	logsFollow bool
+	logsStream string
+	logsServer string
+	logsToken  string
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs workspace-id process-id",
+	Short: "Print the output of a process",
+	Long: `Print the output of a process, as the process wrote it: stdout goes to stdout
+and stderr to stderr, so that 'mobileshell logs ws p > out.txt' gets the exact
+bytes of stdout. With --stream, only this stream is printed, for example stdin.
+
+With --follow, new output is printed until the process has completed or Ctrl-C
+is pressed.
+
+By default the output log is read from the state directory. With --server, it
+is read with the API of a MobileShell server, see 'mobileshell exec' for the
+token.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeWorkspaceAndProcessIDs,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if logsStream != "" && !outputlog.IsValidStreamName(logsStream) {
+			return fmt.Errorf("invalid stream %q", logsStream)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if logsServer != "" {
+			token := apiToken(logsToken)
+			if token == "" {
+				return fmt.Errorf("a token is required with --server")
+			}
+			client := &remote.Client{URL: logsServer, Token: token}
+			return client.Logs(ctx, remote.LogsOptions{
+				Workspace: args[0],
+				Process:   args[1],
+				Stream:    logsStream,
+				Follow:    logsFollow,
+			}, os.Stdout, os.Stderr)
+		}
+
+		dir, err := server.GetStateDir(stateDir, false)
+		if err != nil {
+			return err
+		}
+		processDir, err := workspace.FindProcessDir(dir, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		return printLogs(ctx, processDir, logsStream, logsFollow, os.Stdout, os.Stderr)
+	},
+}
+
+// printLogs writes the output of the process in processDir to stdout, and its stderr to
+// stderr. An empty stream means stdout and stderr. With follow, it waits for new output
+// until the process has completed.
+func printLogs(ctx context.Context, processDir, stream string, follow bool, stdout, stderr io.Writer) error {
+	stopTail := func() bool { return true }
+	if follow {
+		stopTail = processCompleted(processDir)
+	}
+	for chunk := range outputlog.Tail(ctx, filepath.Join(processDir, "output.log"), tailPollInterval, stopTail) {
+		if chunk.Error != nil {
+			return chunk.Error
+		}
+		if chunk.Stream != stream && (stream != "" || (chunk.Stream != outputlog.StreamStdout && chunk.Stream != outputlog.StreamStderr)) {
+			continue
+		}
+		w := stdout
+		if chunk.Stream == outputlog.StreamStderr {
+			w = stderr
+		}
+		if _, err := w.Write(chunk.Line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,12 +2,21 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"mobileshell/internal/auth"
+	"mobileshell/internal/config"
+	"mobileshell/internal/executor"
+	"mobileshell/internal/export"
+	"mobileshell/internal/loadtest"
 	"mobileshell/internal/nohup"
+	"mobileshell/internal/notify"
 	"mobileshell/internal/server"
+	"mobileshell/internal/webhook"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
@@ -16,11 +25,16 @@ import (
 var (
 	stateDir  string
 	port      string
+	basePath  string
 	allowRoot bool
 	debugHTML bool
 
+	widgetOrigins  []string
+	trustedProxies []string
+
 	inputUnixDomainSocket string
 	workingDirectory      string
+	profile               string
 )
 
 var rootCmd = &cobra.Command{
@@ -45,16 +59,22 @@ var runCmd = &cobra.Command{
 		if err := checkRootUser(allowRoot); err != nil {
 			return err
 		}
-		return server.Run(stateDir, port, debugHTML)
+		cfg, err := runConfig(cmd)
+		if err != nil {
+			return err
+		}
+		return server.Run(cfg, debugHTML)
 	},
 }
 
 var fromStdin bool
 
+var passwordUser string
+
 var addPasswordCmd = &cobra.Command{
 	Use:           "add-password",
 	Short:         "Add a password for authentication",
-	Long:          fmt.Sprintf("Read a password from stdin and add it to the hashed-passwords directory. The password must be at least %d characters long.", auth.MinPasswordLength),
+	Long:          fmt.Sprintf("Read a password from stdin and add it to the hashed-passwords directory. The password must be at least %d characters long. With --user the password belongs to the named user, who can only access own and shared workspaces. Without it the password belongs to the admin, who can access all workspaces.", auth.MinPasswordLength),
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -88,7 +108,12 @@ var addPasswordCmd = &cobra.Command{
 		}
 
 		// Add the password
-		if err := auth.AddPassword(dir, password); err != nil {
+		if passwordUser != "" {
+			err = auth.AddUser(dir, passwordUser, password)
+		} else {
+			err = auth.AddPassword(dir, password)
+		}
+		if err != nil {
 			return fmt.Errorf("add password failed: %w", err)
 		}
 
@@ -121,7 +146,31 @@ invoked by the server when executing processes in nohup mode.`,
 		if len(args) < 1 {
 			return fmt.Errorf("not enough arguments")
 		}
-		return nohup.Run(args, inputUnixDomainSocket, workingDirectory)
+		// The command is in the process directory
+		processDir := filepath.Dir(filepath.Clean(args[0]))
+		// The started event is delivered while the command runs, retries don't delay it
+		started := make(chan struct{})
+		go func() {
+			defer close(started)
+			if err := webhook.ProcessStarted(processDir); err != nil {
+				slog.Error("Failed to deliver webhook", "error", err)
+			}
+		}()
+		if err := nohup.Run(args, inputUnixDomainSocket, workingDirectory, profile); err != nil {
+			return err
+		}
+		// If the process is a pipeline step, start the next one
+		pipelineErr := executor.StartNextPipelineStep(processDir)
+		// Notifications are sent after the next step started, a slow service doesn't delay it
+		if err := notify.ProcessFinished(processDir); err != nil {
+			slog.Error("Failed to send notification", "error", err)
+		}
+		// Webhooks get the events in order
+		<-started
+		if err := webhook.ProcessFinished(processDir); err != nil {
+			slog.Error("Failed to deliver webhook", "error", err)
+		}
+		return pipelineErr
 	},
 	SilenceUsage:  true,
 	SilenceErrors: true,
@@ -129,20 +178,136 @@ invoked by the server when executing processes in nohup mode.`,
 
 func init() {
 	runCmd.Flags().StringVarP(&stateDir, "state-dir", "s", "", "State directory for storing data (default: $STATE_DIRECTORY or .mobileshell)")
-	runCmd.Flags().StringVarP(&port, "port", "p", "22123", "Port to listen on")
+	runCmd.Flags().StringVar(&configFile, "config", "", "YAML config file with the server options, flags which are set override it")
+	runCmd.Flags().StringVar(&listen, "listen", config.DefaultListen, "Host or IP address to listen on")
+	runCmd.Flags().StringVarP(&port, "port", "p", config.DefaultPort, "Port to listen on")
+	runCmd.Flags().StringVar(&basePath, "base-path", "", "URL path prefix of the web UI behind a reverse proxy, e.g. /shell (default: X-Forwarded-Prefix header only)")
+	runCmd.Flags().StringSliceVar(&widgetOrigins, "widget-cors-origin", nil, "Origins which may fetch the widgets with JavaScript, e.g. https://grafana.example.com, or * for all (default: none)")
+	runCmd.Flags().StringSliceVar(&trustedProxies, "trusted-proxy", nil, "Address or CIDR range of a reverse proxy, whose X-Forwarded-For header tells the client address, e.g. 127.0.0.1 (default: none)")
 	runCmd.Flags().BoolVar(&allowRoot, "allow-root", false, "Allow running as root user (not recommended for security reasons)")
 	runCmd.Flags().BoolVar(&debugHTML, "debug-html", false, "Validate HTML responses and return 500 on invalid HTML (for development)")
 
 	addPasswordCmd.Flags().StringVarP(&stateDir, "state-dir", "s", "", "State directory for storing data (default: $STATE_DIRECTORY or .mobileshell)")
 	addPasswordCmd.Flags().BoolVar(&fromStdin, "from-stdin", false, "Read password from stdin without prompting (for scripts)")
+	addPasswordCmd.Flags().StringVar(&passwordUser, "user", "", "Name of the user of the password (default: the admin)")
 	addPasswordCmd.Flags().BoolVar(&allowRoot, "allow-root", false, "Allow running as root user (not recommended for security reasons)")
 
+	addWidgetTokenCmd.Flags().StringVarP(&stateDir, "state-dir", "s", "", "State directory for storing data (default: $STATE_DIRECTORY or .mobileshell)")
+	addWidgetTokenCmd.Flags().StringVar(&widgetTokenName, "name", "", "Name of the token, stored to identify it later, e.g. grafana")
+	addWidgetTokenCmd.Flags().StringVar(&widgetTokenUser, "user", "", "Name of the user whose workspaces the widgets show (default: the admin)")
+	addWidgetTokenCmd.Flags().BoolVar(&allowRoot, "allow-root", false, "Allow running as root user (not recommended for security reasons)")
+
+	addReplicationTokenCmd.Flags().StringVarP(&stateDir, "state-dir", "s", "", "State directory for storing data (default: $STATE_DIRECTORY or .mobileshell)")
+	addReplicationTokenCmd.Flags().StringVar(&replicationTokenName, "name", "", "Name of the token, stored to identify it later, e.g. the host name of the standby")
+	addReplicationTokenCmd.Flags().BoolVar(&allowRoot, "allow-root", false, "Allow running as root user (not recommended for security reasons)")
+
+	addAPITokenCmd.Flags().StringVarP(&stateDir, "state-dir", "s", "", "State directory for storing data (default: $STATE_DIRECTORY or .mobileshell)")
+	addAPITokenCmd.Flags().StringVar(&apiTokenUser, "user", "", "Name of the user of the token (default: the admin)")
+	addAPITokenCmd.Flags().BoolVar(&allowRoot, "allow-root", false, "Allow running as root user (not recommended for security reasons)")
+
+	execCmd.Flags().StringVar(&execServer, "server", "", "Base URL of the server, e.g. https://example.com/shell")
+	execCmd.Flags().StringVar(&execToken, "token", "", "API token of the server (default: $MOBILESHELL_TOKEN)")
+	execCmd.Flags().StringVarP(&execWorkspace, "workspace", "w", "", "ID of the workspace in which the command runs")
+	execCmd.Flags().BoolVar(&execConfirmProduction, "confirm-production", false, "Confirm to run the command in a production workspace")
+
+	replicateCmd.Flags().StringVarP(&stateDir, "state-dir", "s", "", "State directory of the standby (default: $STATE_DIRECTORY or .mobileshell)")
+	replicateCmd.Flags().StringVar(&replicateFrom, "from", "", "Base URL of the primary, e.g. https://primary.example.com/shell")
+	replicateCmd.Flags().StringVar(&replicateTokenFile, "token-file", "", "File which contains the replication token of the primary")
+	replicateCmd.Flags().DurationVar(&replicateInterval, "interval", 5*time.Second, "How often the primary is polled for changes")
+	replicateCmd.Flags().BoolVar(&replicateOnce, "once", false, "Sync once and exit")
+	replicateCmd.Flags().BoolVar(&allowRoot, "allow-root", false, "Allow running as root user (not recommended for security reasons)")
+	_ = replicateCmd.MarkFlagRequired("from")
+	_ = replicateCmd.MarkFlagRequired("token-file")
+
 	nohupCmd.Flags().StringVar(&inputUnixDomainSocket, "input-unix-domain-socket", "", "Read input (like stdin and signals) from unix domain socket.")
 	nohupCmd.Flags().StringVar(&workingDirectory, "working-directory", "", "Working directory for the command")
+	nohupCmd.Flags().StringVar(&profile, "profile", "", "Name of the pre-command profile, passed to the command as MOBILESHELL_PROFILE")
+
+	tailCmd.Flags().StringVarP(&stateDir, "state-dir", "s", "", "State directory for storing data (default: $STATE_DIRECTORY or .mobileshell)")
+	tailCmd.Flags().StringSliceVar(&tailStreams, "stream", nil, "Only show these streams, e.g. --stream stdout,stderr (default: all streams)")
+	tailCmd.Flags().StringVarP(&tailWorkspace, "workspace", "w", "", "Only search the process in this workspace")
+	_ = tailCmd.RegisterFlagCompletionFunc("workspace", completeWorkspaceIDs)
+
+	installCmd.Flags().StringVar(&installOptions.SSHUser, "ssh-user", "root", "User of the SSH login, other users than root need passwordless sudo")
+	installCmd.Flags().StringVar(&installOptions.GOOS, "goos", "", "Operating system of the server (default: detected with uname)")
+	installCmd.Flags().StringVar(&installOptions.GOARCH, "goarch", "", "Architecture of the server, e.g. arm64 (default: detected with uname)")
+	installCmd.Flags().StringVar(&installOptions.Source, "source", ".", "Source directory of MobileShell, which gets built")
+	installCmd.Flags().BoolVar(&installOptions.Upgrade, "upgrade", false, "Only replace the binary of an existing installation and restart the service")
+	installCmd.Flags().BoolVar(&installOptions.DryRun, "dry-run", false, "Print the planned steps without changing anything")
+
+	workspaceCmd.PersistentFlags().StringVarP(&stateDir, "state-dir", "s", "", "State directory for storing data (default: $STATE_DIRECTORY or .mobileshell)")
+	workspaceListCmd.Flags().BoolVar(&workspaceJSON, "json", false, "Print the workspaces as JSON")
+	workspaceListCmd.Flags().BoolVar(&workspaceArchived, "archived", false, "Also list the archived workspaces")
+	workspaceShowCmd.Flags().BoolVar(&workspaceJSON, "json", false, "Print the workspace as JSON")
+	workspaceCreateCmd.Flags().StringVarP(&workspaceDirectory, "directory", "d", "", "Working directory of the commands, it must exist")
+	workspaceCreateCmd.Flags().StringVar(&workspacePreCommand, "pre-command", "", "Command which runs before every command, e.g. 'source .env'")
+	workspaceCreateCmd.Flags().StringVar(&workspaceEnvironment, "environment", "", "Environment: dev, staging or prod (prod asks for a confirmation before a command runs)")
+	workspaceCreateCmd.Flags().StringVar(&workspaceOwner, "owner", "", "User who owns the workspace (default: nobody, all users can access it)")
+	workspaceCreateCmd.Flags().StringSliceVar(&workspaceSharedWith, "shared-with", nil, "Other users who can access the workspace, e.g. --shared-with alice,bob")
+	workspaceCreateCmd.Flags().StringVar(&workspaceColor, "color", "", "Accent color of the workspace, e.g. #dc3545")
+	workspaceCreateCmd.Flags().StringVar(&workspaceIcon, "icon", "", "Icon shown in front of the name, e.g. an emoji")
+	workspaceCreateCmd.Flags().BoolVar(&allowRoot, "allow-root", false, "Allow running as root user (not recommended for security reasons)")
+	_ = workspaceCreateCmd.MarkFlagRequired("directory")
+	workspaceDeleteCmd.Flags().BoolVar(&allowRoot, "allow-root", false, "Allow running as root user (not recommended for security reasons)")
+	workspaceExportCmd.Flags().StringVarP(&workspaceOutput, "output", "o", "", "Write the export to this file (default: stdout)")
+	workspaceImportCmd.Flags().StringVar(&workspaceImport.ID, "id", "", "ID of the imported workspace (default: the ID of the export)")
+	workspaceImportCmd.Flags().StringVarP(&workspaceImport.Directory, "directory", "d", "", "Working directory of the imported workspace (default: the directory of the export)")
+	workspaceImportCmd.Flags().BoolVar(&allowRoot, "allow-root", false, "Allow running as root user (not recommended for security reasons)")
+	workspaceCmd.AddCommand(workspaceListCmd, workspaceShowCmd, workspaceCreateCmd, workspaceArchiveCmd, workspaceUnarchiveCmd, workspaceDeleteCmd, workspaceExportCmd, workspaceImportCmd)
+
+	logsCmd.Flags().StringVarP(&stateDir, "state-dir", "s", "", "State directory for storing data (default: $STATE_DIRECTORY or .mobileshell)")
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Print new output until the process has completed")
+	logsCmd.Flags().StringVar(&logsStream, "stream", "", "Only print this stream, e.g. stdout, stderr or stdin (default: stdout and stderr)")
+	logsCmd.Flags().StringVar(&logsServer, "server", "", "Read the output from this server, e.g. https://example.com/shell")
+	logsCmd.Flags().StringVar(&logsToken, "token", "", "API token of the server (default: $MOBILESHELL_TOKEN)")
+
+	demoCmd.Flags().StringVarP(&port, "port", "p", "22123", "Port to listen on")
+	demoCmd.Flags().BoolVar(&debugHTML, "debug-html", false, "Validate HTML responses and return 500 on invalid HTML (for development)")
+
+	doctorCmd.Flags().StringVarP(&stateDir, "state-dir", "s", "", "State directory for storing data (default: $STATE_DIRECTORY or .mobileshell)")
+
+	loadtestCmd.Flags().StringVar(&loadtestOptions.URL, "url", "http://localhost:22123", "Base URL of the server")
+	loadtestCmd.Flags().StringVarP(&loadtestOptions.Workspace, "workspace", "w", "", "ID of the workspace in which the commands run")
+	loadtestCmd.Flags().IntVar(&loadtestOptions.Viewers, "viewers", 10, "Number of concurrent viewers which tail the processes")
+	loadtestCmd.Flags().IntVar(&loadtestOptions.Submissions, "submissions", 2, "Number of commands which get submitted at once")
+	loadtestCmd.Flags().StringVar(&loadtestOptions.Command, "command", loadtest.DefaultCommand, "Command which gets submitted")
+	loadtestCmd.Flags().DurationVar(&loadtestOptions.Duration, "duration", time.Minute, "Stop the viewers after this duration")
+	loadtestCmd.Flags().DurationVar(&loadtestOptions.PollInterval, "poll-interval", time.Second, "How often a viewer polls for new output")
+	loadtestCmd.Flags().IntVar(&loadtestOptions.ServerPID, "server-pid", 0, "PID of the server, to report its CPU and memory usage")
+
+	exportCmd.PersistentFlags().StringVarP(&stateDir, "state-dir", "s", "", "State directory for storing data (default: $STATE_DIRECTORY or .mobileshell)")
+	exportCmd.Flags().StringVar(&exportOptions.Kind, "kind", export.KindAudit, "What to export: audit or history")
+	exportCmd.Flags().StringVar(&exportOptions.Format, "format", export.FormatCSV, "Format of the export: csv or json")
+	exportCmd.Flags().StringVar(&exportFrom, "from", "", "First day of the range, e.g. 2026-01-01 (default: no limit)")
+	exportCmd.Flags().StringVar(&exportTo, "to", "", "Last day of the range, e.g. 2026-01-31 (default: no limit)")
+	exportCmd.Flags().StringVarP(&exportOptions.Workspace, "workspace", "w", "", "Only export this workspace")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write the export to this file (default: stdout)")
+	_ = exportCmd.RegisterFlagCompletionFunc("workspace", completeWorkspaceIDs)
+	exportCmd.AddCommand(exportVerifyCmd)
+
+	docsManCmd.Flags().StringVar(&manDir, "dir", "man", "Directory to write the man pages to")
+	docsCmd.AddCommand(docsManCmd)
 
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(addPasswordCmd)
+	rootCmd.AddCommand(addWidgetTokenCmd)
+	rootCmd.AddCommand(addReplicationTokenCmd)
+	rootCmd.AddCommand(replicateCmd)
+	rootCmd.AddCommand(addAPITokenCmd)
+	rootCmd.AddCommand(execCmd)
 	rootCmd.AddCommand(nohupCmd)
+	rootCmd.AddCommand(tailCmd)
+	rootCmd.AddCommand(logsCmd)
+	rootCmd.AddCommand(workspaceCmd)
+	rootCmd.AddCommand(installCmd)
+	rootCmd.AddCommand(docsCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(demoCmd)
+	rootCmd.AddCommand(loadtestCmd)
+	rootCmd.AddCommand(fsckOutputCmd)
+	rootCmd.AddCommand(exportCmd)
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
 }
 
 func main() {
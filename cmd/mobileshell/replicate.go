@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"mobileshell/internal/auth"
+	"mobileshell/internal/replication"
+	"mobileshell/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	replicationTokenName string
+	replicateFrom        string
+	replicateTokenFile   string
+	replicateInterval    time.Duration
+	replicateOnce        bool
+)
+
+var addReplicationTokenCmd = &cobra.Command{
+	Use:   "add-replication-token",
+	Short: "Create a token for a standby instance",
+	Long: `Create a token with which a standby instance can replicate the workspaces
+of this instance, and print it to stdout. See 'mobileshell replicate'.
+
+The token can read all workspaces, including the output of all processes. Only
+its hash is stored in the replication-tokens directory of the state directory.
+Delete the file to revoke the token.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRootUser(allowRoot); err != nil {
+			return err
+		}
+		dir, err := server.GetStateDir(stateDir, false)
+		if err != nil {
+			return err
+		}
+		token, err := auth.AddReplicationToken(dir, replicationTokenName)
+		if err != nil {
+			return fmt.Errorf("add replication token failed: %w", err)
+		}
+		fmt.Println(token)
+		fmt.Fprintln(os.Stderr, "Replication token added. It can't be shown again.")
+		return nil
+	},
+}
+
+var replicateCmd = &cobra.Command{
+	Use:   "replicate",
+	Short: "Replicate the workspaces of a primary instance to this warm standby",
+	Long: `Replicate the workspaces of a primary instance to the state directory of this
+warm standby, so that it has near-current processes, output and command history
+when the primary fails.
+
+The primary must be reachable with --from, the token file contains a token of
+'mobileshell add-replication-token' on the primary. Changed files are polled
+every --interval, output logs are transferred incrementally.
+
+Passwords, sessions and deletions are not replicated. Don't run 'mobileshell
+run' on the state directory while replicating. On failover, stop replicating
+and start the server.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRootUser(allowRoot); err != nil {
+			return err
+		}
+		token, err := os.ReadFile(replicateTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read token file: %w", err)
+		}
+		dir, err := server.GetStateDir(stateDir, true)
+		if err != nil {
+			return err
+		}
+		client := &replication.Client{
+			URL:      replicateFrom,
+			Token:    strings.TrimSpace(string(token)),
+			StateDir: dir,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if replicateOnce {
+			stats, err := client.Sync(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Replicated %d files, %d bytes\n", stats.Files, stats.Bytes)
+			return nil
+		}
+		err = client.Run(ctx, replicateInterval)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	},
+}
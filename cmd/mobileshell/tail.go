@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+
+	"mobileshell/internal/process"
+	"mobileshell/internal/server"
+	"mobileshell/internal/workspace"
+	"mobileshell/pkg/outputlog"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// tailPollInterval is how often new output is read when following a process.
+const tailPollInterval = 200 * time.Millisecond
+
+var (
+	tailStreams   []string
+	tailWorkspace string
+)
+
+var tailCmd = &cobra.Command{
+	Use:   "tail process-id",
+	Short: "Follow the output of a process",
+	Long: `Follow the output of a process, like 'tail -f'.
+
+The process is looked up in all workspaces of the state directory. The output
+is streamed until the process has completed or Ctrl-C is pressed.
+
+When stdout is a terminal, stderr is shown in red and other non-stdout streams
+are shown in yellow.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeProcessIDs,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := server.GetStateDir(stateDir, false)
+		if err != nil {
+			return err
+		}
+		processDir, err := workspace.FindProcessDir(dir, tailWorkspace, args[0])
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return tailProcess(ctx, processDir, os.Stdout, term.IsTerminal(int(os.Stdout.Fd())))
+	},
+}
+
+// tailProcess writes the output of the process in processDir to w until the process has completed.
+func tailProcess(ctx context.Context, processDir string, w io.Writer, colored bool) error {
+	for chunk := range outputlog.Tail(ctx, filepath.Join(processDir, "output.log"), tailPollInterval, processCompleted(processDir)) {
+		if chunk.Error != nil {
+			return chunk.Error
+		}
+		if len(tailStreams) > 0 && !slices.Contains(tailStreams, chunk.Stream) {
+			continue
+		}
+		if _, err := w.Write(colorizeLine(chunk.Stream, chunk.Line, colored)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processCompleted returns a function which reports whether the process in processDir has
+// completed, or can't be loaded anymore.
+func processCompleted(processDir string) func() bool {
+	return func() bool {
+		proc, err := process.LoadProcessFromDir(processDir)
+		return err != nil || proc.Completed
+	}
+}
+
+// colorizeLine wraps line in ANSI color codes depending on the stream.
+func colorizeLine(stream string, line []byte, colored bool) []byte {
+	if !colored || stream == outputlog.StreamStdout {
+		return line
+	}
+	color := "\x1b[33m" // yellow
+	if stream == outputlog.StreamStderr {
+		color = "\x1b[31m" // red
+	}
+	return fmt.Appendf(nil, "%s%s\x1b[0m", color, line)
+}
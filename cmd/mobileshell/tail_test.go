@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mobileshell/internal/process"
+	"mobileshell/pkg/outputlog"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestColorizeLine(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		stream  string
+		colored bool
+		want    string
+	}{
+		{"stdout", outputlog.StreamStdout, true, "line\n"},
+		{"stderr red", outputlog.StreamStderr, true, "\x1b[31mline\n\x1b[0m"},
+		{"other stream yellow", outputlog.StreamStdin, true, "\x1b[33mline\n\x1b[0m"},
+		{"stderr not colored", outputlog.StreamStderr, false, "line\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, string(colorizeLine(tt.stream, []byte("line\n"), tt.colored)))
+		})
+	}
+}
+
+// notifyingWriter collects the output and closes first on the first write. It is only written
+// by tailProcess, the output is read after tailProcess returned.
+type notifyingWriter struct {
+	buf   strings.Builder
+	first chan struct{}
+}
+
+func (w *notifyingWriter) Write(p []byte) (int, error) {
+	if w.buf.Len() == 0 {
+		close(w.first)
+	}
+	return w.buf.Write(p)
+}
+
+func TestTailProcess(t *testing.T) {
+	t.Parallel()
+	processDir := filepath.Join(t.TempDir(), "2025-01-07T10:00:00Z")
+	require.NoError(t, os.MkdirAll(processDir, 0o700))
+	for name, content := range map[string]string{"cmd": "make", "starttime": "2025-01-07T10:00:00Z", "completed": "false"} {
+		require.NoError(t, os.WriteFile(filepath.Join(processDir, name), []byte(content), 0o600))
+	}
+	outputFile := filepath.Join(processDir, "output.log")
+	appendChunk := func(stream, line string) {
+		f, err := os.OpenFile(outputFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		require.NoError(t, err)
+		_, err = f.Write(outputlog.FormatChunk(outputlog.Chunk{Stream: stream, Timestamp: time.Now().UTC(), Line: []byte(line)}))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	appendChunk(outputlog.StreamStdout, "first\n")
+
+	w := &notifyingWriter{first: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		done <- tailProcess(t.Context(), processDir, w, true)
+	}()
+
+	// The output which is written while tail runs is followed until the process completed
+	select {
+	case <-w.first:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "tail did not print the first line")
+	}
+	appendChunk(outputlog.StreamStderr, "second\n")
+	require.NoError(t, process.Complete(processDir))
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "tail did not stop when the process completed")
+	}
+	require.Equal(t, "first\n\x1b[31msecond\n\x1b[0m", w.buf.String())
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"mobileshell/internal/auth"
+	"mobileshell/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	widgetTokenName string
+	widgetTokenUser string
+)
+
+var addWidgetTokenCmd = &cobra.Command{
+	Use:   "add-widget-token",
+	Short: "Create a token for the embeddable widgets",
+	Long: `Create a token for the embeddable widgets and print it to stdout.
+
+The widgets are HTML fragments for third-party dashboards like Grafana:
+/widgets/running-processes, /widgets/sysmon and /widgets/workspaces. Pass the
+token as "?token=..." query parameter or as "Authorization: Bearer ..." header.
+
+The widgets show the workspaces of the user of --user, the default is the
+admin. Only tokens of the admin can show the sysmon widget.
+
+The token can only read the widgets. Only its hash is stored in the
+widget-tokens directory of the state directory. Delete the file to revoke the
+token.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRootUser(allowRoot); err != nil {
+			return err
+		}
+		dir, err := server.GetStateDir(stateDir, false)
+		if err != nil {
+			return err
+		}
+		token, err := auth.AddWidgetToken(dir, widgetTokenName, widgetTokenUser)
+		if err != nil {
+			return fmt.Errorf("add widget token failed: %w", err)
+		}
+		fmt.Println(token)
+		fmt.Fprintln(os.Stderr, "Widget token added. It can't be shown again.")
+		return nil
+	},
+}
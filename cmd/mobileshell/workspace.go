@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"mobileshell/internal/server"
+	"mobileshell/internal/workspace"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	workspaceJSON        bool
+	workspaceArchived    bool
+	workspaceDirectory   string
+	workspacePreCommand  string
+	workspaceEnvironment string
+	workspaceOwner       string
+	workspaceSharedWith  []string
+	workspaceColor       string
+	workspaceIcon        string
+	workspaceOutput      string
+	workspaceImport      workspace.ImportOptions
+)
+
+var workspaceCmd = &cobra.Command{
+	Use:   "workspace",
+	Short: "Manage the workspaces of the state directory",
+	Long: `List, show, create, archive, delete, export and import the workspaces of the
+state directory, for example in provisioning scripts. The changes show up in a running
+server right away.`,
+	Args: cobra.NoArgs,
+}
+
+var workspaceListCmd = &cobra.Command{
+	Use:           "list",
+	Short:         "List the workspaces",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := server.GetStateDir(stateDir, false)
+		if err != nil {
+			return err
+		}
+		workspaces, err := workspace.ListWorkspacesMatching(dir, workspace.WorkspaceFilter{Archived: workspaceArchived})
+		if err != nil {
+			return err
+		}
+		if workspaceJSON {
+			// An empty list, not null
+			return printJSON(append([]*workspace.Workspace{}, workspaces...))
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ID\tNAME\tENVIRONMENT\tOWNER\tDIRECTORY")
+		for _, ws := range workspaces {
+			name := ws.Name
+			if ws.IsArchived() {
+				name += " (archived)"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", ws.ID, name, ws.Environment, ws.Owner, ws.Directory)
+		}
+		return w.Flush()
+	},
+}
+
+var workspaceShowCmd = &cobra.Command{
+	Use:               "show workspace-id",
+	Short:             "Show the settings of a workspace",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeWorkspaceIDs,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ws, err := loadWorkspace(args[0])
+		if err != nil {
+			return err
+		}
+		if workspaceJSON {
+			return printJSON(ws)
+		}
+		fmt.Printf("ID:          %s\n", ws.ID)
+		fmt.Printf("Name:        %s\n", ws.Name)
+		fmt.Printf("Directory:   %s\n", ws.Directory)
+		fmt.Printf("Environment: %s\n", ws.Environment)
+		fmt.Printf("Owner:       %s\n", ws.Owner)
+		fmt.Printf("Shared with: %s\n", strings.Join(ws.SharedWith, ", "))
+		fmt.Printf("Created:     %s\n", ws.CreatedAt.Format("2006-01-02 15:04:05 UTC"))
+		fmt.Printf("Profiles:    %s\n", strings.Join(ws.ProfileNames(), ", "))
+		fmt.Printf("Pre-command:\n%s\n", ws.PreCommand)
+		return nil
+	},
+}
+
+var workspaceCreateCmd = &cobra.Command{
+	Use:   "create name",
+	Short: "Create a workspace",
+	Long: `Create a workspace and print its ID. The ID is derived from the name.
+
+Without --owner, all users can access the workspace.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRootUser(allowRoot); err != nil {
+			return err
+		}
+		dir, err := server.GetStateDir(stateDir, false)
+		if err != nil {
+			return err
+		}
+		if workspaceOwner == "" && len(workspaceSharedWith) > 0 {
+			return fmt.Errorf("--shared-with needs --owner, without owner all users can access the workspace")
+		}
+		ws, err := workspace.CreateWorkspace(dir, args[0], workspaceDirectory, workspacePreCommand)
+		if err != nil {
+			return err
+		}
+		err = workspace.SaveEnvironment(ws, workspaceEnvironment)
+		if err == nil {
+			err = workspace.SaveIdentity(ws, workspaceColor, workspaceIcon)
+		}
+		if err == nil {
+			err = server.SaveOwner(dir, ws, workspaceOwner, workspaceSharedWith)
+		}
+		if err != nil {
+			// Don't leave a half configured workspace behind
+			_ = os.RemoveAll(ws.Path)
+			return err
+		}
+		fmt.Println(ws.ID)
+		return nil
+	},
+}
+
+var workspaceDeleteCmd = &cobra.Command{
+	Use:   "delete workspace-id",
+	Short: "Delete a workspace",
+	Long: `Delete a workspace and the output of its processes from the state directory.
+The working directory is not touched. Workspaces with running processes can't
+be deleted.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeWorkspaceIDs,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRootUser(allowRoot); err != nil {
+			return err
+		}
+		ws, err := loadWorkspace(args[0])
+		if err != nil {
+			return err
+		}
+		return workspace.DeleteWorkspace(ws)
+	},
+}
+
+var workspaceArchiveCmd = &cobra.Command{
+	Use:   "archive workspace-id",
+	Short: "Archive a workspace",
+	Long: `Archive a workspace: it is hidden from the lists of workspaces and runs no new
+commands. Its processes and their output are kept and can be browsed. Queued
+processes get cancelled when it is their turn.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeWorkspaceIDs,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ws, err := loadWorkspace(args[0])
+		if err != nil {
+			return err
+		}
+		return workspace.SaveArchived(ws, true)
+	},
+}
+
+var workspaceUnarchiveCmd = &cobra.Command{
+	Use:               "unarchive workspace-id",
+	Short:             "Unarchive a workspace, so that it runs commands again",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeWorkspaceIDs,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ws, err := loadWorkspace(args[0])
+		if err != nil {
+			return err
+		}
+		return workspace.SaveArchived(ws, false)
+	},
+}
+
+var workspaceExportCmd = &cobra.Command{
+	Use:   "export workspace-id",
+	Short: "Export a workspace as tar.gz",
+	Long: `Export the settings, the processes and the output logs of a workspace as
+tar.gz, as backup or to move the workspace to another server with
+'mobileshell workspace import'. The working directory is not exported.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeWorkspaceIDs,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ws, err := loadWorkspace(args[0])
+		if err != nil {
+			return err
+		}
+		var w io.Writer = os.Stdout
+		if workspaceOutput != "" {
+			file, err := os.OpenFile(workspaceOutput, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = file.Close() }()
+			w = file
+		}
+		return workspace.Export(ws, w)
+	},
+}
+
+var workspaceImportCmd = &cobra.Command{
+	Use:   "import file",
+	Short: "Import a workspace from an export",
+	Long: `Import a workspace which was exported with 'mobileshell workspace export' and
+print its ID. Use - as file to read the export from stdin.
+
+If a workspace with the ID of the export exists, the imported workspace gets
+the ID with the suffix -2, -3, ... Processes which were running when the
+workspace was exported are marked as finished with an unknown exit status.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRootUser(allowRoot); err != nil {
+			return err
+		}
+		dir, err := server.GetStateDir(stateDir, false)
+		if err != nil {
+			return err
+		}
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer func() { _ = file.Close() }()
+			r = file
+		}
+		ws, err := workspace.Import(dir, r, workspaceImport)
+		if err != nil {
+			return err
+		}
+		fmt.Println(ws.ID)
+		return nil
+	},
+}
+
+// loadWorkspace loads the workspace with the ID from the state directory.
+func loadWorkspace(id string) (*workspace.Workspace, error) {
+	dir, err := server.GetStateDir(stateDir, false)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("invalid workspace id: %q", id)
+	}
+	ws, err := workspace.GetWorkspaceByID(dir, id)
+	if err != nil {
+		return nil, fmt.Errorf("workspace %q not found", id)
+	}
+	return ws, nil
+}
+
+// printJSON writes v as indented JSON to stdout.
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,204 @@
+// Package activity keeps an index of the process starts and completions of all workspaces, so
+// that the start page shows the recent activity without reading the processes of every
+// workspace.
+//
+// The events are appended to stateDir/activity.log in the outputlog format, like the audit
+// log: each event is a chunk of the stream "activity" with the event as JSON. The server, the
+// terminal recorder and the nohup processes append to it concurrently, each event is a single
+// write. When the file grows beyond
+// maxSize, it is rewritten with the newest events which fill half of it. An event which another process
+// appends during the rewrite can get lost, the index is only for the overview.
+package activity
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"mobileshell/internal/metadata"
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+	"mobileshell/pkg/outputlog"
+)
+
+// StreamActivity is the outputlog stream of the events.
+const StreamActivity = "activity"
+
+// logFile is the index in the state directory.
+const logFile = "activity.log"
+
+// maxSize is the size of the index which starts a rewrite, see compact.
+const maxSize = 512 << 10
+
+// Types of an Event.
+const (
+	EventStarted  = "started"
+	EventFinished = "finished"
+)
+
+func init() {
+	outputlog.RegisterStream(StreamActivity)
+}
+
+// Event is the start or the completion of a process.
+type Event struct {
+	Time      time.Time `json:"-"` // The timestamp of the chunk
+	Type      string    `json:"type"`
+	Workspace string    `json:"workspace"` // ID of the workspace
+	Process   string    `json:"process"`   // ID of the process
+	Command   string    `json:"command"`
+	Started   time.Time `json:"started,omitzero"`    // Start time of finished processes
+	ExitCode  int       `json:"exit_code,omitempty"` // Of finished processes
+	Signal    string    `json:"signal,omitempty"`    // Of finished processes which were killed
+}
+
+// Failed returns true if the finished process failed.
+func (e Event) Failed() bool {
+	return e.Type == EventFinished && (e.ExitCode != 0 || e.Signal != "")
+}
+
+// mu serializes the appends of this process.
+var mu sync.Mutex
+
+// Record appends e to the index of stateDir. A zero e.Time is set to now.
+func Record(stateDir string, e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	chunk := outputlog.FormatChunk(outputlog.Chunk{Stream: StreamActivity, Timestamp: e.Time, Line: data})
+
+	mu.Lock()
+	defer mu.Unlock()
+	path := filepath.Join(stateDir, logFile)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open activity log: %w", err)
+	}
+	_, err = f.Write(chunk)
+	var size int64
+	if err == nil {
+		var info os.FileInfo
+		if info, err = f.Stat(); err == nil {
+			size = info.Size()
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write activity log: %w", err)
+	}
+	if size > maxSize {
+		return compact(path)
+	}
+	return nil
+}
+
+// compact rewrites the index at path with its newest events which fit into half of maxSize,
+// so that the next rewrite is far away.
+func compact(path string) error {
+	chunks, _, err := outputlog.ReadFrom(path, 0)
+	if err != nil {
+		return fmt.Errorf("failed to read activity log: %w", err)
+	}
+	var kept [][]byte
+	size := 0
+	for _, chunk := range slices.Backward(chunks) {
+		formatted := outputlog.FormatChunk(chunk)
+		if size+len(formatted) > maxSize/2 {
+			break
+		}
+		kept = append(kept, formatted)
+		size += len(formatted)
+	}
+	slices.Reverse(kept)
+	data := slices.Concat(kept...)
+	if err := metadata.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write activity log: %w", err)
+	}
+	return nil
+}
+
+// Recent returns the newest events of stateDir for which match returns true, at most limit.
+// A nil match matches all events.
+func Recent(stateDir string, limit int, match func(Event) bool) ([]Event, error) {
+	chunks, _, err := outputlog.ReadFrom(filepath.Join(stateDir, logFile), 0)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read activity log: %w", err)
+	}
+	var events []Event
+	for _, chunk := range slices.Backward(chunks) {
+		if chunk.Stream != StreamActivity {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(chunk.Line, &e); err != nil {
+			// A concurrent append or rewrite can break an event, the others are still shown
+			slog.Warn("Skipping invalid activity log entry", "time", chunk.Timestamp, "error", err)
+			continue
+		}
+		e.Time = chunk.Timestamp
+		if match != nil && !match(e) {
+			continue
+		}
+		events = append(events, e)
+		if len(events) == limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+// ProcessStarted records the start of the process in processDir.
+func ProcessStarted(processDir string) error {
+	stateDir, ws, p, err := loadProcess(processDir)
+	if err != nil {
+		return err
+	}
+	return Record(stateDir, Event{Type: EventStarted, Workspace: ws.ID, Process: p.CommandId, Command: p.Command})
+}
+
+// ProcessFinished records the completion of the process in processDir, which ended at end with
+// exitCode, and signal if it was killed. It is called right before process.Complete, so that
+// nothing is written to the state directory after the process completed.
+func ProcessFinished(processDir string, end time.Time, exitCode int, signal string) error {
+	stateDir, ws, p, err := loadProcess(processDir)
+	if err != nil {
+		return err
+	}
+	return Record(stateDir, Event{
+		Time:      end,
+		Type:      EventFinished,
+		Workspace: ws.ID,
+		Process:   p.CommandId,
+		Command:   p.Command,
+		Started:   p.StartTime,
+		ExitCode:  exitCode,
+		Signal:    signal,
+	})
+}
+
+// loadProcess returns the state directory, the workspace and the process of processDir.
+func loadProcess(processDir string) (string, *workspace.Workspace, *process.Process, error) {
+	stateDir, ws, err := workspace.GetWorkspaceOfProcess(processDir)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	p, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return stateDir, ws, p, nil
+}
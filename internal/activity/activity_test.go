@@ -0,0 +1,72 @@
+package activity
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mobileshell/pkg/outputlog"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndRecent(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	events, err := Recent(stateDir, 10, nil)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	day := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, Record(stateDir, Event{Time: day, Type: EventStarted, Workspace: "builds", Process: "p1", Command: "make"}))
+	require.NoError(t, Record(stateDir, Event{Time: day.Add(time.Second), Type: EventStarted, Workspace: "docs", Process: "p2", Command: "hugo"}))
+	finished := Event{Time: day.Add(time.Minute), Type: EventFinished, Workspace: "builds", Process: "p1", Command: "make", Started: day, ExitCode: 2}
+	require.NoError(t, Record(stateDir, finished))
+
+	events, err = Recent(stateDir, 10, nil)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, finished, events[0])
+	require.True(t, events[0].Failed())
+	require.Equal(t, "p2", events[1].Process)
+	require.False(t, events[1].Failed())
+
+	events, err = Recent(stateDir, 1, nil)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	events, err = Recent(stateDir, 10, func(e Event) bool { return e.Workspace == "docs" })
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, "hugo", events[0].Command)
+
+	require.NoError(t, outputlog.Verify(filepath.Join(stateDir, logFile)))
+
+	// A broken event is skipped
+	f, err := os.OpenFile(filepath.Join(stateDir, logFile), os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.Write(outputlog.FormatChunk(outputlog.Chunk{Stream: StreamActivity, Timestamp: day.Add(time.Hour), Line: []byte(`{"type":`)}))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	events, err = Recent(stateDir, 10, nil)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, finished, events[0])
+}
+
+func TestRecordCompacts(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	e := Event{Type: EventStarted, Workspace: "builds", Process: "p1", Command: strings.Repeat("x", 1000)}
+	for range maxSize/1000 + 1 {
+		require.NoError(t, Record(stateDir, e))
+	}
+	info, err := os.Stat(filepath.Join(stateDir, logFile))
+	require.NoError(t, err)
+	require.Less(t, info.Size(), int64(maxSize))
+	events, err := Recent(stateDir, maxSize, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	require.Less(t, len(events), maxSize/1000)
+}
@@ -0,0 +1,147 @@
+// Package audit records the actions of logged-in users, like commands, stdin, signals and
+// file writes, so that it is clear who did what on a shared server.
+//
+// The entries are appended to stateDir/audit.log in the outputlog format: each entry is a chunk
+// of the stream "audit" with the entry as JSON. The file is never rewritten.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"mobileshell/pkg/outputlog"
+)
+
+// StreamAudit is the outputlog stream of the entries.
+const StreamAudit = "audit"
+
+// logFile is the audit log in the state directory.
+const logFile = "audit.log"
+
+// Actions of an Entry.
+const (
+	ActionLogin           = "login"
+	ActionLoginFailed     = "login-failed"
+	ActionLogout          = "logout"
+	ActionExecute         = "execute"
+	ActionExecuteDenied   = "execute-denied"
+	ActionStdin           = "stdin"
+	ActionStdinClose      = "stdin-close"
+	ActionSignal          = "signal"
+	ActionFileWrite       = "file-write"
+	ActionTerminal        = "terminal"
+	ActionWorkspaceCreate = "workspace-create"
+	ActionWorkspaceChange = "workspace-change"
+	ActionProcessDelete   = "process-delete"
+	ActionShare           = "share"
+	ActionSettings        = "settings"
+)
+
+// Actions are all actions, for the filter of the audit page.
+var Actions = []string{
+	ActionLogin, ActionLoginFailed, ActionLogout, ActionExecute, ActionExecuteDenied, ActionStdin,
+	ActionStdinClose, ActionSignal, ActionFileWrite, ActionTerminal, ActionWorkspaceCreate,
+	ActionWorkspaceChange, ActionProcessDelete, ActionShare, ActionSettings,
+}
+
+func init() {
+	outputlog.RegisterStream(StreamAudit)
+}
+
+// Entry is one action.
+type Entry struct {
+	Time      time.Time `json:"-"` // The timestamp of the chunk
+	Action    string    `json:"action"`
+	User      string    `json:"user,omitempty"`      // The logged-in user, empty for failed logins
+	Remote    string    `json:"remote"`              // Address of the client, with X-Forwarded-For if set
+	Workspace string    `json:"workspace,omitempty"` // ID of the workspace
+	Process   string    `json:"process,omitempty"`   // ID of the process
+	Detail    string    `json:"detail,omitempty"`    // Like the command or the path of the file
+}
+
+// mu serializes the appends of the server, so that chunks don't interleave.
+var mu sync.Mutex
+
+// Record appends e to the audit log of stateDir. A zero e.Time is set to now.
+func Record(stateDir string, e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	chunk := outputlog.FormatChunk(outputlog.Chunk{Stream: StreamAudit, Timestamp: e.Time, Line: data})
+
+	mu.Lock()
+	defer mu.Unlock()
+	f, err := os.OpenFile(filepath.Join(stateDir, logFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	_, err = f.Write(chunk)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Filter selects entries. Zero fields match all entries.
+type Filter struct {
+	Action    string
+	User      string
+	Workspace string
+	Query     string    // Substring of the detail or the remote address, case-insensitive
+	From      time.Time // Included
+	To        time.Time // Excluded
+}
+
+// Matches returns true if e is selected by f.
+func (f Filter) Matches(e Entry) bool {
+	query := strings.ToLower(f.Query)
+	return (f.Action == "" || e.Action == f.Action) &&
+		(f.User == "" || e.User == f.User) &&
+		(f.Workspace == "" || e.Workspace == f.Workspace) &&
+		(query == "" || strings.Contains(strings.ToLower(e.Detail), query) || strings.Contains(e.Remote, query)) &&
+		(f.From.IsZero() || !e.Time.Before(f.From)) &&
+		(f.To.IsZero() || e.Time.Before(f.To))
+}
+
+// List returns the entries of stateDir which match f, the newest first, at most limit.
+func List(stateDir string, f Filter, limit int) ([]Entry, error) {
+	chunks, _, err := outputlog.ReadFrom(filepath.Join(stateDir, logFile), 0)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	var entries []Entry
+	for _, chunk := range slices.Backward(chunks) {
+		if chunk.Stream != StreamAudit {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(chunk.Line, &e); err != nil {
+			return nil, fmt.Errorf("invalid audit log entry at %s: %w", chunk.Timestamp, err)
+		}
+		e.Time = chunk.Timestamp
+		if !f.Matches(e) {
+			continue
+		}
+		entries = append(entries, e)
+		if len(entries) == limit {
+			break
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mobileshell/pkg/outputlog"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndList(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	entries, err := List(stateDir, Filter{}, 10)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	day := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, Record(stateDir, Entry{Time: day, Action: ActionLogin, Remote: "10.0.0.1:1234"}))
+	require.NoError(t, Record(stateDir, Entry{Time: day.Add(time.Minute), Action: ActionExecute, Remote: "10.0.0.1:1234", Workspace: "builds", Process: "p1", Detail: "make Deploy"}))
+	require.NoError(t, Record(stateDir, Entry{Time: day.Add(24 * time.Hour), Action: ActionFileWrite, Remote: "10.0.0.2:1234", Workspace: "docs", Detail: "README.md"}))
+
+	entries, err = List(stateDir, Filter{}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, ActionFileWrite, entries[0].Action)
+	require.Equal(t, Entry{Time: day.Add(time.Minute), Action: ActionExecute, Remote: "10.0.0.1:1234", Workspace: "builds", Process: "p1", Detail: "make Deploy"}, entries[1])
+
+	entries, err = List(stateDir, Filter{}, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	entries, err = List(stateDir, Filter{Workspace: "builds"}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	entries, err = List(stateDir, Filter{Query: "deploy"}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	entries, err = List(stateDir, Filter{Query: "10.0.0.1"}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	entries, err = List(stateDir, Filter{Action: ActionLogin}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	entries, err = List(stateDir, Filter{From: day.Add(time.Minute), To: day.Add(time.Hour)}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, ActionExecute, entries[0].Action)
+
+	// The file is a valid output log
+	require.NoError(t, outputlog.Verify(filepath.Join(stateDir, logFile)))
+	data, err := os.ReadFile(filepath.Join(stateDir, logFile))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `audit 2026-01-02T10:00:00Z 43: {"action":"login","remote":"10.0.0.1:1234"}`+"\n")
+}
@@ -10,12 +10,46 @@ import (
 	mathrand "math/rand/v2"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const MinPasswordLength = 36
 
+// AdminUser owns the passwords without a user name, like the ones from before named users
+// existed. The admin can access all workspaces, other users only their own and the ones shared
+// with them.
+const AdminUser = "admin"
+
+var usernameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ValidUsername returns an error if name can't be used as user name.
+func ValidUsername(name string) error {
+	if !usernameRegex.MatchString(name) {
+		return fmt.Errorf("invalid user name %q: use up to 32 lowercase letters, digits, - and _", name)
+	}
+	return nil
+}
+
+// Session is a login of a user.
+type Session struct {
+	User      string
+	Login     time.Time
+	Expiry    time.Time
+	ID        string // Stays the same when the session gets extended, see RevokeSession
+	Remote    string // Address of the client at the login
+	UserAgent string // User-Agent header of the client at the login
+}
+
+// Client is the client of a login, it gets stored with the session.
+type Client struct {
+	Remote    string
+	UserAgent string
+}
+
 func InitAuth(stateDir string) error {
 	// Create sessions directory if it doesn't exist
 	sessionsDir := filepath.Join(stateDir, "sessions")
@@ -25,7 +59,9 @@ func InitAuth(stateDir string) error {
 	return nil
 }
 
-func Authenticate(ctx context.Context, stateDir, password string) (string, bool) {
+// Authenticate checks the password and creates a session for the client. It returns the token
+// of the session.
+func Authenticate(ctx context.Context, stateDir, password string, client Client) (string, bool) {
 	if len(password) < MinPasswordLength {
 		slog.Debug("Password too short")
 		return "", false
@@ -34,9 +70,10 @@ func Authenticate(ctx context.Context, stateDir, password string) (string, bool)
 	hash := sha256.Sum256([]byte(password))
 	hashedPassword := hex.EncodeToString(hash[:])
 
-	// Check if file exists in stateDir/hashed-passwords/
+	// Check if file exists in stateDir/hashed-passwords/, it contains the name of the user
 	passwordFilePath := filepath.Join(stateDir, "hashed-passwords", hashedPassword)
-	if _, err := os.Stat(passwordFilePath); os.IsNotExist(err) {
+	user, err := os.ReadFile(passwordFilePath)
+	if err != nil {
 		// Add random delay to mitigate timing attacks
 		time.Sleep(time.Duration(10+mathrand.Int32N(1000)) * time.Microsecond)
 		slog.Debug("password file not found. Authenticate failed", "path", passwordFilePath)
@@ -44,28 +81,97 @@ func Authenticate(ctx context.Context, stateDir, password string) (string, bool)
 	}
 
 	token := generateToken()
-	expiry := time.Now().UTC().Add(24 * time.Hour)
+	session := Session{
+		User:      userOf(user),
+		Login:     time.Now().UTC(),
+		ID:        generateToken()[:16],
+		Remote:    client.Remote,
+		UserAgent: client.UserAgent,
+	}
+	session.Expiry = session.Login.Add(LoadSessionConfig(stateDir).Duration)
 
 	// Hash the token for storage (security: don't store raw tokens)
 	tokenHash := sha256.Sum256([]byte(token))
 	hashedToken := hex.EncodeToString(tokenHash[:])
 
 	// Persist session to disk
-	if err := saveSession(stateDir, hashedToken, expiry); err != nil {
+	if err := saveSession(stateDir, hashedToken, session); err != nil {
 		slog.Warn("Failed to persist session", "error", err)
 	}
 
 	return token, true
 }
 
-// saveSession saves a session to disk
-func saveSession(stateDir, hashedToken string, expiry time.Time) error {
+// userOf returns the user of the content of a password file. Empty files are from before named
+// users existed, they belong to the admin.
+func userOf(content []byte) string {
+	if user := strings.TrimSpace(string(content)); user != "" {
+		return user
+	}
+	return AdminUser
+}
+
+// saveSession saves a session to disk. The login time is the time of the login which created
+// the session, extended sessions keep it.
+func saveSession(stateDir, hashedToken string, session Session) error {
 	sessionsDir := filepath.Join(stateDir, "sessions")
 	sessionPath := filepath.Join(sessionsDir, hashedToken)
 
-	// Write expiry time as Unix timestamp
-	expiryStr := strconv.FormatInt(expiry.Unix(), 10)
-	return os.WriteFile(sessionPath, []byte(expiryStr), 0o600)
+	// Write expiry and login time as Unix timestamps, followed by the user. The metadata
+	// follows on lines of the form key=value.
+	content := strconv.FormatInt(session.Expiry.Unix(), 10) + " " + strconv.FormatInt(session.Login.Unix(), 10) + " " + session.User + "\n" +
+		"id=" + session.ID + "\n" +
+		"remote=" + oneLine(session.Remote) + "\n" +
+		"user-agent=" + oneLine(session.UserAgent) + "\n"
+	return os.WriteFile(sessionPath, []byte(content), 0o600)
+}
+
+// oneLine replaces the line breaks of s, so that it fits into a line of a session file.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// legacySessionDuration was the fixed duration of sessions, before sessions stored their login
+// time. It is used to derive the login time of these sessions.
+const legacySessionDuration = 24 * time.Hour
+
+// parseSession parses the content of a session file. The session expires at its Expiry, which
+// is capped by the maximum lifetime after the login. Sessions without a user are from before
+// named users existed, they belong to the admin. Sessions from before the metadata existed
+// have only the first line.
+func parseSession(data []byte, config SessionConfig) (Session, error) {
+	first, metadata, _ := strings.Cut(string(data), "\n")
+	expiryStr, rest, hasLogin := strings.Cut(first, " ")
+	expiryUnix, err := strconv.ParseInt(expiryStr, 10, 64)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to parse session expiry: %w", err)
+	}
+	session := Session{User: AdminUser, Expiry: time.Unix(expiryUnix, 0).UTC()}
+	session.Login = session.Expiry.Add(-legacySessionDuration)
+	if hasLogin {
+		loginStr, user, _ := strings.Cut(rest, " ")
+		loginUnix, err := strconv.ParseInt(loginStr, 10, 64)
+		if err != nil {
+			return Session{}, fmt.Errorf("failed to parse session login time: %w", err)
+		}
+		session.Login = time.Unix(loginUnix, 0).UTC()
+		session.User = userOf([]byte(user))
+	}
+	for line := range strings.Lines(metadata) {
+		key, value, _ := strings.Cut(strings.TrimSuffix(line, "\n"), "=")
+		switch key {
+		case "id":
+			session.ID = value
+		case "remote":
+			session.Remote = value
+		case "user-agent":
+			session.UserAgent = value
+		}
+	}
+	if absolute := session.Login.Add(config.MaxLifetime); absolute.Before(session.Expiry) {
+		session.Expiry = absolute
+	}
+	return session, nil
 }
 
 func ValidateSession(stateDir, token string) (bool, error) {
@@ -73,8 +179,19 @@ func ValidateSession(stateDir, token string) (bool, error) {
 	return valid, err
 }
 
-// ValidateSessionWithExpiry validates a session and returns the expiry time
+// ValidateSessionWithExpiry validates a session and returns the expiry time. Sessions expire
+// after the duration of the SessionConfig, and at the latest after its maximum lifetime.
 func ValidateSessionWithExpiry(stateDir, token string) (bool, time.Time, error) {
+	session, err := LookupSession(stateDir, token)
+	if session == nil {
+		return false, time.Time{}, err
+	}
+	return true, session.Expiry, nil
+}
+
+// LookupSession returns the session of token. It returns nil if the token is invalid or
+// expired.
+func LookupSession(stateDir, token string) (*Session, error) {
 	// Hash the token to look it up
 	tokenHash := sha256.Sum256([]byte(token))
 	hashedToken := hex.EncodeToString(tokenHash[:])
@@ -82,91 +199,88 @@ func ValidateSessionWithExpiry(stateDir, token string) (bool, time.Time, error)
 	sessionsDir := filepath.Join(stateDir, "sessions")
 	sessionPath := filepath.Join(sessionsDir, hashedToken)
 
-	// Read session file
-	data, err := os.ReadFile(sessionPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Add random delay to mitigate timing attacks
-			time.Sleep(time.Duration(10+mathrand.Int32N(1000)) * time.Microsecond)
-			return false, time.Time{}, nil
-		}
-		return false, time.Time{}, fmt.Errorf("failed to read session file: %w", err)
+	session, err := readSession(sessionPath, LoadSessionConfig(stateDir))
+	if os.IsNotExist(err) {
+		// Add random delay to mitigate timing attacks
+		time.Sleep(time.Duration(10+mathrand.Int32N(1000)) * time.Microsecond)
+		return nil, nil
 	}
-
-	// Parse expiry time
-	expiryUnix, err := strconv.ParseInt(string(data), 10, 64)
 	if err != nil {
-		return false, time.Time{}, fmt.Errorf("failed to parse session expiry: %w", err)
+		return nil, fmt.Errorf("failed to read session file: %w", err)
 	}
 
-	expiry := time.Unix(expiryUnix, 0)
-
 	// Check if expired
-	if time.Now().UTC().After(expiry) {
+	if time.Now().UTC().After(session.Expiry) {
 		// Clean up expired session
 		_ = os.Remove(sessionPath)
-		return false, time.Time{}, nil
+		return nil, nil
 	}
 
-	return true, expiry, nil
+	return &session, nil
 }
 
-// ExtendSession extends an existing session by creating a new token
-// The old token remains valid until its original expiry time
-func ExtendSession(stateDir, oldToken string) (string, bool) {
+// ExtendSession extends an existing session by creating a new token, and returns it with its
+// expiry. The old token remains valid until its original expiry time. A session can't be
+// extended beyond the maximum lifetime after its login.
+func ExtendSession(stateDir, oldToken string) (string, time.Time, bool) {
 	// Validate the old session first
-	valid, _, err := ValidateSessionWithExpiry(stateDir, oldToken)
-	if err != nil || !valid {
-		return "", false
+	session, err := LookupSession(stateDir, oldToken)
+	if err != nil || session == nil {
+		return "", time.Time{}, false
+	}
+
+	config := LoadSessionConfig(stateDir)
+	oldExpiry := session.Expiry
+	session.Expiry = time.Now().UTC().Add(config.Duration)
+	if absolute := session.Login.Add(config.MaxLifetime); absolute.Before(session.Expiry) {
+		session.Expiry = absolute
+	}
+	if !session.Expiry.After(oldExpiry) {
+		return "", time.Time{}, false
 	}
 
 	// Create new token with new expiry
 	newToken := generateToken()
-	expiry := time.Now().UTC().Add(24 * time.Hour)
 
 	// Hash the new token for storage
 	tokenHash := sha256.Sum256([]byte(newToken))
 	hashedToken := hex.EncodeToString(tokenHash[:])
 
 	// Persist new session to disk
-	if err := saveSession(stateDir, hashedToken, expiry); err != nil {
+	if err := saveSession(stateDir, hashedToken, *session); err != nil {
 		slog.Warn("Failed to persist extended session", "error", err)
-		return "", false
+		return "", time.Time{}, false
 	}
 
-	return newToken, true
+	return newToken, session.Expiry, true
 }
 
 func CleanExpiredSessions(stateDir string) {
-	now := time.Now().UTC()
-	sessionsDir := filepath.Join(stateDir, "sessions")
-
-	entries, err := os.ReadDir(sessionsDir)
+	expired, err := ExpiredSessions(stateDir)
 	if err != nil {
 		return
 	}
+	for _, sessionPath := range expired {
+		_ = os.Remove(sessionPath)
+	}
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		sessionPath := filepath.Join(sessionsDir, entry.Name())
-		data, err := os.ReadFile(sessionPath)
-		if err != nil {
-			continue
-		}
-
-		expiryUnix, err := strconv.ParseInt(string(data), 10, 64)
-		if err != nil {
-			continue
-		}
-
-		expiry := time.Unix(expiryUnix, 0)
-		if now.After(expiry) {
-			_ = os.Remove(sessionPath)
+// ExpiredSessions returns the paths of the session files which are expired, but were not
+// removed yet. Unreadable session files are skipped.
+func ExpiredSessions(stateDir string) ([]string, error) {
+	now := time.Now().UTC()
+	files, err := sessionFiles(stateDir)
+	if err != nil {
+		return nil, err
+	}
+	var expired []string
+	for sessionPath, session := range files {
+		if now.After(session.Expiry) {
+			expired = append(expired, sessionPath)
 		}
 	}
+	slices.Sort(expired)
+	return expired, nil
 }
 
 func generateToken() string {
@@ -179,8 +293,23 @@ func generateToken() string {
 	return hex.EncodeToString(b)
 }
 
-// AddPassword adds a password to the hashed-passwords directory
+// AddPassword adds a password of the admin to the hashed-passwords directory
 func AddPassword(stateDir, password string) error {
+	return addPassword(stateDir, "", password)
+}
+
+// AddUser adds a password of the named user. A user can have several passwords, the password
+// alone identifies the user at the login.
+func AddUser(stateDir, username, password string) error {
+	if err := ValidUsername(username); err != nil {
+		return err
+	}
+	return addPassword(stateDir, username, password)
+}
+
+// addPassword stores the hash of the password in the hashed-passwords directory. The file
+// contains the name of the user, it is empty for the admin.
+func addPassword(stateDir, username, password string) error {
 	if len(password) < MinPasswordLength {
 		return fmt.Errorf("password must be at least %d characters long", MinPasswordLength)
 	}
@@ -197,9 +326,161 @@ func AddPassword(stateDir, password string) error {
 
 	// Create the password file
 	passwordFilePath := filepath.Join(hashedPasswordsDir, hashedPassword)
-	if err := os.WriteFile(passwordFilePath, []byte{}, 0o600); err != nil {
+	if err := os.WriteFile(passwordFilePath, []byte(username), 0o600); err != nil {
 		return fmt.Errorf("failed to write password file: %w", err)
 	}
 
 	return nil
 }
+
+// Users returns the names of the users with a password, sorted. The admin is included if
+// it has a password.
+func Users(stateDir string) ([]string, error) {
+	dir := filepath.Join(stateDir, "hashed-passwords")
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hashed-passwords directory: %w", err)
+	}
+	var users []string
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password file: %w", err)
+		}
+		users = append(users, userOf(content))
+	}
+	slices.Sort(users)
+	return slices.Compact(users), nil
+}
+
+// HasPasswords returns true if at least one password was added with AddPassword.
+func HasPasswords(stateDir string) (bool, error) {
+	entries, err := os.ReadDir(filepath.Join(stateDir, "hashed-passwords"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read hashed-passwords directory: %w", err)
+	}
+	return len(entries) > 0, nil
+}
+
+// widgetTokensDir contains one file per widget token. The file name is the SHA-256 hash of the
+// token, the first line of the content is the name of the token, the second line the user of
+// the token. Tokens without a user are from before named users existed, they belong to the
+// admin.
+const widgetTokensDir = "widget-tokens"
+
+// replicationTokensDir contains the replication tokens, like widgetTokensDir.
+const replicationTokensDir = "replication-tokens"
+
+// AddWidgetToken creates a token for the embeddable widgets and returns it. The widgets show
+// the workspaces of the user, "" is the admin. Only the hash is stored, so the token can't be
+// shown again. Delete the file to revoke the token.
+func AddWidgetToken(stateDir, name, username string) (string, error) {
+	if username != "" && username != AdminUser {
+		if err := ValidUsername(username); err != nil {
+			return "", err
+		}
+	} else {
+		username = ""
+	}
+	if strings.Contains(name, "\n") {
+		return "", fmt.Errorf("the name of the token must not contain a newline")
+	}
+	return addToken(stateDir, widgetTokensDir, name+"\n"+username)
+}
+
+// WidgetTokenUser returns the user of the token which AddWidgetToken created, or false if the
+// token is not valid.
+func WidgetTokenUser(stateDir, token string) (string, bool) {
+	content, ok := readToken(stateDir, widgetTokensDir, token)
+	if !ok {
+		return "", false
+	}
+	_, user, _ := strings.Cut(string(content), "\n")
+	return userOf([]byte(user)), true
+}
+
+// AddReplicationToken creates a token with which a standby instance can read the workspaces,
+// see package replication. It is stored like the widget tokens.
+func AddReplicationToken(stateDir, name string) (string, error) {
+	return addToken(stateDir, replicationTokensDir, name)
+}
+
+// ValidateReplicationToken returns true if the token was created with AddReplicationToken.
+func ValidateReplicationToken(stateDir, token string) bool {
+	return validateToken(stateDir, replicationTokensDir, token)
+}
+
+// apiTokensDir contains the API tokens, like widgetTokensDir. The file contains the name of
+// the user of the token, it is empty for the admin.
+const apiTokensDir = "api-tokens"
+
+// AddAPIToken creates a token with which scripts and `mobileshell exec` use the API as the
+// user, "" is the admin. It is stored like the widget tokens.
+func AddAPIToken(stateDir, username string) (string, error) {
+	if username != "" && username != AdminUser {
+		if err := ValidUsername(username); err != nil {
+			return "", err
+		}
+	} else {
+		username = ""
+	}
+	return addToken(stateDir, apiTokensDir, username)
+}
+
+// APITokenUser returns the user of the token which AddAPIToken created, or false if the
+// token is not valid.
+func APITokenUser(stateDir, token string) (string, bool) {
+	data, ok := readToken(stateDir, apiTokensDir, token)
+	if !ok {
+		return "", false
+	}
+	return userOf(data), true
+}
+
+// addToken creates a token, and stores its hash with the name in the directory tokensDir.
+func addToken(stateDir, tokensDir, name string) (string, error) {
+	dir := filepath.Join(stateDir, tokensDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create %s directory: %w", tokensDir, err)
+	}
+	token := generateToken()
+	hash := sha256.Sum256([]byte(token))
+	if err := os.WriteFile(filepath.Join(dir, hex.EncodeToString(hash[:])), []byte(name), 0o600); err != nil {
+		return "", fmt.Errorf("failed to write token file: %w", err)
+	}
+	return token, nil
+}
+
+// readToken returns the content of the file of the token, which addToken created for
+// tokensDir, or false if the token is not valid.
+func readToken(stateDir, tokensDir, token string) ([]byte, bool) {
+	if !validateToken(stateDir, tokensDir, token) {
+		return nil, false
+	}
+	hash := sha256.Sum256([]byte(token))
+	data, err := os.ReadFile(filepath.Join(stateDir, tokensDir, hex.EncodeToString(hash[:])))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// validateToken returns true if the token was created with addToken for tokensDir.
+func validateToken(stateDir, tokensDir, token string) bool {
+	if token == "" {
+		return false
+	}
+	hash := sha256.Sum256([]byte(token))
+	if _, err := os.Stat(filepath.Join(stateDir, tokensDir, hex.EncodeToString(hash[:]))); err != nil {
+		// Add random delay to mitigate timing attacks
+		time.Sleep(time.Duration(10+mathrand.Int32N(1000)) * time.Microsecond)
+		return false
+	}
+	return true
+}
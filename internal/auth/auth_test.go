@@ -2,10 +2,15 @@ package auth
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestInitAuth(t *testing.T) {
@@ -86,7 +91,7 @@ func TestAuthenticate(t *testing.T) {
 	}
 
 	// Test with non-existent password
-	token, success := Authenticate(ctx, tmpDir, "nonexistent-password-that-is-long-enough-to-pass-length-check")
+	token, success := Authenticate(ctx, tmpDir, "nonexistent-password-that-is-long-enough-to-pass-length-check", Client{})
 	if success {
 		t.Error("Authentication should fail with non-existent password")
 	}
@@ -102,7 +107,7 @@ func TestAuthenticate(t *testing.T) {
 	}
 
 	// Test with correct password
-	token, success = Authenticate(ctx, tmpDir, validPassword)
+	token, success = Authenticate(ctx, tmpDir, validPassword, Client{})
 	if !success {
 		t.Error("Authentication should succeed with valid password")
 	}
@@ -116,7 +121,7 @@ func TestAuthenticate(t *testing.T) {
 	}
 
 	// Test with password too short
-	token, success = Authenticate(ctx, tmpDir, "short")
+	token, success = Authenticate(ctx, tmpDir, "short", Client{})
 	if success {
 		t.Error("Authentication should fail with short password")
 	}
@@ -143,7 +148,7 @@ func TestValidateSession(t *testing.T) {
 		t.Fatalf("Failed to add password: %v", err)
 	}
 
-	token, success := Authenticate(ctx, tmpDir, password)
+	token, success := Authenticate(ctx, tmpDir, password, Client{})
 	if !success {
 		t.Fatal("Authentication failed")
 	}
@@ -186,7 +191,7 @@ func TestValidateSessionWithExpiry(t *testing.T) {
 	}
 
 	beforeAuth := time.Now().UTC()
-	token, success := Authenticate(ctx, tmpDir, password)
+	token, success := Authenticate(ctx, tmpDir, password, Client{})
 	if !success {
 		t.Fatal("Authentication failed")
 	}
@@ -237,13 +242,13 @@ func TestExtendSession(t *testing.T) {
 		t.Fatalf("Failed to add password: %v", err)
 	}
 
-	oldToken, success := Authenticate(ctx, tmpDir, password)
+	oldToken, success := Authenticate(ctx, tmpDir, password, Client{})
 	if !success {
 		t.Fatal("Authentication failed")
 	}
 
 	// Extend the session
-	newToken, success := ExtendSession(tmpDir, oldToken)
+	newToken, _, success := ExtendSession(tmpDir, oldToken)
 	if !success {
 		t.Error("Session extension should succeed")
 	}
@@ -266,7 +271,7 @@ func TestExtendSession(t *testing.T) {
 	}
 
 	// Test extending invalid session
-	newToken, success = ExtendSession(tmpDir, "invalid-token")
+	newToken, _, success = ExtendSession(tmpDir, "invalid-token")
 	if success {
 		t.Error("Extension should fail for invalid token")
 	}
@@ -289,14 +294,14 @@ func TestCleanExpiredSessions(t *testing.T) {
 
 	// Create an expired session manually
 	expiredTime := time.Now().UTC().Add(-1 * time.Hour)
-	err = saveSession(tmpDir, "expired-session", expiredTime)
+	err = saveSession(tmpDir, "expired-session", Session{Expiry: expiredTime, Login: time.Now().UTC()})
 	if err != nil {
 		t.Fatalf("Failed to create expired session: %v", err)
 	}
 
 	// Create a valid session
 	validTime := time.Now().UTC().Add(24 * time.Hour)
-	err = saveSession(tmpDir, "valid-session", validTime)
+	err = saveSession(tmpDir, "valid-session", Session{Expiry: validTime, Login: time.Now().UTC()})
 	if err != nil {
 		t.Fatalf("Failed to create valid session: %v", err)
 	}
@@ -337,7 +342,7 @@ func TestSaveSession(t *testing.T) {
 	}
 
 	expiry := time.Now().UTC().Add(1 * time.Hour)
-	err = saveSession(tmpDir, "test-token", expiry)
+	err = saveSession(tmpDir, "test-token", Session{Expiry: expiry, Login: time.Now().UTC()})
 	if err != nil {
 		t.Fatalf("saveSession failed: %v", err)
 	}
@@ -389,3 +394,130 @@ func TestGenerateToken(t *testing.T) {
 		}
 	}
 }
+
+func TestHasPasswords(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+
+	hasPasswords, err := HasPasswords(tmpDir)
+	require.NoError(t, err)
+	require.False(t, hasPasswords)
+
+	require.NoError(t, AddPassword(tmpDir, "a-very-long-password-that-meets-minimum-length-requirements"))
+	hasPasswords, err = HasPasswords(tmpDir)
+	require.NoError(t, err)
+	require.True(t, hasPasswords)
+}
+
+func TestUsers(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	require.NoError(t, InitAuth(tmpDir))
+
+	password := "a-very-long-password-that-meets-minimum-length-requirements"
+	require.ErrorContains(t, AddUser(tmpDir, "Alice", password), "invalid user name")
+	require.Error(t, AddUser(tmpDir, "../alice", password))
+	require.NoError(t, AddUser(tmpDir, "alice", password))
+	require.NoError(t, AddPassword(tmpDir, "another-very-long-password-that-meets-the-minimum-length"))
+	users, err := Users(tmpDir)
+	require.NoError(t, err)
+	require.Equal(t, []string{AdminUser, "alice"}, users)
+
+	// The password identifies the user of the session
+	token, ok := Authenticate(context.Background(), tmpDir, password, Client{})
+	require.True(t, ok)
+	session, err := LookupSession(tmpDir, token)
+	require.NoError(t, err)
+	require.Equal(t, "alice", session.User)
+
+	// Sessions from before named users belong to the admin
+	hash := sha256.Sum256([]byte("legacy-token"))
+	content := fmt.Sprintf("%d %d", time.Now().Add(time.Hour).Unix(), time.Now().Unix())
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "sessions", hex.EncodeToString(hash[:])), []byte(content), 0o600))
+	session, err = LookupSession(tmpDir, "legacy-token")
+	require.NoError(t, err)
+	require.Equal(t, AdminUser, session.User)
+
+	session, err = LookupSession(tmpDir, "unknown-token")
+	require.NoError(t, err)
+	require.Nil(t, session)
+}
+
+func TestWidgetTokens(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+
+	_, ok := WidgetTokenUser(tmpDir, "")
+	require.False(t, ok)
+	_, ok = WidgetTokenUser(tmpDir, "unknown")
+	require.False(t, ok)
+
+	token, err := AddWidgetToken(tmpDir, "grafana", "")
+	require.NoError(t, err)
+	user, ok := WidgetTokenUser(tmpDir, token)
+	require.True(t, ok)
+	require.Equal(t, AdminUser, user)
+	_, ok = WidgetTokenUser(tmpDir, token+"x")
+	require.False(t, ok)
+
+	aliceToken, err := AddWidgetToken(tmpDir, "alice's dashboard", "alice")
+	require.NoError(t, err)
+	user, ok = WidgetTokenUser(tmpDir, aliceToken)
+	require.True(t, ok)
+	require.Equal(t, "alice", user)
+	_, err = AddWidgetToken(tmpDir, "grafana", "../alice")
+	require.Error(t, err)
+
+	// Tokens from before named users existed only have a name, they belong to the admin
+	legacy, err := addToken(tmpDir, widgetTokensDir, "grafana")
+	require.NoError(t, err)
+	user, ok = WidgetTokenUser(tmpDir, legacy)
+	require.True(t, ok)
+	require.Equal(t, AdminUser, user)
+
+	// Widget tokens are no passwords
+	hasPasswords, err := HasPasswords(tmpDir)
+	require.NoError(t, err)
+	require.False(t, hasPasswords)
+}
+
+func TestReplicationTokens(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+
+	token, err := AddReplicationToken(tmpDir, "standby")
+	require.NoError(t, err)
+	require.True(t, ValidateReplicationToken(tmpDir, token))
+
+	// The kinds of tokens are separate
+	_, ok := WidgetTokenUser(tmpDir, token)
+	require.False(t, ok)
+	widgetToken, err := AddWidgetToken(tmpDir, "grafana", "")
+	require.NoError(t, err)
+	require.False(t, ValidateReplicationToken(tmpDir, widgetToken))
+}
+
+func TestAPITokens(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+
+	_, ok := APITokenUser(tmpDir, "")
+	require.False(t, ok)
+
+	adminToken, err := AddAPIToken(tmpDir, "")
+	require.NoError(t, err)
+	user, ok := APITokenUser(tmpDir, adminToken)
+	require.True(t, ok)
+	require.Equal(t, AdminUser, user)
+
+	aliceToken, err := AddAPIToken(tmpDir, "alice")
+	require.NoError(t, err)
+	user, ok = APITokenUser(tmpDir, aliceToken)
+	require.True(t, ok)
+	require.Equal(t, "alice", user)
+
+	_, err = AddAPIToken(tmpDir, "../alice")
+	require.Error(t, err)
+	_, ok = WidgetTokenUser(tmpDir, aliceToken)
+	require.False(t, ok)
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Limits of the LoginLimiter.
+const (
+	// freeLoginFailures is the number of failed logins of an address before the lockout starts.
+	freeLoginFailures = 5
+
+	// loginBackoff is the first lockout of an address, it doubles with each further failure.
+	loginBackoff = time.Second
+
+	// maxLoginLockout caps the lockout of an address.
+	maxLoginLockout = 15 * time.Minute
+
+	// loginFailureTTL is the time after which the failures of an address are forgotten.
+	loginFailureTTL = time.Hour
+
+	// globalLoginLimit is the number of failed logins of all addresses per globalLoginWindow.
+	// Above it, all logins are locked until the window ends. This slows down attacks which use
+	// many addresses.
+	globalLoginLimit  = 100
+	globalLoginWindow = time.Minute
+)
+
+// LoginLimiter limits the login attempts per client address and in total. Failed attempts of
+// an address lock it out with exponential backoff. It keeps its state in memory, a restart of
+// the server resets it. It is safe for concurrent use.
+type LoginLimiter struct {
+	mu             sync.Mutex
+	now            func() time.Time
+	clients        map[string]*loginClient
+	lastPrune      time.Time
+	windowStart    time.Time
+	windowFailures int
+}
+
+// loginClient are the failed logins of an address.
+type loginClient struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// NewLoginLimiter returns a limiter without failed logins.
+func NewLoginLimiter() *LoginLimiter {
+	return &LoginLimiter{
+		now:     func() time.Time { return time.Now().UTC() },
+		clients: map[string]*loginClient{},
+	}
+}
+
+// Attempt registers a login attempt of the address. If the address or all logins are locked
+// out, it returns how long to wait, and the attempt must be rejected. Otherwise the attempt
+// counts as failure until Success is called, so that parallel attempts can't bypass the limit.
+func (l *LoginLimiter) Attempt(addr string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.prune(now)
+
+	if now.Sub(l.windowStart) >= globalLoginWindow {
+		l.windowStart = now
+		l.windowFailures = 0
+	}
+	if l.windowFailures >= globalLoginLimit {
+		return l.windowStart.Add(globalLoginWindow).Sub(now)
+	}
+	c := l.clients[addr]
+	if c == nil {
+		c = &loginClient{}
+		l.clients[addr] = c
+	}
+	if wait := c.lockedUntil.Sub(now); wait > 0 {
+		return wait
+	}
+
+	c.failures++
+	c.lastFailure = now
+	l.windowFailures++
+	if c.failures >= freeLoginFailures {
+		// Limit the shift, the lockout is capped anyway
+		shift := min(c.failures-freeLoginFailures, 20)
+		c.lockedUntil = now.Add(min(loginBackoff<<shift, maxLoginLockout))
+	}
+	return 0
+}
+
+// Success forgets the failures of the address, after its attempt succeeded.
+func (l *LoginLimiter) Success(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.clients[addr]; ok {
+		delete(l.clients, addr)
+		l.windowFailures = max(l.windowFailures-1, 0)
+	}
+}
+
+// Failures returns the number of failed logins of the address.
+func (l *LoginLimiter) Failures(addr string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.clients[addr]; ok {
+		return c.failures
+	}
+	return 0
+}
+
+// prune removes the addresses which are not locked out and had no failure for
+// loginFailureTTL, at most once per minute.
+func (l *LoginLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	for addr, c := range l.clients {
+		if now.After(c.lockedUntil) && now.Sub(c.lastFailure) > loginFailureTTL {
+			delete(l.clients, addr)
+		}
+	}
+}
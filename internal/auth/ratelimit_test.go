@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	l := NewLoginLimiter()
+	l.now = func() time.Time { return now }
+
+	for range freeLoginFailures {
+		require.Zero(t, l.Attempt("192.0.2.1"))
+	}
+	require.Equal(t, freeLoginFailures, l.Failures("192.0.2.1"))
+	require.Equal(t, time.Second, l.Attempt("192.0.2.1"))
+	// Other addresses are not locked out
+	require.Zero(t, l.Attempt("192.0.2.2"))
+
+	// The lockout doubles with each failure
+	now = now.Add(time.Second)
+	require.Zero(t, l.Attempt("192.0.2.1"))
+	require.Equal(t, 2*time.Second, l.Attempt("192.0.2.1"))
+	now = now.Add(2 * time.Second)
+	require.Zero(t, l.Attempt("192.0.2.1"))
+	require.Equal(t, 4*time.Second, l.Attempt("192.0.2.1"))
+
+	// and is capped
+	l.clients["192.0.2.1"].failures = 100
+	now = now.Add(4 * time.Second)
+	require.Zero(t, l.Attempt("192.0.2.1"))
+	require.Equal(t, maxLoginLockout, l.Attempt("192.0.2.1"))
+
+	// Old failures are forgotten
+	now = now.Add(maxLoginLockout + loginFailureTTL + time.Second)
+	require.Zero(t, l.Attempt("192.0.2.3"))
+	require.Zero(t, l.Failures("192.0.2.1"))
+
+	// A success resets the address
+	require.Zero(t, l.Attempt("192.0.2.2"))
+	l.Success("192.0.2.2")
+	require.Zero(t, l.Failures("192.0.2.2"))
+}
+
+func TestLoginLimiterGlobal(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	l := NewLoginLimiter()
+	l.now = func() time.Time { return now }
+
+	for i := range globalLoginLimit {
+		require.Zero(t, l.Attempt(fmt.Sprintf("198.51.100.%d", i)))
+	}
+	now = now.Add(10 * time.Second)
+	require.Equal(t, globalLoginWindow-10*time.Second, l.Attempt("192.0.2.9"))
+
+	now = now.Add(globalLoginWindow)
+	require.Zero(t, l.Attempt("192.0.2.9"))
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// sessionConfigDir contains one file per setting of SessionConfig, in the state directory. The
+// files contain Go durations like "24h", so they can be edited by hand, too.
+const sessionConfigDir = "session-config"
+
+// Bounds of the session settings, see SessionConfig.Validate.
+const (
+	MinSessionDuration = 5 * time.Minute
+	MaxSessionLifetime = 365 * 24 * time.Hour
+)
+
+// SessionConfig configures how long sessions are valid.
+type SessionConfig struct {
+	Duration     time.Duration // Lifetime of a new or extended session
+	ExtendWithin time.Duration // A request extends a session which expires within this window
+	MaxLifetime  time.Duration // Sessions can't be extended beyond this time after the login
+}
+
+// DefaultSessionConfig returns the session settings which apply until they get saved.
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		Duration:     24 * time.Hour,
+		ExtendWithin: 30 * time.Minute,
+		MaxLifetime:  30 * 24 * time.Hour,
+	}
+}
+
+// Validate checks that the durations are within the bounds, and fit to each other.
+func (c SessionConfig) Validate() error {
+	if c.Duration < MinSessionDuration || c.Duration > MaxSessionLifetime {
+		return fmt.Errorf("session duration must be between %s and %s", MinSessionDuration, MaxSessionLifetime)
+	}
+	if c.ExtendWithin <= 0 || c.ExtendWithin >= c.Duration {
+		return fmt.Errorf("extension window must be positive and shorter than the session duration")
+	}
+	if c.MaxLifetime < c.Duration || c.MaxLifetime > MaxSessionLifetime {
+		return fmt.Errorf("maximum lifetime must be between the session duration and %s", MaxSessionLifetime)
+	}
+	return nil
+}
+
+// LoadSessionConfig reads the session settings. Missing values get their default. If the
+// result is not valid, for example after editing the files by hand, the defaults are used.
+func LoadSessionConfig(stateDir string) SessionConfig {
+	c := DefaultSessionConfig()
+	dir := filepath.Join(stateDir, sessionConfigDir)
+	fields := map[string]*time.Duration{
+		"duration":      &c.Duration,
+		"extend-within": &c.ExtendWithin,
+		"max-lifetime":  &c.MaxLifetime,
+	}
+	for name, field := range fields {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if d, err := time.ParseDuration(string(data)); err == nil {
+			*field = d
+		}
+	}
+	if c.Validate() != nil {
+		return DefaultSessionConfig()
+	}
+	return c
+}
+
+// SaveSessionConfig validates and stores the session settings. They apply to existing
+// sessions, too.
+func SaveSessionConfig(stateDir string, c SessionConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	dir := filepath.Join(stateDir, sessionConfigDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", sessionConfigDir, err)
+	}
+	files := map[string]time.Duration{
+		"duration":      c.Duration,
+		"extend-within": c.ExtendWithin,
+		"max-lifetime":  c.MaxLifetime,
+	}
+	for name, value := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value.String()), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
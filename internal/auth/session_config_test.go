@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionConfig(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.Equal(t, DefaultSessionConfig(), LoadSessionConfig(stateDir))
+	require.NoError(t, DefaultSessionConfig().Validate())
+
+	require.Error(t, SessionConfig{Duration: time.Minute, ExtendWithin: time.Second, MaxLifetime: time.Hour}.Validate())
+	require.Error(t, SessionConfig{Duration: time.Hour, ExtendWithin: time.Hour, MaxLifetime: time.Hour}.Validate())
+	require.Error(t, SessionConfig{Duration: time.Hour, ExtendWithin: time.Minute, MaxLifetime: time.Minute}.Validate())
+	require.Error(t, SessionConfig{Duration: time.Hour, ExtendWithin: time.Minute, MaxLifetime: 2 * MaxSessionLifetime}.Validate())
+	require.Error(t, SaveSessionConfig(stateDir, SessionConfig{}))
+
+	config := SessionConfig{Duration: 2 * time.Hour, ExtendWithin: 10 * time.Minute, MaxLifetime: 48 * time.Hour}
+	require.NoError(t, SaveSessionConfig(stateDir, config))
+	require.Equal(t, config, LoadSessionConfig(stateDir))
+
+	// Files which were edited by hand to an invalid combination are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, sessionConfigDir, "extend-within"), []byte("3h"), 0o600))
+	require.Equal(t, DefaultSessionConfig(), LoadSessionConfig(stateDir))
+}
+
+func TestSessionMaxLifetime(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitAuth(stateDir))
+	require.NoError(t, SaveSessionConfig(stateDir, SessionConfig{Duration: time.Hour, ExtendWithin: 30 * time.Minute, MaxLifetime: 2 * time.Hour}))
+
+	password := "a-very-long-password-that-meets-minimum-length-requirements"
+	require.NoError(t, AddPassword(stateDir, password))
+	token, ok := Authenticate(context.Background(), stateDir, password, Client{})
+	require.True(t, ok)
+	valid, expiry, err := ValidateSessionWithExpiry(stateDir, token)
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.WithinDuration(t, time.Now().Add(time.Hour), expiry, time.Minute)
+
+	// A session of a login 110 minutes ago can only be extended by 10 minutes
+	now := time.Now().UTC()
+	oldToken := generateToken()
+	hash := sha256.Sum256([]byte(oldToken))
+	require.NoError(t, saveSession(stateDir, hex.EncodeToString(hash[:]), Session{Expiry: now.Add(5 * time.Minute), Login: now.Add(-110 * time.Minute)}))
+	newToken, newExpiry, ok := ExtendSession(stateDir, oldToken)
+	require.True(t, ok)
+	require.WithinDuration(t, now.Add(10*time.Minute), newExpiry, 2*time.Second)
+
+	// The extended session can't be extended any further
+	_, _, ok = ExtendSession(stateDir, newToken)
+	require.False(t, ok)
+
+	// A session is invalid after the maximum lifetime, even if its expiry is later
+	expiredToken := generateToken()
+	hash = sha256.Sum256([]byte(expiredToken))
+	require.NoError(t, saveSession(stateDir, hex.EncodeToString(hash[:]), Session{Expiry: now.Add(time.Hour), Login: now.Add(-3 * time.Hour)}))
+	valid, _, err = ValidateSessionWithExpiry(stateDir, expiredToken)
+	require.NoError(t, err)
+	require.False(t, valid)
+}
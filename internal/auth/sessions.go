@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The session files are named by the SHA-256 hash of their token, so reading the sessions
+// directory doesn't reveal valid tokens. A session gets a new token when it is extended, so
+// one session can have several files with the same ID.
+
+// ListSessions returns the active sessions, the newest login first. A session with several
+// tokens is listed once, with its latest expiry.
+func ListSessions(stateDir string) ([]Session, error) {
+	files, err := sessionFiles(stateDir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	byID := map[string]Session{}
+	for _, session := range files {
+		if now.After(session.Expiry) {
+			continue
+		}
+		if current, ok := byID[session.ID]; !ok || session.Expiry.After(current.Expiry) {
+			byID[session.ID] = session
+		}
+	}
+	sessions := slices.Collect(maps.Values(byID))
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return cmp.Or(b.Login.Compare(a.Login), strings.Compare(a.ID, b.ID))
+	})
+	return sessions, nil
+}
+
+// RevokeSession logs out the session with the ID, by removing all of its tokens.
+func RevokeSession(stateDir, id string) error {
+	files, err := sessionFiles(stateDir)
+	if err != nil {
+		return err
+	}
+	found := false
+	for sessionPath, session := range files {
+		if session.ID != id {
+			continue
+		}
+		if err := os.Remove(sessionPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove session file: %w", err)
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("session %q not found", id)
+	}
+	return nil
+}
+
+// sessionFiles returns the sessions of the session files by their path, including the expired
+// ones. Unreadable session files are skipped.
+func sessionFiles(stateDir string) (map[string]Session, error) {
+	sessionsDir := filepath.Join(stateDir, "sessions")
+	entries, err := os.ReadDir(sessionsDir)
+	if err != nil {
+		return nil, err
+	}
+	config := LoadSessionConfig(stateDir)
+	files := map[string]Session{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		sessionPath := filepath.Join(sessionsDir, entry.Name())
+		session, err := readSession(sessionPath, config)
+		if err != nil {
+			continue
+		}
+		files[sessionPath] = session
+	}
+	return files, nil
+}
+
+// readSession reads the session file at sessionPath. Sessions from before sessions had an ID
+// use the name of their file as ID.
+func readSession(sessionPath string, config SessionConfig) (Session, error) {
+	data, err := os.ReadFile(sessionPath)
+	if err != nil {
+		return Session{}, err
+	}
+	session, err := parseSession(data, config)
+	if err != nil {
+		return Session{}, err
+	}
+	if session.ID == "" {
+		session.ID = filepath.Base(sessionPath)
+	}
+	return session, nil
+}
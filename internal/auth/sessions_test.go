@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListAndRevokeSessions(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitAuth(stateDir))
+	password := "a-very-long-password-that-meets-minimum-length-requirements"
+	require.NoError(t, AddUser(stateDir, "alice", password))
+
+	token, ok := Authenticate(context.Background(), stateDir, password, Client{Remote: "192.0.2.1:1234", UserAgent: "Firefox\nInjected=1"})
+	require.True(t, ok)
+	session, err := LookupSession(stateDir, token)
+	require.NoError(t, err)
+	require.Len(t, session.ID, 16)
+	require.Equal(t, "192.0.2.1:1234", session.Remote)
+	require.Equal(t, "Firefox Injected=1", session.UserAgent)
+
+	// An extended session has a second token with the same ID, it is listed once
+	extended := *session
+	extended.Expiry = session.Expiry.Add(time.Hour)
+	require.NoError(t, saveSession(stateDir, "extended-token-hash", extended))
+	// Sessions from before the metadata existed use their file name as ID
+	now := time.Now().UTC()
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "sessions", "legacy-token-hash"), []byte(strconv.FormatInt(now.Add(time.Hour).Unix(), 10)), 0o600))
+	require.NoError(t, saveSession(stateDir, "expired-token-hash", Session{User: "alice", ID: "expired", Login: now.Add(-2 * time.Hour), Expiry: now.Add(-time.Hour)}))
+
+	sessions, err := ListSessions(stateDir)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, session.ID, sessions[0].ID)
+	require.Equal(t, extended.Expiry, sessions[0].Expiry)
+	require.Equal(t, "alice", sessions[0].User)
+	require.Equal(t, "legacy-token-hash", sessions[1].ID)
+	require.Equal(t, AdminUser, sessions[1].User)
+
+	require.NoError(t, RevokeSession(stateDir, session.ID))
+	session, err = LookupSession(stateDir, token)
+	require.NoError(t, err)
+	require.Nil(t, session)
+	require.NoFileExists(t, filepath.Join(stateDir, "sessions", "extended-token-hash"))
+	require.ErrorContains(t, RevokeSession(stateDir, "unknown"), "not found")
+
+	sessions, err = ListSessions(stateDir)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+}
@@ -0,0 +1,88 @@
+// Package clipboard is a small clipboard on the server. It moves text between the web
+// terminal and the process pages, without going through the clipboard of the phone.
+package clipboard
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"mobileshell/pkg/outputlog"
+)
+
+// clipboardDir contains one file per snippet, in the state directory. The file name is the
+// time the snippet was added.
+const clipboardDir = "clipboard"
+
+// MaxSnippets is the number of snippets which are kept. Older snippets get deleted.
+const MaxSnippets = 20
+
+// MaxSnippetSize is the maximum size of a snippet in bytes.
+const MaxSnippetSize = 64 * 1024
+
+// Snippet is a text on the clipboard.
+type Snippet struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// Add puts a snippet on the clipboard and deletes the oldest snippets above MaxSnippets.
+func Add(stateDir, text string) (Snippet, error) {
+	if text == "" {
+		return Snippet{}, fmt.Errorf("snippet is empty")
+	}
+	if len(text) > MaxSnippetSize {
+		return Snippet{}, fmt.Errorf("snippet is too big: %d bytes, maximum is %d", len(text), MaxSnippetSize)
+	}
+	dir := filepath.Join(stateDir, clipboardDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return Snippet{}, fmt.Errorf("failed to create clipboard directory: %w", err)
+	}
+	now := time.Now().UTC()
+	snippet := Snippet{ID: now.Format(outputlog.TimeFormatRFC3339NanoUTC), Time: now, Text: text}
+	if err := os.WriteFile(filepath.Join(dir, snippet.ID), []byte(text), 0o600); err != nil {
+		return Snippet{}, fmt.Errorf("failed to write snippet: %w", err)
+	}
+
+	snippets, err := List(stateDir)
+	if err != nil {
+		return snippet, err
+	}
+	for _, old := range snippets[min(len(snippets), MaxSnippets):] {
+		if err := os.Remove(filepath.Join(dir, old.ID)); err != nil {
+			return snippet, fmt.Errorf("failed to delete old snippet: %w", err)
+		}
+	}
+	return snippet, nil
+}
+
+// List returns the snippets, newest first.
+func List(stateDir string) ([]Snippet, error) {
+	dir := filepath.Join(stateDir, clipboardDir)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snippets := make([]Snippet, 0, len(entries))
+	for _, entry := range entries {
+		t, err := time.Parse(time.RFC3339Nano, entry.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, Snippet{ID: entry.Name(), Time: t, Text: string(data)})
+	}
+	sort.Slice(snippets, func(i, j int) bool {
+		return snippets[i].Time.After(snippets[j].Time)
+	})
+	return snippets, nil
+}
@@ -0,0 +1,51 @@
+package clipboard
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddAndList(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	snippets, err := List(stateDir)
+	require.NoError(t, err)
+	require.Empty(t, snippets)
+
+	_, err = Add(stateDir, "first")
+	require.NoError(t, err)
+	second, err := Add(stateDir, "second\nline")
+	require.NoError(t, err)
+
+	snippets, err = List(stateDir)
+	require.NoError(t, err)
+	require.Len(t, snippets, 2)
+	require.Equal(t, second, snippets[0])
+	require.Equal(t, "first", snippets[1].Text)
+}
+
+func TestAddRejectsEmptyAndBigSnippets(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	_, err := Add(stateDir, "")
+	require.Error(t, err)
+	_, err = Add(stateDir, strings.Repeat("x", MaxSnippetSize+1))
+	require.Error(t, err)
+}
+
+func TestAddDeletesOldSnippets(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	for i := range MaxSnippets + 3 {
+		_, err := Add(stateDir, strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+	snippets, err := List(stateDir)
+	require.NoError(t, err)
+	require.Len(t, snippets, MaxSnippets)
+	require.Equal(t, strconv.Itoa(MaxSnippets+2), snippets[0].Text)
+	require.Equal(t, "3", snippets[MaxSnippets-1].Text)
+}
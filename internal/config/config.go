@@ -0,0 +1,239 @@
+// Package config reads the YAML config file of the server, see Load. It is an alternative to
+// the flags of `mobileshell run`, flags which are set explicitly override the file.
+//
+// The session and notification settings are stored in the state directory, where the
+// settings page and the nohup wrapper read them. Apply writes the values of the file there
+// when the server starts.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+
+	"mobileshell/internal/auth"
+	"mobileshell/internal/notify"
+	"mobileshell/internal/retention"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults of the server options.
+const (
+	DefaultListen = "localhost"
+	DefaultPort   = "22123"
+)
+
+// Config are the server options. Zero values mean "not set".
+type Config struct {
+	StateDir      string   `yaml:"state-dir"`           // Default: $STATE_DIRECTORY or .mobileshell
+	Listen        string   `yaml:"listen"`              // Host or IP address to listen on
+	Port          string   `yaml:"port"`                // Port to listen on
+	BasePath      string   `yaml:"base-path"`           // URL path prefix behind a reverse proxy, like /shell
+	WidgetOrigins []string `yaml:"widget-cors-origins"` // Origins which may fetch the widgets
+
+	// TrustedProxies are addresses or CIDR ranges of reverse proxies, whose X-Forwarded-For
+	// and Forwarded headers tell the address of the client, see TrustedProxyPrefixes.
+	TrustedProxies []string `yaml:"trusted-proxies"`
+
+	Session       Session       `yaml:"session"`
+	Retention     Retention     `yaml:"retention"`
+	Storage       Storage       `yaml:"storage"`
+	Notifications Notifications `yaml:"notifications"`
+}
+
+// Session overrides the fields of auth.SessionConfig, durations like "24h".
+type Session struct {
+	Duration     time.Duration `yaml:"duration"`
+	ExtendWithin time.Duration `yaml:"extend-within"`
+	MaxLifetime  time.Duration `yaml:"max-lifetime"`
+}
+
+// Retention is the retention policy of the workspaces which have none of their own, see
+// retention.Policy.
+type Retention struct {
+	MaxAgeDays int   `yaml:"max-age-days"`
+	MaxCount   int   `yaml:"max-count"`
+	MaxBytes   int64 `yaml:"max-bytes"`
+}
+
+// Storage configures the disk usage monitor of the state directory.
+type Storage struct {
+	WarningBytes int64 `yaml:"warning-bytes"` // Warn when the state directory is bigger
+}
+
+// Notifications overrides the fields of notify.Config.
+type Notifications struct {
+	OnFailure    *bool         `yaml:"on-failure"`
+	MinDuration  time.Duration `yaml:"min-duration"`
+	WebhookURL   string        `yaml:"webhook-url"`
+	NtfyURL      string        `yaml:"ntfy-url"`
+	NtfyToken    string        `yaml:"ntfy-token"`
+	SMTPAddr     string        `yaml:"smtp-addr"`
+	SMTPUsername string        `yaml:"smtp-username"`
+	SMTPPassword string        `yaml:"smtp-password"`
+	EmailFrom    string        `yaml:"email-from"`
+	EmailTo      string        `yaml:"email-to"`
+
+	// Rules replace the rules of the settings page if set, an empty list removes them.
+	Rules []NotifyRule `yaml:"rules"`
+}
+
+// NotifyRule is a notify.Rule, like {class: failure, command: ^make, backends: [ntfy]}.
+type NotifyRule struct {
+	Class    string   `yaml:"class"`
+	Command  string   `yaml:"command,omitempty"`
+	Backends []string `yaml:"backends"`
+}
+
+// Default returns the config without a config file.
+func Default() Config {
+	return Config{Listen: DefaultListen, Port: DefaultPort}
+}
+
+// Load reads the config file at path. Unknown keys are an error, so that typos don't get
+// ignored silently. Missing options get their default.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+	c := Default()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Validate returns an error if an option is invalid. The session and notification settings
+// are validated together with their defaults.
+func (c Config) Validate() error {
+	if c.Listen == "" {
+		return fmt.Errorf("listen must not be empty")
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("port must be a number between 1 and 65535: %q", c.Port)
+	}
+	if err := c.SessionConfig(auth.DefaultSessionConfig()).Validate(); err != nil {
+		return fmt.Errorf("session: %w", err)
+	}
+	if p := c.RetentionPolicy(); p.MaxAgeDays < 0 || p.MaxCount < 0 || p.MaxBytes < 0 {
+		return fmt.Errorf("retention: limits must not be negative")
+	}
+	if _, err := c.TrustedProxyPrefixes(); err != nil {
+		return fmt.Errorf("trusted-proxies: %w", err)
+	}
+	if c.Storage.WarningBytes < 0 {
+		return fmt.Errorf("storage: warning-bytes must not be negative")
+	}
+	if err := c.NotifyConfig(notify.DefaultConfig()).Validate(); err != nil {
+		return fmt.Errorf("notifications: %w", err)
+	}
+	return nil
+}
+
+// TrustedProxyPrefixes parses TrustedProxies. An address without a prefix length, like
+// "127.0.0.1", is the range of this address only.
+func (c Config) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, proxy := range c.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address or CIDR range %q", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// SessionConfig returns base with the session settings of c.
+func (c Config) SessionConfig(base auth.SessionConfig) auth.SessionConfig {
+	override(&base.Duration, c.Session.Duration)
+	override(&base.ExtendWithin, c.Session.ExtendWithin)
+	override(&base.MaxLifetime, c.Session.MaxLifetime)
+	return base
+}
+
+// RetentionPolicy returns the default retention policy of the workspaces.
+func (c Config) RetentionPolicy() retention.Policy {
+	return retention.Policy(c.Retention)
+}
+
+// NotifyConfig returns base with the notification settings of c.
+func (c Config) NotifyConfig(base notify.Config) notify.Config {
+	n := c.Notifications
+	if n.OnFailure != nil {
+		base.OnFailure = *n.OnFailure
+	}
+	override(&base.MinDuration, n.MinDuration)
+	override(&base.WebhookURL, n.WebhookURL)
+	override(&base.NtfyURL, n.NtfyURL)
+	override(&base.NtfyToken, n.NtfyToken)
+	override(&base.SMTPAddr, n.SMTPAddr)
+	override(&base.SMTPUsername, n.SMTPUsername)
+	override(&base.SMTPPassword, n.SMTPPassword)
+	override(&base.EmailFrom, n.EmailFrom)
+	override(&base.EmailTo, n.EmailTo)
+	if n.Rules != nil {
+		base.Rules = make([]notify.Rule, 0, len(n.Rules))
+		for _, r := range n.Rules {
+			base.Rules = append(base.Rules, notify.Rule(r))
+		}
+	}
+	return base
+}
+
+// NotifyRulesYAML returns rules as the notifications section of the config file, so that
+// the rules of the settings page can be copied into it.
+func NotifyRulesYAML(rules []notify.Rule) (string, error) {
+	section := make([]NotifyRule, 0, len(rules))
+	for _, r := range rules {
+		section = append(section, NotifyRule(r))
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]any{"notifications": map[string]any{"rules": section}}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Apply stores the session and notification settings of c in stateDir. Settings which c
+// doesn't set keep their current value, for example from the settings page.
+func (c Config) Apply(stateDir string) error {
+	if c.Session != (Session{}) {
+		if err := auth.SaveSessionConfig(stateDir, c.SessionConfig(auth.LoadSessionConfig(stateDir))); err != nil {
+			return fmt.Errorf("failed to apply session settings: %w", err)
+		}
+	}
+	if !reflect.ValueOf(c.Notifications).IsZero() {
+		if err := notify.SaveConfig(stateDir, c.NotifyConfig(notify.LoadConfig(stateDir))); err != nil {
+			return fmt.Errorf("failed to apply notification settings: %w", err)
+		}
+	}
+	return nil
+}
+
+// override sets *field to value, unless value is zero.
+func override[T comparable](field *T, value T) {
+	var zero T
+	if value != zero {
+		*field = value
+	}
+}
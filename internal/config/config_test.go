@@ -0,0 +1,131 @@
+package config
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mobileshell/internal/auth"
+	"mobileshell/internal/notify"
+	"mobileshell/internal/retention"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "mobileshell.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+	c, err := Load(writeConfig(t, `
+state-dir: /var/lib/mobileshell
+port: "8080"
+widget-cors-origins: [https://grafana.example.com]
+trusted-proxies: [127.0.0.1, 10.0.0.0/8]
+session:
+  duration: 12h
+retention:
+  max-age-days: 30
+storage:
+  warning-bytes: 1073741824
+notifications:
+  on-failure: false
+  ntfy-url: https://ntfy.sh/my-builds
+  rules:
+    - class: failure
+      command: ^make
+      backends: [ntfy]
+    - class: any
+      backends: [none]
+`))
+	require.NoError(t, err)
+	require.Equal(t, "/var/lib/mobileshell", c.StateDir)
+	require.Equal(t, DefaultListen, c.Listen)
+	require.Equal(t, "8080", c.Port)
+	require.Equal(t, []string{"https://grafana.example.com"}, c.WidgetOrigins)
+	proxies, err := c.TrustedProxyPrefixes()
+	require.NoError(t, err)
+	require.Equal(t, []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("10.0.0.0/8")}, proxies)
+	require.Equal(t, 12*time.Hour, c.SessionConfig(auth.DefaultSessionConfig()).Duration)
+	require.Equal(t, retention.Policy{MaxAgeDays: 30}, c.RetentionPolicy())
+	require.Equal(t, int64(1<<30), c.Storage.WarningBytes)
+	n := c.NotifyConfig(notify.DefaultConfig())
+	require.False(t, n.OnFailure)
+	require.Equal(t, "https://ntfy.sh/my-builds", n.NtfyURL)
+	require.Equal(t, []notify.Rule{
+		{Class: notify.ClassFailure, Command: "^make", Backends: []string{"ntfy"}},
+		{Class: "any", Backends: []string{"none"}},
+	}, n.Rules)
+
+	// The rules of the settings page can be copied into the config file
+	exported, err := NotifyRulesYAML(n.Rules)
+	require.NoError(t, err)
+	c, err = Load(writeConfig(t, exported))
+	require.NoError(t, err)
+	require.Equal(t, n.Rules, c.NotifyConfig(notify.DefaultConfig()).Rules)
+
+	c, err = Load(writeConfig(t, ""))
+	require.NoError(t, err)
+	require.Equal(t, Default(), c)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := Load(writeConfig(t, "prot: 8080\n"))
+	require.ErrorContains(t, err, "field prot not found")
+	_, err = Load(writeConfig(t, "port: http\n"))
+	require.ErrorContains(t, err, "port must be a number")
+	_, err = Load(writeConfig(t, "trusted-proxies: [proxy.example.com]\n"))
+	require.ErrorContains(t, err, "trusted-proxies")
+	_, err = Load(writeConfig(t, "session:\n  duration: forever\n"))
+	require.ErrorContains(t, err, "invalid config file")
+	_, err = Load(writeConfig(t, "session:\n  duration: 1m\n"))
+	require.ErrorContains(t, err, "session: session duration must be between")
+	_, err = Load(writeConfig(t, "retention:\n  max-count: -1\n"))
+	require.ErrorContains(t, err, "retention: limits must not be negative")
+	_, err = Load(writeConfig(t, "storage:\n  warning-bytes: -1\n"))
+	require.ErrorContains(t, err, "storage: warning-bytes must not be negative")
+	_, err = Load(writeConfig(t, "notifications:\n  webhook-url: ftp://example.com\n"))
+	require.ErrorContains(t, err, "notifications: webhook URL must be an http or https URL")
+	_, err = Load(writeConfig(t, "notifications:\n  rules:\n    - class: crashed\n      backends: [ntfy]\n"))
+	require.ErrorContains(t, err, "notifications: rule 1: invalid class")
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorContains(t, err, "failed to read config file")
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	saved := auth.DefaultSessionConfig()
+	saved.MaxLifetime = 60 * 24 * time.Hour
+	require.NoError(t, auth.SaveSessionConfig(stateDir, saved))
+
+	// Nothing set, nothing written
+	require.NoError(t, Default().Apply(stateDir))
+	require.Equal(t, saved, auth.LoadSessionConfig(stateDir))
+	require.NoDirExists(t, filepath.Join(stateDir, "notify"))
+
+	c := Default()
+	c.Session.Duration = 12 * time.Hour
+	c.Notifications.NtfyURL = "https://ntfy.sh/my-builds"
+	require.NoError(t, c.Apply(stateDir))
+	session := auth.LoadSessionConfig(stateDir)
+	require.Equal(t, 12*time.Hour, session.Duration)
+	// The settings which the file doesn't set are kept
+	require.Equal(t, 60*24*time.Hour, session.MaxLifetime)
+	n := notify.LoadConfig(stateDir)
+	require.Equal(t, "https://ntfy.sh/my-builds", n.NtfyURL)
+	require.True(t, n.OnFailure)
+
+	// An empty list removes the rules of the settings page
+	require.NoError(t, notify.SaveConfig(stateDir, notify.Config{Rules: []notify.Rule{{Class: "any", Backends: []string{"all"}}}}))
+	c = Default()
+	c.Notifications.Rules = []NotifyRule{}
+	require.NoError(t, c.Apply(stateDir))
+	require.Empty(t, notify.LoadConfig(stateDir).Rules)
+}
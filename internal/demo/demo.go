@@ -0,0 +1,151 @@
+// Package demo seeds a state directory with workspaces and processes for `mobileshell demo`.
+// The processes get created with executor.Fake, no command is executed.
+package demo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"mobileshell/internal/executor"
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+)
+
+// results are the canned outputs of the seeded commands.
+var results = map[string]executor.FakeResult{
+	"go test ./...": {
+		Stdout:   "ok  \tshop/cart\t0.412s\nok  \tshop/payment\t1.027s\n?   \tshop/cmd/shop\t[no test files]\n",
+		Duration: 14 * time.Second,
+	},
+	"go vet ./...": {
+		Stderr:   "# shop/payment\npayment/stripe.go:42:2: unreachable code\n",
+		ExitCode: 1,
+		Duration: 6 * time.Second,
+	},
+	"cat README.md": {
+		Stdout:   readme,
+		Duration: 50 * time.Millisecond,
+	},
+	"git log --oneline --color=always -5": {
+		Stdout: "\x1b[33m3f2a9c1\x1b[m Add coupon codes\n" +
+			"\x1b[33m9b1d0e4\x1b[m Fix rounding of VAT\n" +
+			"\x1b[33m47c8e2a\x1b[m Update dependencies\n" +
+			"\x1b[33m1e0f5b7\x1b[m Show cart in header\n" +
+			"\x1b[33m0a9d3c2\x1b[m Initial commit\n",
+		Duration: 120 * time.Millisecond,
+	},
+	"curl -s https://api.example.com/orders/1042": {
+		Stdout:   `{"id": 1042, "status": "shipped", "items": [{"sku": "MUG-01", "quantity": 2}, {"sku": "TEE-XL", "quantity": 1}], "total": 47.5}` + "\n",
+		Duration: 800 * time.Millisecond,
+	},
+	"kubectl get pods": {
+		Stdout: "NAME                    READY   STATUS    RESTARTS   AGE\n" +
+			"shop-7d9f8b6c4-2xkqp    1/1     Running   0          3d\n" +
+			"shop-7d9f8b6c4-9lmzr    1/1     Running   1          3d\n" +
+			"worker-5c6b7d8f9-q4t2n  1/1     Running   0          12h\n",
+		Duration: 2 * time.Second,
+	},
+	"./deploy.sh": {
+		Stdout:   "Building image shop:3f2a9c1\nPushing image\nWaiting for rollout\n",
+		Signal:   "interrupt",
+		ExitCode: -1,
+		Duration: 95 * time.Second,
+	},
+	"tail -f /var/log/shop/access.log": {
+		Stdout:   "10.0.0.7 - - \"GET /cart HTTP/1.1\" 200 5120\n10.0.0.9 - - \"POST /checkout HTTP/1.1\" 302 0\n",
+		Signal:   "terminated",
+		ExitCode: -1,
+		Duration: 20 * time.Minute,
+	},
+}
+
+const readme = `# Shop
+
+A small web shop.
+
+## Development
+
+- Run the tests with ` + "`go test ./...`" + `
+- Start the server with ` + "`go run ./cmd/shop`" + `
+`
+
+// demoWorkspace is a seeded workspace with the commands which were run in it.
+type demoWorkspace struct {
+	name        string
+	color       string
+	icon        string
+	environment string
+	files       map[string]string // Files in the directory of the workspace
+	commands    []string
+	pipeline    []string // Commands of a pipeline which runs after the commands
+}
+
+var workspaces = []demoWorkspace{
+	{
+		name:        "shop",
+		color:       "#198754",
+		icon:        "🛒",
+		environment: workspace.EnvironmentDev,
+		files: map[string]string{
+			"README.md": readme,
+			"main.go":   "package main\n\nfunc main() {\n\tprintln(\"shop\")\n}\n",
+		},
+		commands: []string{"cat README.md", "git log --oneline --color=always -5", "go test ./..."},
+		pipeline: []string{"go vet ./...", "go test ./..."},
+	},
+	{
+		name:        "production",
+		color:       "#dc3545",
+		icon:        "🔥",
+		environment: workspace.EnvironmentProd,
+		files: map[string]string{
+			"deploy.sh": "#!/bin/sh\necho deploying\n",
+		},
+		commands: []string{"kubectl get pods", "curl -s https://api.example.com/orders/1042", "tail -f /var/log/shop/access.log", "./deploy.sh"},
+	},
+}
+
+// Seed creates the demo workspaces and their processes in stateDir. The directories of the
+// workspaces are created in stateDir, too.
+func Seed(stateDir string) error {
+	fake := &executor.Fake{Results: results}
+	for _, dw := range workspaces {
+		dir := filepath.Join(stateDir, "demo", dw.name)
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("failed to create demo directory: %w", err)
+		}
+		for name, content := range dw.files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+				return fmt.Errorf("failed to write demo file %s: %w", name, err)
+			}
+		}
+
+		ws, err := workspace.CreateWorkspace(stateDir, dw.name, dir, "")
+		if err != nil {
+			return err
+		}
+		if err := workspace.SaveIdentity(ws, dw.color, dw.icon); err != nil {
+			return err
+		}
+		if err := workspace.SaveEnvironment(ws, dw.environment); err != nil {
+			return err
+		}
+
+		for _, command := range dw.commands {
+			if _, err := fake.Execute(ws, command, "", process.Limits{}); err != nil {
+				return err
+			}
+			if err := workspace.AppendHistory(ws, command); err != nil {
+				return err
+			}
+		}
+		if len(dw.pipeline) > 0 {
+			if _, err := fake.ExecutePipeline(ws, dw.pipeline, process.PipelineOnSuccess, "", process.Limits{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package demo
+
+import (
+	"testing"
+
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeed(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(stateDir))
+	require.NoError(t, Seed(stateDir))
+
+	ws, err := workspace.GetWorkspaceByID(stateDir, "production")
+	require.NoError(t, err)
+	require.True(t, ws.IsProduction())
+	processes, err := workspace.ListProcesses(ws)
+	require.NoError(t, err)
+	require.Len(t, processes, len(workspaces[1].commands))
+	require.Contains(t, process.CollectOutputTypes(processes), "json")
+
+	ws, err = workspace.GetWorkspaceByID(stateDir, "shop")
+	require.NoError(t, err)
+	history, err := workspace.LoadHistory(ws)
+	require.NoError(t, err)
+	require.Contains(t, history, "go test ./...")
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package doctor
+
+import "golang.org/x/sys/unix"
+
+// freeBytes returns the number of bytes which are available to unprivileged users on the file
+// system of path.
+func freeBytes(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package doctor
+
+import "golang.org/x/sys/windows"
+
+// freeBytes returns the number of bytes which are available to the current user on the volume
+// of path.
+func freeBytes(path string) (uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
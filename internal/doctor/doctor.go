@@ -0,0 +1,237 @@
+// Package doctor validates a MobileShell installation and produces an actionable report. It is
+// used by the `mobileshell doctor` subcommand and by the doctor page of the web UI.
+package doctor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"mobileshell/internal/auth"
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+	"mobileshell/pkg/outputlog"
+)
+
+// Status is the result of a single check.
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusWarning Status = "warning"
+	StatusError   Status = "error"
+)
+
+// Check is one line of the report. Hint tells the user how to fix a problem.
+type Check struct {
+	Name    string
+	Status  Status
+	Message string
+	Hint    string
+}
+
+// Report is the result of Run.
+type Report struct {
+	Checks []Check
+}
+
+// HasErrors returns true if at least one check failed.
+func (r Report) HasErrors() bool {
+	for _, check := range r.Checks {
+		if check.Status == StatusError {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// Less free space than this is an error, less than diskWarningBytes a warning.
+	diskErrorBytes   = 100 << 20
+	diskWarningBytes = 1 << 30
+)
+
+// Run checks the state directory. assets are the embedded static files of the web UI.
+func Run(stateDir string, assets fs.FS) Report {
+	var report Report
+	report.Checks = append(report.Checks, checkStateDir(stateDir))
+	report.Checks = append(report.Checks, checkProcesses(stateDir)...)
+	report.Checks = append(report.Checks, checkSessions(stateDir))
+	report.Checks = append(report.Checks, checkAssets(assets)...)
+	report.Checks = append(report.Checks, checkDiskSpace(stateDir))
+	return report
+}
+
+func checkStateDir(stateDir string) Check {
+	check := Check{Name: "State directory " + stateDir}
+	info, err := os.Stat(stateDir)
+	if err != nil {
+		check.Status = StatusError
+		check.Message = err.Error()
+		check.Hint = "Start the server once with `mobileshell run` to create it, or pass --state-dir"
+		return check
+	}
+	if !info.IsDir() {
+		check.Status = StatusError
+		check.Message = "not a directory"
+		return check
+	}
+
+	tmpFile, err := os.CreateTemp(stateDir, ".doctor-*")
+	if err != nil {
+		check.Status = StatusError
+		check.Message = fmt.Sprintf("not writable: %v", err)
+		check.Hint = "Fix the owner of the directory, it must be writable by the user running mobileshell"
+		return check
+	}
+	_ = tmpFile.Close()
+	_ = os.Remove(tmpFile.Name())
+
+	if info.Mode().Perm()&0o077 != 0 {
+		check.Status = StatusWarning
+		check.Message = fmt.Sprintf("permissions %s allow access by other users", info.Mode().Perm())
+		check.Hint = "chmod 700 " + stateDir
+		return check
+	}
+	check.Status = StatusOK
+	check.Message = fmt.Sprintf("writable, permissions %s", info.Mode().Perm())
+	return check
+}
+
+// checkProcesses reports process directories which can't be loaded, processes which are
+// marked as running but are not alive, and malformed output logs of finished processes.
+func checkProcesses(stateDir string) []Check {
+	workspaces, err := workspace.ListWorkspaces(stateDir)
+	if err != nil {
+		return []Check{{Name: "Workspaces", Status: StatusError, Message: err.Error()}}
+	}
+
+	var checks []Check
+	var orphaned, malformed []string
+	count := 0
+	for _, ws := range workspaces {
+		processesDir := filepath.Join(ws.Path, "processes")
+		entries, err := os.ReadDir(processesDir)
+		if err != nil && !os.IsNotExist(err) {
+			checks = append(checks, Check{Name: "Workspace " + ws.ID, Status: StatusError, Message: err.Error()})
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			count++
+			processDir := filepath.Join(processesDir, entry.Name())
+			proc, err := process.LoadProcessFromDir(processDir)
+			if err != nil {
+				orphaned = append(orphaned, fmt.Sprintf("%s (%v)", processDir, err))
+				continue
+			}
+			if !proc.Completed {
+				if proc.PID != 0 && !proc.Alive() {
+					orphaned = append(orphaned, fmt.Sprintf("%s (PID %d is not running)", processDir, proc.PID))
+				}
+				continue
+			}
+			if err := outputlog.Verify(proc.OutputFile); err != nil && !os.IsNotExist(err) {
+				malformed = append(malformed, err.Error())
+			}
+		}
+	}
+
+	checks = append(checks, listCheck("Orphaned process directories", count, orphaned,
+		"A running server marks dead processes as completed within seconds. Start it, or delete the directories"))
+	checks = append(checks, listCheck("Output logs", count, malformed,
+		"Download what is left of the output, then delete the process"))
+	return checks
+}
+
+// listCheck creates a warning check listing problems, or an OK check if there are none.
+func listCheck(name string, count int, problems []string, hint string) Check {
+	if len(problems) == 0 {
+		return Check{Name: name, Status: StatusOK, Message: fmt.Sprintf("%d processes checked", count)}
+	}
+	return Check{
+		Name:    name,
+		Status:  StatusWarning,
+		Message: fmt.Sprintf("%d of %d processes:\n%s", len(problems), count, strings.Join(problems, "\n")),
+		Hint:    hint,
+	}
+}
+
+func checkSessions(stateDir string) Check {
+	check := Check{Name: "Sessions"}
+	expired, err := auth.ExpiredSessions(stateDir)
+	switch {
+	case os.IsNotExist(err):
+		check.Status = StatusOK
+		check.Message = "no sessions yet"
+	case err != nil:
+		check.Status = StatusError
+		check.Message = err.Error()
+	case len(expired) > 0:
+		check.Status = StatusWarning
+		check.Message = fmt.Sprintf("%d expired sessions were not removed", len(expired))
+		check.Hint = "A running server removes expired sessions hourly. Start it, or delete the files in the sessions directory"
+	default:
+		check.Status = StatusOK
+		check.Message = "no expired sessions"
+	}
+	return check
+}
+
+// versionRegex finds version numbers in the headers of minified assets, for example
+// "Bootstrap  v5.3.8" or `version:"2.0.4"`.
+var versionRegex = regexp.MustCompile(`(?:\bv|version\W{1,3})(\d+\.\d+\.\d+)`)
+
+// checkAssets lists the embedded static files with their version and checksum.
+func checkAssets(assets fs.FS) []Check {
+	var checks []Check
+	err := fs.WalkDir(assets, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(assets, path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		message := "sha256 " + hex.EncodeToString(sum[:])[:12]
+		if match := versionRegex.FindSubmatch(data); match != nil {
+			message = "version " + string(match[1]) + ", " + message
+		}
+		checks = append(checks, Check{Name: "Asset " + path, Status: StatusOK, Message: message})
+		return nil
+	})
+	if err != nil {
+		checks = append(checks, Check{Name: "Assets", Status: StatusError, Message: err.Error()})
+	}
+	return checks
+}
+
+func checkDiskSpace(stateDir string) Check {
+	check := Check{Name: "Disk space"}
+	free, err := freeBytes(stateDir)
+	if err != nil {
+		check.Status = StatusWarning
+		check.Message = err.Error()
+		return check
+	}
+	check.Message = fmt.Sprintf("%d MiB free", free>>20)
+	switch {
+	case free < diskErrorBytes:
+		check.Status = StatusError
+	case free < diskWarningBytes:
+		check.Status = StatusWarning
+	default:
+		check.Status = StatusOK
+		return check
+	}
+	check.Hint = "Delete old processes, or configure a retention policy for the workspaces"
+	return check
+}
@@ -0,0 +1,77 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"mobileshell/internal/auth"
+	"mobileshell/internal/workspace"
+	"mobileshell/pkg/outputlog"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeProcessDir(t *testing.T, ws *workspace.Workspace, commandId string, files map[string]string) {
+	t.Helper()
+	processDir := workspace.GetProcessDir(ws, commandId)
+	require.NoError(t, os.MkdirAll(processDir, 0o700))
+	files["cmd"] = "echo"
+	files["starttime"] = time.Now().UTC().Format(time.RFC3339Nano)
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(processDir, name), []byte(content), 0o600))
+	}
+}
+
+func findCheck(t *testing.T, report Report, name string) Check {
+	t.Helper()
+	i := slices.IndexFunc(report.Checks, func(check Check) bool { return check.Name == name })
+	require.NotEqual(t, -1, i, "check %q not found", name)
+	return report.Checks[i]
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, os.Chmod(stateDir, 0o700))
+	require.NoError(t, auth.InitAuth(stateDir))
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "sessions", "expired"), []byte("1"), 0o600))
+	ws, err := workspace.CreateWorkspace(stateDir, "doctor-ws", stateDir, "")
+	require.NoError(t, err)
+
+	validLog := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("ok\n")})
+	writeProcessDir(t, ws, "2025-01-07T10:00:00Z", map[string]string{"completed": "true", "output.log": string(validLog)})
+	writeProcessDir(t, ws, "2025-01-07T11:00:00Z", map[string]string{"completed": "true", "output.log": string(validLog[:len(validLog)-3])})
+	writeProcessDir(t, ws, "2025-01-07T12:00:00Z", map[string]string{"completed": "false", "pid": "999999999"})
+
+	assets := fstest.MapFS{"lib.min.js": {Data: []byte(`/*! lib v1.2.3 */`)}}
+	report := Run(stateDir, assets)
+
+	require.Equal(t, StatusOK, findCheck(t, report, "State directory "+stateDir).Status)
+
+	orphaned := findCheck(t, report, "Orphaned process directories")
+	require.Equal(t, StatusWarning, orphaned.Status)
+	require.Contains(t, orphaned.Message, "2025-01-07T12:00:00Z (PID 999999999 is not running)")
+
+	logs := findCheck(t, report, "Output logs")
+	require.Equal(t, StatusWarning, logs.Status)
+	require.Contains(t, logs.Message, "1 of 3 processes")
+	require.Contains(t, logs.Message, "2025-01-07T11:00:00Z")
+	require.Contains(t, logs.Message, "incomplete record")
+
+	require.Equal(t, StatusWarning, findCheck(t, report, "Sessions").Status)
+	require.Equal(t, "version 1.2.3, sha256 ", findCheck(t, report, "Asset lib.min.js").Message[:22])
+	require.False(t, report.HasErrors())
+}
+
+func TestRun_MissingStateDir(t *testing.T) {
+	t.Parallel()
+	stateDir := filepath.Join(t.TempDir(), "missing")
+	report := Run(stateDir, fstest.MapFS{})
+
+	require.Equal(t, StatusError, findCheck(t, report, "State directory "+stateDir).Status)
+	require.True(t, report.HasErrors())
+}
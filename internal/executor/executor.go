@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"time"
 
+	"mobileshell/internal/activity"
+	"mobileshell/internal/metadata"
 	"mobileshell/internal/process"
 	"mobileshell/internal/workspace"
 	"mobileshell/pkg/outputlog"
@@ -53,73 +55,118 @@ func GetWorkspaceByID(stateDir, id string) (*workspace.Workspace, error) {
 }
 
 // Execute spawns a new process in the given workspace. It uses exec.Command() to call the nohup
-// subcommand. It does not wait for completion.
-func Execute(ws *workspace.Workspace, command string) (*process.Process, error) {
-	if ws == nil {
-		return nil, fmt.Errorf("workspace is nil")
-	}
+// subcommand. It does not wait for completion. profile selects a pre-command profile of the
+// workspace, the empty string selects the default pre-command. If the workspace has no free
+// slot, the process gets queued, see StartQueued.
+func Execute(ws *workspace.Workspace, command, profile string) (*process.Process, error) {
+	return execute(ws, command, profile, process.Limits{}, nil)
+}
 
-	// Get the path to the current executable
-	execPath, err := os.Executable()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get executable path: %w", err)
-	}
+// ExecuteWithLimits is like Execute, but nohup enforces the resource limits on the process.
+func ExecuteWithLimits(ws *workspace.Workspace, command, profile string, limits process.Limits) (*process.Process, error) {
+	return execute(ws, command, profile, limits, nil)
+}
 
-	// Generate hash for the process
-	commandId := time.Now().UTC().Format(outputlog.TimeFormatRFC3339NanoUTC)
+// Executor starts processes in a workspace. Nohup runs the commands, Fake is used by the
+// demo mode and doesn't run anything.
+type Executor interface {
+	Execute(ws *workspace.Workspace, command, profile string, limits process.Limits) (*process.Process, error)
+	ExecutePipeline(ws *workspace.Workspace, commands []string, condition, profile string, limits process.Limits) (*process.Process, error)
+}
 
-	processDir := filepath.Join(ws.Path, "processes", commandId)
-	if err := os.MkdirAll(processDir, 0o700); err != nil {
-		return nil, fmt.Errorf("failed to create process directory: %w", err)
-	}
+// Nohup is the Executor which runs the commands with `mobileshell nohup`.
+type Nohup struct{}
 
-	proc := &process.Process{
-		CommandId:  commandId,
-		Command:    command,
-		Completed:  false,
-		ProcessDir: processDir,
-		OutputFile: filepath.Join(processDir, "output.log"),
-	}
+func (Nohup) Execute(ws *workspace.Workspace, command, profile string, limits process.Limits) (*process.Process, error) {
+	return ExecuteWithLimits(ws, command, profile, limits)
+}
 
-	cmdPath := filepath.Join(processDir, "cmd")
-	err = os.WriteFile(cmdPath, []byte(command), 0o600)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write %q: %w", cmdPath, err)
+func (Nohup) ExecutePipeline(ws *workspace.Workspace, commands []string, condition, profile string, limits process.Limits) (*process.Process, error) {
+	return ExecutePipeline(ws, commands, condition, profile, limits)
+}
+
+// execute creates the process and starts it, or queues it if the workspace has no free slot,
+// see StartQueued. The next steps of a pipeline are never queued, they take over the slot of
+// the previous step.
+func execute(ws *workspace.Workspace, command, profile string, limits process.Limits, pl *pipeline) (*process.Process, error) {
+	if err := process.CheckPlatform(); err != nil {
+		return nil, err
+	}
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	queue := false
+	if pl == nil || pl.previous == "" {
+		var err error
+		if queue, err = mustQueue(ws); err != nil {
+			return nil, err
+		}
 	}
 
-	// Write starttime file
-	startTime := time.Now().UTC().Format(outputlog.TimeFormatRFC3339NanoUTC)
-	if err := os.WriteFile(filepath.Join(processDir, "starttime"), []byte(startTime), 0o600); err != nil {
-		return nil, fmt.Errorf("failed to write starttime file: %w", err)
+	// Without priorities of its own, the process gets the defaults of the workspace
+	if ws != nil && limits.Nice == 0 {
+		limits.Nice = ws.Nice
+	}
+	if ws != nil && limits.IOPriority == "" {
+		limits.IOPriority = ws.IOPriority
+	}
+	proc, err := createProcess(ws, command, profile, limits, pl)
+	if err != nil {
+		return nil, err
 	}
+	// The profile was checked by createProcess
+	preCommand, _ := ws.PreCommandForProfile(profile)
 
 	// Create script
-	var nohupCommand string
-	if ws.PreCommand == "" {
+	nohupCommand := preCommand
+	if nohupCommand == "" {
 		nohupCommand = "#!/usr/bin/env bash"
-	} else {
-		nohupCommand = ws.PreCommand
 	}
 
-	nohupCommandPath := filepath.Join(processDir, "nohup-command")
-	if err := os.WriteFile(nohupCommandPath,
+	nohupCommandPath := filepath.Join(proc.ProcessDir, "nohup-command")
+	if err := metadata.WriteFile(nohupCommandPath,
 		[]byte(nohupCommand+"\n"+command), 0o700); err != nil {
 		return nil, fmt.Errorf("failed to write nohup-command file: %w", err)
 	}
 
+	if queue {
+		if err := process.MarkQueued(proc.ProcessDir); err != nil {
+			return nil, err
+		}
+		proc.Queued = true
+		slog.Info("Queued process, the workspace has no free slot", "workspace", ws.ID, "process", proc.CommandId, "maxConcurrent", ws.MaxConcurrent)
+		return proc, nil
+	}
+	if err := spawn(ws, proc, profile); err != nil {
+		return nil, err
+	}
+	return proc, nil
+}
+
+// spawn starts the nohup process of proc, whose nohup-command file was written by execute.
+func spawn(ws *workspace.Workspace, proc *process.Process, profile string) error {
+	processDir := proc.ProcessDir
+	nohupCommandPath := filepath.Join(processDir, "nohup-command")
+
+	// Get the path to the current executable
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+
 	// Spawn the process using `mobileshell nohup` in the background
 	// In test mode, use `go run` to execute the mobileshell command
 
-	// Use a shorter socket path to avoid Unix socket path length limit (108 chars)
-	// Store the socket in /tmp with a unique name based on the process timestamp
-	socketPath := filepath.Join("/tmp", "ms-"+commandId+".sock")
+	socketPath := SocketPath(proc.CommandId)
 
 	args := []string{
 		"nohup",
 		"--input-unix-domain-socket", socketPath,
 		"--working-directory", ws.Directory,
-		nohupCommandPath,
 	}
+	if profile != "" {
+		args = append(args, "--profile", profile)
+	}
+	args = append(args, nohupCommandPath)
 	if filepath.Ext(execPath) == ".test" {
 		// Use ./cmd/mobileshell for go run (works from project root)
 		cmd := []string{"run", "./cmd/mobileshell"}
@@ -128,7 +175,7 @@ func Execute(ws *workspace.Workspace, command string) (*process.Process, error)
 		// Set working directory to project root (where go.mod is)
 		projectRoot, err := findProjectRoot()
 		if err != nil {
-			return nil, fmt.Errorf("failed to find project root: %w", err)
+			return fmt.Errorf("failed to find project root: %w", err)
 		}
 		goCmd.Dir = projectRoot
 		proc.ExecCmd = goCmd
@@ -140,7 +187,7 @@ func Execute(ws *workspace.Workspace, command string) (*process.Process, error)
 	nohupLogPath := filepath.Join(processDir, "nohup.log")
 	nohupLogFile, err := os.OpenFile(nohupLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create nohup.log: %w", err)
+		return fmt.Errorf("failed to create nohup.log: %w", err)
 	}
 	proc.ExecCmd.Stdout = nohupLogFile
 	proc.ExecCmd.Stderr = nohupLogFile
@@ -152,7 +199,91 @@ func Execute(ws *workspace.Workspace, command string) (*process.Process, error)
 
 	if err := proc.ExecCmd.Start(); err != nil {
 		_ = nohupLogFile.Close()
-		return nil, fmt.Errorf("failed to spawn nohup process: %w", err)
+		return fmt.Errorf("failed to spawn nohup process: %w", err)
+	}
+	recordActivity(activity.ProcessStarted, processDir)
+
+	return nil
+}
+
+// recordActivity records the start of the process in processDir with record, see
+// activity.ProcessStarted. Errors are only logged, the index is only for the overview.
+func recordActivity(record func(processDir string) error, processDir string) {
+	if err := record(processDir); err != nil {
+		slog.Warn("Failed to record activity", "processDir", processDir, "error", err)
+	}
+}
+
+// SocketPath returns the Unix domain socket of the nohup process of commandId, which takes stdin
+// chunks in the output log format. It is short to avoid the Unix socket path length limit (108
+// chars), so it is in /tmp with a unique name based on the process timestamp.
+func SocketPath(commandId string) string {
+	return filepath.Join("/tmp", "ms-"+commandId+".sock")
+}
+
+// CreateProcess creates the directory of a new process which is not run by nohup, for example
+// an interactive terminal session. The caller writes its output log and completes it.
+func CreateProcess(ws *workspace.Workspace, command string) (*process.Process, error) {
+	return createProcess(ws, command, "", process.Limits{}, nil)
+}
+
+// createProcess creates the directory of a new process with the files which are known before
+// the command starts. Commands which the policy of the workspace denies are not created.
+func createProcess(ws *workspace.Workspace, command, profile string, limits process.Limits, pl *pipeline) (*process.Process, error) {
+	if ws == nil {
+		return nil, fmt.Errorf("workspace is nil")
+	}
+	if _, err := ws.PreCommandForProfile(profile); err != nil {
+		return nil, err
+	}
+	if err := ws.CheckCommand(command); err != nil {
+		return nil, err
+	}
+
+	// Generate hash for the process
+	commandId := time.Now().UTC().Format(outputlog.TimeFormatRFC3339NanoUTC)
+
+	processDir := filepath.Join(ws.Path, "processes", commandId)
+	if err := os.MkdirAll(processDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create process directory: %w", err)
+	}
+
+	proc := &process.Process{
+		CommandId:  commandId,
+		Command:    command,
+		Completed:  false,
+		ProcessDir: processDir,
+		OutputFile: filepath.Join(processDir, "output.log"),
+	}
+
+	cmdPath := filepath.Join(processDir, "cmd")
+	if err := metadata.WriteFile(cmdPath, []byte(command), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write %q: %w", cmdPath, err)
+	}
+
+	// Write starttime file
+	startTime := time.Now().UTC().Format(outputlog.TimeFormatRFC3339NanoUTC)
+	if err := metadata.WriteFile(filepath.Join(processDir, "starttime"), []byte(startTime), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write starttime file: %w", err)
+	}
+
+	if profile != "" {
+		if err := metadata.WriteFile(filepath.Join(processDir, "profile"), []byte(profile), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write profile file: %w", err)
+		}
+	}
+
+	// The limits are read by the nohup process when it starts the command
+	if err := process.WriteLimits(processDir, limits); err != nil {
+		return nil, err
+	}
+
+	// The pipeline files must exist before the process starts, because the nohup process
+	// reads them as soon as the command completed
+	if pl != nil {
+		if err := pl.writeFiles(processDir); err != nil {
+			return nil, err
+		}
 	}
 
 	return proc, nil
@@ -11,6 +11,7 @@ import (
 	"mobileshell/internal/workspace"
 	"mobileshell/pkg/outputlog"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -119,7 +120,7 @@ func TestExecute(t *testing.T) {
 	}
 
 	// Execute a simple command
-	proc, err := Execute(ws, "echo 'test'")
+	proc, err := Execute(ws, "echo 'test'", "")
 	if err != nil {
 		t.Fatalf("Execute failed: %v", err)
 	}
@@ -164,7 +165,7 @@ func TestListWorkspaceProcesses(t *testing.T) {
 	}
 
 	// Execute a command
-	proc, err := Execute(ws, "echo 'test'")
+	proc, err := Execute(ws, "echo 'test'", "")
 	if err != nil {
 		t.Fatalf("Execute failed: %v", err)
 	}
@@ -211,7 +212,7 @@ func TestGetProcess(t *testing.T) {
 	}
 
 	// Execute a command
-	proc, err := Execute(ws, "echo 'test'")
+	proc, err := Execute(ws, "echo 'test'", "")
 	if err != nil {
 		t.Fatalf("Execute failed: %v", err)
 	}
@@ -518,3 +519,63 @@ func TestReadCombinedOutputNewFormat(t *testing.T) {
 		t.Errorf("stdin should contain 'input text', got: %s", stdin)
 	}
 }
+
+func TestExecutePipeline(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitExecutor(stateDir))
+	ws, err := CreateWorkspace(stateDir, "pipeline-workspace", t.TempDir(), "")
+	require.NoError(t, err)
+
+	_, err = ExecutePipeline(ws, []string{"true"}, "sometimes", "", process.Limits{})
+	require.Error(t, err)
+
+	first, err := ExecutePipeline(ws, []string{"exit 3", "echo second"}, process.PipelineAlways, "", process.Limits{})
+	require.NoError(t, err)
+
+	// The nohup process of the first step starts the second step
+	var second *process.Process
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		processes, err := workspace.ListProcesses(ws)
+		assert.NoError(collect, err)
+		assert.Len(collect, processes, 2)
+		second = processes[len(processes)-1]
+		assert.True(collect, second.Completed)
+	}, 60*time.Second, 100*time.Millisecond)
+	require.Equal(t, "echo second", second.Command)
+	require.Equal(t, first.CommandId, second.PipelinePrevious)
+	require.Empty(t, second.PipelineSteps)
+
+	first, err = process.LoadProcessFromDir(first.ProcessDir)
+	require.NoError(t, err)
+	require.Equal(t, 3, first.ExitCode)
+	require.Equal(t, second.CommandId, first.PipelineNext)
+	require.Equal(t, []string{"echo second"}, first.PipelineSteps)
+	require.False(t, first.PipelineSkipped())
+}
+
+func TestStartNextPipelineStepSkipsOnFailure(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitExecutor(stateDir))
+	ws, err := CreateWorkspace(stateDir, "pipeline-workspace", t.TempDir(), "")
+	require.NoError(t, err)
+	processDir := filepath.Join(ws.Path, "processes", "2025-01-07T10:00:00Z")
+	require.NoError(t, os.MkdirAll(processDir, 0o700))
+	require.NoError(t, (&pipeline{steps: []string{"echo never"}, condition: process.PipelineOnSuccess}).writeFiles(processDir))
+	files := map[string]string{
+		"cmd":         "false",
+		"starttime":   "2025-01-07T10:00:00Z",
+		"completed":   "true",
+		"exit-status": "1",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(processDir, name), []byte(content), 0o600))
+	}
+
+	require.NoError(t, StartNextPipelineStep(processDir))
+	processes, err := workspace.ListProcesses(ws)
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+	require.True(t, processes[0].PipelineSkipped())
+}
@@ -0,0 +1,25 @@
+package executor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteUnsupported(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitExecutor(stateDir))
+	ws, err := CreateWorkspace(stateDir, "windows", t.TempDir(), "")
+	require.NoError(t, err)
+
+	_, err = Execute(ws, "echo hello", "")
+	require.ErrorIs(t, err, errors.ErrUnsupported)
+
+	// No process directory is left behind, it would never complete
+	entries, _ := os.ReadDir(filepath.Join(ws.Path, "processes"))
+	require.Empty(t, entries)
+}
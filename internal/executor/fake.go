@@ -0,0 +1,147 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"mobileshell/internal/activity"
+	"mobileshell/internal/metadata"
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+	"mobileshell/pkg/outputlog"
+	"mobileshell/pkg/outputtype"
+)
+
+// FakeResult is the canned result of a command which Fake doesn't run.
+type FakeResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Signal   string        // Name of the signal which terminated the process, e.g. "killed"
+	Duration time.Duration // How long the process ran before it completed
+}
+
+// Fake is an Executor which doesn't run the commands. Each process completes at once with the
+// result from Results, or with a note that the command was not executed. It is used by the demo
+// mode, so that the web UI can be tried without running anything.
+type Fake struct {
+	Results map[string]FakeResult // Canned results by command
+}
+
+func (f *Fake) Execute(ws *workspace.Workspace, command, profile string, limits process.Limits) (*process.Process, error) {
+	proc, err := createProcess(ws, command, profile, limits, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.complete(proc); err != nil {
+		return nil, err
+	}
+	return proc, nil
+}
+
+// ExecutePipeline completes all steps of the pipeline at once, or up to the first failed step
+// if condition is process.PipelineOnSuccess.
+func (f *Fake) ExecutePipeline(ws *workspace.Workspace, commands []string, condition, profile string, limits process.Limits) (*process.Process, error) {
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("pipeline has no commands")
+	}
+	if condition != process.PipelineOnSuccess && condition != process.PipelineAlways {
+		return nil, fmt.Errorf("invalid pipeline condition %q", condition)
+	}
+	if err := checkCommands(ws, commands); err != nil {
+		return nil, err
+	}
+	var first, previous *process.Process
+	for i, command := range commands {
+		pl := &pipeline{steps: commands[i+1:], condition: condition}
+		if previous != nil {
+			pl.previous = previous.CommandId
+		}
+		proc, err := createProcess(ws, command, profile, limits, pl)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil {
+			if err := metadata.WriteFile(filepath.Join(previous.ProcessDir, "pipeline-next"), []byte(proc.CommandId), 0o600); err != nil {
+				return nil, fmt.Errorf("failed to write pipeline-next file: %w", err)
+			}
+		} else {
+			first = proc
+		}
+		if err := f.complete(proc); err != nil {
+			return nil, err
+		}
+		result := f.result(command)
+		if condition == process.PipelineOnSuccess && (result.ExitCode != 0 || result.Signal != "") {
+			break
+		}
+		previous = proc
+	}
+	return first, nil
+}
+
+// result returns the canned result of the command.
+func (f *Fake) result(command string) FakeResult {
+	if result, ok := f.Results[command]; ok {
+		return result
+	}
+	return FakeResult{Stdout: "Demo mode: the command was not executed.\n"}
+}
+
+// complete writes the files which nohup writes while and after the command ran.
+func (f *Fake) complete(proc *process.Process) error {
+	result := f.result(proc.Command)
+	endTime := time.Now().UTC()
+	startTime := endTime.Add(-result.Duration)
+
+	var output bytes.Buffer
+	for _, chunk := range []outputlog.Chunk{
+		{Stream: outputlog.StreamStdout, Timestamp: startTime, Line: []byte(result.Stdout)},
+		{Stream: outputlog.StreamStderr, Timestamp: endTime, Line: []byte(result.Stderr)},
+	} {
+		if len(chunk.Line) > 0 {
+			output.Write(outputlog.FormatChunk(chunk))
+		}
+	}
+
+	detector := outputtype.NewDetector()
+	detector.Feed([]byte(result.Stdout))
+	detector.Finish()
+	if detector.IsDetected() {
+		outputType, reason := detector.GetDetectedType()
+		if err := process.WriteOutputType(proc.ProcessDir, string(outputType), reason); err != nil {
+			return err
+		}
+	}
+
+	// The start time is written first, the activity records it with the completion
+	if err := metadata.WriteFile(filepath.Join(proc.ProcessDir, "starttime"), []byte(startTime.Format(outputlog.TimeFormatRFC3339NanoUTC)), 0o600); err != nil {
+		return fmt.Errorf("failed to write starttime file: %w", err)
+	}
+	files := []metadata.File{
+		{Name: "output.log", Content: output.String()},
+		{Name: "exit-status", Content: strconv.Itoa(result.ExitCode)},
+		{Name: "endtime", Content: endTime.Format(outputlog.TimeFormatRFC3339NanoUTC)},
+	}
+	if result.Signal != "" {
+		files = append(files, metadata.File{Name: "signal", Content: result.Signal})
+	}
+	recordActivity(activity.ProcessStarted, proc.ProcessDir)
+	if err := activity.ProcessFinished(proc.ProcessDir, endTime, result.ExitCode, result.Signal); err != nil {
+		slog.Warn("Failed to record activity", "processDir", proc.ProcessDir, "error", err)
+	}
+	if err := process.Complete(proc.ProcessDir, files...); err != nil {
+		return err
+	}
+
+	proc.StartTime = startTime
+	proc.EndTime = endTime
+	proc.ExitCode = result.ExitCode
+	proc.Signal = result.Signal
+	proc.Completed = true
+	return nil
+}
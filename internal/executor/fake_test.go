@@ -0,0 +1,85 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+	"mobileshell/pkg/outputlog"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeExecute(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitExecutor(stateDir))
+	ws, err := CreateWorkspace(stateDir, "fake-workspace", t.TempDir(), "")
+	require.NoError(t, err)
+	fake := &Fake{Results: map[string]FakeResult{
+		"make": {Stdout: "building\n", Stderr: "warning\n", ExitCode: 2, Duration: time.Minute},
+	}}
+
+	proc, err := fake.Execute(ws, "make", "", process.Limits{})
+	require.NoError(t, err)
+	loaded, err := process.LoadProcessFromDir(proc.ProcessDir)
+	require.NoError(t, err)
+	require.True(t, loaded.Completed)
+	require.Equal(t, 2, loaded.ExitCode)
+	require.Equal(t, time.Minute, loaded.EndTime.Sub(loaded.StartTime))
+	stdout, stderr, err := outputlog.ReadTwoStreams(proc.OutputFile, outputlog.StreamStdout, outputlog.StreamStderr)
+	require.NoError(t, err)
+	require.Equal(t, "building\n", string(stdout))
+	require.Equal(t, "warning\n", string(stderr))
+
+	// Other commands are not executed
+	proc, err = fake.Execute(ws, "rm -rf /", "", process.Limits{})
+	require.NoError(t, err)
+	stdout, err = outputlog.ReadOneStream(proc.OutputFile, outputlog.StreamStdout)
+	require.NoError(t, err)
+	require.Contains(t, string(stdout), "not executed")
+}
+
+func TestFakeExecutePipeline(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitExecutor(stateDir))
+	ws, err := CreateWorkspace(stateDir, "fake-pipeline", t.TempDir(), "")
+	require.NoError(t, err)
+	fake := &Fake{Results: map[string]FakeResult{"lint": {ExitCode: 1}}}
+
+	first, err := fake.ExecutePipeline(ws, []string{"build", "lint", "deploy"}, process.PipelineOnSuccess, "", process.Limits{})
+	require.NoError(t, err)
+	processes, err := workspace.ListProcesses(ws)
+	require.NoError(t, err)
+	require.Len(t, processes, 2)
+
+	first, err = process.LoadProcessFromDir(first.ProcessDir)
+	require.NoError(t, err)
+	second, err := process.LoadProcessFromDir(workspace.GetProcessDir(ws, first.PipelineNext))
+	require.NoError(t, err)
+	require.Equal(t, "lint", second.Command)
+	require.Equal(t, first.CommandId, second.PipelinePrevious)
+	require.True(t, second.PipelineSkipped())
+}
+
+func TestFakeExecuteCommandPolicy(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitExecutor(stateDir))
+	ws, err := CreateWorkspace(stateDir, "fake-policy", t.TempDir(), "")
+	require.NoError(t, err)
+	require.NoError(t, workspace.SaveCommandPolicy(ws, "deny ^deploy"))
+	fake := &Fake{}
+
+	_, err = fake.Execute(ws, "deploy prod", "", process.Limits{})
+	require.ErrorIs(t, err, workspace.ErrCommandDenied)
+
+	// A denied step denies the whole pipeline, before the first step runs
+	_, err = fake.ExecutePipeline(ws, []string{"build", "deploy prod"}, process.PipelineAlways, "", process.Limits{})
+	require.ErrorIs(t, err, workspace.ErrCommandDenied)
+	processes, err := workspace.ListProcesses(ws)
+	require.NoError(t, err)
+	require.Empty(t, processes)
+}
@@ -0,0 +1,112 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"mobileshell/internal/metadata"
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+)
+
+// pipeline is the position of a process in a pipeline. It is stored in the process directory
+// with one file per field.
+type pipeline struct {
+	previous  string   // CommandId of the previous step
+	steps     []string // Commands which run after the process
+	condition string   // process.PipelineOnSuccess or process.PipelineAlways
+}
+
+func (pl *pipeline) writeFiles(processDir string) error {
+	files := map[string]string{}
+	if pl.previous != "" {
+		files["pipeline-previous"] = pl.previous
+	}
+	if len(pl.steps) > 0 {
+		steps, err := json.Marshal(pl.steps)
+		if err != nil {
+			return err
+		}
+		files["pipeline-steps"] = string(steps)
+		files["pipeline-condition"] = pl.condition
+	}
+	for name, content := range files {
+		if err := metadata.WriteFile(filepath.Join(processDir, name), []byte(content), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s file: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ExecutePipeline starts the first command of a pipeline. Each of the other commands gets
+// started by the nohup process of the previous step when it completed, see
+// StartNextPipelineStep. condition is process.PipelineOnSuccess or process.PipelineAlways.
+// The limits apply to each step.
+func ExecutePipeline(ws *workspace.Workspace, commands []string, condition, profile string, limits process.Limits) (*process.Process, error) {
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("pipeline has no commands")
+	}
+	if condition != process.PipelineOnSuccess && condition != process.PipelineAlways {
+		return nil, fmt.Errorf("invalid pipeline condition %q", condition)
+	}
+	if err := checkCommands(ws, commands); err != nil {
+		return nil, err
+	}
+	return execute(ws, commands[0], profile, limits, &pipeline{steps: commands[1:], condition: condition})
+}
+
+// checkCommands returns an error if the policy of the workspace denies one of the commands, so
+// that a pipeline doesn't stop in the middle.
+func checkCommands(ws *workspace.Workspace, commands []string) error {
+	if ws == nil {
+		return fmt.Errorf("workspace is nil")
+	}
+	for _, command := range commands {
+		if err := ws.CheckCommand(command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartNextPipelineStep starts the next command of the pipeline after the process in
+// processDir completed. It does nothing if the process is not part of a pipeline, or if it
+// failed and the next step should only run on success.
+func StartNextPipelineStep(processDir string) error {
+	if _, err := os.Stat(filepath.Join(processDir, "pipeline-steps")); os.IsNotExist(err) {
+		return nil
+	}
+	proc, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return err
+	}
+	if len(proc.PipelineSteps) == 0 {
+		return nil
+	}
+	if proc.PipelineSkipped() {
+		slog.Info("Pipeline step failed, skipping the next steps", "process", proc.CommandId, "exitCode", proc.ExitCode)
+		return nil
+	}
+
+	// processDir is stateDir/workspaces/<id>/processes/<commandId>
+	workspaceDir := filepath.Dir(filepath.Dir(processDir))
+	ws, err := workspace.GetWorkspace(filepath.Dir(filepath.Dir(workspaceDir)), filepath.Base(workspaceDir))
+	if err != nil {
+		return fmt.Errorf("failed to load workspace of pipeline step: %w", err)
+	}
+	next, err := execute(ws, proc.PipelineSteps[0], proc.Profile, proc.Limits, &pipeline{
+		previous:  proc.CommandId,
+		steps:     proc.PipelineSteps[1:],
+		condition: proc.PipelineCondition,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start next pipeline step: %w", err)
+	}
+	if err := metadata.WriteFile(filepath.Join(processDir, "pipeline-next"), []byte(next.CommandId), 0o600); err != nil {
+		return fmt.Errorf("failed to write pipeline-next file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package executor
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+)
+
+// queueMu serializes counting the running processes of a workspace and starting a process, so
+// that the server doesn't start more than workspace.Workspace.MaxConcurrent.
+var queueMu sync.Mutex
+
+// slots returns the running and the queued processes of the workspace, the oldest first.
+func slots(ws *workspace.Workspace) (running int, queued []*process.Process, err error) {
+	processes, err := workspace.ListProcesses(ws)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, proc := range processes {
+		switch {
+		case proc.Completed:
+		case proc.Queued:
+			queued = append(queued, proc)
+		default:
+			running++
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].CommandId < queued[j].CommandId })
+	return running, queued, nil
+}
+
+// mustQueue returns true if a new process of the workspace has to wait: all slots are taken, or
+// older processes wait already.
+func mustQueue(ws *workspace.Workspace) (bool, error) {
+	if ws.MaxConcurrent <= 0 {
+		return false, nil
+	}
+	running, queued, err := slots(ws)
+	if err != nil {
+		return false, err
+	}
+	return running >= ws.MaxConcurrent || len(queued) > 0, nil
+}
+
+// StartQueued starts the queued processes of all workspaces in stateDir, the oldest first, as
+// long as their workspace has free slots. The server calls it periodically. It returns the
+// started processes.
+func StartQueued(stateDir string) ([]*process.Process, error) {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	workspaces, err := workspace.ListWorkspaces(stateDir)
+	if err != nil {
+		return nil, err
+	}
+	var started []*process.Process
+	for _, ws := range workspaces {
+		running, queued, err := slots(ws)
+		if err != nil {
+			slog.Error("Failed to list the processes of the workspace", "workspace", ws.ID, "error", err)
+			continue
+		}
+		for _, proc := range queued {
+			// Without a limit, for example after it was removed, all queued processes start
+			if ws.MaxConcurrent > 0 && running >= ws.MaxConcurrent {
+				break
+			}
+			if !process.ClaimQueued(proc.ProcessDir) {
+				continue
+			}
+			if err := startQueued(ws, proc); err != nil {
+				slog.Error("Failed to start queued process", "workspace", ws.ID, "process", proc.CommandId, "error", err)
+				continue
+			}
+			slog.Info("Started queued process", "workspace", ws.ID, "process", proc.CommandId)
+			started = append(started, proc)
+			running++
+		}
+	}
+	return started, nil
+}
+
+// startQueued starts a process which was claimed with process.ClaimQueued. If the command is
+// denied by now, or the nohup process can't be spawned, the process gets cancelled, so that it
+// doesn't wait forever.
+func startQueued(ws *workspace.Workspace, proc *process.Process) error {
+	err := ws.CheckCommand(proc.Command)
+	if err == nil {
+		err = process.MarkStarted(proc.ProcessDir)
+	}
+	if err == nil {
+		err = spawn(ws, proc, proc.Profile)
+	}
+	if err != nil {
+		if cancelErr := process.MarkCancelled(proc.ProcessDir); cancelErr != nil {
+			return fmt.Errorf("%w, and failed to cancel it: %v", err, cancelErr)
+		}
+		return err
+	}
+	proc.Queued = false
+	return nil
+}
+
+// CancelQueued cancels the queued process in processDir. It completes without having run. It
+// returns an error if the process is not queued, for example because it started meanwhile.
+func CancelQueued(processDir string) error {
+	if !process.ClaimQueued(processDir) {
+		return fmt.Errorf("process %q is not queued", processDir)
+	}
+	return process.MarkCancelled(processDir)
+}
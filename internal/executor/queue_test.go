@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitExecutor(stateDir))
+	ws, err := CreateWorkspace(stateDir, "queue-workspace", t.TempDir(), "")
+	require.NoError(t, err)
+	require.NoError(t, workspace.SaveMaxConcurrent(ws, 1))
+
+	// The process of a terminal session takes the only slot
+	blocker, err := CreateProcess(ws, "bash")
+	require.NoError(t, err)
+
+	queued, err := ExecuteWithLimits(ws, "echo queued", "", process.Limits{})
+	require.NoError(t, err)
+	require.True(t, queued.Queued)
+	require.Nil(t, queued.ExecCmd)
+	cancelled, err := Execute(ws, "echo cancelled", "")
+	require.NoError(t, err)
+	require.True(t, cancelled.Queued)
+
+	require.NoError(t, CancelQueued(cancelled.ProcessDir))
+	require.Error(t, CancelQueued(cancelled.ProcessDir))
+	cancelled, err = process.LoadProcessFromDir(cancelled.ProcessDir)
+	require.NoError(t, err)
+	require.True(t, cancelled.Completed)
+	require.True(t, cancelled.Cancelled)
+	require.False(t, cancelled.Queued)
+
+	started, err := StartQueued(stateDir)
+	require.NoError(t, err)
+	require.Empty(t, started)
+
+	// The slot is free when the blocker completed
+	require.NoError(t, os.WriteFile(filepath.Join(blocker.ProcessDir, "completed"), []byte("true"), 0o600))
+	started, err = StartQueued(stateDir)
+	require.NoError(t, err)
+	require.Len(t, started, 1)
+	require.Equal(t, queued.CommandId, started[0].CommandId)
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		proc, err := process.LoadProcessFromDir(queued.ProcessDir)
+		assert.NoError(collect, err)
+		assert.False(collect, proc.Queued)
+		assert.True(collect, proc.Completed)
+	}, 60*time.Second, 100*time.Millisecond)
+}
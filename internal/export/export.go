@@ -0,0 +1,334 @@
+// Package export writes the audit log and the command history of the workspaces as signed CSV
+// or JSON, for change-management and compliance reviews.
+//
+// The audit log are the processes of the workspaces: which command ran when, in which
+// workspace, and how it ended. The history contains every command which was submitted.
+//
+// Exports are signed with an HMAC-SHA256 with a secret which never leaves the state directory,
+// so only the server can create and verify them (see Verify). A CSV export ends with the line
+// "# hmac-sha256=<signature>", which signs all bytes before it. A JSON export is an object
+// {"export": {...}, "hmac_sha256": "<signature>"}, the signature covers the compact JSON encoding
+// of "export".
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"mobileshell/internal/process"
+	"mobileshell/internal/secret"
+	"mobileshell/internal/workspace"
+)
+
+// Kinds of exports.
+const (
+	KindAudit   = "audit"
+	KindHistory = "history"
+)
+
+// Formats of exports.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Statuses of audit records.
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusTimedOut  = "timed-out"
+	StatusOrphaned  = "orphaned"
+)
+
+const secretFile = "export-secret"
+
+// csvSignaturePrefix starts the last line of a CSV export.
+const csvSignaturePrefix = "# hmac-sha256="
+
+// ErrInvalidSignature is returned by Verify for exports which were modified, or which were
+// not created by this server.
+var ErrInvalidSignature = errors.New("invalid export signature")
+
+// Record is one entry of an export. The process fields are only set for the audit log.
+type Record struct {
+	Time      time.Time  `json:"time"`
+	Workspace string     `json:"workspace"`
+	Command   string     `json:"command"`
+	ProcessID string     `json:"process_id,omitempty"`
+	Profile   string     `json:"profile,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Status    string     `json:"status,omitempty"`
+	ExitCode  *int       `json:"exit_code,omitempty"`
+	Signal    string     `json:"signal,omitempty"`
+}
+
+// Options select the records of an export.
+type Options struct {
+	Kind      string    // KindAudit or KindHistory
+	Format    string    // FormatCSV or FormatJSON
+	From      time.Time // Records at or after From, zero for no limit
+	To        time.Time // Records before To, zero for no limit
+	Workspace string    // ID of the workspace, empty for all workspaces
+	User      string    // Only the workspaces which the user can access, empty for all workspaces
+}
+
+// Validate checks the kind, the format and the range.
+func (o Options) Validate() error {
+	if o.Kind != KindAudit && o.Kind != KindHistory {
+		return fmt.Errorf("invalid kind %q, use %q or %q", o.Kind, KindAudit, KindHistory)
+	}
+	if o.Format != FormatCSV && o.Format != FormatJSON {
+		return fmt.Errorf("invalid format %q, use %q or %q", o.Format, FormatCSV, FormatJSON)
+	}
+	if !o.From.IsZero() && !o.To.IsZero() && !o.To.After(o.From) {
+		return fmt.Errorf("the end of the range must be after its start")
+	}
+	return nil
+}
+
+// ParseRange parses the start and the end of a range. Both are dates like "2006-01-02" or
+// RFC 3339 timestamps, in UTC. The end date is included, so the range of from=2026-01-01 and
+// to=2026-01-31 ends at 2026-02-01T00:00:00Z. Empty values don't limit the range.
+func ParseRange(from, to string) (time.Time, time.Time, error) {
+	start, err := parseTime(from, 0)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parseTime(to, 24*time.Hour)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, end, nil
+}
+
+// parseTime parses a date or a timestamp. The offset is added to dates.
+func parseTime(value string, offset time.Duration) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t.Add(offset), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD or RFC 3339", value)
+	}
+	return t.UTC(), nil
+}
+
+// Records returns the records of the export, oldest first.
+func Records(stateDir string, opts Options) ([]Record, error) {
+	workspaces, err := workspace.ListWorkspaces(stateDir)
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, ws := range workspaces {
+		if (opts.Workspace != "" && ws.ID != opts.Workspace) || (opts.User != "" && !ws.CanAccess(opts.User)) {
+			continue
+		}
+		var wsRecords []Record
+		if opts.Kind == KindAudit {
+			wsRecords, err = auditRecords(ws)
+		} else {
+			wsRecords, err = historyRecords(ws)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range wsRecords {
+			if (opts.From.IsZero() || !record.Time.Before(opts.From)) && (opts.To.IsZero() || record.Time.Before(opts.To)) {
+				records = append(records, record)
+			}
+		}
+	}
+	slices.SortStableFunc(records, func(a, b Record) int {
+		return a.Time.Compare(b.Time)
+	})
+	return records, nil
+}
+
+func auditRecords(ws *workspace.Workspace) ([]Record, error) {
+	processes, err := workspace.ListProcesses(ws)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(processes))
+	for _, proc := range processes {
+		records = append(records, auditRecord(ws, proc))
+	}
+	return records, nil
+}
+
+func auditRecord(ws *workspace.Workspace, proc *process.Process) Record {
+	record := Record{
+		Time:      proc.StartTime.UTC(),
+		Workspace: ws.ID,
+		Command:   proc.Command,
+		ProcessID: proc.CommandId,
+		Profile:   proc.Profile,
+		Status:    StatusRunning,
+	}
+	if !proc.Completed {
+		return record
+	}
+	endTime := proc.EndTime.UTC()
+	record.EndTime = &endTime
+	switch {
+	case proc.Orphaned:
+		record.Status = StatusOrphaned
+		return record
+	case proc.TimedOut:
+		record.Status = StatusTimedOut
+	default:
+		record.Status = StatusCompleted
+	}
+	exitCode := proc.ExitCode
+	record.ExitCode = &exitCode
+	record.Signal = proc.Signal
+	return record
+}
+
+func historyRecords(ws *workspace.Workspace) ([]Record, error) {
+	entries, err := workspace.LoadHistoryEntries(ws)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(entries))
+	for _, entry := range entries {
+		records = append(records, Record{Time: entry.Time.UTC(), Workspace: ws.ID, Command: entry.Command})
+	}
+	return records, nil
+}
+
+// document is the signed part of a JSON export.
+type document struct {
+	Kind        string    `json:"kind"`
+	From        string    `json:"from,omitempty"`
+	To          string    `json:"to,omitempty"`
+	Workspace   string    `json:"workspace,omitempty"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Records     []Record  `json:"records"`
+}
+
+// signedDocument is a JSON export. Export is kept raw, so that Verify checks the bytes as they
+// are, and not a decoded and encoded again copy.
+type signedDocument struct {
+	Export    json.RawMessage `json:"export"`
+	Signature string          `json:"hmac_sha256"`
+}
+
+// Write writes the signed export to w.
+func Write(stateDir string, w io.Writer, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	records, err := Records(stateDir, opts)
+	if err != nil {
+		return err
+	}
+	key, err := secret.Load(stateDir, secretFile)
+	if err != nil {
+		return err
+	}
+
+	if opts.Format == FormatJSON {
+		doc := document{
+			Kind:        opts.Kind,
+			Workspace:   opts.Workspace,
+			GeneratedAt: time.Now().UTC(),
+			Records:     records,
+		}
+		if doc.Records == nil {
+			doc.Records = []Record{}
+		}
+		if !opts.From.IsZero() {
+			doc.From = opts.From.Format(time.RFC3339)
+		}
+		if !opts.To.IsZero() {
+			doc.To = opts.To.Format(time.RFC3339)
+		}
+		payload, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(signedDocument{Export: payload, Signature: secret.Sign(key, payload)}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+
+	payload, err := formatCSV(records)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s%s\n", payload, csvSignaturePrefix, secret.Sign(key, payload))
+	return err
+}
+
+func formatCSV(records []Record) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	rows := [][]string{{"time", "workspace", "command", "process_id", "profile", "end_time", "status", "exit_code", "signal"}}
+	for _, r := range records {
+		endTime, exitCode := "", ""
+		if r.EndTime != nil {
+			endTime = r.EndTime.Format(time.RFC3339Nano)
+		}
+		if r.ExitCode != nil {
+			exitCode = strconv.Itoa(*r.ExitCode)
+		}
+		rows = append(rows, []string{r.Time.Format(time.RFC3339Nano), r.Workspace, r.Command, r.ProcessID, r.Profile, endTime, r.Status, exitCode, r.Signal})
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Verify checks the signature of a CSV or JSON export which was created by Write. It returns
+// ErrInvalidSignature if the export was modified.
+func Verify(stateDir string, data []byte) error {
+	key, err := secret.Load(stateDir, secretFile)
+	if err != nil {
+		return err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var doc signedDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+		}
+		// The export was signed compact, the indentation is not signed
+		var payload bytes.Buffer
+		if err := json.Compact(&payload, doc.Export); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+		}
+		if !secret.Valid(key, payload.Bytes(), doc.Signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	trimmed := strings.TrimSuffix(string(data), "\n")
+	index := strings.LastIndex(trimmed, "\n"+csvSignaturePrefix)
+	if index < 0 {
+		return fmt.Errorf("%w: no signature line", ErrInvalidSignature)
+	}
+	payload := trimmed[:index+1]
+	signature := trimmed[index+1+len(csvSignaturePrefix):]
+	if !secret.Valid(key, []byte(payload), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mobileshell/internal/executor"
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	t.Parallel()
+	from, to, err := ParseRange("2026-01-01", "2026-01-31")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), from)
+	require.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), to)
+
+	from, to, err = ParseRange("", "")
+	require.NoError(t, err)
+	require.True(t, from.IsZero())
+	require.True(t, to.IsZero())
+
+	_, _, err = ParseRange("yesterday", "")
+	require.Error(t, err)
+	now := time.Now()
+	require.Error(t, Options{Kind: KindAudit, Format: FormatCSV, From: now.Add(time.Hour), To: now}.Validate())
+	require.Error(t, Options{Kind: "sessions", Format: FormatCSV}.Validate())
+}
+
+func TestWriteAndVerify(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := workspace.CreateWorkspace(stateDir, "prod", stateDir, "")
+	require.NoError(t, err)
+	fake := &executor.Fake{Results: map[string]executor.FakeResult{"false": {ExitCode: 1}}}
+	_, err = fake.Execute(ws, "make deploy, \"now\"", "", process.Limits{})
+	require.NoError(t, err)
+	_, err = fake.Execute(ws, "false", "", process.Limits{})
+	require.NoError(t, err)
+	require.NoError(t, workspace.AppendHistory(ws, "make deploy, \"now\""))
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(stateDir, &buf, Options{Kind: KindAudit, Format: FormatCSV}))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+	require.Equal(t, "time,workspace,command,process_id,profile,end_time,status,exit_code,signal", lines[0])
+	require.Contains(t, lines[1], `,"make deploy, ""now""",`)
+	require.Contains(t, lines[2], ",completed,1,")
+	require.True(t, strings.HasPrefix(lines[3], "# hmac-sha256="))
+	require.NoError(t, Verify(stateDir, buf.Bytes()))
+
+	tampered := bytes.Replace(buf.Bytes(), []byte("completed,1,"), []byte("completed,0,"), 1)
+	require.ErrorIs(t, Verify(stateDir, tampered), ErrInvalidSignature)
+
+	buf.Reset()
+	require.NoError(t, Write(stateDir, &buf, Options{Kind: KindHistory, Format: FormatJSON, Workspace: ws.ID}))
+	var doc struct {
+		Export document `json:"export"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	require.Equal(t, KindHistory, doc.Export.Kind)
+	require.Len(t, doc.Export.Records, 1)
+	require.Equal(t, "make deploy, \"now\"", doc.Export.Records[0].Command)
+	require.NoError(t, Verify(stateDir, buf.Bytes()))
+
+	tampered = bytes.Replace(buf.Bytes(), []byte("make deploy"), []byte("make test"), 1)
+	require.ErrorIs(t, Verify(stateDir, tampered), ErrInvalidSignature)
+
+	// Another state directory has another secret
+	require.ErrorIs(t, Verify(t.TempDir(), buf.Bytes()), ErrInvalidSignature)
+
+	// Records outside of the range are not exported
+	buf.Reset()
+	require.NoError(t, Write(stateDir, &buf, Options{Kind: KindAudit, Format: FormatJSON, To: time.Now().Add(-time.Hour)}))
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	require.Empty(t, doc.Export.Records)
+
+	info, err := os.Stat(filepath.Join(stateDir, secretFile))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
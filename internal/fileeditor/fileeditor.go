@@ -35,6 +35,8 @@ type FileEditResult struct {
 	ExternalDiff     string `json:"external_diff,omitempty"`
 	ProposedDiff     string `json:"proposed_diff,omitempty"`
 	NewChecksum      string `json:"new_checksum,omitempty"`
+	MergedContent    string `json:"merged_content,omitempty"` // Three-way merge of a conflict, see Merge3
+	MergeConflicts   int    `json:"merge_conflicts,omitempty"`
 }
 
 // ReadFile reads a file and creates a new editing session
@@ -47,7 +49,7 @@ func ReadFile(filePath string) (*FileSession, error) {
 			return &FileSession{
 				FilePath:         filePath,
 				OriginalContent:  "",
-				OriginalChecksum: calculateChecksum(""),
+				OriginalChecksum: Checksum(""),
 				LastModified:     time.Time{},
 			}, nil
 		}
@@ -61,7 +63,7 @@ func ReadFile(filePath string) (*FileSession, error) {
 	}
 
 	contentStr := string(content)
-	checksum := calculateChecksum(contentStr)
+	checksum := Checksum(contentStr)
 
 	return &FileSession{
 		FilePath:         filePath,
@@ -88,20 +90,11 @@ func WriteFile(session *FileSession, newContent string) (*FileEditResult, error)
 			return nil, fmt.Errorf("failed to read current file: %w", err)
 		}
 
-		currentChecksum := calculateChecksum(string(currentContent))
+		currentChecksum := Checksum(string(currentContent))
 
 		// Check if file has been modified externally
 		if currentChecksum != session.OriginalChecksum {
-			result.ConflictDetected = true
-			result.Message = "File has been modified externally. Please review the differences."
-
-			// Generate diff between original and current (external changes)
-			result.ExternalDiff = GenerateDiff(session.OriginalContent, string(currentContent))
-
-			// Generate diff between original and proposed (user's changes)
-			result.ProposedDiff = GenerateDiff(session.OriginalContent, newContent)
-
-			return result, nil
+			return Conflict(session, string(currentContent), newContent), nil
 		}
 	}
 
@@ -128,14 +121,43 @@ func WriteFile(session *FileSession, newContent string) (*FileEditResult, error)
 	}
 
 	result.Success = true
-	result.NewChecksum = calculateChecksum(newContent)
+	result.NewChecksum = Checksum(newContent)
 	result.ProposedDiff = GenerateDiff(session.OriginalContent, newContent)
 
 	return result, nil
 }
 
-// calculateChecksum calculates SHA256 checksum of content
-func calculateChecksum(content string) string {
+// Conflict returns the result of saving newContent, if the file was changed to currentContent
+// since session was read. If session has the content which was read, the diffs of both changes
+// and their three-way merge are part of the result.
+func Conflict(session *FileSession, currentContent, newContent string) *FileEditResult {
+	result := &FileEditResult{
+		ConflictDetected: true,
+		Message:          "File has been modified externally. Please review the differences.",
+	}
+	if Checksum(session.OriginalContent) != session.OriginalChecksum {
+		// Only the checksum is known, so only the diff to the file on disk can be shown
+		result.ProposedDiff = GenerateDiff(currentContent, newContent)
+		return result
+	}
+
+	// Generate diff between original and current (external changes)
+	result.ExternalDiff = GenerateDiff(session.OriginalContent, currentContent)
+
+	// Generate diff between original and proposed (user's changes)
+	result.ProposedDiff = GenerateDiff(session.OriginalContent, newContent)
+
+	result.MergedContent, result.MergeConflicts = Merge3(session.OriginalContent, newContent, currentContent)
+	if result.MergeConflicts == 0 {
+		result.Message = "File has been modified externally. The changes don't overlap and were merged, please review the merged content."
+	} else {
+		result.Message = fmt.Sprintf("File has been modified externally. The merged content has %d conflicts, resolve the lines between the conflict markers.", result.MergeConflicts)
+	}
+	return result
+}
+
+// Checksum calculates SHA256 checksum of content
+func Checksum(content string) string {
 	hash := sha256.Sum256([]byte(content))
 	return hex.EncodeToString(hash[:])
 }
@@ -26,7 +26,7 @@ func TestReadFileNonExistent(t *testing.T) {
 		t.Errorf("Expected empty content for non-existent file, got: %s", session.OriginalContent)
 	}
 
-	if session.OriginalChecksum != calculateChecksum("") {
+	if session.OriginalChecksum != Checksum("") {
 		t.Errorf("Expected checksum of empty string, got: %s", session.OriginalChecksum)
 	}
 }
@@ -51,7 +51,7 @@ func TestReadFileExisting(t *testing.T) {
 		t.Errorf("Expected content %s, got %s", content, session.OriginalContent)
 	}
 
-	expectedChecksum := calculateChecksum(content)
+	expectedChecksum := Checksum(content)
 	if session.OriginalChecksum != expectedChecksum {
 		t.Errorf("Expected checksum %s, got %s", expectedChecksum, session.OriginalChecksum)
 	}
@@ -269,15 +269,15 @@ func TestGenerateDiffIdentical(t *testing.T) {
 func TestCalculateChecksum(t *testing.T) {
 	t.Parallel()
 	content := "test content"
-	checksum1 := calculateChecksum(content)
-	checksum2 := calculateChecksum(content)
+	checksum1 := Checksum(content)
+	checksum2 := Checksum(content)
 
 	if checksum1 != checksum2 {
 		t.Errorf("Expected same checksum for same content")
 	}
 
 	differentContent := "different content"
-	checksum3 := calculateChecksum(differentContent)
+	checksum3 := Checksum(differentContent)
 
 	if checksum1 == checksum3 {
 		t.Errorf("Expected different checksums for different content")
@@ -0,0 +1,165 @@
+package fileeditor
+
+import (
+	"slices"
+	"strings"
+)
+
+// Conflict markers of Merge3, like git uses them.
+const (
+	markerYours  = "<<<<<<< your changes\n"
+	markerSplit  = "=======\n"
+	markerTheirs = ">>>>>>> file on disk\n"
+)
+
+// Merge3 merges the changes from original to yours and from original to theirs, like diff3
+// and git do. Changes of different lines are combined. If both sides changed the same lines
+// differently, the merged content contains both versions between conflict markers. It returns
+// the merged content and the number of conflicts.
+func Merge3(original, yours, theirs string) (string, int) {
+	base := splitLines(original)
+	a := splitLines(yours)
+	b := splitLines(theirs)
+	matchA := matchedLines(base, a)
+	matchB := matchedLines(base, b)
+
+	var merged strings.Builder
+	conflicts := 0
+	i, j, k := 0, 0, 0 // Next line of base, a and b
+	for {
+		// Find the next base line which is unchanged on both sides
+		next := i
+		for next < len(base) && (matchA[next] < 0 || matchB[next] < 0) {
+			next++
+		}
+		endA, endB := len(a), len(b)
+		if next < len(base) {
+			endA, endB = matchA[next], matchB[next]
+		}
+		if next == i && endA == j && endB == k {
+			if next == len(base) {
+				break
+			}
+			// Stable line
+			merged.WriteString(base[i])
+			i, j, k = i+1, j+1, k+1
+			continue
+		}
+
+		// Lines which changed on at least one side
+		chunkBase, chunkA, chunkB := base[i:next], a[j:endA], b[k:endB]
+		switch {
+		case slices.Equal(chunkA, chunkBase) || slices.Equal(chunkA, chunkB):
+			writeLines(&merged, chunkB, false)
+		case slices.Equal(chunkB, chunkBase):
+			writeLines(&merged, chunkA, false)
+		default:
+			conflicts++
+			merged.WriteString(markerYours)
+			writeLines(&merged, chunkA, true)
+			merged.WriteString(markerSplit)
+			writeLines(&merged, chunkB, true)
+			merged.WriteString(markerTheirs)
+		}
+		i, j, k = next, endA, endB
+	}
+	return merged.String(), conflicts
+}
+
+// splitLines splits text into lines which keep their newline.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// writeLines writes lines to merged. If terminate is true, a missing newline at the end of the
+// file gets added, so that the conflict marker which follows starts in a new line.
+func writeLines(merged *strings.Builder, lines []string, terminate bool) {
+	for _, line := range lines {
+		merged.WriteString(line)
+	}
+	if terminate && len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		merged.WriteString("\n")
+	}
+}
+
+// matchedLines returns for each line of a the index of the same line in b, or -1 if the line
+// was changed. The matched lines are a longest common subsequence, see myers.
+func matchedLines(a, b []string) []int {
+	match := make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+	// Most edits are local, so the common prefix and suffix are matched without diffing
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		match[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		match[len(a)-1-suffix] = len(b) - 1 - suffix
+		suffix++
+	}
+	for _, pair := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		match[prefix+pair[0]] = prefix + pair[1]
+	}
+	return match
+}
+
+// myers returns the index pairs of the equal lines of a and b in a shortest edit script, see
+// "An O(ND) Difference Algorithm and Its Variations" by Eugene W. Myers.
+func myers(a, b []string) [][2]int {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] is v[-d-1..d+1] before step d, it is needed to walk the edit script back
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v[offset-d-1:offset+d+2]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // Insertion
+			} else {
+				x = v[offset+k-1] + 1 // Deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the edit script which myers found back from the end, and returns the pairs
+// of equal lines in order.
+func backtrack(trace [][]int, x, y int) [][2]int {
+	var pairs [][2]int
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			pairs = append(pairs, [2]int{x, y})
+		}
+		x, y = prevX, prevY
+	}
+	slices.Reverse(pairs)
+	return pairs
+}
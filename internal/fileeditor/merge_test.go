@@ -0,0 +1,86 @@
+package fileeditor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge3DifferentLines(t *testing.T) {
+	t.Parallel()
+	original := "one\ntwo\nthree\nfour\nfive\n"
+	yours := "one\nTWO\nthree\nfour\nfive\nsix\n"
+	theirs := "zero\none\ntwo\nthree\nFOUR\nfive\n"
+
+	merged, conflicts := Merge3(original, yours, theirs)
+	require.Equal(t, 0, conflicts)
+	require.Equal(t, "zero\none\nTWO\nthree\nFOUR\nfive\nsix\n", merged)
+}
+
+func TestMerge3SameChange(t *testing.T) {
+	t.Parallel()
+	merged, conflicts := Merge3("a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n")
+	require.Equal(t, 0, conflicts)
+	require.Equal(t, "a\nB\nc\n", merged)
+}
+
+func TestMerge3Conflict(t *testing.T) {
+	t.Parallel()
+	original := "a\nb\nc\nd\n"
+	yours := "a\nmine\nc\nd\n"
+	theirs := "a\ntheirs\nc\nD\n"
+
+	merged, conflicts := Merge3(original, yours, theirs)
+	require.Equal(t, 1, conflicts)
+	require.Equal(t, "a\n"+markerYours+"mine\n"+markerSplit+"theirs\n"+markerTheirs+"c\nD\n", merged)
+}
+
+func TestMerge3DeletedLines(t *testing.T) {
+	t.Parallel()
+	merged, conflicts := Merge3("a\nb\nc\nd\ne\n", "a\nc\nd\ne\n", "a\nb\nc\nd\n")
+	require.Equal(t, 0, conflicts)
+	require.Equal(t, "a\nc\nd\n", merged)
+}
+
+func TestMerge3MissingNewline(t *testing.T) {
+	t.Parallel()
+	merged, conflicts := Merge3("a\nb", "a\nmine", "a\ntheirs")
+	require.Equal(t, 1, conflicts)
+	require.Equal(t, "a\n"+markerYours+"mine\n"+markerSplit+"theirs\n"+markerTheirs, merged)
+
+	merged, conflicts = Merge3("a\nb\nc", "A\nb\nc", "a\nb\nC")
+	require.Equal(t, 0, conflicts)
+	require.Equal(t, "A\nb\nC", merged)
+}
+
+func TestMatchedLines(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, []int{0, -1, 2, 3}, matchedLines([]string{"a", "b", "c", "d"}, []string{"a", "x", "c", "d", "e"}))
+
+	// The lines between the common prefix and suffix get diffed
+	require.Equal(t, []int{0, 2, 3, 4}, matchedLines([]string{"x", "a", "b", "y"}, []string{"x", "b", "a", "b", "y"}))
+
+	require.Equal(t, []int{-1, -1}, matchedLines([]string{"a", "b"}, nil))
+}
+
+func TestWriteFileConflictMerge(t *testing.T) {
+	t.Parallel()
+	filePath := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("a\nb\nc\n"), 0o644))
+	session, err := ReadFile(filePath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filePath, []byte("a\nb\nC\n"), 0o644))
+
+	result, err := WriteFile(session, "A\nb\nc\n")
+	require.NoError(t, err)
+	require.True(t, result.ConflictDetected)
+	require.Equal(t, "A\nb\nC\n", result.MergedContent)
+	require.Equal(t, 0, result.MergeConflicts)
+
+	// Without the loaded content, nothing can be merged
+	result = Conflict(&FileSession{OriginalChecksum: session.OriginalChecksum}, "a\nb\nC\n", "A\nb\nc\n")
+	require.True(t, result.ConflictDetected)
+	require.Empty(t, result.MergedContent)
+}
@@ -0,0 +1,195 @@
+package fileeditor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Limits of SearchContent.
+const (
+	DefaultContentResults = 100
+	MaxContentResults     = 1000
+	MaxContextLines       = 10
+	maxSearchFileSize     = 10 << 20 // Bigger files are skipped, they are rarely source code
+	maxSnippetLength      = 300      // Longer lines get truncated in the result
+)
+
+// skippedDirs are not searched, they contain tools' data rather than the files of a project.
+var skippedDirs = map[string]bool{".git": true, "node_modules": true, ".venv": true, "__pycache__": true}
+
+// ContentSearchOptions configures SearchContent.
+type ContentSearchOptions struct {
+	Pattern      string // Regular expression (RE2 syntax)
+	IgnoreCase   bool
+	ContextLines int // Lines before and after a match, up to MaxContextLines
+	MaxResults   int // Default DefaultContentResults, up to MaxContentResults
+}
+
+// ContentLine is a line of a file.
+type ContentLine struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+// ContentMatch is a line which matches the pattern of SearchContent.
+type ContentMatch struct {
+	RelativePath string        `json:"relative_path"`
+	Line         int           `json:"line"`
+	Text         string        `json:"text"`
+	Before       []ContentLine `json:"before,omitempty"`
+	After        []ContentLine `json:"after,omitempty"`
+}
+
+// ContentSearchResult represents the result of a content search
+type ContentSearchResult struct {
+	Matches       []ContentMatch `json:"matches"`
+	FilesSearched int            `json:"files_searched"`
+	HasMore       bool           `json:"has_more"`
+	TimedOut      bool           `json:"timed_out"`
+}
+
+// SearchContent greps the files under rootDir for lines which match the pattern of opts, like
+// "grep -rn". Binary files, big files and directories like .git are skipped. The search stops
+// at the maximum of results or when ctx is done, then the result has HasMore or TimedOut set.
+func SearchContent(ctx context.Context, rootDir string, opts ContentSearchOptions) (*ContentSearchResult, error) {
+	if opts.Pattern == "" {
+		return nil, fmt.Errorf("pattern is empty")
+	}
+	pattern := opts.Pattern
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	if opts.MaxResults <= 0 {
+		opts.MaxResults = DefaultContentResults
+	}
+	opts.MaxResults = min(opts.MaxResults, MaxContentResults)
+	opts.ContextLines = max(0, min(opts.ContextLines, MaxContextLines))
+
+	result := &ContentSearchResult{Matches: []ContentMatch{}}
+	err = filepath.WalkDir(rootDir, func(path string, d os.DirEntry, err error) error {
+		select {
+		case <-ctx.Done():
+			result.TimedOut = true
+			return filepath.SkipAll
+		default:
+		}
+		if err != nil {
+			return nil // Skip unreadable entries, continue walking
+		}
+		if d.IsDir() {
+			if path != rootDir && skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxSearchFileSize {
+			return nil
+		}
+		relPath, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			relPath = path
+		}
+		if !searchFile(ctx, path, relPath, re, opts, result) {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// searchFile appends the matches in the file at path to result. It returns false if the
+// search has to stop.
+func searchFile(ctx context.Context, path, relPath string, re *regexp.Regexp, opts ContentSearchOptions, result *ContentSearchResult) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer func() { _ = f.Close() }()
+
+	reader := bufio.NewReader(f)
+	// Like grep, a NUL byte at the start marks a binary file
+	if head, _ := reader.Peek(8000); bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+	result.FilesSearched++
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	var before []ContentLine
+	var pending []int // Indexes of the matches in result which still need lines after them
+	for number := 1; scanner.Scan(); number++ {
+		line := ContentLine{Number: number, Text: snippet(scanner.Text())}
+		for _, i := range pending {
+			result.Matches[i].After = append(result.Matches[i].After, line)
+		}
+		pending = pendingMatches(result.Matches, pending, opts.ContextLines)
+
+		if re.MatchString(scanner.Text()) {
+			if len(result.Matches) == opts.MaxResults {
+				result.HasMore = true
+				return false
+			}
+			result.Matches = append(result.Matches, ContentMatch{
+				RelativePath: relPath,
+				Line:         number,
+				Text:         line.Text,
+				Before:       append([]ContentLine(nil), before...),
+			})
+			if opts.ContextLines > 0 {
+				pending = append(pending, len(result.Matches)-1)
+			}
+		}
+		if opts.ContextLines > 0 {
+			before = append(before, line)
+			before = before[max(0, len(before)-opts.ContextLines):]
+		}
+		if number%1000 == 0 && ctx.Err() != nil {
+			result.TimedOut = true
+			return false
+		}
+	}
+	// A read error, like a line longer than the buffer, ends the search of this file only
+	return true
+}
+
+// pendingMatches returns the indexes of pending which have less than contextLines lines after
+// them.
+func pendingMatches(matches []ContentMatch, pending []int, contextLines int) []int {
+	kept := pending[:0]
+	for _, i := range pending {
+		if len(matches[i].After) < contextLines {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// snippet returns line, truncated to maxSnippetLength.
+func snippet(line string) string {
+	line = strings.TrimRight(line, "\r")
+	if len(line) <= maxSnippetLength {
+		return line
+	}
+	// Don't cut a UTF-8 sequence
+	cut := maxSnippetLength
+	for cut > 0 && line[cut]&0xc0 == 0x80 {
+		cut--
+	}
+	return line[:cut] + "…"
+}
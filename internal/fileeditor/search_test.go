@@ -0,0 +1,85 @@
+package fileeditor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeSearchFiles(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main\n\nfunc main() {\n\tprintln(\"Hello\")\n}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# hello\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "config"), []byte("hello\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "binary"), []byte("hello\x00world"), 0o644))
+	return dir
+}
+
+func TestSearchContent(t *testing.T) {
+	t.Parallel()
+	dir := writeSearchFiles(t)
+
+	result, err := SearchContent(context.Background(), dir, ContentSearchOptions{Pattern: `println\("\w+"\)`, ContextLines: 1})
+	require.NoError(t, err)
+	require.Len(t, result.Matches, 1)
+	match := result.Matches[0]
+	require.Equal(t, filepath.Join("src", "main.go"), match.RelativePath)
+	require.Equal(t, 4, match.Line)
+	require.Equal(t, "\tprintln(\"Hello\")", match.Text)
+	require.Equal(t, []ContentLine{{Number: 3, Text: "func main() {"}}, match.Before)
+	require.Equal(t, []ContentLine{{Number: 5, Text: "}"}}, match.After)
+	require.Equal(t, 2, result.FilesSearched)
+	require.False(t, result.HasMore)
+}
+
+func TestSearchContentIgnoreCase(t *testing.T) {
+	t.Parallel()
+	dir := writeSearchFiles(t)
+
+	// .git and binary files are skipped
+	result, err := SearchContent(context.Background(), dir, ContentSearchOptions{Pattern: "hello", IgnoreCase: true})
+	require.NoError(t, err)
+	require.Len(t, result.Matches, 2)
+
+	result, err = SearchContent(context.Background(), dir, ContentSearchOptions{Pattern: "hello", IgnoreCase: true, MaxResults: 1})
+	require.NoError(t, err)
+	require.Len(t, result.Matches, 1)
+	require.True(t, result.HasMore)
+}
+
+func TestSearchContentTimeout(t *testing.T) {
+	t.Parallel()
+	dir := writeSearchFiles(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := SearchContent(ctx, dir, ContentSearchOptions{Pattern: "hello"})
+	require.NoError(t, err)
+	require.True(t, result.TimedOut)
+	require.Empty(t, result.Matches)
+}
+
+func TestSearchContentInvalidPattern(t *testing.T) {
+	t.Parallel()
+	_, err := SearchContent(context.Background(), t.TempDir(), ContentSearchOptions{Pattern: "("})
+	require.Error(t, err)
+
+	_, err = SearchContent(context.Background(), t.TempDir(), ContentSearchOptions{})
+	require.Error(t, err)
+}
+
+func TestSnippet(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "short", snippet("short\r"))
+
+	long := snippet(strings.Repeat("ä", maxSnippetLength))
+	require.True(t, strings.HasSuffix(long, "…"))
+	require.LessOrEqual(t, len(long), maxSnippetLength+len("…"))
+}
@@ -0,0 +1,86 @@
+// Package gitinfo describes the git repository of a workspace directory: branch, uncommitted
+// changes and how far it is ahead of or behind its upstream.
+package gitinfo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Info is the state of a git repository, see Detect.
+type Info struct {
+	Branch    string // Empty if HEAD is detached
+	Commit    string // Abbreviated hash of HEAD, empty before the first commit
+	Upstream  string // Like "origin/main", empty if the branch has no upstream
+	Ahead     int    // Commits which are not in the upstream
+	Behind    int    // Commits of the upstream which are not in the branch
+	Changed   int    // Tracked files with staged or unstaged changes
+	Untracked int
+}
+
+// Dirty returns true if the working tree has uncommitted changes or untracked files.
+func (i *Info) Dirty() bool {
+	return i.Changed > 0 || i.Untracked > 0
+}
+
+// Detect returns the state of the git repository which contains dir. It returns nil if dir is
+// not in a git repository, or if git is not installed.
+func Detect(ctx context.Context, dir string) (*Info, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, nil
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "status", "--porcelain=v2", "--branch")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "not a git repository") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("git status failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseStatus(stdout.String()), nil
+}
+
+// parseStatus parses the output of "git status --porcelain=v2 --branch".
+func parseStatus(output string) *Info {
+	info := &Info{}
+	for line := range strings.Lines(output) {
+		line = strings.TrimSuffix(line, "\n")
+		header, value, _ := strings.Cut(line, " ")
+		switch header {
+		case "#":
+			parseBranchHeader(info, value)
+		case "1", "2", "u":
+			info.Changed++
+		case "?":
+			info.Untracked++
+		}
+	}
+	return info
+}
+
+// parseBranchHeader parses a "# branch.<name> <value>" header line without "# ".
+func parseBranchHeader(info *Info, header string) {
+	name, value, _ := strings.Cut(header, " ")
+	switch name {
+	case "branch.oid":
+		if value != "(initial)" {
+			info.Commit = value[:min(len(value), 7)]
+		}
+	case "branch.head":
+		if value != "(detached)" {
+			info.Branch = value
+		}
+	case "branch.upstream":
+		info.Upstream = value
+	case "branch.ab":
+		ahead, behind, _ := strings.Cut(value, " ")
+		info.Ahead, _ = strconv.Atoi(strings.TrimPrefix(ahead, "+"))
+		info.Behind, _ = strconv.Atoi(strings.TrimPrefix(behind, "-"))
+	}
+}
@@ -0,0 +1,66 @@
+package gitinfo
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatus(t *testing.T) {
+	t.Parallel()
+	info := parseStatus(`# branch.oid 1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b
+# branch.head main
+# branch.upstream origin/main
+# branch.ab +2 -3
+1 .M N... 100644 100644 100644 1a2b 1a2b README.md
+2 R. N... 100644 100644 100644 1a2b 1a2b R100 new.go	old.go
+? notes.txt
+`)
+	require.Equal(t, &Info{
+		Branch:    "main",
+		Commit:    "1a2b3c4",
+		Upstream:  "origin/main",
+		Ahead:     2,
+		Behind:    3,
+		Changed:   2,
+		Untracked: 1,
+	}, info)
+	require.True(t, info.Dirty())
+}
+
+func TestParseStatusDetached(t *testing.T) {
+	t.Parallel()
+	info := parseStatus("# branch.oid (initial)\n# branch.head (detached)\n")
+	require.Equal(t, &Info{}, info)
+	require.False(t, info.Dirty())
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	info, err := Detect(context.Background(), dir)
+	require.NoError(t, err)
+	require.Nil(t, info)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	git("init", "--initial-branch=feature")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0o644))
+	git("add", "file.txt")
+	git("commit", "-m", "first")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "untracked.txt"), []byte("content"), 0o644))
+
+	info, err = Detect(context.Background(), dir)
+	require.NoError(t, err)
+	require.Equal(t, "feature", info.Branch)
+	require.Len(t, info.Commit, 7)
+	require.Equal(t, 0, info.Changed)
+	require.Equal(t, 1, info.Untracked)
+}
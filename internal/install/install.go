@@ -0,0 +1,289 @@
+// Package install installs MobileShell on a remote host with ssh, for `mobileshell install`.
+//
+// It builds the binary for the platform of the host, copies it with rsync and sets up a
+// systemd service which runs as a Linux user. The state directory, including the passwords,
+// is never touched, so running it again upgrades the installation in place.
+package install
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// serviceTemplate is the systemd unit in the source directory. {{USER}} gets replaced by
+// the Linux user.
+const serviceTemplate = "systemd/mobileshell.service"
+
+// userRegex matches the Linux user names which can be used without quoting in the scripts.
+var userRegex = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// Options describe an installation.
+type Options struct {
+	Host    string // SSH host, like "example.com"
+	User    string // Linux user which runs the service, it gets created if missing
+	SSHUser string // User of the SSH login, other users than root need passwordless sudo
+	GOOS    string // Platform of the host, detected with uname if empty
+	GOARCH  string
+	Source  string // Directory of the mobileshell module which gets built
+	Upgrade bool   // Only replace the binary of an existing installation and restart it
+	DryRun  bool   // Print the steps instead of running them
+}
+
+// hostState is the state of the host before the installation.
+type hostState struct {
+	GOOS        string
+	GOARCH      string
+	UserExists  bool
+	Installed   bool // The binary exists
+	HasPassword bool
+}
+
+// step is one action of the installation. It runs either command locally, or script as root
+// on the host.
+type step struct {
+	Description string
+	Command     []string
+	Env         []string // Added to the environment of command
+	Script      string
+}
+
+func (o Options) service() string     { return o.User + "-mobileshell" }
+func (o Options) binary() string      { return "/opt/" + o.User + "-mobileshell" }
+func (o Options) stateDir() string    { return "/var/lib/mobileshell-" + o.User }
+func (o Options) uploadDir() string   { return "/tmp/mobileshell-install-" + o.User }
+func (o Options) destination() string { return o.SSHUser + "@" + o.Host }
+
+// Run installs or upgrades MobileShell on the host and reports the progress to w. With
+// opts.DryRun, the host is only inspected and the planned steps are printed.
+func Run(ctx context.Context, opts Options, w io.Writer) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	service, err := os.ReadFile(filepath.Join(opts.Source, serviceTemplate))
+	if err != nil {
+		return fmt.Errorf("failed to read the service template, run the install in the source directory or use --source: %w", err)
+	}
+
+	var probe bytes.Buffer
+	if err := opts.ssh(ctx, probeScript(opts), &probe); err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", opts.Host, err)
+	}
+	host, err := parseProbe(probe.String())
+	if err != nil {
+		return err
+	}
+
+	buildDir, err := os.MkdirTemp("", "mobileshell-install-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(buildDir) }()
+	steps, err := plan(opts, host, strings.ReplaceAll(string(service), "{{USER}}", opts.User), buildDir)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range steps {
+		_, _ = fmt.Fprintf(w, "==> %s\n", s.Description)
+		if opts.DryRun {
+			_, _ = fmt.Fprint(w, s.dryRun())
+			continue
+		}
+		if err := opts.run(ctx, s, w); err != nil {
+			return fmt.Errorf("%s: %w", s.Description, err)
+		}
+	}
+
+	if !host.HasPassword {
+		_, _ = fmt.Fprintf(w, "\nNo password is configured yet. Add one on %s with:\n  sudo -u %s %s add-password --state-dir %s\n",
+			opts.Host, opts.User, opts.binary(), opts.stateDir())
+	}
+	if !opts.DryRun {
+		_, _ = fmt.Fprintf(w, "\nMobileShell runs on %s as service %s. Configure TLS termination, like nginx, for production use.\n", opts.Host, opts.service())
+	}
+	return nil
+}
+
+func (o Options) validate() error {
+	if o.Host == "" || strings.HasPrefix(o.Host, "-") {
+		return fmt.Errorf("invalid host %q", o.Host)
+	}
+	if !userRegex.MatchString(o.User) {
+		return fmt.Errorf("invalid user %q", o.User)
+	}
+	if !userRegex.MatchString(o.SSHUser) {
+		return fmt.Errorf("invalid SSH user %q", o.SSHUser)
+	}
+	if (o.GOOS == "") != (o.GOARCH == "") {
+		return fmt.Errorf("set both GOOS and GOARCH, or none of them to detect the platform of the host")
+	}
+	return nil
+}
+
+// plan returns the steps which bring the host from its state to the installation. The binary
+// gets built in buildDir.
+func plan(opts Options, host hostState, service, buildDir string) ([]step, error) {
+	if opts.Upgrade && !host.Installed {
+		return nil, fmt.Errorf("MobileShell of user %s is not installed on %s, install it without --upgrade first", opts.User, opts.Host)
+	}
+	goos, goarch := opts.GOOS, opts.GOARCH
+	if goos == "" {
+		goos, goarch = host.GOOS, host.GOARCH
+	}
+	if goos != "linux" {
+		return nil, fmt.Errorf("unsupported platform %s/%s, the service needs systemd on linux", goos, goarch)
+	}
+
+	binary := filepath.Join(buildDir, "mobileshell")
+	steps := []step{{
+		Description: fmt.Sprintf("Build mobileshell for %s/%s", goos, goarch),
+		Command:     []string{"go", "build", "-C", opts.Source, "-o", binary, "./cmd/mobileshell"},
+		Env:         []string{"CGO_ENABLED=0", "GOOS=" + goos, "GOARCH=" + goarch},
+	}}
+	if !opts.Upgrade && !host.UserExists {
+		steps = append(steps, step{
+			Description: "Create user " + opts.User,
+			Script:      fmt.Sprintf("useradd -m -s /bin/bash %s\n", opts.User),
+		})
+	}
+	if !opts.Upgrade {
+		steps = append(steps, step{
+			Description: "Add user " + opts.User + " to the group nix-users, if it exists",
+			Script:      fmt.Sprintf("if getent group nix-users >/dev/null; then usermod -aG nix-users %s; fi\n", opts.User),
+		})
+	}
+	steps = append(steps, step{
+		Description: "Copy the binary to " + opts.Host,
+		Command:     []string{"rsync", "-a", binary, opts.destination() + ":" + opts.uploadDir() + "/"},
+	}, step{
+		// The rename keeps the running binary intact: cp fails with "Text file busy"
+		Description: "Install the binary as " + opts.binary(),
+		Script: fmt.Sprintf("install -m 0755 -o %[1]s -g %[1]s %[2]s/mobileshell %[3]s.new\nmv -f %[3]s.new %[3]s\nrm -rf %[2]s\n",
+			opts.User, opts.uploadDir(), opts.binary()),
+	})
+	if !opts.Upgrade {
+		steps = append(steps, step{
+			Description: "Install and enable the systemd service " + opts.service(),
+			Script: fmt.Sprintf("cat >/etc/systemd/system/%[1]s.service <<'MOBILESHELL_SERVICE'\n%[2]sMOBILESHELL_SERVICE\nchmod 644 /etc/systemd/system/%[1]s.service\nsystemctl daemon-reload\nsystemctl enable %[1]s\n",
+				opts.service(), service),
+		})
+	}
+	steps = append(steps, step{
+		Description: "Restart the service " + opts.service(),
+		Script:      fmt.Sprintf("systemctl restart %s\n", opts.service()),
+	})
+	return steps, nil
+}
+
+// dryRun returns the command or the script of the step, indented.
+func (s step) dryRun() string {
+	text := s.Script
+	if len(s.Command) > 0 {
+		text = strings.Join(append(append([]string{}, s.Env...), s.Command...), " ") + "\n"
+	}
+	var b strings.Builder
+	for line := range strings.Lines(text) {
+		if strings.TrimSpace(line) != "" {
+			b.WriteString("    ")
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// run runs the step and writes its output to w.
+func (o Options) run(ctx context.Context, s step, w io.Writer) error {
+	if len(s.Command) == 0 {
+		return o.ssh(ctx, s.Script, w)
+	}
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Env = append(os.Environ(), s.Env...)
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// ssh runs the script as root on the host and writes its output to stdout.
+func (o Options) ssh(ctx context.Context, script string, stdout io.Writer) error {
+	shell := "sh -s"
+	if o.SSHUser != "root" {
+		// -n fails instead of asking for a password, the script is read from stdin
+		shell = "sudo -n sh -s"
+	}
+	cmd := exec.CommandContext(ctx, "ssh", o.destination(), shell)
+	cmd.Stdin = strings.NewReader("set -eu\n" + script)
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// probeScript prints the platform of the host, and one line for each part of the
+// installation which exists. It doesn't change anything.
+func probeScript(opts Options) string {
+	return fmt.Sprintf(`uname -sm
+if id -u %[1]s >/dev/null 2>&1; then echo user; fi
+if [ -e %[2]s ]; then echo installed; fi
+if [ -n "$(ls -A %[3]s/hashed-passwords 2>/dev/null)" ]; then echo password; fi
+`, opts.User, opts.binary(), opts.stateDir())
+}
+
+// parseProbe parses the output of probeScript.
+func parseProbe(output string) (hostState, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	var host hostState
+	var err error
+	host.GOOS, host.GOARCH, err = parseUname(lines[0])
+	if err != nil {
+		return host, err
+	}
+	for _, line := range lines[1:] {
+		switch line {
+		case "user":
+			host.UserExists = true
+		case "installed":
+			host.Installed = true
+		case "password":
+			host.HasPassword = true
+		default:
+			return host, fmt.Errorf("unexpected output of the host: %q", line)
+		}
+	}
+	return host, nil
+}
+
+// unameOS and unameArch map the output of "uname -sm" to GOOS and GOARCH.
+var (
+	unameOS = map[string]string{
+		"Linux":   "linux",
+		"Darwin":  "darwin",
+		"FreeBSD": "freebsd",
+	}
+	unameArch = map[string]string{
+		"x86_64":  "amd64",
+		"amd64":   "amd64",
+		"aarch64": "arm64",
+		"arm64":   "arm64",
+		"armv7l":  "arm",
+		"i686":    "386",
+		"i386":    "386",
+		"riscv64": "riscv64",
+		"ppc64le": "ppc64le",
+		"s390x":   "s390x",
+	}
+)
+
+// parseUname returns GOOS and GOARCH of the output of "uname -sm", like "Linux x86_64".
+func parseUname(uname string) (string, string, error) {
+	fields := strings.Fields(uname)
+	if len(fields) != 2 || unameOS[fields[0]] == "" || unameArch[fields[1]] == "" {
+		return "", "", fmt.Errorf("unknown platform %q, set GOOS and GOARCH", uname)
+	}
+	return unameOS[fields[0]], unameArch[fields[1]], nil
+}
@@ -0,0 +1,66 @@
+package install
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProbe(t *testing.T) {
+	t.Parallel()
+	host, err := parseProbe("Linux aarch64\nuser\ninstalled\n")
+	require.NoError(t, err)
+	require.Equal(t, hostState{GOOS: "linux", GOARCH: "arm64", UserExists: true, Installed: true}, host)
+
+	host, err = parseProbe("Linux x86_64\n")
+	require.NoError(t, err)
+	require.Equal(t, hostState{GOOS: "linux", GOARCH: "amd64"}, host)
+
+	_, err = parseProbe("Linux sparc64\n")
+	require.ErrorContains(t, err, "unknown platform")
+	_, err = parseProbe("Linux x86_64\nsudo: a password is required\n")
+	require.ErrorContains(t, err, "unexpected output")
+}
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+	opts := Options{Host: "example.com", User: "alice", SSHUser: "deploy", Source: "."}
+	require.NoError(t, opts.validate())
+	steps, err := plan(opts, hostState{GOOS: "linux", GOARCH: "arm64"}, "User={{USER}}\n", "/tmp/build")
+	require.NoError(t, err)
+	require.Len(t, steps, 7)
+	require.Equal(t, "Build mobileshell for linux/arm64", steps[0].Description)
+	require.Equal(t, "    CGO_ENABLED=0 GOOS=linux GOARCH=arm64 go build -C . -o /tmp/build/mobileshell ./cmd/mobileshell\n", steps[0].dryRun())
+	require.Equal(t, "useradd -m -s /bin/bash alice\n", steps[1].Script)
+	require.Equal(t, "deploy@example.com:/tmp/mobileshell-install-alice/", steps[3].Command[3])
+	require.Contains(t, steps[4].Script, "mv -f /opt/alice-mobileshell.new /opt/alice-mobileshell\n")
+	require.Contains(t, steps[5].Script, "systemctl enable alice-mobileshell\n")
+	require.Equal(t, "systemctl restart alice-mobileshell\n", steps[6].Script)
+
+	// Nothing in the scripts touches the state directory with the passwords
+	require.NotContains(t, steps[1].Script+steps[2].Script+steps[4].Script+steps[5].Script+steps[6].Script, "/var/lib")
+
+	// An upgrade keeps the user and the service, and cross-compiles for the given platform
+	opts.Upgrade = true
+	opts.GOOS, opts.GOARCH = "linux", "amd64"
+	steps, err = plan(opts, hostState{GOOS: "linux", GOARCH: "arm64", UserExists: true, Installed: true}, "", "/tmp/build")
+	require.NoError(t, err)
+	require.Len(t, steps, 4)
+	require.Equal(t, "Build mobileshell for linux/amd64", steps[0].Description)
+	require.Equal(t, "Restart the service alice-mobileshell", steps[3].Description)
+
+	_, err = plan(opts, hostState{GOOS: "linux", GOARCH: "arm64", UserExists: true}, "", "/tmp/build")
+	require.ErrorContains(t, err, "install it without --upgrade first")
+
+	opts.Upgrade = false
+	opts.GOOS, opts.GOARCH = "", ""
+	_, err = plan(opts, hostState{GOOS: "darwin", GOARCH: "arm64"}, "", "/tmp/build")
+	require.ErrorContains(t, err, "unsupported platform darwin/arm64")
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	require.ErrorContains(t, Options{Host: "example.com", User: "alice; rm -rf /", SSHUser: "root"}.validate(), "invalid user")
+	require.ErrorContains(t, Options{Host: "-oProxyCommand=x", User: "alice", SSHUser: "root"}.validate(), "invalid host")
+	require.ErrorContains(t, Options{Host: "example.com", User: "alice", SSHUser: "root", GOOS: "linux"}.validate(), "set both GOOS and GOARCH")
+}
@@ -0,0 +1,371 @@
+// Package loadtest simulates viewers which tail running processes and users which submit
+// commands against a running server. It is used by `mobileshell loadtest` to check the
+// streaming endpoints before a release.
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	gopsprocess "github.com/shirou/gopsutil/v3/process"
+)
+
+// Endpoints which are measured.
+const (
+	EndpointExecute   = "execute"   // POST hx-execute
+	EndpointFollow    = "follow"    // GET hx-follow, polled by each viewer
+	EndpointWebSocket = "websocket" // First message of ws-process-updates
+)
+
+// DefaultCommand writes a line every 100ms for 10 seconds.
+const DefaultCommand = `for i in $(seq 1 100); do echo "line $i"; sleep 0.1; done`
+
+// Options configure a load test.
+type Options struct {
+	URL          string // Base URL of the server, e.g. http://localhost:22123
+	Password     string
+	Workspace    string        // ID of the workspace in which the commands run
+	Viewers      int           // Concurrent viewers which tail the processes
+	Submissions  int           // Commands which get submitted concurrently
+	Command      string        // Command which gets submitted
+	Duration     time.Duration // Viewers stop after this duration, even if processes still run
+	PollInterval time.Duration // How often a viewer polls hx-follow, the web UI uses 1s
+	ServerPID    int           // PID of the server, to sample its resource usage. 0 disables it
+}
+
+// Stats are the latencies of one endpoint.
+type Stats struct {
+	Endpoint string
+	Count    int
+	Errors   int
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+}
+
+// Usage is the resource usage of the server during the load test.
+type Usage struct {
+	Samples    int
+	CPUAverage float64 // Percent of one core
+	CPUMax     float64
+	RSSMax     uint64 // Bytes
+}
+
+// Report is the result of a load test.
+type Report struct {
+	Stats []Stats
+	Usage *Usage // nil if Options.ServerPID was not set
+}
+
+// sample is the outcome of one request.
+type sample struct {
+	endpoint string
+	duration time.Duration
+	err      error
+}
+
+// processIDRegex finds the process ID in the snippet which hx-execute returns.
+var processIDRegex = regexp.MustCompile(`/workspaces/[^/"]+/processes/([^/"?]+)"`)
+
+// nextOffsetRegex finds the offset for the next hx-follow request.
+var nextOffsetRegex = regexp.MustCompile(`hx-follow\?offset=(\d+)`)
+
+// Run logs in, submits the commands, lets the viewers tail the processes and returns the
+// latencies. Failed requests are counted, they don't stop the load test.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	base, err := url.Parse(strings.TrimSuffix(opts.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", opts.URL, err)
+	}
+	if opts.Command == "" {
+		opts.Command = DefaultCommand
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	client, err := login(ctx, base, opts.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	usageDone := make(chan *Usage, 1)
+	if opts.ServerPID != 0 {
+		go func() { usageDone <- sampleUsage(ctx, opts.ServerPID) }()
+	}
+
+	samples := make(chan sample)
+	collected := make(chan map[string][]sample, 1)
+	go func() {
+		byEndpoint := map[string][]sample{}
+		for s := range samples {
+			byEndpoint[s.endpoint] = append(byEndpoint[s.endpoint], s)
+		}
+		collected <- byEndpoint
+	}()
+
+	// Submit all commands at once, then the viewers tail them round robin
+	processIDs := make(chan string, opts.Submissions)
+	done := make(chan struct{})
+	for range opts.Submissions {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			id, s := execute(ctx, client, base, opts.Workspace, opts.Command)
+			samples <- s
+			if s.err == nil {
+				processIDs <- id
+			}
+		}()
+	}
+	for range opts.Submissions {
+		<-done
+	}
+	close(processIDs)
+	var ids []string
+	for id := range processIDs {
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		close(samples)
+		<-collected
+		return nil, fmt.Errorf("no command could be submitted")
+	}
+
+	for i := range opts.Viewers {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			view(ctx, client, base, opts.Workspace, ids[i%len(ids)], opts.PollInterval, samples)
+		}()
+	}
+	for range opts.Viewers {
+		<-done
+	}
+	close(samples)
+
+	report := &Report{}
+	byEndpoint := <-collected
+	for _, endpoint := range []string{EndpointExecute, EndpointFollow, EndpointWebSocket} {
+		if len(byEndpoint[endpoint]) > 0 {
+			report.Stats = append(report.Stats, computeStats(endpoint, byEndpoint[endpoint]))
+		}
+	}
+	if opts.ServerPID != 0 {
+		cancel()
+		report.Usage = <-usageDone
+	}
+	return report, nil
+}
+
+// login returns a client with the session cookie of the password.
+func login(ctx context.Context, base *url.URL, password string) (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Jar:     jar,
+		Timeout: 30 * time.Second,
+		// The login redirects on success and shows the form again on failure
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base.String()+"/login", strings.NewReader(url.Values{"password": {password}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("login failed: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		return nil, fmt.Errorf("login failed: status %s, is the password correct?", resp.Status)
+	}
+	return client, nil
+}
+
+// execute submits the command and returns the ID of the new process.
+func execute(ctx context.Context, client *http.Client, base *url.URL, workspaceID, command string) (string, sample) {
+	start := time.Now()
+	form := url.Values{"command": {command}}
+	body, err := do(ctx, client, http.MethodPost, fmt.Sprintf("%s/workspaces/%s/hx-execute", base, workspaceID), strings.NewReader(form.Encode()))
+	s := sample{endpoint: EndpointExecute, duration: time.Since(start), err: err}
+	if err != nil {
+		return "", s
+	}
+	match := processIDRegex.FindSubmatch(body)
+	if match == nil {
+		s.err = fmt.Errorf("no process ID in the response of hx-execute")
+		return "", s
+	}
+	return string(match[1]), s
+}
+
+// view tails the process like the Follow toggle of the process page, until the process
+// completed or ctx is done. It also opens the WebSocket of the workspace page and waits for
+// the first message.
+func view(ctx context.Context, client *http.Client, base *url.URL, workspaceID, processID string, pollInterval time.Duration, samples chan<- sample) {
+	samples <- openWebSocket(ctx, client, base, workspaceID)
+
+	offset := "0"
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		body, err := do(ctx, client, http.MethodGet, fmt.Sprintf("%s/workspaces/%s/processes/%s/hx-follow?offset=%s", base, workspaceID, processID, offset), nil)
+		if ctx.Err() != nil {
+			return
+		}
+		samples <- sample{endpoint: EndpointFollow, duration: time.Since(start), err: err}
+		if err == nil {
+			match := nextOffsetRegex.FindSubmatch(body)
+			if match == nil {
+				// No poller in the response: the process completed
+				return
+			}
+			offset = string(match[1])
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// openWebSocket connects to the process updates of the workspace and measures the time until
+// the first message arrived.
+func openWebSocket(ctx context.Context, client *http.Client, base *url.URL, workspaceID string) sample {
+	start := time.Now()
+	wsURL := *base
+	wsURL.Scheme = strings.Replace(base.Scheme, "http", "ws", 1)
+	wsURL.Path += fmt.Sprintf("/workspaces/%s/ws-process-updates", workspaceID)
+	dialer := websocket.Dialer{Jar: client.Jar, HandshakeTimeout: client.Timeout}
+	conn, resp, err := dialer.DialContext(ctx, wsURL.String(), nil)
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		return sample{endpoint: EndpointWebSocket, duration: time.Since(start), err: err}
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(client.Timeout))
+	_, _, err = conn.ReadMessage()
+	return sample{endpoint: EndpointWebSocket, duration: time.Since(start), err: err}
+}
+
+// do sends a request and returns the body. Status codes other than 200 are errors.
+func do(ctx context.Context, client *http.Client, method, url string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: status %s", method, url, resp.Status)
+	}
+	return data, nil
+}
+
+// computeStats returns the latency percentiles of the successful requests and the number of
+// failed requests.
+func computeStats(endpoint string, samples []sample) Stats {
+	stats := Stats{Endpoint: endpoint, Count: len(samples)}
+	var durations []time.Duration
+	for _, s := range samples {
+		if s.err != nil {
+			stats.Errors++
+			continue
+		}
+		durations = append(durations, s.duration)
+	}
+	if len(durations) == 0 {
+		return stats
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	stats.P50 = percentile(durations, 0.5)
+	stats.P90 = percentile(durations, 0.9)
+	stats.P99 = percentile(durations, 0.99)
+	stats.Max = durations[len(durations)-1]
+	return stats
+}
+
+// percentile returns the p-th percentile (nearest rank) of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// sampleUsage samples the CPU and memory usage of the server every second until ctx is done.
+func sampleUsage(ctx context.Context, pid int) *Usage {
+	usage := &Usage{}
+	proc, err := gopsprocess.NewProcess(int32(pid))
+	if err != nil {
+		return usage
+	}
+	var cpuSum float64
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if usage.Samples > 0 {
+				usage.CPUAverage = cpuSum / float64(usage.Samples)
+			}
+			return usage
+		case <-ticker.C:
+		}
+		// Percent is measured since the previous call, the first call starts the measurement
+		cpu, err := proc.PercentWithContext(ctx, 0)
+		if err != nil {
+			continue
+		}
+		mem, err := proc.MemoryInfoWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		usage.Samples++
+		cpuSum += cpu
+		usage.CPUMax = max(usage.CPUMax, cpu)
+		usage.RSSMax = max(usage.RSSMax, mem.RSS)
+	}
+}
+
+// Print writes the report as table.
+func (r *Report) Print(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "%-10s %7s %7s %10s %10s %10s %10s\n", "Endpoint", "Count", "Errors", "p50", "p90", "p99", "Max")
+	for _, s := range r.Stats {
+		_, _ = fmt.Fprintf(w, "%-10s %7d %7d %10s %10s %10s %10s\n", s.Endpoint, s.Count, s.Errors,
+			s.P50.Round(time.Microsecond), s.P90.Round(time.Microsecond), s.P99.Round(time.Microsecond), s.Max.Round(time.Microsecond))
+	}
+	if r.Usage != nil {
+		_, _ = fmt.Fprintf(w, "\nServer: %d samples, CPU average %.1f%%, CPU max %.1f%%, RSS max %d MiB\n",
+			r.Usage.Samples, r.Usage.CPUAverage, r.Usage.CPUMax, r.Usage.RSSMax>>20)
+	}
+}
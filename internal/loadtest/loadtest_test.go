@@ -0,0 +1,68 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mobileshell/internal/auth"
+	"mobileshell/internal/executor"
+	"mobileshell/internal/server"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	t.Parallel()
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	require.Equal(t, time.Duration(5), percentile(sorted, 0.5))
+	require.Equal(t, time.Duration(9), percentile(sorted, 0.9))
+	require.Equal(t, time.Duration(10), percentile(sorted, 0.99))
+	require.Equal(t, time.Duration(1), percentile(sorted[:1], 0.5))
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	password := "loadtest-password-which-is-long-enough"
+	require.NoError(t, auth.InitAuth(stateDir))
+	require.NoError(t, auth.AddPassword(stateDir, password))
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "loadtest", t.TempDir(), "")
+	require.NoError(t, err)
+
+	// The demo mode completes the commands at once, without running them
+	srv, err := server.New(stateDir, false)
+	require.NoError(t, err)
+	srv.EnableDemo()
+	ts := httptest.NewServer(srv.SetupRoutes())
+	t.Cleanup(ts.Close)
+
+	report, err := Run(context.Background(), Options{
+		URL:         ts.URL,
+		Password:    password,
+		Workspace:   ws.ID,
+		Viewers:     3,
+		Submissions: 2,
+		Duration:    10 * time.Second,
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Stats, 3)
+	require.Equal(t, EndpointExecute, report.Stats[0].Endpoint)
+	require.Equal(t, 2, report.Stats[0].Count)
+	require.Zero(t, report.Stats[0].Errors)
+	// Each viewer polls once, then the process is completed
+	require.Equal(t, EndpointFollow, report.Stats[1].Endpoint)
+	require.Equal(t, 3, report.Stats[1].Count)
+	require.Zero(t, report.Stats[1].Errors)
+	require.Zero(t, report.Stats[2].Errors)
+
+	var out bytes.Buffer
+	report.Print(&out)
+	require.Contains(t, out.String(), "follow")
+
+	_, err = Run(context.Background(), Options{URL: ts.URL, Password: "wrong", Workspace: ws.ID, Duration: time.Second})
+	require.ErrorContains(t, err, "login failed")
+}
@@ -0,0 +1,99 @@
+// Package metadata writes the small files which describe workspaces and processes, like
+// "completed" or "endtime", so that a crash or a power loss never leaves a half written file.
+//
+// A file is written to a temporary file in the same directory, which gets synced and renamed
+// to the final name, then the directory gets synced. Readers see either the old or the new
+// content. Files which are written together with WriteFiles become durable in their order, so
+// readers can rely on the convention that a file like "completed" is written last.
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// tmpSuffix ends the names of the temporary files. The replication and the workspace export
+// skip files with this suffix.
+const tmpSuffix = ".tmp"
+
+// File is a file of WriteFiles.
+type File struct {
+	Name    string
+	Content string
+}
+
+// WriteFile writes data to filePath atomically and durably, see the package documentation.
+// The file gets the permissions perm. It is a drop-in replacement of os.WriteFile.
+func WriteFile(filePath string, data []byte, perm os.FileMode) error {
+	dir, name := filepath.Split(filePath)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+"-*"+tmpSuffix)
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	err = writeTmp(tmp, data, perm)
+	if err == nil {
+		err = os.Rename(tmpName, filePath)
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return SyncDir(dir)
+}
+
+func writeTmp(tmp *os.File, data []byte, perm os.FileMode) error {
+	_, err := tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// WriteFiles writes the files to dir in their order with WriteFile, with the permissions 0600.
+func WriteFiles(dir string, files []File) error {
+	for _, f := range files {
+		if err := WriteFile(filepath.Join(dir, f.Name), []byte(f.Content), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s file: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// Remove removes filePath durably. A file which doesn't exist is no error.
+func Remove(filePath string) error {
+	if err := os.Remove(filePath); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return SyncDir(filepath.Dir(filePath))
+}
+
+// SyncDir flushes the entries of dir to the disk, so that files which were created, renamed
+// or removed in it survive a crash.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	return nil
+}
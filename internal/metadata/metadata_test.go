@@ -0,0 +1,44 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "completed")
+
+	require.NoError(t, WriteFile(filePath, []byte("false"), 0o600))
+	require.NoError(t, WriteFile(filePath, []byte("true"), 0o640))
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	require.Equal(t, "true", string(data))
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	// No temporary files are left
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	require.Error(t, WriteFile(filepath.Join(dir, "missing", "completed"), nil, 0o600))
+}
+
+func TestWriteFilesAndRemove(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.NoError(t, WriteFiles(dir, []File{{"endtime", "2025-01-07T10:00:00Z"}, {"completed", "true"}}))
+	data, err := os.ReadFile(filepath.Join(dir, "endtime"))
+	require.NoError(t, err)
+	require.Equal(t, "2025-01-07T10:00:00Z", string(data))
+
+	require.NoError(t, Remove(filepath.Join(dir, "endtime")))
+	require.NoFileExists(t, filepath.Join(dir, "endtime"))
+	require.NoError(t, Remove(filepath.Join(dir, "endtime")))
+}
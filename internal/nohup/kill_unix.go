@@ -0,0 +1,14 @@
+//go:build !windows
+
+package nohup
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalProcessGroup sends the signal to all processes of the command. The command was
+// started in a new session, so its process group ID is its PID.
+func signalProcessGroup(p *os.Process, sig syscall.Signal) error {
+	return syscall.Kill(-p.Pid, sig)
+}
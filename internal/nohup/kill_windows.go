@@ -0,0 +1,14 @@
+//go:build windows
+
+package nohup
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalProcessGroup stops the command. Windows has no process group signals, so the
+// command gets killed regardless of the signal.
+func signalProcessGroup(p *os.Process, sig syscall.Signal) error {
+	return p.Kill()
+}
@@ -0,0 +1,62 @@
+package nohup
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"mobileshell/internal/process"
+)
+
+// timeoutKillDelay is the time between SIGTERM and SIGKILL when the timeout was reached.
+const timeoutKillDelay = 10 * time.Second
+
+// limitedCommand creates the command. With CPU or memory limits a shell sets them with
+// ulimit (setrlimit) and replaces itself with the command, so the limits apply from the
+// start and can't be raised by the command.
+func limitedCommand(commandSlice []string, limits process.Limits) *exec.Cmd {
+	var ulimits []string
+	if limits.CPU > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -t %d", int64(math.Ceil(limits.CPU.Seconds()))))
+	}
+	if limits.Memory > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -v %d", max(limits.Memory>>10, 1)))
+	}
+	if len(ulimits) == 0 {
+		return exec.Command(commandSlice[0], commandSlice[1:]...)
+	}
+	script := strings.Join(ulimits, " && ") + ` && exec "$0" "$@"`
+	return exec.Command("/bin/sh", append([]string{"-c", script}, commandSlice...)...)
+}
+
+// enforceTimeout terminates the process group with SIGTERM when the timeout was reached,
+// and with SIGKILL if it still runs timeoutKillDelay later. done gets closed when the
+// process exited. timedOut gets set when the timeout was reached.
+func enforceTimeout(p *os.Process, timeout time.Duration, done <-chan struct{}, timedOut *atomic.Bool) {
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+	timedOut.Store(true)
+	slog.Info("Timeout reached, terminating process", "pid", p.Pid, "timeout", timeout)
+	if err := signalProcessGroup(p, syscall.SIGTERM); err != nil {
+		slog.Warn("Failed to send SIGTERM", "pid", p.Pid, "error", err)
+	}
+
+	select {
+	case <-done:
+		return
+	case <-time.After(timeoutKillDelay):
+	}
+	slog.Info("Process still running after SIGTERM, killing it", "pid", p.Pid)
+	if err := signalProcessGroup(p, syscall.SIGKILL); err != nil {
+		slog.Warn("Failed to send SIGKILL", "pid", p.Pid, "error", err)
+	}
+}
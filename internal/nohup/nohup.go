@@ -1,7 +1,6 @@
 package nohup
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"io"
@@ -17,17 +16,37 @@ import (
 	"syscall"
 	"time"
 
+	"mobileshell/internal/activity"
+	"mobileshell/internal/metadata"
+	"mobileshell/internal/process"
+	"mobileshell/internal/signals"
 	"mobileshell/pkg/outputlog"
 	"mobileshell/pkg/outputtype"
 
 	"github.com/creack/pty"
 )
 
+// heartbeatInterval is the interval of the heartbeat chunks in output.log. They show readers
+// that the nohup wrapper is still alive, see outputlog.ReadStatus.
+const heartbeatInterval = 30 * time.Second
+
+// outputCoalescing merges the output of chatty programs into fewer records of output.log. The
+// latency is short, so the follow mode of the web UI stays responsive.
+var outputCoalescing = outputlog.CoalescePolicy{
+	Streams:    []string{outputlog.StreamStdout, outputlog.StreamStderr},
+	MaxBytes:   64 << 10,
+	MaxLatency: 50 * time.Millisecond,
+}
+
 // Run executes a command in nohup mode within a workspace This function is called by the
 // `mobileshell nohup` subcommand. During a http request executor.Execute() gets called, which calls
-// nohup (and Run()).
-func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory string) error {
+// nohup (and Run()). profile is the name of the pre-command profile which was selected, it is
+// passed to the command as environment variable MOBILESHELL_PROFILE.
+func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory string, profile string) error {
 	slog.Info("nohup.Run called", "commandSlice", commandSlice, "socketPath", inputUnixDomainSocket)
+	if err := process.CheckPlatform(); err != nil {
+		return err
+	}
 	if len(commandSlice) < 1 {
 		return fmt.Errorf("not enough arguments")
 	}
@@ -37,8 +56,12 @@ func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory s
 		return fmt.Errorf("failed to run as nohup. A containing directory is needed: %q", command)
 	}
 
-	// Write completed file
-	if err := os.WriteFile(filepath.Join(processDir, "completed"), []byte("false"), 0o600); err != nil {
+	// Write completed file, and the PID of the wrapper, which owns the files until it completed
+	// the process, see process.Repair
+	if err := metadata.WriteFiles(processDir, []metadata.File{
+		{Name: process.NohupPIDFile, Content: strconv.Itoa(os.Getpid())},
+		{Name: "completed", Content: "false"},
+	}); err != nil {
 		return fmt.Errorf("failed to write completed file: %w", err)
 	}
 
@@ -58,11 +81,22 @@ func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory s
 	}
 	defer func() { _ = outFile.Close() }()
 
-	// Create the command
-	cmd := exec.Command(commandSlice[0], commandSlice[1:]...)
+	// The index lets the web UI seek in big logs without reading them completely
+	indexFile, err := os.OpenFile(outputFile+outputlog.IndexSuffix, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open output log index: %w", err)
+	}
+	defer func() { _ = indexFile.Close() }()
+
+	// Create the command with the limits which executor wrote to the process directory
+	limits := process.ReadLimits(processDir)
+	cmd := limitedCommand(commandSlice, limits)
 	if workingDirectory != "" {
 		cmd.Dir = workingDirectory
 	}
+	if profile != "" {
+		cmd.Env = append(os.Environ(), "MOBILESHELL_PROFILE="+profile)
+	}
 
 	var ptmx, tty *os.File
 
@@ -85,14 +119,8 @@ func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory s
 			"time", chunk.Timestamp,
 			"line", string(chunk.Line[:min(10, len(chunk.Line))]),
 		)
-		if chunk.Stream == "stdin" {
-			_, err := ptmx.Write(chunk.Line)
-			if err != nil {
-				slog.Error("ptmx.Write(chunk.Line)", "error", err.Error())
-			}
-		}
 	}
-	outputLogWriter := outputlog.NewOutputLogWriter(outFile, onChunk)
+	outputLogWriter := outputlog.NewOutputLogWriter(outFile, onChunk, outputlog.WithHeartbeat(heartbeatInterval), outputlog.WithCoalescing(outputCoalescing), outputlog.WithIndex(indexFile, outputlog.DefaultIndexInterval))
 
 	// Handle input from Unix domain socket if provided
 	var socketListener net.Listener
@@ -110,13 +138,13 @@ func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory s
 
 		// Accept connections and read stdin data from the socket
 		// processHolder will be set after cmd.Start()
-		go acceptSocketConnections(socketListener, outputLogWriter.Channel(), &processHolder)
+		go acceptSocketConnections(socketListener, outputLogWriter.Channel(), &ptyStdin{pty: ptmx}, &processHolder)
 	} else {
-		// Read input from stdin. Do not read outputlog format. Read from stdin, emit Chunks from
-		// stream "stdin".
-		stdinReaderToChannel := outputLogWriter.StreamWriter("stdin")
+		// Read input from stdin. Do not read outputlog format. Read from stdin, write it to the
+		// PTY and emit Chunks from stream "stdin".
+		stdinReaderToChannel := outputLogWriter.StreamWriter(outputlog.StreamStdin)
 		go func() {
-			_, err := io.Copy(stdinReaderToChannel, os.Stdin)
+			_, err := io.Copy(io.MultiWriter(stdinReaderToChannel, ptmx), os.Stdin)
 			if err != nil {
 				slog.Error("io.Copy(stdinReaderToChannel, os.Stdin)", "error", err)
 			}
@@ -138,13 +166,10 @@ func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory s
 	// cmd.Stderr uses the pipe
 
 	// Start the command in a new session (detach from parent)
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Setsid:  true,
-		Setctty: true,
-	}
+	cmd.SysProcAttr = detachedSysProcAttr()
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
+	// Start the command with the priorities of the limits
+	if err := startCommand(cmd, limits); err != nil {
 		return fmt.Errorf("failed to start command: %w", err)
 	}
 
@@ -160,12 +185,12 @@ func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory s
 
 	// Write PID to file
 	pidFile := filepath.Join(processDir, "pid")
-	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(pid)), 0o600); err != nil {
+	if err := metadata.WriteFile(pidFile, []byte(strconv.Itoa(pid)), 0o600); err != nil {
 		return fmt.Errorf("failed to write pid file: %w", err)
 	}
 
 	// Update status file
-	if err := os.WriteFile(filepath.Join(processDir, "status"), []byte("running"), 0o600); err != nil {
+	if err := metadata.WriteFile(filepath.Join(processDir, "status"), []byte("running"), 0o600); err != nil {
 		return fmt.Errorf("failed to write status file: %w", err)
 	}
 
@@ -176,32 +201,27 @@ func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory s
 	// WaitGroup to ensure stdout/stderr goroutines finish before closing writer
 	var streamWg sync.WaitGroup
 
-	// Copy stdout from PTY to output log with type detection
-	stdoutWriter := outputLogWriter.StreamWriter("stdout")
+	// Copy stdout from PTY to output log with type detection. The output is copied in
+	// chunks as it arrives, so binary data and long lines are kept unchanged.
+	stdoutWriter := outputLogWriter.StreamWriter(outputlog.StreamStdout)
 	streamWg.Add(1)
 	go func() {
 		defer streamWg.Done()
-		// Use a buffered reader to scan lines
-		reader := bufio.NewReader(ptmx)
+		buf := make([]byte, 4096)
 		for {
-			line, err := reader.ReadString('\n')
-			if len(line) > 0 {
-				// Analyze line for output type detection
+			n, err := ptmx.Read(buf)
+			if n > 0 {
+				// Analyze the chunk for output type detection
 				if !detector.IsDetected() {
-					if detector.AnalyzeLine(line) {
+					if detector.Feed(buf[:n]) {
 						// Type detected - write immediately
-						outputType, reason := detector.GetDetectedType()
-						outputTypeFile := filepath.Join(processDir, "output-type")
-						outputTypeContent := fmt.Sprintf("%s,%s", outputType, reason)
-						if writeErr := os.WriteFile(outputTypeFile, []byte(outputTypeContent), 0o600); writeErr != nil {
-							slog.Warn("Failed to write output-type file", "error", writeErr)
-						} else {
+						if writeOutputType(processDir, detector) {
 							detectedWritten.Store(1)
 						}
 					}
 				}
 				// Write to output log
-				if _, writeErr := stdoutWriter.Write([]byte(line)); writeErr != nil {
+				if _, writeErr := stdoutWriter.Write(buf[:n]); writeErr != nil {
 					slog.Error("Failed to write stdout", "error", writeErr)
 				}
 			}
@@ -215,7 +235,7 @@ func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory s
 	}()
 
 	// Copy stderr from pipe to output log
-	stderrWriter := outputLogWriter.StreamWriter("stderr")
+	stderrWriter := outputLogWriter.StreamWriter(outputlog.StreamStderr)
 	streamWg.Add(1)
 	go func() {
 		defer streamWg.Done()
@@ -225,8 +245,21 @@ func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory s
 		}
 	}()
 
+	// Terminate the process when its timeout was reached
+	waitDone := make(chan struct{})
+	var timedOut atomic.Bool
+	if limits.Timeout > 0 {
+		go enforceTimeout(cmd.Process, limits.Timeout, waitDone, &timedOut)
+	}
+	// The sampler must be done before the process completes, a late sample would change the
+	// directory after the process was completed
+	var samplerWg sync.WaitGroup
+	samplerWg.Go(func() { sampleUsage(processDir, pid, waitDone) })
+
 	// Wait for the process to complete
 	err = cmd.Wait()
+	close(waitDone)
+	samplerWg.Wait()
 
 	// Clean up Unix domain socket if it was created
 	if socketListener != nil {
@@ -240,14 +273,11 @@ func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory s
 	streamWg.Wait()
 	outputLogWriter.Close()
 
-	// Write output type detection results if not already written
+	// Write output type detection results if not already written. Short output ends
+	// before the detector decided, then the lines seen so far decide.
+	detector.Finish()
 	if detector.IsDetected() && detectedWritten.Load() == 0 {
-		outputType, reason := detector.GetDetectedType()
-		outputTypeFile := filepath.Join(processDir, "output-type")
-		outputTypeContent := fmt.Sprintf("%s,%s", outputType, reason)
-		if err := os.WriteFile(outputTypeFile, []byte(outputTypeContent), 0o600); err != nil {
-			slog.Warn("Failed to write output-type file", "error", err)
-		}
+		writeOutputType(processDir, detector)
 	}
 
 	// Get exit code and signal
@@ -267,36 +297,76 @@ func Run(commandSlice []string, inputUnixDomainSocket string, workingDirectory s
 		}
 	}
 
-	// Write exit status to file
-	exitStatusFile := filepath.Join(processDir, "exit-status")
-	if err := os.WriteFile(exitStatusFile, []byte(strconv.Itoa(exitCode)), 0o600); err != nil {
-		return fmt.Errorf("failed to write exit-status file: %w", err)
+	if timedOut.Load() {
+		if err := process.WriteTimedOut(processDir); err != nil {
+			return err
+		}
 	}
 
-	// Write signal file if process was terminated by signal
-	if signalName != "" {
-		if err := os.WriteFile(filepath.Join(processDir, "signal"), []byte(signalName), 0o600); err != nil {
-			return fmt.Errorf("failed to write signal file: %w", err)
+	if cmd.ProcessState != nil {
+		if err := process.WriteUsage(processDir, resourceUsage(cmd.ProcessState)); err != nil {
+			return err
 		}
 	}
 
-	// Write endtime file
-	endTime := time.Now().UTC().Format(outputlog.TimeFormatRFC3339NanoUTC)
-	if err := os.WriteFile(filepath.Join(processDir, "endtime"), []byte(endTime), 0o600); err != nil {
-		return fmt.Errorf("failed to write endtime file: %w", err)
+	// Compress the log before the process is completed, so that the output of a completed
+	// process doesn't change anymore
+	compressOutputLog(outputFile)
+
+	// Write the exit status, and the signal if the process was terminated by one, then mark
+	// the process as completed
+	endTime := time.Now().UTC()
+	files := []metadata.File{
+		{Name: "exit-status", Content: strconv.Itoa(exitCode)},
+		{Name: "endtime", Content: endTime.Format(outputlog.TimeFormatRFC3339NanoUTC)},
+	}
+	if signalName != "" {
+		files = append(files, metadata.File{Name: "signal", Content: signalName})
 	}
+	if err := activity.ProcessFinished(processDir, endTime, exitCode, signalName); err != nil {
+		slog.Error("Failed to record activity", "error", err)
+	}
+	return process.Complete(processDir, files...)
+}
 
-	// Update completed file
-	if err := os.WriteFile(filepath.Join(processDir, "completed"), []byte("true"), 0o600); err != nil {
-		return fmt.Errorf("failed to write completed file: %w", err)
+// compressMinSize is the size from which on output.log gets compressed when the command
+// exited. Small logs are kept as they are, compressing them saves next to nothing.
+const compressMinSize = 1 << 20
+
+// compressOutputLog replaces a big output.log by output.log.gz. The readers in
+// pkg/outputlog decompress it transparently, see outputlog.Open. Errors are only logged, the uncompressed log
+// stays usable.
+func compressOutputLog(outputFile string) {
+	info, err := os.Stat(outputFile)
+	if err != nil || info.Size() < compressMinSize {
+		return
 	}
+	if err := outputlog.Compress(outputFile); err != nil {
+		slog.Warn("Failed to compress output log", "file", outputFile, "error", err)
+	}
+}
 
-	return nil
+// writeOutputType stores the detected output type in the process directory. Binary output
+// also gets the binary-data marker, then the output is offered as download instead of text.
+// Errors are only logged, the output stays readable without the type. It returns true on
+// success.
+func writeOutputType(processDir string, detector *outputtype.Detector) bool {
+	outputType, reason := detector.GetDetectedType()
+	if outputType == outputtype.OutputTypeBinary {
+		if err := metadata.WriteFile(filepath.Join(processDir, "binary-data"), nil, 0o600); err != nil {
+			slog.Warn("Failed to write binary-data file", "error", err)
+		}
+	}
+	if err := process.WriteOutputType(processDir, string(outputType), reason); err != nil {
+		slog.Warn("Failed to write output-type file", "error", err)
+		return false
+	}
+	return true
 }
 
 // acceptSocketConnections listens for connections on a Unix domain socket and processes stdin input
-// It reads OutputLog formatted data and logs all chunks (stdin is NOT forwarded to the command)
-func acceptSocketConnections(listener net.Listener, outputChan chan<- outputlog.Chunk, processHolder **os.Process) {
+// It reads OutputLog formatted data, writes stdin chunks to stdin and logs all chunks
+func acceptSocketConnections(listener net.Listener, outputChan chan<- outputlog.Chunk, stdin io.WriteCloser, processHolder **os.Process) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -306,12 +376,12 @@ func acceptSocketConnections(listener net.Listener, outputChan chan<- outputlog.
 		}
 
 		// Handle each connection in a separate goroutine
-		go handleSocketConnection(conn, outputChan, processHolder)
+		go handleSocketConnection(conn, outputChan, stdin, processHolder)
 	}
 }
 
 // handleSocketConnection processes a single connection to the Unix domain socket
-func handleSocketConnection(conn net.Conn, outputChan chan<- outputlog.Chunk, processHolder **os.Process) {
+func handleSocketConnection(conn net.Conn, outputChan chan<- outputlog.Chunk, stdin io.WriteCloser, processHolder **os.Process) {
 	defer func() { _ = conn.Close() }()
 
 	slog.Info("Client connected to Unix domain socket")
@@ -323,7 +393,7 @@ func handleSocketConnection(conn net.Conn, outputChan chan<- outputlog.Chunk, pr
 		return
 	}
 
-	// Read chunks from the channel and log them (stdin is NOT forwarded to command)
+	// Read chunks from the channel and log them
 	for chunk := range reader.Channel() {
 		if chunk.Error != nil {
 			slog.Error("Error reading chunk from Unix socket", "error", chunk.Error)
@@ -331,14 +401,14 @@ func handleSocketConnection(conn net.Conn, outputChan chan<- outputlog.Chunk, pr
 		}
 
 		// Handle signal stream - send signal to process
-		if chunk.Stream == "signal" {
+		if chunk.Stream == outputlog.StreamSignal {
 			if processHolder != nil && *processHolder != nil {
 				signalName := string(chunk.Line)
 				signalName = strings.TrimSpace(signalName)
 				slog.Info("Received signal request via Unix socket", "signal", signalName)
 
 				// Parse signal name to syscall.Signal
-				sig, err := parseSignal(signalName)
+				sig, err := signals.Parse(signalName)
 				if err != nil {
 					slog.Error("Failed to parse signal", "error", err, "signal", signalName)
 					continue
@@ -356,6 +426,32 @@ func handleSocketConnection(conn net.Conn, outputChan chan<- outputlog.Chunk, pr
 			continue
 		}
 
+		// Stdin is written here and not by the output log writer, so that a command which
+		// doesn't read its stdin can't block the logging of its output. The write blocks while
+		// the PTY is full, so a sender which streams a file waits for the command. Stdin chunks
+		// are logged without timeout, they must not get lost. They are logged before the
+		// command gets them, it may exit right after reading them.
+		if chunk.Stream == outputlog.StreamStdin {
+			outputChan <- chunk
+			if _, err := stdin.Write(chunk.Line); err != nil {
+				slog.Error("Failed to write stdin to PTY", "error", err)
+				// The sender waits for the connection to be closed, see server.sendStdin
+				_, _ = fmt.Fprintf(conn, "failed to write stdin: %v\n", err)
+				return
+			}
+			continue
+		}
+
+		if chunk.Stream == outputlog.StreamStdinClose {
+			outputChan <- outputlog.Chunk{Stream: outputlog.StreamEvent, Timestamp: time.Now().UTC(), Line: []byte(outputlog.EventStdinClosed)}
+			if err := stdin.Close(); err != nil {
+				slog.Error("Failed to close stdin", "error", err)
+				_, _ = fmt.Fprintf(conn, "failed to close stdin: %v\n", err)
+				return
+			}
+			continue
+		}
+
 		// Send chunk to output channel for logging (non-blocking)
 		select {
 		case outputChan <- chunk:
@@ -368,90 +464,39 @@ func handleSocketConnection(conn net.Conn, outputChan chan<- outputlog.Chunk, pr
 	slog.Info("Unix domain socket connection closed")
 }
 
-// parseSignal converts a signal name string to syscall.Signal
-func parseSignal(signalName string) (syscall.Signal, error) {
-	signalName = strings.TrimSpace(signalName)
+// ptyStdin is the stdin of a command which runs in a PTY. A PTY has no pipe which could be
+// closed, Close sends the EOF character instead, like Ctrl-D in a terminal. The connections
+// of the Unix domain socket write concurrently, so writes are serialized.
+type ptyStdin struct {
+	mu      sync.Mutex
+	pty     io.Writer
+	midLine bool // The last write didn't end with a newline
+}
 
-	// Try parsing as a number first
-	if num, err := strconv.Atoi(signalName); err == nil {
-		if num < 0 || num > 64 {
-			return 0, fmt.Errorf("signal number out of range: %d", num)
-		}
-		return syscall.Signal(num), nil
-	}
-
-	signalName = strings.ToUpper(signalName)
-
-	// Remove "SIG" prefix if present
-	signalName = strings.TrimPrefix(signalName, "SIG")
-
-	// Map signal names to numbers
-	switch signalName {
-	case "EXIT":
-		return syscall.Signal(0), nil
-	case "HUP":
-		return syscall.SIGHUP, nil
-	case "INT":
-		return syscall.SIGINT, nil
-	case "QUIT":
-		return syscall.SIGQUIT, nil
-	case "ILL":
-		return syscall.SIGILL, nil
-	case "TRAP":
-		return syscall.SIGTRAP, nil
-	case "ABRT":
-		return syscall.SIGABRT, nil
-	case "BUS":
-		return syscall.SIGBUS, nil
-	case "FPE":
-		return syscall.SIGFPE, nil
-	case "KILL":
-		return syscall.SIGKILL, nil
-	case "USR1":
-		return syscall.SIGUSR1, nil
-	case "SEGV":
-		return syscall.SIGSEGV, nil
-	case "USR2":
-		return syscall.SIGUSR2, nil
-	case "PIPE":
-		return syscall.SIGPIPE, nil
-	case "ALRM":
-		return syscall.SIGALRM, nil
-	case "TERM":
-		return syscall.SIGTERM, nil
-	case "STKFLT":
-		return syscall.SIGSTKFLT, nil
-	case "CHLD":
-		return syscall.SIGCHLD, nil
-	case "CONT":
-		return syscall.SIGCONT, nil
-	case "STOP":
-		return syscall.SIGSTOP, nil
-	case "TSTP":
-		return syscall.SIGTSTP, nil
-	case "TTIN":
-		return syscall.SIGTTIN, nil
-	case "TTOU":
-		return syscall.SIGTTOU, nil
-	case "URG":
-		return syscall.SIGURG, nil
-	case "XCPU":
-		return syscall.SIGXCPU, nil
-	case "XFSZ":
-		return syscall.SIGXFSZ, nil
-	case "VTALRM":
-		return syscall.SIGVTALRM, nil
-	case "PROF":
-		return syscall.SIGPROF, nil
-	case "WINCH":
-		return syscall.SIGWINCH, nil
-	case "POLL", "IO":
-		return syscall.SIGIO, nil
-	case "PWR":
-		return syscall.SIGPWR, nil
-	case "SYS":
-		return syscall.SIGSYS, nil
-	default:
-		return 0, fmt.Errorf("unknown signal: %s", signalName)
+func (p *ptyStdin) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n, err := p.pty.Write(data)
+	if n > 0 {
+		p.midLine = data[n-1] != '\n'
 	}
+	return n, err
 }
+
+// Close makes the next read of the command return EOF. Like in a terminal, the first EOF
+// character only ends a started line, so a second one is needed then. The PTY stays open, a
+// command which reads again after EOF waits for more input.
+func (p *ptyStdin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	eof := []byte{eofChar}
+	if p.midLine {
+		eof = append(eof, eofChar)
+	}
+	_, err := p.pty.Write(eof)
+	p.midLine = false
+	return err
+}
+
+// eofChar is the default VEOF character of the terminal line discipline (Ctrl-D).
+const eofChar = 0x04
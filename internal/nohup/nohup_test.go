@@ -49,7 +49,7 @@ func TestNohupRun(t *testing.T) {
 	require.NoError(t, err)
 
 	// Create a process
-	proc, err := executor.Execute(ws, "echo 'Hello, World!'")
+	proc, err := executor.Execute(ws, "echo 'Hello, World!'", "")
 	require.NoError(t, err)
 
 	// Verify PID file was created
@@ -104,6 +104,9 @@ func TestNohupRun(t *testing.T) {
 	if proc.EndTime.IsZero() {
 		t.Error("End time should be set")
 	}
+
+	// The single line is too short for the detector, it gets decided when the output ended
+	require.Equal(t, "text", proc.ContentType)
 }
 
 func TestNohupRunWithPreCommand(t *testing.T) {
@@ -119,7 +122,7 @@ func TestNohupRunWithPreCommand(t *testing.T) {
 	require.NoError(t, err)
 
 	// Create a process that uses the environment variable
-	proc, err := executor.Execute(ws, "echo $TEST_VAR")
+	proc, err := executor.Execute(ws, "echo $TEST_VAR", "")
 	require.NoError(t, err)
 
 	require.EventuallyWithT(t, func(collect *assert.CollectT) {
@@ -146,6 +149,40 @@ func TestNohupRunWithPreCommand(t *testing.T) {
 	}, testTimeout, 100*time.Millisecond)
 }
 
+func TestNohupRunWithProfile(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(tmpDir))
+	ws, err := workspace.CreateWorkspace(tmpDir, "test", tmpDir, "export TEST_VAR=default")
+	require.NoError(t, err)
+	require.NoError(t, workspace.SaveProfiles(ws, map[string]string{"staging env": "export TEST_VAR=staging"}))
+
+	_, err = executor.Execute(ws, "echo $TEST_VAR", "unknown")
+	require.Error(t, err)
+
+	proc, err := executor.Execute(ws, "echo $TEST_VAR $MOBILESHELL_PROFILE", "staging env")
+	require.NoError(t, err)
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		loaded, err := process.LoadProcessFromDir(proc.ProcessDir)
+		assert.NoError(collect, err)
+		assert.True(collect, loaded.Completed)
+		assert.Equal(collect, "staging env", loaded.Profile)
+	}, testTimeout, 100*time.Millisecond)
+
+	stdout, err := outputlog.ReadOneStream(proc.OutputFile, outputlog.StreamStdout)
+	require.NoError(t, err)
+	require.Equal(t, "staging staging env\r\n", string(stdout))
+
+	status, err := outputlog.ReadStatus(proc.OutputFile, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, outputlog.LogClean, status)
+
+	loaded, err := process.LoadProcessFromDir(proc.ProcessDir)
+	require.NoError(t, err)
+	require.NotNil(t, loaded.Usage)
+}
+
 func TestNohupRunWithFailingCommand(t *testing.T) {
 	t.Parallel()
 	tmpDir := t.TempDir()
@@ -159,7 +196,7 @@ func TestNohupRunWithFailingCommand(t *testing.T) {
 	require.NoError(t, err)
 
 	// Create a process that will fail
-	proc, err := executor.Execute(ws, "exit 42")
+	proc, err := executor.Execute(ws, "exit 42", "")
 	require.NoError(t, err)
 	require.EventuallyWithT(t, func(collect *assert.CollectT) {
 		exitStatusFile := filepath.Join(proc.ProcessDir, "exit-status")
@@ -203,7 +240,7 @@ func TestNohupRunWithWorkingDirectory(t *testing.T) {
 	require.NoError(t, err)
 
 	// Create a process that reads the file
-	proc, err := executor.Execute(ws, fmt.Sprintf("cat %s", testFile))
+	proc, err := executor.Execute(ws, fmt.Sprintf("cat %s", testFile), "")
 	require.NoError(t, err)
 
 	require.EventuallyWithT(t, func(collect *assert.CollectT) {
@@ -339,7 +376,7 @@ echo "Process completed naturally"
 	require.NoError(t, err)
 
 	// Execute the process
-	proc, err := executor.Execute(ws, scriptPath)
+	proc, err := executor.Execute(ws, scriptPath, "")
 	require.NoError(t, err)
 
 	// Wait for process to start and write PID
@@ -451,7 +488,7 @@ echo "Process completed naturally"
 	require.NoError(t, err)
 
 	// Execute the process
-	proc, err := executor.Execute(ws, scriptPath)
+	proc, err := executor.Execute(ws, scriptPath, "")
 	require.NoError(t, err)
 
 	// Wait for process to start
@@ -516,3 +553,184 @@ echo "Process completed naturally"
 	require.NoError(t, err)
 	require.NotEqual(t, 0, exitCode)
 }
+
+func TestNohupRunKeepsLongLinesAndBinaryData(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(stateDir))
+	ws, err := workspace.CreateWorkspace(stateDir, "test", t.TempDir(), "")
+	require.NoError(t, err)
+
+	longLine, err := executor.Execute(ws, "head -c 100000 /dev/zero | tr '\\0' a; echo", "")
+	require.NoError(t, err)
+	binary, err := executor.Execute(ws, "printf 'bin\\000\\001\\002data'", "")
+	require.NoError(t, err)
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		proc, err := process.LoadProcessFromDir(longLine.ProcessDir)
+		assert.NoError(collect, err)
+		assert.True(collect, proc.Completed)
+		proc, err = process.LoadProcessFromDir(binary.ProcessDir)
+		assert.NoError(collect, err)
+		assert.True(collect, proc.Completed)
+	}, testTimeout, 100*time.Millisecond)
+
+	stdout, _, _, _, _, err := outputlog.ReadFiveStreams(longLine.OutputFile, outputlog.StreamStdout, outputlog.StreamStderr, outputlog.StreamStdin, outputlog.StreamNohupStdout, outputlog.StreamNohupStderr)
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("a", 100000)+"\r\n", string(stdout))
+	require.NoFileExists(t, filepath.Join(longLine.ProcessDir, "binary-data"))
+
+	stdout, _, _, _, _, err = outputlog.ReadFiveStreams(binary.OutputFile, outputlog.StreamStdout, outputlog.StreamStderr, outputlog.StreamStdin, outputlog.StreamNohupStdout, outputlog.StreamNohupStderr)
+	require.NoError(t, err)
+	require.Equal(t, "bin\x00\x01\x02data", string(stdout))
+	require.FileExists(t, filepath.Join(binary.ProcessDir, "binary-data"))
+}
+
+func TestNohupRunTimeout(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(stateDir))
+	ws, err := workspace.CreateWorkspace(stateDir, "test", t.TempDir(), "")
+	require.NoError(t, err)
+
+	proc, err := executor.ExecuteWithLimits(ws, "sleep 60", "", process.Limits{Timeout: time.Second})
+	require.NoError(t, err)
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		proc, err = process.LoadProcessFromDir(proc.ProcessDir)
+		assert.NoError(collect, err)
+		assert.True(collect, proc.Completed)
+	}, testTimeout+time.Second, 100*time.Millisecond)
+	require.True(t, proc.TimedOut)
+	require.Equal(t, "terminated", proc.Signal)
+}
+
+func TestNohupRunCompressesOutput(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(stateDir))
+	ws, err := workspace.CreateWorkspace(stateDir, "test", t.TempDir(), "")
+	require.NoError(t, err)
+
+	proc, err := executor.ExecuteWithLimits(ws, "yes mobileshell | head -n 200000", "", process.Limits{})
+	require.NoError(t, err)
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		proc, err = process.LoadProcessFromDir(proc.ProcessDir)
+		assert.NoError(collect, err)
+		assert.True(collect, proc.Completed)
+	}, testTimeout, 100*time.Millisecond)
+	// The log is compressed before the process is completed
+	require.NoFileExists(t, proc.OutputFile)
+	require.FileExists(t, proc.OutputFile+outputlog.GzipSuffix)
+	stdout, _, _, _, _, err := outputlog.ReadFiveStreams(proc.OutputFile, outputlog.StreamStdout, outputlog.StreamStderr, outputlog.StreamStdin, outputlog.StreamNohupStdout, outputlog.StreamNohupStderr)
+	require.NoError(t, err)
+	require.Equal(t, 200000, strings.Count(string(stdout), "mobileshell\r\n"))
+}
+
+func TestNohupRunResourceLimits(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(stateDir))
+	ws, err := workspace.CreateWorkspace(stateDir, "test", t.TempDir(), "")
+	require.NoError(t, err)
+
+	proc, err := executor.ExecuteWithLimits(ws, "ulimit -t; ulimit -v", "", process.Limits{CPU: 90 * time.Second, Memory: 512 << 20})
+	require.NoError(t, err)
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		proc, err = process.LoadProcessFromDir(proc.ProcessDir)
+		assert.NoError(collect, err)
+		assert.True(collect, proc.Completed)
+	}, testTimeout, 100*time.Millisecond)
+	require.False(t, proc.TimedOut)
+	stdout, _, _, _, _, err := outputlog.ReadFiveStreams(proc.OutputFile, outputlog.StreamStdout, outputlog.StreamStderr, outputlog.StreamStdin, outputlog.StreamNohupStdout, outputlog.StreamNohupStderr)
+	require.NoError(t, err)
+	require.Equal(t, "90\r\n524288\r\n", string(stdout))
+}
+
+func TestNohupRunPriority(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(stateDir))
+	ws, err := workspace.CreateWorkspace(stateDir, "test", t.TempDir(), "")
+	require.NoError(t, err)
+	require.NoError(t, workspace.SavePriority(ws, 10, process.IOPriorityIdle))
+
+	// Field 19 of /proc/self/stat is the niceness
+	proc, err := executor.ExecuteWithLimits(ws, "cut -d' ' -f19 /proc/self/stat", "", process.Limits{Nice: 15})
+	require.NoError(t, err)
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		proc, err = process.LoadProcessFromDir(proc.ProcessDir)
+		assert.NoError(collect, err)
+		assert.True(collect, proc.Completed)
+	}, testTimeout, 100*time.Millisecond)
+	require.Equal(t, process.Limits{Nice: 15, IOPriority: process.IOPriorityIdle}, proc.Limits)
+	stdout, _, _, _, _, err := outputlog.ReadFiveStreams(proc.OutputFile, outputlog.StreamStdout, outputlog.StreamStderr, outputlog.StreamStdin, outputlog.StreamNohupStdout, outputlog.StreamNohupStderr)
+	require.NoError(t, err)
+	require.Equal(t, "15\r\n", string(stdout))
+}
+
+func TestTreeUsage(t *testing.T) {
+	t.Parallel()
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	defer func() { _ = cmd.Process.Kill(); _ = cmd.Wait() }()
+
+	cpuTimes, rss := treeUsage(int32(os.Getpid()))
+	require.Contains(t, cpuTimes, int32(os.Getpid()))
+	require.Contains(t, cpuTimes, int32(cmd.Process.Pid))
+	require.Positive(t, rss)
+}
+
+func TestPtyStdinClose(t *testing.T) {
+	t.Parallel()
+	var pty strings.Builder
+	stdin := &ptyStdin{pty: &pty}
+
+	_, err := stdin.Write([]byte("started line"))
+	require.NoError(t, err)
+	require.NoError(t, stdin.Close())
+	_, err = stdin.Write([]byte("line\n"))
+	require.NoError(t, err)
+	require.NoError(t, stdin.Close())
+	require.Equal(t, "started line\x04\x04line\n\x04", pty.String())
+}
+
+func TestNohupCloseStdinViaUnixSocket(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(tmpDir))
+	ws, err := workspace.CreateWorkspace(tmpDir, "test", tmpDir, "")
+	require.NoError(t, err)
+
+	// wc reads until EOF
+	proc, err := executor.Execute(ws, "wc -l", "")
+	require.NoError(t, err)
+	socketPath := executor.SocketPath(proc.CommandId)
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		_, err := os.Stat(filepath.Join(proc.ProcessDir, "pid"))
+		assert.NoError(collect, err)
+	}, testTimeout, 100*time.Millisecond)
+
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	writer := outputlog.NewOutputLogWriter(conn, nil)
+	_, err = writer.StreamWriter(outputlog.StreamStdin).Write([]byte("a\nb\n"))
+	require.NoError(t, err)
+	writer.Channel() <- outputlog.Chunk{Stream: outputlog.StreamStdinClose, Timestamp: time.Now().UTC()}
+	writer.Close()
+	_ = conn.Close()
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		completed, err := os.ReadFile(filepath.Join(proc.ProcessDir, "completed"))
+		assert.NoError(collect, err)
+		assert.Equal(collect, "true", strings.TrimSpace(string(completed)))
+	}, testTimeout, 100*time.Millisecond)
+
+	stdout, events, err := outputlog.ReadTwoStreams(filepath.Join(proc.ProcessDir, "output.log"), outputlog.StreamStdout, outputlog.StreamEvent)
+	require.NoError(t, err)
+	require.Contains(t, string(stdout), "2")
+	require.Equal(t, outputlog.EventStdinClosed, string(events))
+}
@@ -0,0 +1,24 @@
+package nohup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunUnsupported(t *testing.T) {
+	t.Parallel()
+	processDir := t.TempDir()
+	command := filepath.Join(processDir, "nohup-command")
+	require.NoError(t, os.WriteFile(command, []byte("echo hello"), 0o700))
+
+	err := Run([]string{command}, "", "", "")
+	require.ErrorIs(t, err, errors.ErrUnsupported)
+
+	// Nothing was written, so the process doesn't look like it ran halfway
+	require.NoFileExists(t, filepath.Join(processDir, "completed"))
+	require.NoFileExists(t, filepath.Join(processDir, "output.log"))
+}
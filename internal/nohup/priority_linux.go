@@ -0,0 +1,62 @@
+package nohup
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"mobileshell/internal/process"
+
+	"golang.org/x/sys/unix"
+)
+
+// ioprio_set(2) arguments, see linux/ioprio.h
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+)
+
+// startCommand starts the command with the niceness and the IO priority of the limits. Both
+// are attributes of a thread on Linux, which the child inherits when it gets forked. So they
+// are set on a locked thread which starts the command and is thrown away afterwards, as the
+// goroutine exits without unlocking it.
+func startCommand(cmd *exec.Cmd, limits process.Limits) error {
+	if limits.Nice == 0 && limits.IOPriority == "" {
+		return cmd.Start()
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := setThreadPriority(limits); err != nil {
+			errCh <- err
+			return
+		}
+		errCh <- cmd.Start()
+	}()
+	return <-errCh
+}
+
+// setThreadPriority sets the niceness and the IO priority of the calling thread.
+func setThreadPriority(limits process.Limits) error {
+	if limits.Nice > 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, limits.Nice); err != nil {
+			return fmt.Errorf("failed to set niceness %d: %w", limits.Nice, err)
+		}
+	}
+	var ioprio int
+	switch limits.IOPriority {
+	case process.IOPriorityLow:
+		ioprio = ioprioClassBE<<ioprioClassShift | 7
+	case process.IOPriorityIdle:
+		ioprio = ioprioClassIdle << ioprioClassShift
+	default:
+		return nil
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(ioprio)); errno != 0 {
+		return fmt.Errorf("failed to set IO priority %s: %w", limits.IOPriority, errno)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package nohup
+
+import (
+	"log/slog"
+	"os/exec"
+
+	"mobileshell/internal/process"
+)
+
+// startCommand starts the command. The niceness and the IO priority are only set on Linux.
+func startCommand(cmd *exec.Cmd, limits process.Limits) error {
+	if limits.Nice != 0 || limits.IOPriority != "" {
+		slog.Warn("Process priorities are only supported on Linux, ignoring them", "nice", limits.Nice, "ioPriority", limits.IOPriority)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,85 @@
+package nohup
+
+import (
+	"log/slog"
+	"time"
+
+	"mobileshell/internal/process"
+
+	gopsprocess "github.com/shirou/gopsutil/v3/process"
+)
+
+// sampleInterval is the initial interval of the usage samples of the command. It doubles each
+// time the samples get compacted, see process.CompactSamples.
+const sampleInterval = 5 * time.Second
+
+// sampleUsage records the CPU and memory usage of the command with pid and its descendants in
+// the process directory until done gets closed, so that the process page can show how it
+// changed, for example a memory leak of a long running job.
+func sampleUsage(processDir string, pid int, done <-chan struct{}) {
+	interval := sampleInterval
+	var samples []process.Sample
+	cpuTimes, _ := treeUsage(int32(pid))
+	last := time.Now()
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+		now := time.Now()
+		current, rss := treeUsage(int32(pid))
+		// Descendants which exited since the previous sample are not counted
+		var cpu time.Duration
+		for p, t := range current {
+			cpu += max(t-cpuTimes[p], 0)
+		}
+		cpuTimes = current
+		sample := process.Sample{
+			Time: now.UTC(),
+			CPU:  float64(cpu) / float64(now.Sub(last)) * 100,
+			RSS:  rss,
+		}
+		last = now
+		samples = append(samples, sample)
+		if len(samples) > process.MaxSamples {
+			samples = process.CompactSamples(samples)
+			interval *= 2
+			if err := process.WriteSamples(processDir, samples); err != nil {
+				slog.Warn("Failed to write usage samples", "error", err)
+			}
+		} else if err := process.AppendSample(processDir, sample); err != nil {
+			slog.Warn("Failed to append usage sample", "error", err)
+		}
+		timer.Reset(interval)
+	}
+}
+
+// treeUsage returns the CPU times of the process with pid and its descendants, and the sum of
+// their resident set sizes. Processes which exited in the meantime are skipped.
+func treeUsage(pid int32) (map[int32]time.Duration, int64) {
+	cpuTimes := map[int32]time.Duration{}
+	var rss int64
+	pending := []int32{pid}
+	for len(pending) > 0 {
+		p, err := gopsprocess.NewProcess(pending[0])
+		pending = pending[1:]
+		if err != nil {
+			continue
+		}
+		if times, err := p.Times(); err == nil {
+			cpuTimes[p.Pid] = time.Duration((times.User + times.System) * float64(time.Second))
+		}
+		if mem, err := p.MemoryInfo(); err == nil {
+			rss += int64(mem.RSS)
+		}
+		if children, err := p.Children(); err == nil {
+			for _, child := range children {
+				pending = append(pending, child.Pid)
+			}
+		}
+	}
+	return cpuTimes, rss
+}
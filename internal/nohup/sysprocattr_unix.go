@@ -0,0 +1,14 @@
+//go:build !windows
+
+package nohup
+
+import "syscall"
+
+// detachedSysProcAttr starts the command in a new session (detached from the parent), with
+// the PTY as controlling terminal.
+func detachedSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+	}
+}
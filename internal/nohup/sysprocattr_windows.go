@@ -0,0 +1,13 @@
+//go:build windows
+
+package nohup
+
+import "syscall"
+
+// detachedSysProcAttr starts the command in a new process group, so that it does not receive
+// the console control events of the parent. Windows has no sessions and controlling terminals.
+func detachedSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
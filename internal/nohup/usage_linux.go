@@ -0,0 +1,20 @@
+package nohup
+
+import (
+	"os"
+	"syscall"
+
+	"mobileshell/internal/process"
+)
+
+// resourceUsage returns the resource usage of the completed command and of its descendants
+// which it waited for.
+func resourceUsage(state *os.ProcessState) process.Usage {
+	usage := process.Usage{UserTime: state.UserTime(), SystemTime: state.SystemTime()}
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		usage.MaxRSS = rusage.Maxrss * 1024 // Linux reports kilobytes
+		usage.BlockIn = rusage.Inblock
+		usage.BlockOut = rusage.Oublock
+	}
+	return usage
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package nohup
+
+import (
+	"os"
+
+	"mobileshell/internal/process"
+)
+
+// resourceUsage returns the CPU times of the completed command. The memory and the block IO
+// are only reported on Linux, the units of getrusage(2) differ between the other platforms.
+func resourceUsage(state *os.ProcessState) process.Usage {
+	return process.Usage{UserTime: state.UserTime(), SystemTime: state.SystemTime()}
+}
@@ -0,0 +1,211 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"mobileshell/internal/webpush"
+)
+
+// Backend delivers notifications to one service. A new service implements Backend and gets
+// added to Backends.
+type Backend interface {
+	Name() string
+	Send(ctx context.Context, event Event) error
+}
+
+// Backends returns the backends which are configured in c, and Web Push if a browser of
+// stateDir subscribed.
+func Backends(stateDir string, c Config) []Backend {
+	var backends []Backend
+	// On an error the backend is used, so that Send reports the error
+	if subs, err := webpush.List(stateDir); err != nil || len(subs) > 0 {
+		backends = append(backends, push{stateDir: stateDir})
+	}
+	if c.WebhookURL != "" {
+		backends = append(backends, webhook{url: c.WebhookURL})
+	}
+	if c.NtfyURL != "" {
+		backends = append(backends, ntfy{url: c.NtfyURL, token: c.NtfyToken})
+	}
+	if c.SMTPAddr != "" {
+		var to []string
+		for _, address := range strings.Split(c.EmailTo, ",") {
+			to = append(to, strings.TrimSpace(address))
+		}
+		backends = append(backends, email{
+			addr:     c.SMTPAddr,
+			username: c.SMTPUsername,
+			password: c.SMTPPassword,
+			from:     c.EmailFrom,
+			to:       to,
+		})
+	}
+	return backends
+}
+
+// webhook posts the Event as JSON.
+type webhook struct {
+	url string
+}
+
+func (w webhook) Name() string { return "webhook" }
+
+func (w webhook) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.url, bytes.NewReader(body), map[string]string{"Content-Type": "application/json"})
+}
+
+// ntfy publishes the message to a topic of ntfy (https://ntfy.sh or a self-hosted server),
+// which pushes it to the ntfy app on the phone.
+type ntfy struct {
+	url   string
+	token string
+}
+
+func (n ntfy) Name() string { return "ntfy" }
+
+func (n ntfy) Send(ctx context.Context, event Event) error {
+	headers := map[string]string{
+		"Title":    event.Title(),
+		"Priority": "default",
+		"Tags":     "white_check_mark",
+	}
+	if event.Failed() {
+		headers["Priority"] = "high"
+		headers["Tags"] = "x"
+	}
+	if n.token != "" {
+		headers["Authorization"] = "Bearer " + n.token
+	}
+	return post(ctx, n.url, strings.NewReader(event.Message()), headers)
+}
+
+// push sends a Web Push message to each browser which subscribed on the settings page. The
+// service worker (static/push-sw.js) shows it, and opens the process on a click.
+type push struct {
+	stateDir string
+}
+
+func (p push) Name() string { return "push" }
+
+// pushFieldLimit keeps the title and the body within webpush.MaxPayload.
+const pushFieldLimit = 1500
+
+func (p push) Send(ctx context.Context, event Event) error {
+	keys, err := webpush.LoadKeys(p.stateDir)
+	if err != nil {
+		return err
+	}
+	subs, err := webpush.List(p.stateDir)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]string{
+		"title":        truncate(event.Title(), pushFieldLimit),
+		"body":         truncate(event.Message(), pushFieldLimit),
+		"workspace_id": event.WorkspaceID,
+		"process_id":   event.ProcessID,
+	})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, sub := range subs {
+		err := webpush.Send(ctx, keys, sub, payload, event.Failed())
+		if errors.Is(err, webpush.ErrGone) {
+			// The browser unsubscribed or revoked the permission
+			err = webpush.Unsubscribe(p.stateDir, sub.ID)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// truncate returns at most n bytes of s, without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "") + "…"
+}
+
+// post sends body to url and returns an error if the response status is not 2xx.
+func post(ctx context.Context, url string, body io.Reader, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(text)))
+	}
+	return nil
+}
+
+// email sends the message with SMTP. The connection uses STARTTLS if the server offers it.
+type email struct {
+	addr     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func (e email) Name() string { return "email" }
+
+func (e email) Send(ctx context.Context, event Event) error {
+	var auth smtp.Auth
+	if e.username != "" {
+		host, _, _ := net.SplitHostPort(e.addr)
+		auth = smtp.PlainAuth("", e.username, e.password, host)
+	}
+	// smtp.SendMail has no context, it runs until the server answers or the connection breaks
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(e.addr, auth, e.from, e.to, e.message(event, time.Now().UTC()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// message returns the mail with headers, sent at date.
+func (e email) message(event Event, date time.Time) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "MobileShell: "+event.Title()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(event.Message(), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	return msg.Bytes()
+}
@@ -0,0 +1,290 @@
+// Package notify sends notifications when a process finished, so that you get pinged when a
+// long build failed. The nohup wrapper calls ProcessFinished after the command exited, so
+// notifications are sent even if the server doesn't run.
+//
+// The Config is stored in stateDir/notify, one file per setting. Each configured Backend
+// (webhook, ntfy, email, Web Push) gets every notification, unless a Rule routes it to some of
+// them only.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+)
+
+// configDir contains one file per setting of Config, in the state directory.
+const configDir = "notify"
+
+// sendTimeout limits each backend, a service which doesn't answer must not keep the nohup
+// wrapper running.
+const sendTimeout = 15 * time.Second
+
+// Config selects which processes cause a notification, and where it is sent to.
+type Config struct {
+	OnFailure   bool          // Notify when a process exited with a nonzero code, got killed by a signal or timed out
+	MinDuration time.Duration // Notify when a process ran at least this long, whatever its exit code. 0: never
+
+	WebhookURL string // Gets the Event as JSON in a POST request
+	NtfyURL    string // Topic URL of ntfy, like https://ntfy.sh/my-builds
+	NtfyToken  string // Access token of the ntfy topic, optional
+
+	SMTPAddr     string // Mail server as host:port
+	SMTPUsername string // Optional, without username no authentication is done
+	SMTPPassword string
+	EmailFrom    string
+	EmailTo      string // Comma separated addresses
+
+	// Rules route the notifications by the class and the command of the process. The first
+	// matching rule decides, without a match OnFailure and MinDuration apply.
+	Rules []Rule
+}
+
+// DefaultConfig returns the config which applies if none was saved. It has no backend, so no
+// notifications are sent.
+func DefaultConfig() Config {
+	return Config{OnFailure: true}
+}
+
+// Validate returns an error if a setting is invalid.
+func (c Config) Validate() error {
+	if c.MinDuration < 0 {
+		return fmt.Errorf("minimum duration must not be negative")
+	}
+	for name, value := range map[string]string{"webhook URL": c.WebhookURL, "ntfy URL": c.NtfyURL} {
+		if value == "" {
+			continue
+		}
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s must be an http or https URL: %q", name, value)
+		}
+	}
+	for i, r := range c.Rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	if c.SMTPAddr != "" {
+		if !strings.Contains(c.SMTPAddr, ":") {
+			return fmt.Errorf("SMTP server must be host:port, like smtp.example.com:587")
+		}
+		if c.EmailFrom == "" || c.EmailTo == "" {
+			return fmt.Errorf("email needs a sender and a recipient")
+		}
+	}
+	return nil
+}
+
+// fields maps the file names in configDir to the string settings of c.
+func (c *Config) fields() map[string]*string {
+	return map[string]*string{
+		"webhook-url":   &c.WebhookURL,
+		"ntfy-url":      &c.NtfyURL,
+		"ntfy-token":    &c.NtfyToken,
+		"smtp-addr":     &c.SMTPAddr,
+		"smtp-username": &c.SMTPUsername,
+		"smtp-password": &c.SMTPPassword,
+		"email-from":    &c.EmailFrom,
+		"email-to":      &c.EmailTo,
+	}
+}
+
+// LoadConfig returns the config which SaveConfig saved in stateDir, or DefaultConfig.
+func LoadConfig(stateDir string) Config {
+	c := DefaultConfig()
+	dir := filepath.Join(stateDir, configDir)
+	for name, field := range c.fields() {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			*field = strings.TrimSpace(string(data))
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "on-failure")); err == nil {
+		c.OnFailure = strings.TrimSpace(string(data)) == "true"
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "min-duration")); err == nil {
+		if d, err := time.ParseDuration(strings.TrimSpace(string(data))); err == nil {
+			c.MinDuration = d
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "rules")); err == nil {
+		rules, err := ParseRules(string(data))
+		if err != nil {
+			return DefaultConfig()
+		}
+		c.Rules = rules
+	}
+	if c.Validate() != nil {
+		return DefaultConfig()
+	}
+	return c
+}
+
+// SaveConfig validates c and saves it in stateDir.
+func SaveConfig(stateDir string, c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	dir := filepath.Join(stateDir, configDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", configDir, err)
+	}
+	files := []metadata.File{
+		{Name: "on-failure", Content: strconv.FormatBool(c.OnFailure)},
+		{Name: "min-duration", Content: c.MinDuration.String()},
+		{Name: "rules", Content: FormatRules(c.Rules)},
+	}
+	fields := c.fields()
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		files = append(files, metadata.File{Name: name, Content: *fields[name]})
+	}
+	return metadata.WriteFiles(dir, files)
+}
+
+// Reasons of an Event.
+const (
+	ReasonFailed   = "failed"   // The process didn't exit with 0
+	ReasonFinished = "finished" // The process ran longer than Config.MinDuration
+	ReasonRule     = "rule"     // A Rule of the Config matched
+	ReasonTest     = "test"     // Sent from the settings page
+)
+
+// Event is a finished process which caused a notification.
+type Event struct {
+	Reason      string    `json:"reason"`
+	Class       string    `json:"class"`
+	Workspace   string    `json:"workspace"`
+	WorkspaceID string    `json:"workspace_id,omitempty"`
+	ProcessID   string    `json:"process_id"`
+	Command     string    `json:"command"`
+	ExitCode    int       `json:"exit_code"`
+	Signal      string    `json:"signal,omitempty"`
+	TimedOut    bool      `json:"timed_out,omitempty"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	Duration    string    `json:"duration"`
+}
+
+// Failed returns true if the process didn't succeed.
+func (e Event) Failed() bool {
+	return e.ExitCode != 0 || e.Signal != "" || e.TimedOut
+}
+
+// classify returns the class of the finished process p.
+func classify(p *process.Process) string {
+	switch {
+	case p.TimedOut:
+		return ClassTimeout
+	case p.Signal != "":
+		return ClassSignaled
+	case p.ExitCode != 0:
+		return ClassFailure
+	}
+	return ClassSuccess
+}
+
+// Title summarizes the event in one line, like "Failed (exit 2): make build".
+func (e Event) Title() string {
+	status := "Succeeded"
+	switch {
+	case e.TimedOut:
+		status = "Timed out"
+	case e.Signal != "":
+		status = fmt.Sprintf("Killed (%s)", e.Signal)
+	case e.ExitCode != 0:
+		status = fmt.Sprintf("Failed (exit %d)", e.ExitCode)
+	}
+	command, _, _ := strings.Cut(e.Command, "\n")
+	return fmt.Sprintf("%s: %s", status, command)
+}
+
+// Message is the text of the notification.
+func (e Event) Message() string {
+	return fmt.Sprintf("Workspace: %s\nCommand: %s\nExit code: %d\nDuration: %s\nFinished: %s",
+		e.Workspace, e.Command, e.ExitCode, e.Duration, e.EndTime.Format("2006-01-02 15:04:05 UTC"))
+}
+
+// NewEvent returns the event of the finished process p in the workspace ws, and false if c
+// doesn't ask for a notification about it. The first Rule which matches decides, without a
+// match OnFailure and MinDuration do.
+func NewEvent(c Config, ws *workspace.Workspace, p *process.Process) (Event, bool) {
+	duration := p.FinishedAt().Sub(p.StartTime)
+	e := Event{
+		Class:       classify(p),
+		Workspace:   ws.Name,
+		WorkspaceID: ws.ID,
+		ProcessID:   p.CommandId,
+		Command:     p.Command,
+		ExitCode:    p.ExitCode,
+		Signal:      p.Signal,
+		TimedOut:    p.TimedOut,
+		StartTime:   p.StartTime,
+		EndTime:     p.FinishedAt(),
+		Duration:    duration.Round(time.Second).String(),
+	}
+	if rule, ok := c.match(e); ok {
+		e.Reason = ReasonRule
+		return e, !rule.silent()
+	}
+	switch {
+	case c.OnFailure && e.Failed():
+		e.Reason = ReasonFailed
+	case c.MinDuration > 0 && duration >= c.MinDuration:
+		e.Reason = ReasonFinished
+	default:
+		return e, false
+	}
+	return e, true
+}
+
+// ProcessFinished sends the notification about the process in processDir, if the config asks
+// for one. Errors of the backends are joined, a failing backend doesn't stop the others.
+func ProcessFinished(processDir string) error {
+	stateDir, ws, err := workspace.GetWorkspaceOfProcess(processDir)
+	if err != nil {
+		return err
+	}
+	c := LoadConfig(stateDir)
+	backends := Backends(stateDir, c)
+	if len(backends) == 0 {
+		return nil
+	}
+	p, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return err
+	}
+	event, ok := NewEvent(c, ws, p)
+	if !ok {
+		return nil
+	}
+	return Send(context.Background(), c.Route(event, backends), event)
+}
+
+// Send sends event to all backends.
+func Send(ctx context.Context, backends []Backend, event Event) error {
+	var errs []error
+	for _, b := range backends {
+		ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := b.Send(ctx, event)
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name(), err))
+			continue
+		}
+		slog.Info("Sent notification", "backend", b.Name(), "process", event.ProcessID, "reason", event.Reason)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mobileshell/internal/executor"
+	"mobileshell/internal/process"
+	"mobileshell/internal/webpush"
+	"mobileshell/internal/workspace"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.Equal(t, DefaultConfig(), LoadConfig(stateDir))
+	require.Empty(t, Backends(stateDir, LoadConfig(stateDir)))
+
+	c := Config{
+		MinDuration:  10 * time.Minute,
+		NtfyURL:      "https://ntfy.sh/builds",
+		SMTPAddr:     "smtp.example.com:587",
+		EmailFrom:    "shell@example.com",
+		EmailTo:      "me@example.com, you@example.com",
+		SMTPUsername: "shell",
+		SMTPPassword: "secret",
+	}
+	require.NoError(t, SaveConfig(stateDir, c))
+	require.Equal(t, c, LoadConfig(stateDir))
+	require.Len(t, Backends(stateDir, c), 2)
+	require.Equal(t, []string{"me@example.com", "you@example.com"}, Backends(stateDir, c)[1].(email).to)
+
+	require.Error(t, SaveConfig(stateDir, Config{WebhookURL: "ftp://example.com"}))
+	require.Error(t, SaveConfig(stateDir, Config{SMTPAddr: "smtp.example.com:587"}))
+	require.Error(t, SaveConfig(stateDir, Config{MinDuration: -time.Second}))
+	require.Equal(t, c, LoadConfig(stateDir))
+
+	// A browser which subscribed to Web Push gets the notifications, too
+	browserKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sub := &webpush.Subscription{Endpoint: "https://push.example.com/abc"}
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(browserKey.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString([]byte("0123456789abcdef"))
+	require.NoError(t, webpush.Subscribe(stateDir, sub, "Firefox"))
+	require.Equal(t, "push", Backends(stateDir, Config{})[0].Name())
+}
+
+func TestNewEvent(t *testing.T) {
+	t.Parallel()
+	ws := &workspace.Workspace{Name: "builds"}
+	start := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	p := &process.Process{CommandId: "p1", Command: "make build", ExitCode: 2, StartTime: start, EndTime: start.Add(90 * time.Second)}
+
+	event, ok := NewEvent(Config{OnFailure: true}, ws, p)
+	require.True(t, ok)
+	require.Equal(t, ReasonFailed, event.Reason)
+	require.Equal(t, "Failed (exit 2): make build", event.Title())
+	require.Equal(t, "1m30s", event.Duration)
+	require.Contains(t, event.Message(), "Workspace: builds")
+
+	_, ok = NewEvent(Config{MinDuration: time.Minute}, ws, p)
+	require.True(t, ok)
+	_, ok = NewEvent(Config{OnFailure: true, MinDuration: time.Hour}, ws, &process.Process{StartTime: start, EndTime: start.Add(time.Minute)})
+	require.False(t, ok)
+}
+
+func TestRules(t *testing.T) {
+	t.Parallel()
+	rules, err := ParseRules("# builds\nfailure ntfy,email ^make \n\nsuccess push deploy to prod\nany none")
+	require.NoError(t, err)
+	require.Equal(t, []Rule{
+		{Class: ClassFailure, Command: "^make", Backends: []string{"ntfy", "email"}},
+		{Class: ClassSuccess, Command: "deploy to prod", Backends: []string{"push"}},
+		{Class: "any", Backends: []string{"none"}},
+	}, rules)
+	require.Equal(t, "failure ntfy,email ^make\nsuccess push deploy to prod\nany none", FormatRules(rules))
+
+	for _, text := range []string{"crashed ntfy", "failure", "failure sms", "failure none,ntfy", "failure ntfy ("} {
+		_, err := ParseRules(text)
+		require.Error(t, err, text)
+	}
+
+	ws := &workspace.Workspace{Name: "builds"}
+	start := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	c := Config{OnFailure: true, Rules: rules}
+	for _, tt := range []struct {
+		process *process.Process
+		class   string
+		notify  bool
+		reason  string
+	}{
+		{&process.Process{Command: "make build", ExitCode: 2}, ClassFailure, true, ReasonRule},
+		{&process.Process{Command: "make build", Signal: "SIGKILL"}, ClassSignaled, false, ""},
+		{&process.Process{Command: "make build", TimedOut: true, ExitCode: -1}, ClassTimeout, false, ""},
+		{&process.Process{Command: "./deploy to prod"}, ClassSuccess, true, ReasonRule},
+		{&process.Process{Command: "ls"}, ClassSuccess, false, ""},
+	} {
+		tt.process.StartTime, tt.process.EndTime = start, start.Add(time.Second)
+		event, ok := NewEvent(c, ws, tt.process)
+		require.Equal(t, tt.class, event.Class, tt.process.Command)
+		require.Equal(t, tt.notify, ok, tt.process.Command)
+		if ok {
+			require.Equal(t, tt.reason, event.Reason)
+		}
+	}
+
+	// Without a matching rule, OnFailure applies
+	event, ok := NewEvent(Config{OnFailure: true, Rules: rules[:2]}, ws, &process.Process{Command: "go test", ExitCode: 1})
+	require.True(t, ok)
+	require.Equal(t, ReasonFailed, event.Reason)
+
+	backends := []Backend{push{}, webhook{}, ntfy{}, email{}}
+	names := func(backends []Backend) []string {
+		var names []string
+		for _, b := range backends {
+			names = append(names, b.Name())
+		}
+		return names
+	}
+	require.Equal(t, []string{"ntfy", "email"}, names(c.Route(Event{Class: ClassFailure, Command: "make"}, backends)))
+	require.Equal(t, []string{"push"}, names(c.Route(Event{Class: ClassSuccess, Command: "deploy to prod"}, backends)))
+	require.Empty(t, c.Route(Event{Class: ClassSuccess, Command: "ls"}, backends))
+	require.Len(t, Config{}.Route(Event{Class: ClassFailure}, backends), 4)
+	require.Len(t, Config{Rules: []Rule{{Class: "any", Backends: []string{"all"}}}}.Route(Event{}, backends), 4)
+
+	stateDir := t.TempDir()
+	require.NoError(t, SaveConfig(stateDir, c))
+	require.Equal(t, c, LoadConfig(stateDir))
+	require.Error(t, SaveConfig(stateDir, Config{Rules: []Rule{{Class: "crashed", Backends: []string{"all"}}}}))
+}
+
+func TestProcessFinished(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(stateDir))
+	ws, err := workspace.CreateWorkspace(stateDir, "builds", t.TempDir(), "")
+	require.NoError(t, err)
+	proc, err := executor.CreateProcess(ws, "make build")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(proc.ProcessDir, "exit-status"), []byte("2"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(proc.ProcessDir, "completed"), []byte("true"), 0o600))
+
+	requests := make(chan *http.Request, 2)
+	bodies := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- string(body)
+	}))
+	t.Cleanup(server.Close)
+	require.NoError(t, SaveConfig(stateDir, Config{
+		OnFailure:  true,
+		WebhookURL: server.URL + "/hook",
+		NtfyURL:    server.URL + "/topic",
+		NtfyToken:  "tk_secret",
+	}))
+	require.NoError(t, ProcessFinished(proc.ProcessDir))
+
+	webhook := <-requests
+	require.Equal(t, "/hook", webhook.URL.Path)
+	var event Event
+	require.NoError(t, json.Unmarshal([]byte(<-bodies), &event))
+	require.Equal(t, ReasonFailed, event.Reason)
+	require.Equal(t, "builds", event.Workspace)
+	require.Equal(t, 2, event.ExitCode)
+
+	topic := <-requests
+	require.Equal(t, "/topic", topic.URL.Path)
+	require.Equal(t, "Failed (exit 2): make build", topic.Header.Get("Title"))
+	require.Equal(t, "high", topic.Header.Get("Priority"))
+	require.Equal(t, "Bearer tk_secret", topic.Header.Get("Authorization"))
+	require.Contains(t, <-bodies, "Command: make build")
+
+	// A rule sends failures of make to the webhook only
+	require.NoError(t, SaveConfig(stateDir, Config{
+		WebhookURL: server.URL + "/hook",
+		NtfyURL:    server.URL + "/topic",
+		Rules:      []Rule{{Class: ClassFailure, Command: "^make ", Backends: []string{"webhook"}}},
+	}))
+	require.NoError(t, ProcessFinished(proc.ProcessDir))
+	require.Equal(t, "/hook", (<-requests).URL.Path)
+	require.NoError(t, json.Unmarshal([]byte(<-bodies), &event))
+	require.Equal(t, ReasonRule, event.Reason)
+	require.Equal(t, ClassFailure, event.Class)
+	require.Empty(t, requests)
+
+	// A backend which fails doesn't stop the others
+	require.NoError(t, SaveConfig(stateDir, Config{OnFailure: true, WebhookURL: server.URL + "/hook", NtfyURL: "http://127.0.0.1:1/topic"}))
+	err = ProcessFinished(proc.ProcessDir)
+	require.ErrorContains(t, err, "ntfy:")
+	require.Equal(t, "/hook", (<-requests).URL.Path)
+}
+
+func TestEmailMessage(t *testing.T) {
+	t.Parallel()
+	e := email{from: "shell@example.com", to: []string{"me@example.com"}}
+	event := Event{Command: "make büld", Signal: "killed", Workspace: "builds"}
+	message := string(e.message(event, time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)))
+	require.Contains(t, message, "To: me@example.com\r\n")
+	require.Contains(t, message, "Subject: =?utf-8?q?MobileShell:_Killed_(killed):_make_b=C3=BCld?=\r\n")
+	require.True(t, strings.HasSuffix(message, "\r\n\r\nWorkspace: builds\r\nCommand: make büld\r\nExit code: 0\r\nDuration: \r\nFinished: 0001-01-01 00:00:00 UTC\r\n"))
+}
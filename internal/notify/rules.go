@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Classes of a finished process, see Event.Class.
+const (
+	ClassSuccess  = "success"  // Exit code 0
+	ClassFailure  = "failure"  // Nonzero exit code
+	ClassSignaled = "signaled" // Killed by a signal
+	ClassTimeout  = "timeout"  // Killed because it ran longer than its timeout
+)
+
+// classes are the values of Rule.Class, "any" matches every class.
+var classes = []string{"any", ClassSuccess, ClassFailure, ClassSignaled, ClassTimeout}
+
+// backendNames are the values of Rule.Backends, see Backend.Name. "all" means every configured
+// backend, "none" suppresses the notification.
+var backendNames = []string{"all", "none", "push", "webhook", "ntfy", "email"}
+
+// Rule routes the notifications of the processes which match it to some backends. Rules are
+// written one per line, like "failure ntfy,email ^make": the class, the backends and an
+// optional regular expression, which the command must match.
+type Rule struct {
+	Class    string   // One of the Class constants, or "any"
+	Command  string   // Regular expression, empty: every command
+	Backends []string // Names of the backends, or "all" or "none"
+}
+
+// Validate returns an error if the rule is invalid.
+func (r Rule) Validate() error {
+	if !slices.Contains(classes, r.Class) {
+		return fmt.Errorf("invalid class %q, must be one of %s", r.Class, strings.Join(classes, ", "))
+	}
+	if len(r.Backends) == 0 {
+		return fmt.Errorf("rule for %s has no backends", r.Class)
+	}
+	for _, name := range r.Backends {
+		if !slices.Contains(backendNames, name) {
+			return fmt.Errorf("invalid backend %q, must be one of %s", name, strings.Join(backendNames, ", "))
+		}
+		if name == "none" && len(r.Backends) > 1 {
+			return fmt.Errorf("backend none can't be combined with others")
+		}
+	}
+	if _, err := regexp.Compile(r.Command); err != nil {
+		return fmt.Errorf("invalid command pattern %q: %w", r.Command, err)
+	}
+	return nil
+}
+
+// Matches returns true if the rule applies to event.
+func (r Rule) Matches(event Event) bool {
+	if r.Class != "any" && r.Class != event.Class {
+		return false
+	}
+	// Validate compiled the pattern already
+	matched, err := regexp.MatchString(r.Command, event.Command)
+	return err == nil && matched
+}
+
+// silent returns true if the rule suppresses the notification.
+func (r Rule) silent() bool {
+	return len(r.Backends) == 1 && r.Backends[0] == "none"
+}
+
+// sendsTo returns true if the rule routes to the backend b.
+func (r Rule) sendsTo(b Backend) bool {
+	return slices.Contains(r.Backends, "all") || slices.Contains(r.Backends, b.Name())
+}
+
+// String returns the rule in the format of ParseRules.
+func (r Rule) String() string {
+	return strings.TrimSpace(r.Class + " " + strings.Join(r.Backends, ",") + " " + r.Command)
+}
+
+// ParseRules parses one rule per line, see Rule. Empty lines and lines starting with # are
+// skipped.
+func ParseRules(text string) ([]Rule, error) {
+	var rules []Rule
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		class, rest, _ := strings.Cut(line, " ")
+		backends, command, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		rule := Rule{Class: class, Command: strings.TrimSpace(command)}
+		if backends != "" {
+			rule.Backends = strings.Split(backends, ",")
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// FormatRules returns the rules in the format of ParseRules.
+func FormatRules(rules []Rule) string {
+	lines := make([]string, 0, len(rules))
+	for _, r := range rules {
+		lines = append(lines, r.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// match returns the first rule of c which matches event.
+func (c Config) match(event Event) (Rule, bool) {
+	for _, r := range c.Rules {
+		if r.Matches(event) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Route returns the backends which get event: the ones of the first rule which matches it,
+// or all backends if no rule matches.
+func (c Config) Route(event Event, backends []Backend) []Backend {
+	rule, ok := c.match(event)
+	if !ok {
+		return backends
+	}
+	var routed []Backend
+	for _, b := range backends {
+		if rule.sendsTo(b) {
+			routed = append(routed, b)
+		}
+	}
+	return routed
+}
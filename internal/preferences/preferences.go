@@ -0,0 +1,85 @@
+// Package preferences stores the display preferences of the output view. They are kept in
+// the state directory, so they apply to all sessions and devices.
+package preferences
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// preferencesDir contains one file per preference, in the state directory.
+const preferencesDir = "preferences"
+
+// FontSizes are the monospace font sizes of the output, in pixels.
+var FontSizes = []int{10, 12, 14, 16, 18, 20}
+
+// Themes are the color themes of the output.
+var Themes = []string{"light", "dark"}
+
+// Preferences of the output view.
+type Preferences struct {
+	Wrap     bool   // Wrap long lines, instead of scrolling horizontally
+	FontSize int    // One of FontSizes
+	Theme    string // One of Themes
+}
+
+// Default returns the preferences which apply until they get saved.
+func Default() Preferences {
+	return Preferences{Wrap: true, FontSize: 14, Theme: "light"}
+}
+
+// Validate checks that the font size and the theme are known.
+func (p Preferences) Validate() error {
+	if !slices.Contains(FontSizes, p.FontSize) {
+		return fmt.Errorf("invalid font size %d", p.FontSize)
+	}
+	if !slices.Contains(Themes, p.Theme) {
+		return fmt.Errorf("invalid theme %q", p.Theme)
+	}
+	return nil
+}
+
+// Load reads the preferences. Missing or invalid values get their default.
+func Load(stateDir string) Preferences {
+	p := Default()
+	dir := filepath.Join(stateDir, preferencesDir)
+	if data, err := os.ReadFile(filepath.Join(dir, "wrap")); err == nil {
+		if wrap, err := strconv.ParseBool(string(data)); err == nil {
+			p.Wrap = wrap
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "font-size")); err == nil {
+		if size, err := strconv.Atoi(string(data)); err == nil && slices.Contains(FontSizes, size) {
+			p.FontSize = size
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "theme")); err == nil && slices.Contains(Themes, string(data)) {
+		p.Theme = string(data)
+	}
+	return p
+}
+
+// Save validates and stores the preferences.
+func Save(stateDir string, p Preferences) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	dir := filepath.Join(stateDir, preferencesDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create preferences directory: %w", err)
+	}
+	files := map[string]string{
+		"wrap":      strconv.FormatBool(p.Wrap),
+		"font-size": strconv.Itoa(p.FontSize),
+		"theme":     p.Theme,
+	}
+	for name, value := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
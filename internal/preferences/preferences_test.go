@@ -0,0 +1,35 @@
+package preferences
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadDefault(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, Default(), Load(t.TempDir()))
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	p := Preferences{Wrap: false, FontSize: 18, Theme: "dark"}
+	require.NoError(t, Save(stateDir, p))
+	require.Equal(t, p, Load(stateDir))
+
+	require.Error(t, Save(stateDir, Preferences{Wrap: true, FontSize: 99, Theme: "dark"}))
+	require.Error(t, Save(stateDir, Preferences{Wrap: true, FontSize: 14, Theme: "pink"}))
+	require.Equal(t, p, Load(stateDir))
+}
+
+func TestLoadIgnoresInvalidValues(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(stateDir, preferencesDir), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, preferencesDir, "font-size"), []byte("1000"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, preferencesDir, "theme"), []byte("<script>"), 0o600))
+	require.Equal(t, Default(), Load(stateDir))
+}
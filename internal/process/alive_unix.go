@@ -0,0 +1,18 @@
+//go:build !windows
+
+package process
+
+import (
+	"os"
+	"syscall"
+)
+
+// IsAlive reports whether a process with the given PID exists. Signal 0 performs the error
+// checks of kill(2) without sending a signal.
+func IsAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return proc.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,88 @@
+package process
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+	"mobileshell/pkg/outputlog"
+)
+
+// Values of the status file. It is "running" while nohup runs the command.
+const (
+	statusRunning   = "running"
+	statusCompleted = "completed"
+)
+
+// Complete marks the process in processDir as completed. The files, for example the exit
+// status, are written first, then the end time, the status and, last, the completed file, so
+// that readers can take the other files for granted once the process is completed. The end
+// time is now, unless the files contain an endtime file.
+func Complete(processDir string, files ...metadata.File) error {
+	if !slices.ContainsFunc(files, func(f metadata.File) bool { return f.Name == "endtime" }) {
+		files = append(files, metadata.File{Name: "endtime", Content: time.Now().UTC().Format(outputlog.TimeFormatRFC3339NanoUTC)})
+	}
+	files = append(files,
+		metadata.File{Name: "status", Content: statusCompleted},
+		metadata.File{Name: "completed", Content: "true"},
+	)
+	return metadata.WriteFiles(processDir, files)
+}
+
+// fillGaps sets the fields of proc whose files are inconsistent, because the writer crashed
+// between two files or is still writing them, see Complete. Nothing is written, the files are
+// owned by the writer, see Repair.
+func fillGaps(proc *Process, startTimeErr error) error {
+	if startTimeErr != nil {
+		// The ID of a process is its start time, the starttime file only differs for queued
+		// processes, see MarkStarted
+		startTime, err := time.Parse(time.RFC3339Nano, proc.CommandId)
+		if err != nil {
+			return startTimeErr
+		}
+		proc.StartTime = startTime
+	}
+	// The end time is written right before the completed file
+	if !proc.EndTime.IsZero() {
+		proc.Completed = true
+	}
+	return nil
+}
+
+// Repair rewrites the files of proc which a crashed writer left inconsistent, see fillGaps, so
+// that the files agree with what readers see. It does nothing while the writer runs, see
+// WriterAlive. It is called by the cleanup of orphaned processes.
+func Repair(proc *Process) error {
+	processDir := proc.ProcessDir
+	var files []metadata.File
+	data, err := os.ReadFile(filepath.Join(processDir, "starttime"))
+	if _, parseErr := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data))); err != nil || parseErr != nil {
+		if _, err := time.Parse(time.RFC3339Nano, proc.CommandId); err == nil {
+			files = append(files, metadata.File{Name: "starttime", Content: proc.CommandId})
+		}
+	}
+	completed, _ := os.ReadFile(filepath.Join(processDir, "completed"))
+	status, _ := os.ReadFile(filepath.Join(processDir, "status"))
+	if proc.Completed && strings.TrimSpace(string(status)) == statusRunning {
+		files = append(files, metadata.File{Name: "status", Content: statusCompleted})
+	}
+	if proc.Completed && strings.TrimSpace(string(completed)) != "true" {
+		files = append(files, metadata.File{Name: "completed", Content: "true"})
+	}
+	if len(files) == 0 || proc.WriterAlive() {
+		return nil
+	}
+	if err := metadata.WriteFiles(processDir, files); err != nil {
+		return err
+	}
+	var repaired []string
+	for _, f := range files {
+		repaired = append(repaired, f.Name)
+	}
+	slog.Warn("Repaired inconsistent process files", "processDir", processDir, "files", repaired)
+	return nil
+}
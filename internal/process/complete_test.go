@@ -0,0 +1,81 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"mobileshell/internal/metadata"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComplete(t *testing.T) {
+	t.Parallel()
+	processDir := filepath.Join(t.TempDir(), "2025-01-07T10:00:00Z")
+	require.NoError(t, os.MkdirAll(processDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "cmd"), []byte("false"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "starttime"), []byte("2025-01-07T10:00:00Z"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "status"), []byte(statusRunning), 0o600))
+
+	require.NoError(t, Complete(processDir, metadata.File{Name: "exit-status", Content: "1"}))
+	proc, err := LoadProcessFromDir(processDir)
+	require.NoError(t, err)
+	require.True(t, proc.Completed)
+	require.Equal(t, 1, proc.ExitCode)
+	require.False(t, proc.EndTime.IsZero())
+	status, err := os.ReadFile(filepath.Join(processDir, "status"))
+	require.NoError(t, err)
+	require.Equal(t, statusCompleted, string(status))
+
+	require.NoError(t, Complete(processDir, metadata.File{Name: "endtime", Content: "2025-01-07T10:00:05Z"}))
+	proc, err = LoadProcessFromDir(processDir)
+	require.NoError(t, err)
+	require.Equal(t, "2025-01-07T10:00:05Z", proc.EndTime.Format("2006-01-02T15:04:05Z07:00"))
+}
+
+func TestRepair(t *testing.T) {
+	t.Parallel()
+	processDir := filepath.Join(t.TempDir(), "2025-01-07T10:00:00Z")
+	require.NoError(t, os.MkdirAll(processDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "cmd"), []byte("make"), 0o600))
+	// A crash after the end time was written, and while the starttime file was written
+	files := map[string]string{"starttime": "", "status": statusRunning, "completed": "false", "exit-status": "0", "endtime": "2025-01-07T10:00:05Z"}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(processDir, name), []byte(content), 0o600))
+	}
+	requireFiles := func(want map[string]string) {
+		t.Helper()
+		for name, content := range want {
+			data, err := os.ReadFile(filepath.Join(processDir, name))
+			require.NoError(t, err)
+			require.Equal(t, content, string(data), name)
+		}
+	}
+
+	// Readers see the process as completed, but don't write
+	proc, err := LoadProcessFromDir(processDir)
+	require.NoError(t, err)
+	require.True(t, proc.Completed)
+	require.Equal(t, "2025-01-07T10:00:00Z", proc.StartTime.Format("2006-01-02T15:04:05Z07:00"))
+	requireFiles(files)
+
+	// Nothing is repaired while the nohup wrapper runs
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, NohupPIDFile), []byte(strconv.Itoa(os.Getpid())), 0o600))
+	require.True(t, proc.WriterAlive())
+	require.NoError(t, Repair(proc))
+	requireFiles(files)
+
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, NohupPIDFile), []byte("0"), 0o600))
+	require.False(t, proc.WriterAlive())
+	require.NoError(t, Repair(proc))
+	requireFiles(map[string]string{"starttime": "2025-01-07T10:00:00Z", "completed": "true", "status": statusCompleted})
+
+	// Without a start time in the ID there is nothing to repair
+	otherDir := filepath.Join(t.TempDir(), "not-a-time")
+	require.NoError(t, os.MkdirAll(otherDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(otherDir, "cmd"), []byte("make"), 0o600))
+	_, err = LoadProcessFromDir(otherDir)
+	require.ErrorContains(t, err, "starttime")
+}
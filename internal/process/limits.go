@@ -0,0 +1,221 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+)
+
+// Files of the limits in the process directory.
+const (
+	limitTimeoutFile = "limit-timeout"
+	limitCPUFile     = "limit-cpu"
+	limitMemoryFile  = "limit-memory"
+	limitNiceFile    = "limit-nice"
+	limitIOFile      = "limit-io-priority"
+	timedOutFile     = "timed-out"
+)
+
+// IO priorities of a process. Without one, the IO priority follows the niceness.
+const (
+	IOPriorityLow  = "low"  // Lowest level of the best-effort class
+	IOPriorityIdle = "idle" // Only gets disk time when no other process needs it
+)
+
+// MaxNice is the lowest CPU priority. Lower values than 0, a higher priority, need root.
+const MaxNice = 19
+
+// Limits restrict the resources of a process. Zero values mean no limit. They get written
+// before the process starts, see WriteLimits, and nohup enforces them.
+type Limits struct {
+	Timeout time.Duration // Wall-clock time, then the process gets terminated
+	CPU     time.Duration // CPU time (RLIMIT_CPU)
+	Memory  int64         // Virtual memory in bytes (RLIMIT_AS)
+
+	// The priorities are no limits, but they are set the same way. Long batch jobs get a
+	// lower priority, so that they don't slow down the interactive terminal.
+	Nice       int    // Niceness from 1 to MaxNice, 0 means unchanged
+	IOPriority string // IOPriorityLow or IOPriorityIdle, empty means unchanged
+}
+
+// ParseLimits parses the user input. timeout and cpu are durations like "10m", memory is a
+// size like "512M" or "2G". nice and ioPriority are parsed by ParsePriority. Empty strings
+// mean no limit.
+func ParseLimits(timeout, cpu, memory, nice, ioPriority string) (Limits, error) {
+	var limits Limits
+	var err error
+	if limits.Timeout, err = parseLimitDuration(timeout); err != nil {
+		return Limits{}, fmt.Errorf("invalid timeout %q: %w", timeout, err)
+	}
+	if limits.CPU, err = parseLimitDuration(cpu); err != nil {
+		return Limits{}, fmt.Errorf("invalid CPU limit %q: %w", cpu, err)
+	}
+	if limits.Memory, err = parseMemory(memory); err != nil {
+		return Limits{}, fmt.Errorf("invalid memory limit %q: %w", memory, err)
+	}
+	if limits.Nice, limits.IOPriority, err = ParsePriority(nice, ioPriority); err != nil {
+		return Limits{}, err
+	}
+	return limits, nil
+}
+
+// ParsePriority parses the niceness, a number from 0 to MaxNice, and the IO priority. Empty
+// strings mean no change of the priority.
+func ParsePriority(nice, ioPriority string) (int, string, error) {
+	n := 0
+	if nice = strings.TrimSpace(nice); nice != "" {
+		var err error
+		if n, err = strconv.Atoi(nice); err != nil {
+			return 0, "", fmt.Errorf("invalid niceness %q: %w", nice, err)
+		}
+	}
+	ioPriority = strings.TrimSpace(ioPriority)
+	if err := ValidatePriority(n, ioPriority); err != nil {
+		return 0, "", err
+	}
+	return n, ioPriority, nil
+}
+
+// ValidatePriority returns an error if the niceness is not between 0 and MaxNice, or if the
+// IO priority is unknown.
+func ValidatePriority(nice int, ioPriority string) error {
+	if nice < 0 || nice > MaxNice {
+		return fmt.Errorf("invalid niceness %d: use 0 (unchanged) to %d (lowest priority)", nice, MaxNice)
+	}
+	switch ioPriority {
+	case "", IOPriorityLow, IOPriorityIdle:
+		return nil
+	}
+	return fmt.Errorf("invalid IO priority %q: use %q or %q", ioPriority, IOPriorityLow, IOPriorityIdle)
+}
+
+func parseLimitDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("must be at least one second")
+	}
+	return d, nil
+}
+
+// parseMemory parses a size in bytes, with an optional K, M or G suffix (powers of 1024).
+func parseMemory(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
+	}
+	if unit > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return n * unit, nil
+}
+
+// IsZero returns true if there are no limits.
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// String describes the limits, like "timeout 10m0s, memory 512 MiB".
+func (l Limits) String() string {
+	var parts []string
+	if l.Timeout > 0 {
+		parts = append(parts, "timeout "+l.Timeout.String())
+	}
+	if l.CPU > 0 {
+		parts = append(parts, "CPU "+l.CPU.String())
+	}
+	if l.Memory > 0 {
+		parts = append(parts, fmt.Sprintf("memory %d MiB", l.Memory>>20))
+	}
+	if l.Nice > 0 {
+		parts = append(parts, fmt.Sprintf("nice %d", l.Nice))
+	}
+	if l.IOPriority != "" {
+		parts = append(parts, "IO priority "+l.IOPriority)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WriteLimits stores the limits in the process directory. Limits which are not set get no
+// file.
+func WriteLimits(processDir string, l Limits) error {
+	files := map[string]string{}
+	if l.Timeout > 0 {
+		files[limitTimeoutFile] = l.Timeout.String()
+	}
+	if l.CPU > 0 {
+		files[limitCPUFile] = l.CPU.String()
+	}
+	if l.Memory > 0 {
+		files[limitMemoryFile] = strconv.FormatInt(l.Memory, 10)
+	}
+	if l.Nice > 0 {
+		files[limitNiceFile] = strconv.Itoa(l.Nice)
+	}
+	if l.IOPriority != "" {
+		files[limitIOFile] = l.IOPriority
+	}
+	for name, content := range files {
+		if err := metadata.WriteFile(filepath.Join(processDir, name), []byte(content), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s file: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ReadLimits reads the limits of the process directory. Missing or invalid files mean no
+// limit.
+func ReadLimits(processDir string) Limits {
+	var l Limits
+	if data, err := os.ReadFile(filepath.Join(processDir, limitTimeoutFile)); err == nil {
+		l.Timeout, _ = time.ParseDuration(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(processDir, limitCPUFile)); err == nil {
+		l.CPU, _ = time.ParseDuration(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(processDir, limitMemoryFile)); err == nil {
+		l.Memory, _ = strconv.ParseInt(string(data), 10, 64)
+	}
+	if data, err := os.ReadFile(filepath.Join(processDir, limitNiceFile)); err == nil {
+		l.Nice, _ = strconv.Atoi(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(processDir, limitIOFile)); err == nil {
+		l.IOPriority = string(data)
+	}
+	return l
+}
+
+// WriteTimedOut marks the process as terminated because its timeout was reached.
+func WriteTimedOut(processDir string) error {
+	if err := metadata.WriteFile(filepath.Join(processDir, timedOutFile), []byte("true"), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s file: %w", timedOutFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimits(t *testing.T) {
+	t.Parallel()
+	limits, err := ParseLimits("10m", " 90s ", "512m", "", "")
+	require.NoError(t, err)
+	require.Equal(t, Limits{Timeout: 10 * time.Minute, CPU: 90 * time.Second, Memory: 512 << 20}, limits)
+	require.Equal(t, "timeout 10m0s, CPU 1m30s, memory 512 MiB", limits.String())
+
+	limits, err = ParseLimits("", "", "", "", "")
+	require.NoError(t, err)
+	require.True(t, limits.IsZero())
+
+	limits, err = ParseLimits("", "", "", "10", "idle")
+	require.NoError(t, err)
+	require.Equal(t, Limits{Nice: 10, IOPriority: IOPriorityIdle}, limits)
+	require.Equal(t, "nice 10, IO priority idle", limits.String())
+
+	_, err = ParseLimits("soon", "", "", "", "")
+	require.Error(t, err)
+	_, err = ParseLimits("10ms", "", "", "", "")
+	require.Error(t, err)
+	_, err = ParseLimits("", "", "-1G", "", "")
+	require.Error(t, err)
+	_, err = ParseLimits("", "", "", "-5", "")
+	require.Error(t, err)
+	_, err = ParseLimits("", "", "", "20", "")
+	require.Error(t, err)
+	_, err = ParseLimits("", "", "", "", "realtime")
+	require.Error(t, err)
+}
+
+func TestWriteAndReadLimits(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.True(t, ReadLimits(dir).IsZero())
+
+	limits := Limits{Timeout: time.Hour, Memory: 1 << 30, Nice: 19, IOPriority: IOPriorityLow}
+	require.NoError(t, WriteLimits(dir, limits))
+	require.Equal(t, limits, ReadLimits(dir))
+}
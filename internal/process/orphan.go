@@ -0,0 +1,79 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+
+	gopsprocess "github.com/shirou/gopsutil/v3/process"
+)
+
+// orphanedFile marks a process which died without the nohup wrapper writing its exit status,
+// for example because the wrapper got killed. The exit status is unknown.
+const orphanedFile = "orphaned"
+
+// NohupPIDFile contains the PID of the nohup wrapper of the process, see WriterAlive.
+const NohupPIDFile = "nohup-pid"
+
+// pidReuseSlack is the tolerance when the start time of the OS process gets compared with the
+// times which were recorded in the process directory. On Linux the start time is derived from
+// the boot time, which has a resolution of one second.
+const pidReuseSlack = 2 * time.Second
+
+// Alive reports whether the command with p.PID still runs. The PID must be alive (see IsAlive)
+// and the OS process must have been started between the start time of p and the time the pid
+// file was written. Otherwise the command died and a later process got the same PID.
+func (p *Process) Alive() bool {
+	return p.pidAlive(p.PID, "pid")
+}
+
+// WriterAlive reports whether the nohup wrapper, which writes the files of the process, still
+// runs. Processes without nohup-pid file, like terminal recordings, have no separate wrapper,
+// then the command is checked, see Alive.
+func (p *Process) WriterAlive() bool {
+	data, err := os.ReadFile(filepath.Join(p.ProcessDir, NohupPIDFile))
+	if err != nil {
+		return p.Alive()
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return false
+	}
+	return p.pidAlive(pid, NohupPIDFile)
+}
+
+// pidAlive reports whether pid, which was written to pidFile, still belongs to the process of
+// p, see Alive.
+func (p *Process) pidAlive(pid int, pidFile string) bool {
+	if pid <= 0 || !IsAlive(pid) {
+		return false
+	}
+	osProc, err := gopsprocess.NewProcess(int32(pid))
+	if err != nil {
+		return false
+	}
+	createTime, err := osProc.CreateTime()
+	if err != nil {
+		// The start time is not available on every platform, trust the PID then
+		return true
+	}
+	created := time.UnixMilli(createTime)
+	if created.Before(p.StartTime.Add(-pidReuseSlack)) {
+		return false
+	}
+	if info, err := os.Stat(filepath.Join(p.ProcessDir, pidFile)); err == nil && created.After(info.ModTime().Add(pidReuseSlack)) {
+		return false
+	}
+	return true
+}
+
+// MarkOrphaned marks the process in processDir as completed with an unknown exit status. It is
+// used for processes whose command died without the nohup wrapper noticing it, and for
+// processes which the user marked as finished.
+func MarkOrphaned(processDir string) error {
+	return Complete(processDir, metadata.File{Name: orphanedFile, Content: "true"})
+}
@@ -0,0 +1,56 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlive(t *testing.T) {
+	t.Parallel()
+	processDir := t.TempDir()
+	startTime := time.Now()
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "pid"), []byte(strconv.Itoa(cmd.Process.Pid)), 0o600))
+
+	proc := &Process{PID: cmd.Process.Pid, StartTime: startTime, ProcessDir: processDir}
+	require.True(t, proc.Alive())
+
+	// The OS process started before the mobileshell process, so the PID was reused
+	proc.StartTime = startTime.Add(time.Hour)
+	require.False(t, proc.Alive())
+
+	// The OS process started after the pid file was written
+	proc.StartTime = startTime.Add(-time.Hour)
+	written := startTime.Add(-time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(processDir, "pid"), written, written))
+	require.False(t, proc.Alive())
+
+	proc.PID = 0
+	require.False(t, proc.Alive())
+}
+
+func TestMarkOrphaned(t *testing.T) {
+	t.Parallel()
+	processDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "cmd"), []byte("sleep 60"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "starttime"), []byte(time.Now().UTC().Format(time.RFC3339Nano)), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "completed"), []byte("false"), 0o600))
+
+	require.NoError(t, MarkOrphaned(processDir))
+	proc, err := LoadProcessFromDir(processDir)
+	require.NoError(t, err)
+	require.True(t, proc.Completed)
+	require.True(t, proc.Orphaned)
+	require.False(t, proc.EndTime.IsZero())
+}
@@ -0,0 +1,48 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"mobileshell/internal/metadata"
+)
+
+// outputTypeFile contains the detected type of the stdout output and the reason, separated by
+// a comma, for example "text,no special terminal control sequences detected".
+const outputTypeFile = "output-type"
+
+// WriteOutputType stores the detected type of the stdout output in the process directory.
+func WriteOutputType(processDir, outputType, reason string) error {
+	data := fmt.Sprintf("%s,%s", outputType, reason)
+	if err := metadata.WriteFile(filepath.Join(processDir, outputTypeFile), []byte(data), 0o600); err != nil {
+		return fmt.Errorf("failed to write output-type file: %w", err)
+	}
+	return nil
+}
+
+// ReadOutputType returns the detected type of the stdout output and the reason. Both are
+// empty if the type was not detected (yet).
+func ReadOutputType(processDir string) (outputType, reason string) {
+	data, err := os.ReadFile(filepath.Join(processDir, outputTypeFile))
+	if err != nil {
+		return "", ""
+	}
+	outputType, reason, _ = strings.Cut(strings.TrimSpace(string(data)), ",")
+	return outputType, reason
+}
+
+// CollectOutputTypes returns the detected output types of all processes, sorted and
+// deduplicated.
+func CollectOutputTypes(processes []*Process) []string {
+	var types []string
+	for _, p := range processes {
+		if p.ContentType != "" {
+			types = append(types, p.ContentType)
+		}
+	}
+	slices.Sort(types)
+	return slices.Compact(types)
+}
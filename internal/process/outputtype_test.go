@@ -0,0 +1,23 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputType(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	outputType, reason := ReadOutputType(dir)
+	require.Empty(t, outputType)
+	require.Empty(t, reason)
+
+	require.NoError(t, WriteOutputType(dir, "ink", "ANSI color codes, no fullscreen"))
+	outputType, reason = ReadOutputType(dir)
+	require.Equal(t, "ink", outputType)
+	require.Equal(t, "ANSI color codes, no fullscreen", reason)
+
+	types := CollectOutputTypes([]*Process{{ContentType: "text"}, {}, {ContentType: "ink"}, {ContentType: "text"}})
+	require.Equal(t, []string{"ink", "text"}, types)
+}
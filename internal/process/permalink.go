@@ -0,0 +1,21 @@
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// PermalinkLength is the number of hex characters of a permalink.
+const PermalinkLength = 16
+
+// PermalinkFor returns the stable identifier of a process. It only depends on the process
+// itself, not on the workspace, so it survives renaming and re-creating the workspace.
+func PermalinkFor(commandId, command string) string {
+	sum := sha256.Sum256([]byte(commandId + "\x00" + command))
+	return hex.EncodeToString(sum[:])[:PermalinkLength]
+}
+
+// Permalink returns the stable identifier of the process, see PermalinkFor.
+func (p *Process) Permalink() string {
+	return PermalinkFor(p.CommandId, p.Command)
+}
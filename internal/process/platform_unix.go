@@ -0,0 +1,8 @@
+//go:build !windows
+
+package process
+
+// CheckPlatform returns nil, processes run in a pseudo terminal of creack/pty.
+func CheckPlatform() error {
+	return nil
+}
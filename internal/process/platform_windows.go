@@ -0,0 +1,15 @@
+//go:build windows
+
+package process
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CheckPlatform returns an error which wraps errors.ErrUnsupported. Processes and terminals
+// need a pseudo terminal, creack/pty has none on Windows and ConPTY is not implemented yet.
+// The callers check it before they write any file, so that nothing runs halfway.
+func CheckPlatform() error {
+	return fmt.Errorf("running processes is not supported on Windows, it needs ConPTY: %w", errors.ErrUnsupported)
+}
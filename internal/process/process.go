@@ -1,6 +1,7 @@
 package process
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -22,11 +23,36 @@ type Process struct {
 	ExitCode    int
 	Signal      string
 	EndTime     time.Time
-	ContentType string // MIME type of stdout output
+	ContentType string // Detected type of stdout output, see outputtype.OutputType
+	Profile     string // Pre-command profile of the workspace, empty for the default pre-command
 	ProcessDir  string
 	ExecCmd     *exec.Cmd
+	Tags        []string // Free-form tags to find related processes, see SaveTags
+
+	ContentTypeReason string // Why ContentType was detected
+
+	Limits    Limits // Resource limits, enforced by nohup
+	TimedOut  bool   // true if the process got terminated because Limits.Timeout was reached
+	Orphaned  bool   // true if the process died without an exit status, see MarkOrphaned
+	Queued    bool   // true while the process waits for a free slot of its workspace, see MarkQueued
+	Cancelled bool   // true if the process was cancelled while it was queued, see MarkCancelled
+	Usage     *Usage // Resource usage, written by nohup when the process completed
+
+	// Pipelines: the next step gets started when this process completed, see
+	// executor.StartNextPipelineStep
+	PipelinePrevious  string   // CommandId of the previous step, empty for the first step
+	PipelineNext      string   // CommandId of the next step, once it was started
+	PipelineSteps     []string // Commands which run after this process
+	PipelineCondition string   // PipelineOnSuccess or PipelineAlways
 }
 
+const (
+	// PipelineOnSuccess runs the next step only if the process exited with 0
+	PipelineOnSuccess = "on-success"
+	// PipelineAlways runs the next step regardless of the exit code
+	PipelineAlways = "always"
+)
+
 func LoadProcessFromDir(processDir string) (*Process, error) {
 	// Read command file
 	cmdData, err := os.ReadFile(filepath.Join(processDir, "cmd"))
@@ -40,16 +66,14 @@ func LoadProcessFromDir(processDir string) (*Process, error) {
 		OutputFile: filepath.Join(processDir, "output.log"),
 	}
 
-	// Read starttime file
+	// Read starttime file, a missing or broken one is taken from the ID below
+	var startTimeErr error
 	startTimeData, err := os.ReadFile(filepath.Join(processDir, "starttime"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read starttime file: %w", err)
-	}
-	startTime, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(startTimeData)))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse starttime: %w", err)
+		startTimeErr = fmt.Errorf("failed to read starttime file: %w", err)
+	} else if proc.StartTime, err = time.Parse(time.RFC3339Nano, strings.TrimSpace(string(startTimeData))); err != nil {
+		startTimeErr = fmt.Errorf("failed to parse starttime: %w", err)
 	}
-	proc.StartTime = startTime
 
 	// Read completed file
 	completedData, err := os.ReadFile(filepath.Join(processDir, "completed"))
@@ -91,5 +115,65 @@ func LoadProcessFromDir(processDir string) (*Process, error) {
 		proc.Signal = strings.TrimSpace(string(signalData))
 	}
 
+	// Read profile file (optional)
+	profileData, err := os.ReadFile(filepath.Join(processDir, "profile"))
+	if err == nil {
+		proc.Profile = string(profileData)
+	}
+
+	proc.ContentType, proc.ContentTypeReason = ReadOutputType(processDir)
+
+	proc.Tags = ReadTags(processDir)
+
+	proc.Limits = ReadLimits(processDir)
+	if _, err := os.Stat(filepath.Join(processDir, timedOutFile)); err == nil {
+		proc.TimedOut = true
+	}
+	if _, err := os.Stat(filepath.Join(processDir, orphanedFile)); err == nil {
+		proc.Orphaned = true
+	}
+	if _, err := os.Stat(filepath.Join(processDir, queuedFile)); err == nil {
+		proc.Queued = true
+	}
+	if _, err := os.Stat(filepath.Join(processDir, cancelledFile)); err == nil {
+		proc.Cancelled = true
+	}
+	proc.Usage = ReadUsage(processDir)
+
+	// Read pipeline files (optional)
+	if data, err := os.ReadFile(filepath.Join(processDir, "pipeline-previous")); err == nil {
+		proc.PipelinePrevious = string(data)
+	}
+	if data, err := os.ReadFile(filepath.Join(processDir, "pipeline-next")); err == nil {
+		proc.PipelineNext = string(data)
+	}
+	if data, err := os.ReadFile(filepath.Join(processDir, "pipeline-steps")); err == nil {
+		if err := json.Unmarshal(data, &proc.PipelineSteps); err != nil {
+			return nil, fmt.Errorf("failed to parse pipeline-steps: %w", err)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(processDir, "pipeline-condition")); err == nil {
+		proc.PipelineCondition = string(data)
+	}
+
+	if err := fillGaps(&proc, startTimeErr); err != nil {
+		return nil, err
+	}
 	return &proc, nil
 }
+
+// PipelineSkipped returns true if the process completed, but its next pipeline steps don't
+// run because the process failed.
+func (p *Process) PipelineSkipped() bool {
+	return p.Completed && len(p.PipelineSteps) > 0 && p.PipelineNext == "" &&
+		p.PipelineCondition != PipelineAlways && (p.ExitCode != 0 || p.Signal != "")
+}
+
+// FinishedAt returns the end time of the process, or the start time if the end time is
+// unknown (for example if the process was marked as completed during cleanup).
+func (p *Process) FinishedAt() time.Time {
+	if p.EndTime.IsZero() {
+		return p.StartTime
+	}
+	return p.EndTime
+}
@@ -0,0 +1,49 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"mobileshell/internal/metadata"
+	"mobileshell/pkg/outputlog"
+)
+
+// The queued file marks a process which waits for a free slot of its workspace, see
+// workspace.Workspace.MaxConcurrent. The cancelled file marks a queued process which was
+// cancelled before it started.
+const (
+	queuedFile    = "queued"
+	cancelledFile = "cancelled"
+)
+
+// MarkQueued marks the process in processDir as queued.
+func MarkQueued(processDir string) error {
+	if err := metadata.WriteFile(filepath.Join(processDir, queuedFile), []byte("true"), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s file: %w", queuedFile, err)
+	}
+	return nil
+}
+
+// ClaimQueued removes the queued mark of the process in processDir. It returns false if the
+// process is not queued (anymore), so that only one caller starts or cancels it.
+func ClaimQueued(processDir string) bool {
+	return os.Remove(filepath.Join(processDir, queuedFile)) == nil
+}
+
+// MarkStarted writes the start time of a process which was queued. Without it, the duration
+// would include the time in the queue.
+func MarkStarted(processDir string) error {
+	startTime := time.Now().UTC().Format(outputlog.TimeFormatRFC3339NanoUTC)
+	if err := metadata.WriteFile(filepath.Join(processDir, "starttime"), []byte(startTime), 0o600); err != nil {
+		return fmt.Errorf("failed to write starttime file: %w", err)
+	}
+	return nil
+}
+
+// MarkCancelled marks the process in processDir, which was claimed with ClaimQueued, as
+// completed without having run.
+func MarkCancelled(processDir string) error {
+	return Complete(processDir, metadata.File{Name: cancelledFile, Content: "true"})
+}
@@ -0,0 +1,98 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+)
+
+// samplesFile contains the usage samples of a running process, one line per sample with the
+// Unix time, the CPU usage in percent and the resident set size in bytes.
+const samplesFile = "usage-samples"
+
+// MaxSamples limits the samples of a process. When there are more, CompactSamples halves them,
+// so that the file of a long running process stays small.
+const MaxSamples = 480
+
+// Sample is the CPU and memory usage of a process and its descendants at a point in time.
+type Sample struct {
+	Time time.Time
+	CPU  float64 // Percent of one CPU core since the previous sample
+	RSS  int64   // Resident set size in bytes
+}
+
+func (s Sample) line() string {
+	return fmt.Sprintf("%d %.1f %d\n", s.Time.Unix(), s.CPU, s.RSS)
+}
+
+// AppendSample adds a sample to the usage-samples file of the process directory.
+func AppendSample(processDir string, s Sample) error {
+	f, err := os.OpenFile(filepath.Join(processDir, samplesFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s file: %w", samplesFile, err)
+	}
+	if _, err := f.WriteString(s.line()); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write %s file: %w", samplesFile, err)
+	}
+	return f.Close()
+}
+
+// WriteSamples replaces the usage-samples file of the process directory.
+func WriteSamples(processDir string, samples []Sample) error {
+	var b strings.Builder
+	for _, s := range samples {
+		b.WriteString(s.line())
+	}
+	if err := metadata.WriteFile(filepath.Join(processDir, samplesFile), []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s file: %w", samplesFile, err)
+	}
+	return nil
+}
+
+// ReadSamples reads the usage samples of the process directory, the oldest first. Invalid
+// lines are skipped. It returns nil if there are none.
+func ReadSamples(processDir string) []Sample {
+	f, err := os.Open(filepath.Join(processDir, samplesFile))
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+	var samples []Sample
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		unix, err1 := strconv.ParseInt(fields[0], 10, 64)
+		cpu, err2 := strconv.ParseFloat(fields[1], 64)
+		rss, err3 := strconv.ParseInt(fields[2], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		samples = append(samples, Sample{Time: time.Unix(unix, 0).UTC(), CPU: cpu, RSS: rss})
+	}
+	return samples
+}
+
+// CompactSamples merges each two neighbouring samples into one with the average CPU usage and
+// the bigger resident set size, so that peaks stay visible.
+func CompactSamples(samples []Sample) []Sample {
+	compacted := make([]Sample, 0, (len(samples)+1)/2)
+	for i := 0; i < len(samples); i += 2 {
+		if i+1 == len(samples) {
+			compacted = append(compacted, samples[i])
+			break
+		}
+		a, b := samples[i], samples[i+1]
+		compacted = append(compacted, Sample{Time: b.Time, CPU: (a.CPU + b.CPU) / 2, RSS: max(a.RSS, b.RSS)})
+	}
+	return compacted
+}
@@ -0,0 +1,33 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamples(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.Nil(t, ReadSamples(dir))
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	samples := []Sample{
+		{Time: start, CPU: 100, RSS: 10 << 20},
+		{Time: start.Add(5 * time.Second), CPU: 50, RSS: 30 << 20},
+		{Time: start.Add(10 * time.Second), CPU: 12.5, RSS: 20 << 20},
+	}
+	for _, s := range samples {
+		require.NoError(t, AppendSample(dir, s))
+	}
+	require.Equal(t, samples, ReadSamples(dir))
+
+	compacted := CompactSamples(samples)
+	require.Equal(t, []Sample{
+		{Time: start.Add(5 * time.Second), CPU: 75, RSS: 30 << 20},
+		samples[2],
+	}, compacted)
+	require.NoError(t, WriteSamples(dir, compacted))
+	require.Equal(t, compacted, ReadSamples(dir))
+}
@@ -0,0 +1,66 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"mobileshell/internal/metadata"
+)
+
+// tagsFile contains the tags of a process, one per line.
+const tagsFile = "tags"
+
+var tagRegex = regexp.MustCompile(`^[\p{L}\p{N}_.:/-]{1,32}$`)
+
+// ParseTags splits the user input at commas and whitespace. The tags are sorted and
+// deduplicated.
+func ParseTags(input string) ([]string, error) {
+	tags := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, tag := range tags {
+		if !tagRegex.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: use up to 32 letters, digits, '_', '.', ':', '/' and '-'", tag)
+		}
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags), nil
+}
+
+// ReadTags returns the tags of the process in processDir, nil if it has none.
+func ReadTags(processDir string) []string {
+	data, err := os.ReadFile(filepath.Join(processDir, tagsFile))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(data))
+}
+
+// SaveTags replaces the tags of the process. No tags remove the file.
+func SaveTags(p *Process, tags []string) error {
+	path := filepath.Join(p.ProcessDir, tagsFile)
+	if len(tags) == 0 {
+		if err := metadata.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove tags file: %w", err)
+		}
+	} else if err := metadata.WriteFile(path, []byte(strings.Join(tags, "\n")), 0o600); err != nil {
+		return fmt.Errorf("failed to write tags file: %w", err)
+	}
+	p.Tags = tags
+	return nil
+}
+
+// CollectTags returns the tags of all processes, sorted and deduplicated.
+func CollectTags(processes []*Process) []string {
+	var tags []string
+	for _, p := range processes {
+		tags = append(tags, p.Tags...)
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
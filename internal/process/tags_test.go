@@ -0,0 +1,44 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTags(t *testing.T) {
+	t.Parallel()
+	tags, err := ParseTags(" deploy, build  test\nbuild,,")
+	require.NoError(t, err)
+	require.Equal(t, []string{"build", "deploy", "test"}, tags)
+
+	tags, err = ParseTags("")
+	require.NoError(t, err)
+	require.Empty(t, tags)
+
+	_, err = ParseTags("ok <script>")
+	require.Error(t, err)
+}
+
+func TestSaveTags(t *testing.T) {
+	t.Parallel()
+	processDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "cmd"), []byte("true"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "starttime"), []byte("2025-01-07T10:00:00Z"), 0o600))
+	p, err := LoadProcessFromDir(processDir)
+	require.NoError(t, err)
+	require.Empty(t, p.Tags)
+
+	require.NoError(t, SaveTags(p, []string{"build", "release:1.2"}))
+	p, err = LoadProcessFromDir(processDir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"build", "release:1.2"}, p.Tags)
+	require.Equal(t, []string{"build", "release:1.2", "test"}, CollectTags([]*Process{p, {Tags: []string{"test", "build"}}}))
+
+	require.NoError(t, SaveTags(p, nil))
+	p, err = LoadProcessFromDir(processDir)
+	require.NoError(t, err)
+	require.Empty(t, p.Tags)
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+)
+
+// Files of the resource usage in the process directory.
+const (
+	usageMaxRSSFile     = "usage-max-rss"
+	usageUserTimeFile   = "usage-user-time"
+	usageSystemTimeFile = "usage-system-time"
+	usageBlockInFile    = "usage-block-in"
+	usageBlockOutFile   = "usage-block-out"
+)
+
+// Usage is the resource usage of a completed process, like getrusage(2) reports it. nohup
+// writes it when the process completed, see WriteUsage. Values which the platform doesn't
+// report are zero.
+type Usage struct {
+	MaxRSS     int64         // Maximum resident set size in bytes
+	UserTime   time.Duration // CPU time in user mode
+	SystemTime time.Duration // CPU time in kernel mode
+	BlockIn    int64         // Block input operations
+	BlockOut   int64         // Block output operations
+}
+
+// CPU returns the CPU time in user and kernel mode.
+func (u Usage) CPU() time.Duration {
+	return u.UserTime + u.SystemTime
+}
+
+// String describes the usage, like "CPU 1.2s (user 1s, system 200ms), max RSS 12 MiB".
+func (u Usage) String() string {
+	parts := []string{fmt.Sprintf("CPU %s (user %s, system %s)", u.CPU().Round(time.Millisecond), u.UserTime.Round(time.Millisecond), u.SystemTime.Round(time.Millisecond))}
+	if u.MaxRSS > 0 {
+		parts = append(parts, fmt.Sprintf("max RSS %d MiB", u.MaxRSS>>20))
+	}
+	if u.BlockIn > 0 || u.BlockOut > 0 {
+		parts = append(parts, fmt.Sprintf("block IO %d in, %d out", u.BlockIn, u.BlockOut))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WriteUsage stores the resource usage in the process directory.
+func WriteUsage(processDir string, u Usage) error {
+	files := map[string]string{
+		usageMaxRSSFile:     strconv.FormatInt(u.MaxRSS, 10),
+		usageUserTimeFile:   u.UserTime.String(),
+		usageSystemTimeFile: u.SystemTime.String(),
+		usageBlockInFile:    strconv.FormatInt(u.BlockIn, 10),
+		usageBlockOutFile:   strconv.FormatInt(u.BlockOut, 10),
+	}
+	for name, content := range files {
+		if err := metadata.WriteFile(filepath.Join(processDir, name), []byte(content), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s file: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ReadUsage reads the resource usage of the process directory. It returns nil if nohup did
+// not write it, for example for running processes. Invalid values are zero.
+func ReadUsage(processDir string) *Usage {
+	data, err := os.ReadFile(filepath.Join(processDir, usageUserTimeFile))
+	if err != nil {
+		return nil
+	}
+	u := &Usage{}
+	u.UserTime, _ = time.ParseDuration(string(data))
+	if data, err := os.ReadFile(filepath.Join(processDir, usageSystemTimeFile)); err == nil {
+		u.SystemTime, _ = time.ParseDuration(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(processDir, usageMaxRSSFile)); err == nil {
+		u.MaxRSS, _ = strconv.ParseInt(string(data), 10, 64)
+	}
+	if data, err := os.ReadFile(filepath.Join(processDir, usageBlockInFile)); err == nil {
+		u.BlockIn, _ = strconv.ParseInt(string(data), 10, 64)
+	}
+	if data, err := os.ReadFile(filepath.Join(processDir, usageBlockOutFile)); err == nil {
+		u.BlockOut, _ = strconv.ParseInt(string(data), 10, 64)
+	}
+	return u
+}
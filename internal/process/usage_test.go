@@ -0,0 +1,22 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteReadUsage(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.Nil(t, ReadUsage(dir))
+
+	u := Usage{MaxRSS: 12 << 20, UserTime: time.Second, SystemTime: 200 * time.Millisecond, BlockIn: 3, BlockOut: 4}
+	require.NoError(t, WriteUsage(dir, u))
+	loaded := ReadUsage(dir)
+	require.NotNil(t, loaded)
+	require.Equal(t, u, *loaded)
+	require.Equal(t, 1200*time.Millisecond, loaded.CPU())
+	require.Equal(t, "CPU 1.2s (user 1s, system 200ms), max RSS 12 MiB, block IO 3 in, 4 out", loaded.String())
+}
@@ -0,0 +1,188 @@
+// Package remote runs commands on a MobileShell server with its API, for `mobileshell exec`
+// and `mobileshell logs`.
+// It authenticates with an API token, see auth.AddAPIToken.
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// outputTimeout is how long the server waits for new output before it answers a request of
+// the output, see the server package.
+const outputTimeout = "30s"
+
+// Client runs commands on a server.
+type Client struct {
+	URL        string // Base URL of the server, for example "https://example.com/shell"
+	Token      string // API token of the server
+	HTTPClient *http.Client
+}
+
+// ExecOptions describes the command of Exec.
+type ExecOptions struct {
+	Workspace         string // ID of the workspace in which the command runs
+	Command           string
+	ConfirmProduction bool // Needed to run the command in a production workspace
+}
+
+// execResult is the response of the server to a started command.
+type execResult struct {
+	ID string `json:"id"`
+}
+
+// outputResult is the response of the server to a request of the output.
+type outputResult struct {
+	Chunks []struct {
+		Stream string `json:"stream"`
+		Text   string `json:"text"`
+	} `json:"chunks"`
+	Offset    int64 `json:"offset"`
+	Completed bool  `json:"completed"`
+	ExitCode  *int  `json:"exit_code"`
+}
+
+// Exec starts the command on the server and copies its stdout and stderr to stdout and
+// stderr, until it finished. It returns the exit code of the command. If ctx gets
+// cancelled, the command keeps running on the server.
+func (c *Client) Exec(ctx context.Context, opts ExecOptions, stdout, stderr io.Writer) (int, error) {
+	form := url.Values{"command": {opts.Command}}
+	if opts.ConfirmProduction {
+		form.Set("confirm_production", "true")
+	}
+	var started execResult
+	route := "/api/v1/workspaces/" + url.PathEscape(opts.Workspace) + "/processes"
+	if err := c.do(ctx, http.MethodPost, route, nil, form, &started); err != nil {
+		return 0, fmt.Errorf("failed to start command: %w", err)
+	}
+
+	result, err := c.copyOutput(ctx, opts.Workspace, started.ID, "", true, stdout, stderr)
+	if err != nil {
+		return 0, err
+	}
+	if result.ExitCode == nil {
+		return 0, fmt.Errorf("process %s completed without exit code", started.ID)
+	}
+	return *result.ExitCode, nil
+}
+
+// LogsOptions describes the output of Logs.
+type LogsOptions struct {
+	Workspace string // ID of the workspace of the process
+	Process   string // ID of the process
+	Stream    string // Only this stream, by default stdout and stderr
+	Follow    bool   // Wait for new output until the process finished
+}
+
+// Logs copies the output of a process to stdout, and its stderr to stderr. Without
+// opts.Follow it returns after the output which was written so far.
+func (c *Client) Logs(ctx context.Context, opts LogsOptions, stdout, stderr io.Writer) error {
+	_, err := c.copyOutput(ctx, opts.Workspace, opts.Process, opts.Stream, opts.Follow, stdout, stderr)
+	return err
+}
+
+// copyOutput copies the output of the process to stdout and stderr, until the process
+// completed, or if follow is false, until there is no more output. An empty stream means
+// stdout and stderr. It returns the last response of the server.
+func (c *Client) copyOutput(ctx context.Context, workspaceID, processID, stream string, follow bool, stdout, stderr io.Writer) (*outputResult, error) {
+	timeout := outputTimeout
+	if !follow {
+		timeout = "0s"
+	}
+	var offset int64
+	for {
+		var result outputResult
+		query := url.Values{"workspace": {workspaceID}, "offset": {fmt.Sprint(offset)}, "timeout": {timeout}}
+		if stream != "" {
+			query.Set("stream", stream)
+		}
+		if err := c.do(ctx, http.MethodGet, "/api/v1/processes/"+url.PathEscape(processID)+"/output", query, nil, &result); err != nil {
+			return nil, fmt.Errorf("failed to read output of process %s: %w", processID, err)
+		}
+		for _, chunk := range result.Chunks {
+			w := stdout
+			if chunk.Stream == "stderr" {
+				w = stderr
+			}
+			if _, err := io.WriteString(w, chunk.Text); err != nil {
+				return nil, err
+			}
+		}
+		if result.Completed || (!follow && result.Offset == offset) {
+			return &result, nil
+		}
+		offset = result.Offset
+	}
+}
+
+// do sends a request to a route of the server and decodes the JSON response into v. The
+// form gets sent as body.
+func (c *Client) do(ctx context.Context, method, route string, query, form url.Values, v any) error {
+	u := strings.TrimSuffix(c.URL, "/") + route
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Error pages are HTML, only plain text messages are useful in the terminal
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+			return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// JoinCommand returns the command line of args. A single argument is the command line, like
+// "make build && make test". Several arguments get quoted for the shell, so that
+// "grep", "a b", "file" keeps "a b" as one argument.
+func JoinCommand(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes s for a POSIX shell, unless it only contains safe characters.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,64 @@
+package remote
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"mobileshell/internal/auth"
+	"mobileshell/internal/executor"
+	"mobileshell/internal/server"
+	"mobileshell/internal/workspace"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExec(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, auth.InitAuth(stateDir))
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "remote-ws", t.TempDir(), "")
+	require.NoError(t, err)
+	srv, err := server.New(stateDir, false)
+	require.NoError(t, err)
+	srv.EnableDemo()
+	httpServer := httptest.NewServer(srv.SetupRoutes())
+	t.Cleanup(httpServer.Close)
+	token, err := auth.AddAPIToken(stateDir, "")
+	require.NoError(t, err)
+
+	client := &Client{URL: httpServer.URL, Token: token}
+	var stdout, stderr bytes.Buffer
+	code, err := client.Exec(t.Context(), ExecOptions{Workspace: ws.ID, Command: "make test"}, &stdout, &stderr)
+	require.NoError(t, err)
+	require.Equal(t, 0, code)
+	require.Equal(t, "Demo mode: the command was not executed.\n", stdout.String())
+	require.Empty(t, stderr.String())
+
+	processes, err := workspace.ListProcesses(ws)
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+	stdout.Reset()
+	err = client.Logs(t.Context(), LogsOptions{Workspace: ws.ID, Process: processes[0].CommandId}, &stdout, &stderr)
+	require.NoError(t, err)
+	require.Equal(t, "Demo mode: the command was not executed.\n", stdout.String())
+	stdout.Reset()
+	err = client.Logs(t.Context(), LogsOptions{Process: processes[0].CommandId, Stream: "stderr", Follow: true}, &stdout, &stderr)
+	require.NoError(t, err)
+	require.Empty(t, stdout.String())
+
+	_, err = client.Exec(t.Context(), ExecOptions{Workspace: "missing", Command: "make test"}, &stdout, &stderr)
+	require.ErrorContains(t, err, "404 Not Found: Workspace not found")
+
+	client.Token = "wrong"
+	_, err = client.Exec(t.Context(), ExecOptions{Workspace: ws.ID, Command: "make test"}, &stdout, &stderr)
+	require.ErrorContains(t, err, "401 Unauthorized: Invalid API token")
+}
+
+func TestJoinCommand(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "make build && make test", JoinCommand([]string{"make build && make test"}))
+	require.Equal(t, "grep -r 'a b' ./src", JoinCommand([]string{"grep", "-r", "a b", "./src"}))
+	require.Equal(t, `echo 'it'\''s' ''`, JoinCommand([]string{"echo", "it's", ""}))
+}
@@ -0,0 +1,218 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"mobileshell/pkg/outputlog"
+)
+
+// sinceFile stores the time of the primary at the last sync in the state directory of the
+// standby, so that a restarted standby continues where it stopped.
+const sinceFile = "replication-since"
+
+// Routes of the primary, see the server package.
+const (
+	ManifestPath = "/replication/json-manifest"
+	FilePath     = "/replication/file"
+)
+
+// Client replicates the workspaces of a primary to the state directory of the standby.
+type Client struct {
+	URL        string // Base URL of the primary, for example "https://primary.example.com/shell"
+	Token      string // Replication token of the primary
+	StateDir   string // State directory of the standby
+	HTTPClient *http.Client
+}
+
+// SyncStats reports what a sync transferred.
+type SyncStats struct {
+	Files int
+	Bytes int64
+}
+
+// Run syncs every interval until ctx gets cancelled. Failed syncs get logged and retried.
+func (c *Client) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		stats, err := c.Sync(ctx)
+		if err != nil {
+			slog.Error("Replication failed", "primary", c.URL, "error", err)
+		} else if stats.Files > 0 {
+			slog.Info("Replicated changes", "primary", c.URL, "files", stats.Files, "bytes", stats.Bytes)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Sync downloads the files which changed on the primary since the last sync.
+func (c *Client) Sync(ctx context.Context) (SyncStats, error) {
+	var stats SyncStats
+	since := c.readSince()
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", since.Add(-overlap).Format(time.RFC3339Nano))
+	}
+	data, err := c.get(ctx, ManifestPath, query)
+	if err != nil {
+		return stats, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return stats, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	for _, file := range manifest.Files {
+		n, err := c.syncFile(ctx, file)
+		if err != nil {
+			return stats, fmt.Errorf("%s: %w", file.Path, err)
+		}
+		if n > 0 {
+			stats.Files++
+			stats.Bytes += n
+		}
+	}
+	return stats, os.WriteFile(filepath.Join(c.StateDir, sinceFile), []byte(manifest.Now.Format(time.RFC3339Nano)), 0o600)
+}
+
+func (c *Client) readSince() time.Time {
+	data, err := os.ReadFile(filepath.Join(c.StateDir, sinceFile))
+	if err != nil {
+		return time.Time{}
+	}
+	since, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}
+	}
+	return since
+}
+
+// syncFile downloads a file of the manifest and returns the number of downloaded bytes. An
+// append-only file which is shorter on the standby, and has the same head, only gets its missing
+// bytes, other files get replaced atomically.
+func (c *Client) syncFile(ctx context.Context, file File) (int64, error) {
+	filePath, err := localPath(c.StateDir, file.Path)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o700); err != nil {
+		return 0, err
+	}
+
+	target := filePath + ".tmp"
+	var offset int64
+	if info, err := os.Stat(filePath); err == nil && appendOnly(filePath) && info.Size() <= file.Size && sameHead(filePath, file) {
+		if info.Size() == file.Size {
+			return 0, nil
+		}
+		target = filePath
+		offset = info.Size()
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if target == filePath {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	dst, err := os.OpenFile(target, flags, 0o600)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := c.download(ctx, file, offset, dst)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if target == filePath {
+		return n, err
+	}
+	if err == nil {
+		err = os.Rename(target, filePath)
+	}
+	if err != nil {
+		_ = os.Remove(target)
+		return 0, err
+	}
+	if uncompressed, ok := strings.CutSuffix(filePath, outputlog.GzipSuffix); ok {
+		// The primary compressed the log of a completed process
+		_ = os.Remove(uncompressed)
+	}
+	return n, nil
+}
+
+// sameHead returns true if the local file has the head of the file of the manifest. Primaries
+// without heads in the manifest are trusted.
+func sameHead(filePath string, file File) bool {
+	if file.Head == "" {
+		return true
+	}
+	head, err := headHash(filePath)
+	return err == nil && head == file.Head
+}
+
+// download writes the bytes of file from offset up to its size in the manifest to dst. A file
+// which was deleted or truncated on the primary in the meantime is not an error, the next
+// sync gets its current state.
+func (c *Client) download(ctx context.Context, file File, offset int64, dst io.Writer) (int64, error) {
+	var n int64
+	for offset+n < file.Size {
+		data, err := c.get(ctx, FilePath, url.Values{"path": {file.Path}, "offset": {strconv.FormatInt(offset+n, 10)}})
+		if errors.Is(err, os.ErrNotExist) || (err == nil && len(data) == 0) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if _, err := dst.Write(data); err != nil {
+			return n, err
+		}
+		n += int64(len(data))
+	}
+	return n, nil
+}
+
+// get requests a route of the primary. A 404 response is returned as os.ErrNotExist.
+func (c *Client) get(ctx context.Context, route string, query url.Values) ([]byte, error) {
+	u := strings.TrimSuffix(c.URL, "/") + route
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return data, nil
+	case http.StatusNotFound:
+		return nil, os.ErrNotExist
+	default:
+		return nil, fmt.Errorf("%s: %s: %s", route, resp.Status, strings.TrimSpace(string(data)))
+	}
+}
@@ -0,0 +1,164 @@
+// Package replication copies the workspaces of a primary mobileshell instance to a warm
+// standby, so that a failover box has near-current processes, output and command history.
+//
+// The standby polls the primary. The primary lists the files of its workspaces directory which
+// changed since the last poll (see ReadManifest), and the standby downloads them (see
+// ReadFile). Output logs only get appended to, so only their new bytes are transferred, unless
+// the retention policy truncated them from the front, which File.Head detects. Both requests
+// are authenticated with a replication token (see auth.AddReplicationToken).
+//
+// Deleted files are not replicated, and the standby must not run the server on the replicated
+// state directory while replication runs, because it would mark the processes of the primary
+// as orphaned.
+package replication
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mobileshell/pkg/outputlog"
+)
+
+// workspacesDir is the directory of the state directory which gets replicated.
+const workspacesDir = "workspaces"
+
+// MaxTransferSize limits the bytes of a file which ReadFile returns at once. Clients request
+// the rest with the next offset.
+const MaxTransferSize = 8 << 20
+
+// overlap is subtracted from the time of the last sync, because the modification times of
+// some file systems have a coarse granularity.
+const overlap = 2 * time.Second
+
+// headSize is the number of bytes at the start of an append-only file which File.Head hashes.
+const headSize = 4096
+
+// File is a file of the workspaces directory.
+type File struct {
+	Path    string    `json:"path"` // Relative to the state directory, with slashes
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+
+	// Head is the hash of the start of an append-only file, see headHash. If the head of the
+	// copy of the standby differs, the file was rewritten, for example by
+	// outputlog.TruncateFront, and gets downloaded again.
+	Head string `json:"head,omitempty"`
+}
+
+// Manifest lists the files which changed since a time.
+type Manifest struct {
+	Now   time.Time `json:"now"` // Time of the primary, pass it as since to the next request
+	Files []File    `json:"files"`
+}
+
+// ReadManifest lists the regular files of the workspaces directory of stateDir which were
+// modified at or after since. A zero since lists all files.
+func ReadManifest(stateDir string, since time.Time) (Manifest, error) {
+	manifest := Manifest{Now: time.Now().UTC(), Files: []File{}}
+	root := filepath.Join(stateDir, workspacesDir)
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if filePath == root && os.IsNotExist(err) {
+				return fs.SkipDir
+			}
+			// A process directory can be deleted while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		// Hidden directories are workspaces which are being created
+		if entry.IsDir() && filePath != root && strings.HasPrefix(entry.Name(), ".") {
+			return fs.SkipDir
+		}
+		if !entry.Type().IsRegular() || strings.HasSuffix(entry.Name(), ".tmp") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().Before(since) {
+			return nil
+		}
+		rel, err := filepath.Rel(stateDir, filePath)
+		if err != nil {
+			return err
+		}
+		file := File{Path: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime().UTC()}
+		if appendOnly(filePath) {
+			// The file can be replaced while walking, the standby then gets it with the next sync
+			if file.Head, err = headHash(filePath); err != nil {
+				return nil
+			}
+		}
+		manifest.Files = append(manifest.Files, file)
+		return nil
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+	return manifest, nil
+}
+
+// localPath returns the path of the file relPath of a manifest in stateDir. Only files in the
+// workspaces directory are allowed.
+func localPath(stateDir, relPath string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(relPath)) || !strings.HasPrefix(path.Clean(relPath), workspacesDir+"/") {
+		return "", fmt.Errorf("invalid path %q", relPath)
+	}
+	return filepath.Join(stateDir, filepath.FromSlash(relPath)), nil
+}
+
+// ReadFile reads at most MaxTransferSize bytes of the file relPath of the workspaces directory,
+// starting at offset.
+func ReadFile(stateDir, relPath string, offset int64) ([]byte, error) {
+	filePath, err := localPath(stateDir, relPath)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid offset %d", offset)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.LimitReader(file, MaxTransferSize))
+}
+
+// appendOnly returns true for files which only get appended to, so that the standby only needs
+// to download their new bytes.
+func appendOnly(filePath string) bool {
+	name := filepath.Base(filePath)
+	return name == "output.log" || name == "output.log"+outputlog.IndexSuffix
+}
+
+// headHash returns the hex encoded SHA-256 hash of the first headSize bytes of the file. The
+// chunks of output logs have timestamps, so a log which was truncated from the front has another
+// head. Files shorter than headSize have another head with every append, the standby downloads
+// them completely until they are longer.
+func headHash(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.LimitReader(file, headSize)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
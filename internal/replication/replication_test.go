@@ -0,0 +1,58 @@
+package replication
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadManifest(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	manifest, err := ReadManifest(stateDir, time.Time{})
+	require.NoError(t, err)
+	require.Empty(t, manifest.Files)
+
+	processDir := filepath.Join(stateDir, "workspaces", "ws", "processes", "p")
+	require.NoError(t, os.MkdirAll(processDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), []byte("output"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "cmd"), []byte("ls"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "session-secret"), []byte("secret"), 0o600))
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(processDir, "cmd"), old, old))
+
+	manifest, err = ReadManifest(stateDir, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, manifest.Files, 2)
+
+	manifest, err = ReadManifest(stateDir, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.Len(t, manifest.Files, 1)
+	require.Equal(t, "workspaces/ws/processes/p/output.log", manifest.Files[0].Path)
+	require.Equal(t, int64(6), manifest.Files[0].Size)
+	head, err := headHash(filepath.Join(processDir, "output.log"))
+	require.NoError(t, err)
+	require.Equal(t, head, manifest.Files[0].Head)
+}
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(stateDir, "workspaces", "ws"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "workspaces", "ws", "command-history"), []byte("ls\npwd\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "session-secret"), []byte("secret"), 0o600))
+
+	data, err := ReadFile(stateDir, "workspaces/ws/command-history", 3)
+	require.NoError(t, err)
+	require.Equal(t, "pwd\n", string(data))
+
+	_, err = ReadFile(stateDir, "session-secret", 0)
+	require.Error(t, err)
+	_, err = ReadFile(stateDir, "workspaces/../session-secret", 0)
+	require.Error(t, err)
+	_, err = ReadFile(stateDir, "workspaces/ws/missing", 0)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
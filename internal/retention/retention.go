@@ -0,0 +1,216 @@
+// Package retention prunes old process directories of a workspace, so that the processes
+// directory does not grow forever. Only finished processes are touched.
+package retention
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+	"mobileshell/pkg/outputlog"
+)
+
+// Policy limits the finished processes of a workspace. Zero values mean "unlimited".
+type Policy struct {
+	MaxAgeDays int   // Delete processes which ended more than MaxAgeDays ago
+	MaxCount   int   // Keep at most MaxCount finished processes
+	MaxBytes   int64 // Keep at most MaxBytes of uncompressed output.log data
+}
+
+// IsZero returns true if the policy does not limit anything.
+func (p Policy) IsZero() bool {
+	return p.MaxAgeDays == 0 && p.MaxCount == 0 && p.MaxBytes == 0
+}
+
+const (
+	maxAgeDaysFile = "retention-max-age-days"
+	maxCountFile   = "retention-max-count"
+	maxBytesFile   = "retention-max-bytes"
+
+	// logFile records what was pruned. It is stored in the workspace directory.
+	logFile = "retention.log"
+)
+
+// LoadPolicy reads the retention policy of the workspace. Missing files mean "unlimited".
+func LoadPolicy(ws *workspace.Workspace) (Policy, error) {
+	var policy Policy
+	maxAgeDays, err := readInt(filepath.Join(ws.Path, maxAgeDaysFile))
+	if err != nil {
+		return policy, err
+	}
+	maxCount, err := readInt(filepath.Join(ws.Path, maxCountFile))
+	if err != nil {
+		return policy, err
+	}
+	maxBytes, err := readInt(filepath.Join(ws.Path, maxBytesFile))
+	if err != nil {
+		return policy, err
+	}
+	policy.MaxAgeDays = int(maxAgeDays)
+	policy.MaxCount = int(maxCount)
+	policy.MaxBytes = maxBytes
+	return policy, nil
+}
+
+// SavePolicy writes the retention policy of the workspace as individual files. Unlimited
+// values remove the corresponding file.
+func SavePolicy(ws *workspace.Workspace, policy Policy) error {
+	if policy.MaxAgeDays < 0 || policy.MaxCount < 0 || policy.MaxBytes < 0 {
+		return fmt.Errorf("retention limits must not be negative")
+	}
+	if err := writeInt(filepath.Join(ws.Path, maxAgeDaysFile), int64(policy.MaxAgeDays)); err != nil {
+		return err
+	}
+	if err := writeInt(filepath.Join(ws.Path, maxCountFile), int64(policy.MaxCount)); err != nil {
+		return err
+	}
+	return writeInt(filepath.Join(ws.Path, maxBytesFile), policy.MaxBytes)
+}
+
+func readInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	return value, nil
+}
+
+func writeInt(path string, value int64) error {
+	if value == 0 {
+		return metadata.Remove(path)
+	}
+	if err := metadata.WriteFile(path, []byte(strconv.FormatInt(value, 10)), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// ApplyAll applies the retention policy of every workspace in the state directory. Workspaces
+// without a policy of their own get defaultPolicy.
+func ApplyAll(stateDir string, defaultPolicy Policy) {
+	workspaces, err := workspace.ListWorkspaces(stateDir)
+	if err != nil {
+		slog.Error("Retention: failed to list workspaces", "error", err)
+		return
+	}
+	for _, ws := range workspaces {
+		policy, err := LoadPolicy(ws)
+		if err != nil {
+			slog.Error("Retention: failed to load policy", "workspace", ws.ID, "error", err)
+			continue
+		}
+		if policy.IsZero() {
+			policy = defaultPolicy
+		}
+		if err := Apply(ws, policy, time.Now().UTC()); err != nil {
+			slog.Error("Retention: failed to apply policy", "workspace", ws.ID, "error", err)
+		}
+	}
+}
+
+// Apply prunes the finished processes of the workspace according to policy. Every deletion
+// and truncation gets appended to the retention.log file of the workspace.
+func Apply(ws *workspace.Workspace, policy Policy, now time.Time) error {
+	if policy.IsZero() {
+		return nil
+	}
+	processes, err := workspace.ListProcesses(ws)
+	if err != nil {
+		return err
+	}
+
+	// Newest first, so that the oldest processes get pruned.
+	var finished []*process.Process
+	for _, proc := range processes {
+		if proc.Completed {
+			finished = append(finished, proc)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].FinishedAt().After(finished[j].FinishedAt())
+	})
+
+	var totalBytes int64
+	for i, proc := range finished {
+		reason := ""
+		switch {
+		case policy.MaxAgeDays > 0 && proc.FinishedAt().Before(now.AddDate(0, 0, -policy.MaxAgeDays)):
+			reason = fmt.Sprintf("older than %d days", policy.MaxAgeDays)
+		case policy.MaxCount > 0 && i >= policy.MaxCount:
+			reason = fmt.Sprintf("more than %d finished processes", policy.MaxCount)
+		}
+
+		if reason == "" && policy.MaxBytes > 0 {
+			size, err := outputSize(proc)
+			if err != nil {
+				return err
+			}
+			if size > policy.MaxBytes {
+				removed, err := outputlog.TruncateFront(proc.OutputFile, policy.MaxBytes)
+				if err != nil {
+					return err
+				}
+				if err := record(ws, now, "truncated", proc.CommandId, fmt.Sprintf("removed %d bytes of output", removed)); err != nil {
+					return err
+				}
+				size, err = outputSize(proc)
+				if err != nil {
+					return err
+				}
+			}
+			if totalBytes+size > policy.MaxBytes {
+				reason = fmt.Sprintf("output of finished processes exceeds %d bytes", policy.MaxBytes)
+			} else {
+				totalBytes += size
+			}
+		}
+
+		if reason == "" {
+			continue
+		}
+		if err := workspace.DeleteProcess(ws, proc.CommandId); err != nil {
+			return err
+		}
+		if err := record(ws, now, "deleted", proc.CommandId, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputSize returns the uncompressed size of output.log, like outputlog.TruncateFront
+// measures it. Compressed logs count with their uncompressed size, too.
+func outputSize(proc *process.Process) (int64, error) {
+	size, err := outputlog.Size(proc.OutputFile)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return size, err
+}
+
+// record appends one line to the retention log of the workspace.
+func record(ws *workspace.Workspace, now time.Time, action, commandId, detail string) error {
+	slog.Info("Retention", "workspace", ws.ID, "action", action, "process", commandId, "detail", detail)
+	file, err := os.OpenFile(filepath.Join(ws.Path, logFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open retention log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	_, err = fmt.Fprintf(file, "%s %s %s: %s\n", now.UTC().Format(outputlog.TimeFormatRFC3339NanoUTC), action, commandId, detail)
+	return err
+}
@@ -0,0 +1,181 @@
+package retention
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"mobileshell/internal/workspace"
+	"mobileshell/pkg/outputlog"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeFinishedProcess creates the directory of a finished process with outputBytes of stdout.
+func writeFinishedProcess(t *testing.T, ws *workspace.Workspace, commandId string, endTime time.Time, outputBytes int) string {
+	t.Helper()
+	processDir := workspace.GetProcessDir(ws, commandId)
+	require.NoError(t, os.MkdirAll(processDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "cmd"), []byte("ls"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "starttime"), []byte(endTime.Add(-time.Second).Format(time.RFC3339Nano)), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "endtime"), []byte(endTime.Format(time.RFC3339Nano)), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "completed"), []byte("true"), 0o600))
+	output := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: endTime, Line: bytes.Repeat([]byte("x"), outputBytes)})
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), output, 0o600))
+	return processDir
+}
+
+func createTestWorkspace(t *testing.T, name string) *workspace.Workspace {
+	t.Helper()
+	ws, err := workspace.CreateWorkspace(t.TempDir(), name, t.TempDir(), "")
+	require.NoError(t, err)
+	return ws
+}
+
+func TestPolicy_SaveAndLoad(t *testing.T) {
+	t.Parallel()
+	ws := createTestWorkspace(t, "policy")
+
+	policy, err := LoadPolicy(ws)
+	require.NoError(t, err)
+	require.True(t, policy.IsZero())
+
+	require.NoError(t, SavePolicy(ws, Policy{MaxAgeDays: 30, MaxCount: 100, MaxBytes: 1 << 20}))
+	policy, err = LoadPolicy(ws)
+	require.NoError(t, err)
+	require.Equal(t, Policy{MaxAgeDays: 30, MaxCount: 100, MaxBytes: 1 << 20}, policy)
+
+	require.NoError(t, SavePolicy(ws, Policy{MaxCount: 5}))
+	policy, err = LoadPolicy(ws)
+	require.NoError(t, err)
+	require.Equal(t, Policy{MaxCount: 5}, policy)
+	require.NoFileExists(t, filepath.Join(ws.Path, maxAgeDaysFile))
+
+	require.Error(t, SavePolicy(ws, Policy{MaxCount: -1}))
+}
+
+func TestApply_MaxAge(t *testing.T) {
+	t.Parallel()
+	ws := createTestWorkspace(t, "max-age")
+	now := time.Now().UTC()
+	oldDir := writeFinishedProcess(t, ws, "2025-01-01T00:00:00Z", now.AddDate(0, 0, -31), 10)
+	newDir := writeFinishedProcess(t, ws, "2025-01-02T00:00:00Z", now.AddDate(0, 0, -1), 10)
+
+	require.NoError(t, Apply(ws, Policy{MaxAgeDays: 30}, now))
+
+	require.NoDirExists(t, oldDir)
+	require.DirExists(t, newDir)
+	log, err := os.ReadFile(filepath.Join(ws.Path, logFile))
+	require.NoError(t, err)
+	require.Contains(t, string(log), "deleted 2025-01-01T00:00:00Z: older than 30 days")
+}
+
+func TestApply_MaxCount(t *testing.T) {
+	t.Parallel()
+	ws := createTestWorkspace(t, "max-count")
+	now := time.Now().UTC()
+	oldestDir := writeFinishedProcess(t, ws, "2025-01-01T00:00:00Z", now.Add(-3*time.Hour), 10)
+	middleDir := writeFinishedProcess(t, ws, "2025-01-02T00:00:00Z", now.Add(-2*time.Hour), 10)
+	newestDir := writeFinishedProcess(t, ws, "2025-01-03T00:00:00Z", now.Add(-1*time.Hour), 10)
+
+	require.NoError(t, Apply(ws, Policy{MaxCount: 2}, now))
+
+	require.NoDirExists(t, oldestDir)
+	require.DirExists(t, middleDir)
+	require.DirExists(t, newestDir)
+}
+
+func TestApply_MaxBytes(t *testing.T) {
+	t.Parallel()
+	ws := createTestWorkspace(t, "max-bytes")
+	now := time.Now().UTC()
+	oldDir := writeFinishedProcess(t, ws, "2025-01-01T00:00:00Z", now.Add(-2*time.Hour), 600)
+	newDir := writeFinishedProcess(t, ws, "2025-01-02T00:00:00Z", now.Add(-1*time.Hour), 600)
+
+	require.NoError(t, Apply(ws, Policy{MaxBytes: 1000}, now))
+
+	require.NoDirExists(t, oldDir)
+	require.DirExists(t, newDir)
+}
+
+func TestApply_TruncatesGiantOutput(t *testing.T) {
+	t.Parallel()
+	ws := createTestWorkspace(t, "truncate")
+	now := time.Now().UTC()
+	processDir := workspace.GetProcessDir(ws, "2025-01-01T00:00:00Z")
+	writeFinishedProcess(t, ws, "2025-01-01T00:00:00Z", now, 10)
+	var output []byte
+	for i := range 100 {
+		output = append(output, outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: now, Line: []byte(strconv.Itoa(i) + "\n")})...)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), output, 0o600))
+
+	require.NoError(t, Apply(ws, Policy{MaxBytes: 1000}, now))
+
+	info, err := os.Stat(filepath.Join(processDir, "output.log"))
+	require.NoError(t, err)
+	require.LessOrEqual(t, info.Size(), int64(1000))
+	log, err := os.ReadFile(filepath.Join(ws.Path, logFile))
+	require.NoError(t, err)
+	require.Contains(t, string(log), "truncated 2025-01-01T00:00:00Z")
+}
+
+func TestApply_CompressedOutput(t *testing.T) {
+	t.Parallel()
+	ws := createTestWorkspace(t, "compressed")
+	now := time.Now().UTC()
+	processDir := writeFinishedProcess(t, ws, "2025-01-01T00:00:00Z", now, 10)
+	// The compressed log is smaller than the limit, the uncompressed one is not
+	output := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: now, Line: bytes.Repeat([]byte("x\n"), 1000)})
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), output, 0o600))
+	require.NoError(t, outputlog.Compress(filepath.Join(processDir, "output.log")))
+
+	require.NoError(t, Apply(ws, Policy{MaxBytes: 1000}, now))
+
+	require.DirExists(t, processDir)
+	require.NoFileExists(t, filepath.Join(processDir, "output.log"))
+	size, err := outputlog.Size(filepath.Join(processDir, "output.log"))
+	require.NoError(t, err)
+	require.LessOrEqual(t, size, int64(1000))
+}
+
+func TestApply_KeepsRunningProcesses(t *testing.T) {
+	t.Parallel()
+	ws := createTestWorkspace(t, "running")
+	now := time.Now().UTC()
+	processDir := writeFinishedProcess(t, ws, "2025-01-01T00:00:00Z", now.AddDate(0, 0, -100), 10)
+	// A running process has no end time yet
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "completed"), []byte("false"), 0o600))
+	require.NoError(t, os.Remove(filepath.Join(processDir, "endtime")))
+
+	require.NoError(t, Apply(ws, Policy{MaxAgeDays: 1, MaxCount: 1, MaxBytes: 1}, now))
+
+	require.DirExists(t, processDir)
+}
+
+func TestApplyAll_DefaultPolicy(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(stateDir))
+	own, err := workspace.CreateWorkspace(stateDir, "own", t.TempDir(), "")
+	require.NoError(t, err)
+	require.NoError(t, SavePolicy(own, Policy{MaxCount: 2}))
+	other, err := workspace.CreateWorkspace(stateDir, "other", t.TempDir(), "")
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	ownOldest := writeFinishedProcess(t, own, "2025-01-01T00:00:00Z", now.Add(-2*time.Hour), 10)
+	ownNewest := writeFinishedProcess(t, own, "2025-01-02T00:00:00Z", now.Add(-1*time.Hour), 10)
+	otherOldest := writeFinishedProcess(t, other, "2025-01-01T00:00:00Z", now.Add(-2*time.Hour), 10)
+	otherNewest := writeFinishedProcess(t, other, "2025-01-02T00:00:00Z", now.Add(-1*time.Hour), 10)
+
+	ApplyAll(stateDir, Policy{MaxCount: 1})
+
+	// The policy of the workspace wins over the default
+	require.DirExists(t, ownOldest)
+	require.DirExists(t, ownNewest)
+	require.NoDirExists(t, otherOldest)
+	require.DirExists(t, otherNewest)
+}
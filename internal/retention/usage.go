@@ -0,0 +1,218 @@
+package retention
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+	"mobileshell/internal/workspace"
+)
+
+// usageCacheFile caches the sizes of finished processes in the workspace directory, see Usage.
+const usageCacheFile = "storage-usage.json"
+
+// ProcessUsage is the disk usage of one process directory.
+type ProcessUsage struct {
+	CommandId     string
+	Command       string
+	Completed     bool
+	LogBytes      int64 // output.log, or output.log.gz of compressed logs
+	MetadataBytes int64 // All other files of the process directory
+}
+
+// Total returns the size of the process directory.
+func (u ProcessUsage) Total() int64 {
+	return u.LogBytes + u.MetadataBytes
+}
+
+// Report is the disk usage of a workspace.
+type Report struct {
+	Processes      []ProcessUsage // Biggest first
+	LogBytes       int64
+	MetadataBytes  int64
+	WorkspaceBytes int64 // Files of the workspace directory itself, like the command history
+}
+
+// Total returns the size of the workspace directory.
+func (r Report) Total() int64 {
+	return r.LogBytes + r.MetadataBytes + r.WorkspaceBytes
+}
+
+// cachedUsage is the measured size of a finished process. It is valid as long as the
+// modification time of the process directory does not change. Compression and truncation
+// replace files by renaming, so they update the modification time.
+type cachedUsage struct {
+	ModTime       time.Time `json:"mod_time"`
+	LogBytes      int64     `json:"log_bytes"`
+	MetadataBytes int64     `json:"metadata_bytes"`
+}
+
+// Usage measures the disk usage of the workspace. The sizes of finished processes are
+// cached, so only new and changed process directories get walked.
+func Usage(ws *workspace.Workspace) (Report, error) {
+	var report Report
+	processes, err := workspace.ListProcesses(ws)
+	if err != nil {
+		return report, err
+	}
+
+	cache := map[string]cachedUsage{}
+	cachePath := filepath.Join(ws.Path, usageCacheFile)
+	if data, err := os.ReadFile(cachePath); err == nil {
+		// A broken cache only costs time, everything gets measured again
+		_ = json.Unmarshal(data, &cache)
+	}
+	newCache := map[string]cachedUsage{}
+
+	for _, proc := range processes {
+		info, err := os.Stat(proc.ProcessDir)
+		if err != nil {
+			return report, err
+		}
+		usage, ok := cache[proc.CommandId]
+		if !ok || !usage.ModTime.Equal(info.ModTime()) || !proc.Completed {
+			usage, err = measureProcess(proc.ProcessDir)
+			if err != nil {
+				return report, err
+			}
+			usage.ModTime = info.ModTime()
+		}
+		if proc.Completed {
+			newCache[proc.CommandId] = usage
+		}
+		report.Processes = append(report.Processes, ProcessUsage{
+			CommandId:     proc.CommandId,
+			Command:       proc.Command,
+			Completed:     proc.Completed,
+			LogBytes:      usage.LogBytes,
+			MetadataBytes: usage.MetadataBytes,
+		})
+		report.LogBytes += usage.LogBytes
+		report.MetadataBytes += usage.MetadataBytes
+	}
+	sort.Slice(report.Processes, func(i, j int) bool {
+		return report.Processes[i].Total() > report.Processes[j].Total()
+	})
+
+	entries, err := os.ReadDir(ws.Path)
+	if err != nil {
+		return report, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == usageCacheFile {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return report, err
+		}
+		report.WorkspaceBytes += info.Size()
+	}
+
+	data, err := json.Marshal(newCache)
+	if err != nil {
+		return report, err
+	}
+	if err := metadata.WriteFile(cachePath, data, 0o600); err != nil {
+		return report, fmt.Errorf("failed to write %s: %w", usageCacheFile, err)
+	}
+	return report, nil
+}
+
+// measureProcess sums up the file sizes of a process directory.
+func measureProcess(processDir string) (cachedUsage, error) {
+	var usage cachedUsage
+	err := filepath.WalkDir(processDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), "output.log") {
+			usage.LogBytes += info.Size()
+		} else {
+			usage.MetadataBytes += info.Size()
+		}
+		return nil
+	})
+	return usage, err
+}
+
+// WorkspaceUsage is the disk usage of one workspace of the state directory.
+type WorkspaceUsage struct {
+	Workspace *workspace.Workspace
+	Report    Report
+	Policy    Policy // Retention policy of the workspace, zero if it has none of its own
+}
+
+// StateReport is the disk usage of the state directory.
+type StateReport struct {
+	Workspaces []WorkspaceUsage // Biggest first
+	OtherBytes int64            // Files outside of the workspaces, like sessions and the audit log
+}
+
+// Total returns the size of the state directory.
+func (r StateReport) Total() int64 {
+	total := r.OtherBytes
+	for _, w := range r.Workspaces {
+		total += w.Report.Total()
+	}
+	return total
+}
+
+// StateUsage measures the disk usage of the state directory, per workspace with Usage.
+func StateUsage(stateDir string) (StateReport, error) {
+	var report StateReport
+	workspaces, err := workspace.ListWorkspaces(stateDir)
+	if err != nil {
+		return report, err
+	}
+	for _, ws := range workspaces {
+		usage, err := Usage(ws)
+		if err != nil {
+			return report, fmt.Errorf("failed to measure workspace %s: %w", ws.ID, err)
+		}
+		policy, err := LoadPolicy(ws)
+		if err != nil {
+			return report, err
+		}
+		report.Workspaces = append(report.Workspaces, WorkspaceUsage{Workspace: ws, Report: usage, Policy: policy})
+	}
+	sort.Slice(report.Workspaces, func(i, j int) bool {
+		return report.Workspaces[i].Report.Total() > report.Workspaces[j].Report.Total()
+	})
+
+	// Everything besides the workspace directories, which were measured above
+	workspacesDir := filepath.Join(stateDir, "workspaces")
+	err = filepath.WalkDir(stateDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can vanish while walking, for example expired sessions
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			if filepath.Dir(path) == workspacesDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			report.OtherBytes += info.Size()
+		}
+		return nil
+	})
+	return report, err
+}
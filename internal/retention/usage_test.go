@@ -0,0 +1,71 @@
+package retention
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mobileshell/internal/workspace"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsage(t *testing.T) {
+	t.Parallel()
+	ws := createTestWorkspace(t, "usage")
+	now := time.Now().UTC()
+	writeFinishedProcess(t, ws, "small", now, 10)
+	writeFinishedProcess(t, ws, "big", now, 1000)
+
+	report, err := Usage(ws)
+	require.NoError(t, err)
+	require.Len(t, report.Processes, 2)
+	require.Equal(t, "big", report.Processes[0].CommandId)
+	require.Greater(t, report.Processes[0].LogBytes, int64(1000))
+	require.Equal(t, report.Processes[0].LogBytes+report.Processes[1].LogBytes, report.LogBytes)
+	require.Positive(t, report.MetadataBytes)
+	require.Equal(t, report.LogBytes+report.MetadataBytes+report.WorkspaceBytes, report.Total())
+
+	// Unchanged finished processes are taken from the cache
+	cachePath := filepath.Join(ws.Path, usageCacheFile)
+	data, err := os.ReadFile(cachePath)
+	require.NoError(t, err)
+	cache := map[string]cachedUsage{}
+	require.NoError(t, json.Unmarshal(data, &cache))
+	cached := cache["small"]
+	cached.LogBytes = 1 << 30
+	cache["small"] = cached
+	data, err = json.Marshal(cache)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(cachePath, data, 0o600))
+
+	report, err = Usage(ws)
+	require.NoError(t, err)
+	require.Equal(t, "small", report.Processes[0].CommandId)
+	require.Equal(t, int64(1<<30), report.Processes[0].LogBytes)
+}
+
+func TestStateUsage(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	small, err := workspace.CreateWorkspace(stateDir, "small", t.TempDir(), "")
+	require.NoError(t, err)
+	big, err := workspace.CreateWorkspace(stateDir, "big", t.TempDir(), "")
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	writeFinishedProcess(t, small, "a", now, 10)
+	writeFinishedProcess(t, big, "b", now, 5000)
+	require.NoError(t, SavePolicy(big, Policy{MaxCount: 3}))
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "audit.log"), make([]byte, 100), 0o600))
+
+	report, err := StateUsage(stateDir)
+	require.NoError(t, err)
+	require.Len(t, report.Workspaces, 2)
+	require.Equal(t, "big", report.Workspaces[0].Workspace.ID)
+	require.Equal(t, Policy{MaxCount: 3}, report.Workspaces[0].Policy)
+	require.Greater(t, report.Workspaces[0].Report.LogBytes, int64(5000))
+	require.GreaterOrEqual(t, report.OtherBytes, int64(100))
+	require.Equal(t, report.OtherBytes+report.Workspaces[0].Report.Total()+report.Workspaces[1].Report.Total(), report.Total())
+}
@@ -0,0 +1,57 @@
+// Package secret manages the secrets which sign share links and exports. A secret is a file in
+// the state directory which never leaves it, it gets created on first use.
+package secret
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Load reads the secret in the file name of stateDir, and creates it on first use.
+func Load(stateDir, name string) ([]byte, error) {
+	secretPath := filepath.Join(stateDir, name)
+	secret, err := os.ReadFile(secretPath)
+	if err == nil {
+		return secret, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	// Write to a temporary file and link it, so that concurrent requests never read a
+	// partially written secret.
+	tmpFile, err := os.CreateTemp(stateDir, name+"-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+	_, err = tmpFile.WriteString(rand.Text() + rand.Text())
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := os.Link(tmpFile.Name(), secretPath); err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	return os.ReadFile(secretPath)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of payload.
+func Sign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Valid returns true if signature is the signature of payload, see Sign. The comparison takes
+// constant time.
+func Valid(secret, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package server
+
+import (
+	"fmt"
+	"io/fs"
+
+	"golang.org/x/sys/unix"
+)
+
+// dupFD returns a duplicate of the file descriptor fd.
+func dupFD(fd int) (int, error) {
+	return unix.Dup(fd)
+}
+
+// redirectFD makes newfd refer to the file of oldfd, like dup2.
+func redirectFD(oldfd, newfd int) error {
+	return unix.Dup2(oldfd, newfd)
+}
+
+// closeFD closes the file descriptor fd.
+func closeFD(fd int) error {
+	return unix.Close(fd)
+}
+
+// fileOwner returns the user and group ID of the file, like "1000:1000".
+func fileOwner(info fs.FileInfo) string {
+	if stat, ok := info.Sys().(*unix.Stat_t); ok {
+		return fmt.Sprintf("%d:%d", stat.Uid, stat.Gid)
+	}
+	return ""
+}
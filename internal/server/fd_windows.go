@@ -0,0 +1,37 @@
+package server
+
+import (
+	"io/fs"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// dupFD returns a duplicate of the handle fd.
+func dupFD(fd int) (int, error) {
+	process := windows.CurrentProcess()
+	var handle windows.Handle
+	err := windows.DuplicateHandle(process, windows.Handle(fd), process, &handle, 0, false, windows.DUPLICATE_SAME_ACCESS)
+	return int(handle), err
+}
+
+// redirectFD replaces the standard handle newfd, the one of os.Stdout or os.Stderr, by oldfd.
+// Windows has no dup2: child processes get the new handle, but os.Stdout and os.Stderr keep
+// writing to the old one, so the server log misses their output.
+func redirectFD(oldfd, newfd int) error {
+	stdHandle := uint32(windows.STD_ERROR_HANDLE)
+	if newfd == int(os.Stdout.Fd()) {
+		stdHandle = windows.STD_OUTPUT_HANDLE
+	}
+	return windows.SetStdHandle(stdHandle, windows.Handle(oldfd))
+}
+
+// closeFD closes the handle fd.
+func closeFD(fd int) error {
+	return windows.CloseHandle(windows.Handle(fd))
+}
+
+// fileOwner returns "", files on Windows have no user and group ID.
+func fileOwner(fs.FileInfo) string {
+	return ""
+}
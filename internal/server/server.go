@@ -3,40 +3,70 @@ package server
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"context"
+	"crypto/rand"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"log"
 	"log/slog"
 	"mime"
 	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode"
 
+	"mobileshell/internal/activity"
+	"mobileshell/internal/audit"
 	"mobileshell/internal/auth"
+	"mobileshell/internal/clipboard"
+	"mobileshell/internal/config"
+	"mobileshell/internal/demo"
+	"mobileshell/internal/doctor"
 	"mobileshell/internal/executor"
+	"mobileshell/internal/export"
 	"mobileshell/internal/fileeditor"
+	"mobileshell/internal/gitinfo"
+	"mobileshell/internal/notify"
+	"mobileshell/internal/preferences"
 	"mobileshell/internal/process"
+	"mobileshell/internal/replication"
+	"mobileshell/internal/retention"
+	"mobileshell/internal/share"
 	"mobileshell/internal/sysmon"
+	"mobileshell/internal/systemd"
 	"mobileshell/internal/terminal"
+	"mobileshell/internal/upload"
+	"mobileshell/internal/webhook"
+	"mobileshell/internal/webpush"
 	"mobileshell/internal/workspace"
 	"mobileshell/internal/wshub"
+	"mobileshell/pkg/ansihtml"
+	"mobileshell/pkg/asciicast"
 	"mobileshell/pkg/httperror"
+	"mobileshell/pkg/jsonhtml"
 	"mobileshell/pkg/markdown"
 	"mobileshell/pkg/outputlog"
 	"mobileshell/pkg/outputtype"
+	"mobileshell/pkg/textwidth"
 
 	"github.com/gorilla/websocket"
 	"golang.org/x/net/html"
@@ -48,22 +78,50 @@ var templatesFS embed.FS
 //go:embed static/*
 var staticFS embed.FS
 
+//go:embed help/*.md
+var helpFS embed.FS
+
+// StaticAssets returns the static files which are embedded into the binary.
+func StaticAssets() fs.FS {
+	assets, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		panic(err) // The directory is embedded, so this can't happen
+	}
+	return assets
+}
+
 type Server struct {
-	stateDir  string
-	tmpl      *template.Template
-	wsHub     *wshub.Hub
-	debugHTML bool
+	stateDir         string
+	basePath         string         // Configured with SetBasePath, see getBasePath
+	widgetOrigins    []string       // Origins which may fetch the widgets, see SetWidgetOrigins
+	trustedProxies   []netip.Prefix // Proxies whose X-Forwarded-For is trusted, see SetTrustedProxies
+	tmpl             *template.Template
+	wsHub            *wshub.Hub
+	debugHTML        bool
+	executor         executor.Executor  // Starts the processes, see EnableDemo
+	demo             bool               // Demo mode: commands are not executed, see EnableDemo
+	terminals        *terminal.Manager  // Active interactive terminal sessions
+	loginLimiter     *auth.LoginLimiter // Limits the login attempts, see handleLogin
+	defaultRetention retention.Policy   // Of the workspaces without a policy, see SetDefaultRetention
+	storageWarning   int64              // Size of the state directory which gets a warning, see SetStorageWarning
+	storageTotal     atomic.Int64       // Size of the state directory when checkStorage ran last
 }
 
 func New(stateDir string, debugHTML bool) (*Server, error) {
 	funcMap := template.FuncMap{
 		"formatDuration": formatDuration,
+		"formatElapsed":  formatElapsed,
 		"split": func(s, sep string) []string {
 			return strings.Split(s, sep)
 		},
 		"divf": func(a int64, b float64) float64 {
 			return float64(a) / b
 		},
+		"help":        renderHelp,
+		"dict":        dict,
+		"formatBytes": formatBytes,
+		"truncate":    textwidth.Truncate,
+		"notifyRules": notify.FormatRules,
 	}
 	tmpl, err := template.New("").Funcs(funcMap).ParseFS(templatesFS, "templates/*.gohtml")
 	if err != nil {
@@ -71,22 +129,46 @@ func New(stateDir string, debugHTML bool) (*Server, error) {
 	}
 
 	s := &Server{
-		stateDir:  stateDir,
-		tmpl:      tmpl,
-		wsHub:     wshub.NewHub(),
-		debugHTML: debugHTML,
+		stateDir:     stateDir,
+		tmpl:         tmpl,
+		wsHub:        wshub.NewHub(),
+		debugHTML:    debugHTML,
+		executor:     executor.Nohup{},
+		terminals:    terminal.NewManager(),
+		loginLimiter: auth.NewLoginLimiter(),
 	}
 
 	return s, nil
 }
 
+// dict builds a map from key value pairs, to pass several values to a template
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict needs an even number of arguments")
+	}
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
 // formatDuration formats a duration in seconds to a human-readable string
 // Returns empty string if duration is less than 1 second
 func formatDuration(start, end time.Time) string {
 	if end.IsZero() {
 		return ""
 	}
-	duration := end.Sub(start)
+	return formatElapsed(end.Sub(start))
+}
+
+// formatElapsed formats a duration like formatDuration, e.g. "3m 10s". Returns empty string
+// if duration is less than 1 second.
+func formatElapsed(duration time.Duration) string {
 	if duration < time.Second {
 		return ""
 	}
@@ -112,6 +194,20 @@ func formatDuration(start, end time.Time) string {
 	return fmt.Sprintf("%dh", hours)
 }
 
+// formatBytes formats a size with a binary unit, like "1.5 MiB"
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
 func getFileExtensionFromContentType(contentType string) string {
 	// Extract base type without parameters (e.g., "text/plain; charset=utf-8" -> "text/plain")
 	if idx := strings.Index(contentType, ";"); idx != -1 {
@@ -185,6 +281,12 @@ func (s *Server) wrapHandler(h handlerFunc) http.HandlerFunc {
 					"status", he.StatusCode,
 					"error", he.Message)
 
+				// API clients get the message without the page around it
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					http.Error(w, he.Message, he.StatusCode)
+					return
+				}
+
 				// Render error page using template
 				var buf bytes.Buffer
 				title := http.StatusText(he.StatusCode)
@@ -563,40 +665,101 @@ func (s *Server) SetupRoutes() http.Handler {
 	mux.HandleFunc("/", s.wrapHandler(s.handleIndex))
 	mux.HandleFunc("/login", s.wrapHandler(s.handleLogin))
 	mux.HandleFunc("/logout", s.wrapHandler(s.handleLogout))
-	mux.HandleFunc("/server-log", s.authMiddleware(s.wrapHandler(s.handleServerLog)))
+	mux.HandleFunc("/server-log", s.authMiddleware(s.adminMiddleware(s.wrapHandler(s.handleServerLog))))
+	mux.HandleFunc("/doctor", s.authMiddleware(s.adminMiddleware(s.wrapHandler(s.handleDoctor))))
+	mux.HandleFunc("/storage", s.authMiddleware(s.adminMiddleware(s.wrapHandler(s.handleStorage))))
+	mux.HandleFunc("/help", s.wrapHandler(s.handleHelp))
+
+	// First-run wizard
+	mux.HandleFunc("/setup", s.wrapHandler(s.handleSetup))
+	mux.HandleFunc("/setup/workspace", s.authMiddleware(s.wrapHandler(s.handleSetupWorkspace)))
+	mux.HandleFunc("/setup/workspaces/{id}/command", s.authMiddleware(s.wrapHandler(s.handleSetupCommand)))
 
 	// Workspace routes
 	mux.HandleFunc("/workspaces/hx-create", s.authMiddleware(s.wrapHandler(s.hxHandleWorkspaceCreate)))
 	mux.HandleFunc("/workspaces/{id}", s.authMiddleware(s.wrapHandler(s.handleWorkspaceByID)))
+	mux.HandleFunc("/workspaces/import", s.authMiddleware(s.adminMiddleware(s.wrapHandler(s.handleWorkspaceImport))))
 	mux.HandleFunc("/workspaces/{id}/edit", s.authMiddleware(s.wrapHandler(s.handleWorkspaceEdit)))
+	mux.HandleFunc("/workspaces/{id}/export", s.authMiddleware(s.wrapHandler(s.handleWorkspaceExport)))
+	mux.HandleFunc("/workspaces/{id}/archive", s.authMiddleware(s.wrapHandler(s.handleWorkspaceArchive)))
+	mux.HandleFunc("/workspaces/{id}/timeline", s.authMiddleware(s.wrapHandler(s.handleWorkspaceTimeline)))
+	mux.HandleFunc("/workspaces/{id}/hx-storage", s.authMiddleware(s.wrapHandler(s.hxHandleStorage)))
+	mux.HandleFunc("/workspaces/{id}/hx-git", s.authMiddleware(s.wrapHandler(s.hxHandleGit)))
+	mux.HandleFunc("/workspaces/{id}/hx-webhooks", s.authMiddleware(s.wrapHandler(s.hxHandleWebhooks)))
 	mux.HandleFunc("/workspaces/{id}/hx-execute", s.authMiddleware(s.wrapHandler(s.hxHandleExecute)))
+	mux.HandleFunc("/workspaces/{id}/execute", s.authMiddleware(s.wrapHandler(s.handleExecute)))
+	mux.HandleFunc("/workspaces/{id}/hx-command-history", s.authMiddleware(s.wrapHandler(s.hxHandleCommandHistory)))
 	mux.HandleFunc("/workspaces/{id}/hx-finished-processes", s.authMiddleware(s.wrapHandler(s.hxHandleFinishedProcesses)))
+	mux.HandleFunc("/workspaces/{id}/hx-delete-finished-processes", s.authMiddleware(s.wrapHandler(s.hxHandleDeleteFinishedProcesses)))
 	mux.HandleFunc("/workspaces/{id}/json-process-updates", s.authMiddleware(s.wrapHandler(s.jsonHandleProcessUpdates)))
 	mux.HandleFunc("/workspaces/{id}/ws-process-updates", s.authMiddleware(s.handleWSProcessUpdates))
 	mux.HandleFunc("/workspaces/{id}/processes/{processID}", s.authMiddleware(s.wrapHandler(s.handleProcessByID)))
+	mux.HandleFunc("/p/{permalink}", s.authMiddleware(s.wrapHandler(s.handlePermalink)))
+	mux.HandleFunc("/hx-preferences", s.authMiddleware(s.wrapHandler(s.hxHandlePreferences)))
+	mux.HandleFunc("/clipboard", s.authMiddleware(s.wrapHandler(s.handleClipboard)))
+	mux.HandleFunc("/settings", s.authMiddleware(s.adminMiddleware(s.wrapHandler(s.handleSettings))))
+	mux.HandleFunc("/export", s.authMiddleware(s.wrapHandler(s.handleExport)))
+	mux.HandleFunc("/audit", s.authMiddleware(s.wrapHandler(s.handleAudit)))
+	mux.HandleFunc("/sessions", s.authMiddleware(s.wrapHandler(s.handleSessions)))
+	mux.HandleFunc("/push/json-key", s.authMiddleware(s.adminMiddleware(s.wrapHandler(s.jsonHandlePushKey))))
+	mux.HandleFunc("/push/json-subscription", s.authMiddleware(s.adminMiddleware(s.wrapHandler(s.jsonHandlePushSubscription))))
+	mux.HandleFunc("/hx-clipboard", s.authMiddleware(s.wrapHandler(s.hxHandleClipboard)))
 	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-output", s.authMiddleware(s.wrapHandler(s.hxHandleOutput)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-output-page", s.authMiddleware(s.wrapHandler(s.hxHandleOutputPage)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/json-output-range", s.authMiddleware(s.wrapHandler(s.jsonHandleOutputRange)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-follow", s.authMiddleware(s.wrapHandler(s.hxHandleFollow)))
 	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-send-stdin", s.authMiddleware(s.wrapHandler(s.hxHandleSendStdin)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-send-stdin-file", s.authMiddleware(s.wrapHandler(s.hxHandleSendStdinFile)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-close-stdin", s.authMiddleware(s.wrapHandler(s.hxHandleCloseStdin)))
 	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-send-signal", s.authMiddleware(s.wrapHandler(s.hxHandleSendSignal)))
 	mux.HandleFunc("/workspaces/{id}/processes/{processID}/download", s.authMiddleware(s.wrapHandler(s.handleDownloadOutput)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/download-cast", s.authMiddleware(s.wrapHandler(s.handleDownloadCast)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-tags", s.authMiddleware(s.wrapHandler(s.hxHandleProcessTags)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-usage", s.authMiddleware(s.wrapHandler(s.hxHandleProcessUsage)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-delete", s.authMiddleware(s.wrapHandler(s.hxHandleDeleteProcess)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-mark-finished", s.authMiddleware(s.wrapHandler(s.hxHandleMarkFinished)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-shares", s.authMiddleware(s.wrapHandler(s.hxHandleShares)))
+	mux.HandleFunc("/workspaces/{id}/processes/{processID}/hx-revoke-share", s.authMiddleware(s.wrapHandler(s.hxHandleRevokeShare)))
+
+	// JSON API for scripts
+	mux.HandleFunc("/api/v1/workspaces/{id}/processes", s.apiMiddleware(s.wrapHandler(s.apiHandleExecute)))
+	mux.HandleFunc("/api/v1/processes/{id}/output", s.apiMiddleware(s.wrapHandler(s.apiHandleProcessOutput)))
+	mux.HandleFunc("/api/v1/processes/{id}/wait", s.apiMiddleware(s.wrapHandler(s.apiHandleWaitProcess)))
+	mux.HandleFunc("/api/v1/clipboard", s.apiMiddleware(s.wrapHandler(s.apiHandleClipboard)))
+	mux.HandleFunc("/api/v1/workspaces/{id}/uploads", s.apiMiddleware(s.wrapHandler(s.apiHandleCreateUpload)))
+	mux.HandleFunc("/api/v1/uploads/{uploadID}", s.apiMiddleware(s.wrapHandler(s.apiHandleUpload)))
+
+	// Read-only share links, they work without login
+	mux.HandleFunc("/share/{token}", s.wrapHandler(s.handleShare))
+
+	// Embeddable widgets for third-party dashboards, they use widget tokens instead of login
+	mux.HandleFunc("/widgets/{name}", s.widgetMiddleware(s.wrapHandler(s.handleWidget)))
+
+	// Replication to a standby instance, it uses replication tokens instead of login
+	mux.HandleFunc(replication.ManifestPath, s.replicationMiddleware(s.wrapHandler(s.jsonHandleReplicationManifest)))
+	mux.HandleFunc(replication.FilePath, s.replicationMiddleware(s.wrapHandler(s.handleReplicationFile)))
 
 	// Interactive terminal routes
 	mux.HandleFunc("/workspaces/{id}/processes/{processID}/terminal", s.authMiddleware(s.wrapHandler(s.handleTerminal)))
 	mux.HandleFunc("/workspaces/{id}/processes/{processID}/ws-terminal", s.authMiddleware(s.handleWebSocketTerminal))
 	mux.HandleFunc("/workspaces/{id}/terminal-execute", s.authMiddleware(s.wrapHandler(s.handleTerminalExecute)))
+	mux.HandleFunc("/terminals", s.authMiddleware(s.wrapHandler(s.handleTerminals)))
 
 	// File editor routes
 	mux.HandleFunc("/workspaces/{id}/files", s.authMiddleware(s.wrapHandler(s.handleFileEditor)))
 	mux.HandleFunc("/workspaces/{id}/files/read", s.authMiddleware(s.wrapHandler(s.handleFileRead)))
 	mux.HandleFunc("/workspaces/{id}/files/save", s.authMiddleware(s.wrapHandler(s.handleFileSave)))
 	mux.HandleFunc("/workspaces/{id}/files/autocomplete", s.authMiddleware(s.wrapHandler(s.handleFileAutocomplete)))
+	mux.HandleFunc("/workspaces/{id}/files/json-search", s.authMiddleware(s.wrapHandler(s.jsonHandleFileSearch)))
 
 	// File browser routes (for all local files)
-	mux.HandleFunc("/files", s.authMiddleware(s.wrapHandler(s.handleFileBrowser)))
-	mux.HandleFunc("/files/view", s.authMiddleware(s.wrapHandler(s.handleFileView)))
-	mux.HandleFunc("/files/download", s.authMiddleware(s.wrapHandler(s.handleFileDownload)))
+	mux.HandleFunc("/files", s.authMiddleware(s.adminMiddleware(s.wrapHandler(s.handleFileBrowser))))
+	mux.HandleFunc("/files/view", s.authMiddleware(s.adminMiddleware(s.wrapHandler(s.handleFileView))))
+	mux.HandleFunc("/files/download", s.authMiddleware(s.adminMiddleware(s.wrapHandler(s.handleFileDownload))))
 
-	// System monitor routes
-	sysmon.RegisterRoutes(mux, s.tmpl, s.getBasePath, s.authMiddleware,
+	// System monitor routes, they show all processes of the server
+	adminOnly := func(next http.HandlerFunc) http.HandlerFunc { return s.authMiddleware(s.adminMiddleware(next)) }
+	sysmon.RegisterRoutes(mux, s.tmpl, sysmon.GopsutilProvider{}, sysmon.NewHostMonitor(sysmon.GopsutilHostProvider{}), s.getBasePath, adminOnly,
 		func(h func(context.Context, *http.Request) ([]byte, error)) http.HandlerFunc {
 			return s.wrapHandler(func(ctx context.Context, r *http.Request) ([]byte, error) {
 				return h(ctx, r)
@@ -608,34 +771,238 @@ func (s *Server) SetupRoutes() http.Handler {
 
 	// Wrap all routes with HTML validation middleware (if enabled), then logging middleware
 	handler := s.htmlValidationMiddleware(mux)
+	if s.basePath != "" {
+		prefixed := http.NewServeMux()
+		prefixed.Handle(s.basePath+"/", http.StripPrefix(s.basePath, handler))
+		prefixed.Handle("/", handler)
+		handler = prefixed
+	}
 	return s.loggingMiddleware(handler)
 }
 
 func (s *Server) handleIndex(ctx context.Context, r *http.Request) ([]byte, error) {
 	token := s.getSessionToken(r)
 	if token != "" {
-		valid, err := auth.ValidateSession(s.stateDir, token)
+		session, err := auth.LookupSession(s.stateDir, token)
 		if err != nil {
 			return nil, fmt.Errorf("failed to validate session: %w", err)
 		}
-		if valid {
+		if session != nil {
 			// User is logged in, show workspaces
-			return s.handleWorkspaces(ctx, r)
+			return s.handleWorkspaces(ctx, withUser(r, session.User))
 		}
 	}
 
-	// User is not logged in, redirect to login
+	// User is not logged in, redirect to login, or to the wizard if there is no password yet
 	basePath := s.getBasePath(r)
+	firstRun, err := s.isFirstRun()
+	if err != nil {
+		return nil, err
+	}
+	if firstRun {
+		return nil, &redirectError{url: basePath + "/setup", statusCode: http.StatusSeeOther}
+	}
 	return nil, &redirectError{url: basePath + "/login", statusCode: http.StatusSeeOther}
 }
 
+// isFirstRun returns true if neither a password nor a workspace exists. Then the first-run
+// wizard is available without login.
+func (s *Server) isFirstRun() (bool, error) {
+	hasPasswords, err := auth.HasPasswords(s.stateDir)
+	if err != nil || hasPasswords {
+		return false, err
+	}
+	workspaces, err := workspace.ListWorkspaces(s.stateDir)
+	if err != nil {
+		return false, err
+	}
+	return len(workspaces) == 0, nil
+}
+
+// handleSetup is the first step of the first-run wizard: it adds the first password and logs
+// the user in. It is only available during the first run, because it needs no login.
+func (s *Server) handleSetup(ctx context.Context, r *http.Request) ([]byte, error) {
+	basePath := s.getBasePath(r)
+	firstRun, err := s.isFirstRun()
+	if err != nil {
+		return nil, err
+	}
+	if !firstRun {
+		return nil, &redirectError{url: basePath + "/login", statusCode: http.StatusSeeOther}
+	}
+
+	data := map[string]any{
+		"BasePath":          basePath,
+		"Step":              1,
+		"MinPasswordLength": auth.MinPasswordLength,
+		"SuggestedPassword": rand.Text() + rand.Text(),
+	}
+	if r.Method == http.MethodPost {
+		password := r.FormValue("password")
+		if password != r.FormValue("password_confirm") {
+			data["Error"] = "The passwords do not match"
+			return s.renderSetup(data)
+		}
+		if err := auth.AddPassword(s.stateDir, password); err != nil {
+			data["Error"] = err.Error()
+			return s.renderSetup(data)
+		}
+		token, ok := auth.Authenticate(ctx, s.stateDir, password, loginClient(r))
+		if !ok {
+			return nil, fmt.Errorf("failed to log in with the new password")
+		}
+		slog.Info("First-run wizard added a password")
+		return nil, &cookieRedirectError{
+			cookie:     s.sessionCookie(r, token, s.sessionMaxAge()),
+			redirect:   basePath + "/setup/workspace",
+			statusCode: http.StatusSeeOther,
+		}
+	}
+	return s.renderSetup(data)
+}
+
+// handleSetupWorkspace is the second step of the first-run wizard: it creates a workspace.
+func (s *Server) handleSetupWorkspace(ctx context.Context, r *http.Request) ([]byte, error) {
+	basePath := s.getBasePath(r)
+	home, _ := os.UserHomeDir()
+	data := map[string]any{
+		"BasePath": basePath,
+		"Step":     2,
+		"FormValues": map[string]string{
+			"Name":      "home",
+			"Directory": home,
+		},
+	}
+	if r.Method == http.MethodPost {
+		name := r.FormValue("name")
+		directory := r.FormValue("directory")
+		ws, err := s.createWorkspace(r, name, directory, "")
+		if err != nil {
+			data["Error"] = err.Error()
+			data["FormValues"] = map[string]string{"Name": name, "Directory": directory}
+			return s.renderSetup(data)
+		}
+		s.recordAudit(r, audit.Entry{Action: audit.ActionWorkspaceCreate, Workspace: ws.ID, Detail: directory})
+		return nil, &redirectError{url: fmt.Sprintf("%s/setup/workspaces/%s/command", basePath, ws.ID), statusCode: http.StatusSeeOther}
+	}
+	return s.renderSetup(data)
+}
+
+// handleSetupCommand is the last step of the first-run wizard: it runs a test command and
+// shows its output.
+func (s *Server) handleSetupCommand(ctx context.Context, r *http.Request) ([]byte, error) {
+	basePath := s.getBasePath(r)
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	if r.Method == http.MethodPost {
+		command := r.FormValue("command")
+		if command == "" {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Command is required"}
+		}
+		proc, err := s.executor.Execute(ws, command, "", process.Limits{})
+		if err != nil {
+			return nil, err
+		}
+		s.recordAudit(r, audit.Entry{Action: audit.ActionExecute, Workspace: ws.ID, Process: proc.CommandId, Detail: command})
+		if err := workspace.AppendHistory(ws, command); err != nil {
+			slog.Error("Failed to append command history", "workspace", ws.ID, "error", err)
+		}
+		return nil, &redirectError{url: fmt.Sprintf("%s/workspaces/%s/processes/%s", basePath, ws.ID, proc.CommandId), statusCode: http.StatusSeeOther}
+	}
+	return s.renderSetup(map[string]any{
+		"BasePath":  basePath,
+		"Step":      3,
+		"Workspace": ws,
+		"Command":   `echo "Hello from MobileShell"; uname -a`,
+	})
+}
+
+func (s *Server) renderSetup(data map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "setup.gohtml", data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// helpTopic is a markdown file in the help directory. The panels of the web UI reference it
+// by Name, for example {{template "help-panel" "workspaces"}}.
+type helpTopic struct {
+	Name  string
+	Title string
+}
+
+// readHelp reads the help topic with the given name and splits it into the title (the first
+// line, a markdown heading) and the body.
+func readHelp(name string) (title, body string, err error) {
+	data, err := helpFS.ReadFile("help/" + name + ".md")
+	if err != nil {
+		return "", "", fmt.Errorf("unknown help topic %q: %w", name, err)
+	}
+	title, body, _ = strings.Cut(string(data), "\n")
+	return strings.TrimPrefix(title, "# "), body, nil
+}
+
+// renderHelp renders the body of the help topic with the given name to HTML.
+func renderHelp(name string) (template.HTML, error) {
+	_, body, err := readHelp(name)
+	if err != nil {
+		return "", err
+	}
+	// The markdown is embedded and sanitized by RenderToHTML
+	return template.HTML(markdown.RenderToHTML(body)), nil
+}
+
+// helpTopics returns all help topics, sorted by name.
+func helpTopics() ([]helpTopic, error) {
+	entries, err := helpFS.ReadDir("help")
+	if err != nil {
+		return nil, err
+	}
+	topics := make([]helpTopic, 0, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".md")
+		title, _, err := readHelp(name)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, helpTopic{Name: name, Title: title})
+	}
+	return topics, nil
+}
+
+func (s *Server) handleHelp(ctx context.Context, r *http.Request) ([]byte, error) {
+	topics, err := helpTopics()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "help.gohtml", map[string]any{
+		"BasePath": s.getBasePath(r),
+		"Topics":   topics,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func (s *Server) handleLogin(ctx context.Context, r *http.Request) ([]byte, error) {
 	basePath := s.getBasePath(r)
 
 	// Handle GET request - show login form
 	if r.Method == http.MethodGet {
+		firstRun, err := s.isFirstRun()
+		if err != nil {
+			return nil, err
+		}
+		if firstRun {
+			return nil, &redirectError{url: basePath + "/setup", statusCode: http.StatusSeeOther}
+		}
 		var buf bytes.Buffer
-		err := s.tmpl.ExecuteTemplate(&buf, "login.gohtml", map[string]interface{}{
+		err = s.tmpl.ExecuteTemplate(&buf, "login.gohtml", map[string]interface{}{
 			"BasePath": basePath,
 		})
 		if err != nil {
@@ -649,10 +1016,23 @@ func (s *Server) handleLogin(ctx context.Context, r *http.Request) ([]byte, erro
 		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
 	}
 
+	// X-Forwarded-For is only used from trusted proxies, clients could spoof it to bypass the
+	// limit
+	remote := s.remoteHost(r)
+	if wait := s.loginLimiter.Attempt(remote); wait > 0 {
+		slog.Warn("Login rejected, too many failed logins", "remote", remote, "retry_after", wait)
+		return nil, httperror.HTTPError{
+			StatusCode: http.StatusTooManyRequests,
+			Message:    fmt.Sprintf("Too many failed logins. Try again in %s.", wait.Truncate(time.Second)+time.Second),
+		}
+	}
+
 	password := r.FormValue("password")
-	token, ok := auth.Authenticate(ctx, s.stateDir, password)
+	token, ok := auth.Authenticate(ctx, s.stateDir, password, loginClient(r))
 
 	if !ok {
+		slog.Warn("Login failed", "remote", remote, "failures", s.loginLimiter.Failures(remote))
+		s.recordAudit(r, audit.Entry{Action: audit.ActionLoginFailed})
 		var buf bytes.Buffer
 		err := s.tmpl.ExecuteTemplate(&buf, "login.gohtml", map[string]interface{}{
 			"error":    "Invalid password",
@@ -664,14 +1044,13 @@ func (s *Server) handleLogin(ctx context.Context, r *http.Request) ([]byte, erro
 		return buf.Bytes(), nil
 	}
 
+	s.loginLimiter.Success(remote)
+	user := s.sessionUser(token)
+	slog.Info("Login succeeded", "remote", remote, "user", user)
+	s.recordAudit(r, audit.Entry{Action: audit.ActionLogin, User: user})
+
 	// Create session cookie
-	cookie := &http.Cookie{
-		Name:     "session",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   86400, // 24 hours
-	}
+	cookie := s.sessionCookie(r, token, s.sessionMaxAge())
 
 	// Check if this is an HTMX request
 	isHtmx := r.Header.Get("HX-Request") == "true"
@@ -694,16 +1073,19 @@ func (s *Server) handleLogin(ctx context.Context, r *http.Request) ([]byte, erro
 
 func (s *Server) handleLogout(ctx context.Context, r *http.Request) ([]byte, error) {
 	basePath := s.getBasePath(r)
+	user := ""
+	if session, err := auth.LookupSession(s.stateDir, s.getSessionToken(r)); err == nil && session != nil {
+		user = session.User
+		// The token gets invalid on the server, too, in case the cookie was copied
+		if err := auth.RevokeSession(s.stateDir, session.ID); err != nil {
+			slog.Warn("Failed to revoke session on logout", "error", err)
+		}
+	}
+	s.recordAudit(r, audit.Entry{Action: audit.ActionLogout, User: user})
 	redirectPath := basePath + "/login"
 
 	return nil, &cookieRedirectError{
-		cookie: &http.Cookie{
-			Name:     "session",
-			Value:    "",
-			Path:     "/",
-			HttpOnly: true,
-			MaxAge:   -1,
-		},
+		cookie:     s.sessionCookie(r, "", -1),
 		redirect:   redirectPath,
 		statusCode: http.StatusSeeOther,
 	}
@@ -751,25 +1133,166 @@ func (s *Server) handleServerLog(ctx context.Context, r *http.Request) ([]byte,
 	return buf.Bytes(), nil
 }
 
+// handleDoctor shows the health report of the installation, see package doctor.
+func (s *Server) handleDoctor(ctx context.Context, r *http.Request) ([]byte, error) {
+	var buf bytes.Buffer
+	err := s.tmpl.ExecuteTemplate(&buf, "doctor.gohtml", map[string]interface{}{
+		"BasePath": s.getBasePath(r),
+		"Report":   doctor.Run(s.stateDir, StaticAssets()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkStorage measures the state directory and logs a warning if it is bigger than the
+// configured threshold. The admin pages show the warning, see storageWarningMessage.
+func (s *Server) checkStorage() {
+	if s.storageWarning <= 0 {
+		return
+	}
+	report, err := retention.StateUsage(s.stateDir)
+	if err != nil {
+		slog.Error("Failed to measure the state directory", "error", err)
+		return
+	}
+	s.storageTotal.Store(report.Total())
+	if report.Total() > s.storageWarning {
+		slog.Warn("The state directory is bigger than the warning threshold", "bytes", report.Total(), "threshold", s.storageWarning)
+	}
+}
+
+// storageWarningMessage returns the warning for the admin if the state directory was bigger
+// than the threshold when checkStorage ran last, otherwise the empty string.
+func (s *Server) storageWarningMessage(r *http.Request) string {
+	total := s.storageTotal.Load()
+	if requestUser(r) != auth.AdminUser || s.storageWarning <= 0 || total <= s.storageWarning {
+		return ""
+	}
+	return fmt.Sprintf("The state directory uses %s, more than the warning threshold of %s.", formatBytes(total), formatBytes(s.storageWarning))
+}
+
+// handleStorage shows the disk usage of the state directory per workspace. POST requests
+// apply the retention policy of the workspace given by the "workspace" parameter, or of all
+// workspaces without it, like the hourly pruning does.
+func (s *Server) handleStorage(ctx context.Context, r *http.Request) ([]byte, error) {
+	basePath := s.getBasePath(r)
+	if r.Method == http.MethodPost {
+		if id := r.FormValue("workspace"); id != "" {
+			ws, err := s.getWorkspace(r, id)
+			if err != nil {
+				return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+			}
+			policy, err := retention.LoadPolicy(ws)
+			if err != nil {
+				return nil, err
+			}
+			if policy.IsZero() {
+				policy = s.defaultRetention
+			}
+			if policy.IsZero() {
+				return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "The workspace has no retention policy"}
+			}
+			if err := retention.Apply(ws, policy, time.Now().UTC()); err != nil {
+				return nil, err
+			}
+		} else {
+			retention.ApplyAll(s.stateDir, s.defaultRetention)
+		}
+		return nil, &redirectError{url: basePath + "/storage", statusCode: http.StatusSeeOther}
+	}
+
+	report, err := retention.StateUsage(s.stateDir)
+	if err != nil {
+		return nil, err
+	}
+	s.storageTotal.Store(report.Total())
+
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "storage.gohtml", map[string]any{
+		"BasePath":         basePath,
+		"Report":           report,
+		"DefaultRetention": s.defaultRetention,
+		"WarningBytes":     s.storageWarning,
+		"Warning":          s.storageWarningMessage(r),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// recentActivityLimit is the number of events of the recent activity on the start page.
+const recentActivityLimit = 20
+
+// activityEntry is an event of the recent activity with its workspace.
+type activityEntry struct {
+	Event     activity.Event
+	Workspace *workspace.Workspace
+}
+
+// recentActivity returns the newest process starts and completions of the workspaces.
+func (s *Server) recentActivity(workspaces []*workspace.Workspace) ([]activityEntry, error) {
+	byID := make(map[string]*workspace.Workspace, len(workspaces))
+	for _, ws := range workspaces {
+		byID[ws.ID] = ws
+	}
+	events, err := activity.Recent(s.stateDir, recentActivityLimit, func(e activity.Event) bool {
+		return byID[e.Workspace] != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]activityEntry, 0, len(events))
+	for _, e := range events {
+		entries = append(entries, activityEntry{Event: e, Workspace: byID[e.Workspace]})
+	}
+	return entries, nil
+}
+
 func (s *Server) handleWorkspaces(ctx context.Context, r *http.Request) ([]byte, error) {
 	basePath := s.getBasePath(r)
 
-	// Get all workspaces for the list
-	workspaces, _ := workspace.ListWorkspaces(s.stateDir)
+	// Get all workspaces of the user for the list, the archived ones only with ?archived=1
+	workspaces, _ := s.listWorkspaces(r)
+	filter := workspace.WorkspaceFilter{Archived: r.URL.Query().Get("archived") == "1"}
 	var workspaceList []map[string]any
+	archived := 0
 	for _, ws := range workspaces {
+		if ws.IsArchived() {
+			archived++
+		}
+		if !filter.Matches(ws) {
+			continue
+		}
 		workspaceList = append(workspaceList, map[string]any{
-			"ID":         ws.ID,
-			"Name":       ws.Name,
-			"Directory":  ws.Directory,
-			"PreCommand": ws.PreCommand,
+			"ID":          ws.ID,
+			"Name":        ws.Name,
+			"Directory":   ws.Directory,
+			"PreCommand":  ws.PreCommand,
+			"Color":       ws.Color,
+			"Icon":        ws.Icon,
+			"Environment": ws.Environment,
+			"Archived":    ws.IsArchived(),
 		})
 	}
 
+	recent, err := s.recentActivity(workspaces)
+	if err != nil {
+		slog.Error("Failed to read the activity log", "error", err)
+	}
+
 	var buf bytes.Buffer
-	err := s.tmpl.ExecuteTemplate(&buf, "workspaces.gohtml", map[string]any{
-		"BasePath":   basePath,
-		"Workspaces": workspaceList,
+	err = s.tmpl.ExecuteTemplate(&buf, "workspaces.gohtml", map[string]any{
+		"BasePath":       basePath,
+		"User":           requestUser(r),
+		"IsAdmin":        requestUser(r) == auth.AdminUser,
+		"Workspaces":     workspaceList,
+		"ShowArchived":   filter.Archived,
+		"ArchivedCount":  archived,
+		"Activity":       recent,
+		"StorageWarning": s.storageWarningMessage(r),
 	})
 	if err != nil {
 		return nil, err
@@ -791,7 +1314,7 @@ func (s *Server) hxHandleWorkspaceCreate(ctx context.Context, r *http.Request) (
 	}
 
 	// Create the workspace
-	ws, err := executor.CreateWorkspace(s.stateDir, name, directory, preCommand)
+	ws, err := s.createWorkspace(r, name, directory, preCommand)
 	if err != nil {
 		// Return just the form partial with error and preserved values
 		basePath := s.getBasePath(r)
@@ -811,12 +1334,32 @@ func (s *Server) hxHandleWorkspaceCreate(ctx context.Context, r *http.Request) (
 		return buf.Bytes(), nil
 	}
 
+	s.recordAudit(r, audit.Entry{Action: audit.ActionWorkspaceCreate, Workspace: ws.ID, Detail: directory})
+
 	// Use HX-Redirect header for htmx requests
 	basePath := s.getBasePath(r)
 	redirectURL := fmt.Sprintf("%s/workspaces/%s", basePath, ws.ID)
 	return nil, &hxRedirectError{url: redirectURL}
 }
 
+// createWorkspace creates a workspace which is owned by the user of the request.
+func (s *Server) createWorkspace(r *http.Request, name, directory, preCommand string) (*workspace.Workspace, error) {
+	user := requestUser(r)
+	if user == "" {
+		return nil, errNoUser
+	}
+	ws, err := executor.CreateWorkspace(s.stateDir, name, directory, preCommand)
+	if err != nil {
+		return nil, err
+	}
+	if err := workspace.SaveOwner(ws, user, nil); err != nil {
+		// Without an owner, everybody could access the workspace
+		_ = os.RemoveAll(ws.Path)
+		return nil, err
+	}
+	return ws, nil
+}
+
 // handleWorkspaceByID handles /workspaces/{id}
 func (s *Server) handleWorkspaceByID(ctx context.Context, r *http.Request) ([]byte, error) {
 	// Extract workspace ID from path parameter
@@ -826,21 +1369,44 @@ func (s *Server) handleWorkspaceByID(ctx context.Context, r *http.Request) ([]by
 	}
 
 	// Get the workspace by ID
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	ws, err := s.getWorkspace(r, workspaceID)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
 
+	processes, err := workspace.ListProcesses(ws)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first page of finished processes is part of the page, so that it works without
+	// JavaScript. htmx reloads it with the filters.
+	finished, err := s.hxHandleFinishedProcesses(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
 	// Render workspace page
 	basePath := s.getBasePath(r)
 	var buf bytes.Buffer
 	err = s.tmpl.ExecuteTemplate(&buf, "workspaces.gohtml", map[string]any{
-		"BasePath": basePath,
+		"BasePath":          basePath,
+		"User":              requestUser(r),
+		"IsAdmin":           requestUser(r) == auth.AdminUser,
+		"StorageWarning":    s.storageWarningMessage(r),
+		"FinishedProcesses": template.HTML(finished),
 		"CurrentWorkspace": map[string]any{
-			"ID":         ws.ID,
-			"Name":       ws.Name,
-			"Directory":  ws.Directory,
-			"PreCommand": ws.PreCommand,
+			"ID":          ws.ID,
+			"Name":        ws.Name,
+			"Directory":   ws.Directory,
+			"PreCommand":  ws.PreCommand,
+			"Profiles":    ws.ProfileNames(),
+			"Color":       ws.Color,
+			"Icon":        ws.Icon,
+			"Environment": ws.Environment,
+			"Archived":    ws.IsArchived(),
+			"Tags":        process.CollectTags(processes),
+			"OutputTypes": process.CollectOutputTypes(processes),
 		},
 	})
 	if err != nil {
@@ -849,525 +1415,1290 @@ func (s *Server) handleWorkspaceByID(ctx context.Context, r *http.Request) ([]by
 	return buf.Bytes(), nil
 }
 
-func (s *Server) handleWorkspaceEdit(ctx context.Context, r *http.Request) ([]byte, error) {
-	// Extract workspace ID from path parameter
-	workspaceID := r.PathValue("id")
-	if workspaceID == "" {
-		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Not found"}
+// Layout of the workspace timeline. Bars get scaled into timelineWidth SVG user units.
+const (
+	timelineWidth       = 1000.0
+	timelineRowHeight   = 20
+	timelineTicks       = 6
+	defaultTimelineSpan = 24 * time.Hour
+	maxTimelineSpan     = 30 * 24 * time.Hour
+)
+
+// timelineBar is the bar of one process in the workspace timeline.
+type timelineBar struct {
+	Process *process.Process
+	X       float64
+	Width   float64
+	Y       int
+	Status  string // "running", "success" or "failure"
+}
+
+// timelineTick is a time label on the axis of the workspace timeline.
+type timelineTick struct {
+	X     float64
+	Label string
+}
+
+// timeline is the Gantt-style overview of the processes of a workspace.
+type timeline struct {
+	Bars   []timelineBar
+	Ticks  []timelineTick
+	Height int
+}
+
+// buildTimeline lays out the processes which ran between start and end, one row per process
+// in the order of their start time. Running processes last until end.
+func buildTimeline(processes []*process.Process, start, end time.Time) timeline {
+	var t timeline
+	span := end.Sub(start)
+	x := func(ts time.Time) float64 {
+		return min(max(float64(ts.Sub(start))/float64(span)*timelineWidth, 0), timelineWidth)
+	}
+	for i := range timelineTicks {
+		ts := start.Add(span * time.Duration(i) / timelineTicks)
+		t.Ticks = append(t.Ticks, timelineTick{X: x(ts), Label: ts.UTC().Format("01-02 15:04")})
 	}
 
-	// Get the workspace by ID
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
-	if err != nil {
-		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	sorted := slices.Clone(processes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].StartTime.Before(sorted[j].StartTime)
+	})
+	for _, p := range sorted {
+		processEnd, status := end, "running"
+		if p.Completed {
+			processEnd, status = p.FinishedAt(), "success"
+			if p.ExitCode != 0 || p.Signal != "" {
+				status = "failure"
+			}
+		}
+		if p.StartTime.After(end) || processEnd.Before(start) {
+			continue
+		}
+		t.Bars = append(t.Bars, timelineBar{
+			Process: p,
+			X:       x(p.StartTime),
+			// Short processes get a minimal width, so that they stay visible
+			Width:  max(x(processEnd)-x(p.StartTime), 2),
+			Y:      len(t.Bars) * timelineRowHeight,
+			Status: status,
+		})
 	}
+	t.Height = len(t.Bars) * timelineRowHeight
+	return t
+}
 
-	basePath := s.getBasePath(r)
+// maxUsageSummaries limits the commands in the resource usage summary of the timeline.
+const maxUsageSummaries = 10
+
+// usageSummary is the resource usage of all runs of a command.
+type usageSummary struct {
+	Command  string
+	Runs     int
+	CPU      time.Duration // Sum of the CPU times
+	MaxRSS   int64         // Maximum of the maximum resident set sizes, in bytes
+	BlockIn  int64
+	BlockOut int64
+}
 
-	// Handle GET request - show edit form
-	if r.Method == http.MethodGet {
-		var buf bytes.Buffer
-		err = s.tmpl.ExecuteTemplate(&buf, "edit-workspace.gohtml", map[string]any{
-			"BasePath": basePath,
-			"Workspace": map[string]any{
-				"ID":                     ws.ID,
-				"Name":                   ws.Name,
-				"Directory":              ws.Directory,
-				"PreCommand":             ws.PreCommand,
-				"DefaultTerminalCommand": ws.DefaultTerminalCommand,
-			},
-		})
-		if err != nil {
-			return nil, err
+// summarizeUsage sums the resource usage of the processes per command, heaviest CPU users
+// first. Processes without usage, for example running ones, are skipped.
+func summarizeUsage(bars []timelineBar) []usageSummary {
+	byCommand := map[string]*usageSummary{}
+	var summaries []*usageSummary
+	for _, bar := range bars {
+		u := bar.Process.Usage
+		if u == nil {
+			continue
 		}
-		return buf.Bytes(), nil
+		summary, ok := byCommand[bar.Process.Command]
+		if !ok {
+			summary = &usageSummary{Command: bar.Process.Command}
+			byCommand[bar.Process.Command] = summary
+			summaries = append(summaries, summary)
+		}
+		summary.Runs++
+		summary.CPU += u.CPU()
+		summary.MaxRSS = max(summary.MaxRSS, u.MaxRSS)
+		summary.BlockIn += u.BlockIn
+		summary.BlockOut += u.BlockOut
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].CPU > summaries[j].CPU
+	})
+	result := make([]usageSummary, 0, min(len(summaries), maxUsageSummaries))
+	for _, summary := range summaries[:min(len(summaries), maxUsageSummaries)] {
+		result = append(result, *summary)
 	}
+	return result
+}
 
-	// Handle POST request - update workspace
-	if r.Method == http.MethodPost {
-		name := r.FormValue("name")
-		preCommand := r.FormValue("pre_command")
-		defaultTerminalCommand := r.FormValue("default_terminal_command")
+// Size of the usage sparklines of a process in SVG user units. They get stretched to the width
+// of the page.
+const (
+	sparklineWidth  = 300.0
+	sparklineHeight = 40.0
+)
 
-		if name == "" {
-			var buf bytes.Buffer
-			err = s.tmpl.ExecuteTemplate(&buf, "edit-workspace.gohtml", map[string]any{
-				"BasePath": basePath,
-				"Workspace": map[string]any{
-					"ID":                     ws.ID,
-					"Name":                   ws.Name,
-					"Directory":              ws.Directory,
-					"PreCommand":             ws.PreCommand,
-					"DefaultTerminalCommand": ws.DefaultTerminalCommand,
-				},
-				"Error": "Workspace name and directory are required",
-			})
-			if err != nil {
-				return nil, err
-			}
-			return buf.Bytes(), nil
-		}
-
-		// Update the workspace
-		_, err := workspace.UpdateWorkspace(s.stateDir, workspaceID, name, preCommand, defaultTerminalCommand)
-		if err != nil {
-			var buf bytes.Buffer
-			err = s.tmpl.ExecuteTemplate(&buf, "edit-workspace.gohtml", map[string]any{
-				"BasePath": basePath,
-				"Workspace": map[string]any{
-					"ID":                     ws.ID,
-					"Name":                   name,
-					"PreCommand":             preCommand,
-					"DefaultTerminalCommand": defaultTerminalCommand,
-				},
-				"Error": fmt.Sprintf("Failed to update workspace: %v", err),
-			})
-			if err != nil {
-				return nil, err
-			}
-			return buf.Bytes(), nil
-		}
-
-		// Redirect to workspace page
-		return nil, &redirectError{url: fmt.Sprintf("%s/workspaces/%s", basePath, workspaceID), statusCode: http.StatusSeeOther}
-	}
+// usageSparkline is the CPU and memory usage of a process over time, as points of SVG
+// polylines. The points are empty if there are less than two samples.
+type usageSparkline struct {
+	CPUPoints string
+	RSSPoints string
+	MaxCPU    float64
+	MaxRSS    int64
+	Last      process.Sample
+	Width     float64
+	Height    float64
+}
 
-	return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+// Points returns true if there is something to draw.
+func (u usageSparkline) Points() bool {
+	return u.CPUPoints != ""
 }
 
-func (s *Server) handleWorkspaceClear(ctx context.Context, r *http.Request) ([]byte, error) {
-	if r.Method != http.MethodPost {
-		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+// buildUsageSparkline scales the samples of a process, the x axis is the time of the samples
+// and the y axis goes from 0 to the maximum.
+func buildUsageSparkline(samples []process.Sample) usageSparkline {
+	u := usageSparkline{Width: sparklineWidth, Height: sparklineHeight}
+	if len(samples) == 0 {
+		return u
+	}
+	u.Last = samples[len(samples)-1]
+	for _, sample := range samples {
+		u.MaxCPU = max(u.MaxCPU, sample.CPU)
+		u.MaxRSS = max(u.MaxRSS, sample.RSS)
+	}
+	if len(samples) < 2 {
+		return u
+	}
+	start, span := samples[0].Time, samples[len(samples)-1].Time.Sub(samples[0].Time)
+	y := func(value, maxValue float64) float64 {
+		if maxValue <= 0 {
+			return sparklineHeight
+		}
+		return sparklineHeight - value/maxValue*sparklineHeight
 	}
-
-	// Redirect to home page
-	basePath := s.getBasePath(r)
-	return nil, &redirectError{url: basePath + "/", statusCode: http.StatusSeeOther}
+	var cpu, rss []string
+	for i, sample := range samples {
+		x := float64(i) / float64(len(samples)-1) * sparklineWidth
+		if span > 0 {
+			x = float64(sample.Time.Sub(start)) / float64(span) * sparklineWidth
+		}
+		cpu = append(cpu, fmt.Sprintf("%.1f,%.1f", x, y(sample.CPU, u.MaxCPU)))
+		rss = append(rss, fmt.Sprintf("%.1f,%.1f", x, y(float64(sample.RSS), float64(u.MaxRSS))))
+	}
+	u.CPUPoints = strings.Join(cpu, " ")
+	u.RSSPoints = strings.Join(rss, " ")
+	return u
 }
 
-func (s *Server) hxHandleExecute(ctx context.Context, r *http.Request) ([]byte, error) {
-	if r.Method != http.MethodPost {
-		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+// hxHandleProcessUsage returns the usage sparklines of a process. They poll for new samples
+// while the process runs.
+func (s *Server) hxHandleProcessUsage(ctx context.Context, r *http.Request) ([]byte, error) {
+	processDir, err := workspace.FindProcessDir(s.stateDir, r.PathValue("id"), r.PathValue("processID"))
+	if err != nil || !canAccessProcess(r, processDir) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Process not found"}
 	}
-
-	command := r.FormValue("command")
-	if command == "" {
-		command = "bash"
+	proc, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get workspace ID from path parameter
-	workspaceID := r.PathValue("id")
-	if workspaceID == "" {
-		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Workspace ID is required"}
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "hx-process-usage.gohtml", map[string]any{
+		"BasePath":    s.getBasePath(r),
+		"WorkspaceID": r.PathValue("id"),
+		"Process":     proc,
+		"Usage":       buildUsageSparkline(process.ReadSamples(processDir)),
+	})
+	if err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	// Get the workspace
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+// handleWorkspaceTimeline shows when the processes of the workspace ran, to see the overlap
+// of scheduled jobs and manual runs, and which commands used the most resources. The "hours"
+// parameter selects the time span.
+func (s *Server) handleWorkspaceTimeline(ctx context.Context, r *http.Request) ([]byte, error) {
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
 
-	proc, err := executor.Execute(ws, command)
+	span := defaultTimelineSpan
+	if param := r.URL.Query().Get("hours"); param != "" {
+		hours, err := strconv.Atoi(param)
+		if err != nil || hours < 1 || time.Duration(hours)*time.Hour > maxTimelineSpan {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Invalid hours"}
+		}
+		span = time.Duration(hours) * time.Hour
+	}
+
+	processes, err := workspace.ListProcesses(ws)
 	if err != nil {
 		return nil, err
 	}
+	end := time.Now().UTC()
+	t := buildTimeline(processes, end.Add(-span), end)
 
-	// Return minimal hidden div that triggers immediate JSON polling via hx-on::after-request
-	// The polling will fetch and display the full process details from the JSON endpoint
 	var buf bytes.Buffer
-	basePath := s.getBasePath(r)
-	fmt.Fprintf(&buf, `<div data-process-id="%s" style="display:none" data-output-url="%s/workspaces/%s/processes/%s/hx-output">%s</div>`,
-		proc.CommandId, basePath, workspaceID, proc.CommandId, command)
+	err = s.tmpl.ExecuteTemplate(&buf, "timeline.gohtml", map[string]any{
+		"BasePath":  s.getBasePath(r),
+		"Workspace": ws,
+		"Hours":     int(span.Hours()),
+		"Spans":     []int{1, 6, 24, 168},
+		"Timeline":  t,
+		"Usage":     summarizeUsage(t.Bars),
+		"Width":     timelineWidth,
+		"RowHeight": timelineRowHeight,
+	})
+	if err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
-func (s *Server) jsonHandleProcessUpdates(ctx context.Context, r *http.Request) ([]byte, error) {
-	// Get workspace ID from path parameter
+func (s *Server) handleWorkspaceEdit(ctx context.Context, r *http.Request) ([]byte, error) {
+	// Extract workspace ID from path parameter
 	workspaceID := r.PathValue("id")
 	if workspaceID == "" {
-		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Workspace ID is required"}
-	}
-
-	// Parse query parameters to get current process IDs
-	processIDsParam := r.URL.Query().Get("process_ids")
-	var processIDs []string
-	if processIDsParam != "" {
-		processIDs = strings.Split(processIDsParam, ",")
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Not found"}
 	}
 
-	// Get the workspace
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	// Get the workspace by ID
+	ws, err := s.getWorkspace(r, workspaceID)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
 
-	allProcesses, err := workspace.ListProcesses(ws)
+	basePath := s.getBasePath(r)
+
+	policy, err := retention.LoadPolicy(ws)
 	if err != nil {
 		return nil, err
 	}
 
-	// Build map of received process IDs for quick lookup
-	receivedIDs := make(map[string]bool)
-	for _, id := range processIDs {
-		receivedIDs[id] = true
+	// Handle GET request - show edit form
+	if r.Method == http.MethodGet {
+		return s.renderWorkspaceEdit(r, ws, policy, "")
 	}
 
-	// Response structure
-	type ProcessUpdate struct {
-		ID         string `json:"id"`
-		Status     string `json:"status"` // "running", "finished", "new", "unknown"
-		HTML       string `json:"html"`
-		OutputHTML string `json:"output_html,omitempty"` // For running processes - HTML content for output div
-	}
+	// Handle POST request - update workspace
+	if r.Method == http.MethodPost {
+		name := r.FormValue("name")
+		preCommand := r.FormValue("pre_command")
+		defaultTerminalCommand := r.FormValue("default_terminal_command")
 
-	var updates []ProcessUpdate
+		if name == "" {
+			return s.renderWorkspaceEdit(r, ws, policy, "Workspace name and directory are required")
+		}
 
-	// Check each received ID to see if it's still running or finished
-	for _, id := range processIDs {
-		found := false
-		for _, p := range allProcesses {
-			if p.CommandId == id {
-				found = true
+		newPolicy, err := parseRetentionPolicy(r)
+		if err != nil {
+			return s.renderWorkspaceEdit(r, ws, policy, err.Error())
+		}
 
-				if p.Completed {
-					// Render finished process HTML (view only, like initial page load)
-					html, err := s.renderFinishedProcessSnippet(p, workspaceID, r)
-					if err != nil {
-						slog.Error("Failed to render finished process", "error", err, "id", p.CommandId)
-						continue
-					}
-					updates = append(updates, ProcessUpdate{
-						ID:     id,
-						Status: "finished",
-						HTML:   html,
-					})
-				} else {
-					// Process is still running - send output update
-					outputHTML, err := s.renderProcessOutputHTML(p, workspaceID, r)
-					if err != nil {
-						slog.Error("Failed to render process output", "error", err, "id", p.CommandId)
-						continue
-					}
-					updates = append(updates, ProcessUpdate{
-						ID:         id,
-						Status:     "running",
-						OutputHTML: outputHTML,
-					})
-				}
-				break
+		// Forms without the field keep the limit
+		maxConcurrent := ws.MaxConcurrent
+		if r.Form.Has("max_concurrent") {
+			limit, err := parseOptionalLimit(r, "max_concurrent")
+			if err != nil {
+				return s.renderWorkspaceEdit(r, ws, policy, err.Error())
 			}
+			maxConcurrent = int(limit)
 		}
-		if !found {
-			// ID is unknown (process may have been deleted)
-			slog.Warn("Unknown process ID in update request", "id", id)
-			updates = append(updates, ProcessUpdate{
-				ID:     id,
-				Status: "unknown",
-				HTML:   "",
-			})
-		}
-	}
 
-	// Check for new running processes not in the received list
-	var runningProcesses []*process.Process
-	for _, p := range allProcesses {
-		if !p.Completed && !receivedIDs[p.CommandId] {
-			// Check if actually running
-			if p.PID > 0 {
-				process, err := os.FindProcess(p.PID)
-				if err == nil {
-					err = process.Signal(syscall.Signal(0))
-					if err != nil {
-						// Dead process, skip
-						continue
-					}
-				}
+		// Forms without the fields keep the priorities
+		nice, ioPriority := ws.Nice, ws.IOPriority
+		if r.Form.Has("nice") || r.Form.Has("io_priority") {
+			nice, ioPriority, err = process.ParsePriority(r.FormValue("nice"), r.FormValue("io_priority"))
+			if err != nil {
+				return s.renderWorkspaceEdit(r, ws, policy, err.Error())
 			}
-			runningProcesses = append(runningProcesses, p)
 		}
-	}
 
-	// Sort new running processes by start time (oldest first, to maintain creation order)
-	sort.Slice(runningProcesses, func(i, j int) bool {
-		return runningProcesses[i].StartTime.Before(runningProcesses[j].StartTime)
-	})
+		profiles := parseProfiles(r)
+		color := r.FormValue("color")
+		icon := r.FormValue("icon")
+		environment := r.FormValue("environment")
+		// Forms without the sharing fields keep the sharing
+		owner, sharedWith := ws.Owner, ws.SharedWith
+		// Only who can share the workspace can change its policy, it restricts the others. They
+		// can't change the pre-commands either, which would run any command.
+		commandPolicy := ws.CommandPolicy
+		if r.Form.Has("command_policy") && canShare(r, ws) {
+			commandPolicy = r.FormValue("command_policy")
+		}
+		if policyLocked(r, ws) {
+			preCommand = ws.PreCommand
+			profiles = ws.Profiles
+		}
+		if r.Form.Has("shared_with") {
+			sharedWith = parseUsers(r.FormValue("shared_with"))
+		}
+		if r.Form.Has("owner") && requestUser(r) == auth.AdminUser {
+			owner = r.FormValue("owner")
+		}
 
-	// Add new running processes to updates
-	for _, p := range runningProcesses {
-		html, err := s.renderRunningProcessSnippet(p, workspaceID, r)
+		// Update the workspace
+		updated, err := workspace.UpdateWorkspace(s.stateDir, workspaceID, name, preCommand, defaultTerminalCommand)
+		if err == nil {
+			err = retention.SavePolicy(updated, newPolicy)
+		}
+		if err == nil {
+			err = workspace.SaveProfiles(updated, profiles)
+		}
+		if err == nil {
+			err = workspace.SaveIdentity(updated, color, icon)
+		}
+		if err == nil {
+			err = workspace.SaveEnvironment(updated, environment)
+		}
+		if err == nil {
+			err = workspace.SaveMaxConcurrent(updated, maxConcurrent)
+		}
+		if err == nil {
+			err = workspace.SavePriority(updated, nice, ioPriority)
+		}
+		if err == nil && canShare(r, ws) {
+			err = SaveOwner(s.stateDir, updated, owner, sharedWith)
+		}
+		if err == nil && canShare(r, ws) {
+			err = workspace.SaveCommandPolicy(updated, commandPolicy)
+		}
 		if err != nil {
-			slog.Error("Failed to render new running process", "error", err, "id", p.CommandId)
-			continue
+			ws.Name = name
+			ws.PreCommand = preCommand
+			ws.DefaultTerminalCommand = defaultTerminalCommand
+			ws.Profiles = profiles
+			ws.Color = color
+			ws.Icon = icon
+			ws.Environment = environment
+			ws.Owner = owner
+			ws.SharedWith = sharedWith
+			ws.CommandPolicy = commandPolicy
+			ws.MaxConcurrent = maxConcurrent
+			ws.Nice = nice
+			ws.IOPriority = ioPriority
+			return s.renderWorkspaceEdit(r, ws, newPolicy, fmt.Sprintf("Failed to update workspace: %v", err))
 		}
-		updates = append(updates, ProcessUpdate{
-			ID:     p.CommandId,
-			Status: "new",
-			HTML:   html,
-		})
+
+		s.recordAudit(r, audit.Entry{Action: audit.ActionWorkspaceChange, Workspace: workspaceID, Detail: "settings"})
+
+		// Redirect to workspace page
+		return nil, &redirectError{url: fmt.Sprintf("%s/workspaces/%s", basePath, workspaceID), statusCode: http.StatusSeeOther}
 	}
 
-	// Return JSON response
-	responseData, err := json.Marshal(map[string]interface{}{
-		"updates": updates,
-	})
+	return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+}
+
+// canShare returns true if the user of the request can change who can access the workspace:
+// its owner and the admin.
+func canShare(r *http.Request, ws *workspace.Workspace) bool {
+	user := requestUser(r)
+	return user == auth.AdminUser || (user != "" && ws.Owner == user)
+}
+
+// policyLocked returns true if the user of the request is restricted by the command policy of
+// the workspace, and thus can't change its pre-commands.
+func policyLocked(r *http.Request, ws *workspace.Workspace) bool {
+	return ws.CommandPolicy != "" && !canShare(r, ws)
+}
+
+// parseUsers splits a list of user names, separated by commas or spaces.
+func parseUsers(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+}
+
+// SaveOwner sets the owner of the workspace and the users it is shared with, after checking
+// that the users exist in stateDir.
+func SaveOwner(stateDir string, ws *workspace.Workspace, owner string, sharedWith []string) error {
+	users, err := auth.Users(stateDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal response: %w", err)
+		return err
+	}
+	for _, user := range append([]string{owner}, sharedWith...) {
+		if user != "" && !slices.Contains(users, user) {
+			return fmt.Errorf("unknown user %q, add it with: mobileshell add-password --user %s", user, user)
+		}
 	}
+	return workspace.SaveOwner(ws, owner, sharedWith)
+}
 
-	return responseData, nil
+// workspaceColors are offered in the edit form of a workspace. The keys are the values which
+// get stored, the template sorts them.
+var workspaceColors = map[string]string{
+	"#0d6efd": "Blue",
+	"#198754": "Green",
+	"#6f42c1": "Purple",
+	"#adb5bd": "Gray",
+	"#dc3545": "Red",
+	"#fd7e14": "Orange",
+	"#ffc107": "Yellow",
 }
 
-func (s *Server) renderRunningProcessSnippet(p *process.Process, workspaceID string, r *http.Request) (string, error) {
-	var buf bytes.Buffer
-	err := s.tmpl.ExecuteTemplate(&buf, "hx-running-process-single.gohtml", map[string]interface{}{
-		"Process":     p,
-		"BasePath":    s.getBasePath(r),
-		"WorkspaceID": workspaceID,
-	})
+// renderWorkspaceEdit renders the edit form of a workspace with an optional error message.
+func (s *Server) renderWorkspaceEdit(r *http.Request, ws *workspace.Workspace, policy retention.Policy, errorMessage string) ([]byte, error) {
+	// One row per profile, and an empty row to add a profile
+	type profileRow struct {
+		Name       string
+		PreCommand string
+	}
+	var profileRows []profileRow
+	for _, name := range ws.ProfileNames() {
+		profileRows = append(profileRows, profileRow{Name: name, PreCommand: ws.Profiles[name]})
+	}
+	profileRows = append(profileRows, profileRow{})
+
+	users, err := auth.Users(s.stateDir)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return buf.String(), nil
-}
 
-func (s *Server) renderFinishedProcessSnippet(p *process.Process, workspaceID string, r *http.Request) (string, error) {
 	var buf bytes.Buffer
-	err := s.tmpl.ExecuteTemplate(&buf, "hx-finished-process-single.gohtml", map[string]interface{}{
-		"Process":     p,
-		"BasePath":    s.getBasePath(r),
-		"WorkspaceID": workspaceID,
+	err = s.tmpl.ExecuteTemplate(&buf, "edit-workspace.gohtml", map[string]any{
+		"BasePath":         s.getBasePath(r),
+		"Workspace":        ws,
+		"Retention":        policy,
+		"DefaultRetention": s.defaultRetention,
+		"ProfileRows":      profileRows,
+		"Colors":           workspaceColors,
+		"Environments":     []string{workspace.EnvironmentDev, workspace.EnvironmentStaging, workspace.EnvironmentProd},
+		"Users":            users,
+		"SharedWith":       strings.Join(ws.SharedWith, ", "),
+		"CanShare":         canShare(r, ws),
+		"IsAdmin":          requestUser(r) == auth.AdminUser,
+		"PolicyPresets":    workspace.PolicyPresetNames(),
+		"PolicyLocked":     policyLocked(r, ws),
+		"Error":            errorMessage,
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return buf.String(), nil
+	return buf.Bytes(), nil
 }
 
-// handleWSProcessUpdates handles WebSocket connections for workspace process updates
-func (s *Server) handleWSProcessUpdates(w http.ResponseWriter, r *http.Request) {
-	// Get workspace ID from path parameter
-	workspaceID := r.PathValue("id")
-	if workspaceID == "" {
-		slog.Error("WebSocket: Workspace ID is required")
-		http.Error(w, "Workspace ID is required", http.StatusBadRequest)
-		return
+// parseRetentionPolicy reads the retention fields of the workspace edit form. Empty fields
+// mean "unlimited".
+// parseProfiles reads the pre-command profiles of the edit workspace form. The form has the
+// same number of "profile_name" and "profile_pre_command" fields. Rows with an empty name are
+// skipped.
+func parseProfiles(r *http.Request) map[string]string {
+	_ = r.ParseForm()
+	names := r.Form["profile_name"]
+	preCommands := r.Form["profile_pre_command"]
+	profiles := make(map[string]string, len(names))
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || i >= len(preCommands) {
+			continue
+		}
+		profiles[name] = preCommands[i]
 	}
+	return profiles
+}
 
-	// Verify workspace exists
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+func parseRetentionPolicy(r *http.Request) (retention.Policy, error) {
+	maxAgeDays, err := parseOptionalLimit(r, "retention_max_age_days")
 	if err != nil {
-		slog.Error("WebSocket: Workspace not found", "workspaceID", workspaceID, "error", err)
-		http.Error(w, "Workspace not found", http.StatusNotFound)
-		return
+		return retention.Policy{}, err
 	}
-
-	// Upgrade to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	maxCount, err := parseOptionalLimit(r, "retention_max_count")
 	if err != nil {
-		slog.Error("Failed to upgrade to WebSocket", "error", err)
-		return
+		return retention.Policy{}, err
 	}
-	defer func() {
-		if err := conn.Close(); err != nil {
-			slog.Error("Failed to close WebSocket connection", "error", err)
-		}
-	}()
+	maxBytes, err := parseOptionalLimit(r, "retention_max_bytes")
+	if err != nil {
+		return retention.Policy{}, err
+	}
+	return retention.Policy{MaxAgeDays: int(maxAgeDays), MaxCount: int(maxCount), MaxBytes: maxBytes}, nil
+}
 
-	// Create WebSocket client
-	clientID := fmt.Sprintf("%s-%d", workspaceID, time.Now().UnixNano())
-	client := &wshub.Client{
-		ID:          clientID,
-		WorkspaceID: workspaceID,
-		Conn:        conn,
-		SendChan:    make(chan wshub.Message, 100),
-		Done:        make(chan struct{}),
+// parseOptionalLimit parses a non-negative integer form field. An empty field returns 0.
+func parseOptionalLimit(r *http.Request, field string) (int64, error) {
+	value := strings.TrimSpace(r.FormValue(field))
+	if value == "" {
+		return 0, nil
 	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid value for %s: %q", field, value)
+	}
+	return parsed, nil
+}
 
-	// Register client with hub
-	s.wsHub.RegisterClient(client)
-	defer s.wsHub.UnregisterClient(clientID)
-	defer close(client.Done)
+func (s *Server) handleWorkspaceClear(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
 
-	// Start goroutine to write messages to WebSocket
-	go func() {
-		for {
-			select {
-			case msg := <-client.SendChan:
-				if err := conn.WriteJSON(msg); err != nil {
-					slog.Error("Failed to write WebSocket message", "error", err)
-					return
-				}
-			case <-client.Done:
-				return
-			}
-		}
-	}()
+	// Redirect to home page
+	basePath := s.getBasePath(r)
+	return nil, &redirectError{url: basePath + "/", statusCode: http.StatusSeeOther}
+}
 
-	// Send initial reconciliation: full current state
-	if err := s.sendWSReconciliation(client, ws, r); err != nil {
-		slog.Error("Failed to send reconciliation", "error", err, "workspaceID", workspaceID)
-		return
+// commandHistoryLimit is the maximum number of suggestions of hxHandleCommandHistory.
+const commandHistoryLimit = 10
+
+// hxHandleCommandHistory returns the previous commands of the workspace which fuzzy match the
+// "command" parameter, most recent first, with their run statistics. The execute form shows
+// them as autocomplete dropdown.
+func (s *Server) hxHandleCommandHistory(ctx context.Context, r *http.Request) ([]byte, error) {
+	workspaceID := r.PathValue("id")
+	ws, err := s.getWorkspace(r, workspaceID)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
 
-	// Create a ticker for periodic process checks (for detecting finished processes)
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
+	commands, err := workspace.SearchHistory(ws, r.FormValue("command"), commandHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := workspace.CommandStatistics(ws)
+	if err != nil {
+		return nil, err
+	}
 
-	// Track known process IDs and their states
-	knownProcesses := make(map[string]bool) // processID -> completed status
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "hx-command-history.gohtml", map[string]interface{}{
+		"Commands": commands,
+		"Stats":    stats,
+	})
+	return buf.Bytes(), err
+}
 
-	// Main loop for periodic checks
-	for {
-		select {
-		case <-client.Done:
-			return
-		case <-ticker.C:
-			// Periodic check for process state changes
-			if err := s.checkWSProcessUpdates(client, ws, r, knownProcesses); err != nil {
-				slog.Error("Failed to check process updates", "error", err)
-				return
-			}
+// processStartTimeout is the maximum time hxHandleExecute waits for the nohup supervisor.
+const processStartTimeout = 3 * time.Second
+
+// processPollInterval is the interval in which waitForProcess reads the process directory.
+const processPollInterval = 50 * time.Millisecond
+
+func (s *Server) hxHandleExecute(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	// The form confirms with hx-confirm and sends confirm_production with hx-vals
+	if err := s.checkProductionConfirmed(r); err != nil {
+		return nil, err
+	}
+	proc, err := s.executeForm(r)
+	if he, ok := err.(httperror.HTTPError); ok && he.StatusCode == http.StatusForbidden {
+		// The policy of the workspace denied the command, show the reason above the form
+		return []byte(`<div hx-swap-oob="innerHTML:#execute-error"><div class="alert alert-danger mt-3 mb-0" role="alert">` +
+			html.EscapeString(he.Message) + `</div></div>`), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	workspaceID := r.PathValue("id")
+
+	// Render the process from its persisted state instead of an optimistic
+	// placeholder, so the card does not disappear on the next refresh
+	proc, err = waitForProcessStart(ctx, proc.ProcessDir)
+	if err != nil {
+		return nil, err
+	}
+	if proc.Completed {
+		html, err := s.renderFinishedProcessSnippet(proc, workspaceID, r)
+		if err != nil {
+			return nil, err
 		}
+		return []byte(`<div hx-swap-oob="afterbegin:#finished-processes">` + html + `</div>`), nil
+	}
+	html, err := s.renderRunningProcessSnippet(proc, workspaceID, r)
+	if err != nil {
+		return nil, err
 	}
+	return []byte(html), nil
 }
 
-// sendReconciliationEvents sends the full current state to a new SSE client
-// sendWSReconciliation sends the full current state to a new WebSocket client
-func (s *Server) sendWSReconciliation(client *wshub.Client, ws *workspace.Workspace, r *http.Request) error {
-	allProcesses, err := workspace.ListProcesses(ws)
+// handleExecute is the fallback of hxHandleExecute for browsers without JavaScript. It starts
+// the command and redirects to the process page. Commands in production workspaces need the
+// confirmation checkbox, which the form only shows without JavaScript.
+func (s *Server) handleExecute(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	if err := s.checkProductionConfirmed(r); err != nil {
+		return nil, err
+	}
+	proc, err := s.executeForm(r)
 	if err != nil {
-		return fmt.Errorf("failed to list processes: %w", err)
+		return nil, err
 	}
+	return nil, &redirectError{url: s.processURL(r, proc.ProcessDir), statusCode: http.StatusSeeOther}
+}
 
-	// Send running processes
-	var runningProcesses []*process.Process
-	for _, p := range allProcesses {
-		if !p.Completed {
-			// Check if actually running
-			if p.PID > 0 {
-				process, err := os.FindProcess(p.PID)
-				if err == nil {
-					err = process.Signal(syscall.Signal(0))
-					if err != nil {
-						// Dead process, skip
-						continue
-					}
-				}
-			}
-			runningProcesses = append(runningProcesses, p)
+// checkProductionConfirmed returns an error if the workspace of the request is a production
+// workspace, and the form value "confirm_production" is not set.
+func (s *Server) checkProductionConfirmed(r *http.Request) error {
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	if ws.IsProduction() && r.FormValue("confirm_production") == "" {
+		return httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Confirm to run the command in the production workspace"}
+	}
+	return nil
+}
+
+// executeForm starts the command of the execute form in the workspace of the request.
+func (s *Server) executeForm(r *http.Request) (*process.Process, error) {
+	command := r.FormValue("command")
+	if command == "" {
+		command = "bash"
+	}
+
+	// Get workspace ID from path parameter
+	workspaceID := r.PathValue("id")
+	if workspaceID == "" {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Workspace ID is required"}
+	}
+
+	// Get the workspace
+	ws, err := s.getWorkspace(r, workspaceID)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+
+	profile := r.FormValue("profile")
+	if _, err := ws.PreCommandForProfile(profile); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+	tags, err := process.ParseTags(r.FormValue("tags"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+	limits, err := process.ParseLimits(r.FormValue("timeout"), r.FormValue("cpu_limit"), r.FormValue("memory_limit"), r.FormValue("nice"), r.FormValue("io_priority"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	// Each line of next_steps is a pipeline step which runs after the command
+	commands := []string{command}
+	for _, line := range strings.Split(r.FormValue("next_steps"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			commands = append(commands, line)
 		}
 	}
+	var proc *process.Process
+	if len(commands) > 1 {
+		condition := r.FormValue("next_condition")
+		if condition != process.PipelineOnSuccess && condition != process.PipelineAlways {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Invalid pipeline condition"}
+		}
+		proc, err = s.executor.ExecutePipeline(ws, commands, condition, profile, limits)
+	} else {
+		proc, err = s.executor.Execute(ws, command, profile, limits)
+	}
+	if err != nil {
+		return nil, s.commandDeniedError(r, ws.ID, err)
+	}
+	s.recordAudit(r, audit.Entry{Action: audit.ActionExecute, Workspace: ws.ID, Process: proc.CommandId, Detail: strings.Join(commands, "\n")})
+	if err := process.SaveTags(proc, tags); err != nil {
+		return nil, err
+	}
+	if err := workspace.AppendHistory(ws, command); err != nil {
+		slog.Error("Failed to append command history", "workspace", ws.ID, "error", err)
+	}
+	return proc, nil
+}
 
-	// Sort by start time
-	sort.Slice(runningProcesses, func(i, j int) bool {
-		return runningProcesses[i].StartTime.Before(runningProcesses[j].StartTime)
+// commandDeniedError records a command which the policy of the workspace denied in the audit
+// log, and returns a 403 error with the reason. Other errors are returned as they are.
+func (s *Server) commandDeniedError(r *http.Request, workspaceID string, err error) error {
+	if !errors.Is(err, workspace.ErrCommandDenied) {
+		return err
+	}
+	s.recordAudit(r, audit.Entry{Action: audit.ActionExecuteDenied, Workspace: workspaceID, Detail: err.Error()})
+	return httperror.HTTPError{StatusCode: http.StatusForbidden, Message: err.Error()}
+}
+
+// waitForProcessStart waits until the nohup supervisor has written the pid or the
+// process completed. Queued processes don't start yet.
+func waitForProcessStart(ctx context.Context, processDir string) (*process.Process, error) {
+	return waitForProcess(ctx, processDir, processStartTimeout, func(p *process.Process) bool {
+		return p.PID != 0 || p.Completed || p.Queued
 	})
+}
 
-	// Send each running process as a reconcile message
-	for _, p := range runningProcesses {
-		html, err := s.renderRunningProcessSnippet(p, ws.ID, r)
+// waitForProcess polls the process directory until done returns true for the persisted
+// state. After the timeout, or when ctx is done, the state read last gets returned.
+func waitForProcess(ctx context.Context, processDir string, timeout time.Duration, done func(*process.Process) bool) (*process.Process, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(processPollInterval)
+	defer ticker.Stop()
+	for {
+		proc, err := process.LoadProcessFromDir(processDir)
 		if err != nil {
-			slog.Error("Failed to render running process", "error", err)
-			continue
+			return nil, err
 		}
-
-		msg := wshub.Message{
-			Type: "reconcile_running",
-			Data: map[string]interface{}{
-				"id":   p.CommandId,
-				"html": html,
-			},
+		if done(proc) {
+			return proc, nil
 		}
-
 		select {
-		case client.SendChan <- msg:
-		case <-client.Done:
-			return fmt.Errorf("client disconnected during reconciliation")
+		case <-ctx.Done():
+			return proc, nil
+		case <-ticker.C:
 		}
 	}
+}
 
-	// Send reconcile_done message
-	msg := wshub.Message{
-		Type: "reconcile_done",
-		Data: map[string]interface{}{
-			"count": len(runningProcesses),
-		},
+// defaultWaitTimeout and maxWaitTimeout limit the "timeout" parameter of apiHandleWaitProcess.
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 10 * time.Minute
+)
+
+// waitResult is the JSON response of apiHandleWaitProcess.
+type waitResult struct {
+	ID        string     `json:"id"`
+	Command   string     `json:"command"`
+	Completed bool       `json:"completed"`
+	TimedOut  bool       `json:"timed_out"`
+	ExitCode  *int       `json:"exit_code"`
+	Signal    string     `json:"signal,omitempty"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+}
+
+// apiHandleWaitProcess blocks until the process finished or the "timeout" parameter
+// (default 30s) passed, then it returns the status as JSON. Scripts use it to act on the
+// exit code without busy polling. The optional "workspace" parameter restricts the search
+// to one workspace.
+func (s *Server) apiHandleWaitProcess(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodGet {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
 	}
 
-	select {
-	case client.SendChan <- msg:
-	case <-client.Done:
-		return fmt.Errorf("client disconnected during reconciliation")
+	timeout := defaultWaitTimeout
+	if param := r.URL.Query().Get("timeout"); param != "" {
+		var err error
+		timeout, err = time.ParseDuration(param)
+		if err != nil || timeout < 0 || timeout > maxWaitTimeout {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid timeout, use a duration like 30s up to %s", maxWaitTimeout)}
+		}
 	}
 
-	return nil
-}
+	processDir, err := workspace.FindProcessDir(s.stateDir, r.URL.Query().Get("workspace"), r.PathValue("id"))
+	if err == nil && !canAccessProcess(r, processDir) {
+		err = fmt.Errorf("process %q not found", r.PathValue("id"))
+	}
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
+	}
+	proc, err := waitForProcess(ctx, processDir, timeout, func(p *process.Process) bool {
+		return p.Completed
+	})
+	if err != nil {
+		return nil, err
+	}
 
-// checkWSProcessUpdates checks for process state changes and sends updates via WebSocket
-func (s *Server) checkWSProcessUpdates(client *wshub.Client, ws *workspace.Workspace, r *http.Request, knownProcesses map[string]bool) error {
-	allProcesses, err := workspace.ListProcesses(ws)
+	result := waitResult{
+		ID:        proc.CommandId,
+		Command:   proc.Command,
+		Completed: proc.Completed,
+		TimedOut:  !proc.Completed,
+		Signal:    proc.Signal,
+		StartTime: proc.StartTime,
+	}
+	if proc.Completed {
+		result.ExitCode = &proc.ExitCode
+		result.EndTime = &proc.EndTime
+	}
+	data, err := json.Marshal(result)
 	if err != nil {
-		return fmt.Errorf("failed to list processes: %w", err)
+		return nil, err
 	}
+	return nil, &contentTypeError{contentType: "application/json", data: data}
+}
 
-	// Build map of current process states
-	currentProcesses := make(map[string]bool) // processID -> completed status
+// executeResult is the JSON response of apiHandleExecute.
+type executeResult struct {
+	ID        string `json:"id"`
+	Workspace string `json:"workspace"`
+	Command   string `json:"command"`
+	Queued    bool   `json:"queued,omitempty"` // The process waits for a free slot of the workspace
+}
 
-	for _, p := range allProcesses {
+// apiHandleExecute starts a command in the workspace. It takes the form values of the
+// execute form, like "command", "profile" and "timeout". Production workspaces need
+// "confirm_production". The response is the ID of the process as JSON, its output can be
+// followed with apiHandleProcessOutput.
+func (s *Server) apiHandleExecute(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	if err := s.checkProductionConfirmed(r); err != nil {
+		return nil, err
+	}
+	proc, err := s.executeForm(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(executeResult{ID: proc.CommandId, Workspace: r.PathValue("id"), Command: proc.Command, Queued: proc.Queued})
+	if err != nil {
+		return nil, err
+	}
+	return nil, &contentTypeError{contentType: "application/json", data: data}
+}
 
-		currentProcesses[p.CommandId] = p.Completed
+// outputResult is the JSON response of apiHandleProcessOutput.
+type outputResult struct {
+	Chunks    []outputRangeChunk `json:"chunks"`    // Of stdout and stderr
+	Offset    int64              `json:"offset"`    // Pass it to the next request
+	Completed bool               `json:"completed"` // The process finished and all output was returned
+	ExitCode  *int               `json:"exit_code"`
+	Signal    string             `json:"signal,omitempty"`
+}
 
-		wasKnown, existed := knownProcesses[p.CommandId]
+// apiHandleProcessOutput returns the stdout and stderr of a process from the byte "offset"
+// of its output log on, as JSON. Without new output, it waits until there is some or the
+// process finished, for at most "timeout" (default 30s). The response contains the offset
+// for the next request, and "completed" when all output was returned. The optional
+// "workspace" parameter restricts the search to one workspace, the optional "stream"
+// parameter returns only this stream instead of stdout and stderr.
+func (s *Server) apiHandleProcessOutput(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodGet {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	query := r.URL.Query()
+	var offset int64
+	if param := query.Get("offset"); param != "" {
+		var err error
+		offset, err = strconv.ParseInt(param, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid offset: %q", param)}
+		}
+	}
+	timeout := defaultWaitTimeout
+	if param := query.Get("timeout"); param != "" {
+		var err error
+		timeout, err = time.ParseDuration(param)
+		if err != nil || timeout < 0 || timeout > maxWaitTimeout {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid timeout, use a duration like 30s up to %s", maxWaitTimeout)}
+		}
+	}
 
-		if !existed {
-			// New process - we haven't seen it before
-			if !p.Completed {
-				// New running process
-				html, err := s.renderRunningProcessSnippet(p, ws.ID, r)
-				if err != nil {
-					slog.Error("Failed to render new process", "error", err)
-					continue
-				}
+	stream := query.Get("stream")
+	if stream != "" && !outputlog.IsValidStreamName(stream) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid stream: %q", stream)}
+	}
 
-				msg := wshub.Message{
-					Type: "process_started",
-					Data: map[string]interface{}{
-						"id":   p.CommandId,
-						"html": html,
-					},
-				}
+	processDir, err := workspace.FindProcessDir(s.stateDir, query.Get("workspace"), r.PathValue("id"))
+	if err == nil && !canAccessProcess(r, processDir) {
+		err = fmt.Errorf("process %q not found", r.PathValue("id"))
+	}
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
+	}
+	// The state is read before the output, so that a completed process has written all of it
+	proc, err := waitForProcess(ctx, processDir, timeout, func(p *process.Process) bool {
+		info, err := os.Stat(p.OutputFile)
+		return p.Completed || (err == nil && info.Size() > offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	chunks, next, err := outputlog.ReadChunks(proc.OutputFile, offset, outputWindowSize)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
 
-				select {
-				case client.SendChan <- msg:
-				case <-client.Done:
-					return fmt.Errorf("client disconnected")
+	result := outputResult{Chunks: []outputRangeChunk{}, Offset: next, Signal: proc.Signal}
+	for _, chunk := range chunks {
+		if chunk.Stream == stream || (stream == "" && (chunk.Stream == outputlog.StreamStdout || chunk.Stream == outputlog.StreamStderr)) {
+			result.Chunks = append(result.Chunks, outputRangeChunk{Stream: chunk.Stream, Timestamp: chunk.Timestamp, Text: string(chunk.Line)})
+		}
+	}
+	if proc.Completed && len(chunks) == 0 {
+		result.Completed = true
+		result.ExitCode = &proc.ExitCode
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &contentTypeError{contentType: "application/json", data: data}
+}
+
+func (s *Server) jsonHandleProcessUpdates(ctx context.Context, r *http.Request) ([]byte, error) {
+	// Get workspace ID from path parameter
+	workspaceID := r.PathValue("id")
+	if workspaceID == "" {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Workspace ID is required"}
+	}
+
+	// Parse query parameters to get current process IDs
+	processIDsParam := r.URL.Query().Get("process_ids")
+	var processIDs []string
+	if processIDsParam != "" {
+		processIDs = strings.Split(processIDsParam, ",")
+	}
+
+	// Get the workspace
+	ws, err := s.getWorkspace(r, workspaceID)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+
+	allProcesses, err := workspace.ListProcesses(ws)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build map of received process IDs for quick lookup
+	receivedIDs := make(map[string]bool)
+	for _, id := range processIDs {
+		receivedIDs[id] = true
+	}
+
+	// Response structure
+	type ProcessUpdate struct {
+		ID         string `json:"id"`
+		Status     string `json:"status"` // "running", "finished", "new", "unknown"
+		HTML       string `json:"html"`
+		OutputHTML string `json:"output_html,omitempty"` // For running processes - HTML content for output div
+	}
+
+	var updates []ProcessUpdate
+
+	// Check each received ID to see if it's still running or finished
+	for _, id := range processIDs {
+		found := false
+		for _, p := range allProcesses {
+			if p.CommandId == id {
+				found = true
+
+				if p.Completed {
+					// Render finished process HTML (view only, like initial page load)
+					html, err := s.renderFinishedProcessSnippet(p, workspaceID, r)
+					if err != nil {
+						slog.Error("Failed to render finished process", "error", err, "id", p.CommandId)
+						continue
+					}
+					updates = append(updates, ProcessUpdate{
+						ID:     id,
+						Status: "finished",
+						HTML:   html,
+					})
+				} else {
+					// Process is still running - send output update
+					outputHTML, err := s.renderProcessOutputHTML(p, workspaceID, r)
+					if err != nil {
+						slog.Error("Failed to render process output", "error", err, "id", p.CommandId)
+						continue
+					}
+					updates = append(updates, ProcessUpdate{
+						ID:         id,
+						Status:     "running",
+						OutputHTML: outputHTML,
+					})
 				}
+				break
 			}
-			// If new and already completed, ignore (it finished before we started monitoring)
-		} else if !wasKnown && p.Completed {
-			// Process transition: was not completed before (!wasKnown means knownProcesses[p.ID]=false),
-			// now completed (p.Completed=true)
-			msg := wshub.Message{
-				Type: "process_finished",
-				Data: map[string]interface{}{
-					"id": p.CommandId,
-				},
+		}
+		if !found {
+			// ID is unknown (process may have been deleted)
+			slog.Warn("Unknown process ID in update request", "id", id)
+			updates = append(updates, ProcessUpdate{
+				ID:     id,
+				Status: "unknown",
+				HTML:   "",
+			})
+		}
+	}
+
+	// Check for new running processes not in the received list
+	var runningProcesses []*process.Process
+	for _, p := range allProcesses {
+		if !p.Completed && !receivedIDs[p.CommandId] {
+			// Check if actually running
+			if p.PID > 0 && !p.Alive() {
+				// Dead process, skip
+				continue
 			}
+			runningProcesses = append(runningProcesses, p)
+		}
+	}
+
+	// Sort new running processes by start time (oldest first, to maintain creation order)
+	sort.Slice(runningProcesses, func(i, j int) bool {
+		return runningProcesses[i].StartTime.Before(runningProcesses[j].StartTime)
+	})
+
+	// Add new running processes to updates
+	for _, p := range runningProcesses {
+		html, err := s.renderRunningProcessSnippet(p, workspaceID, r)
+		if err != nil {
+			slog.Error("Failed to render new running process", "error", err, "id", p.CommandId)
+			continue
+		}
+		updates = append(updates, ProcessUpdate{
+			ID:     p.CommandId,
+			Status: "new",
+			HTML:   html,
+		})
+	}
+
+	// Return JSON response
+	responseData, err := json.Marshal(map[string]interface{}{
+		"updates": updates,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return responseData, nil
+}
+
+func (s *Server) renderRunningProcessSnippet(p *process.Process, workspaceID string, r *http.Request) (string, error) {
+	var buf bytes.Buffer
+	err := s.tmpl.ExecuteTemplate(&buf, "hx-running-process-single.gohtml", map[string]interface{}{
+		"Process":     p,
+		"BasePath":    s.getBasePath(r),
+		"WorkspaceID": workspaceID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (s *Server) renderFinishedProcessSnippet(p *process.Process, workspaceID string, r *http.Request) (string, error) {
+	var buf bytes.Buffer
+	err := s.tmpl.ExecuteTemplate(&buf, "hx-finished-process-single.gohtml", map[string]interface{}{
+		"Process":     p,
+		"BasePath":    s.getBasePath(r),
+		"WorkspaceID": workspaceID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// handleWSProcessUpdates handles WebSocket connections for workspace process updates
+func (s *Server) handleWSProcessUpdates(w http.ResponseWriter, r *http.Request) {
+	// Get workspace ID from path parameter
+	workspaceID := r.PathValue("id")
+	if workspaceID == "" {
+		slog.Error("WebSocket: Workspace ID is required")
+		http.Error(w, "Workspace ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Verify workspace exists
+	ws, err := s.getWorkspace(r, workspaceID)
+	if err != nil {
+		slog.Error("WebSocket: Workspace not found", "workspaceID", workspaceID, "error", err)
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return
+	}
+
+	// Upgrade to WebSocket
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("Failed to upgrade to WebSocket", "error", err)
+		return
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			slog.Error("Failed to close WebSocket connection", "error", err)
+		}
+	}()
+
+	// Create WebSocket client
+	clientID := fmt.Sprintf("%s-%d", workspaceID, time.Now().UnixNano())
+	client := &wshub.Client{
+		ID:          clientID,
+		WorkspaceID: workspaceID,
+		Conn:        conn,
+		SendChan:    make(chan wshub.Message, 100),
+		Done:        make(chan struct{}),
+	}
+
+	// Register client with hub
+	s.wsHub.RegisterClient(client)
+	defer s.wsHub.UnregisterClient(clientID)
+	defer close(client.Done)
 
+	// Start goroutine to write messages to WebSocket
+	go func() {
+		for {
 			select {
-			case client.SendChan <- msg:
+			case msg := <-client.SendChan:
+				if err := conn.WriteJSON(msg); err != nil {
+					slog.Error("Failed to write WebSocket message", "error", err)
+					return
+				}
 			case <-client.Done:
-				return fmt.Errorf("client disconnected")
+				return
 			}
-		} else if !p.Completed {
-			// Running process - check if we should send update (rate limiting)
-			minInterval := 500 * time.Millisecond // 2 updates per second max per process
-			if s.wsHub.ShouldSendUpdate(p.CommandId, minInterval) {
-				outputHTML, err := s.renderProcessOutputHTML(p, ws.ID, r)
-				if err != nil {
-					slog.Error("Failed to render process output", "error", err)
-					continue
-				}
+		}
+	}()
+
+	// Send initial reconciliation: full current state
+	if err := s.sendWSReconciliation(client, ws, r); err != nil {
+		slog.Error("Failed to send reconciliation", "error", err, "workspaceID", workspaceID)
+		return
+	}
+
+	// Create a ticker for periodic process checks (for detecting finished processes)
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	// Track known process IDs and their states
+	knownProcesses := make(map[string]bool) // processID -> completed status
+
+	// Main loop for periodic checks
+	for {
+		select {
+		case <-client.Done:
+			return
+		case <-ticker.C:
+			// Periodic check for process state changes
+			if err := s.checkWSProcessUpdates(client, ws, r, knownProcesses); err != nil {
+				slog.Error("Failed to check process updates", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// sendReconciliationEvents sends the full current state to a new SSE client
+// sendWSReconciliation sends the full current state to a new WebSocket client
+func (s *Server) sendWSReconciliation(client *wshub.Client, ws *workspace.Workspace, r *http.Request) error {
+	allProcesses, err := workspace.ListProcesses(ws)
+	if err != nil {
+		return fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	// Send running processes
+	var runningProcesses []*process.Process
+	for _, p := range allProcesses {
+		if !p.Completed {
+			// Check if actually running
+			if p.PID > 0 && !p.Alive() {
+				// Dead process, skip
+				continue
+			}
+			runningProcesses = append(runningProcesses, p)
+		}
+	}
+
+	// Sort by start time
+	sort.Slice(runningProcesses, func(i, j int) bool {
+		return runningProcesses[i].StartTime.Before(runningProcesses[j].StartTime)
+	})
+
+	// Send each running process as a reconcile message
+	for _, p := range runningProcesses {
+		html, err := s.renderRunningProcessSnippet(p, ws.ID, r)
+		if err != nil {
+			slog.Error("Failed to render running process", "error", err)
+			continue
+		}
+
+		msg := wshub.Message{
+			Type: "reconcile_running",
+			Data: map[string]interface{}{
+				"id":   p.CommandId,
+				"html": html,
+			},
+		}
+
+		select {
+		case client.SendChan <- msg:
+		case <-client.Done:
+			return fmt.Errorf("client disconnected during reconciliation")
+		}
+	}
+
+	// Send reconcile_done message
+	msg := wshub.Message{
+		Type: "reconcile_done",
+		Data: map[string]interface{}{
+			"count": len(runningProcesses),
+		},
+	}
+
+	select {
+	case client.SendChan <- msg:
+	case <-client.Done:
+		return fmt.Errorf("client disconnected during reconciliation")
+	}
+
+	return nil
+}
+
+// checkWSProcessUpdates checks for process state changes and sends updates via WebSocket
+func (s *Server) checkWSProcessUpdates(client *wshub.Client, ws *workspace.Workspace, r *http.Request, knownProcesses map[string]bool) error {
+	allProcesses, err := workspace.ListProcesses(ws)
+	if err != nil {
+		return fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	// Build map of current process states
+	currentProcesses := make(map[string]bool) // processID -> completed status
+
+	for _, p := range allProcesses {
+
+		currentProcesses[p.CommandId] = p.Completed
+
+		wasKnown, existed := knownProcesses[p.CommandId]
+
+		if !existed {
+			// New process - we haven't seen it before
+			if !p.Completed {
+				// New running process
+				html, err := s.renderRunningProcessSnippet(p, ws.ID, r)
+				if err != nil {
+					slog.Error("Failed to render new process", "error", err)
+					continue
+				}
+
+				msg := wshub.Message{
+					Type: "process_started",
+					Data: map[string]interface{}{
+						"id":   p.CommandId,
+						"html": html,
+					},
+				}
+
+				select {
+				case client.SendChan <- msg:
+				case <-client.Done:
+					return fmt.Errorf("client disconnected")
+				}
+			}
+			// If new and already completed, ignore (it finished before we started monitoring)
+		} else if !wasKnown && p.Completed {
+			// Process transition: was not completed before (!wasKnown means knownProcesses[p.ID]=false),
+			// now completed (p.Completed=true)
+			msg := wshub.Message{
+				Type: "process_finished",
+				Data: map[string]interface{}{
+					"id": p.CommandId,
+				},
+			}
+
+			select {
+			case client.SendChan <- msg:
+			case <-client.Done:
+				return fmt.Errorf("client disconnected")
+			}
+		} else if !p.Completed {
+			// Running process - check if we should send update (rate limiting)
+			minInterval := 500 * time.Millisecond // 2 updates per second max per process
+			if s.wsHub.ShouldSendUpdate(p.CommandId, minInterval) {
+				outputHTML, err := s.renderProcessOutputHTML(p, ws.ID, r)
+				if err != nil {
+					slog.Error("Failed to render process output", "error", err)
+					continue
+				}
 
 				msg := wshub.Message{
 					Type: "process_output",
@@ -1377,107 +2708,1268 @@ func (s *Server) checkWSProcessUpdates(client *wshub.Client, ws *workspace.Works
 					},
 				}
 
-				select {
-				case client.SendChan <- msg:
-				case <-client.Done:
-					return fmt.Errorf("client disconnected")
-				}
-			}
-		}
+				select {
+				case client.SendChan <- msg:
+				case <-client.Done:
+					return fmt.Errorf("client disconnected")
+				}
+			}
+		}
+	}
+
+	// Update known processes
+	for id, completed := range currentProcesses {
+		knownProcesses[id] = completed
+	}
+
+	// Clean up rate limiters for processes that no longer exist
+	var activeIDs []string
+	for id := range currentProcesses {
+		activeIDs = append(activeIDs, id)
+	}
+	s.wsHub.CleanupRateLimiters(activeIDs)
+
+	return nil
+}
+
+func (s *Server) hxHandleFinishedProcesses(ctx context.Context, r *http.Request) ([]byte, error) {
+	// Get workspace ID from path parameter
+	workspaceID := r.PathValue("id")
+	if workspaceID == "" {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Workspace ID is required"}
+	}
+
+	// Get offset from query parameter
+	offsetStr := r.URL.Query().Get("offset")
+	offset := 0
+	if offsetStr != "" {
+		if _, err := fmt.Sscanf(offsetStr, "%d", &offset); err != nil {
+			slog.Warn("Failed to parse offset parameter", "offset", offsetStr, "error", err)
+		}
+	}
+
+	// Get the workspace
+	ws, err := s.getWorkspace(r, workspaceID)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+
+	// Finished processes only, and optionally with a tag and an output type, the newest first
+	tag := r.URL.Query().Get("tag")
+	outputType := r.URL.Query().Get("type")
+	const pageSize = 10
+	paginatedProcesses, total, err := workspace.ListProcessesPage(ws, offset, pageSize, workspace.ProcessFilter{Finished: true, Tag: tag, OutputType: outputType})
+	if err != nil {
+		return nil, err
+	}
+	if offset >= total && offset > 0 {
+		// No more processes
+		return []byte{}, nil
+	}
+	newOffset := offset + len(paginatedProcesses)
+	hasMore := newOffset < total
+
+	var buf bytes.Buffer
+
+	// Use different template for initial load vs pagination
+	templateName := "hx-finished-processes-page.gohtml"
+	if offset == 0 {
+		templateName = "hx-finished-processes-initial.gohtml"
+	}
+
+	err = s.tmpl.ExecuteTemplate(&buf, templateName, map[string]interface{}{
+		"FinishedProcesses": paginatedProcesses,
+		"HasMore":           hasMore,
+		"Offset":            newOffset,
+		"BasePath":          s.getBasePath(r),
+		"WorkspaceID":       workspaceID,
+		"Production":        ws.IsProduction(),
+		"Tag":               tag,
+		"Type":              outputType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hxHandleDeleteFinishedProcesses deletes all finished processes of the workspace which ended
+// more than "days" days ago, and returns the updated list of finished processes.
+func (s *Server) hxHandleDeleteFinishedProcesses(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+
+	days, err := strconv.Atoi(r.FormValue("days"))
+	if err != nil || days < 0 {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Invalid number of days"}
+	}
+
+	before := time.Now().UTC().AddDate(0, 0, -days)
+	deleted, err := workspace.DeleteFinishedProcessesBefore(ws, before)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Deleted finished processes", "workspace", ws.ID, "days", days, "count", deleted)
+	s.recordAudit(r, audit.Entry{Action: audit.ActionProcessDelete, Workspace: ws.ID, Detail: fmt.Sprintf("%d processes older than %d days", deleted, days)})
+
+	return s.hxHandleFinishedProcesses(ctx, r)
+}
+
+// hxHandleDeleteProcess deletes a single finished process. The response is empty, so that htmx
+// removes the process card.
+// maxShareTTL limits how long a share link of a process can be valid.
+const maxShareTTL = 30 * 24 * time.Hour
+
+// hxHandleShares lists the share links of a process. A POST request creates a new link which
+// expires after the duration in the "expires" parameter, for example "24h".
+func (s *Server) hxHandleShares(ctx context.Context, r *http.Request) ([]byte, error) {
+	workspaceID := r.PathValue("id")
+	processID := r.PathValue("processID")
+	if _, err := s.getWorkspace(r, workspaceID); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	processDir := filepath.Join(s.stateDir, "workspaces", workspaceID, "processes", processID)
+	if _, err := process.LoadProcessFromDir(processDir); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
+	}
+
+	if r.Method == http.MethodPost {
+		ttl, err := time.ParseDuration(r.FormValue("expires"))
+		if err != nil || ttl <= 0 || ttl > maxShareTTL {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid expiry: %q", r.FormValue("expires"))}
+		}
+		sh, err := share.Create(s.stateDir, workspaceID, processID, ttl)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Created share link", "workspace", workspaceID, "process", processID, "share", sh.ID, "expires", sh.ExpiresAt)
+		s.recordAudit(r, audit.Entry{Action: audit.ActionShare, Workspace: workspaceID, Process: processID, Detail: "created link, expires " + sh.ExpiresAt.Format(time.RFC3339)})
+	}
+	return s.renderShares(r, workspaceID, processID)
+}
+
+// hxHandleRevokeShare deletes the share link with the ID in the "share" parameter.
+func (s *Server) hxHandleRevokeShare(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	workspaceID := r.PathValue("id")
+	processID := r.PathValue("processID")
+	if _, err := s.getWorkspace(r, workspaceID); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	shares, err := share.List(s.stateDir, workspaceID, processID)
+	if err != nil {
+		return nil, err
+	}
+	id := r.FormValue("share")
+	if !slices.ContainsFunc(shares, func(sh *share.Share) bool { return sh.ID == id }) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Share not found"}
+	}
+	if err := share.Revoke(s.stateDir, id); err != nil {
+		return nil, err
+	}
+	slog.Info("Revoked share link", "workspace", workspaceID, "process", processID, "share", id)
+	s.recordAudit(r, audit.Entry{Action: audit.ActionShare, Workspace: workspaceID, Process: processID, Detail: "revoked link"})
+	return s.renderShares(r, workspaceID, processID)
+}
+
+// shareLink is a share with its absolute URL for the hx-shares template.
+type shareLink struct {
+	*share.Share
+	URL string
+}
+
+func (s *Server) renderShares(r *http.Request, workspaceID, processID string) ([]byte, error) {
+	shares, err := share.List(s.stateDir, workspaceID, processID)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]shareLink, 0, len(shares))
+	for _, sh := range shares {
+		token, err := share.Token(s.stateDir, sh)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, shareLink{Share: sh, URL: s.absoluteBaseURL(r) + "/share/" + token})
+	}
+
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "hx-shares.gohtml", map[string]any{
+		"BasePath":    s.getBasePath(r),
+		"WorkspaceID": workspaceID,
+		"ProcessID":   processID,
+		"Shares":      links,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hxHandleWebhooks shows the webhooks of a workspace. POST with the action "add" creates one
+// from the form values url, secret and events, the action "delete" deletes the webhook "id".
+func (s *Server) hxHandleWebhooks(ctx context.Context, r *http.Request) ([]byte, error) {
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+
+	errorMessage := ""
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+		}
+		switch r.FormValue("action") {
+		case "add":
+			h, err := webhook.Add(ws, strings.TrimSpace(r.FormValue("url")), r.FormValue("secret"), r.Form["events"])
+			if err != nil {
+				errorMessage = err.Error()
+				break
+			}
+			slog.Info("Added webhook", "workspace", ws.ID, "webhook", h.ID, "url", h.URL)
+			s.recordAudit(r, audit.Entry{Action: audit.ActionWorkspaceChange, Workspace: ws.ID, Detail: "added webhook " + h.URL})
+		case "delete":
+			if err := webhook.Delete(ws, r.FormValue("webhook")); err != nil {
+				return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
+			}
+			slog.Info("Deleted webhook", "workspace", ws.ID, "webhook", r.FormValue("webhook"))
+			s.recordAudit(r, audit.Entry{Action: audit.ActionWorkspaceChange, Workspace: ws.ID, Detail: "deleted webhook " + r.FormValue("webhook")})
+		default:
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Unknown action"}
+		}
+	}
+
+	hooks, err := webhook.List(ws)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "hx-webhooks.gohtml", map[string]any{
+		"BasePath":    s.getBasePath(r),
+		"WorkspaceID": ws.ID,
+		"Webhooks":    hooks,
+		"Events":      webhook.Events,
+		"Error":       errorMessage,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// handleShare shows a process read-only to everybody who has a valid share link.
+func (s *Server) handleShare(ctx context.Context, r *http.Request) ([]byte, error) {
+	sh, err := share.Open(s.stateDir, r.PathValue("token"))
+	if errors.Is(err, share.ErrInvalid) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+	processDir := filepath.Join(s.stateDir, "workspaces", sh.WorkspaceID, "processes", sh.ProcessID)
+	proc, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "The process of this share link was deleted"}
+	}
+	outputData, err := s.prepareProcessOutput(proc.OutputFile, true)
+	if err != nil {
+		return nil, err
+	}
+
+	data := outputData.templateData()
+	data["BasePath"] = s.getBasePath(r)
+	data["Process"] = proc
+	data["Share"] = sh
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "share.gohtml", data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// absoluteBaseURL returns the base path with scheme and host, for links which are used outside
+// of the web UI.
+func (s *Server) absoluteBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, s.getBasePath(r))
+}
+
+// widgetTopProcesses is the number of processes listed in the sysmon widget.
+const widgetTopProcesses = 5
+
+// workspaceStatus is a workspace with its processes for the widgets.
+type workspaceStatus struct {
+	*workspace.Workspace
+	Running      []*process.Process
+	Finished     int
+	LastFinished *process.Process // nil if no process finished yet
+}
+
+// workspaceStatuses returns the status of the workspaces which are not archived, and which the
+// user of the request can access, sorted by name.
+func (s *Server) workspaceStatuses(r *http.Request) ([]workspaceStatus, error) {
+	workspaces, err := workspace.ListWorkspacesMatching(s.stateDir, workspace.WorkspaceFilter{})
+	if err != nil {
+		return nil, err
+	}
+	workspaces = slices.DeleteFunc(workspaces, func(ws *workspace.Workspace) bool { return !canAccess(r, ws) })
+	statuses := make([]workspaceStatus, 0, len(workspaces))
+	for _, ws := range workspaces {
+		processes, err := workspace.ListProcesses(ws)
+		if err != nil {
+			return nil, err
+		}
+		status := workspaceStatus{Workspace: ws}
+		for _, p := range processes {
+			if !p.Completed {
+				status.Running = append(status.Running, p)
+				continue
+			}
+			status.Finished++
+			if status.LastFinished == nil || p.EndTime.After(status.LastFinished.EndTime) {
+				status.LastFinished = p
+			}
+		}
+		sort.Slice(status.Running, func(i, j int) bool {
+			return status.Running[i].StartTime.After(status.Running[j].StartTime)
+		})
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses, nil
+}
+
+// handleWidget renders an HTML fragment which third-party dashboards can embed. It uses a
+// widget token instead of the session cookie, see widgetMiddleware.
+func (s *Server) handleWidget(ctx context.Context, r *http.Request) ([]byte, error) {
+	widget := r.PathValue("name")
+	data := map[string]any{
+		"Widget":  widget,
+		"BaseURL": s.absoluteBaseURL(r),
+		"Now":     time.Now().UTC(),
+	}
+	switch widget {
+	case "running-processes", "workspaces":
+		statuses, err := s.workspaceStatuses(r)
+		if err != nil {
+			return nil, err
+		}
+		data["Workspaces"] = statuses
+	case "sysmon":
+		// The system processes are the ones of all users, like on the sysmon page
+		if requestUser(r) != auth.AdminUser {
+			return nil, httperror.HTTPError{StatusCode: http.StatusForbidden, Message: "Only widget tokens of the admin can show the sysmon widget"}
+		}
+		processes, err := sysmon.GetUserProcesses(sysmon.GopsutilProvider{}, uint32(os.Getuid()))
+		if err != nil {
+			return nil, err
+		}
+		data["Summary"] = sysmon.Summarize(processes, widgetTopProcesses)
+	default:
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Unknown widget"}
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "widgets.gohtml", data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonHandleReplicationManifest lists the files of the workspaces which changed since ?since=,
+// for a standby instance. See package replication.
+func (s *Server) jsonHandleReplicationManifest(ctx context.Context, r *http.Request) ([]byte, error) {
+	var since time.Time
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, sinceParam)
+		if err != nil {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid since: %q", sinceParam)}
+		}
+	}
+	manifest, err := replication.ReadManifest(s.stateDir, since)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &contentTypeError{contentType: "application/json", data: data}
+}
+
+// handleReplicationFile returns the bytes of a file of the workspaces from ?offset= on, for a
+// standby instance.
+func (s *Server) handleReplicationFile(ctx context.Context, r *http.Request) ([]byte, error) {
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid offset: %q", r.URL.Query().Get("offset"))}
+	}
+	data, err := replication.ReadFile(s.stateDir, r.URL.Query().Get("path"), offset)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "File not found"}
+	}
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+	return nil, &contentTypeError{contentType: "application/octet-stream", data: data}
+}
+
+// hxHandleProcessTags replaces the tags of a process and returns the new tag badges.
+func (s *Server) hxHandleProcessTags(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	processDir, err := workspace.FindProcessDir(s.stateDir, r.PathValue("id"), r.PathValue("processID"))
+	if err != nil || !canAccessProcess(r, processDir) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Process not found"}
+	}
+	proc, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := process.ParseTags(r.FormValue("tags"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err := process.SaveTags(proc, tags); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "hx-process-tags.gohtml", proc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// handleClipboard shows the snippets of the server clipboard. POST adds a snippet.
+func (s *Server) handleClipboard(ctx context.Context, r *http.Request) ([]byte, error) {
+	basePath := s.getBasePath(r)
+	dir, err := s.userStateDir(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Method == http.MethodPost {
+		if _, err := clipboard.Add(dir, r.FormValue("text")); err != nil {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+		}
+		return nil, &redirectError{url: basePath + "/clipboard", statusCode: http.StatusSeeOther}
+	}
+	snippets, err := clipboard.List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "clipboard.gohtml", map[string]any{
+		"BasePath":    basePath,
+		"Snippets":    snippets,
+		"MaxSnippets": clipboard.MaxSnippets,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// handleSettings shows and saves the server settings, for now the lifetime of sessions. The
+// page has the form of the export, too. Invalid values are shown as error, the stored settings
+// stay unchanged then.
+func (s *Server) handleSettings(ctx context.Context, r *http.Request) ([]byte, error) {
+	basePath := s.getBasePath(r)
+	data := map[string]any{
+		"BasePath":           basePath,
+		"Session":            auth.LoadSessionConfig(s.stateDir),
+		"MinSessionDuration": auth.MinSessionDuration,
+		"MaxSessionLifetime": auth.MaxSessionLifetime,
+		"Terminal":           terminal.LoadPolicy(s.stateDir),
+		"MinTerminalTimeout": terminal.MinPolicyTimeout,
+		"Notify":             notify.LoadConfig(s.stateDir),
+	}
+	subs, err := webpush.List(s.stateDir)
+	if err != nil {
+		return nil, err
+	}
+	data["PushSubscriptions"] = subs
+	if rules := notify.LoadConfig(s.stateDir).Rules; len(rules) > 0 {
+		data["NotifyRulesYAML"], err = config.NotifyRulesYAML(rules)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.Method == http.MethodPost && r.FormValue("section") == "notify" {
+		config, err := parseNotifyConfig(r, notify.LoadConfig(s.stateDir))
+		if err == nil {
+			err = notify.SaveConfig(s.stateDir, config)
+		}
+		if err == nil {
+			s.recordAudit(r, audit.Entry{Action: audit.ActionSettings, Detail: cmp.Or(r.FormValue("section"), "sessions")})
+			return nil, &redirectError{url: basePath + "/settings", statusCode: http.StatusSeeOther}
+		}
+		data["NotifyError"] = err.Error()
+		data["Notify"] = config
+	} else if r.Method == http.MethodPost && r.FormValue("section") == "notify-test" {
+		backends := notify.Backends(s.stateDir, notify.LoadConfig(s.stateDir))
+		now := time.Now().UTC()
+		err := notify.Send(ctx, backends, notify.Event{
+			Reason:    notify.ReasonTest,
+			Workspace: "MobileShell",
+			Command:   "test notification from the settings page",
+			StartTime: now,
+			EndTime:   now,
+			Duration:  "0s",
+		})
+		switch {
+		case len(backends) == 0:
+			data["NotifyError"] = "No notification service is configured"
+		case err != nil:
+			data["NotifyError"] = err.Error()
+		default:
+			data["NotifyResult"] = fmt.Sprintf("Sent a test notification to %d service(s)", len(backends))
+		}
+	} else if r.Method == http.MethodPost && r.FormValue("section") == "push-remove" {
+		if err := webpush.Unsubscribe(s.stateDir, r.FormValue("id")); err != nil {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+		}
+		s.recordAudit(r, audit.Entry{Action: audit.ActionSettings, Detail: cmp.Or(r.FormValue("section"), "sessions")})
+		return nil, &redirectError{url: basePath + "/settings", statusCode: http.StatusSeeOther}
+	} else if r.Method == http.MethodPost && r.FormValue("section") == "terminal" {
+		var policy terminal.Policy
+		err := parseDurationFields(map[string]*time.Duration{
+			"idle_timeout":          &policy.IdleTimeout,
+			"terminal_max_lifetime": &policy.MaxLifetime,
+		}, r)
+		if err == nil {
+			err = terminal.SavePolicy(s.stateDir, policy)
+		}
+		if err == nil {
+			s.recordAudit(r, audit.Entry{Action: audit.ActionSettings, Detail: cmp.Or(r.FormValue("section"), "sessions")})
+			return nil, &redirectError{url: basePath + "/settings", statusCode: http.StatusSeeOther}
+		}
+		data["TerminalError"] = err.Error()
+		data["Terminal"] = policy
+	} else if r.Method == http.MethodPost {
+		var config auth.SessionConfig
+		err := parseDurationFields(map[string]*time.Duration{
+			"duration":      &config.Duration,
+			"extend_within": &config.ExtendWithin,
+			"max_lifetime":  &config.MaxLifetime,
+		}, r)
+		if err == nil {
+			err = auth.SaveSessionConfig(s.stateDir, config)
+		}
+		if err == nil {
+			s.recordAudit(r, audit.Entry{Action: audit.ActionSettings, Detail: cmp.Or(r.FormValue("section"), "sessions")})
+			return nil, &redirectError{url: basePath + "/settings", statusCode: http.StatusSeeOther}
+		}
+		data["Error"] = err.Error()
+		data["Session"] = config
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "settings.gohtml", data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// handleExport downloads the signed audit log or command history, see package export. The
+// query parameters are kind, format, from, to (dates like 2006-01-02, to is included) and
+// workspace.
+func (s *Server) handleExport(ctx context.Context, r *http.Request) ([]byte, error) {
+	query := r.URL.Query()
+	opts := export.Options{
+		Kind:      query.Get("kind"),
+		Format:    query.Get("format"),
+		Workspace: query.Get("workspace"),
+	}
+	switch user := requestUser(r); user {
+	case "":
+		return nil, errNoUser
+	case auth.AdminUser:
+	default:
+		opts.User = user
+	}
+	var err error
+	opts.From, opts.To, err = export.ParseRange(query.Get("from"), query.Get("to"))
+	if err == nil {
+		err = opts.Validate()
+	}
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	var buf bytes.Buffer
+	if err := export.Write(s.stateDir, &buf, opts); err != nil {
+		return nil, err
+	}
+	contentType := "text/csv"
+	if opts.Format == export.FormatJSON {
+		contentType = "application/json"
+	}
+	return nil, &downloadError{
+		contentType: contentType,
+		filename:    fmt.Sprintf("mobileshell-%s-%s.%s", opts.Kind, time.Now().UTC().Format("20060102-150405"), opts.Format),
+		data:        buf.Bytes(),
+	}
+}
+
+// handleWorkspaceExport downloads the workspace with its processes and output logs as
+// tar.gz, see workspace.Export.
+func (s *Server) handleWorkspaceExport(ctx context.Context, r *http.Request) ([]byte, error) {
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	var buf bytes.Buffer
+	if err := workspace.Export(ws, &buf); err != nil {
+		return nil, err
+	}
+	return nil, &downloadError{
+		contentType: "application/gzip",
+		filename:    fmt.Sprintf("mobileshell-workspace-%s-%s.tar.gz", ws.ID, time.Now().UTC().Format("20060102-150405")),
+		data:        buf.Bytes(),
+	}
+}
+
+// handleWorkspaceArchive archives the workspace, or unarchives it if the field "archived" is
+// "false", see workspace.SaveArchived. Only who can share the workspace can do it.
+func (s *Server) handleWorkspaceArchive(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	if !canShare(r, ws) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusForbidden, Message: "Only the owner of the workspace can archive it"}
+	}
+	archived := r.FormValue("archived") != "false"
+	if err := workspace.SaveArchived(ws, archived); err != nil {
+		return nil, err
+	}
+	detail := "archived"
+	if !archived {
+		detail = "unarchived"
+	}
+	s.recordAudit(r, audit.Entry{Action: audit.ActionWorkspaceChange, Workspace: ws.ID, Detail: detail})
+	return nil, &redirectError{url: fmt.Sprintf("%s/workspaces/%s", s.getBasePath(r), ws.ID), statusCode: http.StatusSeeOther}
+}
+
+// handleWorkspaceImport adds the workspace of an uploaded export, see workspace.Import. The
+// multipart form has the fields id and directory, which must come before the file, so that the
+// export gets streamed from the request.
+func (s *Server) handleWorkspaceImport(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Upload an export file"}
+	}
+	var opts workspace.ImportOptions
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Upload an export file"}
+		}
+		if err != nil {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid upload: %v", err)}
+		}
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid upload: %v", err)}
+			}
+			switch part.FormName() {
+			case "id":
+				opts.ID = strings.TrimSpace(string(value))
+			case "directory":
+				opts.Directory = strings.TrimSpace(string(value))
+			}
+			continue
+		}
+		ws, err := workspace.Import(s.stateDir, part, opts)
+		if err != nil {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+		}
+		slog.Info("Imported workspace", "workspace", ws.ID, "file", part.FileName())
+		s.recordAudit(r, audit.Entry{Action: audit.ActionWorkspaceCreate, Workspace: ws.ID, Detail: "imported from " + part.FileName()})
+		return nil, &redirectError{url: s.getBasePath(r) + "/workspaces/" + ws.ID, statusCode: http.StatusSeeOther}
+	}
+}
+
+// auditPageLimit is the maximum number of entries of the audit page.
+const auditPageLimit = 500
+
+// handleAudit shows the audit log, newest first. The query parameters action, user, workspace,
+// q (substring), from and to (dates like 2006-01-02, to is included) filter it. Users other
+// than the admin only see their own entries.
+func (s *Server) handleAudit(ctx context.Context, r *http.Request) ([]byte, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Action:    query.Get("action"),
+		User:      query.Get("user"),
+		Workspace: query.Get("workspace"),
+		Query:     strings.TrimSpace(query.Get("q")),
+	}
+	// The admin can filter by user
+	var users []string
+	var err error
+	switch user := requestUser(r); user {
+	case "":
+		return nil, errNoUser
+	case auth.AdminUser:
+		if users, err = auth.Users(s.stateDir); err != nil {
+			return nil, err
+		}
+	default:
+		filter.User = user
+	}
+	var entries []audit.Entry
+	filter.From, filter.To, err = export.ParseRange(query.Get("from"), query.Get("to"))
+	if err == nil {
+		entries, err = audit.List(s.stateDir, filter, auditPageLimit)
+	}
+	errorMessage := ""
+	if err != nil {
+		errorMessage = err.Error()
+	}
+	workspaces, err := s.listWorkspaces(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "audit.gohtml", map[string]any{
+		"BasePath":   s.getBasePath(r),
+		"Actions":    audit.Actions,
+		"Users":      users,
+		"Workspaces": workspaces,
+		"Filter":     filter,
+		"From":       query.Get("from"),
+		"To":         query.Get("to"),
+		"Entries":    entries,
+		"Limit":      auditPageLimit,
+		"Error":      errorMessage,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// handleSessions lists the active sessions, and revokes the session of the "revoke" parameter
+// on POST. Users see their own sessions, the admin sees the sessions of all users.
+func (s *Server) handleSessions(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	current, err := auth.LookupSession(s.stateDir, s.getSessionToken(r))
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := auth.ListSessions(s.stateDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	user := requestUser(r)
+	if user != auth.AdminUser {
+		sessions = slices.DeleteFunc(sessions, func(session auth.Session) bool { return session.User != user })
+	}
+	basePath := s.getBasePath(r)
+
+	if r.Method == http.MethodPost {
+		id := r.FormValue("revoke")
+		i := slices.IndexFunc(sessions, func(session auth.Session) bool { return session.ID == id })
+		if i < 0 {
+			return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Session not found"}
+		}
+		if err := auth.RevokeSession(s.stateDir, id); err != nil {
+			return nil, err
+		}
+		slog.Info("Revoked session", "user", sessions[i].User, "remote", sessions[i].Remote)
+		s.recordAudit(r, audit.Entry{Action: audit.ActionLogout, Detail: fmt.Sprintf("revoked session of %s from %s", sessions[i].User, sessions[i].Remote)})
+		if current != nil && current.ID == id {
+			return nil, &cookieRedirectError{cookie: s.sessionCookie(r, "", -1), redirect: basePath + "/login", statusCode: http.StatusSeeOther}
+		}
+		return nil, &redirectError{url: basePath + "/sessions", statusCode: http.StatusSeeOther}
+	}
+
+	currentID := ""
+	if current != nil {
+		currentID = current.ID
+	}
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "sessions.gohtml", map[string]any{
+		"BasePath":  basePath,
+		"IsAdmin":   user == auth.AdminUser,
+		"Sessions":  sessions,
+		"CurrentID": currentID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseNotifyConfig parses the notification settings form. The password and the token are
+// not shown in the form, empty fields keep the stored ones.
+func parseNotifyConfig(r *http.Request, stored notify.Config) (notify.Config, error) {
+	config := notify.Config{
+		OnFailure:    r.FormValue("on_failure") == "on",
+		WebhookURL:   strings.TrimSpace(r.FormValue("webhook_url")),
+		NtfyURL:      strings.TrimSpace(r.FormValue("ntfy_url")),
+		NtfyToken:    cmp.Or(r.FormValue("ntfy_token"), stored.NtfyToken),
+		SMTPAddr:     strings.TrimSpace(r.FormValue("smtp_addr")),
+		SMTPUsername: strings.TrimSpace(r.FormValue("smtp_username")),
+		SMTPPassword: cmp.Or(r.FormValue("smtp_password"), stored.SMTPPassword),
+		EmailFrom:    strings.TrimSpace(r.FormValue("email_from")),
+		EmailTo:      strings.TrimSpace(r.FormValue("email_to")),
+	}
+	if minDuration := strings.TrimSpace(r.FormValue("min_duration")); minDuration != "" {
+		if err := parseDurationFields(map[string]*time.Duration{"min_duration": &config.MinDuration}, r); err != nil {
+			return config, err
+		}
+	}
+	rules, err := notify.ParseRules(r.FormValue("rules"))
+	if err != nil {
+		return config, err
+	}
+	config.Rules = rules
+	return config, nil
+}
+
+// jsonHandlePushKey returns the public VAPID key, which the browser needs to subscribe to
+// Web Push notifications.
+func (s *Server) jsonHandlePushKey(ctx context.Context, r *http.Request) ([]byte, error) {
+	keys, err := webpush.LoadKeys(s.stateDir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(map[string]string{"public_key": keys.PublicKey()})
+	if err != nil {
+		return nil, err
+	}
+	return nil, &contentTypeError{contentType: "application/json", data: data}
+}
+
+// jsonHandlePushSubscription subscribes the browser to Web Push notifications (POST) or
+// unsubscribes it (DELETE). The body is the PushSubscription of the browser as JSON.
+func (s *Server) jsonHandlePushSubscription(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	var sub webpush.Subscription
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&sub); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Invalid subscription: " + err.Error()}
+	}
+	if r.Method == http.MethodDelete {
+		if err := webpush.UnsubscribeEndpoint(s.stateDir, sub.Endpoint); err != nil {
+			return nil, err
+		}
+		return nil, &contentTypeError{contentType: "application/json", data: []byte(`{}`)}
+	}
+	if err := webpush.Subscribe(s.stateDir, &sub, r.UserAgent()); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &contentTypeError{contentType: "application/json", data: data}
+}
+
+// parseDurationFields parses the form values of r into the durations of fields, which are
+// keyed by the name of the form field.
+func parseDurationFields(fields map[string]*time.Duration, r *http.Request) error {
+	for name, field := range fields {
+		d, err := time.ParseDuration(strings.TrimSpace(r.FormValue(name)))
+		if err != nil {
+			return fmt.Errorf("invalid duration for %s: %q", name, r.FormValue(name))
+		}
+		*field = d
+	}
+	return nil
+}
+
+// hxHandleClipboard adds a snippet to the server clipboard, for example the command of a
+// process, or text which the terminal copied with OSC 52.
+func (s *Server) hxHandleClipboard(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	dir, err := s.userStateDir(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := clipboard.Add(dir, r.FormValue("text")); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "hx-clipboard.gohtml", map[string]any{
+		"BasePath": s.getBasePath(r),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// apiHandleClipboard returns the snippets of the server clipboard as JSON, newest first.
+func (s *Server) apiHandleClipboard(ctx context.Context, r *http.Request) ([]byte, error) {
+	dir, err := s.userStateDir(r)
+	if err != nil {
+		return nil, err
+	}
+	snippets, err := clipboard.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	if snippets == nil {
+		snippets = []clipboard.Snippet{}
+	}
+	data, err := json.Marshal(snippets)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &contentTypeError{contentType: "application/json", data: data}
+}
+
+// apiHandleCreateUpload starts a chunked upload of a file into the workspace directory. The
+// form values are "path" (relative to the workspace directory), "size" and "sha256". The
+// response is the upload as JSON, its chunks are sent to apiHandleUpload.
+func (s *Server) apiHandleCreateUpload(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	size, err := strconv.ParseInt(r.FormValue("size"), 10, 64)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Invalid size"}
+	}
+	u, err := upload.Create(s.stateDir, ws, r.FormValue("path"), size, r.FormValue("sha256"))
+	if errors.Is(err, upload.ErrChecksum) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusUnprocessableEntity, Message: err.Error()}
+	}
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+	// An empty file is complete without a chunk
+	if u.Complete {
+		s.recordUpload(r, u)
+	}
+	return uploadResponse(u)
+}
+
+// apiHandleUpload serves a chunked upload: GET returns it as JSON, its offset tells where to
+// resume after a lost connection. PUT appends the chunk in the body, the Content-Range header
+// ("bytes <first>-<last>/<size>") must start at the offset. The last chunk completes the
+// upload: the checksum is verified and the file is moved to the workspace directory. DELETE
+// cancels the upload.
+func (s *Server) apiHandleUpload(ctx context.Context, r *http.Request) ([]byte, error) {
+	id := r.PathValue("uploadID")
+	// Uploads into the workspaces of other users are not found
+	if u, err := upload.Get(s.stateDir, id); err == nil {
+		if _, err := s.getWorkspace(r, u.WorkspaceID); err != nil {
+			return nil, uploadError(upload.ErrNotFound)
+		}
+	}
+	switch r.Method {
+	case http.MethodGet:
+		u, err := upload.Get(s.stateDir, id)
+		if err != nil {
+			return nil, uploadError(err)
+		}
+		return uploadResponse(u)
+
+	case http.MethodPut:
+		start, length, size, err := upload.ParseContentRange(r.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+		}
+		u, err := upload.Get(s.stateDir, id)
+		if err != nil {
+			return nil, uploadError(err)
+		}
+		if size != u.Size {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("The upload has %d bytes, not %d", u.Size, size)}
+		}
+		u, err = upload.Write(s.stateDir, id, start, r.Body, length)
+		if err != nil {
+			return nil, uploadError(err)
+		}
+		if u.Complete {
+			s.recordUpload(r, u)
+		}
+		return uploadResponse(u)
+
+	case http.MethodDelete:
+		if err := upload.Delete(s.stateDir, id); err != nil {
+			return nil, uploadError(err)
+		}
+		return nil, &contentTypeError{contentType: "application/json", data: []byte(`{}`)}
+
+	default:
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+}
+
+// recordUpload records the complete upload u in the audit log.
+func (s *Server) recordUpload(r *http.Request, u *upload.Upload) {
+	s.recordAudit(r, audit.Entry{Action: audit.ActionFileWrite, Workspace: u.WorkspaceID, Detail: fmt.Sprintf("%s, %d bytes uploaded", u.Path, u.Size)})
+}
+
+// uploadResponse returns u as JSON response.
+func uploadResponse(u *upload.Upload) ([]byte, error) {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &contentTypeError{contentType: "application/json", data: data}
+}
+
+// uploadError returns the HTTP error for an error of the upload package.
+func uploadError(err error) error {
+	switch {
+	case errors.Is(err, upload.ErrNotFound):
+		return httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
+	case errors.Is(err, upload.ErrOffset):
+		return httperror.HTTPError{StatusCode: http.StatusConflict, Message: err.Error()}
+	case errors.Is(err, upload.ErrChecksum):
+		return httperror.HTTPError{StatusCode: http.StatusUnprocessableEntity, Message: err.Error()}
+	default:
+		return err
+	}
+}
+
+// hxHandlePreferences saves the display preferences of the output view. The response
+// replaces the style sheet which applies them.
+func (s *Server) hxHandlePreferences(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	fontSize, err := strconv.Atoi(r.FormValue("font-size"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Invalid font size"}
+	}
+	prefs := preferences.Preferences{
+		Wrap:     r.FormValue("wrap") == "true",
+		FontSize: fontSize,
+		Theme:    r.FormValue("theme"),
+	}
+	if err := prefs.Validate(); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err := preferences.Save(s.stateDir, prefs); err != nil {
+		return nil, err
 	}
 
-	// Update known processes
-	for id, completed := range currentProcesses {
-		knownProcesses[id] = completed
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "hx-preferences.gohtml", map[string]any{
+		"Preferences": prefs,
+		"OOB":         true,
+	})
+	if err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	// Clean up rate limiters for processes that no longer exist
-	var activeIDs []string
-	for id := range currentProcesses {
-		activeIDs = append(activeIDs, id)
+// gitInfoTimeout limits "git status" for the workspace page, it is slow in huge repositories.
+const gitInfoTimeout = 5 * time.Second
+
+// gitActions are the commands of the quick actions of a git repository. The pager is disabled,
+// because it would wait for input in the PTY of the process.
+var gitActions = []string{"git status", "git --no-pager diff"}
+
+// hxHandleGit shows the branch and the uncommitted changes of the workspace directory, if it is
+// a git repository, with buttons which run "git status" and "git diff" as processes.
+func (s *Server) hxHandleGit(ctx context.Context, r *http.Request) ([]byte, error) {
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	gitCtx, cancel := context.WithTimeout(ctx, gitInfoTimeout)
+	defer cancel()
+	info, err := gitinfo.Detect(gitCtx, ws.Directory)
+	if err != nil {
+		slog.Warn("Failed to detect git repository", "workspace", ws.ID, "error", err)
 	}
-	s.wsHub.CleanupRateLimiters(activeIDs)
 
-	return nil
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "hx-git.gohtml", map[string]any{
+		"BasePath":    s.getBasePath(r),
+		"WorkspaceID": ws.ID,
+		"Production":  ws.IsProduction(),
+		"Git":         info,
+		"Actions":     gitActions,
+		"Error":       err,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
-func (s *Server) hxHandleFinishedProcesses(ctx context.Context, r *http.Request) ([]byte, error) {
-	// Get workspace ID from path parameter
+// storageTopProcesses is the number of processes listed in the storage report.
+const storageTopProcesses = 20
+
+// hxHandleStorage shows the disk usage of the workspace. POST requests run a cleanup action
+// first: "retention" applies the retention policy now, "delete" deletes the finished process
+// given by the "process" parameter.
+func (s *Server) hxHandleStorage(ctx context.Context, r *http.Request) ([]byte, error) {
 	workspaceID := r.PathValue("id")
-	if workspaceID == "" {
-		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Workspace ID is required"}
+	ws, err := s.getWorkspace(r, workspaceID)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
 
-	// Get offset from query parameter
-	offsetStr := r.URL.Query().Get("offset")
-	offset := 0
-	if offsetStr != "" {
-		if _, err := fmt.Sscanf(offsetStr, "%d", &offset); err != nil {
-			slog.Warn("Failed to parse offset parameter", "offset", offsetStr, "error", err)
+	message := ""
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "retention":
+			policy, err := retention.LoadPolicy(ws)
+			if err != nil {
+				return nil, err
+			}
+			if policy.IsZero() {
+				return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "The workspace has no retention policy"}
+			}
+			if err := retention.Apply(ws, policy, time.Now().UTC()); err != nil {
+				return nil, err
+			}
+			message = "Retention policy applied"
+		case "delete":
+			if err := workspace.DeleteProcess(ws, r.FormValue("process")); err != nil {
+				return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+			}
+			message = "Process deleted"
+		default:
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Unknown action"}
 		}
 	}
 
-	// Get the workspace
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	report, err := retention.Usage(ws)
 	if err != nil {
-		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+		return nil, err
 	}
-
-	allProcesses, err := workspace.ListProcesses(ws)
+	policy, err := retention.LoadPolicy(ws)
 	if err != nil {
 		return nil, err
 	}
-
-	// Filter for finished processes only
-	var finishedProcesses []*process.Process
-	for _, p := range allProcesses {
-		if p.Completed {
-			finishedProcesses = append(finishedProcesses, p)
-		}
+	top := report.Processes
+	if len(top) > storageTopProcesses {
+		top = top[:storageTopProcesses]
 	}
 
-	// Sort finished processes by end time (newest first)
-	sort.Slice(finishedProcesses, func(i, j int) bool {
-		return finishedProcesses[i].EndTime.After(finishedProcesses[j].EndTime)
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "hx-storage.gohtml", map[string]any{
+		"BasePath":     s.getBasePath(r),
+		"WorkspaceID":  workspaceID,
+		"Report":       report,
+		"Processes":    top,
+		"HasRetention": !policy.IsZero(),
+		"Message":      message,
 	})
-
-	// Apply pagination
-	const pageSize = 10
-	start := offset
-	end := offset + pageSize
-	if start >= len(finishedProcesses) {
-		// No more processes
-		return []byte{}, nil
+	if err != nil {
+		return nil, err
 	}
-	if end > len(finishedProcesses) {
-		end = len(finishedProcesses)
+	return buf.Bytes(), nil
+}
+
+func (s *Server) hxHandleDeleteProcess(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
 	}
 
-	paginatedProcesses := finishedProcesses[start:end]
-	hasMore := end < len(finishedProcesses)
-	newOffset := end
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
 
-	var buf bytes.Buffer
+	if err := workspace.DeleteProcess(ws, r.PathValue("processID")); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+	s.recordAudit(r, audit.Entry{Action: audit.ActionProcessDelete, Workspace: ws.ID, Process: r.PathValue("processID")})
+	return []byte{}, nil
+}
 
-	// Use different template for initial load vs pagination
-	templateName := "hx-finished-processes-page.gohtml"
-	if offset == 0 {
-		templateName = "hx-finished-processes-initial.gohtml"
+// hxHandleMarkFinished marks a process, which is shown as running, as finished with an
+// unknown exit status. This is for processes which the reconciliation doesn't catch, for
+// example if the nohup wrapper died but the command still runs. Queued processes get
+// cancelled. It returns the new status badge.
+func (s *Server) hxHandleMarkFinished(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
 	}
 
-	err = s.tmpl.ExecuteTemplate(&buf, templateName, map[string]interface{}{
-		"FinishedProcesses": paginatedProcesses,
-		"HasMore":           hasMore,
-		"Offset":            newOffset,
-		"BasePath":          s.getBasePath(r),
-		"WorkspaceID":       workspaceID,
-	})
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	processDir := workspace.GetProcessDir(ws, r.PathValue("processID"))
+	proc, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Process not found"}
+	}
+	if proc.Completed {
+		return nil, httperror.HTTPError{StatusCode: http.StatusConflict, Message: "Process already finished"}
+	}
+	if proc.Queued {
+		err = executor.CancelQueued(processDir)
+	} else {
+		err = process.MarkOrphaned(processDir)
+	}
 	if err != nil {
 		return nil, err
 	}
+	proc, err = process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "hx-mark-finished.gohtml", proc); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
+// processURL returns the URL of the process page of a process directory.
+func (s *Server) processURL(r *http.Request, processDir string) string {
+	workspaceID := filepath.Base(filepath.Dir(filepath.Dir(processDir)))
+	return fmt.Sprintf("%s/workspaces/%s/processes/%s", s.getBasePath(r), workspaceID, filepath.Base(processDir))
+}
+
+// handlePermalink redirects the stable link of a process to its process page. Permalinks
+// don't depend on the workspace, so they keep working when the workspace gets re-created.
+func (s *Server) handlePermalink(ctx context.Context, r *http.Request) ([]byte, error) {
+	processDir, err := workspace.FindProcessByPermalink(s.stateDir, r.PathValue("permalink"))
+	if err != nil || !canAccessProcess(r, processDir) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Process not found"}
+	}
+	return nil, &redirectError{url: s.processURL(r, processDir), statusCode: http.StatusFound}
+}
+
 func (s *Server) handleProcessByID(ctx context.Context, r *http.Request) ([]byte, error) {
 	// Get process ID from path parameter
 	processID := r.PathValue("processID") // todo: use commandId
@@ -1491,15 +3983,22 @@ func (s *Server) handleProcessByID(ctx context.Context, r *http.Request) ([]byte
 		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Workspace ID is required"}
 	}
 
-	// Get the workspace
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	// Get the workspace. Links of re-created workspaces get redirected to the workspace
+	// which has the process now.
+	ws, err := s.getWorkspace(r, workspaceID)
 	if err != nil {
+		if processDir, findErr := workspace.FindProcessDir(s.stateDir, "", processID); findErr == nil && canAccessProcess(r, processDir) {
+			return nil, &redirectError{url: s.processURL(r, processDir), statusCode: http.StatusMovedPermanently}
+		}
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
 
 	processDir := filepath.Join(s.stateDir, "workspaces", workspaceID, "processes", processID)
 	proc, err := process.LoadProcessFromDir(processDir)
 	if err != nil {
+		if processDir, findErr := workspace.FindProcessDir(s.stateDir, "", processID); findErr == nil && canAccessProcess(r, processDir) {
+			return nil, &redirectError{url: s.processURL(r, processDir), statusCode: http.StatusMovedPermanently}
+		}
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
 	}
 
@@ -1510,8 +4009,15 @@ func (s *Server) handleProcessByID(ctx context.Context, r *http.Request) ([]byte
 		isBinary = true
 	}
 
+	// A recorded terminal session has the output and input of the PTY instead of stdout and stdin
+	terminalRecording := terminal.IsSession(proc)
+	stdoutStream, stdinStream := outputlog.StreamStdout, outputlog.StreamStdin
+	if terminalRecording {
+		stdoutStream, stdinStream = terminal.StreamOutput, terminal.StreamInput
+	}
+
 	// Read full output
-	stdoutBytes, stderrBytes, stdinBytes, nohupStdoutBytes, nohupStderrBytes, err := outputlog.ReadFiveStreams(proc.OutputFile, "stdout", "stderr", "stdin", "nohup-stdout", "nohup-stderr")
+	stdoutBytes, stderrBytes, stdinBytes, nohupStdoutBytes, nohupStderrBytes, err := outputlog.ReadFiveStreams(proc.OutputFile, stdoutStream, outputlog.StreamStderr, stdinStream, outputlog.StreamNohupStdout, outputlog.StreamNohupStderr)
 	stdout := string(stdoutBytes)
 	stderr := string(stderrBytes)
 	stdin := string(stdinBytes)
@@ -1525,66 +4031,372 @@ func (s *Server) handleProcessByID(ctx context.Context, r *http.Request) ([]byte
 		nohupStderr = ""
 	}
 
-	// Read content type and render markdown if needed
-	contentType := ""
-	outputTypeFile := filepath.Join(processDir, "output-type")
-	if data, err := os.ReadFile(outputTypeFile); err == nil {
-		parts := strings.Split(strings.TrimSpace(string(data)), ",")
-		if len(parts) > 0 {
-			contentType = parts[0]
-		}
+	contentType := proc.ContentType
+	stdoutHTML := renderStdoutHTML(contentType, stdout)
+
+	// Get the process directory path for the file browser link
+	processDirPath := filepath.Dir(proc.OutputFile)
+	processDirURL := fmt.Sprintf("%s/files?path=%s", s.getBasePath(r), url.QueryEscape(processDirPath))
+
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "process.gohtml", map[string]interface{}{
+		"Process":           proc,
+		"Stdout":            stdout,
+		"StdoutHTML":        template.HTML(stdoutHTML),
+		"Stderr":            stderr,
+		"Stdin":             stdin,
+		"NohupStdout":       nohupStdout,
+		"NohupStderr":       nohupStderr,
+		"IsBinary":          isBinary,
+		"TerminalRecording": terminalRecording,
+		"ContentType":       contentType,
+		"BasePath":          s.getBasePath(r),
+		"WorkspaceID":       workspaceID,
+		"Workspace":         ws,
+		"ProcessDirURL":     processDirURL,
+		"Usage":             buildUsageSparkline(process.ReadSamples(processDir)),
+		"Preferences":       preferences.Load(s.stateDir),
+		"FontSizes":         preferences.FontSizes,
+		"Themes":            preferences.Themes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *Server) hxHandleOutput(ctx context.Context, r *http.Request) ([]byte, error) {
+	// Get process ID from path parameter
+	processID := r.PathValue("processID")
+	workspaceID := r.PathValue("id")
+	if _, err := s.getWorkspace(r, workspaceID); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	processDir := filepath.Join(s.stateDir, "workspaces", workspaceID, "processes", processID)
+	proc, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
+	}
+
+	if offsetParam := r.URL.Query().Get("offset"); offsetParam != "" {
+		return s.renderProcessOutputDelta(proc, offsetParam)
+	}
+	if r.URL.Query().Has("at") || r.URL.Query().Has("lines") {
+		return s.renderProcessOutputWindow(proc, r)
+	}
+
+	expand := r.URL.Query().Get("expand") == "true"
+
+	html, err := s.renderProcessOutput(proc, workspaceID, expand, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(html), nil
+}
+
+// readOutputDelta reads the chunks which were appended to the output after offsetParam. It
+// returns the offset for the next request.
+func readOutputDelta(proc *process.Process, offsetParam string) ([]outputlog.Chunk, int64, error) {
+	offset, err := strconv.ParseInt(offsetParam, 10, 64)
+	if err != nil || offset < 0 {
+		return nil, 0, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid offset: %q", offsetParam)}
+	}
+
+	chunks, nextOffset, err := outputlog.ReadFrom(proc.OutputFile, offset)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, 0, err
+	}
+	return chunks, nextOffset, nil
+}
+
+// renderProcessOutputDelta renders only the chunks which were appended to the output after
+// offset. The offset for the next request is returned in the data-next-offset attribute.
+func (s *Server) renderProcessOutputDelta(proc *process.Process, offsetParam string) ([]byte, error) {
+	chunks, nextOffset, err := readOutputDelta(proc, offsetParam)
+	if err != nil {
+		return nil, err
+	}
+	return s.renderOutputChunks(proc, chunks, nextOffset, false)
+}
+
+// renderOutputChunks renders chunks of the output. nextOffset is the offset after the last
+// chunk, it is returned in the data-next-offset attribute. A window is shown on its own, a
+// delta gets appended to the output which is shown already.
+func (s *Server) renderOutputChunks(proc *process.Process, chunks []outputlog.Chunk, nextOffset int64, window bool) ([]byte, error) {
+	var buf bytes.Buffer
+	err := s.tmpl.ExecuteTemplate(&buf, "hx-output.gohtml", map[string]interface{}{
+		"Process":    proc,
+		"Type":       "delta",
+		"Chunks":     chunks,
+		"NextOffset": nextOffset,
+		"Window":     window,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// outputWindowSize limits the output which renderProcessOutputWindow shows, output logs can be
+// several GB big.
+const outputWindowSize = 1 << 20
+
+// renderProcessOutputWindow renders the output from ?at= on, a UTC time like
+// "2025-01-07T14:32", or the last ?lines= lines of stdout and stderr. The index of the output
+// log (see outputlog.IndexEntry) avoids reading the whole log.
+func (s *Server) renderProcessOutputWindow(proc *process.Process, r *http.Request) ([]byte, error) {
+	var offset int64
+	var err error
+	if at := r.URL.Query().Get("at"); at != "" {
+		t, parseErr := parseOutputTime(at)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		offset, err = outputlog.SeekToTime(proc.OutputFile, t)
+	} else {
+		lines, parseErr := strconv.ParseInt(r.URL.Query().Get("lines"), 10, 64)
+		if parseErr != nil || lines <= 0 {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid number of lines: %q", r.URL.Query().Get("lines"))}
+		}
+		offset, err = outputlog.SeekToLastLines(proc.OutputFile, lines, outputlog.StreamStdout, outputlog.StreamStderr)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	chunks, nextOffset, err := outputlog.ReadChunks(proc.OutputFile, offset, outputWindowSize)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return s.renderOutputChunks(proc, chunks, nextOffset, true)
+}
+
+// parseOutputTime parses a UTC time like "2025-01-07T14:32", as a datetime-local input sends
+// it, or an RFC 3339 timestamp.
+func parseOutputTime(value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02T15:04", value)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return time.Time{}, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid time: %q", value)}
+	}
+	return t.UTC(), nil
+}
+
+// Limits of the output ranges.
+const (
+	outputPageLines     = 500   // Lines per page of hxHandleOutputPage
+	maxOutputRangeLines = 10000 // Lines per request of jsonHandleOutputRange
+)
+
+// outputRangeLine is a line of the response of jsonHandleOutputRange.
+type outputRangeLine struct {
+	Number int64  `json:"number"`
+	Text   string `json:"text"`
+}
+
+// outputRangeChunk is a chunk of the response of jsonHandleOutputRange.
+type outputRangeChunk struct {
+	Stream    string    `json:"stream"`
+	Timestamp time.Time `json:"timestamp"`
+	Text      string    `json:"text"`
+}
+
+// jsonHandleOutputRange returns a part of the output of a process as JSON. With ?first= and
+// ?last= it returns these lines of ?stream= (default stdout), numbered from 1, and the number
+// of complete lines. With ?from= and ?to= it returns the chunks between these times, of
+// ?stream= or of all streams. The index of the output log makes this fast for big logs.
+func (s *Server) jsonHandleOutputRange(ctx context.Context, r *http.Request) ([]byte, error) {
+	if _, err := s.getWorkspace(r, r.PathValue("id")); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	processDir := filepath.Join(s.stateDir, "workspaces", r.PathValue("id"), "processes", r.PathValue("processID"))
+	proc, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
+	}
+	query := r.URL.Query()
+	stream := query.Get("stream")
+	if stream != "" && !outputlog.IsValidStreamName(stream) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid stream: %q", stream)}
+	}
+
+	var response any
+	if query.Has("from") || query.Has("to") {
+		from, err := parseOutputTime(query.Get("from"))
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseOutputTime(query.Get("to"))
+		if err != nil {
+			return nil, err
+		}
+		var streams []string
+		if stream != "" {
+			streams = []string{stream}
+		}
+		chunks, err := outputlog.ReadTimeRange(proc.OutputFile, from, to, outputWindowSize, streams...)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		result := []outputRangeChunk{}
+		for _, chunk := range chunks {
+			result = append(result, outputRangeChunk{Stream: chunk.Stream, Timestamp: chunk.Timestamp, Text: string(chunk.Line)})
+		}
+		response = map[string]any{"from": from, "to": to, "chunks": result}
+	} else {
+		if stream == "" {
+			stream = outputlog.StreamStdout
+		}
+		first, err := strconv.ParseInt(query.Get("first"), 10, 64)
+		if err != nil || first < 1 {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid first line: %q", query.Get("first"))}
+		}
+		last, err := strconv.ParseInt(query.Get("last"), 10, 64)
+		if err != nil || last < first || last-first >= maxOutputRangeLines {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid last line %q, at most %d lines can be read at once", query.Get("last"), maxOutputRangeLines)}
+		}
+		lines, total, err := readOutputLines(proc, stream, first, last)
+		if err != nil {
+			return nil, err
+		}
+		response = map[string]any{"stream": stream, "lines": numberLines(lines, first), "total": total}
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &contentTypeError{contentType: "application/json", data: data}
+}
+
+// readOutputLines reads the lines first to last of stream, and the number of complete lines.
+// A process without output has no lines.
+func readOutputLines(proc *process.Process, stream string, first, last int64) ([]string, int64, error) {
+	total, err := outputlog.CountLines(proc.OutputFile, stream)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	lines, err := outputlog.ReadLines(proc.OutputFile, stream, first, last)
+	if err != nil {
+		return nil, 0, err
+	}
+	return lines, total, nil
+}
+
+// numberLines numbers lines, starting with first.
+func numberLines(lines []string, first int64) []outputRangeLine {
+	numbered := make([]outputRangeLine, 0, len(lines))
+	for i, line := range lines {
+		numbered = append(numbered, outputRangeLine{Number: first + int64(i), Text: line})
 	}
+	return numbered
+}
 
-	stdoutHTML := ""
-	if contentType == string(outputtype.OutputTypeMarkdown) && stdout != "" {
-		stdoutHTML = markdown.RenderToHTML(stdout)
+// hxHandleOutputPage renders a page of outputPageLines lines of ?stream= (default stdout), for
+// long jobs. ?page= starts at 1, the default is the last page.
+func (s *Server) hxHandleOutputPage(ctx context.Context, r *http.Request) ([]byte, error) {
+	workspaceID := r.PathValue("id")
+	if _, err := s.getWorkspace(r, workspaceID); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	processDir := filepath.Join(s.stateDir, "workspaces", workspaceID, "processes", r.PathValue("processID"))
+	proc, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
+	}
+	stream := r.URL.Query().Get("stream")
+	if stream == "" {
+		stream = outputlog.StreamStdout
+	}
+	if !outputlog.IsValidStreamName(stream) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid stream: %q", stream)}
 	}
 
-	// Get the process directory path for the file browser link
-	processDirPath := filepath.Dir(proc.OutputFile)
-	processDirURL := fmt.Sprintf("%s/files?path=%s", s.getBasePath(r), url.QueryEscape(processDirPath))
+	total, err := outputlog.CountLines(proc.OutputFile, stream)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	// A last line without newline is on the last page, too
+	pages := total/outputPageLines + 1
+	page := pages
+	if pageParam := r.URL.Query().Get("page"); pageParam != "" {
+		page, err = strconv.ParseInt(pageParam, 10, 64)
+		if err != nil || page < 1 || page > pages {
+			return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid page: %q", pageParam)}
+		}
+	}
+	first := (page-1)*outputPageLines + 1
+	lines, _, err := readOutputLines(proc, stream, first, first+outputPageLines-1)
+	if err != nil {
+		return nil, err
+	}
+	var next int64 // 0 on the last page
+	if page < pages {
+		next = page + 1
+	}
 
 	var buf bytes.Buffer
-	err = s.tmpl.ExecuteTemplate(&buf, "process.gohtml", map[string]interface{}{
-		"Process":       proc,
-		"Stdout":        stdout,
-		"StdoutHTML":    template.HTML(stdoutHTML),
-		"Stderr":        stderr,
-		"Stdin":         stdin,
-		"NohupStdout":   nohupStdout,
-		"NohupStderr":   nohupStderr,
-		"IsBinary":      isBinary,
-		"ContentType":   contentType,
-		"BasePath":      s.getBasePath(r),
-		"WorkspaceID":   workspaceID,
-		"WorkspaceName": ws.Name,
-		"ProcessDirURL": processDirURL,
+	err = s.tmpl.ExecuteTemplate(&buf, "hx-output-page.gohtml", map[string]any{
+		"BasePath":    s.getBasePath(r),
+		"WorkspaceID": workspaceID,
+		"Process":     proc,
+		"Stream":      stream,
+		"Lines":       numberLines(lines, first),
+		"Page":        page,
+		"Pages":       pages,
+		"Previous":    page - 1,
+		"Next":        next,
 	})
 	if err != nil {
 		return nil, err
 	}
-
 	return buf.Bytes(), nil
 }
 
-func (s *Server) hxHandleOutput(ctx context.Context, r *http.Request) ([]byte, error) {
-	// Get process ID from path parameter
+// hxHandleFollow renders the output which was appended after ?offset= for the follow mode of
+// the process page. With ?start=true the output container gets rendered, too. The poller gets
+// replaced out-of-band, so that the next poll continues at the new offset. After the process
+// completed, a completion banner replaces the poller, which stops polling.
+func (s *Server) hxHandleFollow(ctx context.Context, r *http.Request) ([]byte, error) {
 	processID := r.PathValue("processID")
 	workspaceID := r.PathValue("id")
+	if _, err := s.getWorkspace(r, workspaceID); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
 	processDir := filepath.Join(s.stateDir, "workspaces", workspaceID, "processes", processID)
+
+	// Load the process before reading the output. If it is completed now, the output is
+	// complete, too.
 	proc, err := process.LoadProcessFromDir(processDir)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
 	}
 
-	expand := r.URL.Query().Get("expand") == "true"
-
-	html, err := s.renderProcessOutput(proc, workspaceID, expand, r)
+	chunks, nextOffset, err := readOutputDelta(proc, r.URL.Query().Get("offset"))
 	if err != nil {
 		return nil, err
 	}
 
-	return []byte(html), nil
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "hx-follow.gohtml", map[string]interface{}{
+		"Process":     proc,
+		"Chunks":      chunks,
+		"NextOffset":  nextOffset,
+		"Start":       r.URL.Query().Get("start") == "true",
+		"BasePath":    s.getBasePath(r),
+		"WorkspaceID": workspaceID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 type processOutputData struct {
@@ -1599,6 +4411,20 @@ type processOutputData struct {
 	contentType string // Content type from output-type file
 }
 
+// templateData returns the values which the "output-display" template needs.
+func (d processOutputData) templateData() map[string]any {
+	return map[string]any{
+		"Stdout":      d.stdout,
+		"StdoutHTML":  template.HTML(d.stdoutHTML), // Mark as safe HTML
+		"Stderr":      d.stderr,
+		"Stdin":       d.stdin,
+		"NohupStdout": d.nohupStdout,
+		"NohupStderr": d.nohupStderr,
+		"IsBinary":    d.isBinary,
+		"ContentType": d.contentType,
+	}
+}
+
 func (s *Server) prepareProcessOutput(outputFile string, expand bool) (processOutputData, error) {
 	// Check for binary-data marker file
 	processDir := filepath.Dir(outputFile)
@@ -1609,7 +4435,7 @@ func (s *Server) prepareProcessOutput(outputFile string, expand bool) (processOu
 	}
 
 	// Read combined output from single file
-	stdoutBytes, stderrBytes, stdinBytes, nohupStdoutBytes, nohupStderrBytes, err := outputlog.ReadFiveStreams(outputFile, "stdout", "stderr", "stdin", "nohup-stdout", "nohup-stderr")
+	stdoutBytes, stderrBytes, stdinBytes, nohupStdoutBytes, nohupStderrBytes, err := outputlog.ReadFiveStreams(outputFile, outputlog.StreamStdout, outputlog.StreamStderr, outputlog.StreamStdin, outputlog.StreamNohupStdout, outputlog.StreamNohupStderr)
 	stdout := string(stdoutBytes)
 	stderr := string(stderrBytes)
 	stdin := string(stdinBytes)
@@ -1645,22 +4471,9 @@ func (s *Server) prepareProcessOutput(outputFile string, expand bool) (processOu
 	// Prepare preview
 	needsExpand := !autoShow && !expand
 
-	// Read content type from output-type file
-	contentType := ""
-	outputTypeFile := filepath.Join(processDir, "output-type")
-	if data, err := os.ReadFile(outputTypeFile); err == nil {
-		// Output-type file format: "type,reason"
-		parts := strings.Split(strings.TrimSpace(string(data)), ",")
-		if len(parts) > 0 {
-			contentType = parts[0]
-		}
-	}
+	contentType, _ := process.ReadOutputType(processDir)
 
-	// Render markdown to HTML if content type is markdown
-	stdoutHTML := ""
-	if contentType == string(outputtype.OutputTypeMarkdown) && stdout != "" {
-		stdoutHTML = markdown.RenderToHTML(stdout)
-	}
+	stdoutHTML := renderStdoutHTML(contentType, stdout)
 
 	return processOutputData{
 		stdout:      stdout,
@@ -1675,29 +4488,44 @@ func (s *Server) prepareProcessOutput(outputFile string, expand bool) (processOu
 	}, nil
 }
 
+// renderStdoutHTML renders the stdout of markdown processes, of ink processes which
+// print ANSI colors, and of JSON processes. Other output types, and JSON which got cut
+// off, are shown as plain text and get "".
+func renderStdoutHTML(contentType, stdout string) string {
+	if stdout == "" {
+		return ""
+	}
+	switch contentType {
+	case string(outputtype.OutputTypeMarkdown):
+		return markdown.RenderToHTML(stdout)
+	case string(outputtype.OutputTypeInk):
+		return ansihtml.ToHTML(stdout)
+	case string(outputtype.OutputTypeJSON), string(outputtype.OutputTypeNDJSON):
+		rendered, err := jsonhtml.ToHTML(stdout)
+		if err != nil {
+			return ""
+		}
+		return rendered
+	}
+	return ""
+}
+
 func (s *Server) renderProcessOutput(proc *process.Process, workspaceID string, expand bool, r *http.Request) (string, error) {
 	outputData, err := s.prepareProcessOutput(proc.OutputFile, expand)
 	if err != nil {
 		return "", err
 	}
 
+	data := outputData.templateData()
+	data["Process"] = proc
+	data["Type"] = "combined"
+	data["NeedsExpand"] = outputData.needsExpand
+	data["Expanded"] = expand
+	data["BasePath"] = s.getBasePath(r)
+	data["WorkspaceID"] = workspaceID
+
 	var buf bytes.Buffer
-	err = s.tmpl.ExecuteTemplate(&buf, "hx-output.gohtml", map[string]interface{}{
-		"Process":     proc,
-		"Stdout":      outputData.stdout,
-		"StdoutHTML":  template.HTML(outputData.stdoutHTML), // Mark as safe HTML
-		"Stderr":      outputData.stderr,
-		"Stdin":       outputData.stdin,
-		"NohupStdout": outputData.nohupStdout,
-		"NohupStderr": outputData.nohupStderr,
-		"Type":        "combined",
-		"NeedsExpand": outputData.needsExpand,
-		"Expanded":    expand,
-		"IsBinary":    outputData.isBinary,
-		"ContentType": outputData.contentType,
-		"BasePath":    s.getBasePath(r),
-		"WorkspaceID": workspaceID,
-	})
+	err = s.tmpl.ExecuteTemplate(&buf, "hx-output.gohtml", data)
 	if err != nil {
 		return "", err
 	}
@@ -1710,65 +4538,248 @@ func (s *Server) renderProcessOutputHTML(p *process.Process, workspaceID string,
 }
 
 func (s *Server) hxHandleSendStdin(ctx context.Context, r *http.Request) ([]byte, error) {
-	// Get workspace ID and process ID from path
-	workspaceID := r.PathValue("id")
-	processID := r.PathValue("processID")
-
 	// Parse form data
 	if err := r.ParseForm(); err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Failed to parse form"}
 	}
-
 	stdinData := r.FormValue("stdin")
 
-	// Get workspace
-	_, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	_, proc, err := s.runningProcess(r)
 	if err != nil {
-		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+		return nil, err
 	}
 
-	// Use the same shorter socket path as executor to avoid Unix socket path length limit
-	socketPath := filepath.Join("/tmp", "ms-"+processID+".sock")
+	ctx, cancel := context.WithTimeout(ctx, stdinDeliveryTimeout)
+	defer cancel()
+	// The input is not recorded, it can be a password
+	s.recordAudit(r, audit.Entry{Action: audit.ActionStdin, Workspace: r.PathValue("id"), Process: proc.CommandId, Detail: fmt.Sprintf("%d bytes", len(stdinData)+1)})
+	if _, err := sendStdin(ctx, executor.SocketPath(proc.CommandId), strings.NewReader(stdinData+"\n")); err != nil {
+		slog.Warn("Failed to send stdin", "error", err, "process", proc.CommandId)
+		return stdinResult(err), nil
+	}
 
-	// Write to Unix domain socket in a goroutine with timeout
-	go func() {
-		// Use a timeout channel to avoid blocking forever
-		done := make(chan struct{})
-		go func() {
-			defer close(done)
+	// Return empty response (form will reset automatically via hx-on::after-request)
+	return []byte{}, nil
+}
 
-			// Connect to the Unix domain socket
-			conn, err := net.Dial("unix", socketPath)
-			if err != nil {
-				slog.Error("Failed to connect to Unix domain socket", "error", err, "path", socketPath)
-				return
-			}
-			defer func() { _ = conn.Close() }()
+// Sending input to the stdin of a process, see sendStdin.
+const (
+	stdinChunkSize       = 1024             // Below the line buffer of a PTY, which has 4 KiB
+	stdinWriteTimeout    = 30 * time.Second // A process which doesn't read its stdin for this long gets no more
+	stdinDeliveryTimeout = 5 * time.Second  // The text input waits this long for the process to read it
+	stdinDialTimeout     = 5 * time.Second  // A process which was just started creates its socket within this time
+	maxStdinFileSize     = 100 << 20
+)
+
+// errStdinQueued is returned by sendStdin if the process didn't read the input in time. The
+// input stays queued in the nohup process, the command gets it when it reads its stdin.
+var errStdinQueued = errors.New("the process didn't read its input yet, it is queued")
+
+// runningProcess returns the workspace and the process of a request with the path values "id"
+// and "processID", or an HTTPError if they don't exist or the process has finished.
+func (s *Server) runningProcess(r *http.Request) (*workspace.Workspace, *process.Process, error) {
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	proc, err := process.LoadProcessFromDir(workspace.GetProcessDir(ws, r.PathValue("processID")))
+	if err != nil {
+		return nil, nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Process not found"}
+	}
+	if proc.Completed {
+		return nil, nil, httperror.HTTPError{StatusCode: http.StatusConflict, Message: "The process has finished"}
+	}
+	return ws, proc, nil
+}
+
+// stdinResult returns the HTML snippet which tells the user that input was not (yet) delivered.
+func stdinResult(err error) []byte {
+	if errors.Is(err, errStdinQueued) {
+		return []byte(`<div class="small text-warning">` + html.EscapeString(err.Error()) + `</div>`)
+	}
+	return []byte(`<div class="small text-danger">Input not delivered: ` + html.EscapeString(err.Error()) + `</div>`)
+}
+
+// dialProcess connects to the Unix domain socket of a nohup process, which takes chunks in the
+// output log format. The nohup process of a command which was just started may not listen yet,
+// so it retries for up to stdinDialTimeout.
+func dialProcess(ctx context.Context, socketPath string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, stdinDialTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	for {
+		conn, err := dialer.DialContext(ctx, "unix", socketPath)
+		if err == nil {
+			return conn, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to connect to the process: %w", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// sendStdin streams r to the stdin of the process with the Unix domain socket socketPath, in
+// chunks of stdinChunkSize. The socket accepts the next chunk when the process read the
+// previous ones, so a slow process slows the sender down. It returns the number of sent bytes.
+//
+// The nohup process closes the connection when it wrote all chunks to the command, so
+// sendStdin waits for that until ctx is done, and returns errStdinQueued then.
+func sendStdin(ctx context.Context, socketPath string, r io.Reader) (int64, error) {
+	conn, err := dialProcess(ctx, socketPath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = conn.Close() }()
 
-			// Write stdin data in OutputLog format
-			chunk := outputlog.Chunk{
-				Stream:    "stdin",
-				Timestamp: time.Now().UTC(),
-				Line:      []byte(stdinData + "\n"),
+	var sent int64
+	buf := make([]byte, stdinChunkSize)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			if err := ctx.Err(); err != nil {
+				return sent, err
 			}
-			formatted := outputlog.FormatChunk(chunk)
-			_, err = conn.Write(formatted)
-			if err != nil {
-				slog.Error("Failed to write to Unix domain socket", "error", err)
+			chunk := outputlog.Chunk{Stream: outputlog.StreamStdin, Timestamp: time.Now().UTC(), Line: buf[:n]}
+			if err := conn.SetWriteDeadline(time.Now().Add(stdinWriteTimeout)); err != nil {
+				return sent, err
+			}
+			if _, err := conn.Write(outputlog.FormatChunk(chunk)); err != nil {
+				return sent, fmt.Errorf("failed to write to the process, does it read its stdin? %w", err)
 			}
-		}()
+			sent += int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return sent, readErr
+		}
+	}
+	return sent, waitDelivered(ctx, conn)
+}
 
-		// Wait for write to complete or timeout after 5 seconds
-		select {
-		case <-done:
-			// Write completed
-		case <-time.After(5 * time.Second):
-			slog.Error("Timeout writing to Unix domain socket", "path", socketPath)
+// waitDelivered closes the sending side of conn and waits until the nohup process closes it,
+// after it wrote everything to the command. If it could not, it replies with the error.
+func waitDelivered(ctx context.Context, conn net.Conn) error {
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		if err := unixConn.CloseWrite(); err != nil {
+			return err
 		}
-	}()
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(stdinWriteTimeout)
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return err
+	}
+	reply, err := io.ReadAll(conn)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return errStdinQueued
+	}
+	if err != nil {
+		return err
+	}
+	if len(reply) > 0 {
+		return errors.New(strings.TrimSpace(string(reply)))
+	}
+	return nil
+}
 
-	// Return empty response (form will reset automatically via hx-on::after-request)
-	return []byte{}, nil
+// hxHandleCloseStdin closes the stdin of a running process, so that a command like "wc -l"
+// which reads until EOF finishes.
+func (s *Server) hxHandleCloseStdin(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	_, proc, err := s.runningProcess(r)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialProcess(ctx, executor.SocketPath(proc.CommandId))
+	if err != nil {
+		return stdinResult(err), nil
+	}
+	defer func() { _ = conn.Close() }()
+	chunk := outputlog.Chunk{Stream: outputlog.StreamStdinClose, Timestamp: time.Now().UTC()}
+	if _, err := conn.Write(outputlog.FormatChunk(chunk)); err != nil {
+		return stdinResult(err), nil
+	}
+	s.recordAudit(r, audit.Entry{Action: audit.ActionStdinClose, Workspace: r.PathValue("id"), Process: proc.CommandId})
+	return []byte(`<span class="small text-muted">Stdin closed</span>`), nil
+}
+
+// hxHandleSendStdinFile sends a file to the stdin of a running process: the uploaded "file",
+// or the file "path" of the workspace directory. The file is streamed in chunks, which show up
+// in the output log as stdin.
+func (s *Server) hxHandleSendStdinFile(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	ws, proc, err := s.runningProcess(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.ContentLength > maxStdinFileSize {
+		return nil, httperror.HTTPError{StatusCode: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("The file is bigger than %s", formatBytes(maxStdinFileSize))}
+	}
+	file, name, err := stdinFile(r, ws)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+	defer func() { _ = file.Close() }()
+
+	sent, err := sendStdin(ctx, executor.SocketPath(proc.CommandId), io.LimitReader(file, maxStdinFileSize))
+	s.recordAudit(r, audit.Entry{Action: audit.ActionStdin, Workspace: ws.ID, Process: proc.CommandId, Detail: fmt.Sprintf("%s, %d bytes", name, sent)})
+	if err != nil {
+		slog.Warn("Failed to send file to stdin", "error", err, "process", proc.CommandId, "file", name)
+		return append([]byte(fmt.Sprintf(`<div class="small">Sent %s of %s</div>`, formatBytes(sent), html.EscapeString(name))), stdinResult(err)...), nil
+	}
+	return []byte(fmt.Sprintf(`<div class="small text-success">Sent %s of %s</div>`, formatBytes(sent), html.EscapeString(name))), nil
+}
+
+// stdinFile returns the file of a hxHandleSendStdinFile request and its name. An uploaded file is
+// streamed from the request, without a temporary copy.
+func stdinFile(r *http.Request, ws *workspace.Workspace) (io.ReadCloser, string, error) {
+	path := r.FormValue("path")
+	if reader, err := r.MultipartReader(); err == nil {
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid upload: %w", err)
+			}
+			switch {
+			case part.FormName() == "file" && part.FileName() != "":
+				return part, part.FileName(), nil
+			case part.FormName() == "path":
+				value, err := io.ReadAll(io.LimitReader(part, 4096))
+				if err != nil {
+					return nil, "", fmt.Errorf("invalid upload: %w", err)
+				}
+				path = strings.TrimSpace(string(value))
+			}
+		}
+	}
+	if path == "" {
+		return nil, "", fmt.Errorf("select a file to upload or enter the path of a file in the workspace")
+	}
+	if !filepath.IsLocal(path) {
+		return nil, "", fmt.Errorf("the path must be relative to the workspace directory and must not contain \"..\"")
+	}
+	file, err := os.Open(filepath.Join(ws.Directory, path))
+	if err != nil {
+		return nil, "", err
+	}
+	if info, err := file.Stat(); err != nil || !info.Mode().IsRegular() {
+		_ = file.Close()
+		return nil, "", fmt.Errorf("%s is not a regular file", path)
+	}
+	return file, path, nil
 }
 
 func (s *Server) hxHandleSendSignal(ctx context.Context, r *http.Request) ([]byte, error) {
@@ -1796,6 +4807,9 @@ func (s *Server) hxHandleSendSignal(ctx context.Context, r *http.Request) ([]byt
 	// Get signal name
 	signalName := syscall.Signal(signalNum).String()
 
+	if _, err := s.getWorkspace(r, workspaceID); err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
 	// Get process to find PID
 	processDir := filepath.Join(s.stateDir, "workspaces", workspaceID, "processes", processID)
 	proc, err := process.LoadProcessFromDir(processDir)
@@ -1825,6 +4839,7 @@ func (s *Server) hxHandleSendSignal(ctx context.Context, r *http.Request) ([]byt
 	}
 
 	slog.Info("Signal sent to process", "pid", proc.PID, "signal", signalName, "signal_num", signalNum)
+	s.recordAudit(r, audit.Entry{Action: audit.ActionSignal, Workspace: workspaceID, Process: processID, Detail: signalName})
 
 	// Return empty response
 	return []byte{}, nil
@@ -1844,7 +4859,7 @@ func (s *Server) handleDownloadOutput(ctx context.Context, r *http.Request) ([]b
 	}
 
 	// Get the workspace
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	ws, err := s.getWorkspace(r, workspaceID)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
@@ -1853,48 +4868,273 @@ func (s *Server) handleDownloadOutput(ctx context.Context, r *http.Request) ([]b
 	processDir := workspace.GetProcessDir(ws, processID)
 	outputFile := filepath.Join(processDir, "output.log")
 
-	// Read raw stdout bytes
-	stdoutBytes, err := outputlog.ReadRawStdout(outputFile)
+	// The stream can be chosen with ?stream=, default is stdout
+	stream := r.URL.Query().Get("stream")
+	if stream == "" {
+		stream = outputlog.StreamStdout
+	}
+	if !outputlog.IsValidStreamName(stream) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Invalid stream name"}
+	}
+
+	// Read the raw bytes of the stream
+	data, err := outputlog.ReadOneStream(outputFile, stream)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusInternalServerError, Message: "Failed to read output"}
 	}
 
-	// Read content type from file, or detect it
-	contentTypeFile := filepath.Join(processDir, "content-type")
-	var contentType string
-	if data, err := os.ReadFile(contentTypeFile); err == nil {
-		contentType = string(data)
-	} else {
-		// Fallback: detect content type
-		contentType = executor.DetectContentType(stdoutBytes)
+	// Read content type from file, or detect it. The content-type file describes stdout only.
+	var contentType string
+	fileContentType, err := os.ReadFile(filepath.Join(processDir, "content-type"))
+	if stream == outputlog.StreamStdout && err == nil {
+		contentType = string(fileContentType)
+	} else {
+		// Fallback: detect content type
+		contentType = executor.DetectContentType(data)
+	}
+
+	// Determine file name based on stream and content type
+	filename := processID
+	if stream != outputlog.StreamStdout {
+		filename += "-" + stream
+	}
+	filename += getFileExtensionFromContentType(contentType)
+
+	// Return download error which will be handled by wrapHandler
+	return nil, &downloadError{
+		contentType: contentType,
+		filename:    filename,
+		data:        data,
+	}
+}
+
+// handleDownloadCast returns the recorded terminal session of a process in the asciicast v2
+// format, which can be replayed with `asciinema play`.
+func (s *Server) handleDownloadCast(ctx context.Context, r *http.Request) ([]byte, error) {
+	processID := r.PathValue("processID")
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	processDir := workspace.GetProcessDir(ws, processID)
+	proc, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Process not found"}
+	}
+
+	if !terminal.IsSession(proc) {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "The process is no recorded terminal session"}
+	}
+	recording, err := outputlog.Open(proc.OutputFile)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "The process has no output"}
+	}
+	defer func() { _ = recording.Close() }()
+
+	var buf bytes.Buffer
+	if err := asciicast.Convert(recording, &buf, terminal.CastStreams, proc.Command); err != nil {
+		return nil, err
+	}
+	return nil, &downloadError{
+		contentType: "application/x-asciicast",
+		filename:    processID + ".cast",
+		data:        buf.Bytes(),
+	}
+}
+
+// recordAudit appends an action of the user of r to the audit log, see package audit. An error
+// is only logged, the action was done already.
+func (s *Server) recordAudit(r *http.Request, e audit.Entry) {
+	if user := requestUser(r); user != "" && e.User == "" {
+		e.User = user
+	}
+	e.Remote = clientAddress(r)
+	if err := audit.Record(s.stateDir, e); err != nil {
+		slog.Error("Failed to record audit log entry", "action", e.Action, "error", err)
+	}
+}
+
+// clientAddress returns the address of the client of r, with X-Forwarded-For if set. It is
+// for humans, like in the audit log, X-Forwarded-For could be spoofed.
+func clientAddress(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return r.RemoteAddr + " (" + forwarded + ")"
+	}
+	return r.RemoteAddr
+}
+
+// loginClient returns the client of a login request, which gets stored with the session.
+func loginClient(r *http.Request) auth.Client {
+	return auth.Client{Remote: clientAddress(r), UserAgent: r.UserAgent()}
+}
+
+// remoteHost returns the host of the client, without the port. It is the address of the
+// connection, unless the connection comes from a trusted proxy (see SetTrustedProxies). Then it
+// is the last address of X-Forwarded-For or Forwarded which is not a trusted proxy, because the
+// client can put anything in front of the addresses which the proxies append.
+func (s *Server) remoteHost(r *http.Request) string {
+	host := hostOf(r.RemoteAddr)
+	if !s.trustedProxy(host) {
+		return host
+	}
+	hops := forwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !s.trustedProxy(hops[i]) {
+			return hops[i]
+		}
+	}
+	return host
+}
+
+// trustedProxy returns true if host is the address of a trusted proxy.
+func (s *Server) trustedProxy(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(s.trustedProxies, func(p netip.Prefix) bool { return p.Contains(addr.Unmap()) })
+}
+
+// forwardedFor returns the client addresses of the X-Forwarded-For headers, or of the
+// Forwarded headers (RFC 7239) if there are none, in the order of the hops, without ports.
+func forwardedFor(header http.Header) []string {
+	var hops []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, hostOf(strings.TrimSpace(hop)))
+		}
+	}
+	if len(hops) > 0 {
+		return hops
+	}
+	for _, value := range header.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, hop, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hops = append(hops, hostOf(strings.Trim(hop, `"`)))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// hostOf returns address without the port and without the brackets of IPv6 addresses.
+func hostOf(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return strings.Trim(address, "[]")
+}
+
+// userContextKey is the context key of the user of a request, see withUser.
+type userContextKey struct{}
+
+// withUser returns r with the user of its session in the context.
+func withUser(r *http.Request, user string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userContextKey{}, user))
+}
+
+// requestUser returns the user of the session of the request, or the empty string if the
+// request did not pass authMiddleware. The empty string can't access any workspace, see
+// canAccess, so that a handler without authMiddleware fails closed.
+func requestUser(r *http.Request) string {
+	user, _ := r.Context().Value(userContextKey{}).(string)
+	return user
+}
+
+// errNoUser is returned by the handlers which need the user of the request, if the request
+// has none.
+var errNoUser = httperror.HTTPError{StatusCode: http.StatusForbidden, Message: "Not logged in"}
+
+// sessionUser returns the user of the session token, or the empty string if the token is
+// invalid. It is for the pages without authMiddleware.
+func (s *Server) sessionUser(token string) string {
+	session, err := auth.LookupSession(s.stateDir, token)
+	if err != nil || session == nil {
+		return ""
+	}
+	return session.User
+}
+
+// userStateDir returns the directory of the data of the user of the request, like the
+// clipboard. The admin uses the state directory, which has the data from before named users
+// existed.
+func (s *Server) userStateDir(r *http.Request) (string, error) {
+	switch user := requestUser(r); user {
+	case "":
+		return "", errNoUser
+	case auth.AdminUser:
+		return s.stateDir, nil
+	default:
+		return filepath.Join(s.stateDir, "users", user), nil
+	}
+}
+
+// canAccess returns true if the user of the request can access the workspace. The admin can
+// access all workspaces.
+func canAccess(r *http.Request, ws *workspace.Workspace) bool {
+	user := requestUser(r)
+	return user == auth.AdminUser || (user != "" && ws.CanAccess(user))
+}
+
+// getWorkspace returns the workspace id, if the user of the request can access it. The
+// workspaces of other users are not found, so that their IDs don't leak.
+func (s *Server) getWorkspace(r *http.Request, id string) (*workspace.Workspace, error) {
+	ws, err := executor.GetWorkspaceByID(s.stateDir, id)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess(r, ws) {
+		return nil, fmt.Errorf("workspace %q not found", id)
+	}
+	return ws, nil
+}
+
+// listWorkspaces returns the workspaces which the user of the request can access, also the
+// archived ones.
+func (s *Server) listWorkspaces(r *http.Request) ([]*workspace.Workspace, error) {
+	workspaces, err := workspace.ListWorkspaces(s.stateDir)
+	if err != nil {
+		return nil, err
 	}
+	return slices.DeleteFunc(workspaces, func(ws *workspace.Workspace) bool { return !canAccess(r, ws) }), nil
+}
 
-	// Determine file extension based on content type
-	fileExtension := getFileExtensionFromContentType(contentType)
+// canAccessProcess returns true if the user of the request can access the workspace of the
+// process in processDir.
+func canAccessProcess(r *http.Request, processDir string) bool {
+	_, ws, err := workspace.GetWorkspaceOfProcess(processDir)
+	return err == nil && canAccess(r, ws)
+}
 
-	// Return download error which will be handled by wrapHandler
-	return nil, &downloadError{
-		contentType: contentType,
-		filename:    processID + fileExtension,
-		data:        stdoutBytes,
+// adminMiddleware restricts server-wide pages, like the settings and the file browser, to the
+// admin. It has to be wrapped by authMiddleware, which sets the user.
+func (s *Server) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if requestUser(r) != auth.AdminUser {
+			http.Error(w, "Only the admin can access this page", http.StatusForbidden)
+			return
+		}
+		next(w, r)
 	}
 }
 
 func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		token := s.getSessionToken(r)
-		valid := false
-		var expiry time.Time
+		var session *auth.Session
 		if token != "" {
 			var err error
-			valid, expiry, err = auth.ValidateSessionWithExpiry(s.stateDir, token)
+			session, err = auth.LookupSession(s.stateDir, token)
 			if err != nil {
 				slog.Error("Failed to validate session", "error", err)
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
 				return
 			}
 		}
-		if !valid {
+		if session == nil {
 			slog.Info("ValidateSession returned false")
 			basePath := s.getBasePath(r)
 			redirectPath := basePath + "/login"
@@ -1902,26 +5142,93 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Check if session expires in less than 30 minutes
+		// Check if session expires within the extension window
+		expiry := session.Expiry
 		timeUntilExpiry := time.Until(expiry)
-		if timeUntilExpiry < 30*time.Minute {
-			// Extend the session by creating a new token
-			newToken, ok := auth.ExtendSession(s.stateDir, token)
+		if timeUntilExpiry < auth.LoadSessionConfig(s.stateDir).ExtendWithin {
+			// Extend the session by creating a new token. This fails near the maximum lifetime
+			// of the session, the user has to log in again then.
+			newToken, newExpiry, ok := auth.ExtendSession(s.stateDir, token)
 			if ok {
 				// Set new session cookie
-				http.SetCookie(w, &http.Cookie{
-					Name:     "session",
-					Value:    newToken,
-					Path:     "/",
-					HttpOnly: true,
-					MaxAge:   86400, // 24 hours
-				})
+				http.SetCookie(w, s.sessionCookie(r, newToken, int(time.Until(newExpiry).Seconds())))
 				slog.Debug("Session extended", "old_expiry", expiry, "time_until_expiry", timeUntilExpiry)
 			} else {
-				slog.Error("Failed to extend session")
+				slog.Debug("Session not extended", "expiry", expiry)
 			}
 		}
 
+		next(w, withUser(r, session.User))
+	}
+}
+
+// apiMiddleware authenticates requests with an API token in the "Authorization: Bearer"
+// header, see auth.AddAPIToken. Requests without the header need a session, like with
+// authMiddleware, so that the web UI can use the API, too.
+func (s *Server) apiMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			s.authMiddleware(next)(w, r)
+			return
+		}
+		user, ok := auth.APITokenUser(s.stateDir, token)
+		if !ok {
+			http.Error(w, "Invalid API token", http.StatusUnauthorized)
+			return
+		}
+		next(w, withUser(r, user))
+	}
+}
+
+// widgetMiddleware authenticates requests with a widget token from the "token" query
+// parameter or the "Authorization: Bearer" header, the request gets the user of the token. It
+// sets the CORS headers for the origins configured with SetWidgetOrigins, so that dashboards
+// can fetch the widgets.
+func (s *Server) widgetMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin != "" && (slices.Contains(s.widgetOrigins, "*") || slices.Contains(s.widgetOrigins, origin)) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+		}
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.URL.Query().Get("token")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			token = bearer
+		}
+		user, ok := auth.WidgetTokenUser(s.stateDir, token)
+		if !ok {
+			http.Error(w, "Invalid widget token", http.StatusUnauthorized)
+			return
+		}
+		next(w, withUser(r, user))
+	}
+}
+
+// replicationMiddleware authenticates the requests of a standby instance with a replication
+// token in the "Authorization: Bearer" header.
+func (s *Server) replicationMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !auth.ValidateReplicationToken(s.stateDir, token) {
+			http.Error(w, "Invalid replication token", http.StatusUnauthorized)
+			return
+		}
 		next(w, r)
 	}
 }
@@ -1934,12 +5241,85 @@ func (s *Server) getSessionToken(r *http.Request) string {
 	return cookie.Value
 }
 
+// SetBasePath configures the path under which the server is reachable, for example "/shell".
+// Routes are served with and without this prefix, so it works behind proxies which strip the
+// prefix and behind proxies which pass the full path. It must be called before SetupRoutes.
+func (s *Server) SetBasePath(basePath string) error {
+	basePath = strings.TrimSuffix(basePath, "/")
+	if basePath == "" {
+		s.basePath = ""
+		return nil
+	}
+	if !strings.HasPrefix(basePath, "/") || path.Clean(basePath) != basePath || strings.ContainsAny(basePath, "?#{}") {
+		return fmt.Errorf("invalid base path %q: it must be an absolute URL path like /shell", basePath)
+	}
+	s.basePath = basePath
+	return nil
+}
+
+// SetWidgetOrigins configures the origins which may fetch the widgets with JavaScript, for
+// example "https://grafana.example.com". "*" allows all origins.
+func (s *Server) SetWidgetOrigins(origins []string) {
+	s.widgetOrigins = origins
+}
+
+// SetTrustedProxies configures the reverse proxies, whose X-Forwarded-For and Forwarded headers
+// tell the address of the client for the login rate limit. Without trusted proxies the address
+// of the connection is used, behind a proxy all clients would share one limit.
+func (s *Server) SetTrustedProxies(proxies []netip.Prefix) {
+	s.trustedProxies = proxies
+}
+
+// SetDefaultRetention configures the retention policy of the workspaces which have none of
+// their own.
+func (s *Server) SetDefaultRetention(policy retention.Policy) {
+	s.defaultRetention = policy
+}
+
+// SetStorageWarning configures the size of the state directory in bytes above which the admin
+// gets a warning. 0 disables the warning.
+func (s *Server) SetStorageWarning(bytes int64) {
+	s.storageWarning = bytes
+}
+
+// EnableDemo switches the server to demo mode: commands are not executed, see executor.Fake,
+// and the interactive terminal is not available.
+func (s *Server) EnableDemo() {
+	s.executor = &executor.Fake{}
+	s.demo = true
+}
+
+// getBasePath returns the prefix for URLs in links, redirects and cookies. It is the
+// X-Forwarded-Prefix header of the reverse proxy followed by the configured base path. If
+// the header already ends with the base path (the proxy sets the header and passes the full
+// path), the base path is not added twice.
 func (s *Server) getBasePath(r *http.Request) string {
-	// Check for reverse proxy header (standard convention)
-	if prefix := r.Header.Get("X-Forwarded-Prefix"); prefix != "" {
-		return strings.TrimSuffix(prefix, "/")
+	prefix := strings.TrimSuffix(r.Header.Get("X-Forwarded-Prefix"), "/")
+	if strings.HasSuffix(prefix, s.basePath) {
+		return prefix
+	}
+	return prefix + s.basePath
+}
+
+// sessionMaxAge returns the max age of the cookie of a new session in seconds.
+func (s *Server) sessionMaxAge() int {
+	return int(auth.LoadSessionConfig(s.stateDir).Duration.Seconds())
+}
+
+// sessionCookie creates the session cookie. It is limited to the base path, so that other
+// applications behind the same proxy don't get it. maxAge -1 deletes the cookie.
+func (s *Server) sessionCookie(r *http.Request, token string, maxAge int) *http.Cookie {
+	cookiePath := s.getBasePath(r)
+	if cookiePath == "" {
+		cookiePath = "/"
+	}
+	return &http.Cookie{
+		Name:     "session",
+		Value:    token,
+		Path:     cookiePath,
+		HttpOnly: true,
+		MaxAge:   maxAge,
 	}
-	return ""
 }
 
 // cleanupStaleProcesses checks for processes marked as running but no longer active
@@ -1979,6 +5359,11 @@ func (s *Server) cleanupStaleProcesses() {
 				continue
 			}
 
+			// Files which a crashed writer left inconsistent are repaired once the writer is gone
+			if err := process.Repair(proc); err != nil {
+				slog.Error("Failed to repair process files", "processDir", processDir, "error", err)
+			}
+
 			// Skip processes that are already marked as completed
 			if proc.Completed {
 				continue
@@ -1989,56 +5374,42 @@ func (s *Server) cleanupStaleProcesses() {
 				continue
 			}
 
-			// Check if the process is still running
-			osProc, err := os.FindProcess(proc.PID)
-			if err != nil {
-				// Process doesn't exist, mark as completed
-				slog.Info("Marking stale process as completed", "workspace", workspaceEntry.Name(), "process", processEntry.Name(), "pid", proc.PID)
-				s.markProcessAsCompleted(processDir, -1, "cleanup-stale-process")
-				continue
-			}
-
-			// Try to send signal 0 to check if process exists
-			err = osProc.Signal(syscall.Signal(0))
-			if err != nil {
-				// Process doesn't exist or we don't have permission
-				slog.Info("Marking stale process as completed", "workspace", workspaceEntry.Name(), "process", processEntry.Name(), "pid", proc.PID, "error", err)
-				s.markProcessAsCompleted(processDir, -1, "cleanup-stale-process")
+			// Check if the command is still running. The nohup wrapper writes the exit
+			// status, if it died too, the exit status is unknown.
+			if !proc.Alive() {
+				slog.Info("Marking orphaned process as completed", "workspace", workspaceEntry.Name(), "process", processEntry.Name(), "pid", proc.PID)
+				if err := process.MarkOrphaned(processDir); err != nil {
+					slog.Error("Failed to mark orphaned process", "processDir", processDir, "error", err)
+				}
 			}
 		}
 	}
 }
 
-// markProcessAsCompleted marks a process as completed by writing the necessary files
-func (s *Server) markProcessAsCompleted(processDir string, exitCode int, signal string) {
-	now := time.Now()
-
-	// Write completed file
-	if err := os.WriteFile(filepath.Join(processDir, "completed"), []byte("true"), 0o644); err != nil {
-		slog.Error("Failed to write completed file", "processDir", processDir, "error", err)
-	}
+// queueInterval is how often the queued processes are checked for a free slot, see
+// executor.StartQueued.
+const queueInterval = 2 * time.Second
 
-	// Write endtime file
-	if err := os.WriteFile(filepath.Join(processDir, "endtime"), []byte(now.Format(time.RFC3339Nano)), 0o644); err != nil {
-		slog.Error("Failed to write endtime file", "processDir", processDir, "error", err)
-	}
+// terminalReapInterval is how often the terminal sessions are checked against terminal.Policy.
+const terminalReapInterval = 30 * time.Second
 
-	// Write exit status if provided
-	if exitCode >= 0 {
-		if err := os.WriteFile(filepath.Join(processDir, "exit-status"), []byte(fmt.Sprintf("%d", exitCode)), 0o644); err != nil {
-			slog.Error("Failed to write exit-status file", "processDir", processDir, "error", err)
-		}
-	}
+// Timeouts of the HTTP server. The WebSockets are not affected, the upgrade clears the
+// deadlines of the connection.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 5 * time.Minute // Uploads of big files
+	writeTimeout      = 5 * time.Minute // Downloads and exports of big files
+	idleTimeout       = 2 * time.Minute
+)
 
-	// Write signal if provided
-	if signal != "" {
-		if err := os.WriteFile(filepath.Join(processDir, "signal"), []byte(signal), 0o644); err != nil {
-			slog.Error("Failed to write signal file", "processDir", processDir, "error", err)
-		}
-	}
-}
+// shutdownTimeout is how long Start waits for the responses in flight and the terminal
+// sessions to finish, when ctx is done.
+const shutdownTimeout = 10 * time.Second
 
-func (s *Server) Start(addr string) error {
+// Start serves on addr, or on the sockets of systemd socket activation, until ctx is done. Then it stops accepting connections, waits for the
+// responses in flight, and ends the terminal sessions, see terminal.Manager.Shutdown.
+// Background processes keep running, a restarted server picks them up.
+func (s *Server) Start(ctx context.Context, addr string) error {
 	// Run cleanup immediately on startup
 	s.cleanupStaleProcesses()
 
@@ -2051,17 +5422,137 @@ func (s *Server) Start(addr string) error {
 		}
 	}()
 
+	// Start queued processes when their workspace has a free slot
+	go func() {
+		ticker := time.NewTicker(queueInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := executor.StartQueued(s.stateDir); err != nil {
+				slog.Error("Failed to start queued processes", "error", err)
+			}
+		}
+	}()
+
+	// Prune old processes according to the retention policy of each workspace, and warn if the
+	// state directory is still too big
+	retention.ApplyAll(s.stateDir, s.defaultRetention)
+	go func() {
+		s.checkStorage()
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			retention.ApplyAll(s.stateDir, s.defaultRetention)
+			s.checkStorage()
+		}
+	}()
+
+	// Terminate idle terminal sessions, the policy can be changed on the settings page
+	go func() {
+		ticker := time.NewTicker(terminalReapInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n := s.terminals.Reap(terminal.LoadPolicy(s.stateDir), time.Now()); n > 0 {
+				slog.Info("Terminated terminal sessions", "count", n)
+			}
+		}
+	}()
+
 	// Clean expired sessions periodically
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
 		for range ticker.C {
 			auth.CleanExpiredSessions(s.stateDir)
+			share.CleanExpired(s.stateDir)
 		}
 	}()
 
-	log.Printf("Starting server on http://%s", addr)
-	return http.ListenAndServe(addr, s.SetupRoutes())
+	listeners, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{
+		Handler:           s.SetupRoutes(),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	errc := make(chan error, len(listeners))
+	for _, l := range listeners {
+		log.Printf("Starting server on http://%s", l.Addr())
+		go func() { errc <- httpServer.Serve(l) }()
+	}
+
+	// Type=notify of the systemd unit waits for this
+	if _, err := systemd.Notify("READY=1"); err != nil {
+		slog.Warn("Failed to notify systemd about readiness", "error", err)
+	}
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		go s.watchdog(ctx, interval)
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	if _, err := systemd.Notify("STOPPING=1"); err != nil {
+		slog.Warn("Failed to notify systemd about stopping", "error", err)
+	}
+	slog.Info("Shutting down server", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = httpServer.Shutdown(shutdownCtx)
+	if err != nil {
+		err = fmt.Errorf("failed to shut down HTTP server: %w", err)
+	}
+	err = errors.Join(err, s.terminals.Shutdown(shutdownCtx, s.stateDir))
+	if err == nil {
+		slog.Info("Server stopped")
+	}
+	return err
+}
+
+// listen returns the sockets which systemd passed with socket activation, see
+// systemd.Listeners. Without socket activation it listens on addr.
+func listen(addr string) ([]net.Listener, error) {
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) > 0 {
+		slog.Info("Using the sockets of systemd socket activation", "count", len(listeners))
+		return listeners, nil
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return []net.Listener{l}, nil
+}
+
+// watchdog notifies the systemd watchdog twice per interval, until ctx is done. A state
+// directory which became inaccessible, for example an unmounted disk, stops the
+// notifications, so that systemd restarts the server.
+func (s *Server) watchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := os.Stat(s.stateDir); err != nil {
+			slog.Error("State directory is not accessible, skipping watchdog notification", "error", err)
+			continue
+		}
+		if _, err := systemd.Notify("WATCHDOG=1"); err != nil {
+			slog.Warn("Failed to notify systemd watchdog", "error", err)
+		}
+	}
 }
 
 // GetStateDir returns the state directory, using the provided value,
@@ -2106,8 +5597,8 @@ type LogFileHandle struct {
 func (h *LogFileHandle) Close() error {
 	// Restore original stdout/stderr by duplicating the saved FDs back
 	// This causes the pipes to receive EOF
-	_ = syscall.Dup2(h.origStdoutFD, int(os.Stdout.Fd()))
-	_ = syscall.Dup2(h.origStderrFD, int(os.Stderr.Fd()))
+	_ = redirectFD(h.origStdoutFD, int(os.Stdout.Fd()))
+	_ = redirectFD(h.origStderrFD, int(os.Stderr.Fd()))
 
 	// Close the pipe writers to signal EOF to the goroutines
 	_ = h.stdoutWriter.Close()
@@ -2152,15 +5643,15 @@ func setupServerLog(stateDir string) (*LogFileHandle, error) {
 	}
 
 	// Duplicate original stdout (FD 1) and stderr (FD 2) to save them
-	origStdoutFD, err := syscall.Dup(int(os.Stdout.Fd()))
+	origStdoutFD, err := dupFD(int(os.Stdout.Fd()))
 	if err != nil {
 		_ = logFile.Close()
 		return nil, fmt.Errorf("failed to dup stdout: %w", err)
 	}
 
-	origStderrFD, err := syscall.Dup(int(os.Stderr.Fd()))
+	origStderrFD, err := dupFD(int(os.Stderr.Fd()))
 	if err != nil {
-		_ = syscall.Close(origStdoutFD)
+		_ = closeFD(origStdoutFD)
 		_ = logFile.Close()
 		return nil, fmt.Errorf("failed to dup stderr: %w", err)
 	}
@@ -2190,7 +5681,7 @@ func setupServerLog(stateDir string) (*LogFileHandle, error) {
 	}
 
 	// Redirect FD 1 (stdout) to the write end of stdout pipe
-	if err := syscall.Dup2(int(stdoutWriter.Fd()), int(os.Stdout.Fd())); err != nil {
+	if err := redirectFD(int(stdoutWriter.Fd()), int(os.Stdout.Fd())); err != nil {
 		_ = stderrReader.Close()
 		_ = stderrWriter.Close()
 		_ = stdoutReader.Close()
@@ -2202,7 +5693,7 @@ func setupServerLog(stateDir string) (*LogFileHandle, error) {
 	}
 
 	// Redirect FD 2 (stderr) to the write end of stderr pipe
-	if err := syscall.Dup2(int(stderrWriter.Fd()), int(os.Stderr.Fd())); err != nil {
+	if err := redirectFD(int(stderrWriter.Fd()), int(os.Stderr.Fd())); err != nil {
 		_ = stderrReader.Close()
 		_ = stderrWriter.Close()
 		_ = stdoutReader.Close()
@@ -2245,9 +5736,8 @@ func setupServerLog(stateDir string) (*LogFileHandle, error) {
 }
 
 // Run starts the server with the given configuration
-func Run(stateDir, port string, debugHTML bool) error {
-	var err error
-	stateDir, err = GetStateDir(stateDir, false)
+func Run(cfg config.Config, debugHTML bool) error {
+	stateDir, err := GetStateDir(cfg.StateDir, false)
 	if err != nil {
 		return err
 	}
@@ -2270,12 +5760,12 @@ func Run(stateDir, port string, debugHTML bool) error {
 	}
 
 	// Check if any passwords are configured
-	entries, err := os.ReadDir(passwordDir)
+	hasPasswords, err := auth.HasPasswords(stateDir)
 	if err != nil {
-		return fmt.Errorf("failed to read hashed-passwords directory: %w", err)
+		return err
 	}
-	if len(entries) == 0 {
-		slog.Warn("No passwords configured yet. Add one with: mobileshell add-password")
+	if !hasPasswords {
+		slog.Warn("No passwords configured yet. Add one with: mobileshell add-password, or open the web UI to run the setup wizard")
 	}
 
 	// Initialize auth
@@ -2288,17 +5778,74 @@ func Run(stateDir, port string, debugHTML bool) error {
 		return fmt.Errorf("failed to initialize executor: %w", err)
 	}
 
+	// The settings of the config file win over the ones of the settings page
+	if err := cfg.Apply(stateDir); err != nil {
+		return err
+	}
+
 	srv, err := New(stateDir, debugHTML)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
+	if err := srv.SetBasePath(cfg.BasePath); err != nil {
+		return err
+	}
+	srv.SetWidgetOrigins(cfg.WidgetOrigins)
+	trustedProxies, err := cfg.TrustedProxyPrefixes()
+	if err != nil {
+		return err
+	}
+	srv.SetTrustedProxies(trustedProxies)
+	srv.SetDefaultRetention(cfg.RetentionPolicy())
+	srv.SetStorageWarning(cfg.Storage.WarningBytes)
 
 	if debugHTML {
 		slog.Info("HTML validation enabled - invalid HTML will return 500 errors")
 	}
 
+	// Shut down gracefully on Ctrl-C and on SIGTERM, for example from systemd
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return srv.Start(ctx, net.JoinHostPort(cfg.Listen, cfg.Port))
+}
+
+// RunDemo starts the server in demo mode with a temporary state directory, which gets seeded
+// with demo workspaces and processes. Commands are not executed, see EnableDemo. The state
+// directory is removed when the server stops.
+func RunDemo(port string, debugHTML bool) error {
+	stateDir, err := os.MkdirTemp("", "mobileshell-demo-")
+	if err != nil {
+		return fmt.Errorf("failed to create demo state directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(stateDir) }()
+
+	if err := auth.InitAuth(stateDir); err != nil {
+		return fmt.Errorf("failed to initialize auth: %w", err)
+	}
+	password := rand.Text() + rand.Text()
+	if err := auth.AddPassword(stateDir, password); err != nil {
+		return err
+	}
+	if err := executor.InitExecutor(stateDir); err != nil {
+		return fmt.Errorf("failed to initialize executor: %w", err)
+	}
+	if err := demo.Seed(stateDir); err != nil {
+		return fmt.Errorf("failed to seed demo: %w", err)
+	}
+
+	srv, err := New(stateDir, debugHTML)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+	srv.EnableDemo()
+
 	addr := fmt.Sprintf("localhost:%s", port)
-	return srv.Start(addr)
+	fmt.Fprintf(os.Stderr, "Demo mode: commands are not executed.\nOpen http://%s/ and log in with the password: %s\n", addr, password)
+
+	// Stop on Ctrl-C, so that the state directory gets removed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return srv.Start(ctx, addr)
 }
 
 // WebSocket upgrader
@@ -2338,7 +5885,7 @@ func (s *Server) handleTerminal(ctx context.Context, r *http.Request) ([]byte, e
 	processID := r.PathValue("processID")
 
 	// Get workspace
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	ws, err := s.getWorkspace(r, workspaceID)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
@@ -2353,15 +5900,19 @@ func (s *Server) handleTerminal(ctx context.Context, r *http.Request) ([]byte, e
 	basePath := s.getBasePath(r)
 
 	data := struct {
-		BasePath      string
-		WorkspaceID   string
-		WorkspaceName string
-		Process       *process.Process
+		BasePath    string
+		WorkspaceID string
+		Workspace   *workspace.Workspace
+		Process     *process.Process
+		Multiplexer string // Terminal multiplexer of the session, "" if it runs in none
+		Watch       bool   // Attached to an active session without input, see handleWebSocketTerminal
 	}{
-		BasePath:      basePath,
-		WorkspaceID:   workspaceID,
-		WorkspaceName: ws.Name,
-		Process:       proc,
+		BasePath:    basePath,
+		WorkspaceID: workspaceID,
+		Workspace:   ws,
+		Process:     proc,
+		Multiplexer: terminal.ReadMultiplexer(processDir),
+		Watch:       r.URL.Query().Get("mode") == "watch",
 	}
 
 	var buf bytes.Buffer
@@ -2382,7 +5933,7 @@ func (s *Server) handleTerminalExecute(ctx context.Context, r *http.Request) ([]
 	}
 
 	// Get workspace
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	ws, err := s.getWorkspace(r, workspaceID)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
@@ -2393,20 +5944,22 @@ func (s *Server) handleTerminalExecute(ctx context.Context, r *http.Request) ([]
 		if ws.DefaultTerminalCommand != "" {
 			command = ws.DefaultTerminalCommand
 		} else {
-			// Check if tmux is available
-			if _, err := exec.LookPath("tmux"); err == nil {
-				command = "tmux"
-			} else {
-				command = "bash"
-			}
+			command = terminal.DefaultCommand(ws.ID)
 		}
 	}
 
 	// Create the process
-	proc, err := executor.Execute(ws, command)
+	proc, err := s.executor.Execute(ws, command, "", process.Limits{})
 	if err != nil {
+		if errors.Is(err, workspace.ErrCommandDenied) {
+			return nil, s.commandDeniedError(r, ws.ID, err)
+		}
 		return nil, fmt.Errorf("failed to execute command: %w", err)
 	}
+	s.recordAudit(r, audit.Entry{Action: audit.ActionExecute, Workspace: ws.ID, Process: proc.CommandId, Detail: command})
+	if err := terminal.WriteMultiplexer(proc.ProcessDir, command); err != nil {
+		return nil, err
+	}
 
 	// Redirect to terminal view
 	basePath := s.getBasePath(r)
@@ -2414,6 +5967,54 @@ func (s *Server) handleTerminalExecute(ctx context.Context, r *http.Request) ([]
 	return nil, &redirectError{url: redirectURL, statusCode: http.StatusSeeOther}
 }
 
+// handleTerminals lists the active interactive terminal sessions. A POST terminates the
+// session of the form value "session".
+func (s *Server) handleTerminals(ctx context.Context, r *http.Request) ([]byte, error) {
+	basePath := s.getBasePath(r)
+	if r.Method == http.MethodPost {
+		sessionID := r.FormValue("session")
+		session, err := s.terminals.Session(sessionID)
+		if err == nil {
+			_, err = s.getWorkspace(r, session.WorkspaceID())
+		}
+		if err == nil {
+			err = s.terminals.KillSession(sessionID)
+		}
+		if err != nil {
+			return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: err.Error()}
+		}
+		slog.Info("Terminal session terminated", "session", sessionID)
+		return nil, &redirectError{url: basePath + "/terminals", statusCode: http.StatusSeeOther}
+	}
+
+	// Only the sessions in the workspaces of the user
+	sessions := slices.DeleteFunc(s.terminals.ListSessions(), func(info terminal.SessionInfo) bool {
+		_, err := s.getWorkspace(r, info.WorkspaceID)
+		return err != nil
+	})
+	// The sessions which were active when the server shut down, they can be opened again
+	saved, err := terminal.LoadSavedSessions(s.stateDir)
+	if err != nil {
+		return nil, err
+	}
+	if saved != nil {
+		saved.Sessions = slices.DeleteFunc(saved.Sessions, func(info terminal.SessionInfo) bool {
+			_, err := s.getWorkspace(r, info.WorkspaceID)
+			return err != nil
+		})
+	}
+	var buf bytes.Buffer
+	err = s.tmpl.ExecuteTemplate(&buf, "terminals.gohtml", map[string]any{
+		"BasePath": basePath,
+		"Sessions": sessions,
+		"Saved":    saved,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // handleWebSocketTerminal handles WebSocket connections for interactive terminals
 func (s *Server) handleWebSocketTerminal(w http.ResponseWriter, r *http.Request) {
 	// Authenticate
@@ -2429,8 +6030,17 @@ func (s *Server) handleWebSocketTerminal(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if s.demo {
+		http.Error(w, "The terminal is not available in demo mode", http.StatusForbidden)
+		return
+	}
+
 	workspaceID := r.PathValue("id")
 	processID := r.PathValue("processID")
+	if _, err := s.getWorkspace(r, workspaceID); err != nil {
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return
+	}
 
 	// Get the process to get the command
 	processDir := filepath.Join(s.stateDir, "workspaces", workspaceID, "processes", processID)
@@ -2440,6 +6050,19 @@ func (s *Server) handleWebSocketTerminal(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// ?session= attaches to an active session instead of starting one, ?mode=watch without input
+	var session *terminal.Session
+	if sessionID := r.URL.Query().Get("session"); sessionID != "" {
+		session, err = s.terminals.Session(sessionID)
+		if err == nil && session.WorkspaceID() != workspaceID {
+			err = terminal.ErrSessionNotFound
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
 	// Upgrade to WebSocket
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -2447,22 +6070,35 @@ func (s *Server) handleWebSocketTerminal(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Create terminal session
-	session, err := terminal.NewSession(ws, s.stateDir, workspaceID, proc.Command)
-	if err != nil {
-		slog.Error("Failed to create terminal session", "error", err)
-		_ = ws.Close()
-		return
-	}
+	if session == nil {
+		// Create terminal session
+		session, err = terminal.NewSession(s.stateDir, workspaceID, proc.Command)
+		if err != nil {
+			slog.Error("Failed to create terminal session", "error", err)
+			if errors.Is(err, workspace.ErrCommandDenied) {
+				// The terminal shows the reason instead of closing without a word
+				s.recordAudit(r, audit.Entry{Action: audit.ActionExecuteDenied, Workspace: workspaceID, Process: processID, Detail: err.Error()})
+				_ = ws.WriteMessage(websocket.TextMessage, []byte("\r\n"+err.Error()+"\r\n"))
+			}
+			_ = ws.Close()
+			return
+		}
 
-	// Start the session
-	session.Start()
+		// Record the session as a process of the workspace, which can be replayed as asciicast
+		if _, err := session.Record(); err != nil {
+			slog.Warn("Failed to record terminal session", "error", err)
+		}
 
-	// Wait for session to complete
-	session.Wait()
+		// Start the session, it cleans up when it ended
+		session.Start()
+		s.terminals.Add(session)
+		s.recordAudit(r, audit.Entry{Action: audit.ActionTerminal, Workspace: workspaceID, Process: processID, Detail: "start " + proc.Command})
+	} else {
+		s.recordAudit(r, audit.Entry{Action: audit.ActionTerminal, Workspace: workspaceID, Process: processID, Detail: strings.TrimSpace("attach " + r.URL.Query().Get("mode"))})
+	}
 
-	// Clean up
-	_ = session.Close()
+	// Serve the browser until it disconnects or the session ended
+	session.Attach(ws, r.URL.Query().Get("mode") == "watch")
 }
 
 // handleFileEditor shows the file editor page
@@ -2470,7 +6106,7 @@ func (s *Server) handleFileEditor(ctx context.Context, r *http.Request) ([]byte,
 	workspaceID := r.PathValue("id")
 
 	// Get workspace
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	ws, err := s.getWorkspace(r, workspaceID)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
@@ -2478,15 +6114,15 @@ func (s *Server) handleFileEditor(ctx context.Context, r *http.Request) ([]byte,
 	basePath := s.getBasePath(r)
 
 	data := struct {
-		BasePath      string
-		WorkspaceID   string
-		WorkspaceName string
-		Directory     string
+		BasePath    string
+		WorkspaceID string
+		Workspace   *workspace.Workspace
+		Directory   string
 	}{
-		BasePath:      basePath,
-		WorkspaceID:   workspaceID,
-		WorkspaceName: ws.Name,
-		Directory:     ws.Directory,
+		BasePath:    basePath,
+		WorkspaceID: workspaceID,
+		Workspace:   ws,
+		Directory:   ws.Directory,
 	}
 
 	var buf bytes.Buffer
@@ -2506,7 +6142,7 @@ func (s *Server) handleFileRead(ctx context.Context, r *http.Request) ([]byte, e
 	workspaceID := r.PathValue("id")
 
 	// Get workspace
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	ws, err := s.getWorkspace(r, workspaceID)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
@@ -2565,7 +6201,7 @@ func (s *Server) handleFileSave(ctx context.Context, r *http.Request) ([]byte, e
 	workspaceID := r.PathValue("id")
 
 	// Get workspace
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	ws, err := s.getWorkspace(r, workspaceID)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
@@ -2594,14 +6230,14 @@ func (s *Server) handleFileSave(ctx context.Context, r *http.Request) ([]byte, e
 
 	// Check if file has been modified since the user loaded it
 	if currentSession.OriginalChecksum != originalChecksum {
-		// File has been modified externally - create a conflict response
-		result := &fileeditor.FileEditResult{
-			Success:          false,
-			ConflictDetected: true,
-			Message:          "File has been modified externally. Please review the current content and try again.",
-			// We can only show the diff between current and proposed since we don't have the original
-			ProposedDiff: fileeditor.GenerateDiff(currentSession.OriginalContent, newContent),
+		// File has been modified externally - create a conflict response. The form contains the
+		// content the user started with, so that both changes can be merged
+		loadedSession := &fileeditor.FileSession{
+			FilePath:         filePath,
+			OriginalContent:  r.FormValue("original_content"),
+			OriginalChecksum: originalChecksum,
 		}
+		result := fileeditor.Conflict(loadedSession, currentSession.OriginalContent, newContent)
 
 		basePath := s.getBasePath(r)
 		data := struct {
@@ -2615,6 +6251,9 @@ func (s *Server) handleFileSave(ctx context.Context, r *http.Request) ([]byte, e
 			ProposedDiff     string
 			NewChecksum      string
 			CurrentContent   string
+			CurrentChecksum  string
+			MergedContent    string
+			MergeConflicts   int
 		}{
 			BasePath:         basePath,
 			WorkspaceID:      workspaceID,
@@ -2622,8 +6261,12 @@ func (s *Server) handleFileSave(ctx context.Context, r *http.Request) ([]byte, e
 			Success:          result.Success,
 			Message:          result.Message,
 			ConflictDetected: result.ConflictDetected,
+			ExternalDiff:     result.ExternalDiff,
 			ProposedDiff:     result.ProposedDiff,
 			CurrentContent:   currentSession.OriginalContent,
+			CurrentChecksum:  currentSession.OriginalChecksum,
+			MergedContent:    result.MergedContent,
+			MergeConflicts:   result.MergeConflicts,
 		}
 
 		var buf bytes.Buffer
@@ -2641,6 +6284,9 @@ func (s *Server) handleFileSave(ctx context.Context, r *http.Request) ([]byte, e
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusInternalServerError, Message: fmt.Sprintf("Failed to write file: %v", err)}
 	}
+	if result.Success {
+		s.recordAudit(r, audit.Entry{Action: audit.ActionFileWrite, Workspace: workspaceID, Detail: relativePath})
+	}
 
 	basePath := s.getBasePath(r)
 
@@ -2654,6 +6300,7 @@ func (s *Server) handleFileSave(ctx context.Context, r *http.Request) ([]byte, e
 		ExternalDiff     string
 		ProposedDiff     string
 		NewChecksum      string
+		NewContent       string
 	}{
 		BasePath:         basePath,
 		WorkspaceID:      workspaceID,
@@ -2664,6 +6311,7 @@ func (s *Server) handleFileSave(ctx context.Context, r *http.Request) ([]byte, e
 		ExternalDiff:     result.ExternalDiff,
 		ProposedDiff:     result.ProposedDiff,
 		NewChecksum:      result.NewChecksum,
+		NewContent:       newContent,
 	}
 
 	var buf bytes.Buffer
@@ -2683,7 +6331,7 @@ func (s *Server) handleFileAutocomplete(ctx context.Context, r *http.Request) ([
 	workspaceID := r.PathValue("id")
 
 	// Get workspace
-	ws, err := executor.GetWorkspaceByID(s.stateDir, workspaceID)
+	ws, err := s.getWorkspace(r, workspaceID)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
 	}
@@ -2724,6 +6372,47 @@ func (s *Server) handleFileAutocomplete(ctx context.Context, r *http.Request) ([
 	return jsonBytes, nil
 }
 
+// contentSearchTimeout limits jsonHandleFileSearch, the result contains the matches which were
+// found until then.
+const contentSearchTimeout = 10 * time.Second
+
+// jsonHandleFileSearch greps the files of the workspace directory. The query parameters are
+// "q" (regular expression), "ignore_case", "context" (lines before and after a match) and "max"
+// (results).
+func (s *Server) jsonHandleFileSearch(ctx context.Context, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodGet {
+		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	}
+	ws, err := s.getWorkspace(r, r.PathValue("id"))
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusNotFound, Message: "Workspace not found"}
+	}
+	query := r.URL.Query()
+	opts := fileeditor.ContentSearchOptions{
+		Pattern:    query.Get("q"),
+		IgnoreCase: query.Get("ignore_case") == "true",
+	}
+	for name, value := range map[string]*int{"context": &opts.ContextLines, "max": &opts.MaxResults} {
+		if param := query.Get(name); param != "" {
+			if *value, err = strconv.Atoi(param); err != nil {
+				return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("Invalid %s", name)}
+			}
+		}
+	}
+
+	searchCtx, cancel := context.WithTimeout(ctx, contentSearchTimeout)
+	defer cancel()
+	result, err := fileeditor.SearchContent(searchCtx, ws.Directory, opts)
+	if err != nil {
+		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &contentTypeError{contentType: "application/json", data: data}
+}
+
 // handleFileBrowser handles browsing local files and directories
 func (s *Server) handleFileBrowser(ctx context.Context, r *http.Request) ([]byte, error) {
 	if r.Method != http.MethodGet {
@@ -2777,10 +6466,7 @@ func (s *Server) handleFileBrowser(ctx context.Context, r *http.Request) ([]byte
 			}
 
 			// Get owner (Unix only)
-			owner := ""
-			if stat, ok := entryInfo.Sys().(*syscall.Stat_t); ok {
-				owner = fmt.Sprintf("%d:%d", stat.Uid, stat.Gid)
-			}
+			owner := fileOwner(entryInfo)
 
 			fileInfo := FileInfo{
 				Name:        entry.Name(),
@@ -3,21 +3,46 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
+	"maps"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"mobileshell/internal/audit"
 	"mobileshell/internal/auth"
 	"mobileshell/internal/executor"
+	"mobileshell/internal/export"
+	"mobileshell/internal/fileeditor"
+	"mobileshell/internal/notify"
 	"mobileshell/internal/process"
+	"mobileshell/internal/replication"
+	"mobileshell/internal/retention"
+	"mobileshell/internal/share"
+	"mobileshell/internal/terminal"
+	"mobileshell/internal/upload"
+	"mobileshell/internal/webhook"
+	"mobileshell/internal/webpush"
+	"mobileshell/internal/workspace"
 	"mobileshell/pkg/httperror"
 	"mobileshell/pkg/outputlog"
 
@@ -409,7 +434,7 @@ func TestAuthMiddleware(t *testing.T) {
 		t.Fatalf("Failed to add password: %v", err)
 	}
 
-	validToken, success := auth.Authenticate(t.Context(), stateDir, password)
+	validToken, success := auth.Authenticate(t.Context(), stateDir, password, auth.Client{})
 	if !success {
 		t.Fatal("Failed to authenticate")
 	}
@@ -660,7 +685,7 @@ func TestBinaryDownload(t *testing.T) {
 
 	// Create a fake process by directly setting up the process directory structure
 	// This avoids issues with running actual commands in the test environment
-	proc, err := executor.Execute(ws, "test binary command")
+	proc, err := executor.Execute(ws, "test binary command", "")
 	if err != nil {
 		t.Fatalf("Failed to create process: %v", err)
 	}
@@ -705,7 +730,7 @@ func TestBinaryDownload(t *testing.T) {
 		t.Fatalf("Failed to add password: %v", err)
 	}
 
-	token, success := auth.Authenticate(context.Background(), stateDir, password)
+	token, success := auth.Authenticate(context.Background(), stateDir, password, auth.Client{})
 	if !success {
 		t.Fatal("Failed to authenticate")
 	}
@@ -865,3 +890,2722 @@ func TestServerLogCapture(t *testing.T) {
 		t.Error("server.log should not be empty")
 	}
 }
+
+func TestHxHandleOutputWithOffset(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "offset-ws", stateDir, "")
+	require.NoError(t, err)
+
+	processID := "2025-01-07T12:34:56.789Z"
+	processDir := writeTestProcessDir(t, ws.Path, processID, false)
+	first := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("first\n")})
+	second := outputlog.FormatChunk(outputlog.Chunk{Stream: "stderr", Timestamp: time.Now(), Line: []byte("second\n")})
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), append(first, second...), 0o600))
+
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("GET", fmt.Sprintf("/workspaces/%s/processes/%s/hx-output?offset=%d", ws.ID, processID, len(first)), nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	body, err := srv.hxHandleOutput(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<span class="output-chunk stderr">second`)
+	require.NotContains(t, string(body), "first")
+	require.Contains(t, string(body), fmt.Sprintf(`data-next-offset="%d"`, len(first)+len(second)))
+
+	req = withUser(httptest.NewRequest("GET", fmt.Sprintf("/workspaces/%s/processes/%s/hx-output?offset=-1", ws.ID, processID), nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.hxHandleOutput(context.Background(), req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+}
+
+func TestHxHandleOutputWindow(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "window-ws", stateDir, "")
+	require.NoError(t, err)
+
+	processID := "2025-01-07T12:34:56.789Z"
+	processDir := writeTestProcessDir(t, ws.Path, processID, true)
+	start := time.Date(2025, 1, 7, 14, 30, 0, 0, time.UTC)
+	first := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: start, Line: []byte("first\n")})
+	second := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: start.Add(5 * time.Minute), Line: []byte("second\n")})
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), append(first, second...), 0o600))
+
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("GET", fmt.Sprintf("/workspaces/%s/processes/%s/hx-output?at=2025-01-07T14:32", ws.ID, processID), nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	body, err := srv.hxHandleOutput(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<span class="output-chunk stdout">second`)
+	require.NotContains(t, string(body), "first")
+	require.Contains(t, string(body), `class="output-delta output-container"`)
+
+	req = withUser(httptest.NewRequest("GET", fmt.Sprintf("/workspaces/%s/processes/%s/hx-output?lines=2", ws.ID, processID), nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	body, err = srv.hxHandleOutput(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "first")
+	require.Contains(t, string(body), "second")
+
+	req = withUser(httptest.NewRequest("GET", fmt.Sprintf("/workspaces/%s/processes/%s/hx-output?lines=x", ws.ID, processID), nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.hxHandleOutput(context.Background(), req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+}
+
+func TestHxHandleOutputRendered(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "rendered-ws", stateDir, "")
+	require.NoError(t, err)
+
+	inkDir := writeTestProcessDir(t, ws.Path, "2025-01-07T12:00:00Z", true)
+	stdout := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("\x1b[32mPASS\x1b[0m <test>\n")})
+	require.NoError(t, os.WriteFile(filepath.Join(inkDir, "output.log"), stdout, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(inkDir, "output-type"), []byte("ink,ANSI color codes"), 0o600))
+
+	markdownDir := writeTestProcessDir(t, ws.Path, "2025-01-07T13:00:00Z", true)
+	stdout = outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("# Report\n")})
+	require.NoError(t, os.WriteFile(filepath.Join(markdownDir, "output.log"), stdout, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(markdownDir, "output-type"), []byte("markdown,significant markdown formatting detected"), 0o600))
+
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/processes/2025-01-07T12:00:00Z/hx-output", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "2025-01-07T12:00:00Z")
+	body, err := srv.hxHandleOutput(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<div class="output-container ansi output-rendered"><span class="ansi-fg-green">PASS</span> &lt;test&gt;`)
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/processes/2025-01-07T13:00:00Z/hx-output", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "2025-01-07T13:00:00Z")
+	body, err = srv.hxHandleOutput(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<h1 id="report">Report</h1>`)
+	require.Contains(t, string(body), `id="output-raw-2025-01-07T13:00:00Z"`)
+	require.Contains(t, string(body), `<div class="output-container output-raw"># Report`)
+
+	jsonDir := writeTestProcessDir(t, ws.Path, "2025-01-07T14:00:00Z", true)
+	stdout = outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("{\"kind\": \"Pod\"}\n")})
+	require.NoError(t, os.WriteFile(filepath.Join(jsonDir, "output.log"), stdout, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(jsonDir, "output-type"), []byte("json,output starts with a JSON object or array"), 0o600))
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/processes/2025-01-07T14:00:00Z/hx-output", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "2025-01-07T14:00:00Z")
+	body, err = srv.hxHandleOutput(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<div class="output-container json-tree output-rendered"><div class="json-document"><details open>`)
+	require.Contains(t, string(body), `<span class="json-key">&#34;kind&#34;</span>: <span class="json-string">&#34;Pod&#34;</span>`)
+}
+
+// writeTestProcessDir creates a process directory without spawning a real process.
+func writeTestProcessDir(t *testing.T, workspacePath, processID string, completed bool) string {
+	t.Helper()
+	processDir := filepath.Join(workspacePath, "processes", processID)
+	require.NoError(t, os.MkdirAll(processDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "cmd"), []byte("echo"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "starttime"), []byte(time.Now().UTC().Format(time.RFC3339Nano)), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "completed"), []byte(strconv.FormatBool(completed)), 0o600))
+	return processDir
+}
+
+func TestHxHandleDeleteProcess(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "delete-ws", stateDir, "")
+	require.NoError(t, err)
+	finishedDir := writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	runningDir := writeTestProcessDir(t, ws.Path, "2025-01-07T11:00:00Z", false)
+
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/2025-01-07T10:00:00Z/hx-delete", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "2025-01-07T10:00:00Z")
+	body, err := srv.hxHandleDeleteProcess(context.Background(), req)
+	require.NoError(t, err)
+	require.Empty(t, body)
+	require.NoDirExists(t, finishedDir)
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/2025-01-07T11:00:00Z/hx-delete", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "2025-01-07T11:00:00Z")
+	_, err = srv.hxHandleDeleteProcess(context.Background(), req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+	require.DirExists(t, runningDir)
+}
+
+func TestHxHandleDeleteFinishedProcesses(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "bulk-delete-ws", stateDir, "")
+	require.NoError(t, err)
+	finishedDir := writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-delete-finished-processes", strings.NewReader("days=0")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.hxHandleDeleteFinishedProcesses(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "No finished processes yet")
+	require.NoDirExists(t, finishedDir)
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-delete-finished-processes", strings.NewReader("days=-1")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.hxHandleDeleteFinishedProcesses(context.Background(), req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+}
+
+func TestHandleDownloadOutputStream(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "download-ws", stateDir, "")
+	require.NoError(t, err)
+
+	processID := "2025-01-07T12:34:56.789Z"
+	processDir := writeTestProcessDir(t, ws.Path, processID, true)
+	stdout := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("\x89PNG\r\n\x1a\n")})
+	stderr := outputlog.FormatChunk(outputlog.Chunk{Stream: "stderr", Timestamp: time.Now(), Line: []byte("warning\n")})
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), append(stdout, stderr...), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "content-type"), []byte("image/png"), 0o600))
+
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/processes/"+processID+"/download?stream=stderr", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.handleDownloadOutput(context.Background(), req)
+	var download *downloadError
+	require.ErrorAs(t, err, &download)
+	require.Equal(t, "warning\n", string(download.data))
+	require.Equal(t, "text/plain; charset=utf-8", download.contentType)
+	// The extension of text/plain depends on the mime.types of the system
+	require.True(t, strings.HasPrefix(download.filename, processID+"-stderr."), download.filename)
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/processes/"+processID+"/download", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.handleDownloadOutput(context.Background(), req)
+	require.ErrorAs(t, err, &download)
+	require.Equal(t, "\x89PNG\r\n\x1a\n", string(download.data))
+	require.Equal(t, "image/png", download.contentType)
+	require.Equal(t, processID+".png", download.filename)
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/processes/"+processID+"/download?stream=a%20b", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.handleDownloadOutput(context.Background(), req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+}
+
+func TestHandleDownloadCast(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "cast-ws", stateDir, "")
+	require.NoError(t, err)
+
+	processID := "2025-01-07T12:34:56.789Z"
+	processDir := writeTestProcessDir(t, ws.Path, processID, true)
+
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/processes/"+processID+"/download-cast", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.handleDownloadCast(context.Background(), req)
+	var httpErr httperror.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+
+	start := time.Date(2025, 1, 7, 12, 34, 56, 0, time.UTC)
+	recording := append(
+		outputlog.FormatChunk(outputlog.Chunk{Stream: terminal.StreamResize, Timestamp: start, Line: []byte("80x24")}),
+		outputlog.FormatChunk(outputlog.Chunk{Stream: terminal.StreamOutput, Timestamp: start.Add(time.Second), Line: []byte("$ ")})...)
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), recording, 0o600))
+	proc, err := process.LoadProcessFromDir(processDir)
+	require.NoError(t, err)
+	require.NoError(t, process.SaveTags(proc, []string{terminal.SessionTag}))
+
+	_, err = srv.handleDownloadCast(context.Background(), req)
+	var download *downloadError
+	require.ErrorAs(t, err, &download)
+	require.Equal(t, "application/x-asciicast", download.contentType)
+	require.Equal(t, processID+".cast", download.filename)
+	require.Contains(t, string(download.data), `"width":80,"height":24`)
+	require.Contains(t, string(download.data), `[1,"o","$ "]`)
+}
+
+func TestHxHandleFollow(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "follow-ws", stateDir, "")
+	require.NoError(t, err)
+
+	processID := "2025-01-07T12:34:56.789Z"
+	processDir := writeTestProcessDir(t, ws.Path, processID, false)
+	first := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("first\n")})
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), first, 0o600))
+
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/processes/"+processID+"/hx-follow?offset=0&start=true", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	body, err := srv.hxHandleFollow(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<div id="follow-output" class="output-container"><span class="output-chunk stdout">first`)
+	require.Contains(t, string(body), fmt.Sprintf("hx-follow?offset=%d", len(first)))
+	require.NotContains(t, string(body), "hx-swap-oob")
+
+	// The process completes, the next poll gets the rest of the output and the banner
+	second := outputlog.FormatChunk(outputlog.Chunk{Stream: "stderr", Timestamp: time.Now(), Line: []byte("second\n")})
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), append(first, second...), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "exit-status"), []byte("3"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "completed"), []byte("true"), 0o600))
+
+	req = withUser(httptest.NewRequest("GET", fmt.Sprintf("/workspaces/%s/processes/%s/hx-follow?offset=%d", ws.ID, processID, len(first)), nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	body, err = srv.hxHandleFollow(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<span class="output-chunk stderr">second`)
+	require.NotContains(t, string(body), "first")
+	require.Contains(t, string(body), "Process finished with exit code 3")
+	require.Contains(t, string(body), `id="process-status" class="card-subtitle mb-2" hx-swap-oob="true"`)
+	require.NotContains(t, string(body), "every 1s")
+}
+
+func TestHandleDoctor(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("GET", "/doctor", nil), auth.AdminUser)
+	body, err := srv.handleDoctor(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Orphaned process directories")
+	require.Contains(t, string(body), "Asset htmx.min.js")
+}
+
+func TestHxHandleCommandHistory(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "history-ws", stateDir, "")
+	require.NoError(t, err)
+	require.NoError(t, workspace.AppendHistory(ws, "git status"))
+	require.NoError(t, workspace.AppendHistory(ws, "ls -la"))
+	require.NoError(t, workspace.AppendHistory(ws, "git checkout <main>"))
+	fake := &executor.Fake{Results: map[string]executor.FakeResult{"git status": {Duration: 3 * time.Minute}}}
+	_, err = fake.Execute(ws, "git status", "", process.Limits{})
+	require.NoError(t, err)
+
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/hx-command-history?command=gt", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.hxHandleCommandHistory(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, `<div class="autocomplete-item" data-index="0" data-command="git checkout &lt;main&gt;">git checkout &lt;main&gt;</div>
+<div class="autocomplete-item" data-index="1" data-command="git status">git status
+<div class="autocomplete-stats">1 run &middot; 100% succeeded &middot; p50 3m &middot; p95 3m</div></div>
+`, string(body))
+}
+
+func TestFirstRunWizard(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, auth.InitAuth(stateDir))
+	require.NoError(t, executor.InitExecutor(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Without password and workspace, the index page leads to the wizard
+	_, err = srv.handleIndex(ctx, httptest.NewRequest("GET", "/", nil))
+	var redirect *redirectError
+	require.ErrorAs(t, err, &redirect)
+	require.Equal(t, "/setup", redirect.url)
+
+	body, err := srv.handleSetup(ctx, httptest.NewRequest("GET", "/setup", nil))
+	require.NoError(t, err)
+	require.Contains(t, string(body), `action="/setup"`)
+	require.Contains(t, string(body), "<code>mobileshell add-password</code>")
+
+	password := strings.Repeat("p", auth.MinPasswordLength)
+	req := httptest.NewRequest("POST", "/setup", strings.NewReader("password="+password+"&password_confirm=other"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err = srv.handleSetup(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "The passwords do not match")
+
+	req = httptest.NewRequest("POST", "/setup", strings.NewReader("password="+password+"&password_confirm="+password))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = srv.handleSetup(ctx, req)
+	var login *cookieRedirectError
+	require.ErrorAs(t, err, &login)
+	require.Equal(t, "/setup/workspace", login.redirect)
+	valid, err := auth.ValidateSession(stateDir, login.cookie.Value)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	// The password exists now, so the wizard is closed for anonymous users
+	_, err = srv.handleSetup(ctx, httptest.NewRequest("GET", "/setup", nil))
+	require.ErrorAs(t, err, &redirect)
+	require.Equal(t, "/login", redirect.url)
+
+	req = withUser(httptest.NewRequest("POST", "/setup/workspace", strings.NewReader("name=first&directory="+url.QueryEscape(stateDir))), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = srv.handleSetupWorkspace(ctx, req)
+	require.ErrorAs(t, err, &redirect)
+	require.Equal(t, "/setup/workspaces/first/command", redirect.url)
+
+	req = withUser(httptest.NewRequest("GET", "/setup/workspaces/first/command", nil), auth.AdminUser)
+	req.SetPathValue("id", "first")
+	body, err = srv.handleSetupCommand(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Hello from MobileShell")
+}
+
+func TestHandleHelp(t *testing.T) {
+	t.Parallel()
+	srv, err := New(t.TempDir(), true)
+	require.NoError(t, err)
+
+	body, err := srv.handleHelp(context.Background(), httptest.NewRequest("GET", "/help", nil))
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<a href="#help-workspaces" class="list-group-item list-group-item-action">Workspaces</a>`)
+	require.Contains(t, string(body), `<h5 class="card-title">Executing Commands</h5>`)
+
+	_, err = renderHelp("../server")
+	require.Error(t, err)
+}
+
+func TestBasePath(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, auth.InitAuth(stateDir))
+	password := strings.Repeat("p", auth.MinPasswordLength)
+	require.NoError(t, auth.AddPassword(stateDir, password))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	require.Error(t, srv.SetBasePath("shell"))
+	require.Error(t, srv.SetBasePath("/a/../shell"))
+	require.NoError(t, srv.SetBasePath("/"))
+	require.Empty(t, srv.basePath)
+	require.NoError(t, srv.SetBasePath("/shell/"))
+	require.Equal(t, "/shell", srv.basePath)
+	handler := srv.SetupRoutes()
+
+	// The proxy passes the full path and sets no header
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/shell/login", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `href="/shell/static/static/bootstrap.min.css"`)
+
+	// The proxy strips the prefix and sets no header
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/login", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `hx-post="/shell/login"`)
+
+	// Nested proxies: the outer one strips /outer and sets the header, the inner one passes
+	// the full path
+	req := httptest.NewRequest("GET", "/shell/login", nil)
+	req.Header.Set("X-Forwarded-Prefix", "/outer")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Contains(t, rec.Body.String(), `hx-post="/outer/shell/login"`)
+
+	// The header already contains the base path
+	req = httptest.NewRequest("POST", "/shell/login", strings.NewReader("password="+password))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-Prefix", "/outer/shell/")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+	require.Equal(t, "/outer/shell/", rec.Header().Get("Location"))
+	require.Contains(t, rec.Header().Get("Set-Cookie"), "Path=/outer/shell;")
+
+	// Static files are served below the base path, too
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/shell/static/static/url-links.js", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestShareLinks(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "share-ws", stateDir, "")
+	require.NoError(t, err)
+	processID := "2025-01-07T12:34:56.789Z"
+	processDir := writeTestProcessDir(t, ws.Path, processID, true)
+	output := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("shared output\n")})
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), output, 0o600))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/"+processID+"/hx-shares", strings.NewReader("expires=999h")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.hxHandleShares(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/"+processID+"/hx-shares", strings.NewReader("expires=1h")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	body, err := srv.hxHandleShares(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "viewed 0 times")
+	shares, err := share.List(stateDir, ws.ID, processID)
+	require.NoError(t, err)
+	require.Len(t, shares, 1)
+	token, err := share.Token(stateDir, shares[0])
+	require.NoError(t, err)
+	require.Contains(t, string(body), `value="http://example.com/share/`+token+`"`)
+
+	// The link works without login and shows no actions
+	req = withUser(httptest.NewRequest("GET", "/share/"+token, nil), auth.AdminUser)
+	req.SetPathValue("token", token)
+	body, err = srv.handleShare(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "shared output")
+	require.NotContains(t, string(body), "hx-post")
+	require.NotContains(t, string(body), "/workspaces/")
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/"+processID+"/hx-revoke-share", strings.NewReader("share="+shares[0].ID)), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	body, err = srv.hxHandleRevokeShare(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "No share links.")
+
+	req = withUser(httptest.NewRequest("GET", "/share/"+token, nil), auth.AdminUser)
+	req.SetPathValue("token", token)
+	_, err = srv.handleShare(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+}
+
+func TestWorkspaceProfiles(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "profile-ws", stateDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	form := url.Values{
+		"name":                {"profile-ws"},
+		"profile_name":        {"prod", ""},
+		"profile_pre_command": {"source .env.prod", ""},
+	}
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/edit", strings.NewReader(form.Encode())), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.handleWorkspaceEdit(ctx, req)
+	var redirect *redirectError
+	require.ErrorAs(t, err, &redirect)
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/edit", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.handleWorkspaceEdit(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `name="profile_name" value="prod"`)
+	require.Contains(t, string(body), "source .env.prod</textarea>")
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID, nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err = srv.handleWorkspaceByID(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<option value="prod">Profile: prod</option>`)
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-execute", strings.NewReader("command=true&profile=unknown")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.hxHandleExecute(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+}
+
+func TestWidgets(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "widget-ws", stateDir, "")
+	require.NoError(t, err)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T11:00:00Z", false)
+	token, err := auth.AddWidgetToken(stateDir, "dashboard", "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	srv.SetWidgetOrigins([]string{"https://dashboard.example.com"})
+	handler := srv.SetupRoutes()
+
+	// Session cookies don't work, a widget token is needed
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/widgets/workspaces?token=wrong", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/widgets/workspaces?token="+token, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `<a href="http://example.com/workspaces/`+ws.ID+`">widget-ws</a>`)
+	require.NotContains(t, rec.Body.String(), "<html")
+
+	req := httptest.NewRequest("GET", "/widgets/running-processes", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "https://dashboard.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	require.Contains(t, rec.Body.String(), "/processes/2025-01-07T11:00:00Z")
+	require.NotContains(t, rec.Body.String(), "/processes/2025-01-07T10:00:00Z")
+
+	// Preflight requests carry no token
+	req = httptest.NewRequest("OPTIONS", "/widgets/sysmon", nil)
+	req.Header.Set("Origin", "https://other.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/widgets/sysmon?token="+token, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "processes, CPU")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/widgets/unknown?token="+token, nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	// The widgets of a user only show the workspaces which the user can access
+	aliceWs, err := executor.CreateWorkspace(stateDir, "alice-ws", stateDir, "")
+	require.NoError(t, err)
+	require.NoError(t, workspace.SaveOwner(aliceWs, "alice", nil))
+	bobWs, err := executor.CreateWorkspace(stateDir, "bob-ws", stateDir, "")
+	require.NoError(t, err)
+	require.NoError(t, workspace.SaveOwner(bobWs, "bob", nil))
+	writeTestProcessDir(t, bobWs.Path, "2025-01-07T12:00:00Z", false)
+	aliceToken, err := auth.AddWidgetToken(stateDir, "alice's dashboard", "alice")
+	require.NoError(t, err)
+	for _, widget := range []string{"workspaces", "running-processes"} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/widgets/"+widget+"?token="+aliceToken, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NotContains(t, rec.Body.String(), "bob-ws")
+		require.NotContains(t, rec.Body.String(), "/processes/2025-01-07T12:00:00Z")
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/widgets/workspaces?token="+aliceToken, nil))
+	require.Contains(t, rec.Body.String(), "alice-ws")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/widgets/sysmon?token="+aliceToken, nil))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// The admin sees all workspaces
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/widgets/workspaces?token="+token, nil))
+	require.Contains(t, rec.Body.String(), "bob-ws")
+}
+
+func TestPipelines(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "pipeline-ws", stateDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-execute", strings.NewReader("command=true&next_steps=echo+b&next_condition=sometimes")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.hxHandleExecute(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+
+	failedDir := writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	require.NoError(t, os.WriteFile(filepath.Join(failedDir, "exit-status"), []byte("1"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(failedDir, "pipeline-steps"), []byte(`["echo b", "echo c"]`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(failedDir, "pipeline-condition"), []byte(process.PipelineOnSuccess), 0o600))
+	failed, err := process.LoadProcessFromDir(failedDir)
+	require.NoError(t, err)
+	html, err := srv.renderFinishedProcessSnippet(failed, ws.ID, req)
+	require.NoError(t, err)
+	require.Contains(t, html, "2 more skipped")
+
+	runningDir := writeTestProcessDir(t, ws.Path, "2025-01-07T11:00:00Z", false)
+	require.NoError(t, os.WriteFile(filepath.Join(runningDir, "pipeline-previous"), []byte("2025-01-07T09:00:00Z"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(runningDir, "pipeline-steps"), []byte(`["echo b"]`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(runningDir, "pipeline-condition"), []byte(process.PipelineAlways), 0o600))
+	running, err := process.LoadProcessFromDir(runningDir)
+	require.NoError(t, err)
+	html, err = srv.renderRunningProcessSnippet(running, ws.ID, req)
+	require.NoError(t, err)
+	require.Contains(t, html, `href="/workspaces/`+ws.ID+`/processes/2025-01-07T09:00:00Z">previous step</a>`)
+	require.Contains(t, html, "&rarr; <code>echo b</code> (always)")
+}
+
+func TestWorkspaceIdentity(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "prod", stateDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	form := url.Values{"name": {"prod"}, "color": {"red"}, "icon": {"🔥"}}
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/edit", strings.NewReader(form.Encode())), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.handleWorkspaceEdit(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "invalid color")
+
+	form.Set("color", "#dc3545")
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/edit", strings.NewReader(form.Encode())), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.handleWorkspaceEdit(ctx, req)
+	var redirect *redirectError
+	require.ErrorAs(t, err, &redirect)
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID, nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err = srv.handleWorkspaceByID(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "<title>🔥 prod - MobileShell - Workspaces</title>")
+	require.Contains(t, string(body), "border-bottom: 6px solid #dc3545")
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/edit", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err = srv.handleWorkspaceEdit(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<option value="#dc3545" selected>Red</option>`)
+
+	body, err = srv.handleWorkspaces(ctx, withUser(httptest.NewRequest("GET", "/", nil), auth.AdminUser))
+	require.NoError(t, err)
+	require.Contains(t, string(body), `style="border-left: 6px solid #dc3545"`)
+}
+
+func TestProductionWorkspace(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "live", stateDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID, nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.handleWorkspaceByID(ctx, req)
+	require.NoError(t, err)
+	require.NotContains(t, string(body), "Production workspace")
+	require.NotContains(t, string(body), "hx-confirm=\"Run this command")
+
+	form := url.Values{"name": {"live"}, "environment": {"prod"}}
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/edit", strings.NewReader(form.Encode())), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.handleWorkspaceEdit(ctx, req)
+	var redirect *redirectError
+	require.ErrorAs(t, err, &redirect)
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID, nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err = srv.handleWorkspaceByID(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Production workspace")
+	require.Contains(t, string(body), `hx-confirm="Run this command in the production workspace?" hx-vals='{"confirm_production": "on"}'`)
+
+	body, err = srv.handleWorkspaces(ctx, withUser(httptest.NewRequest("GET", "/", nil), auth.AdminUser))
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<span class="badge bg-danger">prod</span>`)
+
+	writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/hx-finished-processes", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err = srv.hxHandleFinishedProcesses(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Rerun this command in the production workspace?")
+
+	// A direct post to the htmx endpoint needs the confirmation, too
+	srv.EnableDemo()
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-execute", strings.NewReader("command=ls")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.hxHandleExecute(ctx, req)
+	var he httperror.HTTPError
+	require.ErrorAs(t, err, &he)
+	require.Equal(t, http.StatusBadRequest, he.StatusCode)
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-execute", strings.NewReader("command=ls&confirm_production=on")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.hxHandleExecute(ctx, req)
+	require.NoError(t, err)
+}
+
+func TestProcessTags(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "tags-ws", stateDir, "")
+	require.NoError(t, err)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T11:00:00Z", true)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/2025-01-07T10:00:00Z/hx-tags", strings.NewReader("tags=deploy,+prod")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "2025-01-07T10:00:00Z")
+	body, err := srv.hxHandleProcessTags(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, `<span class="badge bg-info text-dark me-1">deploy</span><span class="badge bg-info text-dark me-1">prod</span>`, string(body))
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/2025-01-07T10:00:00Z/hx-tags", strings.NewReader("tags=%3Cb%3E")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "2025-01-07T10:00:00Z")
+	_, err = srv.hxHandleProcessTags(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID, nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err = srv.handleWorkspaceByID(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<option value="deploy">deploy</option>`)
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/hx-finished-processes?offset=0&tag=deploy", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err = srv.hxHandleFinishedProcesses(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "/processes/2025-01-07T10:00:00Z/")
+	require.NotContains(t, string(body), "/processes/2025-01-07T11:00:00Z/")
+}
+
+func TestWaitForProcessStart(t *testing.T) {
+	t.Parallel()
+	wsPath := t.TempDir()
+	startedDir := writeTestProcessDir(t, wsPath, "2025-01-07T10:00:00Z", false)
+	require.NoError(t, os.WriteFile(filepath.Join(startedDir, "pid"), []byte("4242"), 0o600))
+	proc, err := waitForProcessStart(context.Background(), startedDir)
+	require.NoError(t, err)
+	require.Equal(t, 4242, proc.PID)
+
+	finishedDir := writeTestProcessDir(t, wsPath, "2025-01-07T11:00:00Z", true)
+	proc, err = waitForProcessStart(context.Background(), finishedDir)
+	require.NoError(t, err)
+	require.True(t, proc.Completed)
+
+	// Without pid the state read so far gets returned once the context is done
+	pendingDir := writeTestProcessDir(t, wsPath, "2025-01-07T12:00:00Z", false)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	proc, err = waitForProcessStart(ctx, pendingDir)
+	require.NoError(t, err)
+	require.Zero(t, proc.PID)
+	require.False(t, proc.Completed)
+
+	_, err = waitForProcessStart(context.Background(), filepath.Join(wsPath, "missing"))
+	require.Error(t, err)
+}
+
+func TestAPIWaitProcess(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "wait-ws", stateDir, "")
+	require.NoError(t, err)
+	finishedDir := writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	require.NoError(t, os.WriteFile(filepath.Join(finishedDir, "exit-status"), []byte("3"), 0o600))
+	writeTestProcessDir(t, ws.Path, "2025-01-07T11:00:00Z", false)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("GET", "/api/v1/processes/2025-01-07T10:00:00Z/wait", nil), auth.AdminUser)
+	req.SetPathValue("id", "2025-01-07T10:00:00Z")
+	_, err = srv.apiHandleWaitProcess(ctx, req)
+	var response *contentTypeError
+	require.ErrorAs(t, err, &response)
+	require.Equal(t, "application/json", response.contentType)
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(response.data, &result))
+	require.Equal(t, true, result["completed"])
+	require.Equal(t, float64(3), result["exit_code"])
+
+	req = withUser(httptest.NewRequest("GET", "/api/v1/processes/2025-01-07T11:00:00Z/wait?timeout=10ms&workspace="+ws.ID, nil), auth.AdminUser)
+	req.SetPathValue("id", "2025-01-07T11:00:00Z")
+	_, err = srv.apiHandleWaitProcess(ctx, req)
+	require.ErrorAs(t, err, &response)
+	require.NoError(t, json.Unmarshal(response.data, &result))
+	require.Equal(t, false, result["completed"])
+	require.Equal(t, true, result["timed_out"])
+	require.Nil(t, result["exit_code"])
+
+	req = withUser(httptest.NewRequest("GET", "/api/v1/processes/2025-01-07T11:00:00Z/wait?timeout=forever", nil), auth.AdminUser)
+	req.SetPathValue("id", "2025-01-07T11:00:00Z")
+	_, err = srv.apiHandleWaitProcess(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+
+	req = withUser(httptest.NewRequest("GET", "/api/v1/processes/2025-01-07T10:00:00Z/wait?workspace=other", nil), auth.AdminUser)
+	req.SetPathValue("id", "2025-01-07T10:00:00Z")
+	_, err = srv.apiHandleWaitProcess(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+}
+
+func TestBuildTimeline(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 7, 0, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Hour)
+	failed := &process.Process{CommandId: "b", StartTime: start.Add(2 * time.Hour), EndTime: start.Add(4 * time.Hour), Completed: true, ExitCode: 1}
+	succeeded := &process.Process{CommandId: "a", StartTime: start.Add(time.Hour), EndTime: start.Add(time.Hour), Completed: true}
+	running := &process.Process{CommandId: "c", StartTime: start.Add(5 * time.Hour)}
+	before := &process.Process{CommandId: "d", StartTime: start.Add(-3 * time.Hour), EndTime: start.Add(-2 * time.Hour), Completed: true}
+
+	tl := buildTimeline([]*process.Process{failed, running, succeeded, before}, start, end)
+	require.Len(t, tl.Bars, 3)
+	require.Equal(t, 3*timelineRowHeight, tl.Height)
+	require.Equal(t, "a", tl.Bars[0].Process.CommandId)
+	require.Equal(t, "success", tl.Bars[0].Status)
+	require.InDelta(t, 2.0, tl.Bars[0].Width, 0.001)
+	require.Equal(t, "failure", tl.Bars[1].Status)
+	require.InDelta(t, 200.0, tl.Bars[1].X, 0.001)
+	require.InDelta(t, 200.0, tl.Bars[1].Width, 0.001)
+	require.Equal(t, timelineRowHeight, tl.Bars[1].Y)
+	require.Equal(t, "running", tl.Bars[2].Status)
+	require.InDelta(t, 500.0, tl.Bars[2].Width, 0.001)
+	require.Len(t, tl.Ticks, timelineTicks)
+	require.Equal(t, "01-07 00:00", tl.Ticks[0].Label)
+}
+
+func TestSummarizeUsage(t *testing.T) {
+	t.Parallel()
+	bars := []timelineBar{
+		{Process: &process.Process{Command: "make", Usage: &process.Usage{UserTime: time.Second, MaxRSS: 10, BlockOut: 1}}},
+		{Process: &process.Process{Command: "ls", Usage: &process.Usage{SystemTime: 10 * time.Millisecond}}},
+		{Process: &process.Process{Command: "make", Usage: &process.Usage{UserTime: 2 * time.Second, MaxRSS: 30, BlockOut: 2}}},
+		{Process: &process.Process{Command: "sleep 100"}},
+	}
+
+	summaries := summarizeUsage(bars)
+	require.Len(t, summaries, 2)
+	require.Equal(t, usageSummary{Command: "make", Runs: 2, CPU: 3 * time.Second, MaxRSS: 30, BlockOut: 3}, summaries[0])
+	require.Equal(t, "ls", summaries[1].Command)
+}
+
+func TestBuildUsageSparkline(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 7, 0, 0, 0, 0, time.UTC)
+	require.False(t, buildUsageSparkline(nil).Points())
+	require.False(t, buildUsageSparkline([]process.Sample{{Time: start, CPU: 50}}).Points())
+
+	u := buildUsageSparkline([]process.Sample{
+		{Time: start, CPU: 100, RSS: 10 << 20},
+		{Time: start.Add(10 * time.Second), CPU: 50, RSS: 40 << 20},
+		{Time: start.Add(40 * time.Second), CPU: 0, RSS: 20 << 20},
+	})
+	require.True(t, u.Points())
+	require.InDelta(t, 100.0, u.MaxCPU, 0.001)
+	require.Equal(t, int64(40<<20), u.MaxRSS)
+	require.Equal(t, int64(20<<20), u.Last.RSS)
+	require.Equal(t, "0.0,0.0 75.0,20.0 300.0,40.0", u.CPUPoints)
+	require.Equal(t, "0.0,30.0 75.0,0.0 300.0,20.0", u.RSSPoints)
+}
+
+func TestHxHandleProcessUsage(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "usage-ws", stateDir, "")
+	require.NoError(t, err)
+	processDir := writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", false)
+	start := time.Date(2025, 1, 7, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, process.AppendSample(processDir, process.Sample{Time: start, CPU: 12, RSS: 1 << 20}))
+	require.NoError(t, process.AppendSample(processDir, process.Sample{Time: start.Add(5 * time.Second), CPU: 8, RSS: 3 << 20}))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/processes/2025-01-07T10:00:00Z/hx-usage", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "2025-01-07T10:00:00Z")
+	body, err := srv.hxHandleProcessUsage(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `hx-trigger="every 10s"`)
+	require.Contains(t, string(body), "CPU: 8% (max 12%)")
+	require.Contains(t, string(body), "<polyline")
+}
+
+func TestHandleWorkspaceTimeline(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "timeline-ws", stateDir, "")
+	require.NoError(t, err)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", false)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/timeline?hours=6", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.handleWorkspaceTimeline(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<rect class="bar-running"`)
+	require.Contains(t, string(body), "/processes/2025-01-07T10:00:00Z")
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/timeline?hours=10000", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.handleWorkspaceTimeline(context.Background(), req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+}
+
+func TestOutputTypeFilter(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "type-ws", stateDir, "")
+	require.NoError(t, err)
+	markdownDir := writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	require.NoError(t, process.WriteOutputType(markdownDir, "markdown", "significant markdown formatting detected"))
+	writeTestProcessDir(t, ws.Path, "2025-01-07T11:00:00Z", true)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID, nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.handleWorkspaceByID(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<option value="markdown">markdown</option>`)
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/hx-finished-processes?offset=0&type=markdown", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err = srv.hxHandleFinishedProcesses(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "/processes/2025-01-07T10:00:00Z/")
+	require.Contains(t, string(body), "Output type: markdown")
+	require.NotContains(t, string(body), "/processes/2025-01-07T11:00:00Z/")
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/processes/2025-01-07T10:00:00Z", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "2025-01-07T10:00:00Z")
+	body, err = srv.handleProcessByID(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "(significant markdown formatting detected)")
+}
+
+func TestHxHandleStorage(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "storage-ws", stateDir, "")
+	require.NoError(t, err)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T11:00:00Z", false)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/hx-storage", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.hxHandleStorage(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `"process": "2025-01-07T10:00:00Z"`)
+	require.NotContains(t, string(body), "Apply retention policy now")
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-storage", strings.NewReader("action=delete&process=2025-01-07T10:00:00Z")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	body, err = srv.hxHandleStorage(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Process deleted")
+	require.NotContains(t, string(body), "2025-01-07T10:00:00Z")
+	require.Contains(t, string(body), "2025-01-07T11:00:00Z")
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-storage", strings.NewReader("action=retention")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.hxHandleStorage(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+}
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "512 B", formatBytes(512))
+	require.Equal(t, "1.5 KiB", formatBytes(1536))
+	require.Equal(t, "3.0 GiB", formatBytes(3<<30))
+}
+
+func TestHandlePermalink(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "permalink-ws", stateDir, "")
+	require.NoError(t, err)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	permalink := process.PermalinkFor("2025-01-07T10:00:00Z", "echo")
+	req := withUser(httptest.NewRequest("GET", "/p/"+permalink, nil), auth.AdminUser)
+	req.SetPathValue("permalink", permalink)
+	_, err = srv.handlePermalink(ctx, req)
+	var redirect *redirectError
+	require.ErrorAs(t, err, &redirect)
+	require.Equal(t, "/workspaces/"+ws.ID+"/processes/2025-01-07T10:00:00Z", redirect.url)
+
+	req = withUser(httptest.NewRequest("GET", "/p/0000000000000000", nil), auth.AdminUser)
+	req.SetPathValue("permalink", "0000000000000000")
+	_, err = srv.handlePermalink(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+
+	// Links with the ID of a deleted workspace get redirected to the workspace of the process
+	req = withUser(httptest.NewRequest("GET", "/workspaces/old-ws/processes/2025-01-07T10:00:00Z", nil), auth.AdminUser)
+	req.SetPathValue("id", "old-ws")
+	req.SetPathValue("processID", "2025-01-07T10:00:00Z")
+	_, err = srv.handleProcessByID(ctx, req)
+	require.ErrorAs(t, err, &redirect)
+	require.Equal(t, "/workspaces/"+ws.ID+"/processes/2025-01-07T10:00:00Z", redirect.url)
+	require.Equal(t, http.StatusMovedPermanently, redirect.statusCode)
+}
+
+func TestHxHandlePreferences(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "preferences-ws", stateDir, "")
+	require.NoError(t, err)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("POST", "/hx-preferences", strings.NewReader("font-size=18&theme=dark")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err := srv.hxHandlePreferences(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<style id="output-preferences-style" hx-swap-oob="true">`)
+	require.Contains(t, string(body), "font-size: 18px;")
+	require.Contains(t, string(body), "white-space: pre;")
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/processes/2025-01-07T10:00:00Z", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "2025-01-07T10:00:00Z")
+	body, err = srv.handleProcessByID(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "background: #1e1e1e;")
+	require.Contains(t, string(body), `<option value="18" selected>18px</option>`)
+	require.NotContains(t, string(body), `id="preference-wrap" name="wrap" value="true" checked`)
+
+	req = withUser(httptest.NewRequest("POST", "/hx-preferences", strings.NewReader("wrap=true&font-size=18&theme=pink")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = srv.hxHandlePreferences(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+}
+
+func TestClipboard(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("POST", "/hx-clipboard", strings.NewReader("text=make+%3Cdeploy%3E")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err := srv.hxHandleClipboard(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Copied to the")
+
+	req = withUser(httptest.NewRequest("POST", "/hx-clipboard", strings.NewReader("text=")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = srv.hxHandleClipboard(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+
+	req = withUser(httptest.NewRequest("GET", "/api/v1/clipboard", nil), auth.AdminUser)
+	_, err = srv.apiHandleClipboard(ctx, req)
+	var response *contentTypeError
+	require.ErrorAs(t, err, &response)
+	var snippets []map[string]any
+	require.NoError(t, json.Unmarshal(response.data, &snippets))
+	require.Len(t, snippets, 1)
+	require.Equal(t, "make <deploy>", snippets[0]["text"])
+
+	req = withUser(httptest.NewRequest("GET", "/clipboard", nil), auth.AdminUser)
+	body, err = srv.handleClipboard(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "make &lt;deploy&gt;</textarea>")
+}
+
+func TestHandleSettings(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("GET", "/settings", nil), auth.AdminUser)
+	body, err := srv.handleSettings(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `value="24h0m0s"`)
+
+	req = withUser(httptest.NewRequest("POST", "/settings", strings.NewReader("duration=8h&extend_within=1h&max_lifetime=9h")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = srv.handleSettings(ctx, req)
+	var redirect *redirectError
+	require.ErrorAs(t, err, &redirect)
+	require.Equal(t, auth.SessionConfig{Duration: 8 * time.Hour, ExtendWithin: time.Hour, MaxLifetime: 9 * time.Hour}, auth.LoadSessionConfig(stateDir))
+	require.Equal(t, 8*3600, srv.sessionMaxAge())
+
+	req = withUser(httptest.NewRequest("POST", "/settings", strings.NewReader("duration=8h&extend_within=1h&max_lifetime=1h")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err = srv.handleSettings(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "maximum lifetime must be between")
+	require.Equal(t, 9*time.Hour, auth.LoadSessionConfig(stateDir).MaxLifetime)
+
+	req = withUser(httptest.NewRequest("POST", "/settings", strings.NewReader("section=terminal&idle_timeout=30m&terminal_max_lifetime=0")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = srv.handleSettings(ctx, req)
+	require.ErrorAs(t, err, &redirect)
+	require.Equal(t, terminal.Policy{IdleTimeout: 30 * time.Minute}, terminal.LoadPolicy(stateDir))
+
+	req = withUser(httptest.NewRequest("POST", "/settings", strings.NewReader("section=terminal&idle_timeout=1s&terminal_max_lifetime=0")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err = srv.handleSettings(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "idle timeout must be at least")
+
+	req = withUser(httptest.NewRequest("POST", "/settings", strings.NewReader("section=notify&on_failure=on&min_duration=10m&ntfy_url=https://ntfy.sh/builds&ntfy_token=tk_secret")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = srv.handleSettings(ctx, req)
+	require.ErrorAs(t, err, &redirect)
+	require.Equal(t, notify.Config{OnFailure: true, MinDuration: 10 * time.Minute, NtfyURL: "https://ntfy.sh/builds", NtfyToken: "tk_secret"}, notify.LoadConfig(stateDir))
+
+	// The token is not shown, an empty field keeps it
+	req = withUser(httptest.NewRequest("POST", "/settings", strings.NewReader("section=notify&ntfy_url=https://ntfy.sh/other")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = srv.handleSettings(ctx, req)
+	require.ErrorAs(t, err, &redirect)
+	require.Equal(t, notify.Config{NtfyURL: "https://ntfy.sh/other", NtfyToken: "tk_secret"}, notify.LoadConfig(stateDir))
+	body, err = srv.handleSettings(ctx, withUser(httptest.NewRequest("GET", "/settings", nil), auth.AdminUser))
+	require.NoError(t, err)
+	require.NotContains(t, string(body), "tk_secret")
+
+	req = withUser(httptest.NewRequest("POST", "/settings", strings.NewReader("section=notify&webhook_url=ftp://example.com")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err = srv.handleSettings(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "webhook URL must be an http or https URL")
+
+	// Rules route by class and command, the page shows them for the config file, too
+	form := url.Values{"section": {"notify"}, "ntfy_url": {"https://ntfy.sh/other"}, "rules": {"failure ntfy ^make\r\nany none"}}
+	req = withUser(httptest.NewRequest("POST", "/settings", strings.NewReader(form.Encode())), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = srv.handleSettings(ctx, req)
+	require.ErrorAs(t, err, &redirect)
+	require.Equal(t, []notify.Rule{
+		{Class: notify.ClassFailure, Command: "^make", Backends: []string{"ntfy"}},
+		{Class: "any", Backends: []string{"none"}},
+	}, notify.LoadConfig(stateDir).Rules)
+	body, err = srv.handleSettings(ctx, withUser(httptest.NewRequest("GET", "/settings", nil), auth.AdminUser))
+	require.NoError(t, err)
+	require.Contains(t, string(body), "failure ntfy ^make\nany none</textarea>")
+	require.Contains(t, string(body), "- class: failure")
+
+	form.Set("rules", "crashed ntfy")
+	req = withUser(httptest.NewRequest("POST", "/settings", strings.NewReader(form.Encode())), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err = srv.handleSettings(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "rule 1: invalid class &#34;crashed&#34;")
+}
+
+func TestJSONHandlePushSubscription(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = srv.jsonHandlePushKey(ctx, withUser(httptest.NewRequest("GET", "/push/json-key", nil), auth.AdminUser))
+	var response *contentTypeError
+	require.ErrorAs(t, err, &response)
+	keys, err := webpush.LoadKeys(stateDir)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"public_key":"`+keys.PublicKey()+`"}`, string(response.data))
+
+	browserKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	subscription := `{"endpoint":"https://push.example.com/abc","expirationTime":null,"keys":{"p256dh":"` +
+		base64.RawURLEncoding.EncodeToString(browserKey.PublicKey().Bytes()) + `","auth":"MDEyMzQ1Njc4OWFiY2RlZg"}}`
+	req := withUser(httptest.NewRequest("POST", "/push/json-subscription", strings.NewReader(subscription)), auth.AdminUser)
+	req.Header.Set("User-Agent", "Firefox")
+	_, err = srv.jsonHandlePushSubscription(ctx, req)
+	require.ErrorAs(t, err, &response)
+	subs, err := webpush.List(stateDir)
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+	require.Equal(t, "Firefox", subs[0].UserAgent)
+
+	body, err := srv.handleSettings(ctx, withUser(httptest.NewRequest("GET", "/settings", nil), auth.AdminUser))
+	require.NoError(t, err)
+	require.Contains(t, string(body), `name="id" value="`+subs[0].ID+`"`)
+
+	_, err = srv.jsonHandlePushSubscription(ctx, withUser(httptest.NewRequest("POST", "/push/json-subscription", strings.NewReader(`{"endpoint":"http://push.example.com"}`)), auth.AdminUser))
+	var httpErr httperror.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusBadRequest, httpErr.StatusCode)
+
+	_, err = srv.jsonHandlePushSubscription(ctx, withUser(httptest.NewRequest("DELETE", "/push/json-subscription", strings.NewReader(subscription)), auth.AdminUser))
+	require.ErrorAs(t, err, &response)
+	subs, err = webpush.List(stateDir)
+	require.NoError(t, err)
+	require.Empty(t, subs)
+}
+
+func TestHxHandleWebhooks(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "hooks", stateDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-webhooks",
+		strings.NewReader("action=add&url=https://example.com/hook&secret=s3cret&events=started&events=failed")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.hxHandleWebhooks(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "<code>https://example.com/hook</code>")
+	require.Contains(t, string(body), "Events: started, failed.")
+	hooks, err := webhook.List(ws)
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-webhooks", strings.NewReader("action=add&url=ftp://example.com&events=failed")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	body, err = srv.hxHandleWebhooks(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "webhook URL must be an http or https URL")
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-webhooks", strings.NewReader("action=delete&webhook="+hooks[0].ID)), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	body, err = srv.hxHandleWebhooks(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "No webhooks.")
+}
+
+func TestHandleExport(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "export-ws", stateDir, "")
+	require.NoError(t, err)
+	require.NoError(t, workspace.AppendHistory(ws, "make deploy"))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("GET", "/export?kind=history&format=csv&from=2020-01-01", nil), auth.AdminUser)
+	_, err = srv.handleExport(ctx, req)
+	var download *downloadError
+	require.ErrorAs(t, err, &download)
+	require.Equal(t, "text/csv", download.contentType)
+	require.Contains(t, string(download.data), ",export-ws,make deploy,")
+	require.NoError(t, export.Verify(stateDir, download.data))
+
+	req = withUser(httptest.NewRequest("GET", "/export?kind=history&format=csv&from=2020-13-01", nil), auth.AdminUser)
+	_, err = srv.handleExport(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+	require.Contains(t, err.Error(), "invalid date")
+}
+
+func TestWorkspaceExportImport(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "backup-ws", t.TempDir(), "")
+	require.NoError(t, err)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/export", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.handleWorkspaceExport(ctx, req)
+	var download *downloadError
+	require.ErrorAs(t, err, &download)
+	require.Equal(t, "application/gzip", download.contentType)
+	require.True(t, strings.HasPrefix(download.filename, "mobileshell-workspace-backup-ws-"))
+
+	// importRequest uploads the export with the form fields in front of the file
+	importRequest := func(fields map[string]string) *http.Request {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for name, value := range fields {
+			require.NoError(t, mw.WriteField(name, value))
+		}
+		part, err := mw.CreateFormFile("file", download.filename)
+		require.NoError(t, err)
+		_, err = part.Write(download.data)
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+		req := httptest.NewRequest("POST", "/workspaces/import", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return req
+	}
+
+	_, err = srv.handleWorkspaceImport(ctx, importRequest(nil))
+	var redirect *redirectError
+	require.ErrorAs(t, err, &redirect)
+	require.Regexp(t, `^/workspaces/backup-ws-[a-z2-7]{5}$`, redirect.url)
+	imported, err := workspace.GetWorkspaceByID(stateDir, strings.TrimPrefix(redirect.url, "/workspaces/"))
+	require.NoError(t, err)
+	require.Equal(t, ws.Directory, imported.Directory)
+	require.DirExists(t, filepath.Join(imported.Path, "processes", "2025-01-07T10:00:00Z"))
+
+	_, err = srv.handleWorkspaceImport(ctx, importRequest(map[string]string{"id": "backup-ws"}))
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+	require.Contains(t, err.Error(), "already exists")
+}
+
+func TestProcessLimits(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "limits-ws", stateDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-execute", strings.NewReader("command=true&timeout=soon")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.hxHandleExecute(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+
+	processDir := writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	require.NoError(t, process.WriteLimits(processDir, process.Limits{Timeout: time.Minute}))
+	require.NoError(t, process.WriteTimedOut(processDir))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "signal"), []byte("terminated"), 0o600))
+	proc, err := process.LoadProcessFromDir(processDir)
+	require.NoError(t, err)
+	html, err := srv.renderFinishedProcessSnippet(proc, ws.ID, req)
+	require.NoError(t, err)
+	require.Contains(t, html, "Timed out after 1m0s")
+	require.NotContains(t, html, "terminated by signal")
+}
+
+func TestDemoMode(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "demo-ws", stateDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	srv.EnableDemo()
+
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-execute", strings.NewReader("command=touch+executed")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.hxHandleExecute(context.Background(), req)
+	require.NoError(t, err)
+
+	// The fake process completed at once, without running the command
+	processes, err := workspace.ListProcesses(ws)
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+	require.True(t, processes[0].Completed)
+	require.NoFileExists(t, filepath.Join(stateDir, "executed"))
+}
+
+func TestQueuedProcess(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "queue-ws", stateDir, "")
+	require.NoError(t, err)
+	require.NoError(t, workspace.SaveMaxConcurrent(ws, 1))
+	_, err = executor.CreateProcess(ws, "bash")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/hx-execute", strings.NewReader("command=make")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.hxHandleExecute(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Queued")
+	require.NotContains(t, string(body), "hx-send-signal")
+
+	processes, err := workspace.ListProcesses(ws)
+	require.NoError(t, err)
+	require.Len(t, processes, 2)
+	queued := processes[1]
+	require.True(t, queued.Queued)
+
+	// Marking a queued process as finished cancels it
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/"+queued.CommandId+"/hx-mark-finished", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", queued.CommandId)
+	body, err = srv.hxHandleMarkFinished(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Cancelled before it started")
+}
+
+func TestHxHandleMarkFinished(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "mark-ws", stateDir, "")
+	require.NoError(t, err)
+	processDir := writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", false)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/2025-01-07T10:00:00Z/hx-mark-finished", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "2025-01-07T10:00:00Z")
+	body, err := srv.hxHandleMarkFinished(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Orphaned - exit status unknown")
+	proc, err := process.LoadProcessFromDir(processDir)
+	require.NoError(t, err)
+	require.True(t, proc.Completed)
+
+	_, err = srv.hxHandleMarkFinished(context.Background(), req)
+	require.Equal(t, httperror.HTTPError{StatusCode: http.StatusConflict, Message: "Process already finished"}, err)
+}
+
+func TestCleanupStaleProcessesMarksOrphans(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "orphan-ws", stateDir, "")
+	require.NoError(t, err)
+	processDir := writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", false)
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "pid"), []byte("999999999"), 0o600))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	srv.cleanupStaleProcesses()
+	proc, err := process.LoadProcessFromDir(processDir)
+	require.NoError(t, err)
+	require.True(t, proc.Completed)
+	require.True(t, proc.Orphaned)
+	require.Empty(t, proc.Signal)
+}
+
+func TestWithoutJavaScript(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "nojs-ws", stateDir, "")
+	require.NoError(t, err)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	srv.EnableDemo()
+	ctx := context.Background()
+
+	// The finished processes are part of the workspace page
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID, nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.handleWorkspaceByID(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "/workspaces/"+ws.ID+"/processes/2025-01-07T10:00:00Z")
+	require.Contains(t, string(body), `action="/workspaces/`+ws.ID+`/execute"`)
+
+	// A plain form post redirects to the process page
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/execute", strings.NewReader("command=ls")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.handleExecute(ctx, req)
+	var redirect *redirectError
+	require.ErrorAs(t, err, &redirect)
+	require.Equal(t, http.StatusSeeOther, redirect.statusCode)
+	require.Contains(t, redirect.url, "/workspaces/"+ws.ID+"/processes/")
+
+	// Production workspaces need the confirmation checkbox
+	require.NoError(t, workspace.SaveEnvironment(ws, workspace.EnvironmentProd))
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/execute", strings.NewReader("command=ls")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.handleExecute(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/execute", strings.NewReader("command=ls&confirm_production=on")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.handleExecute(ctx, req)
+	require.ErrorAs(t, err, &redirect)
+}
+
+func TestReplication(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "primary-ws", stateDir, "")
+	require.NoError(t, err)
+	processDir := writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", false)
+	first := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("first\n")})
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), first, 0o600))
+	token, err := auth.AddReplicationToken(stateDir, "standby")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	primary := httptest.NewServer(srv.SetupRoutes())
+	t.Cleanup(primary.Close)
+
+	standbyDir := t.TempDir()
+	client := &replication.Client{URL: primary.URL, Token: token, StateDir: standbyDir}
+	stats, err := client.Sync(context.Background())
+	require.NoError(t, err)
+	require.Positive(t, stats.Files)
+	replicatedDir := filepath.Join(standbyDir, "workspaces", ws.ID, "processes", "2025-01-07T10:00:00Z")
+	require.FileExists(t, filepath.Join(replicatedDir, "cmd"))
+
+	second := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("second\n")})
+	f, err := os.OpenFile(filepath.Join(processDir, "output.log"), os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.Write(second)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = client.Sync(context.Background())
+	require.NoError(t, err)
+	stdout, err := outputlog.ReadOneStream(filepath.Join(replicatedDir, "output.log"), outputlog.StreamStdout)
+	require.NoError(t, err)
+	require.Equal(t, "first\nsecond\n", string(stdout))
+
+	// The retention policy truncates the log from the front between two syncs. The truncated
+	// log is still longer than the copy of the standby, which must not append to its copy.
+	logFile := filepath.Join(processDir, "output.log")
+	var lines []byte
+	for i := range 500 {
+		lines = append(lines, outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: time.Now(), Line: fmt.Appendf(nil, "line %d\n", i)})...)
+	}
+	require.NoError(t, os.WriteFile(logFile, lines, 0o600))
+	_, err = client.Sync(context.Background())
+	require.NoError(t, err)
+	f, err = os.OpenFile(logFile, os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.Write(lines)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	removed, err := outputlog.TruncateFront(logFile, int64(len(lines))*3/2)
+	require.NoError(t, err)
+	require.Positive(t, removed)
+	_, err = client.Sync(context.Background())
+	require.NoError(t, err)
+	want, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	got, err := os.ReadFile(filepath.Join(replicatedDir, "output.log"))
+	require.NoError(t, err)
+	require.Equal(t, string(want), string(got))
+
+	client.Token = "invalid"
+	_, err = client.Sync(context.Background())
+	require.ErrorContains(t, err, "401")
+}
+
+func TestOutputRanges(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "range-ws", stateDir, "")
+	require.NoError(t, err)
+	processID := "2025-01-07T14:00:00Z"
+	processDir := writeTestProcessDir(t, ws.Path, processID, true)
+	start := time.Date(2025, 1, 7, 14, 30, 0, 0, time.UTC)
+	first := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: start, Line: []byte("one\ntwo\n")})
+	second := outputlog.FormatChunk(outputlog.Chunk{Stream: "stdout", Timestamp: start.Add(5 * time.Minute), Line: []byte("three\n")})
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "output.log"), append(first, second...), 0o600))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+	url := "/workspaces/" + ws.ID + "/processes/" + processID
+
+	req := withUser(httptest.NewRequest("GET", url+"/json-output-range?first=2&last=3", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.jsonHandleOutputRange(ctx, req)
+	var response *contentTypeError
+	require.ErrorAs(t, err, &response)
+	require.JSONEq(t, `{"stream":"stdout","lines":[{"number":2,"text":"two"},{"number":3,"text":"three"}],"total":3}`, string(response.data))
+
+	req = withUser(httptest.NewRequest("GET", url+"/json-output-range?from=2025-01-07T14:32&to=2025-01-07T15:00", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.jsonHandleOutputRange(ctx, req)
+	require.ErrorAs(t, err, &response)
+	require.Contains(t, string(response.data), `"text":"three\n"`)
+	require.NotContains(t, string(response.data), "one")
+
+	req = withUser(httptest.NewRequest("GET", url+"/json-output-range?first=1&last=100000", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.jsonHandleOutputRange(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+
+	req = withUser(httptest.NewRequest("GET", url+"/hx-output-page", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	body, err := srv.hxHandleOutputPage(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "page 1 of 1")
+	require.Contains(t, string(body), "three")
+	require.NotContains(t, string(body), "Next")
+
+	req = withUser(httptest.NewRequest("GET", url+"/hx-output-page?page=2", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.hxHandleOutputPage(ctx, req)
+	require.ErrorAs(t, err, &httperror.HTTPError{})
+}
+
+func TestHandleTerminals(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("GET", "/terminals", nil), auth.AdminUser)
+	body, err := srv.handleTerminals(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "No terminal session is active.")
+	require.NotContains(t, string(body), "Before the Restart")
+
+	// The sessions of the last shutdown
+	ws, err := executor.CreateWorkspace(stateDir, "term-ws", t.TempDir(), "")
+	require.NoError(t, err)
+	saved := fmt.Sprintf(`{"time":"2025-01-07T12:00:00Z","sessions":[{"WorkspaceID":%q,"Command":"tmux new -A -s mobileshell-%s","Multiplexer":"tmux"},{"WorkspaceID":"gone","Command":"bash"}]}`, ws.ID, ws.ID)
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "terminal-sessions.json"), []byte(saved), 0o600))
+	req = withUser(httptest.NewRequest("GET", "/terminals", nil), auth.AdminUser)
+	body, err = srv.handleTerminals(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Before the Restart")
+	require.Contains(t, string(body), "2025-01-07 12:00:00 UTC")
+	require.Contains(t, string(body), "/workspaces/"+ws.ID+"/terminal-execute")
+	require.NotContains(t, string(body), "/workspaces/gone/")
+
+	req = withUser(httptest.NewRequest("POST", "/terminals", strings.NewReader("session=1")), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = srv.handleTerminals(ctx, req)
+	var httpErr httperror.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+}
+
+func TestStartShutdown(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Start(ctx, "localhost:0") }()
+	cancel()
+	require.NoError(t, <-errc)
+	require.FileExists(t, filepath.Join(stateDir, "terminal-sessions.json"))
+}
+
+func TestAPIUpload(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	wsDir := t.TempDir()
+	ws, err := executor.CreateWorkspace(stateDir, "upload-ws", wsDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+	content := "0123456789"
+	sum := sha256.Sum256([]byte(content))
+
+	form := url.Values{"path": {"artifact.bin"}, "size": {"10"}, "sha256": {hex.EncodeToString(sum[:])}}
+	req := withUser(httptest.NewRequest("POST", "/api/v1/workspaces/"+ws.ID+"/uploads", strings.NewReader(form.Encode())), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.apiHandleCreateUpload(ctx, req)
+	var response *contentTypeError
+	require.ErrorAs(t, err, &response)
+	var created upload.Upload
+	require.NoError(t, json.Unmarshal(response.data, &created))
+
+	req = withUser(httptest.NewRequest("PUT", "/api/v1/uploads/"+created.ID, strings.NewReader(content[:4])), auth.AdminUser)
+	req.Header.Set("Content-Range", "bytes 0-3/10")
+	req.SetPathValue("uploadID", created.ID)
+	_, err = srv.apiHandleUpload(ctx, req)
+	require.ErrorAs(t, err, &response)
+
+	// A chunk which was sent already gets rejected, GET returns where to resume
+	req = withUser(httptest.NewRequest("PUT", "/api/v1/uploads/"+created.ID, strings.NewReader(content[:4])), auth.AdminUser)
+	req.Header.Set("Content-Range", "bytes 0-3/10")
+	req.SetPathValue("uploadID", created.ID)
+	_, err = srv.apiHandleUpload(ctx, req)
+	var httpErr httperror.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusConflict, httpErr.StatusCode)
+
+	req = withUser(httptest.NewRequest("GET", "/api/v1/uploads/"+created.ID, nil), auth.AdminUser)
+	req.SetPathValue("uploadID", created.ID)
+	_, err = srv.apiHandleUpload(ctx, req)
+	require.ErrorAs(t, err, &response)
+	var resumed upload.Upload
+	require.NoError(t, json.Unmarshal(response.data, &resumed))
+	require.Equal(t, int64(4), resumed.Offset)
+
+	req = withUser(httptest.NewRequest("PUT", "/api/v1/uploads/"+created.ID, strings.NewReader(content[4:])), auth.AdminUser)
+	req.Header.Set("Content-Range", "bytes 4-9/10")
+	req.SetPathValue("uploadID", created.ID)
+	_, err = srv.apiHandleUpload(ctx, req)
+	require.ErrorAs(t, err, &response)
+	var completed upload.Upload
+	require.NoError(t, json.Unmarshal(response.data, &completed))
+	require.True(t, completed.Complete)
+	data, err := os.ReadFile(filepath.Join(wsDir, "artifact.bin"))
+	require.NoError(t, err)
+	require.Equal(t, content, string(data))
+
+	req = withUser(httptest.NewRequest("GET", "/api/v1/uploads/"+created.ID, nil), auth.AdminUser)
+	req.SetPathValue("uploadID", created.ID)
+	_, err = srv.apiHandleUpload(ctx, req)
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+
+	// An empty file is complete without a chunk, and gets audited, too
+	empty := sha256.Sum256(nil)
+	form = url.Values{"path": {"empty.txt"}, "size": {"0"}, "sha256": {hex.EncodeToString(empty[:])}}
+	req = withUser(httptest.NewRequest("POST", "/api/v1/workspaces/"+ws.ID+"/uploads", strings.NewReader(form.Encode())), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.apiHandleCreateUpload(ctx, req)
+	require.ErrorAs(t, err, &response)
+	require.NoError(t, json.Unmarshal(response.data, &completed))
+	require.True(t, completed.Complete)
+	require.FileExists(t, filepath.Join(wsDir, "empty.txt"))
+
+	entries, err := audit.List(stateDir, audit.Filter{Action: audit.ActionFileWrite}, 10)
+	require.NoError(t, err)
+	var details []string
+	for _, e := range entries {
+		details = append(details, e.Detail)
+	}
+	require.ElementsMatch(t, []string{"artifact.bin, 10 bytes uploaded", "empty.txt, 0 bytes uploaded"}, details)
+}
+
+func TestJSONHandleFileSearch(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	wsDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(wsDir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+	ws, err := executor.CreateWorkspace(stateDir, "search-ws", wsDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/files/json-search?q=func+%5Cw%2B&context=1", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.jsonHandleFileSearch(ctx, req)
+	var response *contentTypeError
+	require.ErrorAs(t, err, &response)
+	var result fileeditor.ContentSearchResult
+	require.NoError(t, json.Unmarshal(response.data, &result))
+	require.Len(t, result.Matches, 1)
+	require.Equal(t, "main.go", result.Matches[0].RelativePath)
+	require.Equal(t, 3, result.Matches[0].Line)
+	require.Len(t, result.Matches[0].Before, 1)
+
+	req = withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/files/json-search?q=%28", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.jsonHandleFileSearch(ctx, req)
+	var httpErr httperror.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusBadRequest, httpErr.StatusCode)
+}
+
+func TestHandleFileSaveMerge(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	wsDir := t.TempDir()
+	ws, err := executor.CreateWorkspace(stateDir, "merge-ws", wsDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	filePath := filepath.Join(wsDir, "notes.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("a\nb\nC\n"), 0o644))
+
+	// The file was "a\nb\nc\n" when the editor loaded it
+	form := url.Values{
+		"file_path":         {"notes.txt"},
+		"content":           {"A\nb\nc\n"},
+		"original_content":  {"a\nb\nc\n"},
+		"original_checksum": {fileeditor.Checksum("a\nb\nc\n")},
+	}
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/files/save", strings.NewReader(form.Encode())), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.handleFileSave(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Conflict Detected")
+	require.Contains(t, string(body), "A\nb\nC\n")
+	require.Contains(t, string(body), "Use Merged Content")
+
+	// The file on disk is not changed before the user saves the merged content
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	require.Equal(t, "a\nb\nC\n", string(data))
+}
+
+func TestHandleAudit(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	wsDir := t.TempDir()
+	ws, err := executor.CreateWorkspace(stateDir, "audit-ws", wsDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := httptest.NewRequest("POST", "/login", strings.NewReader("password=wrong"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	_, err = srv.handleLogin(ctx, req)
+	require.NoError(t, err)
+
+	form := url.Values{"file_path": {"notes.txt"}, "content": {"hello"}, "original_checksum": {fileeditor.Checksum("")}}
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/files/save", strings.NewReader(form.Encode())), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	_, err = srv.handleFileSave(ctx, req)
+	require.NoError(t, err)
+
+	entries, err := audit.List(stateDir, audit.Filter{}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, audit.Entry{Time: entries[0].Time, Action: audit.ActionFileWrite, User: auth.AdminUser, Remote: "192.0.2.1:1234", Workspace: ws.ID, Detail: "notes.txt"}, entries[0])
+	require.Equal(t, "192.0.2.1:1234 (203.0.113.7)", entries[1].Remote)
+
+	body, err := srv.handleAudit(ctx, withUser(httptest.NewRequest("GET", "/audit?action=login-failed", nil), auth.AdminUser))
+	require.NoError(t, err)
+	require.Contains(t, string(body), "203.0.113.7")
+	require.NotContains(t, string(body), "notes.txt")
+
+	body, err = srv.handleAudit(ctx, withUser(httptest.NewRequest("GET", "/audit?from=2020-13-01", nil), auth.AdminUser))
+	require.NoError(t, err)
+	require.Contains(t, string(body), "invalid date")
+}
+
+func TestHandleLoginRateLimit(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, auth.InitAuth(stateDir))
+	password := "correct-horse-battery-staple-0123456789"
+	require.NoError(t, auth.AddPassword(stateDir, password))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+	login := func(remote, pw string) error {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader("password="+pw))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = remote
+		_, err := srv.handleLogin(ctx, req)
+		return err
+	}
+
+	require.NoError(t, login("192.0.2.1:1234", "wrong"))
+	var redirect *cookieRedirectError
+	require.ErrorAs(t, login("192.0.2.1:1234", password), &redirect)
+	// The success reset the failures
+	for range 5 {
+		require.NoError(t, login("192.0.2.1:1234", "wrong"))
+	}
+
+	// Locked out, even with the correct password and from another port
+	err = login("192.0.2.1:5678", password)
+	var httpErr httperror.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusTooManyRequests, httpErr.StatusCode)
+	require.Contains(t, httpErr.Message, "Try again in 1s")
+
+	require.NoError(t, login("192.0.2.2:1234", "wrong"))
+}
+
+func TestHandleLoginRateLimitBehindProxy(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, auth.InitAuth(stateDir))
+	require.NoError(t, auth.AddPassword(stateDir, "correct-horse-battery-staple-0123456789"))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+	login := func(remote string, header http.Header) error {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader("password=wrong"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		maps.Copy(req.Header, header)
+		req.RemoteAddr = remote
+		_, err := srv.handleLogin(ctx, req)
+		return err
+	}
+	lockOut := func(remote string, header http.Header) {
+		for range 5 {
+			require.NoError(t, login(remote, header))
+		}
+		var httpErr httperror.HTTPError
+		require.ErrorAs(t, login(remote, header), &httpErr)
+		require.Equal(t, http.StatusTooManyRequests, httpErr.StatusCode)
+	}
+
+	// Without trusted proxies X-Forwarded-For is ignored, a spoofed header does not bypass the limit
+	lockOut("192.0.2.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.1"}})
+	require.Error(t, login("192.0.2.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.2"}}))
+
+	// Behind a trusted proxy every client has its own limit
+	srv.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("10.0.0.0/8")})
+	lockOut("127.0.0.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.3"}})
+	require.NoError(t, login("127.0.0.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.4"}}))
+	// Addresses which the client puts in front don't count, the last untrusted hop does
+	require.Error(t, login("127.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.3, 10.0.0.2"}}))
+	require.Error(t, login("127.0.0.1:1234", http.Header{"Forwarded": {`for="203.0.113.3:4711";proto=https`}}))
+	require.Equal(t, "203.0.113.5", srv.remoteHost(&http.Request{RemoteAddr: "[::ffff:127.0.0.1]:80", Header: http.Header{"Forwarded": {`for=198.51.100.1, for="203.0.113.5"`}}}))
+	require.Equal(t, "2001:db8::17", srv.remoteHost(&http.Request{RemoteAddr: "127.0.0.1:80", Header: http.Header{"Forwarded": {`for="[2001:db8::17]:4711"`}}}))
+}
+
+func TestHxHandleGit(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	wsDir := t.TempDir()
+	ws, err := executor.CreateWorkspace(stateDir, "git-ws", wsDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	req := withUser(httptest.NewRequest("GET", "/workspaces/"+ws.ID+"/hx-git", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	body, err := srv.hxHandleGit(ctx, req)
+	require.NoError(t, err)
+	require.NotContains(t, string(body), "Git:")
+
+	output, err := exec.Command("git", "-C", wsDir, "init", "--initial-branch=main").CombinedOutput()
+	require.NoError(t, err, string(output))
+	require.NoError(t, os.WriteFile(filepath.Join(wsDir, "new.txt"), []byte("content"), 0o644))
+	body, err = srv.hxHandleGit(ctx, req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "main")
+	require.Contains(t, string(body), "0 changed, 1 untracked")
+	require.Contains(t, string(body), `value="git --no-pager diff"`)
+}
+
+func TestHxHandleSendStdinFile(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	wsDir := t.TempDir()
+	ws, err := executor.CreateWorkspace(stateDir, "stdin-ws", wsDir, "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	content := strings.Repeat("0123456789", 300)
+	require.NoError(t, os.WriteFile(filepath.Join(wsDir, "input.txt"), []byte(content), 0o644))
+
+	// A listener in place of the socket of a nohup process
+	proc, err := executor.CreateProcess(ws, "cat")
+	require.NoError(t, err)
+	processID := proc.CommandId
+	listener, err := net.Listen("unix", executor.SocketPath(processID))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	received := make(chan map[string][]byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		reader, _ := outputlog.NewOutputLogReader(conn)
+		received <- reader.All()
+	}()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	require.NoError(t, writer.WriteField("path", "input.txt"))
+	require.NoError(t, writer.Close())
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/"+processID+"/hx-send-stdin-file", &body), auth.AdminUser)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	result, err := srv.hxHandleSendStdinFile(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(result), "Sent 2.9 KiB of input.txt")
+	require.Equal(t, content, string((<-received)["stdin"]))
+
+	req = withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/"+processID+"/hx-send-stdin-file",
+		strings.NewReader(url.Values{"path": {"../secret"}}.Encode())), auth.AdminUser)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", processID)
+	_, err = srv.hxHandleSendStdinFile(context.Background(), req)
+	var httpErr httperror.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusBadRequest, httpErr.StatusCode)
+}
+
+func TestHxHandleCloseStdin(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "close-stdin-ws", t.TempDir(), "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/unknown/hx-close-stdin", nil), auth.AdminUser)
+	req.SetPathValue("id", ws.ID)
+	req.SetPathValue("processID", "unknown")
+	_, err = srv.hxHandleCloseStdin(context.Background(), req)
+	var httpErr httperror.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+
+	proc, err := executor.CreateProcess(ws, "cat")
+	require.NoError(t, err)
+	req.SetPathValue("processID", proc.CommandId)
+	listener, err := net.Listen("unix", executor.SocketPath(proc.CommandId))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	received := make(chan outputlog.Chunk, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		reader, _ := outputlog.NewOutputLogReader(conn)
+		received <- <-reader.Channel()
+	}()
+	body, err := srv.hxHandleCloseStdin(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "Stdin closed")
+	require.Equal(t, outputlog.StreamStdinClose, (<-received).Stream)
+}
+
+func TestHxHandleSendStdin(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "send-stdin-ws", t.TempDir(), "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	proc, err := executor.CreateProcess(ws, "cat")
+	require.NoError(t, err)
+	listener, err := net.Listen("unix", executor.SocketPath(proc.CommandId))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	// Like nohup, the listener closes the connection when the input was written to the command,
+	// and replies with the error if that failed. The last connection is never answered.
+	received := make(chan string, 3)
+	unanswered := make(chan net.Conn, 1)
+	go func() {
+		for _, reply := range []string{"", "failed to write stdin: input/output error\n"} {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := io.ReadAll(conn)
+			received <- string(data)
+			_, _ = conn.Write([]byte(reply))
+			_ = conn.Close()
+		}
+		conn, err := listener.Accept()
+		if err == nil {
+			unanswered <- conn
+		}
+	}()
+	send := func(ctx context.Context) string {
+		req := withUser(httptest.NewRequest("POST", "/workspaces/"+ws.ID+"/processes/"+proc.CommandId+"/hx-send-stdin",
+			strings.NewReader(url.Values{"stdin": {"hello"}}.Encode())), auth.AdminUser)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetPathValue("id", ws.ID)
+		req.SetPathValue("processID", proc.CommandId)
+		body, err := srv.hxHandleSendStdin(ctx, req)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	require.Empty(t, send(context.Background()))
+	require.Contains(t, <-received, "hello\n")
+	require.Contains(t, send(context.Background()), "Input not delivered: failed to write stdin: input/output error")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	require.Contains(t, send(ctx), "it is queued")
+}
+
+func TestSysmonRoutes(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	require.NoError(t, auth.InitAuth(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	handler := srv.SetupRoutes()
+	admin := strings.Repeat("a", auth.MinPasswordLength)
+	alice := strings.Repeat("b", auth.MinPasswordLength)
+	require.NoError(t, auth.AddPassword(stateDir, admin))
+	require.NoError(t, auth.AddUser(stateDir, "alice", alice))
+
+	// get sends a GET request with a session of the user of password, or without a session
+	get := func(password, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if password != "" {
+			token, ok := auth.Authenticate(t.Context(), stateDir, password, auth.Client{})
+			require.True(t, ok)
+			req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	pages := map[string]string{
+		"/sysmon":              "/sysmon/hx-host",
+		"/sysmon/hx-host":      "Memory",
+		"/sysmon/hx-processes": "/sysmon/process/",
+		"/sysmon/process/" + strconv.Itoa(os.Getpid()): "Send Signal",
+	}
+	for target, want := range pages {
+		w := get(admin, target)
+		require.Equal(t, http.StatusOK, w.Code, target)
+		require.Contains(t, w.Body.String(), want, target)
+
+		require.Equal(t, http.StatusForbidden, get(alice, target).Code, target)
+		require.NotEqual(t, http.StatusOK, get("", target).Code, target)
+	}
+
+	// Only the admin gets the link in the navigation
+	require.Contains(t, get(admin, "/").Body.String(), `href="/sysmon"`)
+	require.NotContains(t, get(alice, "/").Body.String(), `href="/sysmon"`)
+}
+
+func TestHandleStorage(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	require.NoError(t, auth.InitAuth(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "storage-ws", stateDir, "")
+	require.NoError(t, err)
+	writeTestProcessDir(t, ws.Path, "2025-01-07T10:00:00Z", true)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	srv.SetStorageWarning(1)
+	srv.checkStorage()
+	handler := srv.SetupRoutes()
+	admin := strings.Repeat("a", auth.MinPasswordLength)
+	alice := strings.Repeat("b", auth.MinPasswordLength)
+	require.NoError(t, auth.AddPassword(stateDir, admin))
+	require.NoError(t, auth.AddUser(stateDir, "alice", alice))
+
+	// do sends a request with a session of the user of password
+	do := func(password, method, target, form string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		token, ok := auth.Authenticate(t.Context(), stateDir, password, auth.Client{})
+		require.True(t, ok)
+		req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(admin, "GET", "/storage", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "storage-ws")
+	require.Contains(t, w.Body.String(), "more than the warning threshold")
+
+	// Only the admin gets the warning and the link
+	require.Contains(t, do(admin, "GET", "/", "").Body.String(), "more than the warning threshold")
+	require.NotContains(t, do(alice, "GET", "/", "").Body.String(), "more than the warning threshold")
+	require.Equal(t, http.StatusForbidden, do(alice, "GET", "/storage", "").Code)
+
+	// Without a policy there is nothing to apply
+	w = do(admin, "POST", "/storage", "workspace="+ws.ID)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	require.NoError(t, retention.SavePolicy(ws, retention.Policy{MaxCount: 1}))
+	writeTestProcessDir(t, ws.Path, "2025-01-07T11:00:00Z", true)
+	w = do(admin, "POST", "/storage", "workspace="+ws.ID)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/storage", w.Header().Get("Location"))
+	_, err = os.Stat(filepath.Join(ws.Path, "processes", "2025-01-07T10:00:00Z"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(ws.Path, "processes", "2025-01-07T11:00:00Z"))
+	require.NoError(t, err)
+}
+
+func TestWorkspaceOwnership(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	require.NoError(t, auth.InitAuth(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	handler := srv.SetupRoutes()
+
+	admin := strings.Repeat("a", auth.MinPasswordLength)
+	alice := strings.Repeat("b", auth.MinPasswordLength)
+	bob := strings.Repeat("c", auth.MinPasswordLength)
+	require.NoError(t, auth.AddPassword(stateDir, admin))
+	require.NoError(t, auth.AddUser(stateDir, "alice", alice))
+	require.NoError(t, auth.AddUser(stateDir, "bob", bob))
+
+	// serve sends a request with a session of the user of password
+	serve := func(password, method, target string, form url.Values) *httptest.ResponseRecorder {
+		token, ok := auth.Authenticate(t.Context(), stateDir, password, auth.Client{})
+		require.True(t, ok)
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(alice, "POST", "/workspaces/hx-create", url.Values{"name": {"alice-ws"}, "directory": {t.TempDir()}})
+	require.Equal(t, "/workspaces/alice-ws", w.Header().Get("HX-Redirect"))
+	ws, err := workspace.GetWorkspaceByID(stateDir, "alice-ws")
+	require.NoError(t, err)
+	require.Equal(t, "alice", ws.Owner)
+
+	// Other users neither see nor open the workspace, the admin does
+	require.Contains(t, serve(alice, "GET", "/", nil).Body.String(), "alice-ws")
+	require.NotContains(t, serve(bob, "GET", "/", nil).Body.String(), "alice-ws")
+	require.Equal(t, http.StatusNotFound, serve(bob, "GET", "/workspaces/alice-ws", nil).Code)
+	require.Equal(t, http.StatusNotFound, serve(bob, "POST", "/workspaces/alice-ws/execute", url.Values{"command": {"id"}}).Code)
+	require.Equal(t, http.StatusOK, serve(admin, "GET", "/workspaces/alice-ws", nil).Code)
+
+	// The owner shares the workspace with existing users
+	w = serve(alice, "POST", "/workspaces/alice-ws/edit", url.Values{"name": {"alice-ws"}, "shared_with": {"carol"}})
+	require.Contains(t, w.Body.String(), "unknown user &#34;carol&#34;")
+	w = serve(alice, "POST", "/workspaces/alice-ws/edit", url.Values{"name": {"alice-ws"}, "shared_with": {"bob"}})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, http.StatusOK, serve(bob, "GET", "/workspaces/alice-ws", nil).Code)
+	require.Contains(t, serve(bob, "GET", "/workspaces/alice-ws/edit", nil).Body.String(), "Owned by alice, shared with you")
+
+	// Server-wide pages are only for the admin
+	require.Equal(t, http.StatusForbidden, serve(bob, "GET", "/settings", nil).Code)
+	require.Equal(t, http.StatusForbidden, serve(bob, "GET", "/files", nil).Code)
+	require.Equal(t, http.StatusOK, serve(admin, "GET", "/settings", nil).Code)
+
+	entries, err := audit.List(stateDir, audit.Filter{User: "alice", Action: audit.ActionWorkspaceCreate}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// A request which missed authMiddleware has no user and can't access anything, not even the
+	// workspaces from before named users existed
+	legacy, err := executor.CreateWorkspace(stateDir, "legacy", t.TempDir(), "")
+	require.NoError(t, err)
+	req := httptest.NewRequest("GET", "/workspaces/"+legacy.ID, nil)
+	req.SetPathValue("id", legacy.ID)
+	_, err = srv.handleWorkspaceByID(t.Context(), req)
+	require.Error(t, err)
+	_, err = srv.handleExport(t.Context(), httptest.NewRequest("GET", "/export?kind=processes", nil))
+	require.ErrorIs(t, err, errNoUser)
+	_, err = srv.apiHandleClipboard(t.Context(), httptest.NewRequest("GET", "/api/v1/clipboard", nil))
+	require.ErrorIs(t, err, errNoUser)
+}
+
+func TestCommandPolicy(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	require.NoError(t, auth.InitAuth(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	srv.executor = &executor.Fake{}
+	handler := srv.SetupRoutes()
+
+	alice := strings.Repeat("b", auth.MinPasswordLength)
+	bob := strings.Repeat("c", auth.MinPasswordLength)
+	require.NoError(t, auth.AddUser(stateDir, "alice", alice))
+	require.NoError(t, auth.AddUser(stateDir, "bob", bob))
+	serve := func(password, method, target string, form url.Values) *httptest.ResponseRecorder {
+		token, ok := auth.Authenticate(t.Context(), stateDir, password, auth.Client{})
+		require.True(t, ok)
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(alice, "POST", "/workspaces/hx-create", url.Values{"name": {"team"}, "directory": {t.TempDir()}})
+	require.Equal(t, "/workspaces/team", w.Header().Get("HX-Redirect"))
+	w = serve(alice, "POST", "/workspaces/team/edit", url.Values{"name": {"team"}, "shared_with": {"bob"}, "command_policy": {"allow ("}})
+	require.Contains(t, w.Body.String(), "invalid command policy")
+	w = serve(alice, "POST", "/workspaces/team/edit", url.Values{"name": {"team"}, "shared_with": {"bob"}, "command_policy": {"preset no-destructive"}})
+	require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+
+	// The teammate can change neither the policy nor the pre-command
+	w = serve(bob, "POST", "/workspaces/team/edit", url.Values{"name": {"team"}, "command_policy": {""}, "pre_command": {"rm -rf build"}})
+	require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+	ws, err := workspace.GetWorkspaceByID(stateDir, "team")
+	require.NoError(t, err)
+	require.Equal(t, "preset no-destructive", ws.CommandPolicy)
+	require.Empty(t, ws.PreCommand)
+
+	// Denied commands show the reason above the execute form
+	w = serve(bob, "POST", "/workspaces/team/hx-execute", url.Values{"command": {"rm -rf build"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `hx-swap-oob="innerHTML:#execute-error"`)
+	require.Contains(t, w.Body.String(), "command denied by the policy of the workspace")
+	w = serve(bob, "POST", "/workspaces/team/execute", url.Values{"command": {"rm -rf build"}})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = serve(bob, "POST", "/workspaces/team/terminal-execute", url.Values{"command": {"sudo reboot"}})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	processes, err := workspace.ListProcesses(ws)
+	require.NoError(t, err)
+	require.Empty(t, processes)
+
+	w = serve(bob, "POST", "/workspaces/team/hx-execute", url.Values{"command": {"rm build/app"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), "execute-error")
+
+	entries, err := audit.List(stateDir, audit.Filter{User: "bob", Action: audit.ActionExecuteDenied}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+}
+
+func TestWorkspaceArchive(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	require.NoError(t, auth.InitAuth(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	srv.executor = &executor.Fake{}
+	handler := srv.SetupRoutes()
+
+	alice := strings.Repeat("b", auth.MinPasswordLength)
+	bob := strings.Repeat("c", auth.MinPasswordLength)
+	require.NoError(t, auth.AddUser(stateDir, "alice", alice))
+	require.NoError(t, auth.AddUser(stateDir, "bob", bob))
+	serve := func(password, method, target string, form url.Values) *httptest.ResponseRecorder {
+		token, ok := auth.Authenticate(t.Context(), stateDir, password, auth.Client{})
+		require.True(t, ok)
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(alice, "POST", "/workspaces/hx-create", url.Values{"name": {"old-project"}, "directory": {t.TempDir()}})
+	require.Equal(t, "/workspaces/old-project", w.Header().Get("HX-Redirect"))
+	w = serve(alice, "POST", "/workspaces/old-project/edit", url.Values{"name": {"old-project"}, "shared_with": {"bob"}})
+	require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+	w = serve(alice, "POST", "/workspaces/old-project/hx-execute", url.Values{"command": {"make"}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Only the owner can archive the workspace
+	require.Equal(t, http.StatusForbidden, serve(bob, "POST", "/workspaces/old-project/archive", nil).Code)
+	w = serve(alice, "POST", "/workspaces/old-project/archive", nil)
+	require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+	require.Contains(t, serve(alice, "GET", "/workspaces/old-project", nil).Body.String(), "This workspace is archived")
+
+	// It is hidden from the list, but the history stays browsable
+	body := serve(alice, "GET", "/", nil).Body.String()
+	require.NotContains(t, body, `href="/workspaces/old-project"`)
+	require.Contains(t, body, "Show archived workspaces (1)")
+	require.Contains(t, serve(alice, "GET", "/?archived=1", nil).Body.String(), `href="/workspaces/old-project"`)
+	ws, err := workspace.GetWorkspaceByID(stateDir, "old-project")
+	require.NoError(t, err)
+	require.True(t, ws.IsArchived())
+	processes, err := workspace.ListProcesses(ws)
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+	w = serve(bob, "GET", "/workspaces/old-project/processes/"+processes[0].CommandId, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// New commands are denied
+	w = serve(bob, "POST", "/workspaces/old-project/execute", url.Values{"command": {"make"}})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "the workspace is archived")
+
+	w = serve(alice, "POST", "/workspaces/old-project/archive", url.Values{"archived": {"false"}})
+	require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+	require.Contains(t, serve(alice, "GET", "/", nil).Body.String(), `href="/workspaces/old-project"`)
+	w = serve(bob, "POST", "/workspaces/old-project/execute", url.Values{"command": {"make"}})
+	require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+
+	entries, err := audit.List(stateDir, audit.Filter{User: "alice", Action: audit.ActionWorkspaceChange, Query: "archived"}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestRecentActivity(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	require.NoError(t, auth.InitAuth(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	srv.executor = &executor.Fake{Results: map[string]executor.FakeResult{
+		"make test": {ExitCode: 2, Duration: 90 * time.Second},
+	}}
+	handler := srv.SetupRoutes()
+
+	alice := strings.Repeat("b", auth.MinPasswordLength)
+	bob := strings.Repeat("c", auth.MinPasswordLength)
+	require.NoError(t, auth.AddUser(stateDir, "alice", alice))
+	require.NoError(t, auth.AddUser(stateDir, "bob", bob))
+	serve := func(password, method, target string, form url.Values) *httptest.ResponseRecorder {
+		token, ok := auth.Authenticate(t.Context(), stateDir, password, auth.Client{})
+		require.True(t, ok)
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	require.NotContains(t, serve(alice, "GET", "/", nil).Body.String(), "Recent Activity")
+	w := serve(alice, "POST", "/workspaces/hx-create", url.Values{"name": {"backend"}, "directory": {t.TempDir()}})
+	require.Equal(t, "/workspaces/backend", w.Header().Get("HX-Redirect"))
+	w = serve(alice, "POST", "/workspaces/backend/hx-execute", url.Values{"command": {"make test"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	ws, err := workspace.GetWorkspaceByID(stateDir, "backend")
+	require.NoError(t, err)
+	processes, err := workspace.ListProcesses(ws)
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+
+	body := serve(alice, "GET", "/", nil).Body.String()
+	require.Contains(t, body, "Recent Activity")
+	require.Contains(t, body, `href="/workspaces/backend/processes/`+processes[0].CommandId+`"`)
+	require.Contains(t, body, "exit 2")
+	require.Contains(t, body, "1m 30s")
+
+	// The activity of workspaces which are not shared is hidden
+	require.NotContains(t, serve(bob, "GET", "/", nil).Body.String(), "Recent Activity")
+}
+
+func TestHandleSessions(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	require.NoError(t, auth.InitAuth(stateDir))
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	handler := srv.SetupRoutes()
+
+	alice := strings.Repeat("b", auth.MinPasswordLength)
+	bob := strings.Repeat("c", auth.MinPasswordLength)
+	require.NoError(t, auth.AddUser(stateDir, "alice", alice))
+	require.NoError(t, auth.AddUser(stateDir, "bob", bob))
+
+	// serve sends a request with the session of token
+	serve := func(token, method, target string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The login records the client of the session
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(url.Values{"password": {alice}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "Phone Browser")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	phone := w.Result().Cookies()[0].Value
+	laptop, ok := auth.Authenticate(t.Context(), stateDir, alice, auth.Client{Remote: "192.0.2.7", UserAgent: "Laptop Browser"})
+	require.True(t, ok)
+	bobToken, ok := auth.Authenticate(t.Context(), stateDir, bob, auth.Client{UserAgent: "Bob Browser"})
+	require.True(t, ok)
+
+	// Users see only their own sessions
+	body := serve(laptop, "GET", "/sessions", nil).Body.String()
+	require.Contains(t, body, "Phone Browser")
+	require.Contains(t, body, "Laptop Browser")
+	require.Contains(t, body, "192.0.2.7")
+	require.NotContains(t, body, "Bob Browser")
+
+	phoneSession, err := auth.LookupSession(stateDir, phone)
+	require.NoError(t, err)
+	bobSession, err := auth.LookupSession(stateDir, bobToken)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, serve(laptop, "POST", "/sessions", url.Values{"revoke": {bobSession.ID}}).Code)
+
+	// Revoking another session logs it out
+	w = serve(laptop, "POST", "/sessions", url.Values{"revoke": {phoneSession.ID}})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/sessions", w.Header().Get("Location"))
+	require.Equal(t, "/login", serve(phone, "GET", "/", nil).Header().Get("Location"))
+	require.Equal(t, http.StatusOK, serve(laptop, "GET", "/", nil).Code)
+
+	// Revoking the current session logs out
+	laptopSession, err := auth.LookupSession(stateDir, laptop)
+	require.NoError(t, err)
+	w = serve(laptop, "POST", "/sessions", url.Values{"revoke": {laptopSession.ID}})
+	require.Equal(t, "/login", w.Header().Get("Location"))
+	require.Equal(t, "/login", serve(laptop, "GET", "/", nil).Header().Get("Location"))
+
+	// The logout revokes the session on the server, too
+	w = serve(bobToken, "GET", "/logout", nil)
+	require.Equal(t, "/login", w.Header().Get("Location"))
+	bobSession, err = auth.LookupSession(stateDir, bobToken)
+	require.NoError(t, err)
+	require.Nil(t, bobSession)
+
+	entries, err := audit.List(stateDir, audit.Filter{User: "alice", Action: audit.ActionLogout}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestAPIExecute(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "api-ws", t.TempDir(), "")
+	require.NoError(t, err)
+	srv, err := New(stateDir, true)
+	require.NoError(t, err)
+	srv.executor = &executor.Fake{Results: map[string]executor.FakeResult{
+		"make test": {Stdout: "ok\n", Stderr: "warning\n", ExitCode: 2},
+	}}
+	handler := srv.SetupRoutes()
+	token, err := auth.AddAPIToken(stateDir, "")
+	require.NoError(t, err)
+
+	serve := func(token, method, target string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("wrong", "POST", "/api/v1/workspaces/"+ws.ID+"/processes", url.Values{"command": {"make test"}})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serve(token, "POST", "/api/v1/workspaces/"+ws.ID+"/processes", url.Values{"command": {"make test"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var started executeResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+	require.Equal(t, "make test", started.Command)
+
+	w = serve(token, "GET", "/api/v1/processes/"+started.ID+"/output?workspace="+ws.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var output outputResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &output))
+	require.Len(t, output.Chunks, 2)
+	require.Equal(t, "ok\n", output.Chunks[0].Text)
+	require.Equal(t, outputlog.StreamStderr, output.Chunks[1].Stream)
+	require.False(t, output.Completed)
+
+	w = serve(token, "GET", "/api/v1/processes/"+started.ID+"/output?stream=stderr", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	output = outputResult{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &output))
+	require.Len(t, output.Chunks, 1)
+	require.Equal(t, outputlog.StreamStderr, output.Chunks[0].Stream)
+	w = serve(token, "GET", "/api/v1/processes/"+started.ID+"/output?stream=no%20stream", nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The process completed and all output was returned
+	w = serve(token, "GET", fmt.Sprintf("/api/v1/processes/%s/output?offset=%d", started.ID, output.Offset), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	output = outputResult{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &output))
+	require.Empty(t, output.Chunks)
+	require.True(t, output.Completed)
+	require.Equal(t, 2, *output.ExitCode)
+
+	// Errors are plain text for API clients
+	require.NoError(t, workspace.SaveEnvironment(ws, workspace.EnvironmentProd))
+	w = serve(token, "POST", "/api/v1/workspaces/"+ws.ID+"/processes", url.Values{"command": {"make test"}})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "Confirm to run the command in the production workspace\n", w.Body.String())
+	w = serve(token, "POST", "/api/v1/workspaces/"+ws.ID+"/processes", url.Values{"command": {"make test"}, "confirm_production": {"true"}})
+	require.Equal(t, http.StatusOK, w.Code)
+}
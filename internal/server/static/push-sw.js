@@ -0,0 +1,34 @@
+// Service worker for Web Push notifications, it gets registered on the settings page. It shows
+// the notifications about finished processes, even when no MobileShell tab is open.
+
+self.addEventListener('push', (event) => {
+    let data = {};
+    try {
+        data = event.data ? event.data.json() : {};
+    } catch (e) {
+        data = { title: event.data.text() };
+    }
+    event.waitUntil(self.registration.showNotification(data.title || 'MobileShell', {
+        body: data.body || '',
+        tag: data.process_id || undefined,
+        data: data,
+    }));
+});
+
+self.addEventListener('notificationclick', (event) => {
+    event.notification.close();
+    const data = event.notification.data || {};
+    // The worker is served from <base path>/static/static/push-sw.js
+    let url = new URL('../../', self.location);
+    if (data.workspace_id && data.process_id) {
+        url = new URL('workspaces/' + encodeURIComponent(data.workspace_id) + '/processes/' + encodeURIComponent(data.process_id), url);
+    }
+    event.waitUntil(clients.matchAll({ type: 'window', includeUncontrolled: true }).then((windows) => {
+        for (const w of windows) {
+            if (w.url === url.href && 'focus' in w) {
+                return w.focus();
+            }
+        }
+        return clients.openWindow(url.href);
+    }));
+});
@@ -0,0 +1,216 @@
+// Package share creates expiring read-only links to a single process, which work without
+// login.
+//
+// A share is a directory in stateDir/shares/<id> with one file per field (like a process
+// directory). The link contains the token "<id>.<expiry>.<signature>". The signature is an
+// HMAC-SHA256 of id and expiry with a secret which never leaves the state directory. A token
+// is only accepted if the signature is valid, it is not expired, and the share directory
+// still exists, so deleting the directory revokes the link. Guessing a valid token is not
+// feasible, and every failure takes the same code path and returns the same error.
+package share
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+	"mobileshell/internal/secret"
+)
+
+// ErrInvalid is returned by Open for tokens which are malformed, expired, revoked or forged.
+var ErrInvalid = errors.New("invalid or expired share link")
+
+// Share is a read-only link to a process.
+type Share struct {
+	ID          string
+	WorkspaceID string
+	ProcessID   string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	Views       int
+}
+
+const secretFile = "share-secret"
+
+func sharesDir(stateDir string) string {
+	return filepath.Join(stateDir, "shares")
+}
+
+// Create creates a share for the process which expires after ttl.
+func Create(stateDir, workspaceID, processID string, ttl time.Duration) (*Share, error) {
+	now := time.Now().UTC()
+	sh := &Share{
+		ID:          rand.Text(),
+		WorkspaceID: workspaceID,
+		ProcessID:   processID,
+		CreatedAt:   now,
+		// The expiry is part of the token, so it has a resolution of one second
+		ExpiresAt: now.Add(ttl).Truncate(time.Second),
+	}
+	shareDir := filepath.Join(sharesDir(stateDir), sh.ID)
+	if err := os.MkdirAll(shareDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create share directory: %w", err)
+	}
+	err := metadata.WriteFiles(shareDir, []metadata.File{
+		{Name: "workspace-id", Content: workspaceID},
+		{Name: "process-id", Content: processID},
+		{Name: "created", Content: sh.CreatedAt.Format(time.RFC3339Nano)},
+		{Name: "expires", Content: sh.ExpiresAt.Format(time.RFC3339Nano)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sh, nil
+}
+
+// Token returns the token for the link of the share.
+func Token(stateDir string, sh *Share) (string, error) {
+	key, err := secret.Load(stateDir, secretFile)
+	if err != nil {
+		return "", err
+	}
+	payload := sh.ID + "." + strconv.FormatInt(sh.ExpiresAt.Unix(), 10)
+	return payload + "." + secret.Sign(key, []byte(payload)), nil
+}
+
+// Open verifies the token and counts the view. It returns ErrInvalid if the token is not
+// valid (anymore).
+func Open(stateDir, token string) (*Share, error) {
+	sh, err := open(stateDir, token)
+	if err != nil {
+		// Add random delay to mitigate timing attacks
+		time.Sleep(time.Duration(10+mathrand.Int32N(1000)) * time.Microsecond)
+		slog.Debug("Share link rejected", "error", err)
+		return nil, ErrInvalid
+	}
+	// Each view appends one byte, so concurrent views need no locking
+	f, err := os.OpenFile(filepath.Join(sharesDir(stateDir), sh.ID, "views"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count view: %w", err)
+	}
+	_, err = f.Write([]byte{'.'})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to count view: %w", err)
+	}
+	sh.Views++
+	return sh, nil
+}
+
+func open(stateDir, token string) (*Share, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	key, err := secret.Load(stateDir, secretFile)
+	if err != nil {
+		return nil, err
+	}
+	if !secret.Valid(key, []byte(parts[0]+"."+parts[1]), parts[2]) {
+		return nil, fmt.Errorf("wrong signature")
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().UTC().After(time.Unix(expiry, 0)) {
+		return nil, fmt.Errorf("share %s expired", parts[0])
+	}
+	return load(stateDir, parts[0])
+}
+
+// List returns the shares of the process which are not expired, newest first.
+func List(stateDir, workspaceID, processID string) ([]*Share, error) {
+	entries, err := os.ReadDir(sharesDir(stateDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shares directory: %w", err)
+	}
+	now := time.Now().UTC()
+	var shares []*Share
+	for _, entry := range entries {
+		sh, err := load(stateDir, entry.Name())
+		if err != nil || sh.WorkspaceID != workspaceID || sh.ProcessID != processID || now.After(sh.ExpiresAt) {
+			continue
+		}
+		shares = append(shares, sh)
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].CreatedAt.After(shares[j].CreatedAt)
+	})
+	return shares, nil
+}
+
+// Revoke deletes the share, so that its link does not work anymore.
+func Revoke(stateDir, id string) error {
+	if _, err := load(stateDir, id); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(sharesDir(stateDir), id))
+}
+
+// CleanExpired deletes the directories of expired shares.
+func CleanExpired(stateDir string) {
+	entries, err := os.ReadDir(sharesDir(stateDir))
+	if err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	for _, entry := range entries {
+		sh, err := load(stateDir, entry.Name())
+		if err != nil || now.After(sh.ExpiresAt) {
+			_ = os.RemoveAll(filepath.Join(sharesDir(stateDir), entry.Name()))
+		}
+	}
+}
+
+// load reads the share directory. id must not contain path separators.
+func load(stateDir, id string) (*Share, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("invalid share ID %q", id)
+	}
+	shareDir := filepath.Join(sharesDir(stateDir), id)
+	read := func(name string) (string, error) {
+		data, err := os.ReadFile(filepath.Join(shareDir, name))
+		return strings.TrimSpace(string(data)), err
+	}
+	sh := &Share{ID: id}
+	var err error
+	if sh.WorkspaceID, err = read("workspace-id"); err != nil {
+		return nil, err
+	}
+	if sh.ProcessID, err = read("process-id"); err != nil {
+		return nil, err
+	}
+	created, err := read("created")
+	if err != nil {
+		return nil, err
+	}
+	if sh.CreatedAt, err = time.Parse(time.RFC3339Nano, created); err != nil {
+		return nil, err
+	}
+	expires, err := read("expires")
+	if err != nil {
+		return nil, err
+	}
+	if sh.ExpiresAt, err = time.Parse(time.RFC3339Nano, expires); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(filepath.Join(shareDir, "views")); err == nil {
+		sh.Views = int(info.Size())
+	}
+	return sh, nil
+}
@@ -0,0 +1,69 @@
+package share
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShare(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+
+	sh, err := Create(stateDir, "ws", "proc", time.Hour)
+	require.NoError(t, err)
+	token, err := Token(stateDir, sh)
+	require.NoError(t, err)
+
+	opened, err := Open(stateDir, token)
+	require.NoError(t, err)
+	require.Equal(t, "ws", opened.WorkspaceID)
+	require.Equal(t, "proc", opened.ProcessID)
+	require.Equal(t, 1, opened.Views)
+	_, err = Open(stateDir, token)
+	require.NoError(t, err)
+
+	shares, err := List(stateDir, "ws", "proc")
+	require.NoError(t, err)
+	require.Len(t, shares, 1)
+	require.Equal(t, 2, shares[0].Views)
+	shares, err = List(stateDir, "ws", "other")
+	require.NoError(t, err)
+	require.Empty(t, shares)
+
+	// Forged and malformed tokens
+	_, err = Open(stateDir, "A"+token)
+	require.ErrorIs(t, err, ErrInvalid)
+	_, err = Open(stateDir, token[:len(token)-1]+"0")
+	require.ErrorIs(t, err, ErrInvalid)
+	_, err = Open(stateDir, "../../etc.1.2")
+	require.ErrorIs(t, err, ErrInvalid)
+
+	require.NoError(t, Revoke(stateDir, sh.ID))
+	_, err = Open(stateDir, token)
+	require.ErrorIs(t, err, ErrInvalid)
+	require.Error(t, Revoke(stateDir, "../shares"))
+}
+
+func TestShareExpired(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+
+	sh, err := Create(stateDir, "ws", "proc", -time.Hour)
+	require.NoError(t, err)
+	token, err := Token(stateDir, sh)
+	require.NoError(t, err)
+	_, err = Open(stateDir, token)
+	require.ErrorIs(t, err, ErrInvalid)
+
+	shares, err := List(stateDir, "ws", "proc")
+	require.NoError(t, err)
+	require.Empty(t, shares)
+
+	CleanExpired(stateDir)
+	_, err = os.Stat(filepath.Join(stateDir, "shares", sh.ID))
+	require.True(t, os.IsNotExist(err))
+}
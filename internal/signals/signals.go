@@ -0,0 +1,53 @@
+// Package signals lists the signals of the platform, for the pages and APIs which send signals
+// to processes. The tables are in the files of the platforms, so the callers don't use syscall
+// constants which only exist on some platforms.
+package signals
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Signal is a signal of the platform.
+type Signal struct {
+	Number      int
+	Name        string // With "SIG" prefix, like "SIGTERM"
+	Description string
+}
+
+// All returns the signals of the platform, sorted by number.
+func All() []Signal {
+	all := slices.Clone(table)
+	slices.SortStableFunc(all, func(a, b Signal) int {
+		return a.Number - b.Number
+	})
+	return all
+}
+
+// Parse returns the signal of name, like "SIGTERM", "term" or "15". "EXIT" is the signal 0,
+// which only checks that the process exists.
+func Parse(name string) (syscall.Signal, error) {
+	name = strings.TrimSpace(name)
+	if num, err := strconv.Atoi(name); err == nil {
+		if num < 0 || num > 64 {
+			return 0, fmt.Errorf("signal number out of range: %d", num)
+		}
+		return syscall.Signal(num), nil
+	}
+	name = strings.TrimPrefix(strings.ToUpper(name), "SIG")
+	switch name {
+	case "EXIT":
+		return 0, nil
+	case "POLL":
+		name = "IO"
+	}
+	for _, s := range table {
+		if s.Name == "SIG"+name {
+			return syscall.Signal(s.Number), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown signal: %s", name)
+}
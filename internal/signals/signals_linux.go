@@ -0,0 +1,9 @@
+package signals
+
+import "syscall"
+
+// platformSignals are the signals which only exist on Linux.
+var platformSignals = []Signal{
+	{Number: int(syscall.SIGSTKFLT), Name: "SIGSTKFLT", Description: "Stack fault"},
+	{Number: int(syscall.SIGPWR), Name: "SIGPWR", Description: "Power failure"},
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !windows
+
+package signals
+
+// platformSignals are the signals which only exist on the current platform. macOS and the BSDs
+// only have the POSIX signals.
+var platformSignals []Signal
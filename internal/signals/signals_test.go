@@ -0,0 +1,32 @@
+package signals
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"SIGKILL", "kill", " Kill ", "9"} {
+		sig, err := Parse(name)
+		require.NoError(t, err, name)
+		require.Equal(t, syscall.SIGKILL, sig, name)
+	}
+	sig, err := Parse("EXIT")
+	require.NoError(t, err)
+	require.Equal(t, syscall.Signal(0), sig)
+	_, err = Parse("NOPE")
+	require.ErrorContains(t, err, "unknown signal")
+	_, err = Parse("65")
+	require.ErrorContains(t, err, "out of range")
+
+	all := All()
+	require.NotEmpty(t, all)
+	for _, s := range all {
+		sig, err := Parse(s.Name)
+		require.NoError(t, err, s.Name)
+		require.Equal(t, s.Number, int(sig), s.Name)
+	}
+}
@@ -0,0 +1,9 @@
+package signals
+
+import "syscall"
+
+// table are the signals which work on Windows. It has no signals, os.Process.Signal only
+// supports killing the process.
+var table = []Signal{
+	{Number: int(syscall.SIGKILL), Name: "SIGKILL", Description: "Killed (uncatchable)"},
+}
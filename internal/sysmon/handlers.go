@@ -37,8 +37,21 @@ func HandleSysmon(tmpl *template.Template, ctx context.Context, r *http.Request,
 	return buf.Bytes(), nil
 }
 
+// HandleHostOverview returns the panels of the host metrics (HTMX endpoint)
+func HandleHostOverview(monitor *HostMonitor, tmpl *template.Template, ctx context.Context, r *http.Request, basePath string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := tmpl.ExecuteTemplate(&buf, "hx-sysmon-host.gohtml", map[string]interface{}{
+		"Host":     monitor.Collect(),
+		"BasePath": basePath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
 // HandleProcessList returns the sortable process list (HTMX endpoint)
-func HandleProcessList(tmpl *template.Template, ctx context.Context, r *http.Request, basePath string) ([]byte, error) {
+func HandleProcessList(provider Provider, tmpl *template.Template, ctx context.Context, r *http.Request, basePath string) ([]byte, error) {
 	sortBy := r.URL.Query().Get("sort")
 	if sortBy == "" {
 		sortBy = "cpu"
@@ -54,7 +67,7 @@ func HandleProcessList(tmpl *template.Template, ctx context.Context, r *http.Req
 	currentUID := uint32(os.Getuid())
 
 	// Fetch and filter processes
-	processes, err := GetUserProcesses(currentUID)
+	processes, err := GetUserProcesses(provider, currentUID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get processes: %w", err)
 	}
@@ -99,7 +112,7 @@ func matchesSearch(text, query string) bool {
 }
 
 // HandleBulkSignal sends a signal to multiple processes (POST only)
-func HandleBulkSignal(ctx context.Context, r *http.Request) ([]byte, error) {
+func HandleBulkSignal(provider Provider, ctx context.Context, r *http.Request) ([]byte, error) {
 	if r.Method != http.MethodPost {
 		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
 	}
@@ -133,7 +146,7 @@ func HandleBulkSignal(ctx context.Context, r *http.Request) ([]byte, error) {
 			continue
 		}
 
-		err = SendSignalToProcess(int32(pid), signalNum, currentUID)
+		err = SendSignalToProcess(provider, int32(pid), signalNum, currentUID)
 		if err != nil {
 			lastErr = err
 			continue
@@ -164,9 +177,8 @@ func HandleBulkSignal(ctx context.Context, r *http.Request) ([]byte, error) {
 	</div>`, signalName, count)), nil
 }
 
-
 // HandleProcessDetail renders the process detail page
-func HandleProcessDetail(tmpl *template.Template, ctx context.Context, r *http.Request, basePath string, pidStr string) ([]byte, error) {
+func HandleProcessDetail(provider Provider, tmpl *template.Template, ctx context.Context, r *http.Request, basePath string, pidStr string) ([]byte, error) {
 	pid, err := strconv.ParseInt(pidStr, 10, 32)
 	if err != nil {
 		return nil, httperror.HTTPError{StatusCode: http.StatusBadRequest, Message: "Invalid PID"}
@@ -174,7 +186,7 @@ func HandleProcessDetail(tmpl *template.Template, ctx context.Context, r *http.R
 
 	// Get process detail with ownership verification
 	currentUID := uint32(os.Getuid())
-	detail, err := GetProcessDetailForUser(int32(pid), currentUID)
+	detail, err := GetProcessDetailForUser(provider, int32(pid), currentUID)
 	if err != nil {
 		if strings.Contains(err.Error(), "permission denied") {
 			return nil, httperror.HTTPError{StatusCode: http.StatusForbidden, Message: "Cannot view process owned by another user"}
@@ -195,7 +207,7 @@ func HandleProcessDetail(tmpl *template.Template, ctx context.Context, r *http.R
 }
 
 // HandleSendSignal sends a signal to a process (POST only)
-func HandleSendSignal(ctx context.Context, r *http.Request, pidStr string) ([]byte, error) {
+func HandleSendSignal(provider Provider, ctx context.Context, r *http.Request, pidStr string) ([]byte, error) {
 	if r.Method != http.MethodPost {
 		return nil, httperror.HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "Method not allowed"}
 	}
@@ -216,7 +228,7 @@ func HandleSendSignal(ctx context.Context, r *http.Request, pidStr string) ([]by
 
 	// Send signal with ownership verification
 	currentUID := uint32(os.Getuid())
-	err = SendSignalToProcess(int32(pid), signalNum, currentUID)
+	err = SendSignalToProcess(provider, int32(pid), signalNum, currentUID)
 	if err != nil {
 		if strings.Contains(err.Error(), "process has exited") || strings.Contains(err.Error(), "process not found") {
 			return []byte(`<div class="alert alert-warning">Process has already exited</div>`), nil
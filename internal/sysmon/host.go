@@ -0,0 +1,209 @@
+package sysmon
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// HostProvider is the source of the host-level metrics of sysmon. GopsutilHostProvider is
+// the default, tests use a fake.
+type HostProvider interface {
+	LoadAvg() (*load.AvgStat, error)
+	// CPUPercent returns the usage of all CPUs since the previous call.
+	CPUPercent() (float64, error)
+	CPUCount() (int, error)
+	VirtualMemory() (*mem.VirtualMemoryStat, error)
+	SwapMemory() (*mem.SwapMemoryStat, error)
+	// Partitions returns the mounted file systems of physical devices.
+	Partitions() ([]disk.PartitionStat, error)
+	DiskUsage(path string) (*disk.UsageStat, error)
+	// NetIOCounters returns the cumulative counters of each network interface.
+	NetIOCounters() ([]net.IOCountersStat, error)
+}
+
+// GopsutilHostProvider collects host metrics with gopsutil.
+type GopsutilHostProvider struct{}
+
+var _ HostProvider = GopsutilHostProvider{}
+
+func (GopsutilHostProvider) LoadAvg() (*load.AvgStat, error) { return load.Avg() }
+
+func (GopsutilHostProvider) CPUPercent() (float64, error) {
+	percent, err := cpu.Percent(0, false)
+	if err != nil {
+		return 0, err
+	}
+	if len(percent) == 0 {
+		return 0, nil
+	}
+	return percent[0], nil
+}
+
+func (GopsutilHostProvider) CPUCount() (int, error) { return cpu.Counts(true) }
+
+func (GopsutilHostProvider) VirtualMemory() (*mem.VirtualMemoryStat, error) {
+	return mem.VirtualMemory()
+}
+
+func (GopsutilHostProvider) SwapMemory() (*mem.SwapMemoryStat, error) { return mem.SwapMemory() }
+
+func (GopsutilHostProvider) Partitions() ([]disk.PartitionStat, error) {
+	return disk.Partitions(false)
+}
+
+func (GopsutilHostProvider) DiskUsage(path string) (*disk.UsageStat, error) {
+	return disk.Usage(path)
+}
+
+func (GopsutilHostProvider) NetIOCounters() ([]net.IOCountersStat, error) {
+	return net.IOCounters(true)
+}
+
+// HostMetrics is the overview of the resources of the host. Metrics which are not available on
+// the platform are nil or empty.
+type HostMetrics struct {
+	Load       *load.AvgStat
+	CPUPercent float64
+	CPUCount   int
+	Memory     *MemoryUsage
+	Swap       *MemoryUsage // nil if there is no swap
+	Disks      []DiskUsage
+	Network    []NetworkRate
+}
+
+// MemoryUsage is the usage of the memory or the swap space, in bytes.
+type MemoryUsage struct {
+	Total   int64
+	Used    int64
+	Percent float64
+}
+
+// DiskUsage is the usage of a mounted file system, in bytes.
+type DiskUsage struct {
+	Mountpoint string
+	Device     string
+	Fstype     string
+	Total      int64
+	Used       int64
+	Percent    float64
+}
+
+// NetworkRate is the throughput of a network interface since the previous collection.
+type NetworkRate struct {
+	Name       string
+	RecvPerSec int64 // Bytes per second
+	SentPerSec int64
+	RatesKnown bool // false for the first collection, there is nothing to compare with
+	RecvTotal  int64
+	SentTotal  int64
+}
+
+// HostMonitor collects the host metrics. It keeps the network counters of the previous
+// collection to compute the throughput.
+type HostMonitor struct {
+	provider HostProvider
+
+	mu          sync.Mutex
+	lastNet     map[string]net.IOCountersStat
+	lastNetTime time.Time
+}
+
+// NewHostMonitor returns a HostMonitor which collects the metrics with provider.
+func NewHostMonitor(provider HostProvider) *HostMonitor {
+	return &HostMonitor{provider: provider}
+}
+
+// Collect returns the current host metrics. Errors of single metrics are ignored, the metric
+// is missing then.
+func (m *HostMonitor) Collect() *HostMetrics {
+	h := &HostMetrics{}
+	if avg, err := m.provider.LoadAvg(); err == nil {
+		h.Load = avg
+	}
+	if percent, err := m.provider.CPUPercent(); err == nil {
+		h.CPUPercent = percent
+	}
+	if count, err := m.provider.CPUCount(); err == nil {
+		h.CPUCount = count
+	}
+	if vm, err := m.provider.VirtualMemory(); err == nil {
+		h.Memory = &MemoryUsage{Total: int64(vm.Total), Used: int64(vm.Used), Percent: vm.UsedPercent}
+	}
+	if swap, err := m.provider.SwapMemory(); err == nil && swap.Total > 0 {
+		h.Swap = &MemoryUsage{Total: int64(swap.Total), Used: int64(swap.Used), Percent: swap.UsedPercent}
+	}
+	h.Disks = m.disks()
+	h.Network = m.network(time.Now())
+	return h
+}
+
+// disks returns the usage of the mounted file systems. Bind mounts of a device which was
+// already listed are skipped.
+func (m *HostMonitor) disks() []DiskUsage {
+	partitions, err := m.provider.Partitions()
+	if err != nil {
+		return nil
+	}
+	var disks []DiskUsage
+	seen := map[string]bool{}
+	for _, p := range partitions {
+		if seen[p.Device] {
+			continue
+		}
+		usage, err := m.provider.DiskUsage(p.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+		seen[p.Device] = true
+		disks = append(disks, DiskUsage{
+			Mountpoint: p.Mountpoint,
+			Device:     p.Device,
+			Fstype:     p.Fstype,
+			Total:      int64(usage.Total),
+			Used:       int64(usage.Used),
+			Percent:    usage.UsedPercent,
+		})
+	}
+	sort.Slice(disks, func(i, j int) bool { return disks[i].Mountpoint < disks[j].Mountpoint })
+	return disks
+}
+
+// network returns the throughput of the network interfaces since the previous call. The
+// loopback interface is skipped.
+func (m *HostMonitor) network(now time.Time) []NetworkRate {
+	counters, err := m.provider.NetIOCounters()
+	if err != nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elapsed := now.Sub(m.lastNetTime).Seconds()
+	current := make(map[string]net.IOCountersStat, len(counters))
+	var rates []NetworkRate
+	for _, c := range counters {
+		current[c.Name] = c
+		if c.Name == "lo" || strings.HasPrefix(c.Name, "lo0") {
+			continue
+		}
+		rate := NetworkRate{Name: c.Name, RecvTotal: int64(c.BytesRecv), SentTotal: int64(c.BytesSent)}
+		// Counters which went back were reset, for example because the interface was re-created
+		if last, ok := m.lastNet[c.Name]; ok && elapsed > 0 && c.BytesRecv >= last.BytesRecv && c.BytesSent >= last.BytesSent {
+			rate.RecvPerSec = int64(float64(c.BytesRecv-last.BytesRecv) / elapsed)
+			rate.SentPerSec = int64(float64(c.BytesSent-last.BytesSent) / elapsed)
+			rate.RatesKnown = true
+		}
+		rates = append(rates, rate)
+	}
+	m.lastNet = current
+	m.lastNetTime = now
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Name < rates[j].Name })
+	return rates
+}
@@ -0,0 +1,78 @@
+package sysmon
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHostProvider returns fixed metrics. The network counters get changed by the tests.
+type fakeHostProvider struct {
+	net []net.IOCountersStat
+}
+
+func (f *fakeHostProvider) LoadAvg() (*load.AvgStat, error) {
+	return &load.AvgStat{Load1: 1.5, Load5: 1, Load15: 0.5}, nil
+}
+func (f *fakeHostProvider) CPUPercent() (float64, error) { return 25, nil }
+func (f *fakeHostProvider) CPUCount() (int, error)       { return 4, nil }
+func (f *fakeHostProvider) VirtualMemory() (*mem.VirtualMemoryStat, error) {
+	return &mem.VirtualMemoryStat{Total: 4 << 30, Used: 1 << 30, UsedPercent: 25}, nil
+}
+func (f *fakeHostProvider) SwapMemory() (*mem.SwapMemoryStat, error) {
+	return &mem.SwapMemoryStat{}, nil
+}
+func (f *fakeHostProvider) Partitions() ([]disk.PartitionStat, error) {
+	return []disk.PartitionStat{
+		{Device: "/dev/sda2", Mountpoint: "/var", Fstype: "ext4"},
+		{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+		{Device: "/dev/sda1", Mountpoint: "/mnt/bind", Fstype: "ext4"},
+		{Device: "/dev/sr0", Mountpoint: "/media/cdrom", Fstype: "iso9660"},
+	}, nil
+}
+func (f *fakeHostProvider) DiskUsage(path string) (*disk.UsageStat, error) {
+	if path == "/media/cdrom" {
+		return nil, errors.New("no medium")
+	}
+	return &disk.UsageStat{Path: path, Total: 100 << 30, Used: 60 << 30, UsedPercent: 60}, nil
+}
+func (f *fakeHostProvider) NetIOCounters() ([]net.IOCountersStat, error) { return f.net, nil }
+
+func TestHostMonitorCollect(t *testing.T) {
+	t.Parallel()
+	provider := &fakeHostProvider{net: []net.IOCountersStat{{Name: "lo", BytesRecv: 1}, {Name: "eth0", BytesRecv: 1000, BytesSent: 500}}}
+	monitor := NewHostMonitor(provider)
+
+	h := monitor.Collect()
+	require.InDelta(t, 1.5, h.Load.Load1, 0.001)
+	require.InDelta(t, 25.0, h.CPUPercent, 0.001)
+	require.Equal(t, 4, h.CPUCount)
+	require.Equal(t, &MemoryUsage{Total: 4 << 30, Used: 1 << 30, Percent: 25}, h.Memory)
+	require.Nil(t, h.Swap)
+	require.Len(t, h.Disks, 2)
+	require.Equal(t, "/", h.Disks[0].Mountpoint)
+	require.Equal(t, "/var", h.Disks[1].Mountpoint)
+	require.Equal(t, []NetworkRate{{Name: "eth0", RecvTotal: 1000, SentTotal: 500}}, h.Network)
+}
+
+func TestHostMonitorNetworkRates(t *testing.T) {
+	t.Parallel()
+	provider := &fakeHostProvider{net: []net.IOCountersStat{{Name: "eth0", BytesRecv: 1000, BytesSent: 500}}}
+	monitor := NewHostMonitor(provider)
+	start := time.Date(2025, 1, 7, 10, 0, 0, 0, time.UTC)
+	require.False(t, monitor.network(start)[0].RatesKnown)
+
+	provider.net = []net.IOCountersStat{{Name: "eth0", BytesRecv: 21000, BytesSent: 2500}}
+	rates := monitor.network(start.Add(2 * time.Second))
+	require.Equal(t, NetworkRate{Name: "eth0", RecvPerSec: 10000, SentPerSec: 1000, RatesKnown: true, RecvTotal: 21000, SentTotal: 2500}, rates[0])
+
+	// The counters were reset
+	provider.net = []net.IOCountersStat{{Name: "eth0", BytesRecv: 10}}
+	require.False(t, monitor.network(start.Add(4 * time.Second))[0].RatesKnown)
+}
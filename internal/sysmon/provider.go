@@ -0,0 +1,75 @@
+package sysmon
+
+import (
+	"syscall"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// Provider is the source of all process data of sysmon. GopsutilProvider is the default.
+// Alternative providers (reading /proc directly, remote agents) and test fakes implement
+// this interface.
+type Provider interface {
+	// Pids returns the PIDs of all processes.
+	Pids() ([]int32, error)
+	// Process returns the process with the given PID, or an error if it does not exist.
+	Process(pid int32) (ProcessSource, error)
+}
+
+// ProcessMetrics is the part of a process which is shown in the process list.
+type ProcessMetrics interface {
+	Name() (string, error)
+	Cmdline() (string, error)
+	Username() (string, error)
+	CPUPercent() (float64, error)
+	MemoryInfo() (*process.MemoryInfoStat, error)
+	MemoryPercent() (float32, error)
+	IOCounters() (*process.IOCountersStat, error)
+	CreateTime() (int64, error)
+	Status() ([]string, error)
+	Ppid() (int32, error)
+	NumThreads() (int32, error)
+}
+
+// ProcessSource provides all data of a single process, and sends signals to it.
+type ProcessSource interface {
+	ProcessMetrics
+	Uids() ([]int32, error)
+	Times() (*cpu.TimesStat, error)
+	ChildPids() ([]int32, error)
+	SendSignal(sig syscall.Signal) error
+}
+
+// GopsutilProvider collects process data with gopsutil.
+type GopsutilProvider struct{}
+
+var _ Provider = GopsutilProvider{}
+
+func (GopsutilProvider) Pids() ([]int32, error) {
+	return process.Pids()
+}
+
+func (GopsutilProvider) Process(pid int32) (ProcessSource, error) {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	return gopsutilProcess{p}, nil
+}
+
+type gopsutilProcess struct {
+	*process.Process
+}
+
+func (g gopsutilProcess) ChildPids() ([]int32, error) {
+	children, err := g.Children()
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]int32, 0, len(children))
+	for _, child := range children {
+		pids = append(pids, child.Pid)
+	}
+	return pids, nil
+}
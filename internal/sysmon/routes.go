@@ -6,10 +6,13 @@ import (
 	"net/http"
 )
 
-// RegisterRoutes registers all sysmon routes on the provided mux
+// RegisterRoutes registers all sysmon routes on the provided mux. All process data is
+// collected through provider, the host metrics through hostMonitor.
 func RegisterRoutes(
 	mux *http.ServeMux,
 	tmpl *template.Template,
+	provider Provider,
+	hostMonitor *HostMonitor,
 	getBasePath func(*http.Request) string,
 	authMiddleware func(http.HandlerFunc) http.HandlerFunc,
 	wrapHandler func(func(context.Context, *http.Request) ([]byte, error)) http.HandlerFunc,
@@ -18,19 +21,23 @@ func RegisterRoutes(
 		return HandleSysmon(tmpl, ctx, r, getBasePath(r))
 	})))
 
+	mux.HandleFunc("/sysmon/hx-host", authMiddleware(wrapHandler(func(ctx context.Context, r *http.Request) ([]byte, error) {
+		return HandleHostOverview(hostMonitor, tmpl, ctx, r, getBasePath(r))
+	})))
+
 	mux.HandleFunc("/sysmon/hx-processes", authMiddleware(wrapHandler(func(ctx context.Context, r *http.Request) ([]byte, error) {
-		return HandleProcessList(tmpl, ctx, r, getBasePath(r))
+		return HandleProcessList(provider, tmpl, ctx, r, getBasePath(r))
 	})))
 
 	mux.HandleFunc("/sysmon/process/{pid}", authMiddleware(wrapHandler(func(ctx context.Context, r *http.Request) ([]byte, error) {
-		return HandleProcessDetail(tmpl, ctx, r, getBasePath(r), r.PathValue("pid"))
+		return HandleProcessDetail(provider, tmpl, ctx, r, getBasePath(r), r.PathValue("pid"))
 	})))
 
 	mux.HandleFunc("/sysmon/process/{pid}/hx-signal", authMiddleware(wrapHandler(func(ctx context.Context, r *http.Request) ([]byte, error) {
-		return HandleSendSignal(ctx, r, r.PathValue("pid"))
+		return HandleSendSignal(provider, ctx, r, r.PathValue("pid"))
 	})))
 
 	mux.HandleFunc("/sysmon/hx-bulk-signal", authMiddleware(wrapHandler(func(ctx context.Context, r *http.Request) ([]byte, error) {
-		return HandleBulkSignal(ctx, r)
+		return HandleBulkSignal(provider, ctx, r)
 	})))
 }
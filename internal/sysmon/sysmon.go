@@ -6,25 +6,28 @@ import (
 	"strings"
 	"syscall"
 	"time"
-
-	"github.com/shirou/gopsutil/v3/process"
 )
 
 // ProcessInfo represents a system process with metrics
 type ProcessInfo struct {
-	PID            int32
-	Name           string
-	Cmdline        string
-	Username       string
-	CPUPercent     float64
-	MemoryMB       float64 // RSS in MB
-	MemoryPercent  float32
-	IOReadMB       float64 // Cumulative
-	IOWriteMB      float64 // Cumulative
-	CreateTime     time.Time
-	Status         string
-	PPID           int32
-	NumThreads     int32
+	PID           int32
+	Name          string
+	Cmdline       string
+	Username      string
+	CPUPercent    float64
+	MemoryMB      float64 // RSS in MB
+	MemoryPercent float32
+	IOReadMB      float64 // Cumulative
+	IOWriteMB     float64 // Cumulative
+	CreateTime    time.Time
+	Status        string
+	PPID          int32
+	NumThreads    int32
+
+	// Metrics which are not implemented on this platform (for example I/O counters on macOS)
+	CPUUnsupported    bool
+	MemoryUnsupported bool
+	IOUnsupported     bool
 }
 
 // ProcessDetail extends ProcessInfo with additional details
@@ -32,7 +35,7 @@ type ProcessDetail struct {
 	ProcessInfo
 	CPUTimesUser   float64
 	CPUTimesSystem float64
-	ParentInfo     *ProcessInfo  // nil if parent not accessible
+	ParentInfo     *ProcessInfo // nil if parent not accessible
 	ChildrenInfo   []*ProcessInfo
 }
 
@@ -56,14 +59,20 @@ const (
 )
 
 // GetUserProcesses returns all processes owned by the specified UID
-func GetUserProcesses(uid uint32) ([]*ProcessInfo, error) {
-	procs, err := process.Processes()
+func GetUserProcesses(provider Provider, uid uint32) ([]*ProcessInfo, error) {
+	pids, err := provider.Pids()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get processes: %w", err)
 	}
 
 	var userProcesses []*ProcessInfo
-	for _, p := range procs {
+	for _, pid := range pids {
+		// Processes may exit while iterating
+		p, err := provider.Process(pid)
+		if err != nil {
+			continue
+		}
+
 		// Check if process belongs to the user
 		uids, err := p.Uids()
 		if err != nil || len(uids) == 0 || uint32(uids[0]) != uid {
@@ -71,7 +80,7 @@ func GetUserProcesses(uid uint32) ([]*ProcessInfo, error) {
 		}
 
 		// Fetch process info
-		info := fetchProcessInfo(p)
+		info := fetchProcessInfo(pid, p)
 		if info != nil {
 			userProcesses = append(userProcesses, info)
 		}
@@ -80,10 +89,16 @@ func GetUserProcesses(uid uint32) ([]*ProcessInfo, error) {
 	return userProcesses, nil
 }
 
+// isUnsupported returns true if gopsutil does not implement a metric on this platform. The
+// error variable lives in an internal package of gopsutil, so only the message can be compared.
+func isUnsupported(err error) bool {
+	return err != nil && err.Error() == "not implemented yet"
+}
+
 // fetchProcessInfo retrieves detailed information for a single process
-func fetchProcessInfo(p *process.Process) *ProcessInfo {
+func fetchProcessInfo(pid int32, p ProcessMetrics) *ProcessInfo {
 	info := &ProcessInfo{
-		PID: p.Pid,
+		PID: pid,
 	}
 
 	// Get name (may fail for short-lived processes)
@@ -102,14 +117,18 @@ func fetchProcessInfo(p *process.Process) *ProcessInfo {
 	}
 
 	// Get CPU percent (may fail)
-	if cpuPercent, err := p.CPUPercent(); err == nil {
+	cpuPercent, err := p.CPUPercent()
+	if err == nil {
 		info.CPUPercent = cpuPercent
 	}
+	info.CPUUnsupported = isUnsupported(err)
 
 	// Get memory info
-	if memInfo, err := p.MemoryInfo(); err == nil {
+	memInfo, err := p.MemoryInfo()
+	if err == nil {
 		info.MemoryMB = float64(memInfo.RSS) / 1024 / 1024 // Convert bytes to MB
 	}
+	info.MemoryUnsupported = isUnsupported(err)
 
 	// Get memory percent
 	if memPercent, err := p.MemoryPercent(); err == nil {
@@ -117,10 +136,12 @@ func fetchProcessInfo(p *process.Process) *ProcessInfo {
 	}
 
 	// Get IO counters
-	if ioCounters, err := p.IOCounters(); err == nil {
+	ioCounters, err := p.IOCounters()
+	if err == nil {
 		info.IOReadMB = float64(ioCounters.ReadBytes) / 1024 / 1024
 		info.IOWriteMB = float64(ioCounters.WriteBytes) / 1024 / 1024
 	}
+	info.IOUnsupported = isUnsupported(err)
 
 	// Get create time
 	if createTime, err := p.CreateTime(); err == nil {
@@ -148,14 +169,14 @@ func fetchProcessInfo(p *process.Process) *ProcessInfo {
 }
 
 // GetProcessDetail retrieves detailed information for a specific process
-func GetProcessDetail(pid int32) (*ProcessDetail, error) {
-	p, err := process.NewProcess(pid)
+func GetProcessDetail(provider Provider, pid int32) (*ProcessDetail, error) {
+	p, err := provider.Process(pid)
 	if err != nil {
 		return nil, fmt.Errorf("process not found: %w", err)
 	}
 
 	// Fetch basic info
-	basicInfo := fetchProcessInfo(p)
+	basicInfo := fetchProcessInfo(pid, p)
 	if basicInfo == nil {
 		return nil, fmt.Errorf("failed to fetch process info")
 	}
@@ -172,9 +193,9 @@ func GetProcessDetail(pid int32) (*ProcessDetail, error) {
 
 	// Get parent process info
 	if basicInfo.PPID > 0 {
-		parent, err := process.NewProcess(basicInfo.PPID)
+		parent, err := provider.Process(basicInfo.PPID)
 		if err == nil {
-			parentInfo := fetchProcessInfo(parent)
+			parentInfo := fetchProcessInfo(basicInfo.PPID, parent)
 			if parentInfo != nil {
 				detail.ParentInfo = parentInfo
 			}
@@ -182,10 +203,14 @@ func GetProcessDetail(pid int32) (*ProcessDetail, error) {
 	}
 
 	// Get children processes
-	children, err := p.Children()
+	childPids, err := p.ChildPids()
 	if err == nil {
-		for _, child := range children {
-			childInfo := fetchProcessInfo(child)
+		for _, childPid := range childPids {
+			child, err := provider.Process(childPid)
+			if err != nil {
+				continue
+			}
+			childInfo := fetchProcessInfo(childPid, child)
 			if childInfo != nil {
 				detail.ChildrenInfo = append(detail.ChildrenInfo, childInfo)
 			}
@@ -195,6 +220,27 @@ func GetProcessDetail(pid int32) (*ProcessDetail, error) {
 	return detail, nil
 }
 
+// Summary aggregates the metrics of a process list
+type Summary struct {
+	Count      int
+	CPUPercent float64
+	MemoryMB   float64
+	Top        []*ProcessInfo // Processes with the highest CPU usage
+}
+
+// Summarize returns the totals of the processes and the top processes by CPU usage. The
+// processes get sorted by CPU usage.
+func Summarize(processes []*ProcessInfo, top int) Summary {
+	summary := Summary{Count: len(processes)}
+	for _, p := range processes {
+		summary.CPUPercent += p.CPUPercent
+		summary.MemoryMB += p.MemoryMB
+	}
+	SortProcesses(processes, SortByCPU, SortDesc)
+	summary.Top = processes[:min(top, len(processes))]
+	return summary
+}
+
 // SortProcesses sorts the process list by the specified column and order
 func SortProcesses(processes []*ProcessInfo, column SortColumn, order SortOrder) {
 	sort.Slice(processes, func(i, j int) bool {
@@ -227,8 +273,8 @@ func SortProcesses(processes []*ProcessInfo, column SortColumn, order SortOrder)
 }
 
 // VerifyProcessOwnership checks if a process belongs to the specified user
-func VerifyProcessOwnership(pid int32, uid uint32) error {
-	p, err := process.NewProcess(pid)
+func VerifyProcessOwnership(provider Provider, pid int32, uid uint32) error {
+	p, err := provider.Process(pid)
 	if err != nil {
 		return fmt.Errorf("process not found: %w", err)
 	}
@@ -246,15 +292,15 @@ func VerifyProcessOwnership(pid int32, uid uint32) error {
 }
 
 // GetProcessDetailForUser retrieves detailed information for a process and verifies ownership
-func GetProcessDetailForUser(pid int32, uid uint32) (*ProcessDetail, error) {
+func GetProcessDetailForUser(provider Provider, pid int32, uid uint32) (*ProcessDetail, error) {
 	// Get process detail
-	detail, err := GetProcessDetail(pid)
+	detail, err := GetProcessDetail(provider, pid)
 	if err != nil {
 		return nil, err
 	}
 
 	// Verify ownership
-	if err := VerifyProcessOwnership(pid, uid); err != nil {
+	if err := VerifyProcessOwnership(provider, pid, uid); err != nil {
 		return nil, fmt.Errorf("permission denied: %w", err)
 	}
 
@@ -262,20 +308,20 @@ func GetProcessDetailForUser(pid int32, uid uint32) (*ProcessDetail, error) {
 }
 
 // SendSignalToProcess sends a signal to a process after verifying ownership
-func SendSignalToProcess(pid int32, signal int, uid uint32) error {
+func SendSignalToProcess(provider Provider, pid int32, signal int, uid uint32) error {
 	// Validate signal
 	if err := ValidateSignal(signal); err != nil {
 		return err
 	}
 
 	// Get process
-	p, err := process.NewProcess(pid)
+	p, err := provider.Process(pid)
 	if err != nil {
 		return fmt.Errorf("process not found: %w", err)
 	}
 
 	// Verify ownership
-	if err := VerifyProcessOwnership(pid, uid); err != nil {
+	if err := VerifyProcessOwnership(provider, pid, uid); err != nil {
 		return err
 	}
 
@@ -1,16 +1,22 @@
 package sysmon
 
 import (
+	"errors"
+	"maps"
 	"os"
+	"slices"
+	"syscall"
 	"testing"
 
+	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/process"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetUserProcesses(t *testing.T) {
 	t.Parallel()
 	currentUID := uint32(os.Getuid())
-	processes, err := GetUserProcesses(currentUID)
+	processes, err := GetUserProcesses(GopsutilProvider{}, currentUID)
 	if err != nil {
 		t.Fatalf("GetUserProcesses failed: %v", err)
 	}
@@ -118,7 +124,7 @@ func TestGetProcessDetail(t *testing.T) {
 	t.Parallel()
 	// Use current process (guaranteed to exist)
 	pid := int32(os.Getpid())
-	detail, err := GetProcessDetail(pid)
+	detail, err := GetProcessDetail(GopsutilProvider{}, pid)
 	if err != nil {
 		t.Fatalf("GetProcessDetail failed: %v", err)
 	}
@@ -138,7 +144,7 @@ func TestGetProcessDetailNonExistent(t *testing.T) {
 	t.Parallel()
 	// Use a PID that's unlikely to exist
 	pid := int32(999999)
-	_, err := GetProcessDetail(pid)
+	_, err := GetProcessDetail(GopsutilProvider{}, pid)
 
 	if err == nil {
 		t.Error("Expected error for non-existent process, got nil")
@@ -212,19 +218,19 @@ func TestVerifyProcessOwnership(t *testing.T) {
 	currentPID := int32(os.Getpid())
 
 	// Test with current process (should succeed)
-	err := VerifyProcessOwnership(currentPID, currentUID)
+	err := VerifyProcessOwnership(GopsutilProvider{}, currentPID, currentUID)
 	if err != nil {
 		t.Errorf("VerifyProcessOwnership failed for current process: %v", err)
 	}
 
 	// Test with wrong UID (should fail)
-	err = VerifyProcessOwnership(currentPID, currentUID+9999)
+	err = VerifyProcessOwnership(GopsutilProvider{}, currentPID, currentUID+9999)
 	if err == nil {
 		t.Error("VerifyProcessOwnership should fail for wrong UID")
 	}
 
 	// Test with non-existent PID (should fail)
-	err = VerifyProcessOwnership(999999, currentUID)
+	err = VerifyProcessOwnership(GopsutilProvider{}, 999999, currentUID)
 	if err == nil {
 		t.Error("VerifyProcessOwnership should fail for non-existent PID")
 	}
@@ -236,7 +242,7 @@ func TestGetProcessDetailForUser(t *testing.T) {
 	currentPID := int32(os.Getpid())
 
 	// Test with current process (should succeed)
-	detail, err := GetProcessDetailForUser(currentPID, currentUID)
+	detail, err := GetProcessDetailForUser(GopsutilProvider{}, currentPID, currentUID)
 	if err != nil {
 		t.Fatalf("GetProcessDetailForUser failed: %v", err)
 	}
@@ -245,7 +251,7 @@ func TestGetProcessDetailForUser(t *testing.T) {
 	}
 
 	// Test with wrong UID (should fail)
-	_, err = GetProcessDetailForUser(currentPID, currentUID+9999)
+	_, err = GetProcessDetailForUser(GopsutilProvider{}, currentPID, currentUID+9999)
 	if err == nil {
 		t.Error("GetProcessDetailForUser should fail for wrong UID")
 	}
@@ -256,20 +262,179 @@ func TestSendSignalToProcess(t *testing.T) {
 	currentUID := uint32(os.Getuid())
 
 	// Test with invalid signal (should fail)
-	err := SendSignalToProcess(int32(os.Getpid()), 999, currentUID)
+	err := SendSignalToProcess(GopsutilProvider{}, int32(os.Getpid()), 999, currentUID)
 	if err == nil {
 		t.Error("SendSignalToProcess should fail for invalid signal")
 	}
 
 	// Test with non-existent PID (should fail)
-	err = SendSignalToProcess(999999, 15, currentUID)
+	err = SendSignalToProcess(GopsutilProvider{}, 999999, 15, currentUID)
 	if err == nil {
 		t.Error("SendSignalToProcess should fail for non-existent PID")
 	}
 
 	// Test with wrong UID (should fail)
-	err = SendSignalToProcess(int32(os.Getpid()), 0, currentUID+9999)
+	err = SendSignalToProcess(GopsutilProvider{}, int32(os.Getpid()), 0, currentUID+9999)
 	if err == nil {
 		t.Error("SendSignalToProcess should fail for wrong UID")
 	}
 }
+
+// fakeProcessMetrics simulates a process on a platform where some metrics are not implemented.
+type fakeProcessMetrics struct {
+	unsupported error
+}
+
+func (f fakeProcessMetrics) Name() (string, error)        { return "fake", nil }
+func (f fakeProcessMetrics) Cmdline() (string, error)     { return "fake --flag", nil }
+func (f fakeProcessMetrics) Username() (string, error)    { return "user", nil }
+func (f fakeProcessMetrics) CPUPercent() (float64, error) { return 12.5, nil }
+func (f fakeProcessMetrics) MemoryInfo() (*process.MemoryInfoStat, error) {
+	return &process.MemoryInfoStat{RSS: 2 * 1024 * 1024}, nil
+}
+func (f fakeProcessMetrics) MemoryPercent() (float32, error) { return 1.5, nil }
+func (f fakeProcessMetrics) IOCounters() (*process.IOCountersStat, error) {
+	if f.unsupported != nil {
+		return nil, f.unsupported
+	}
+	return &process.IOCountersStat{ReadBytes: 1024 * 1024, WriteBytes: 3 * 1024 * 1024}, nil
+}
+func (f fakeProcessMetrics) CreateTime() (int64, error) { return 1700000000000, nil }
+func (f fakeProcessMetrics) Status() ([]string, error)  { return []string{"S"}, nil }
+func (f fakeProcessMetrics) Ppid() (int32, error)       { return 1, nil }
+func (f fakeProcessMetrics) NumThreads() (int32, error) { return 4, nil }
+
+func TestFetchProcessInfo_AllMetricsSupported(t *testing.T) {
+	t.Parallel()
+	info := fetchProcessInfo(42, fakeProcessMetrics{})
+
+	require.Equal(t, int32(42), info.PID)
+	require.Equal(t, "fake", info.Name)
+	require.InDelta(t, 12.5, info.CPUPercent, 0.001)
+	require.InDelta(t, 2.0, info.MemoryMB, 0.001)
+	require.InDelta(t, 1.0, info.IOReadMB, 0.001)
+	require.InDelta(t, 3.0, info.IOWriteMB, 0.001)
+	require.False(t, info.CPUUnsupported)
+	require.False(t, info.MemoryUnsupported)
+	require.False(t, info.IOUnsupported)
+}
+
+func TestFetchProcessInfo_IOUnsupported(t *testing.T) {
+	t.Parallel()
+	// gopsutil returns this error on macOS for IOCounters
+	info := fetchProcessInfo(42, fakeProcessMetrics{unsupported: errors.New("not implemented yet")})
+
+	require.True(t, info.IOUnsupported)
+	require.Zero(t, info.IOReadMB)
+	require.False(t, info.CPUUnsupported)
+	require.InDelta(t, 12.5, info.CPUPercent, 0.001)
+}
+
+func TestFetchProcessInfo_IOFailedButSupported(t *testing.T) {
+	t.Parallel()
+	// Permission errors are not "unsupported", the value is just unknown
+	info := fetchProcessInfo(42, fakeProcessMetrics{unsupported: errors.New("permission denied")})
+
+	require.False(t, info.IOUnsupported)
+	require.Zero(t, info.IOReadMB)
+}
+
+func TestGetAllSignals_SortedByNumber(t *testing.T) {
+	t.Parallel()
+	signals := GetAllSignals()
+	numbers := make([]int, 0, len(signals))
+	for _, sig := range signals {
+		numbers = append(numbers, sig.Number)
+	}
+	require.IsIncreasing(t, numbers)
+}
+
+type fakeProcess struct {
+	fakeProcessMetrics
+	uid      int32
+	children []int32
+	signals  *[]syscall.Signal
+}
+
+func (f fakeProcess) Uids() ([]int32, error) { return []int32{f.uid}, nil }
+func (f fakeProcess) Times() (*cpu.TimesStat, error) {
+	return &cpu.TimesStat{User: 1.5, System: 0.5}, nil
+}
+func (f fakeProcess) ChildPids() ([]int32, error) { return f.children, nil }
+func (f fakeProcess) SendSignal(sig syscall.Signal) error {
+	*f.signals = append(*f.signals, sig)
+	return nil
+}
+
+// fakeProvider maps PIDs to processes. Unknown PIDs do not exist.
+type fakeProvider map[int32]fakeProcess
+
+func (f fakeProvider) Pids() ([]int32, error) {
+	return slices.Sorted(maps.Keys(f)), nil
+}
+
+func (f fakeProvider) Process(pid int32) (ProcessSource, error) {
+	p, ok := f[pid]
+	if !ok {
+		return nil, errors.New("process does not exist")
+	}
+	return p, nil
+}
+
+func TestGetUserProcesses_FakeProvider(t *testing.T) {
+	t.Parallel()
+	provider := fakeProvider{1: {uid: 0}, 42: {uid: 1000}, 43: {uid: 1000}}
+
+	processes, err := GetUserProcesses(provider, 1000)
+	require.NoError(t, err)
+	require.Len(t, processes, 2)
+	require.Equal(t, int32(42), processes[0].PID)
+	require.Equal(t, "fake", processes[0].Name)
+}
+
+func TestGetProcessDetail_FakeProvider(t *testing.T) {
+	t.Parallel()
+	// PID 99 exited after it was listed as child
+	provider := fakeProvider{1: {uid: 0}, 42: {uid: 1000, children: []int32{43, 99}}, 43: {uid: 1000}}
+
+	detail, err := GetProcessDetail(provider, 42)
+	require.NoError(t, err)
+	require.InDelta(t, 1.5, detail.CPUTimesUser, 0.001)
+	require.Equal(t, int32(1), detail.ParentInfo.PID)
+	require.Len(t, detail.ChildrenInfo, 1)
+	require.Equal(t, int32(43), detail.ChildrenInfo[0].PID)
+
+	_, err = GetProcessDetail(provider, 99)
+	require.Error(t, err)
+}
+
+func TestSendSignalToProcess_FakeProvider(t *testing.T) {
+	t.Parallel()
+	var signals []syscall.Signal
+	provider := fakeProvider{42: {uid: 1000, signals: &signals}}
+
+	require.NoError(t, SendSignalToProcess(provider, 42, 15, 1000))
+	require.Equal(t, []syscall.Signal{syscall.SIGTERM}, signals)
+
+	require.Error(t, SendSignalToProcess(provider, 42, 15, 1001))
+	require.Len(t, signals, 1)
+}
+
+func TestSummarize(t *testing.T) {
+	t.Parallel()
+	processes := []*ProcessInfo{
+		{PID: 1, CPUPercent: 10.0, MemoryMB: 100},
+		{PID: 2, CPUPercent: 50.0, MemoryMB: 20},
+		{PID: 3, CPUPercent: 5.0, MemoryMB: 1.5},
+	}
+
+	summary := Summarize(processes, 2)
+	require.Equal(t, 3, summary.Count)
+	require.InDelta(t, 65.0, summary.CPUPercent, 0.001)
+	require.InDelta(t, 121.5, summary.MemoryMB, 0.001)
+	require.Len(t, summary.Top, 2)
+	require.Equal(t, int32(2), summary.Top[0].PID)
+	require.Equal(t, int32(1), summary.Top[1].PID)
+
+	require.Empty(t, Summarize(nil, 2).Top)
+}
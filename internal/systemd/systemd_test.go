@@ -0,0 +1,62 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	ok, err := Notify("READY=1")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	ok, err = Notify("READY=1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "READY=1", string(buf[:n]))
+
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	_, err = Notify("READY=1")
+	require.ErrorContains(t, err, "failed to connect")
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	t.Setenv("WATCHDOG_PID", "")
+	require.Zero(t, WatchdogInterval())
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	require.Equal(t, 30*time.Second, WatchdogInterval())
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	require.Equal(t, 30*time.Second, WatchdogInterval())
+
+	// The watchdog is meant for another process
+	t.Setenv("WATCHDOG_PID", "1")
+	require.Zero(t, WatchdogInterval())
+}
+
+func TestListenersWithoutSocketActivation(t *testing.T) {
+	// For another process, the variables are ignored and unset
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	listeners, err := Listeners()
+	require.NoError(t, err)
+	require.Nil(t, listeners)
+	_, ok := os.LookupEnv("LISTEN_FDS")
+	require.False(t, ok)
+}
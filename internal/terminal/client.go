@@ -0,0 +1,231 @@
+package terminal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/gorilla/websocket"
+)
+
+// maxScrollback limits the output which a session keeps in memory for clients which attach
+// later. The whole output is in the recording, see Session.Record.
+const maxScrollback = 256 << 10
+
+// controlMessage is sent to clients as binary message, the output is sent as text messages.
+type controlMessage struct {
+	Type string `json:"type"` // "session": ID is the session, which can be attached on reconnect
+	ID   string `json:"id,omitempty"`
+}
+
+// client is a browser which is attached to a session.
+type client struct {
+	ws       *websocket.Conn
+	send     chan []byte
+	readOnly bool          // The input and the resizes of the client are ignored
+	done     chan struct{} // Closed when the client got detached
+	once     sync.Once
+}
+
+// Attach connects the browser ws to the session and serves it until it disconnects or the session
+// ends. The output of the session is sent to all clients, and the input of all clients which are
+// not readOnly is written to the session. A client gets the ID of the session (see
+// Manager.Add) and the scrollback first, so that a reconnecting browser shows the latest output.
+func (s *Session) Attach(ws *websocket.Conn, readOnly bool) {
+	c := &client{ws: ws, send: make(chan []byte, 100), readOnly: readOnly, done: make(chan struct{})}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = ws.Close()
+		return
+	}
+	s.clients[c] = struct{}{}
+	control, _ := json.Marshal(controlMessage{Type: "session", ID: s.id})
+	scrollback := slices.Clone(s.scrollback)
+	s.readers.Add(1)
+	s.mu.Unlock()
+	defer s.readers.Done()
+	defer s.detach(c)
+
+	if err := ws.WriteMessage(websocket.BinaryMessage, control); err != nil {
+		return
+	}
+	if len(scrollback) > 0 {
+		if err := ws.WriteMessage(websocket.TextMessage, scrollback); err != nil {
+			return
+		}
+	}
+	go s.writeToClient(c)
+	s.readFromClient(c)
+}
+
+// detach removes c from the session. A session without clients keeps running, so that a browser
+// can reconnect, until the Manager terminates it (see Policy).
+func (s *Session) detach(c *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, attached := s.clients[c]; !attached {
+		return
+	}
+	delete(s.clients, c)
+	c.once.Do(func() { close(c.done) })
+	_ = c.ws.Close()
+	s.lastActivity = time.Now()
+}
+
+// clientCount returns the number of attached clients.
+func (s *Session) clientCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// broadcast sends data to all clients. A client which can't keep up gets detached, so that it
+// doesn't block the others. If output is true, data is kept for clients which attach later.
+func (s *Session) broadcast(data []byte, output bool) {
+	var slow []*client
+	s.mu.Lock()
+	if output {
+		s.scrollback = appendScrollback(s.scrollback, data)
+		s.lastActivity = time.Now()
+	}
+	for c := range s.clients {
+		select {
+		case c.send <- data:
+		default:
+			slow = append(slow, c)
+		}
+	}
+	s.mu.Unlock()
+	for _, c := range slow {
+		slog.Warn("Detaching slow terminal client")
+		s.detach(c)
+	}
+}
+
+// appendScrollback appends data to scrollback and drops the oldest output beyond maxScrollback.
+// The kept output starts at a line, so that it doesn't start within an escape sequence.
+func appendScrollback(scrollback, data []byte) []byte {
+	scrollback = append(scrollback, data...)
+	if len(scrollback) <= maxScrollback {
+		return scrollback
+	}
+	kept := scrollback[len(scrollback)-maxScrollback:]
+	if i := bytes.IndexByte(kept, '\n'); i >= 0 {
+		kept = kept[i+1:]
+	}
+	return slices.Clone(kept)
+}
+
+// writeToClient handles all writes to the WebSocket of c through its channel
+func (s *Session) writeToClient(c *client) {
+	for {
+		select {
+		case data := <-c.send:
+			if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				slog.Error("Error writing to WebSocket", "error", err)
+				s.detach(c)
+				return
+			}
+		case <-c.done:
+			return
+		case <-s.done:
+			// Send what is left, for example the exit notification
+			for {
+				select {
+				case data := <-c.send:
+					if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// readFromClient reads messages from the WebSocket of c and processes them
+func (s *Session) readFromClient(c *client) {
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				slog.Error("WebSocket read error", "error", err)
+			}
+			return
+		}
+		if c.readOnly {
+			continue
+		}
+
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			// If it's not JSON, treat it as raw input
+			msg = Message{Type: "input", Data: string(data)}
+		}
+
+		switch msg.Type {
+		case "input":
+			if !s.writeInput(msg.Data) {
+				return
+			}
+
+		case "keys":
+			var input strings.Builder
+			for _, name := range msg.Keys {
+				seq, err := KeySequence(name)
+				if err != nil {
+					slog.Warn("Ignoring key from terminal client", "error", err)
+					continue
+				}
+				input.WriteString(seq)
+			}
+			if !s.writeInput(input.String()) {
+				return
+			}
+
+		case "signal":
+			sig, err := ParseSignal(msg.Data)
+			if err != nil {
+				slog.Warn("Ignoring signal from terminal client", "error", err)
+				continue
+			}
+			if err := s.signal(sig); err != nil {
+				slog.Error("Error sending signal", "signal", sig, "error", err)
+			}
+
+		case "resize":
+			if msg.Cols > 0 && msg.Rows > 0 {
+				if err := pty.Setsize(s.ptmx, &pty.Winsize{
+					Rows: uint16(msg.Rows),
+					Cols: uint16(msg.Cols),
+				}); err != nil {
+					slog.Error("Error resizing PTY", "error", err)
+				}
+				s.recorder.write(StreamResize, fmt.Appendf(nil, "%dx%d", msg.Cols, msg.Rows))
+			}
+		}
+	}
+}
+
+// writeInput records input and writes it to the PTY. It returns false if the session got stopped
+// because the PTY is gone.
+func (s *Session) writeInput(input string) bool {
+	if input == "" {
+		return true
+	}
+	s.recorder.write(StreamInput, []byte(input))
+	if _, err := s.ptmx.Write([]byte(input)); err != nil {
+		slog.Error("Error writing input to PTY", "error", err)
+		s.Stop()
+		return false
+	}
+	return true
+}
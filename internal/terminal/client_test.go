@@ -0,0 +1,102 @@
+package terminal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mobileshell/internal/executor"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// readUntil reads from conn until the received output contains want.
+func readUntil(t *testing.T, conn *websocket.Conn, want string) {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var received strings.Builder
+	for !strings.Contains(received.String(), want) {
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err, "received %q", received.String())
+		received.Write(data)
+	}
+}
+
+// startTestSession starts a session which runs command in a new workspace.
+func startTestSession(t *testing.T, command string) *Session {
+	t.Helper()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "test-ws", stateDir, "")
+	require.NoError(t, err)
+	session, err := NewSession(stateDir, ws.ID, command)
+	require.NoError(t, err)
+	session.Start()
+	t.Cleanup(session.Stop)
+	return session
+}
+
+// serveSession returns the URL of a WebSocket server which attaches its clients to session.
+// Clients with "?mode=watch" are attached read-only.
+func serveSession(t *testing.T, session *Session) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		session.Attach(conn, r.URL.Query().Get("mode") == "watch")
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestAttachSeveralClients(t *testing.T) {
+	t.Parallel()
+	session := startTestSession(t, "cat")
+	url := serveSession(t, session)
+
+	writer, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer func() { _ = writer.Close() }()
+	require.NoError(t, writer.WriteJSON(Message{Type: "input", Data: "first\n"}))
+	readUntil(t, writer, "first")
+
+	// A later client gets the latest output first, and the input of a watcher is ignored
+	watcher, _, err := websocket.DefaultDialer.Dial(url+"?mode=watch", nil)
+	require.NoError(t, err)
+	defer func() { _ = watcher.Close() }()
+	readUntil(t, watcher, "first")
+	require.NoError(t, watcher.WriteJSON(Message{Type: "input", Data: "ignored\n"}))
+	require.NoError(t, writer.WriteJSON(Message{Type: "input", Data: "second\n"}))
+	readUntil(t, watcher, "second")
+	require.Eventually(t, func() bool { return session.clientCount() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// The session waits for a reconnect after its last client detached
+	require.NoError(t, writer.Close())
+	require.NoError(t, watcher.Close())
+	require.Eventually(t, func() bool { return session.clientCount() == 0 }, 5*time.Second, 10*time.Millisecond)
+	reconnected, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer func() { _ = reconnected.Close() }()
+	messageType, data, err := reconnected.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, messageType)
+	require.JSONEq(t, `{"type":"session"}`, string(data))
+	_, data, err = reconnected.ReadMessage()
+	require.NoError(t, err)
+	require.Contains(t, string(data), "first")
+	require.Contains(t, string(data), "second")
+	require.NotContains(t, string(data), "ignored")
+}
+
+func TestAppendScrollback(t *testing.T) {
+	t.Parallel()
+	scrollback := appendScrollback(nil, []byte("first\n"))
+	require.Equal(t, "first\n", string(scrollback))
+
+	scrollback = appendScrollback(scrollback, []byte(strings.Repeat("x", maxScrollback-3)+"\nlast"))
+	require.Equal(t, "last", string(scrollback))
+}
@@ -0,0 +1,61 @@
+package terminal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"syscall"
+
+	"mobileshell/internal/signals"
+)
+
+// keySequences maps the names of keys which are hard to type on mobile to what a terminal sends
+// for them. Ctrl-a to ctrl-z are handled by KeySequence.
+var keySequences = map[string]string{
+	"esc":      "\x1b",
+	"tab":      "\t",
+	"enter":    "\r",
+	"up":       "\x1b[A",
+	"down":     "\x1b[B",
+	"right":    "\x1b[C",
+	"left":     "\x1b[D",
+	"home":     "\x1b[H",
+	"end":      "\x1b[F",
+	"pageup":   "\x1b[5~",
+	"pagedown": "\x1b[6~",
+}
+
+// allowedSignals are the signals which clients may send to the foreground process group.
+var allowedSignals = []string{
+	"SIGHUP", "SIGINT", "SIGQUIT", "SIGKILL", "SIGUSR1", "SIGUSR2", "SIGTERM", "SIGCONT", "SIGSTOP", "SIGTSTP",
+}
+
+// KeySequence returns the bytes which a terminal sends for the key name, like "ctrl-c", "esc" or
+// "up". Names are case-insensitive.
+func KeySequence(name string) (string, error) {
+	name = strings.ToLower(name)
+	if seq, ok := keySequences[name]; ok {
+		return seq, nil
+	}
+	if letter, ok := strings.CutPrefix(name, "ctrl-"); ok && len(letter) == 1 && letter[0] >= 'a' && letter[0] <= 'z' {
+		return string(rune(letter[0] & 0x1f)), nil
+	}
+	return "", fmt.Errorf("unknown key %q", name)
+}
+
+// ParseSignal returns the signal name, like "SIGINT" or "INT". Only the allowed signals which
+// exist on the platform are accepted.
+func ParseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if !slices.Contains(allowedSignals, name) {
+		return 0, fmt.Errorf("unsupported signal %q", name)
+	}
+	sig, err := signals.Parse(name)
+	if err != nil {
+		return 0, fmt.Errorf("unsupported signal %q", name)
+	}
+	return sig, nil
+}
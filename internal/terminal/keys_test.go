@@ -0,0 +1,76 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySequence(t *testing.T) {
+	t.Parallel()
+	seq, err := KeySequence("ctrl-c")
+	require.NoError(t, err)
+	require.Equal(t, "\x03", seq)
+
+	seq, err = KeySequence("Ctrl-D")
+	require.NoError(t, err)
+	require.Equal(t, "\x04", seq)
+
+	seq, err = KeySequence("esc")
+	require.NoError(t, err)
+	require.Equal(t, "\x1b", seq)
+
+	seq, err = KeySequence("up")
+	require.NoError(t, err)
+	require.Equal(t, "\x1b[A", seq)
+
+	_, err = KeySequence("ctrl-1")
+	require.Error(t, err)
+
+	_, err = KeySequence("unknown")
+	require.Error(t, err)
+}
+
+func TestParseSignal(t *testing.T) {
+	t.Parallel()
+	sig, err := ParseSignal("SIGINT")
+	require.NoError(t, err)
+	require.Equal(t, syscall.SIGINT, sig)
+
+	sig, err = ParseSignal("tstp")
+	require.NoError(t, err)
+	require.Equal(t, syscall.SIGTSTP, sig)
+
+	_, err = ParseSignal("SIGSEGV")
+	require.Error(t, err)
+}
+
+func TestSignalAndKeys(t *testing.T) {
+	t.Parallel()
+	session := startTestSession(t, "cat")
+	url := serveSession(t, session)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	// The keys get written to the PTY like input, the terminal echoes Esc as ^[
+	require.NoError(t, conn.WriteJSON(Message{Type: "keys", Keys: []string{"esc", "enter"}}))
+	readUntil(t, conn, "^[")
+
+	// The signal reaches cat, which runs in the foreground
+	require.NoError(t, conn.WriteJSON(Message{Type: "signal", Data: "SIGINT"}))
+	select {
+	case <-session.exited:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "cat did not exit")
+	}
+	status, ok := session.cmd.ProcessState.Sys().(syscall.WaitStatus)
+	require.True(t, ok)
+	require.Equal(t, syscall.SIGINT, status.Signal())
+}
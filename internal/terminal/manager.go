@@ -0,0 +1,143 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrSessionNotFound is returned for the ID of a session which is not (or no longer) active.
+var ErrSessionNotFound = errors.New("terminal session not found")
+
+// SessionInfo describes an active session, see Manager.ListSessions.
+type SessionInfo struct {
+	ID          string
+	WorkspaceID string
+	Command     string
+	StartTime   time.Time
+	ProcessID   string // CommandId of the recorded process, empty if the session is not recorded
+	Multiplexer string // See Multiplexer
+	Clients     int    // Attached browsers, sessions which attach the same multiplexer session share them
+}
+
+// Manager keeps track of the active sessions, so that they can be listed and terminated after the
+// browser tab which started them was closed. It is safe for concurrent use.
+type Manager struct {
+	mu       sync.Mutex
+	nextID   int
+	sessions map[string]*Session
+}
+
+// NewManager returns a Manager without sessions.
+func NewManager() *Manager {
+	return &Manager{sessions: map[string]*Session{}}
+}
+
+// Add registers an active session and returns its ID. It gets removed when it ended.
+func (m *Manager) Add(s *Session) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	id := strconv.Itoa(m.nextID)
+	m.sessions[id] = s
+	s.mu.Lock()
+	s.id = id
+	s.mu.Unlock()
+	go func() {
+		s.Wait()
+		m.Remove(id)
+	}()
+	return id
+}
+
+// Session returns the active session id, for example to attach another browser to it.
+func (m *Manager) Session(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return s, nil
+}
+
+// Remove unregisters the session id.
+func (m *Manager) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+}
+
+// ListSessions returns the active sessions, the oldest first.
+func (m *Manager) ListSessions() []SessionInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	infos := make([]SessionInfo, 0, len(m.sessions))
+	clients := map[string]int{}
+	for id, s := range m.sessions {
+		info := s.info(id)
+		infos = append(infos, info)
+		clients[clientKey(info)] += info.Clients
+	}
+	for i := range infos {
+		infos[i].Clients = clients[clientKey(infos[i])]
+	}
+	slices.SortFunc(infos, func(a, b SessionInfo) int {
+		return a.StartTime.Compare(b.StartTime)
+	})
+	return infos
+}
+
+// clientKey returns the key of the browsers which share the session of info.
+func clientKey(info SessionInfo) string {
+	if info.Multiplexer == "" {
+		return info.ID
+	}
+	return info.WorkspaceID + "\x00" + info.Command
+}
+
+// Reap terminates the sessions which exceed the timeouts of policy at now: sessions without
+// client and without output for policy.IdleTimeout, and sessions which are older than
+// policy.MaxLifetime. It returns the number of terminated sessions.
+func (m *Manager) Reap(policy Policy, now time.Time) int {
+	m.mu.Lock()
+	sessions := slices.Collect(maps.Values(m.sessions))
+	m.mu.Unlock()
+
+	terminated := 0
+	for _, s := range sessions {
+		select {
+		case <-s.done:
+			// Already ending, Add removes it
+			continue
+		default:
+		}
+		s.mu.Lock()
+		idle := len(s.clients) == 0 && now.Sub(s.lastActivity) >= policy.IdleTimeout
+		s.mu.Unlock()
+		switch {
+		case policy.MaxLifetime > 0 && now.Sub(s.startTime) >= policy.MaxLifetime:
+			s.terminate(fmt.Sprintf("The maximum lifetime of %s is reached", policy.MaxLifetime))
+		case idle:
+			s.terminate(fmt.Sprintf("Idle for %s", policy.IdleTimeout))
+		default:
+			continue
+		}
+		terminated++
+	}
+	return terminated
+}
+
+// KillSession terminates the command of the session id and disconnects its browsers.
+func (m *Manager) KillSession(id string) error {
+	s, err := m.Session(id)
+	if err != nil {
+		return err
+	}
+	s.Stop()
+	return nil
+}
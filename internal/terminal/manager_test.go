@@ -0,0 +1,68 @@
+package terminal
+
+import (
+	"testing"
+	"time"
+
+	"mobileshell/internal/workspace"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSession(workspaceID, command string, startTime time.Time) *Session {
+	return &Session{
+		workspace: &workspace.Workspace{ID: workspaceID},
+		command:   command,
+		startTime: startTime,
+		done:      make(chan struct{}),
+		clients:   map[*client]struct{}{{send: make(chan []byte, 100)}: {}},
+	}
+}
+
+func TestManager(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 7, 12, 0, 0, 0, time.UTC)
+	m := NewManager()
+	bash := m.Add(newTestSession("ws", "bash", start.Add(time.Minute)))
+	tmux := newTestSession("ws", "tmux new -A -s mobileshell-ws", start)
+	tmuxID := m.Add(tmux)
+	m.Add(newTestSession("ws", "tmux new -A -s mobileshell-ws", start.Add(2*time.Minute)))
+
+	sessions := m.ListSessions()
+	require.Len(t, sessions, 3)
+	require.Equal(t, tmuxID, sessions[0].ID)
+	require.Equal(t, MultiplexerTmux, sessions[0].Multiplexer)
+	require.Equal(t, 2, sessions[0].Clients)
+	require.Equal(t, bash, sessions[1].ID)
+	require.Equal(t, 1, sessions[1].Clients)
+	require.Equal(t, 2, sessions[2].Clients)
+
+	require.NoError(t, m.KillSession(tmuxID))
+	<-tmux.done
+	m.Remove(tmuxID)
+	require.ErrorIs(t, m.KillSession(tmuxID), ErrSessionNotFound)
+	require.Equal(t, 1, m.ListSessions()[1].Clients)
+}
+
+func TestManagerReap(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 7, 12, 0, 0, 0, time.UTC)
+	m := NewManager()
+	attached := newTestSession("ws", "bash", start)
+	idle := newTestSession("ws", "bash", start)
+	idle.clients = map[*client]struct{}{}
+	idle.lastActivity = start.Add(time.Minute)
+	m.Add(attached)
+	m.Add(idle)
+
+	policy := Policy{IdleTimeout: 10 * time.Minute}
+	require.Equal(t, 0, m.Reap(policy, start.Add(10*time.Minute)))
+	require.Equal(t, 1, m.Reap(policy, start.Add(11*time.Minute)))
+	<-idle.done
+	require.Contains(t, string(idle.scrollback), "Idle for 10m0s")
+
+	policy.MaxLifetime = time.Hour
+	require.Equal(t, 0, m.Reap(policy, start.Add(59*time.Minute)))
+	require.Equal(t, 1, m.Reap(policy, start.Add(time.Hour)))
+	<-attached.done
+}
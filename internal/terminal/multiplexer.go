@@ -0,0 +1,67 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"mobileshell/internal/metadata"
+)
+
+// MultiplexerTmux is the terminal multiplexer which DefaultCommand launches.
+const MultiplexerTmux = "tmux"
+
+// multiplexerFile stores in the process directory which terminal multiplexer a session runs in.
+// A session in a multiplexer survives a lost connection.
+const multiplexerFile = "multiplexer"
+
+// multiplexers are the commands which are detected as terminal multiplexer.
+var multiplexers = []string{MultiplexerTmux, "screen", "zellij"}
+
+// DefaultCommand returns the command of a terminal which was started without one. If tmux is
+// installed, a tmux session per workspace gets created, or attached if it exists already.
+// Otherwise it is bash.
+func DefaultCommand(workspaceID string) string {
+	if _, err := exec.LookPath(MultiplexerTmux); err != nil {
+		return "bash"
+	}
+	return fmt.Sprintf("tmux new -A -s mobileshell-%s", workspaceID)
+}
+
+// Multiplexer returns the terminal multiplexer which command runs, or "" if it runs none.
+func Multiplexer(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return ""
+	}
+	name := filepath.Base(fields[0])
+	for _, multiplexer := range multiplexers {
+		if name == multiplexer {
+			return multiplexer
+		}
+	}
+	return ""
+}
+
+// WriteMultiplexer stores the terminal multiplexer of command in processDir, if it runs one.
+func WriteMultiplexer(processDir, command string) error {
+	multiplexer := Multiplexer(command)
+	if multiplexer == "" {
+		return nil
+	}
+	if err := metadata.WriteFile(filepath.Join(processDir, multiplexerFile), []byte(multiplexer), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s file: %w", multiplexerFile, err)
+	}
+	return nil
+}
+
+// ReadMultiplexer returns the terminal multiplexer which WriteMultiplexer stored, or "".
+func ReadMultiplexer(processDir string) string {
+	data, err := os.ReadFile(filepath.Join(processDir, multiplexerFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,25 @@
+package terminal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiplexer(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, MultiplexerTmux, Multiplexer("tmux new -A -s mobileshell-ws"))
+	require.Equal(t, "screen", Multiplexer("/usr/bin/screen -R"))
+	require.Equal(t, "", Multiplexer("bash"))
+	require.Equal(t, "", Multiplexer(""))
+}
+
+func TestWriteMultiplexer(t *testing.T) {
+	t.Parallel()
+	processDir := t.TempDir()
+	require.NoError(t, WriteMultiplexer(processDir, "bash"))
+	require.Equal(t, "", ReadMultiplexer(processDir))
+
+	require.NoError(t, WriteMultiplexer(processDir, "tmux new -A -s mobileshell-ws"))
+	require.Equal(t, MultiplexerTmux, ReadMultiplexer(processDir))
+}
@@ -0,0 +1,77 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"mobileshell/internal/metadata"
+)
+
+// policyDir contains one file per setting of Policy, in the state directory. The files contain
+// Go durations like "30m", so they can be edited by hand, too.
+const policyDir = "terminal-policy"
+
+// MinPolicyTimeout is the shortest timeout of a Policy, see Policy.Validate.
+const MinPolicyTimeout = time.Minute
+
+// Policy configures when the Manager terminates sessions, see Manager.Reap.
+type Policy struct {
+	IdleTimeout time.Duration // Sessions without client and without output for this long get terminated
+	MaxLifetime time.Duration // Sessions get terminated this long after they started, 0: no limit
+}
+
+// DefaultPolicy returns the policy which applies if none was saved.
+func DefaultPolicy() Policy {
+	return Policy{IdleTimeout: 10 * time.Minute}
+}
+
+// Validate returns an error if a timeout is out of bounds.
+func (p Policy) Validate() error {
+	if p.IdleTimeout < MinPolicyTimeout {
+		return fmt.Errorf("idle timeout must be at least %s", MinPolicyTimeout)
+	}
+	if p.MaxLifetime != 0 && p.MaxLifetime < MinPolicyTimeout {
+		return fmt.Errorf("maximum lifetime must be 0 (no limit) or at least %s", MinPolicyTimeout)
+	}
+	return nil
+}
+
+// LoadPolicy returns the policy which SavePolicy saved in stateDir, or DefaultPolicy.
+func LoadPolicy(stateDir string) Policy {
+	p := DefaultPolicy()
+	dir := filepath.Join(stateDir, policyDir)
+	fields := map[string]*time.Duration{
+		"idle-timeout": &p.IdleTimeout,
+		"max-lifetime": &p.MaxLifetime,
+	}
+	for name, field := range fields {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if d, err := time.ParseDuration(string(data)); err == nil {
+			*field = d
+		}
+	}
+	if p.Validate() != nil {
+		return DefaultPolicy()
+	}
+	return p
+}
+
+// SavePolicy validates p and saves it in stateDir.
+func SavePolicy(stateDir string, p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	dir := filepath.Join(stateDir, policyDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", policyDir, err)
+	}
+	return metadata.WriteFiles(dir, []metadata.File{
+		{Name: "idle-timeout", Content: p.IdleTimeout.String()},
+		{Name: "max-lifetime", Content: p.MaxLifetime.String()},
+	})
+}
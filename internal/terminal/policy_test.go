@@ -0,0 +1,28 @@
+package terminal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.Equal(t, DefaultPolicy(), LoadPolicy(stateDir))
+
+	policy := Policy{IdleTimeout: time.Hour, MaxLifetime: 24 * time.Hour}
+	require.NoError(t, SavePolicy(stateDir, policy))
+	require.Equal(t, policy, LoadPolicy(stateDir))
+
+	require.Error(t, SavePolicy(stateDir, Policy{IdleTimeout: time.Second}))
+	require.Error(t, SavePolicy(stateDir, Policy{IdleTimeout: time.Hour, MaxLifetime: time.Second}))
+	require.Equal(t, policy, LoadPolicy(stateDir))
+
+	// An invalid file edited by hand falls back to the default
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, policyDir, "idle-timeout"), []byte("1s"), 0o600))
+	require.Equal(t, DefaultPolicy(), LoadPolicy(stateDir))
+}
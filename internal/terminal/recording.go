@@ -0,0 +1,126 @@
+package terminal
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"mobileshell/internal/activity"
+	"mobileshell/internal/executor"
+	"mobileshell/internal/metadata"
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+	"mobileshell/pkg/asciicast"
+	"mobileshell/pkg/outputlog"
+)
+
+// Streams of the output log of a recorded session, see Session.Record.
+const (
+	StreamOutput = "pty-out"    // Output of the PTY
+	StreamInput  = "pty-in"     // Input from the browser
+	StreamResize = "pty-resize" // New size of the terminal, like "100x30"
+)
+
+// SessionTag is the tag of the processes of recorded sessions, so that they can be found in the
+// process list.
+const SessionTag = "terminal"
+
+// CastStreams maps the streams of a recording to the events of an asciicast.
+var CastStreams = asciicast.Streams{
+	StreamOutput: asciicast.EventOutput,
+	StreamInput:  asciicast.EventInput,
+	StreamResize: asciicast.EventResize,
+}
+
+func init() {
+	outputlog.RegisterStream(StreamOutput)
+	outputlog.RegisterStream(StreamInput)
+	outputlog.RegisterStream(StreamResize)
+}
+
+// IsSession returns true if proc is a recorded terminal session.
+func IsSession(proc *process.Process) bool {
+	return slices.Contains(proc.Tags, SessionTag)
+}
+
+// recorder writes a session to the output log of its process, like nohup does for other
+// processes.
+type recorder struct {
+	processDir string
+	file       *os.File
+	writer     *outputlog.OutputLogIoWriter
+}
+
+// newRecorder creates the process of a session which runs command with pid in ws.
+func newRecorder(ws *workspace.Workspace, command string, pid int) (*recorder, *process.Process, error) {
+	proc, err := executor.CreateProcess(ws, command)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := process.SaveTags(proc, []string{SessionTag}); err != nil {
+		return nil, nil, err
+	}
+	if err := WriteMultiplexer(proc.ProcessDir, command); err != nil {
+		return nil, nil, err
+	}
+	for name, content := range map[string]string{"pid": strconv.Itoa(pid), "completed": "false"} {
+		if err := metadata.WriteFile(filepath.Join(proc.ProcessDir, name), []byte(content), 0o600); err != nil {
+			return nil, nil, fmt.Errorf("failed to write %s file: %w", name, err)
+		}
+	}
+	file, err := os.OpenFile(proc.OutputFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open output.log file: %w", err)
+	}
+	if err := activity.ProcessStarted(proc.ProcessDir); err != nil {
+		slog.Warn("Failed to record activity", "processDir", proc.ProcessDir, "error", err)
+	}
+	r := &recorder{processDir: proc.ProcessDir, file: file, writer: outputlog.NewOutputLogWriter(file, nil)}
+	return r, proc, nil
+}
+
+// write records data on stream. A nil recorder records nothing.
+func (r *recorder) write(stream string, data []byte) {
+	if r == nil {
+		return
+	}
+	_, _ = r.writer.StreamWriter(stream).Write(data)
+}
+
+// finish waits until everything is written and completes the process with the exit status of
+// state. It must not be called before the last write.
+func (r *recorder) finish(state *os.ProcessState) error {
+	if r == nil {
+		return nil
+	}
+	r.writer.Close()
+	closeErr := r.file.Close()
+
+	exitCode, signal := 1, ""
+	if state != nil {
+		exitCode = state.ExitCode()
+		if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			signal = status.Signal().String()
+		}
+	}
+	endTime := time.Now().UTC()
+	files := []metadata.File{
+		{Name: "exit-status", Content: strconv.Itoa(exitCode)},
+		{Name: "endtime", Content: endTime.Format(outputlog.TimeFormatRFC3339NanoUTC)},
+	}
+	if signal != "" {
+		files = append(files, metadata.File{Name: "signal", Content: signal})
+	}
+	if err := activity.ProcessFinished(r.processDir, endTime, exitCode, signal); err != nil {
+		slog.Warn("Failed to record activity", "processDir", r.processDir, "error", err)
+	}
+	if err := process.Complete(r.processDir, files...); err != nil {
+		return err
+	}
+	return closeErr
+}
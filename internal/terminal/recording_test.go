@@ -0,0 +1,55 @@
+package terminal
+
+import (
+	"testing"
+
+	"mobileshell/internal/activity"
+	"mobileshell/internal/executor"
+	"mobileshell/internal/process"
+	"mobileshell/pkg/outputlog"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, executor.InitExecutor(stateDir))
+	ws, err := executor.CreateWorkspace(stateDir, "terminal-ws", stateDir, "")
+	require.NoError(t, err)
+
+	r, proc, err := newRecorder(ws, "bash", 12345)
+	require.NoError(t, err)
+	r.write(StreamOutput, []byte("$ "))
+	r.write(StreamInput, []byte("exit\r"))
+
+	loaded, err := process.LoadProcessFromDir(proc.ProcessDir)
+	require.NoError(t, err)
+	require.False(t, loaded.Completed)
+	require.Equal(t, 12345, loaded.PID)
+	require.True(t, IsSession(loaded))
+
+	require.NoError(t, r.finish(nil))
+	loaded, err = process.LoadProcessFromDir(proc.ProcessDir)
+	require.NoError(t, err)
+	require.True(t, loaded.Completed)
+	require.Equal(t, 1, loaded.ExitCode)
+	require.Equal(t, "bash", loaded.Command)
+
+	output, err := outputlog.ReadOneStream(loaded.OutputFile, StreamOutput)
+	require.NoError(t, err)
+	require.Equal(t, "$ ", string(output))
+	input, err := outputlog.ReadOneStream(loaded.OutputFile, StreamInput)
+	require.NoError(t, err)
+	require.Equal(t, "exit\r", string(input))
+
+	// The session is in the recent activity
+	events, err := activity.Recent(stateDir, 10, nil)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, activity.EventFinished, events[0].Type)
+	require.Equal(t, loaded.EndTime, events[0].Time)
+	require.Equal(t, 1, events[0].ExitCode)
+	require.Equal(t, activity.EventStarted, events[1].Type)
+	require.Equal(t, proc.CommandId, events[1].Process)
+}
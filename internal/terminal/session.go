@@ -1,7 +1,6 @@
 package terminal
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
@@ -11,33 +10,52 @@ import (
 	"syscall"
 	"time"
 
+	"mobileshell/internal/process"
 	"mobileshell/internal/workspace"
+	"mobileshell/pkg/asciicast"
 
 	"github.com/creack/pty"
-	"github.com/gorilla/websocket"
 )
 
-// Session represents an interactive terminal session
+// Session represents an interactive terminal session. Several browsers can be attached to it,
+// see Attach.
 type Session struct {
-	ws        *websocket.Conn
 	ptmx      *os.File
 	cmd       *exec.Cmd
 	workspace *workspace.Workspace
+	command   string
+	startTime time.Time
+	processID string // CommandId of the process which Record created
 	done      chan struct{}
 	closeOnce sync.Once
-	writeChan chan []byte
+	exited    chan struct{}  // Closed when the command completed, s.cmd.ProcessState is set then
+	finished  chan struct{}  // Closed when Close returned, the recording is complete then
+	recorder  *recorder      // nil: the session is not recorded
+	readers   sync.WaitGroup // readFromPTY and the readers of the clients, they write to the recorder
+
+	mu           sync.Mutex // Guards the fields below
+	id           string     // See Manager.Add
+	clients      map[*client]struct{}
+	scrollback   []byte    // The latest output, for clients which attach later
+	lastActivity time.Time // Of the output and the clients, see Policy.IdleTimeout
+	closed       bool      // Close was called, clients can't attach anymore
 }
 
 // Message represents a WebSocket message
 type Message struct {
-	Type string `json:"type"` // "input", "resize"
-	Data string `json:"data,omitempty"`
-	Cols int    `json:"cols,omitempty"`
-	Rows int    `json:"rows,omitempty"`
+	Type string   `json:"type"`           // "input", "resize", "signal" or "keys"
+	Data string   `json:"data,omitempty"` // The input, or the name of the signal, see ParseSignal
+	Keys []string `json:"keys,omitempty"` // Names of keys, see KeySequence
+	Cols int      `json:"cols,omitempty"`
+	Rows int      `json:"rows,omitempty"`
 }
 
-// NewSession creates a new interactive terminal session
-func NewSession(ws *websocket.Conn, stateDir string, workspaceID string, command string) (*Session, error) {
+// NewSession creates a new interactive terminal session. Browsers get attached with Attach. The
+// error wraps workspace.ErrCommandDenied if the policy of the workspace denies the command.
+func NewSession(stateDir string, workspaceID string, command string) (*Session, error) {
+	if err := process.CheckPlatform(); err != nil {
+		return nil, err
+	}
 	// Get workspace
 	wsList, err := workspace.ListWorkspaces(stateDir)
 	if err != nil {
@@ -55,6 +73,9 @@ func NewSession(ws *websocket.Conn, stateDir string, workspaceID string, command
 	if targetWorkspace == nil {
 		return nil, fmt.Errorf("workspace not found: %s", workspaceID)
 	}
+	if err := targetWorkspace.CheckCommand(command); err != nil {
+		return nil, err
+	}
 
 	// Create the command with pre-command if specified
 	var cmd *exec.Cmd
@@ -96,34 +117,63 @@ func NewSession(ws *websocket.Conn, stateDir string, workspaceID string, command
 	// Set PTY size to default (will be updated by client)
 	_ = pty.Setsize(ptmx, &pty.Winsize{Rows: 24, Cols: 80})
 
+	now := time.Now().UTC()
 	session := &Session{
-		ws:        ws,
-		ptmx:      ptmx,
-		cmd:       cmd,
-		workspace: targetWorkspace,
-		done:      make(chan struct{}),
-		writeChan: make(chan []byte, 100),
+		ptmx:         ptmx,
+		cmd:          cmd,
+		workspace:    targetWorkspace,
+		command:      command,
+		startTime:    now,
+		done:         make(chan struct{}),
+		exited:       make(chan struct{}),
+		finished:     make(chan struct{}),
+		clients:      map[*client]struct{}{},
+		lastActivity: now,
 	}
 
 	return session, nil
 }
 
-// Start begins handling the terminal session
-func (s *Session) Start() {
-	// Read from PTY and send to WebSocket
-	go s.readFromPTY()
+// Record creates a process in the workspace for the session, tagged with SessionTag. The output,
+// the input and the size of the terminal get written to its output log, from which an asciicast
+// can be exported. The process completes when the session gets closed. It must be called before
+// Start.
+func (s *Session) Record() (*process.Process, error) {
+	r, proc, err := newRecorder(s.workspace, s.command, s.cmd.Process.Pid)
+	if err != nil {
+		return nil, err
+	}
+	s.recorder = r
+	s.processID = proc.CommandId
+	// The browser sends its size after connecting
+	s.recorder.write(StreamResize, fmt.Appendf(nil, "%dx%d", asciicast.DefaultWidth, asciicast.DefaultHeight))
+	return proc, nil
+}
 
-	// Read from WebSocket and write to PTY
-	go s.readFromWebSocket()
+// Start begins handling the terminal session. The session ends when its command exits, when its
+// last client detaches, or when Stop is called. It cleans up with Close then.
+func (s *Session) Start() {
+	s.readers.Add(1)
 
-	// Handle WebSocket writes via channel
-	go s.writeToWebSocket()
+	// Read from PTY and send to the clients
+	go func() {
+		defer s.readers.Done()
+		s.readFromPTY()
+	}()
 
 	// Wait for process to complete
 	go s.waitForProcess()
+
+	go func() {
+		s.Wait()
+		if err := s.Close(); err != nil {
+			slog.Error("Failed to close terminal session", "error", err)
+		}
+		close(s.finished)
+	}()
 }
 
-// readFromPTY reads output from the PTY and sends it to the WebSocket
+// readFromPTY reads output from the PTY and sends it to the clients
 func (s *Session) readFromPTY() {
 	buf := make([]byte, 8192)
 	for {
@@ -132,79 +182,15 @@ func (s *Session) readFromPTY() {
 			if err != io.EOF {
 				slog.Error("Error reading from PTY", "error", err)
 			}
-			s.closeOnce.Do(func() { close(s.done) })
+			s.Stop()
 			return
 		}
 
 		if n > 0 {
-			// Send data to write channel
 			data := make([]byte, n)
 			copy(data, buf[:n])
-			select {
-			case s.writeChan <- data:
-			case <-s.done:
-				return
-			}
-		}
-	}
-}
-
-// writeToWebSocket handles all WebSocket writes through a channel
-func (s *Session) writeToWebSocket() {
-	for {
-		select {
-		case data := <-s.writeChan:
-			if err := s.ws.WriteMessage(websocket.TextMessage, data); err != nil {
-				slog.Error("Error writing to WebSocket", "error", err)
-				s.closeOnce.Do(func() { close(s.done) })
-				return
-			}
-		case <-s.done:
-			return
-		}
-	}
-}
-
-// readFromWebSocket reads messages from the WebSocket and processes them
-func (s *Session) readFromWebSocket() {
-	for {
-		_, data, err := s.ws.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				slog.Error("WebSocket read error", "error", err)
-			}
-			s.closeOnce.Do(func() { close(s.done) })
-			return
-		}
-
-		var msg Message
-		if err := json.Unmarshal(data, &msg); err != nil {
-			// If it's not JSON, treat it as raw input
-			if _, err := s.ptmx.Write(data); err != nil {
-				slog.Error("Error writing to PTY", "error", err)
-				s.closeOnce.Do(func() { close(s.done) })
-				return
-			}
-			continue
-		}
-
-		switch msg.Type {
-		case "input":
-			if _, err := s.ptmx.Write([]byte(msg.Data)); err != nil {
-				slog.Error("Error writing input to PTY", "error", err)
-				s.closeOnce.Do(func() { close(s.done) })
-				return
-			}
-
-		case "resize":
-			if msg.Cols > 0 && msg.Rows > 0 {
-				if err := pty.Setsize(s.ptmx, &pty.Winsize{
-					Rows: uint16(msg.Rows),
-					Cols: uint16(msg.Cols),
-				}); err != nil {
-					slog.Error("Error resizing PTY", "error", err)
-				}
-			}
+			s.recorder.write(StreamOutput, data)
+			s.broadcast(data, true)
 		}
 	}
 }
@@ -212,25 +198,26 @@ func (s *Session) readFromWebSocket() {
 // waitForProcess waits for the command to complete
 func (s *Session) waitForProcess() {
 	_ = s.cmd.Wait()
+	close(s.exited)
 
 	// Give a moment for any final output to be sent
 	time.Sleep(100 * time.Millisecond)
 
-	// Send exit notification via channel
-	exitMsg := []byte("\r\n\r\n[Process exited]\r\n")
-	select {
-	case s.writeChan <- exitMsg:
-	case <-time.After(1 * time.Second):
-		// If we can't send, continue with cleanup
-	}
+	// Send exit notification to the clients
+	s.broadcast([]byte("\r\n\r\n[Process exited]\r\n"), false)
 
-	s.closeOnce.Do(func() { close(s.done) })
+	s.Stop()
 }
 
-// Close cleans up the session
+// Close detaches the clients and terminates the command. Start calls it when the session ended.
 func (s *Session) Close() error {
-	// Close WebSocket
-	_ = s.ws.Close()
+	// Close the WebSockets, the readers of the clients end then
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.clients {
+		_ = c.ws.Close()
+	}
+	s.mu.Unlock()
 
 	// Close PTY
 	_ = s.ptmx.Close()
@@ -239,23 +226,51 @@ func (s *Session) Close() error {
 	if s.cmd.Process != nil {
 		_ = s.cmd.Process.Signal(syscall.SIGTERM)
 
-		// Wait a bit for graceful shutdown
-		waitDone := make(chan struct{})
-		go func() {
-			_ = s.cmd.Wait()
-			close(waitDone)
-		}()
-
+		// Wait a bit for graceful shutdown, waitForProcess waits for the command
 		select {
-		case <-waitDone:
+		case <-s.exited:
 			// Process exited gracefully
 		case <-time.After(2 * time.Second):
 			// Force kill if it doesn't exit
 			_ = s.cmd.Process.Kill()
+			<-s.exited
 		}
 	}
 
-	return nil
+	// The readers end, because the WebSockets and the PTY are closed
+	s.readers.Wait()
+	return s.recorder.finish(s.cmd.ProcessState)
+}
+
+// Stop ends the session, Wait returns and the command gets terminated then.
+func (s *Session) Stop() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// terminate shows reason in the terminal and the recording, and ends the session.
+func (s *Session) terminate(reason string) {
+	message := fmt.Appendf(nil, "\r\n\r\n[%s, terminating the session]\r\n", reason)
+	s.recorder.write(StreamOutput, message)
+	s.broadcast(message, true)
+	s.Stop()
+}
+
+// WorkspaceID returns the ID of the workspace of the session.
+func (s *Session) WorkspaceID() string {
+	return s.workspace.ID
+}
+
+// info describes the session, its ID is id.
+func (s *Session) info(id string) SessionInfo {
+	return SessionInfo{
+		ID:          id,
+		WorkspaceID: s.WorkspaceID(),
+		Command:     s.command,
+		StartTime:   s.startTime,
+		ProcessID:   s.processID,
+		Multiplexer: Multiplexer(s.command),
+		Clients:     s.clientCount(),
+	}
 }
 
 // Wait waits for the session to complete
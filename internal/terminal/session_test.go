@@ -2,6 +2,10 @@ package terminal
 
 import (
 	"testing"
+
+	"mobileshell/internal/workspace"
+
+	"github.com/stretchr/testify/require"
 )
 
 // Basic test to ensure package compiles
@@ -11,3 +15,15 @@ func TestPackageCompiles(t *testing.T) {
 	// Actual functional tests would require more complex setup
 	t.Log("Terminal package compiles successfully")
 }
+
+func TestNewSessionCommandPolicy(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(stateDir))
+	ws, err := workspace.CreateWorkspace(stateDir, "policy", t.TempDir(), "")
+	require.NoError(t, err)
+	require.NoError(t, workspace.SaveCommandPolicy(ws, "allow ^tmux\\b"))
+
+	_, err = NewSession(stateDir, ws.ID, "bash")
+	require.ErrorIs(t, err, workspace.ErrCommandDenied)
+}
@@ -0,0 +1,21 @@
+package terminal
+
+import (
+	"errors"
+	"testing"
+
+	"mobileshell/internal/workspace"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSessionUnsupported(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(stateDir))
+	ws, err := workspace.CreateWorkspace(stateDir, "windows", t.TempDir(), "")
+	require.NoError(t, err)
+
+	_, err = NewSession(stateDir, ws.ID, "bash")
+	require.ErrorIs(t, err, errors.ErrUnsupported)
+}
@@ -0,0 +1,68 @@
+package terminal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// savedSessionsFile stores the sessions which were active when the server shut down, see
+// Manager.Shutdown.
+const savedSessionsFile = "terminal-sessions.json"
+
+// SavedSessions are the sessions which were active when the server shut down. Their commands
+// were terminated, but sessions in a terminal multiplexer survive and can be attached again.
+type SavedSessions struct {
+	Time     time.Time     `json:"time"`
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// Shutdown stores the active sessions in stateDir, see LoadSavedSessions, and ends them. It
+// waits until their recordings are complete, or ctx is done.
+func (m *Manager) Shutdown(ctx context.Context, stateDir string) error {
+	saved := SavedSessions{Time: time.Now().UTC(), Sessions: m.ListSessions()}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(stateDir, savedSessionsFile), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", savedSessionsFile, err)
+	}
+
+	m.mu.Lock()
+	sessions := slices.Collect(maps.Values(m.sessions))
+	m.mu.Unlock()
+	for _, s := range sessions {
+		s.terminate("The server shuts down")
+	}
+	for _, s := range sessions {
+		select {
+		case <-s.finished:
+		case <-ctx.Done():
+			return fmt.Errorf("failed to close terminal sessions: %w", ctx.Err())
+		}
+	}
+	return nil
+}
+
+// LoadSavedSessions returns the sessions which Shutdown stored in stateDir, or nil if there
+// are none.
+func LoadSavedSessions(stateDir string) (*SavedSessions, error) {
+	data, err := os.ReadFile(filepath.Join(stateDir, savedSessionsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved SavedSessions
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", savedSessionsFile, err)
+	}
+	return &saved, nil
+}
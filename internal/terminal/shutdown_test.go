@@ -0,0 +1,45 @@
+package terminal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerShutdown(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	saved, err := LoadSavedSessions(stateDir)
+	require.NoError(t, err)
+	require.Nil(t, saved)
+
+	start := time.Date(2025, 1, 7, 12, 0, 0, 0, time.UTC)
+	m := NewManager()
+	s := newTestSession("ws", "tmux new -A -s mobileshell-ws", start)
+	s.finished = make(chan struct{})
+	m.Add(s)
+	go func() {
+		<-s.done
+		close(s.finished)
+	}()
+	require.NoError(t, m.Shutdown(context.Background(), stateDir))
+
+	saved, err = LoadSavedSessions(stateDir)
+	require.NoError(t, err)
+	require.Len(t, saved.Sessions, 1)
+	require.Equal(t, "ws", saved.Sessions[0].WorkspaceID)
+	require.Equal(t, MultiplexerTmux, saved.Sessions[0].Multiplexer)
+	require.Equal(t, start, saved.Sessions[0].StartTime)
+	require.WithinDuration(t, time.Now(), saved.Time, time.Minute)
+
+	// Sessions which don't finish in time
+	m = NewManager()
+	stuck := newTestSession("ws", "bash", start)
+	stuck.finished = make(chan struct{})
+	m.Add(stuck)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, m.Shutdown(ctx, stateDir), context.DeadlineExceeded)
+}
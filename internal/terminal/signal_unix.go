@@ -0,0 +1,22 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// signal sends sig to the foreground process group of the PTY, like the terminal driver does for
+// Ctrl-C. This reaches the program which runs in the shell, not only the shell.
+func (s *Session) signal(sig syscall.Signal) error {
+	var pgrp int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, s.ptmx.Fd(), syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp))); errno != 0 {
+		return fmt.Errorf("failed to get foreground process group: %w", errno)
+	}
+	if err := syscall.Kill(-int(pgrp), sig); err != nil {
+		return fmt.Errorf("failed to send %s to process group %d: %w", sig, pgrp, err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package terminal
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// signal kills the shell of the session. Windows has no process groups of a terminal, so the
+// programs which the shell started are not reached.
+func (s *Session) signal(sig syscall.Signal) error {
+	if sig != syscall.SIGKILL {
+		return fmt.Errorf("%s is not supported on Windows", sig)
+	}
+	if err := s.cmd.Process.Kill(); err != nil {
+		return fmt.Errorf("failed to kill the shell: %w", err)
+	}
+	return nil
+}
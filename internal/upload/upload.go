@@ -0,0 +1,308 @@
+// Package upload assembles big files which are uploaded in chunks, so that an upload over a
+// flaky mobile network can be resumed where the connection was lost.
+//
+// An upload is a directory in stateDir/uploads/<id> with one file per field (like a process
+// directory), and the data which was received so far. The size of the data is the offset at
+// which the next chunk has to start. When the last chunk arrived, the SHA-256 checksum of the
+// data is verified and the file is moved to its path in the workspace directory.
+package upload
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mobileshell/internal/workspace"
+)
+
+// ErrNotFound is returned for the ID of an upload which doesn't exist (anymore).
+var ErrNotFound = errors.New("upload not found")
+
+// ErrOffset is returned for a chunk which doesn't start where the received data ends.
+var ErrOffset = errors.New("chunk doesn't start at the offset of the upload")
+
+// ErrChecksum is returned if the assembled file doesn't match the checksum of the upload. The
+// upload gets deleted then.
+var ErrChecksum = errors.New("checksum of the uploaded file doesn't match")
+
+// dataFile contains the data which was received so far.
+const dataFile = "data"
+
+// Upload is a file which is uploaded in chunks.
+type Upload struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspace_id"`
+	Path        string    `json:"path"` // Relative to the workspace directory
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"` // Hex encoded checksum of the whole file
+	Offset      int64     `json:"offset"` // Bytes received so far, the next chunk starts here
+	CreatedAt   time.Time `json:"created_at"`
+	Complete    bool      `json:"complete"` // The file was verified and is in the workspace directory
+}
+
+// locks serializes the writes to an upload, the key is the ID. The entry is deleted with the
+// upload, so that the map doesn't grow on a long running server.
+var locks sync.Map
+
+func uploadsDir(stateDir string) string {
+	return filepath.Join(stateDir, "uploads")
+}
+
+// uploadDir returns the directory of the upload id, or ErrNotFound if id is malformed.
+func uploadDir(stateDir, id string) (string, error) {
+	// IDs are created by rand.Text, anything else could escape the uploads directory
+	if id == "" || strings.Trim(id, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567") != "" {
+		return "", ErrNotFound
+	}
+	return filepath.Join(uploadsDir(stateDir), id), nil
+}
+
+// Create starts the upload of a file with size bytes and the hex encoded SHA-256 checksum
+// to path, which is relative to the directory of ws. An existing file gets replaced when the
+// upload is complete.
+func Create(stateDir string, ws *workspace.Workspace, path string, size int64, checksum string) (*Upload, error) {
+	if !filepath.IsLocal(path) {
+		return nil, fmt.Errorf("path must be relative to the workspace directory and must not contain \"..\": %q", path)
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("invalid size %d", size)
+	}
+	checksum = strings.ToLower(checksum)
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("invalid SHA-256 checksum %q", checksum)
+	}
+	target := filepath.Join(ws.Directory, path)
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+
+	u := &Upload{
+		ID:          rand.Text(),
+		WorkspaceID: ws.ID,
+		Path:        filepath.Clean(path),
+		Size:        size,
+		SHA256:      checksum,
+		CreatedAt:   time.Now().UTC(),
+	}
+	dir := filepath.Join(uploadsDir(stateDir), u.ID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	files := map[string]string{
+		"workspace-id": u.WorkspaceID,
+		"path":         u.Path,
+		"target":       target,
+		"size":         strconv.FormatInt(size, 10),
+		"sha256":       checksum,
+		"created":      u.CreatedAt.Format(time.RFC3339Nano),
+		dataFile:       "",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	if size == 0 {
+		return u, complete(dir, u)
+	}
+	return u, nil
+}
+
+// Get returns the upload id, its Offset tells where to resume.
+func Get(stateDir, id string) (*Upload, error) {
+	dir, err := uploadDir(stateDir, id)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{}
+	for _, name := range []string{"workspace-id", "path", "size", "sha256", "created"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		fields[name] = string(data)
+	}
+	size, err := strconv.ParseInt(fields["size"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid size file: %w", err)
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, fields["created"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid created file: %w", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, dataFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dataFile, err)
+	}
+	return &Upload{
+		ID:          id,
+		WorkspaceID: fields["workspace-id"],
+		Path:        fields["path"],
+		Size:        size,
+		SHA256:      fields["sha256"],
+		Offset:      info.Size(),
+		CreatedAt:   createdAt,
+	}, nil
+}
+
+// Write appends the chunk of length bytes, which starts at start, to the upload id. If the
+// connection breaks, the bytes which arrived are kept and the upload resumes at the returned
+// Offset. The last chunk completes the upload, see Upload.Complete.
+func Write(stateDir, id string, start int64, chunk io.Reader, length int64) (*Upload, error) {
+	// A malformed ID must not get an entry in locks
+	dir, err := uploadDir(stateDir, id)
+	if err != nil {
+		return nil, err
+	}
+	lock, _ := locks.LoadOrStore(id, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	u, err := Get(stateDir, id)
+	if errors.Is(err, ErrNotFound) {
+		locks.Delete(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if start != u.Offset {
+		return u, fmt.Errorf("%w: the chunk starts at %d, %d bytes were received", ErrOffset, start, u.Offset)
+	}
+	if length <= 0 || start+length > u.Size {
+		return u, fmt.Errorf("the chunk of %d bytes at %d exceeds the size %d", length, start, u.Size)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, dataFile), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return u, fmt.Errorf("failed to open %s: %w", dataFile, err)
+	}
+	written, err := io.Copy(f, io.LimitReader(chunk, length))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	u.Offset += written
+	if err == nil && written < length {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return u, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	if u.Offset < u.Size {
+		return u, nil
+	}
+	return u, complete(dir, u)
+}
+
+// complete verifies the checksum of the data of u in dir and moves it to its target. The
+// upload directory gets deleted, also if the checksum doesn't match.
+func complete(dir string, u *Upload) error {
+	defer func() {
+		_ = os.RemoveAll(dir)
+		locks.Delete(u.ID)
+	}()
+
+	data := filepath.Join(dir, dataFile)
+	checksum, err := fileChecksum(data)
+	if err != nil {
+		return err
+	}
+	if checksum != u.SHA256 {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksum, u.SHA256, checksum)
+	}
+	target, err := os.ReadFile(filepath.Join(dir, "target"))
+	if err != nil {
+		return fmt.Errorf("failed to read target: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(string(target)), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := moveFile(data, string(target)); err != nil {
+		return err
+	}
+	u.Complete = true
+	return nil
+}
+
+// fileChecksum returns the hex encoded SHA-256 checksum of the file at path.
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// moveFile renames src to dst, or copies it if the workspace directory is on another file
+// system than the state directory.
+func moveFile(src, dst string) error {
+	// The data was written for the state directory, files in the workspace are readable
+	if err := os.Rename(src, dst); err == nil {
+		return os.Chmod(dst, 0o644)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	return nil
+}
+
+// Delete cancels the upload id and deletes the data which was received.
+func Delete(stateDir, id string) error {
+	dir, err := uploadDir(stateDir, id)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	locks.Delete(id)
+	return nil
+}
+
+// ParseContentRange parses a Content-Range header like "bytes 0-1048575/209715200" and
+// returns the offset and the length of the chunk, and the size of the whole file.
+func ParseContentRange(header string) (start, length, size int64, err error) {
+	var end int64
+	if _, err := fmt.Sscanf(header, "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q, expected \"bytes <first>-<last>/<size>\"", header)
+	}
+	if start < 0 || end < start || end >= size {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+	return start, end - start + 1, size, nil
+}
@@ -0,0 +1,149 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mobileshell/internal/workspace"
+
+	"github.com/stretchr/testify/require"
+)
+
+func checksum(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadInChunks(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws := &workspace.Workspace{ID: "ws", Directory: t.TempDir()}
+	content := "first chunk, second chunk"
+
+	u, err := Create(stateDir, ws, "dist/artifact.bin", int64(len(content)), checksum(content))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), u.Offset)
+
+	// The connection breaks after 5 bytes of the first chunk, the upload resumes there
+	u, err = Write(stateDir, u.ID, 0, strings.NewReader(content[:5]), 13)
+	require.Error(t, err)
+	require.Equal(t, int64(5), u.Offset)
+
+	u, err = Get(stateDir, u.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), u.Offset)
+
+	_, err = Write(stateDir, u.ID, 0, strings.NewReader(content[:13]), 13)
+	require.ErrorIs(t, err, ErrOffset)
+
+	u, err = Write(stateDir, u.ID, 5, strings.NewReader(content[5:13]), 8)
+	require.NoError(t, err)
+	require.False(t, u.Complete)
+
+	u, err = Write(stateDir, u.ID, 13, strings.NewReader(content[13:]), int64(len(content)-13))
+	require.NoError(t, err)
+	require.True(t, u.Complete)
+	data, err := os.ReadFile(filepath.Join(ws.Directory, "dist", "artifact.bin"))
+	require.NoError(t, err)
+	require.Equal(t, content, string(data))
+
+	_, err = Get(stateDir, u.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.False(t, hasLock(u.ID))
+}
+
+// hasLock returns true if locks has an entry for the upload id.
+func hasLock(id string) bool {
+	_, ok := locks.Load(id)
+	return ok
+}
+
+func TestUploadChecksumMismatch(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws := &workspace.Workspace{ID: "ws", Directory: t.TempDir()}
+
+	u, err := Create(stateDir, ws, "file.txt", 5, checksum("hello"))
+	require.NoError(t, err)
+	_, err = Write(stateDir, u.ID, 0, strings.NewReader("HELLO"), 5)
+	require.ErrorIs(t, err, ErrChecksum)
+
+	require.NoFileExists(t, filepath.Join(ws.Directory, "file.txt"))
+	_, err = Get(stateDir, u.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCreateUploadInvalid(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws := &workspace.Workspace{ID: "ws", Directory: t.TempDir()}
+
+	_, err := Create(stateDir, ws, "../outside.txt", 5, checksum("hello"))
+	require.Error(t, err)
+
+	_, err = Create(stateDir, ws, "/etc/passwd", 5, checksum("hello"))
+	require.Error(t, err)
+
+	_, err = Create(stateDir, ws, "file.txt", 5, "not-a-checksum")
+	require.Error(t, err)
+
+	_, err = Get(stateDir, "../../etc")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Chunks for IDs which don't exist don't leave a lock behind
+	_, err = Write(stateDir, "../../etc", 0, strings.NewReader("hello"), 5)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.False(t, hasLock("../../etc"))
+	_, err = Write(stateDir, "MISSING", 0, strings.NewReader("hello"), 5)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.False(t, hasLock("MISSING"))
+}
+
+func TestUploadEmptyFile(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws := &workspace.Workspace{ID: "ws", Directory: t.TempDir()}
+
+	u, err := Create(stateDir, ws, "empty.txt", 0, checksum(""))
+	require.NoError(t, err)
+	require.True(t, u.Complete)
+	require.FileExists(t, filepath.Join(ws.Directory, "empty.txt"))
+	require.False(t, hasLock(u.ID))
+}
+
+func TestDeleteUpload(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws := &workspace.Workspace{ID: "ws", Directory: t.TempDir()}
+
+	u, err := Create(stateDir, ws, "file.txt", 5, checksum("hello"))
+	require.NoError(t, err)
+	_, err = Write(stateDir, u.ID, 0, strings.NewReader("he"), 2)
+	require.NoError(t, err)
+	require.True(t, hasLock(u.ID))
+	require.NoError(t, Delete(stateDir, u.ID))
+	require.False(t, hasLock(u.ID))
+	require.ErrorIs(t, Delete(stateDir, u.ID), ErrNotFound)
+}
+
+func TestParseContentRange(t *testing.T) {
+	t.Parallel()
+	start, length, size, err := ParseContentRange("bytes 1048576-2097151/209715200")
+	require.NoError(t, err)
+	require.Equal(t, int64(1048576), start)
+	require.Equal(t, int64(1048576), length)
+	require.Equal(t, int64(209715200), size)
+
+	_, _, _, err = ParseContentRange("bytes 10-5/100")
+	require.Error(t, err)
+
+	_, _, _, err = ParseContentRange("bytes 0-100/100")
+	require.Error(t, err)
+
+	_, _, _, err = ParseContentRange("items 0-1/2")
+	require.Error(t, err)
+}
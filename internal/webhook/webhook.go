@@ -0,0 +1,324 @@
+// Package webhook posts the lifecycle events of processes (started, completed, failed) to the
+// webhooks of their workspace, for example to bridge them into Slack or Matrix.
+//
+// Each webhook has a URL, a secret and an event filter. The JSON body is signed with
+// HMAC-SHA256 of the secret, like GitHub does it: the X-MobileShell-Signature header is
+// "sha256=<hex>". Failed deliveries are retried with backoff. The nohup wrapper sends the
+// events, so they are delivered while the server is down, too.
+//
+// The webhooks are stored in the workspace directory, one directory per webhook with one file
+// per field.
+package webhook
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+)
+
+// Events of a process. Completed and failed exclude each other: a process which exited with a
+// nonzero code, got killed by a signal or timed out failed.
+const (
+	EventStarted   = "started"
+	EventCompleted = "completed"
+	EventFailed    = "failed"
+)
+
+// Events are all events, in the order of the lifecycle of a process.
+var Events = []string{EventStarted, EventCompleted, EventFailed}
+
+// webhooksDir contains a directory per Webhook, in the workspace directory.
+const webhooksDir = "webhooks"
+
+// requestTimeout limits each delivery attempt.
+const requestTimeout = 10 * time.Second
+
+// retryDelays are the waits before the retries of a failed delivery.
+var retryDelays = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+
+// Webhook gets the events of the processes of a workspace.
+type Webhook struct {
+	ID        string
+	URL       string
+	Secret    string   // Key of the HMAC signature
+	Events    []string // The events which are sent, see Events
+	CreatedAt time.Time
+}
+
+// Wants returns true if the webhook gets event.
+func (h *Webhook) Wants(event string) bool {
+	return slices.Contains(h.Events, event)
+}
+
+// Add creates a webhook of the workspace. An empty secret creates a random one.
+func Add(ws *workspace.Workspace, rawURL, secret string, events []string) (*Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook URL must be an http or https URL: %q", rawURL)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("select at least one event")
+	}
+	for _, event := range events {
+		if !slices.Contains(Events, event) {
+			return nil, fmt.Errorf("invalid event %q: use %s", event, strings.Join(Events, ", "))
+		}
+	}
+	h := &Webhook{
+		ID:        rand.Text(),
+		URL:       rawURL,
+		Secret:    cmp.Or(secret, rand.Text()),
+		Events:    events,
+		CreatedAt: time.Now().UTC(),
+	}
+	dir := filepath.Join(ws.Path, webhooksDir, h.ID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create webhook directory: %w", err)
+	}
+	err = metadata.WriteFiles(dir, []metadata.File{
+		{Name: "url", Content: h.URL},
+		{Name: "secret", Content: h.Secret},
+		{Name: "events", Content: strings.Join(h.Events, ",")},
+		{Name: "created", Content: h.CreatedAt.Format(time.RFC3339Nano)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Delete removes the webhook id of the workspace.
+func Delete(ws *workspace.Workspace, id string) error {
+	// IDs are created by rand.Text, anything else could escape the webhooks directory
+	if id == "" || strings.Trim(id, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567") != "" {
+		return fmt.Errorf("invalid webhook ID %q", id)
+	}
+	dir := filepath.Join(ws.Path, webhooksDir, id)
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("webhook %q not found", id)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
+
+// List returns the webhooks of the workspace, the oldest first. Incomplete webhooks are
+// skipped.
+func List(ws *workspace.Workspace) ([]*Webhook, error) {
+	entries, err := os.ReadDir(filepath.Join(ws.Path, webhooksDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhooks: %w", err)
+	}
+	var hooks []*Webhook
+	for _, entry := range entries {
+		dir := filepath.Join(ws.Path, webhooksDir, entry.Name())
+		fields := map[string]string{}
+		for _, name := range []string{"url", "secret", "events", "created"} {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				break
+			}
+			fields[name] = string(data)
+		}
+		if len(fields) < 4 {
+			continue
+		}
+		h := &Webhook{
+			ID:     entry.Name(),
+			URL:    fields["url"],
+			Secret: fields["secret"],
+			Events: strings.Split(fields["events"], ","),
+		}
+		h.CreatedAt, _ = time.Parse(time.RFC3339Nano, fields["created"])
+		hooks = append(hooks, h)
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].CreatedAt.Before(hooks[j].CreatedAt) })
+	return hooks, nil
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Event       string     `json:"event"`
+	Text        string     `json:"text"` // One line summary, Slack and Matrix bridges show it
+	WorkspaceID string     `json:"workspace_id"`
+	Workspace   string     `json:"workspace"`
+	ProcessID   string     `json:"process_id"`
+	Command     string     `json:"command"`
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     *time.Time `json:"end_time,omitempty"`
+	ExitCode    *int       `json:"exit_code,omitempty"`
+	Signal      string     `json:"signal,omitempty"`
+	TimedOut    bool       `json:"timed_out,omitempty"`
+}
+
+// NewPayload returns the payload of event of the process p in the workspace ws. The end
+// time and the exit code are only set for the completed and failed events.
+func NewPayload(event string, ws *workspace.Workspace, p *process.Process) Payload {
+	payload := Payload{
+		Event:       event,
+		WorkspaceID: ws.ID,
+		Workspace:   ws.Name,
+		ProcessID:   p.CommandId,
+		Command:     p.Command,
+		StartTime:   p.StartTime,
+	}
+	command, _, _ := strings.Cut(p.Command, "\n")
+	if event == EventStarted {
+		payload.Text = fmt.Sprintf("[%s] Started: %s", ws.Name, command)
+		return payload
+	}
+	endTime := p.FinishedAt()
+	exitCode := p.ExitCode
+	payload.EndTime = &endTime
+	payload.ExitCode = &exitCode
+	payload.Signal = p.Signal
+	payload.TimedOut = p.TimedOut
+	duration := endTime.Sub(p.StartTime).Round(time.Second)
+	status := fmt.Sprintf("exit %d", exitCode)
+	switch {
+	case p.TimedOut:
+		status = "timed out"
+	case p.Signal != "":
+		status = "killed by " + p.Signal
+	}
+	verb := "Completed"
+	if event == EventFailed {
+		verb = "Failed"
+	}
+	payload.Text = fmt.Sprintf("[%s] %s (%s, %s): %s", ws.Name, verb, status, duration, command)
+	return payload
+}
+
+// Sign returns the value of the X-MobileShell-Signature header of body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ProcessStarted sends the started event of the process in processDir to the webhooks of its
+// workspace.
+func ProcessStarted(processDir string) error {
+	return send(processDir, func(p *process.Process) string { return EventStarted })
+}
+
+// ProcessFinished sends the completed or failed event of the process in processDir to the
+// webhooks of its workspace.
+func ProcessFinished(processDir string) error {
+	return send(processDir, func(p *process.Process) string {
+		if p.ExitCode != 0 || p.Signal != "" || p.TimedOut {
+			return EventFailed
+		}
+		return EventCompleted
+	})
+}
+
+// send delivers the event, which eventOf returns, to the webhooks which want it. Errors of the
+// webhooks are joined, a failing webhook doesn't stop the others.
+func send(processDir string, eventOf func(p *process.Process) string) error {
+	_, ws, err := workspace.GetWorkspaceOfProcess(processDir)
+	if err != nil {
+		return err
+	}
+	hooks, err := List(ws)
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+	p, err := process.LoadProcessFromDir(processDir)
+	if err != nil {
+		return err
+	}
+	payload := NewPayload(eventOf(p), ws, p)
+	var errs []error
+	for _, h := range hooks {
+		if !h.Wants(payload.Event) {
+			continue
+		}
+		if err := Deliver(context.Background(), h, payload); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", h.URL, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Deliver posts payload to the webhook. Network errors, 5xx and 429 responses are retried
+// after the retryDelays, other responses are final.
+func Deliver(ctx context.Context, h *Webhook, payload Payload) error {
+	return deliver(ctx, h, payload, retryDelays)
+}
+
+func deliver(ctx context.Context, h *Webhook, payload Payload, delays []time.Duration) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	// The delivery ID is the same for all attempts, receivers can ignore duplicates with it
+	deliveryID := rand.Text()
+	for attempt := 0; ; attempt++ {
+		retry, err := post(ctx, h, payload.Event, deliveryID, body)
+		if err == nil {
+			slog.Info("Delivered webhook", "url", h.URL, "event", payload.Event, "process", payload.ProcessID)
+			return nil
+		}
+		if !retry || attempt >= len(delays) {
+			return err
+		}
+		slog.Warn("Webhook delivery failed, retrying", "url", h.URL, "event", payload.Event, "error", err, "delay", delays[attempt])
+		select {
+		case <-time.After(delays[attempt]):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// post sends one delivery attempt. retry is true if the error is temporary.
+func post(ctx context.Context, h *Webhook, event, deliveryID string, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "MobileShell-Webhook")
+	req.Header.Set("X-MobileShell-Event", event)
+	req.Header.Set("X-MobileShell-Delivery", deliveryID)
+	req.Header.Set("X-MobileShell-Signature", Sign(h.Secret, body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(text)))
+	}
+	return false, nil
+}
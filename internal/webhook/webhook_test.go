@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mobileshell/internal/executor"
+	"mobileshell/internal/process"
+	"mobileshell/internal/workspace"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newWorkspace(t *testing.T) *workspace.Workspace {
+	stateDir := t.TempDir()
+	require.NoError(t, workspace.InitWorkspaces(stateDir))
+	ws, err := workspace.CreateWorkspace(stateDir, "builds", t.TempDir(), "")
+	require.NoError(t, err)
+	return ws
+}
+
+func TestAddListDelete(t *testing.T) {
+	t.Parallel()
+	ws := newWorkspace(t)
+	hooks, err := List(ws)
+	require.NoError(t, err)
+	require.Empty(t, hooks)
+
+	h, err := Add(ws, "https://example.com/hook", "", []string{EventFailed})
+	require.NoError(t, err)
+	require.NotEmpty(t, h.Secret)
+	_, err = Add(ws, "https://example.com/other", "s3cret", Events)
+	require.NoError(t, err)
+
+	hooks, err = List(ws)
+	require.NoError(t, err)
+	require.Len(t, hooks, 2)
+	require.Equal(t, h.Secret, hooks[0].Secret)
+	require.True(t, hooks[0].Wants(EventFailed))
+	require.False(t, hooks[0].Wants(EventStarted))
+	require.Equal(t, "s3cret", hooks[1].Secret)
+
+	_, err = Add(ws, "ftp://example.com", "", Events)
+	require.ErrorContains(t, err, "http or https")
+	_, err = Add(ws, "https://example.com", "", nil)
+	require.ErrorContains(t, err, "at least one event")
+	_, err = Add(ws, "https://example.com", "", []string{"exploded"})
+	require.ErrorContains(t, err, "invalid event")
+
+	require.Error(t, Delete(ws, "../processes"))
+	require.NoError(t, Delete(ws, h.ID))
+	require.Error(t, Delete(ws, h.ID))
+	hooks, err = List(ws)
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+}
+
+func TestNewPayload(t *testing.T) {
+	t.Parallel()
+	ws := &workspace.Workspace{ID: "builds", Name: "Builds"}
+	start := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	p := &process.Process{CommandId: "p1", Command: "make build\nmake test", ExitCode: 2, StartTime: start, EndTime: start.Add(90 * time.Second)}
+
+	payload := NewPayload(EventStarted, ws, p)
+	require.Equal(t, "[Builds] Started: make build", payload.Text)
+	require.Nil(t, payload.ExitCode)
+
+	payload = NewPayload(EventFailed, ws, p)
+	require.Equal(t, "[Builds] Failed (exit 2, 1m30s): make build", payload.Text)
+	require.Equal(t, 2, *payload.ExitCode)
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `"workspace_id":"builds","workspace":"Builds","process_id":"p1"`)
+}
+
+func TestDeliver(t *testing.T) {
+	t.Parallel()
+	var attempts atomic.Int32
+	requests := make(chan *http.Request, 3)
+	bodies := make(chan []byte, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		// The first attempt fails temporarily
+		w.WriteHeader([]int{http.StatusBadGateway, http.StatusNoContent}[min(attempts.Add(1)-1, 1)])
+	}))
+	t.Cleanup(server.Close)
+
+	h := &Webhook{URL: server.URL, Secret: "s3cret", Events: Events}
+	payload := Payload{Event: EventStarted, ProcessID: "p1"}
+	require.NoError(t, deliver(context.Background(), h, payload, []time.Duration{time.Millisecond}))
+	require.Equal(t, int32(2), attempts.Load())
+
+	first, second := <-requests, <-requests
+	body := <-bodies
+	require.Equal(t, body, <-bodies)
+	require.Equal(t, first.Header.Get("X-MobileShell-Delivery"), second.Header.Get("X-MobileShell-Delivery"))
+	require.Equal(t, EventStarted, second.Header.Get("X-MobileShell-Event"))
+	require.Equal(t, Sign("s3cret", body), second.Header.Get("X-MobileShell-Signature"))
+	require.Regexp(t, `^sha256=[0-9a-f]{64}$`, Sign("s3cret", body))
+	require.NotEqual(t, Sign("other", body), Sign("s3cret", body))
+}
+
+func TestDeliverNoRetry(t *testing.T) {
+	t.Parallel()
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		http.Error(w, "no such channel", http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+
+	h := &Webhook{URL: server.URL, Secret: "s3cret", Events: Events}
+	err := deliver(context.Background(), h, Payload{Event: EventStarted}, []time.Duration{time.Millisecond})
+	require.ErrorContains(t, err, "404 Not Found: no such channel")
+	require.Equal(t, int32(1), attempts.Load())
+
+	// Network errors are retried until the delays are used up
+	h.URL = "http://127.0.0.1:1/hook"
+	err = deliver(context.Background(), h, Payload{Event: EventStarted}, []time.Duration{time.Millisecond, time.Millisecond})
+	require.ErrorContains(t, err, "connection refused")
+}
+
+func TestProcessFinished(t *testing.T) {
+	t.Parallel()
+	ws := newWorkspace(t)
+	proc, err := executor.CreateProcess(ws, "make build")
+	require.NoError(t, err)
+
+	events := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload Payload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		events <- r.URL.Path + " " + payload.Event
+	}))
+	t.Cleanup(server.Close)
+	_, err = Add(ws, server.URL+"/all", "", Events)
+	require.NoError(t, err)
+	_, err = Add(ws, server.URL+"/succeeded", "", []string{EventCompleted})
+	require.NoError(t, err)
+
+	require.NoError(t, ProcessStarted(proc.ProcessDir))
+	require.Equal(t, "/all started", <-events)
+
+	require.NoError(t, os.WriteFile(filepath.Join(proc.ProcessDir, "exit-status"), []byte("2"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(proc.ProcessDir, "completed"), []byte("true"), 0o600))
+	require.NoError(t, ProcessFinished(proc.ProcessDir))
+	require.Equal(t, "/all failed", <-events)
+	require.Empty(t, events)
+}
@@ -0,0 +1,121 @@
+package webpush
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// subscriptionsDir contains a directory per Subscription, in the state directory.
+const subscriptionsDir = "push-subscriptions"
+
+// Subscription is a browser which gets push messages, as PushSubscription.toJSON() returns it.
+type Subscription struct {
+	ID       string `json:"id"`
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"` // Public key of the browser
+		Auth   string `json:"auth"`   // Shared secret
+	} `json:"keys"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// subscriptionID returns the ID of the subscription with endpoint. Subscribing the same
+// browser again replaces its subscription.
+func subscriptionID(endpoint string) string {
+	sum := sha256.Sum256([]byte(endpoint))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Subscribe stores sub, so that it gets the push messages. userAgent describes the browser for
+// the list of subscriptions.
+func Subscribe(stateDir string, sub *Subscription, userAgent string) error {
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("endpoint must be an https URL: %q", sub.Endpoint)
+	}
+	if sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+		return fmt.Errorf("subscription has no keys")
+	}
+	// Encrypting a message checks the keys
+	if _, err := encrypt(sub, nil); err != nil {
+		return err
+	}
+	sub.ID = subscriptionID(sub.Endpoint)
+	sub.UserAgent = userAgent
+	sub.CreatedAt = time.Now().UTC()
+
+	dir := filepath.Join(stateDir, subscriptionsDir, sub.ID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create subscription directory: %w", err)
+	}
+	files := map[string]string{
+		"endpoint":   sub.Endpoint,
+		"p256dh":     sub.Keys.P256dh,
+		"auth":       sub.Keys.Auth,
+		"user-agent": sub.UserAgent,
+		"created":    sub.CreatedAt.Format(time.RFC3339Nano),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Unsubscribe deletes the subscription id. It is no error if it doesn't exist.
+func Unsubscribe(stateDir, id string) error {
+	if id == "" || strings.Trim(id, "0123456789abcdef") != "" {
+		return fmt.Errorf("invalid subscription ID %q", id)
+	}
+	if err := os.RemoveAll(filepath.Join(stateDir, subscriptionsDir, id)); err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	return nil
+}
+
+// UnsubscribeEndpoint deletes the subscription with endpoint, see Unsubscribe.
+func UnsubscribeEndpoint(stateDir, endpoint string) error {
+	return Unsubscribe(stateDir, subscriptionID(endpoint))
+}
+
+// List returns the subscriptions, the oldest first. Incomplete subscriptions are skipped.
+func List(stateDir string) ([]*Subscription, error) {
+	entries, err := os.ReadDir(filepath.Join(stateDir, subscriptionsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subscriptions: %w", err)
+	}
+	var subs []*Subscription
+	for _, entry := range entries {
+		dir := filepath.Join(stateDir, subscriptionsDir, entry.Name())
+		fields := map[string]string{}
+		for _, name := range []string{"endpoint", "p256dh", "auth", "user-agent", "created"} {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				break
+			}
+			fields[name] = string(data)
+		}
+		if len(fields) < 5 {
+			continue
+		}
+		sub := &Subscription{ID: entry.Name(), Endpoint: fields["endpoint"], UserAgent: fields["user-agent"]}
+		sub.Keys.P256dh = fields["p256dh"]
+		sub.Keys.Auth = fields["auth"]
+		sub.CreatedAt, _ = time.Parse(time.RFC3339Nano, fields["created"])
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs, nil
+}
@@ -0,0 +1,275 @@
+// Package webpush sends notifications to browsers with the Web Push protocol, so that a phone
+// shows them even when no MobileShell tab is open.
+//
+// The browser subscribes with the public VAPID key of the server (RFC 8292) and gets an
+// endpoint URL of its push service. The server encrypts each message for the subscription
+// (RFC 8291) and posts it to the endpoint. The VAPID key and the subscriptions are stored in
+// the state directory.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrGone is returned by Send if the push service doesn't know the subscription anymore, for
+// example because the user revoked the permission. The subscription should be deleted then.
+var ErrGone = errors.New("push subscription expired")
+
+// vapidKeyFile contains the private VAPID key as PEM, in the state directory.
+const vapidKeyFile = "vapid-private-key.pem"
+
+// Subject identifies the sender to the push services, they contact it if there are problems.
+const Subject = "https://github.com/guettli/mobileshell"
+
+// ttl is how long a push service keeps a message for a phone which is offline.
+const ttl = 24 * time.Hour
+
+var b64 = base64.RawURLEncoding
+
+// Keys is the VAPID key pair of the server.
+type Keys struct {
+	private *ecdsa.PrivateKey
+}
+
+// LoadKeys returns the VAPID keys of stateDir, they are created on the first call.
+func LoadKeys(stateDir string) (*Keys, error) {
+	path := filepath.Join(stateDir, vapidKeyFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return createKeys(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VAPID key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid VAPID key file %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID key: %w", err)
+	}
+	private, ok := key.(*ecdsa.PrivateKey)
+	if !ok || private.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("VAPID key is not a P-256 ECDSA key")
+	}
+	return &Keys{private: private}, nil
+}
+
+func createKeys(path string) (*Keys, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	// O_EXCL: if two processes create the key at the same time, the second one uses the first key
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if os.IsExist(err) {
+		return LoadKeys(filepath.Dir(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VAPID key: %w", err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write VAPID key: %w", err)
+	}
+	return &Keys{private: private}, nil
+}
+
+// PublicKey returns the public key as the browser needs it for the applicationServerKey of
+// pushManager.subscribe(): the uncompressed point, base64url encoded.
+func (k *Keys) PublicKey() string {
+	public, err := k.private.PublicKey.ECDH()
+	if err != nil {
+		// A P-256 key always converts
+		panic(err)
+	}
+	return b64.EncodeToString(public.Bytes())
+}
+
+// authorization returns the Authorization header for the push service of endpoint: a JWT
+// which is signed with the VAPID key.
+func (k *Keys) authorization(endpoint string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint: %w", err)
+	}
+	header := b64.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(12 * time.Hour).Unix(),
+		"sub": Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + b64.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, k.private, hash[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS uses the fixed size encoding of the signature, not ASN.1
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return fmt.Sprintf("vapid t=%s.%s, k=%s", unsigned, b64.EncodeToString(signature), k.PublicKey()), nil
+}
+
+// Send encrypts payload for sub and posts it to the push service. urgent messages are
+// delivered right away, also to a phone which saves battery.
+func Send(ctx context.Context, keys *Keys, sub *Subscription, payload []byte, urgent bool) error {
+	body, err := encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+	auth, err := keys.authorization(sub.Endpoint, time.Now())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Urgency", "normal")
+	if urgent {
+		req.Header.Set("Urgency", "high")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push service: %s: %s", resp.Status, strings.TrimSpace(string(text)))
+	}
+	return nil
+}
+
+// recordSize is the record size of the encrypted content. The payload is sent in one record,
+// push services accept up to 4096 bytes.
+const recordSize = 4096
+
+// MaxPayload is the size limit of a payload, see recordSize.
+const MaxPayload = recordSize - 16 - 1 - 86 // Tag, delimiter and header
+
+// encrypt encrypts payload for sub with the "aes128gcm" content encoding of RFC 8188, with
+// the keys of RFC 8291.
+func encrypt(sub *Subscription, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayload {
+		return nil, fmt.Errorf("payload of %d bytes is bigger than %d bytes", len(payload), MaxPayload)
+	}
+	uaPublicBytes, err := b64.DecodeString(strings.TrimRight(sub.Keys.P256dh, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := b64.DecodeString(strings.TrimRight(sub.Keys.Auth, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+
+	// A new key pair per message, its public key is sent in the header
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	cek, nonce, err := deriveKeys(sharedSecret, uaPublicBytes, asPublic, authSecret, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	body.Write(salt)
+	_ = binary.Write(&body, binary.BigEndian, uint32(recordSize))
+	body.WriteByte(byte(len(asPublic)))
+	body.Write(asPublic)
+	// 0x02 marks the last (and only) record
+	body.Write(gcm.Seal(nil, nonce, append(payload, 0x02), nil))
+	return body.Bytes(), nil
+}
+
+// deriveKeys returns the content encryption key and the nonce of a message, see RFC 8291
+// section 3.4. sharedSecret is the ECDH secret of the key pair of the browser (user agent, ua)
+// and the key pair of the message (application server, as).
+func deriveKeys(sharedSecret, uaPublic, asPublic, authSecret, salt []byte) (cek, nonce []byte, err error) {
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, string(keyInfo), 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	cek, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cek, nonce, nil
+}
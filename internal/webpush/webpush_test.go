@@ -0,0 +1,171 @@
+package webpush
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newBrowser returns a subscription to endpoint, with the private key of the browser.
+func newBrowser(t *testing.T, endpoint string) (*Subscription, *ecdh.PrivateKey, []byte) {
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	authSecret := make([]byte, 16)
+	_, err = rand.Read(authSecret)
+	require.NoError(t, err)
+	sub := &Subscription{Endpoint: endpoint}
+	sub.Keys.P256dh = b64.EncodeToString(private.PublicKey().Bytes())
+	sub.Keys.Auth = b64.EncodeToString(authSecret)
+	return sub, private, authSecret
+}
+
+// decrypt decrypts body like the browser does.
+func decrypt(t *testing.T, body []byte, private *ecdh.PrivateKey, authSecret []byte) []byte {
+	salt := body[:16]
+	require.Equal(t, uint32(recordSize), binary.BigEndian.Uint32(body[16:20]))
+	idLen := int(body[20])
+	asPublicBytes := body[21 : 21+idLen]
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	require.NoError(t, err)
+	sharedSecret, err := private.ECDH(asPublic)
+	require.NoError(t, err)
+	cek, nonce, err := deriveKeys(sharedSecret, private.PublicKey().Bytes(), asPublicBytes, authSecret, salt)
+	require.NoError(t, err)
+	block, err := aes.NewCipher(cek)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	plain, err := gcm.Open(nil, nonce, body[21+idLen:], nil)
+	require.NoError(t, err)
+	require.Equal(t, byte(0x02), plain[len(plain)-1])
+	return plain[:len(plain)-1]
+}
+
+func TestLoadKeys(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	keys, err := LoadKeys(stateDir)
+	require.NoError(t, err)
+	again, err := LoadKeys(stateDir)
+	require.NoError(t, err)
+	require.Equal(t, keys.PublicKey(), again.PublicKey())
+	require.Len(t, keys.PublicKey(), 87) // 65 bytes
+
+	other, err := LoadKeys(t.TempDir())
+	require.NoError(t, err)
+	require.NotEqual(t, keys.PublicKey(), other.PublicKey())
+}
+
+func TestSend(t *testing.T) {
+	t.Parallel()
+	keys, err := LoadKeys(t.TempDir())
+	require.NoError(t, err)
+
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(server.Close)
+
+	sub, private, authSecret := newBrowser(t, server.URL+"/push/abc")
+	require.NoError(t, Send(context.Background(), keys, sub, []byte(`{"title":"Failed"}`), true))
+	r := <-requests
+	require.Equal(t, "/push/abc", r.URL.Path)
+	require.Equal(t, "aes128gcm", r.Header.Get("Content-Encoding"))
+	require.Equal(t, "86400", r.Header.Get("TTL"))
+	require.Equal(t, "high", r.Header.Get("Urgency"))
+	require.Equal(t, `{"title":"Failed"}`, string(decrypt(t, <-bodies, private, authSecret)))
+
+	// The JWT is signed with the VAPID key, for the origin of the push service
+	token, publicKey, ok := strings.Cut(strings.TrimPrefix(r.Header.Get("Authorization"), "vapid t="), ", k=")
+	require.True(t, ok)
+	require.Equal(t, keys.PublicKey(), publicKey)
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+	claimsJSON, err := b64.DecodeString(parts[1])
+	require.NoError(t, err)
+	var claims struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	require.NoError(t, json.Unmarshal(claimsJSON, &claims))
+	require.Equal(t, server.URL, claims.Aud)
+	require.Equal(t, Subject, claims.Sub)
+	require.Greater(t, claims.Exp, time.Now().Unix())
+	signature, err := b64.DecodeString(parts[2])
+	require.NoError(t, err)
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.True(t, ecdsa.Verify(&keys.private.PublicKey, hash[:],
+		new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])))
+
+	require.ErrorContains(t, Send(context.Background(), keys, sub, make([]byte, MaxPayload+1), false), "bigger than")
+}
+
+func TestSendGone(t *testing.T) {
+	t.Parallel()
+	keys, err := LoadKeys(t.TempDir())
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	t.Cleanup(server.Close)
+
+	sub, _, _ := newBrowser(t, server.URL)
+	require.ErrorIs(t, Send(context.Background(), keys, sub, []byte("hello"), false), ErrGone)
+}
+
+func TestSubscriptions(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	subs, err := List(stateDir)
+	require.NoError(t, err)
+	require.Empty(t, subs)
+
+	sub, _, _ := newBrowser(t, "https://push.example.com/abc")
+	require.NoError(t, Subscribe(stateDir, sub, "Firefox"))
+	// Subscribing again replaces the subscription
+	again, _, _ := newBrowser(t, "https://push.example.com/abc")
+	require.NoError(t, Subscribe(stateDir, again, "Firefox"))
+	other, _, _ := newBrowser(t, "https://push.example.com/other")
+	require.NoError(t, Subscribe(stateDir, other, "Chrome"))
+
+	subs, err = List(stateDir)
+	require.NoError(t, err)
+	require.Len(t, subs, 2)
+	require.Equal(t, again.Keys, subs[0].Keys)
+	require.Equal(t, "Firefox", subs[0].UserAgent)
+	require.Equal(t, "Chrome", subs[1].UserAgent)
+
+	invalid, _, _ := newBrowser(t, "http://push.example.com/abc")
+	require.ErrorContains(t, Subscribe(stateDir, invalid, ""), "https")
+	invalid, _, _ = newBrowser(t, "https://push.example.com/abc")
+	invalid.Keys.P256dh = b64.EncodeToString([]byte("not a key"))
+	require.ErrorContains(t, Subscribe(stateDir, invalid, ""), "invalid p256dh key")
+
+	require.NoError(t, UnsubscribeEndpoint(stateDir, "https://push.example.com/abc"))
+	require.Error(t, Unsubscribe(stateDir, "../notify"))
+	require.NoError(t, Unsubscribe(stateDir, other.ID))
+	subs, err = List(stateDir)
+	require.NoError(t, err)
+	require.Empty(t, subs)
+}
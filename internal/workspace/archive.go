@@ -0,0 +1,254 @@
+package workspace
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"mobileshell/internal/process"
+)
+
+// ImportOptions change a workspace which gets imported, see Import.
+type ImportOptions struct {
+	// ID of the new workspace. If empty, the workspace keeps the ID of the export, unless a
+	// workspace has or had this ID, then it gets a random suffix like "<id>-k3x7q", see
+	// issueWorkspaceID. An ID which is set must not be taken.
+	ID string
+	// Directory replaces the working directory of the export, for example when the directory
+	// has a different path on the new server.
+	Directory string
+}
+
+// Export writes the workspace, with its settings, processes and output logs, as tar.gz to w.
+// The entries are in a directory named like the ID of the workspace. Temporary files and
+// special files like sockets are skipped.
+func Export(ws *Workspace, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.WalkDir(ws.Path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// A process directory can be deleted while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !entry.IsDir() && (!entry.Type().IsRegular() || strings.HasSuffix(entry.Name(), ".tmp")) {
+			return nil
+		}
+		rel, err := filepath.Rel(ws.Path, filePath)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(ws.ID, filepath.ToSlash(rel))
+		if entry.IsDir() {
+			header.Name += "/"
+		}
+		// The names of users and groups of this host mean nothing on another host
+		header.Uname, header.Gname = "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+		// The output log of a running process grows while it gets exported
+		_, err = io.Copy(tw, io.LimitReader(file, header.Size))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export workspace %q: %w", ws.ID, err)
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Import reads a workspace which was written by Export from r and adds it to stateDir. The
+// processes which were running or queued when the workspace was exported are marked as
+// finished with an unknown exit status, they don't run on this host.
+func Import(stateDir string, r io.Reader, opts ImportOptions) (*Workspace, error) {
+	directory := opts.Directory
+	if directory != "" {
+		if _, err := os.Stat(directory); err != nil {
+			return nil, fmt.Errorf("directory does not exist: %s", directory)
+		}
+	}
+	if opts.ID != "" {
+		if id, err := generateWorkspaceID(opts.ID); err != nil || id != opts.ID {
+			return nil, fmt.Errorf("invalid workspace ID %q, use lowercase letters, digits and hyphens", opts.ID)
+		}
+	}
+
+	// The workspace is extracted next to the workspaces directory, so that it is not listed
+	// before it is complete
+	tmpDir, err := os.MkdirTemp(stateDir, "import-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	exportedID, err := extract(r, tmpDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace export: %w", err)
+	}
+	extracted := &Workspace{Path: filepath.Join(tmpDir, exportedID)}
+	if err := loadWorkspaceFiles(extracted); err != nil {
+		return nil, fmt.Errorf("export contains no valid workspace: %w", err)
+	}
+	if directory == "" {
+		if _, err := os.Stat(extracted.Directory); err != nil {
+			return nil, fmt.Errorf("directory %s of the workspace does not exist, choose another one", extracted.Directory)
+		}
+		directory = extracted.Directory
+	}
+	if err := finishProcesses(extracted); err != nil {
+		return nil, err
+	}
+
+	// A chosen ID only needs to be free, so that a deleted workspace can be restored with its
+	// ID. The exported one gets a random suffix if it was given out before.
+	id := opts.ID
+	if id == "" {
+		if id, err = issueWorkspaceID(stateDir, exportedID); err != nil {
+			return nil, err
+		}
+	}
+	workspacePath := filepath.Join(stateDir, "workspaces", id)
+	if _, err := os.Stat(workspacePath); err == nil {
+		return nil, fmt.Errorf("workspace with ID '%s' already exists", id)
+	}
+	if opts.ID != "" {
+		if err := recordWorkspaceID(stateDir, id); err != nil {
+			return nil, err
+		}
+	}
+	extracted.ID = id
+	extracted.Directory = directory
+	if err := saveWorkspaceFiles(extracted); err != nil {
+		return nil, err
+	}
+	if err := InitWorkspaces(stateDir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(extracted.Path, workspacePath); err != nil {
+		return nil, fmt.Errorf("failed to move imported workspace: %w", err)
+	}
+	return GetWorkspace(stateDir, id)
+}
+
+// extract writes the entries of the tar.gz in r to dir and returns the name of the top
+// directory, which is the ID of the exported workspace.
+func extract(r io.Reader, dir string) (string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return "", err
+	}
+	tr := tar.NewReader(gz)
+	var id string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		name := path.Clean(header.Name)
+		top, _, _ := strings.Cut(name, "/")
+		if !filepath.IsLocal(filepath.FromSlash(name)) || strings.Contains(name, `\`) {
+			return "", fmt.Errorf("invalid path %q", header.Name)
+		}
+		if id == "" {
+			if validID, err := generateWorkspaceID(top); err != nil || validID != top {
+				return "", fmt.Errorf("invalid workspace ID %q", top)
+			}
+			id = top
+		}
+		if top != id {
+			return "", fmt.Errorf("%q is not in the directory of workspace %q", header.Name, id)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o700); err != nil {
+				return "", err
+			}
+		case tar.TypeReg:
+			if err := extractFile(tr, target, header); err != nil {
+				return "", err
+			}
+		default:
+			return "", fmt.Errorf("%q is not a regular file or directory", header.Name)
+		}
+	}
+	if id == "" {
+		return "", fmt.Errorf("the export is empty")
+	}
+	return id, nil
+}
+
+func extractFile(r io.Reader, target string, header *tar.Header) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		return err
+	}
+	// Only the owner gets access, like to the other files of the state directory
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(header.Mode).Perm()&0o700|0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// Keep the modification times, the retention and the replication use them
+	return os.Chtimes(target, header.ModTime, header.ModTime)
+}
+
+// finishProcesses marks the processes of ws which did not complete as finished, see Import.
+func finishProcesses(ws *Workspace) error {
+	// A workspace without processes gets an empty processes directory
+	if err := os.MkdirAll(filepath.Join(ws.Path, "processes"), 0o700); err != nil {
+		return err
+	}
+	processes, err := ListProcesses(ws)
+	if err != nil {
+		return err
+	}
+	for _, proc := range processes {
+		if proc.Completed {
+			continue
+		}
+		if process.ClaimQueued(proc.ProcessDir) {
+			err = process.MarkCancelled(proc.ProcessDir)
+		} else {
+			err = process.MarkOrphaned(proc.ProcessDir)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package workspace
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mobileshell/internal/process"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitWorkspaces(stateDir))
+	ws, err := CreateWorkspace(stateDir, "backup", t.TempDir(), "source .env")
+	require.NoError(t, err)
+	require.NoError(t, SaveIdentity(ws, "#dc3545", ""))
+	completed := filepath.Join(ws.Path, "processes", "2025-01-07T10:00:00Z")
+	require.NoError(t, os.MkdirAll(completed, 0o700))
+	for name, content := range map[string]string{"cmd": "make", "starttime": "2025-01-07T10:00:00Z", "completed": "true", "exit-status": "0", "output.log": "stdout 2025-01-07T10:00:01Z 3: ok\n"} {
+		require.NoError(t, os.WriteFile(filepath.Join(completed, name), []byte(content), 0o600))
+	}
+	running := filepath.Join(ws.Path, "processes", "2025-01-07T11:00:00Z")
+	require.NoError(t, os.MkdirAll(running, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(running, "cmd"), []byte("sleep 100"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(running, "starttime"), []byte("2025-01-07T11:00:00Z"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(running, "pid"), []byte("4242"), 0o600))
+
+	var buf bytes.Buffer
+	require.NoError(t, Export(ws, &buf))
+	exported := buf.Bytes()
+
+	// The ID is taken, the import gets a unique one
+	imported, err := Import(stateDir, bytes.NewReader(exported), ImportOptions{})
+	require.NoError(t, err)
+	require.Regexp(t, `^backup-[a-z2-7]{5}$`, imported.ID)
+	require.Equal(t, ws.Name, imported.Name)
+	require.Equal(t, ws.Directory, imported.Directory)
+	require.Equal(t, ws.PreCommand, imported.PreCommand)
+	require.Equal(t, "#dc3545", imported.Color)
+	output, err := os.ReadFile(filepath.Join(imported.Path, "processes", "2025-01-07T10:00:00Z", "output.log"))
+	require.NoError(t, err)
+	require.Contains(t, string(output), "ok")
+
+	// The running process doesn't run on this host
+	proc, err := process.LoadProcessFromDir(filepath.Join(imported.Path, "processes", "2025-01-07T11:00:00Z"))
+	require.NoError(t, err)
+	require.True(t, proc.Completed)
+	require.True(t, proc.Orphaned)
+
+	// Another state directory with another working directory
+	otherStateDir := t.TempDir()
+	otherDir := t.TempDir()
+	imported, err = Import(otherStateDir, bytes.NewReader(exported), ImportOptions{ID: "restored", Directory: otherDir})
+	require.NoError(t, err)
+	require.Equal(t, "restored", imported.ID)
+	require.Equal(t, otherDir, imported.Directory)
+	workspaces, err := ListWorkspaces(otherStateDir)
+	require.NoError(t, err)
+	require.Len(t, workspaces, 1)
+
+	_, err = Import(otherStateDir, bytes.NewReader(exported), ImportOptions{ID: "restored"})
+	require.ErrorContains(t, err, "already exists")
+	_, err = Import(otherStateDir, bytes.NewReader(exported), ImportOptions{ID: "Not Valid"})
+	require.ErrorContains(t, err, "invalid workspace ID")
+	_, err = Import(otherStateDir, bytes.NewReader(exported), ImportOptions{Directory: filepath.Join(otherDir, "missing")})
+	require.ErrorContains(t, err, "does not exist")
+
+	// Nothing of the failed imports is left
+	entries, err := os.ReadDir(otherStateDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NotContains(t, entry.Name(), "import-")
+	}
+}
+
+func TestImportRejectsUnsafePaths(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"../evil", "ws/../../evil", "/etc/evil"} {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o600, Size: 1}))
+		_, err := tw.Write([]byte("x"))
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		require.NoError(t, gz.Close())
+
+		_, err = Import(t.TempDir(), &buf, ImportOptions{})
+		require.Error(t, err, name)
+	}
+}
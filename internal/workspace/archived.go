@@ -0,0 +1,90 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+	"mobileshell/pkg/outputlog"
+)
+
+// archivedFile marks an archived workspace and contains the time it was archived. It is
+// optional.
+const archivedFile = "archived"
+
+// ErrArchived is returned by CheckCommand for archived workspaces. It wraps ErrCommandDenied.
+var ErrArchived = fmt.Errorf("%w: the workspace is archived", ErrCommandDenied)
+
+// SaveArchived archives or unarchives the workspace. An archived workspace is hidden from the
+// lists of workspaces and runs no new commands, see CheckCommand. Its processes and their
+// output are kept.
+func SaveArchived(ws *Workspace, archived bool) error {
+	path := filepath.Join(ws.Path, archivedFile)
+	if !archived {
+		if err := metadata.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s file: %w", archivedFile, err)
+		}
+		ws.ArchivedAt = time.Time{}
+		return nil
+	}
+	if ws.IsArchived() {
+		return nil
+	}
+	now := time.Now().UTC()
+	if err := metadata.WriteFile(path, []byte(now.Format(outputlog.TimeFormatRFC3339NanoUTC)), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s file: %w", archivedFile, err)
+	}
+	ws.ArchivedAt = now
+	return nil
+}
+
+// IsArchived returns true if the workspace is archived, see SaveArchived.
+func (ws *Workspace) IsArchived() bool {
+	return !ws.ArchivedAt.IsZero()
+}
+
+// loadArchived reads the archived file. It is optional. A broken time still archives the
+// workspace, with the modification time of the file.
+func loadArchived(ws *Workspace) {
+	path := filepath.Join(ws.Path, archivedFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	archivedAt, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		if info, statErr := os.Stat(path); statErr == nil {
+			archivedAt = info.ModTime().UTC()
+		}
+	}
+	ws.ArchivedAt = archivedAt
+}
+
+// WorkspaceFilter selects the workspaces of ListWorkspacesMatching. The zero value selects the
+// workspaces which are not archived.
+type WorkspaceFilter struct {
+	Archived bool // Also the archived workspaces
+}
+
+// Matches returns true if ws is selected by f.
+func (f WorkspaceFilter) Matches(ws *Workspace) bool {
+	return f.Archived || !ws.IsArchived()
+}
+
+// ListWorkspacesMatching returns the workspaces of stateDir which match filter.
+func ListWorkspacesMatching(stateDir string, filter WorkspaceFilter) ([]*Workspace, error) {
+	workspaces, err := ListWorkspaces(stateDir)
+	if err != nil {
+		return nil, err
+	}
+	var matching []*Workspace
+	for _, ws := range workspaces {
+		if filter.Matches(ws) {
+			matching = append(matching, ws)
+		}
+	}
+	return matching, nil
+}
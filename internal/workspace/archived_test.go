@@ -0,0 +1,42 @@
+package workspace
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveArchived(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws, err := CreateWorkspace(stateDir, "archived", t.TempDir(), "")
+	require.NoError(t, err)
+	_, err = CreateWorkspace(stateDir, "active", t.TempDir(), "")
+	require.NoError(t, err)
+	require.NoError(t, ws.CheckCommand("make"))
+
+	require.NoError(t, SaveArchived(ws, true))
+	require.True(t, ws.IsArchived())
+	loaded, err := GetWorkspaceByID(stateDir, "archived")
+	require.NoError(t, err)
+	require.True(t, loaded.IsArchived())
+	require.Equal(t, ws.ArchivedAt, loaded.ArchivedAt)
+	err = loaded.CheckCommand("make")
+	require.ErrorIs(t, err, ErrArchived)
+	require.True(t, errors.Is(err, ErrCommandDenied))
+
+	active, err := ListWorkspacesMatching(stateDir, WorkspaceFilter{})
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	require.Equal(t, "active", active[0].ID)
+	all, err := ListWorkspacesMatching(stateDir, WorkspaceFilter{Archived: true})
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+
+	require.NoError(t, SaveArchived(loaded, false))
+	loaded, err = GetWorkspaceByID(stateDir, "archived")
+	require.NoError(t, err)
+	require.False(t, loaded.IsArchived())
+	require.NoError(t, loaded.CheckCommand("make"))
+}
@@ -0,0 +1,173 @@
+package workspace
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"mobileshell/internal/process"
+)
+
+// The workspaces and processes are cached in memory, so that the htmx refreshes of a workspace
+// with hundreds of processes don't read thousands of small files. An entry is valid while the
+// modification time of its directory is unchanged. The metadata files are written with a
+// rename (see package metadata), which changes it.
+//
+// Directories which changed within cacheSettleTime are not cached, because the modification
+// time has a coarse resolution on some filesystems, so that a second change could keep it.
+const cacheSettleTime = 2 * time.Second
+
+type cachedProcess struct {
+	modTime time.Time
+	proc    process.Process
+}
+
+type cachedWorkspace struct {
+	modTime         time.Time // Of the workspace directory
+	profilesModTime time.Time // Of the profiles directory, its files are not in the workspace directory
+	ws              Workspace
+}
+
+var cache = struct {
+	sync.Mutex
+	// Processes by the name of their directory, by processes directory. A map is replaced, not
+	// modified, when the processes get listed.
+	processes  map[string]map[string]cachedProcess
+	workspaces map[string]cachedWorkspace // By workspace path
+}{
+	processes:  map[string]map[string]cachedProcess{},
+	workspaces: map[string]cachedWorkspace{},
+}
+
+// settled returns true if modTime is old enough to be cached, see cacheSettleTime.
+func settled(modTime time.Time) bool {
+	return time.Since(modTime) >= cacheSettleTime
+}
+
+// listProcessesCached loads the processes of the entries of processesDir. Processes whose
+// directory didn't change are taken from the cache.
+func listProcessesCached(processesDir string, entries []os.DirEntry) ([]*process.Process, error) {
+	old := cachedProcesses(processesDir)
+	fresh := make(map[string]cachedProcess, len(entries))
+	var processes []*process.Process
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		proc, err := loadProcessCached(processesDir, entry.Name(), entryModTime(entry), old, fresh)
+		if err != nil {
+			return nil, err
+		}
+		processes = append(processes, proc)
+	}
+	storeProcesses(processesDir, fresh)
+	return processes, nil
+}
+
+// cachedProcesses returns the cached processes of processesDir. The map must not be modified.
+func cachedProcesses(processesDir string) map[string]cachedProcess {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.processes[processesDir]
+}
+
+// storeProcesses replaces the cached processes of processesDir.
+func storeProcesses(processesDir string, processes map[string]cachedProcess) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.processes[processesDir] = processes
+}
+
+// entryModTime returns the modification time of entry, or the zero time if it is unknown.
+func entryModTime(entry os.DirEntry) time.Time {
+	info, err := entry.Info()
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// loadProcessCached loads the process in the directory name of processesDir, which was
+// modified at modTime. It is taken from old if it didn't change since. It is added to fresh,
+// if it can be cached.
+func loadProcessCached(processesDir, name string, modTime time.Time, old, fresh map[string]cachedProcess) (*process.Process, error) {
+	if c, ok := old[name]; ok && !modTime.IsZero() && c.modTime.Equal(modTime) {
+		fresh[name] = c
+		return cloneProcess(c.proc), nil
+	}
+	proc, err := process.LoadProcessFromDir(filepath.Join(processesDir, name))
+	if err != nil {
+		return nil, err
+	}
+	if !modTime.IsZero() && settled(modTime) {
+		fresh[name] = cachedProcess{modTime: modTime, proc: *cloneProcess(*proc)}
+	}
+	return proc, nil
+}
+
+// loadWorkspaceCached loads the workspace in workspacePath, or takes it from the cache if its
+// directories didn't change.
+func loadWorkspaceCached(workspacePath string) (*Workspace, error) {
+	var modTime, profilesModTime time.Time
+	if info, err := os.Stat(workspacePath); err == nil {
+		modTime = info.ModTime()
+	}
+	if info, err := os.Stat(filepath.Join(workspacePath, profilesDir)); err == nil {
+		profilesModTime = info.ModTime()
+	}
+	cacheable := !modTime.IsZero() && settled(modTime) && settled(profilesModTime)
+
+	if cacheable {
+		cache.Lock()
+		c, ok := cache.workspaces[workspacePath]
+		cache.Unlock()
+		if ok && c.modTime.Equal(modTime) && c.profilesModTime.Equal(profilesModTime) {
+			return cloneWorkspace(c.ws), nil
+		}
+	}
+
+	ws := &Workspace{Path: workspacePath}
+	if err := loadWorkspaceFiles(ws); err != nil {
+		return nil, err
+	}
+	if cacheable {
+		cache.Lock()
+		cache.workspaces[workspacePath] = cachedWorkspace{modTime: modTime, profilesModTime: profilesModTime, ws: *cloneWorkspace(*ws)}
+		cache.Unlock()
+	}
+	return ws, nil
+}
+
+// pruneWorkspaceCache removes the workspaces of workspacesDir which are not in paths, for
+// example because they were deleted.
+func pruneWorkspaceCache(workspacesDir string, paths map[string]bool) {
+	cache.Lock()
+	defer cache.Unlock()
+	for path := range cache.workspaces {
+		if filepath.Dir(path) == workspacesDir && !paths[path] {
+			delete(cache.workspaces, path)
+			delete(cache.processes, filepath.Join(path, "processes"))
+		}
+	}
+}
+
+// The callers may modify the returned values, so they get copies of the cached ones.
+
+func cloneProcess(p process.Process) *process.Process {
+	p.Tags = slices.Clone(p.Tags)
+	p.PipelineSteps = slices.Clone(p.PipelineSteps)
+	if p.Usage != nil {
+		usage := *p.Usage
+		p.Usage = &usage
+	}
+	return &p
+}
+
+func cloneWorkspace(ws Workspace) *Workspace {
+	ws.Profiles = maps.Clone(ws.Profiles)
+	ws.SharedWith = slices.Clone(ws.SharedWith)
+	return &ws
+}
@@ -0,0 +1,92 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mobileshell/internal/metadata"
+
+	"github.com/stretchr/testify/require"
+)
+
+// age sets the modification time of the dirs into the past, so that they are cached.
+func age(t *testing.T, dirs ...string) {
+	t.Helper()
+	past := time.Now().Add(-time.Minute)
+	for _, dir := range dirs {
+		require.NoError(t, os.Chtimes(dir, past, past))
+	}
+}
+
+func TestListProcessesCache(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws, err := CreateWorkspace(stateDir, "cache-processes", t.TempDir(), "")
+	require.NoError(t, err)
+	processDir := writeTestProcess(t, ws, "2025-01-07T10:00:00Z", false, time.Now().UTC())
+	age(t, processDir)
+
+	processes, err := ListProcesses(ws)
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+	require.False(t, processes[0].Completed)
+
+	// The returned process is a copy
+	processes[0].Tags = append(processes[0].Tags, "changed")
+	processes[0].Completed = true
+
+	// A change which keeps the modification time is not seen
+	info, err := os.Stat(processDir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "cmd"), []byte("make"), 0o600))
+	require.NoError(t, os.Chtimes(processDir, info.ModTime(), info.ModTime()))
+	processes, err = ListProcesses(ws)
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+	require.Equal(t, "ls", processes[0].Command)
+	require.Empty(t, processes[0].Tags)
+	require.False(t, processes[0].Completed)
+
+	// Metadata files are written with a rename, which changes it
+	require.NoError(t, metadata.WriteFile(filepath.Join(processDir, "completed"), []byte("true"), 0o600))
+	processes, err = ListProcesses(ws)
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+	require.Equal(t, "make", processes[0].Command)
+	require.True(t, processes[0].Completed)
+
+	require.NoError(t, DeleteProcess(ws, "2025-01-07T10:00:00Z"))
+	processes, err = ListProcesses(ws)
+	require.NoError(t, err)
+	require.Empty(t, processes)
+}
+
+func TestGetWorkspaceCache(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws, err := CreateWorkspace(stateDir, "cache-workspace", t.TempDir(), "")
+	require.NoError(t, err)
+	age(t, ws.Path)
+
+	loaded, err := GetWorkspace(stateDir, ws.ID)
+	require.NoError(t, err)
+	loaded.Name = "changed"
+	loaded, err = GetWorkspace(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Equal(t, "cache-workspace", loaded.Name)
+
+	require.NoError(t, SaveIdentity(ws, "#dc3545", ""))
+	loaded, err = GetWorkspace(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Equal(t, "#dc3545", loaded.Color)
+
+	require.NoError(t, DeleteWorkspace(ws))
+	workspaces, err := ListWorkspaces(stateDir)
+	require.NoError(t, err)
+	require.Empty(t, workspaces)
+	cache.Lock()
+	defer cache.Unlock()
+	require.NotContains(t, cache.workspaces, ws.Path)
+}
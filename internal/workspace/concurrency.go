@@ -0,0 +1,42 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"mobileshell/internal/metadata"
+)
+
+// maxConcurrentFile contains the number of processes of the workspace which run at the same
+// time. More get queued by the executor. It is optional, without it there is no limit.
+const maxConcurrentFile = "max-concurrent"
+
+// SaveMaxConcurrent sets the number of processes which run at the same time. 0 removes the
+// limit.
+func SaveMaxConcurrent(ws *Workspace, maxConcurrent int) error {
+	if maxConcurrent < 0 {
+		return fmt.Errorf("invalid maximum of concurrent processes %d: use 0 (no limit) or more", maxConcurrent)
+	}
+	path := filepath.Join(ws.Path, maxConcurrentFile)
+	if maxConcurrent == 0 {
+		if err := metadata.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s file: %w", maxConcurrentFile, err)
+		}
+	} else if err := metadata.WriteFile(path, []byte(strconv.Itoa(maxConcurrent)), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s file: %w", maxConcurrentFile, err)
+	}
+	ws.MaxConcurrent = maxConcurrent
+	return nil
+}
+
+// loadMaxConcurrent reads the max-concurrent file. It is optional.
+func loadMaxConcurrent(ws *Workspace) {
+	if data, err := os.ReadFile(filepath.Join(ws.Path, maxConcurrentFile)); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && n > 0 {
+			ws.MaxConcurrent = n
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveMaxConcurrent(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitWorkspaces(stateDir))
+	ws, err := CreateWorkspace(stateDir, "batch", t.TempDir(), "")
+	require.NoError(t, err)
+
+	require.Error(t, SaveMaxConcurrent(ws, -1))
+	require.NoError(t, SaveMaxConcurrent(ws, 2))
+	loaded, err := GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Equal(t, 2, loaded.MaxConcurrent)
+
+	require.NoError(t, SaveMaxConcurrent(loaded, 0))
+	loaded, err = GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Zero(t, loaded.MaxConcurrent)
+}
@@ -0,0 +1,125 @@
+package workspace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// historyFile stores one JSON encoded HistoryEntry per line, oldest first.
+const historyFile = "command-history"
+
+// HistoryEntry is one executed command of a workspace.
+type HistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+}
+
+// AppendHistory appends command to the command history of the workspace.
+func AppendHistory(ws *Workspace, command string) error {
+	line, err := json.Marshal(HistoryEntry{Time: time.Now().UTC(), Command: command})
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(ws.Path, historyFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open command history: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write command history: %w", err)
+	}
+	return f.Close()
+}
+
+// LoadHistory returns the commands of the workspace, most recent first and without
+// duplicates. A missing history file is not an error. Malformed lines are skipped.
+func LoadHistory(ws *Workspace) ([]string, error) {
+	entries, err := LoadHistoryEntries(ws)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(entries))
+	result := make([]string, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if seen[entries[i].Command] {
+			continue
+		}
+		seen[entries[i].Command] = true
+		result = append(result, entries[i].Command)
+	}
+	return result, nil
+}
+
+// LoadHistoryEntries returns all entries of the command history of the workspace, oldest
+// first. A missing history file is not an error. Malformed lines are skipped.
+func LoadHistoryEntries(ws *Workspace) ([]HistoryEntry, error) {
+	f, err := os.Open(filepath.Join(ws.Path, historyFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open command history: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Command == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read command history: %w", err)
+	}
+	return entries, nil
+}
+
+// SearchHistory returns up to limit commands of the history which fuzzy match query, most
+// recent first. An empty query matches all commands.
+func SearchHistory(ws *Workspace, query string, limit int) ([]string, error) {
+	commands, err := LoadHistory(ws)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, command := range commands {
+		if len(matches) >= limit {
+			break
+		}
+		if fuzzyMatch(command, query) {
+			matches = append(matches, command)
+		}
+	}
+	return matches, nil
+}
+
+// fuzzyMatch returns true if all non-space characters of query appear in s in the same
+// order, ignoring case. For example "gco" matches "git checkout".
+func fuzzyMatch(s, query string) bool {
+	remaining := []rune(strings.ToLower(s))
+	for _, q := range strings.ToLower(query) {
+		if unicode.IsSpace(q) {
+			continue
+		}
+		i := 0
+		for i < len(remaining) && remaining[i] != q {
+			i++
+		}
+		if i == len(remaining) {
+			return false
+		}
+		remaining = remaining[i+1:]
+	}
+	return true
+}
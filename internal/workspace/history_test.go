@@ -0,0 +1,51 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+	ws := &Workspace{Path: t.TempDir()}
+
+	commands, err := LoadHistory(ws)
+	require.NoError(t, err)
+	require.Empty(t, commands)
+
+	require.NoError(t, AppendHistory(ws, "make test"))
+	require.NoError(t, AppendHistory(ws, "git status"))
+	require.NoError(t, AppendHistory(ws, "make test"))
+	require.NoError(t, AppendHistory(ws, "echo \"multi\nline\""))
+
+	// Malformed lines get skipped
+	f, err := os.OpenFile(filepath.Join(ws.Path, historyFile), os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString("not json\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	commands, err = LoadHistory(ws)
+	require.NoError(t, err)
+	require.Equal(t, []string{"echo \"multi\nline\"", "make test", "git status"}, commands)
+
+	commands, err = SearchHistory(ws, "", 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"echo \"multi\nline\"", "make test"}, commands)
+
+	commands, err = SearchHistory(ws, "GS", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"git status"}, commands)
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	t.Parallel()
+	require.True(t, fuzzyMatch("git checkout main", "gco"))
+	require.True(t, fuzzyMatch("git checkout main", "git main"))
+	require.True(t, fuzzyMatch("anything", ""))
+	require.False(t, fuzzyMatch("git checkout", "ocg"))
+	require.False(t, fuzzyMatch("ls", "lss"))
+}
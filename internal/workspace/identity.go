@@ -0,0 +1,99 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"mobileshell/internal/metadata"
+)
+
+// The color and the icon make it easy to tell workspaces apart, for example "prod" and
+// "staging". Both are optional and stored in one file each.
+const (
+	colorFile       = "color"
+	iconFile        = "icon"
+	environmentFile = "environment"
+)
+
+// Environments of a workspace. Commands in production workspaces need a confirmation.
+const (
+	EnvironmentDev     = "dev"
+	EnvironmentStaging = "staging"
+	EnvironmentProd    = "prod"
+)
+
+// maxIconRunes allows emoji which consist of several code points, like flags or skin tones.
+const maxIconRunes = 8
+
+var colorRegex = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// SaveIdentity sets the color ("#rrggbb") and the icon (an emoji or a few characters) of the
+// workspace. Empty values remove them.
+func SaveIdentity(ws *Workspace, color, icon string) error {
+	color = strings.ToLower(strings.TrimSpace(color))
+	icon = strings.TrimSpace(icon)
+	if color != "" && !colorRegex.MatchString(color) {
+		return fmt.Errorf("invalid color %q: use the format #rrggbb", color)
+	}
+	if utf8.RuneCountInString(icon) > maxIconRunes || strings.ContainsFunc(icon, unicode.IsSpace) {
+		return fmt.Errorf("invalid icon %q: use an emoji or up to %d characters without spaces", icon, maxIconRunes)
+	}
+	files := map[string]string{colorFile: color, iconFile: icon}
+	for name, content := range files {
+		path := filepath.Join(ws.Path, name)
+		if content == "" {
+			if err := metadata.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove %s file: %w", name, err)
+			}
+			continue
+		}
+		if err := metadata.WriteFile(path, []byte(content), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s file: %w", name, err)
+		}
+	}
+	ws.Color = color
+	ws.Icon = icon
+	return nil
+}
+
+// SaveEnvironment sets the environment of the workspace. The empty string removes it.
+func SaveEnvironment(ws *Workspace, environment string) error {
+	path := filepath.Join(ws.Path, environmentFile)
+	switch environment {
+	case "":
+		if err := metadata.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s file: %w", environmentFile, err)
+		}
+	case EnvironmentDev, EnvironmentStaging, EnvironmentProd:
+		if err := metadata.WriteFile(path, []byte(environment), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s file: %w", environmentFile, err)
+		}
+	default:
+		return fmt.Errorf("invalid environment %q: use %s, %s or %s", environment, EnvironmentDev, EnvironmentStaging, EnvironmentProd)
+	}
+	ws.Environment = environment
+	return nil
+}
+
+// IsProduction returns true if commands in the workspace need a confirmation.
+func (ws *Workspace) IsProduction() bool {
+	return ws.Environment == EnvironmentProd
+}
+
+// loadIdentity reads the color, icon and environment files. All are optional.
+func loadIdentity(ws *Workspace) {
+	if data, err := os.ReadFile(filepath.Join(ws.Path, colorFile)); err == nil {
+		ws.Color = string(data)
+	}
+	if data, err := os.ReadFile(filepath.Join(ws.Path, iconFile)); err == nil {
+		ws.Icon = string(data)
+	}
+	if data, err := os.ReadFile(filepath.Join(ws.Path, environmentFile)); err == nil {
+		ws.Environment = string(data)
+	}
+}
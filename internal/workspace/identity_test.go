@@ -0,0 +1,53 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveIdentity(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitWorkspaces(stateDir))
+	ws, err := CreateWorkspace(stateDir, "prod", t.TempDir(), "")
+	require.NoError(t, err)
+
+	require.Error(t, SaveIdentity(ws, "red", ""))
+	require.Error(t, SaveIdentity(ws, "#ff000", ""))
+	require.Error(t, SaveIdentity(ws, "", "too long icon"))
+
+	require.NoError(t, SaveIdentity(ws, " #DC3545 ", "🔥"))
+	loaded, err := GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Equal(t, "#dc3545", loaded.Color)
+	require.Equal(t, "🔥", loaded.Icon)
+
+	// A flag consists of two code points
+	require.NoError(t, SaveIdentity(loaded, "", "🇩🇪"))
+	loaded, err = GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Empty(t, loaded.Color)
+	require.Equal(t, "🇩🇪", loaded.Icon)
+}
+
+func TestSaveEnvironment(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitWorkspaces(stateDir))
+	ws, err := CreateWorkspace(stateDir, "prod", t.TempDir(), "")
+	require.NoError(t, err)
+	require.False(t, ws.IsProduction())
+
+	require.Error(t, SaveEnvironment(ws, "production"))
+	require.NoError(t, SaveEnvironment(ws, EnvironmentProd))
+	loaded, err := GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Equal(t, EnvironmentProd, loaded.Environment)
+	require.True(t, loaded.IsProduction())
+
+	require.NoError(t, SaveEnvironment(loaded, ""))
+	loaded, err = GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Empty(t, loaded.Environment)
+}
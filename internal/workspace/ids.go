@@ -0,0 +1,163 @@
+package workspace
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"mobileshell/internal/metadata"
+)
+
+// The ID of a workspace is in its URLs, the audit log, the shares and the webhooks, so a
+// generated ID is never given to a second workspace, also not after the first one was deleted.
+// idsFile lists all IDs which were given out, one per line.
+const idsFile = "workspace-ids"
+
+// idSuffixLength is the number of random characters which make an ID unique if the slug of
+// the name was given out before, for example "frontend-k3x7q".
+const idSuffixLength = 5
+
+// legacyDirRegex matches the directories of older versions, which were named by the creation
+// date and the ID, for example "2025-12-30_frontend".
+var legacyDirRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}_(.+)$`)
+
+// idsMutex serializes the changes of idsFile. Another mobileshell process could change it at
+// the same time; a lost ID can be given out again after its workspace was deleted, two
+// workspaces never get the same ID, see CreateWorkspace.
+var idsMutex sync.Mutex
+
+// readIssuedIDs returns the IDs of idsFile and of the workspace directories.
+func readIssuedIDs(stateDir string) (map[string]bool, error) {
+	ids := map[string]bool{}
+	data, err := os.ReadFile(filepath.Join(stateDir, idsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s file: %w", idsFile, err)
+	}
+	for _, id := range strings.Fields(string(data)) {
+		ids[id] = true
+	}
+	entries, err := os.ReadDir(filepath.Join(stateDir, "workspaces"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read workspaces directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && !legacyDirRegex.MatchString(entry.Name()) {
+			ids[entry.Name()] = true
+		}
+	}
+	return ids, nil
+}
+
+// writeIssuedIDs replaces idsFile with ids.
+func writeIssuedIDs(stateDir string, ids map[string]bool) error {
+	sorted := slices.Sorted(maps.Keys(ids))
+	if err := metadata.WriteFile(filepath.Join(stateDir, idsFile), []byte(strings.Join(sorted, "\n")+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s file: %w", idsFile, err)
+	}
+	return nil
+}
+
+// issueWorkspaceID returns slug, see generateWorkspaceID, if no workspace has or had it as ID,
+// else slug with a random suffix. The ID is added to idsFile.
+func issueWorkspaceID(stateDir, slug string) (string, error) {
+	idsMutex.Lock()
+	defer idsMutex.Unlock()
+	ids, err := readIssuedIDs(stateDir)
+	if err != nil {
+		return "", err
+	}
+	id := slug
+	for ids[id] {
+		id = withRandomSuffix(slug)
+	}
+	ids[id] = true
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return id, writeIssuedIDs(stateDir, ids)
+}
+
+// recordWorkspaceID adds id, which was chosen by the user, to idsFile.
+func recordWorkspaceID(stateDir, id string) error {
+	idsMutex.Lock()
+	defer idsMutex.Unlock()
+	ids, err := readIssuedIDs(stateDir)
+	if err != nil {
+		return err
+	}
+	ids[id] = true
+	return writeIssuedIDs(stateDir, ids)
+}
+
+// withRandomSuffix appends random lowercase letters and digits to slug. The result has at
+// most the maximum length of an ID, see generateWorkspaceID.
+func withRandomSuffix(slug string) string {
+	slug = strings.TrimRight(slug[:min(len(slug), maxIDLength-idSuffixLength-1)], "-")
+	return slug + "-" + strings.ToLower(rand.Text()[:idSuffixLength])
+}
+
+// migrateWorkspaceDirs renames the directories of older versions, see legacyDirRegex, to their
+// ID. If several directories have the same ID, which happened when a workspace with the same
+// name was created on another day, the newest one keeps it, so that the URLs still show the
+// same workspace, and the others get a unique ID. Then idsFile is created if it is missing.
+func migrateWorkspaceDirs(stateDir string) error {
+	workspacesDir := filepath.Join(stateDir, "workspaces")
+	entries, err := os.ReadDir(workspacesDir)
+	if err != nil {
+		return fmt.Errorf("failed to read workspaces directory: %w", err)
+	}
+	// The names start with the date, so the newest directories come first
+	for _, entry := range slices.Backward(entries) {
+		match := legacyDirRegex.FindStringSubmatch(entry.Name())
+		if !entry.IsDir() || match == nil {
+			continue
+		}
+		legacyPath := filepath.Join(workspacesDir, entry.Name())
+		slug := match[1]
+		if data, err := os.ReadFile(filepath.Join(legacyPath, "id")); err == nil && strings.TrimSpace(string(data)) != "" {
+			slug = strings.TrimSpace(string(data))
+		}
+		if slug, err = generateWorkspaceID(slug); err != nil {
+			slog.Warn("Skipping workspace directory with invalid ID", "dir", legacyPath, "error", err)
+			continue
+		}
+		id, err := issueWorkspaceID(stateDir, slug)
+		if err != nil {
+			return err
+		}
+		// Rename first: after a crash in between, the missing id file gets repaired from the
+		// directory name on load, a stale id file would name a directory which doesn't exist
+		if err := metadata.Remove(filepath.Join(legacyPath, "id")); err != nil {
+			return fmt.Errorf("failed to remove id file: %w", err)
+		}
+		path := filepath.Join(workspacesDir, id)
+		if err := os.Rename(legacyPath, path); err != nil {
+			return fmt.Errorf("failed to rename workspace directory: %w", err)
+		}
+		if err := metadata.SyncDir(workspacesDir); err != nil {
+			return err
+		}
+		if err := metadata.WriteFile(filepath.Join(path, "id"), []byte(id), 0o600); err != nil {
+			return fmt.Errorf("failed to write id file: %w", err)
+		}
+		slog.Info("Migrated workspace directory", "from", entry.Name(), "id", id)
+	}
+
+	if _, err := os.Stat(filepath.Join(stateDir, idsFile)); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+	idsMutex.Lock()
+	defer idsMutex.Unlock()
+	ids, err := readIssuedIDs(stateDir)
+	if err != nil {
+		return err
+	}
+	return writeIssuedIDs(stateDir, ids)
+}
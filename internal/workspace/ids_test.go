@@ -0,0 +1,92 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateWorkspaceUniqueID(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	first, err := CreateWorkspace(stateDir, "Frontend", t.TempDir(), "")
+	require.NoError(t, err)
+	require.Equal(t, "frontend", first.ID)
+
+	second, err := CreateWorkspace(stateDir, "frontend", t.TempDir(), "")
+	require.NoError(t, err)
+	require.Regexp(t, `^frontend-[a-z2-7]{5}$`, second.ID)
+	require.Equal(t, "frontend", second.Name)
+
+	// The ID of a deleted workspace is not given out again
+	require.NoError(t, DeleteWorkspace(first))
+	third, err := CreateWorkspace(stateDir, "Frontend", t.TempDir(), "")
+	require.NoError(t, err)
+	require.NotEqual(t, "frontend", third.ID)
+	require.NotEqual(t, second.ID, third.ID)
+
+	long, err := CreateWorkspace(stateDir, strings.Repeat("a", 60), t.TempDir(), "")
+	require.NoError(t, err)
+	require.Len(t, long.ID, maxIDLength)
+	long, err = CreateWorkspace(stateDir, strings.Repeat("a", 60), t.TempDir(), "")
+	require.NoError(t, err)
+	require.Len(t, long.ID, maxIDLength)
+}
+
+func TestMigrateWorkspaceDirs(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	workspacesDir := filepath.Join(stateDir, "workspaces")
+	legacy := func(dirName, id string) {
+		dir := filepath.Join(workspacesDir, dirName)
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "processes"), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "directory"), []byte(t.TempDir()), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "name"), []byte(dirName), 0o600))
+		if id != "" {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "id"), []byte(id), 0o600))
+		}
+	}
+	legacy("2025-12-30_frontend", "frontend")
+	legacy("2026-01-05_frontend", "frontend")
+	legacy("2025-11-01_api", "")
+
+	require.NoError(t, InitWorkspaces(stateDir))
+
+	// The newest workspace keeps the ID
+	ws, err := GetWorkspaceByID(stateDir, "frontend")
+	require.NoError(t, err)
+	require.Equal(t, "2026-01-05_frontend", ws.Name)
+	ws, err = GetWorkspaceByID(stateDir, "api")
+	require.NoError(t, err)
+	require.Equal(t, "api", ws.ID)
+
+	workspaces, err := ListWorkspaces(stateDir)
+	require.NoError(t, err)
+	require.Len(t, workspaces, 3)
+	for _, ws := range workspaces {
+		require.Equal(t, filepath.Base(ws.Path), ws.ID)
+		if ws.Name == "2025-12-30_frontend" {
+			require.Regexp(t, `^frontend-[a-z2-7]{5}$`, ws.ID)
+		}
+	}
+
+	ids, err := os.ReadFile(filepath.Join(stateDir, idsFile))
+	require.NoError(t, err)
+	require.Len(t, strings.Fields(string(ids)), 3)
+
+	// A crash after the rename leaves the directory without id file, it gets repaired
+	require.NoError(t, os.Remove(filepath.Join(workspacesDir, "api", "id")))
+	ws, err = GetWorkspaceByID(stateDir, "api")
+	require.NoError(t, err)
+	require.Equal(t, "api", ws.ID)
+	require.FileExists(t, filepath.Join(workspacesDir, "api", "id"))
+
+	// Migrating again changes nothing
+	require.NoError(t, InitWorkspaces(stateDir))
+	again, err := ListWorkspaces(stateDir)
+	require.NoError(t, err)
+	require.ElementsMatch(t, workspaces, again)
+}
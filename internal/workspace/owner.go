@@ -0,0 +1,62 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"mobileshell/internal/metadata"
+)
+
+// The owner of a workspace is the user who created it. The owner and the users it is shared
+// with can access it, see CanAccess. Workspaces without an owner are from before named users
+// existed, everybody can access them.
+const (
+	ownerFile      = "owner"
+	sharedWithFile = "shared-with"
+)
+
+// SaveOwner sets the owner of the workspace and the users it is shared with. An empty owner
+// makes the workspace accessible to everybody, an empty sharedWith removes the sharing.
+func SaveOwner(ws *Workspace, owner string, sharedWith []string) error {
+	var shared []string
+	for _, user := range sharedWith {
+		if user = strings.TrimSpace(user); user != "" && user != owner && !slices.Contains(shared, user) {
+			shared = append(shared, user)
+		}
+	}
+	files := map[string]string{ownerFile: owner, sharedWithFile: strings.Join(shared, "\n")}
+	for name, content := range files {
+		path := filepath.Join(ws.Path, name)
+		if content == "" {
+			if err := metadata.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove %s file: %w", name, err)
+			}
+			continue
+		}
+		if err := metadata.WriteFile(path, []byte(content), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s file: %w", name, err)
+		}
+	}
+	ws.Owner = owner
+	ws.SharedWith = shared
+	return nil
+}
+
+// CanAccess returns true if user owns the workspace or it is shared with user. Checking for
+// the admin, who can access all workspaces, is up to the caller.
+func (ws *Workspace) CanAccess(user string) bool {
+	return ws.Owner == "" || ws.Owner == user || slices.Contains(ws.SharedWith, user)
+}
+
+// loadOwner reads the owner and shared-with files. Both are optional.
+func loadOwner(ws *Workspace) {
+	if data, err := os.ReadFile(filepath.Join(ws.Path, ownerFile)); err == nil {
+		ws.Owner = string(data)
+	}
+	if data, err := os.ReadFile(filepath.Join(ws.Path, sharedWithFile)); err == nil {
+		ws.SharedWith = strings.Fields(string(data))
+	}
+}
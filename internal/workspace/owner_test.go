@@ -0,0 +1,33 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveOwner(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitWorkspaces(stateDir))
+	ws, err := CreateWorkspace(stateDir, "builds", t.TempDir(), "")
+	require.NoError(t, err)
+
+	// Workspaces without owner are from before named users
+	require.True(t, ws.CanAccess("alice"))
+
+	require.NoError(t, SaveOwner(ws, "alice", []string{"bob", " bob ", "alice", ""}))
+	loaded, err := GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Equal(t, "alice", loaded.Owner)
+	require.Equal(t, []string{"bob"}, loaded.SharedWith)
+	require.True(t, loaded.CanAccess("alice"))
+	require.True(t, loaded.CanAccess("bob"))
+	require.False(t, loaded.CanAccess("carol"))
+
+	require.NoError(t, SaveOwner(loaded, "alice", nil))
+	loaded, err = GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Empty(t, loaded.SharedWith)
+	require.False(t, loaded.CanAccess("bob"))
+}
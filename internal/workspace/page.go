@@ -0,0 +1,127 @@
+package workspace
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"mobileshell/internal/process"
+)
+
+// ProcessFilter selects the processes of ListProcessesPage. Zero fields match all processes.
+type ProcessFilter struct {
+	Finished   bool   // Only completed processes, sorted by end time instead of start time
+	Tag        string // See process.SaveTags
+	OutputType string // See process.WriteOutputType
+}
+
+// processSummary holds what ListProcessesPage needs to filter and sort a process. Only the
+// files the filter needs are read.
+type processSummary struct {
+	name      string
+	modTime   time.Time
+	completed bool
+	sortTime  time.Time
+	tags      []string
+	outType   string
+}
+
+func (f ProcessFilter) matches(s processSummary) bool {
+	return (!f.Finished || s.completed) &&
+		(f.Tag == "" || slices.Contains(s.tags, f.Tag)) &&
+		(f.OutputType == "" || s.outType == f.OutputType)
+}
+
+// ListProcessesPage returns at most limit processes of ws which match filter, starting at
+// offset, and the number of all matching processes. The processes are sorted by start time,
+// or by end time if filter.Finished is set, the newest first.
+//
+// Only the processes of the page are loaded. The others are filtered and sorted with their
+// directory name, which is the start time, and the few files the filter needs, so that
+// paging through a workspace with thousands of processes stays cheap.
+func ListProcessesPage(ws *Workspace, offset, limit int, filter ProcessFilter) ([]*process.Process, int, error) {
+	processesDir := filepath.Join(ws.Path, "processes")
+	entries, err := os.ReadDir(processesDir)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read processes directory: %w", err)
+	}
+
+	old := cachedProcesses(processesDir)
+	// The cached processes which didn't change stay cached, also those not on the page
+	fresh := make(map[string]cachedProcess, len(old))
+	var summaries []processSummary
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		modTime := entryModTime(entry)
+		if c, ok := old[entry.Name()]; ok && c.modTime.Equal(modTime) {
+			fresh[entry.Name()] = c
+		}
+		s := summarizeProcess(processesDir, entry.Name(), modTime, old, filter)
+		if filter.matches(s) {
+			summaries = append(summaries, s)
+		}
+	}
+	slices.SortFunc(summaries, func(a, b processSummary) int {
+		return cmp.Or(b.sortTime.Compare(a.sortTime), strings.Compare(b.name, a.name))
+	})
+
+	total := len(summaries)
+	start := min(max(offset, 0), total)
+	end := min(start+max(limit, 0), total)
+
+	var processes []*process.Process
+	for _, s := range summaries[start:end] {
+		proc, err := loadProcessCached(processesDir, s.name, s.modTime, old, fresh)
+		if err != nil {
+			return nil, 0, err
+		}
+		processes = append(processes, proc)
+	}
+	storeProcesses(processesDir, fresh)
+	return processes, total, nil
+}
+
+// summarizeProcess returns the summary of the process in the directory name of processesDir,
+// from the cache if its directory didn't change.
+func summarizeProcess(processesDir, name string, modTime time.Time, old map[string]cachedProcess, filter ProcessFilter) processSummary {
+	s := processSummary{name: name, modTime: modTime}
+	// The ID of a process is the time it was created, see executor.createProcess. The
+	// starttime file of a queued process is later.
+	s.sortTime, _ = time.Parse(time.RFC3339Nano, name)
+	if c, ok := old[name]; ok && !modTime.IsZero() && c.modTime.Equal(modTime) {
+		s.completed = c.proc.Completed
+		if filter.Finished {
+			s.sortTime = c.proc.EndTime
+		}
+		s.tags = c.proc.Tags
+		s.outType = c.proc.ContentType
+		return s
+	}
+
+	processDir := filepath.Join(processesDir, name)
+	if filter.Finished {
+		// The end time is written before the completed file, a process which has one is
+		// completed when it is loaded, see process.Complete
+		if data, err := os.ReadFile(filepath.Join(processDir, "endtime")); err == nil {
+			s.completed = true
+			s.sortTime, _ = time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+		} else {
+			data, _ := os.ReadFile(filepath.Join(processDir, "completed"))
+			s.completed = strings.TrimSpace(string(data)) == "true"
+			s.sortTime = time.Time{}
+		}
+	}
+	if filter.Tag != "" {
+		s.tags = process.ReadTags(processDir)
+	}
+	if filter.OutputType != "" {
+		s.outType, _ = process.ReadOutputType(processDir)
+	}
+	return s
+}
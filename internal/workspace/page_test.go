@@ -0,0 +1,77 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mobileshell/internal/process"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListProcessesPage(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws, err := CreateWorkspace(stateDir, "page", t.TempDir(), "")
+	require.NoError(t, err)
+	base := time.Date(2025, 1, 7, 10, 0, 0, 0, time.UTC)
+	// Started in this order, finished in the reverse order
+	for i := range 5 {
+		commandId := base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339Nano)
+		writeTestProcess(t, ws, commandId, true, base.Add(time.Hour-time.Duration(i)*time.Minute))
+	}
+	running := base.Add(time.Hour).Format(time.RFC3339Nano)
+	writeTestProcess(t, ws, running, false, time.Time{})
+	proc, err := process.LoadProcessFromDir(GetProcessDir(ws, "2025-01-07T10:01:00Z"))
+	require.NoError(t, err)
+	require.NoError(t, process.SaveTags(proc, []string{"deploy"}))
+	require.NoError(t, process.WriteOutputType(GetProcessDir(ws, "2025-01-07T10:02:00Z"), "json", "valid JSON"))
+
+	ids := func(processes []*process.Process) []string {
+		var ids []string
+		for _, p := range processes {
+			ids = append(ids, p.CommandId)
+		}
+		return ids
+	}
+
+	processes, total, err := ListProcessesPage(ws, 0, 2, ProcessFilter{})
+	require.NoError(t, err)
+	require.Equal(t, 6, total)
+	require.Equal(t, []string{running, "2025-01-07T10:04:00Z"}, ids(processes))
+
+	processes, total, err = ListProcessesPage(ws, 0, 2, ProcessFilter{Finished: true})
+	require.NoError(t, err)
+	require.Equal(t, 5, total)
+	require.Equal(t, []string{"2025-01-07T10:00:00Z", "2025-01-07T10:01:00Z"}, ids(processes))
+
+	processes, total, err = ListProcessesPage(ws, 4, 2, ProcessFilter{Finished: true})
+	require.NoError(t, err)
+	require.Equal(t, 5, total)
+	require.Equal(t, []string{"2025-01-07T10:04:00Z"}, ids(processes))
+
+	processes, total, err = ListProcessesPage(ws, 10, 2, ProcessFilter{Finished: true})
+	require.NoError(t, err)
+	require.Equal(t, 5, total)
+	require.Empty(t, processes)
+
+	processes, total, err = ListProcessesPage(ws, 0, 10, ProcessFilter{Finished: true, Tag: "deploy"})
+	require.NoError(t, err)
+	require.Equal(t, 1, total)
+	require.Equal(t, []string{"2025-01-07T10:01:00Z"}, ids(processes))
+
+	processes, total, err = ListProcessesPage(ws, 0, 10, ProcessFilter{OutputType: "json"})
+	require.NoError(t, err)
+	require.Equal(t, 1, total)
+	require.Equal(t, []string{"2025-01-07T10:02:00Z"}, ids(processes))
+
+	// Processes which are not on the page are not loaded
+	require.NoError(t, os.Remove(filepath.Join(GetProcessDir(ws, "2025-01-07T10:04:00Z"), "cmd")))
+	processes, _, err = ListProcessesPage(ws, 0, 2, ProcessFilter{Finished: true})
+	require.NoError(t, err)
+	require.Len(t, processes, 2)
+	_, _, err = ListProcessesPage(ws, 4, 2, ProcessFilter{Finished: true})
+	require.Error(t, err)
+}
@@ -0,0 +1,189 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mobileshell/internal/metadata"
+)
+
+// commandPolicyFile restricts the commands of the workspace, see ParseCommandPolicy. It is
+// optional, without it all commands are allowed.
+const commandPolicyFile = "command-policy"
+
+// ErrCommandDenied is wrapped by the errors of CheckCommand.
+var ErrCommandDenied = errors.New("command denied by the policy of the workspace")
+
+// policyRule is a regular expression of a command policy, with the line which defined it for
+// the error messages.
+type policyRule struct {
+	regex  *regexp.Regexp
+	source string
+}
+
+// policyPresets are the named deny rules which can be enabled with "preset <name>".
+var policyPresets = map[string][]string{
+	"no-destructive": {
+		`\brm\s+(-\S*\s+)*-\S*[rR]`,                 // Recursive deletes
+		`\bmkfs(\.\w+)?\b`,                          // Formatting file systems
+		`\bdd\b.*\bof=`,                             // Writing to devices
+		`\b(shutdown|reboot|poweroff|halt)\b`,       // Stopping the machine
+		`\bgit\s+push\b.*(\s-f\b|--force)`,          // Rewriting remote history
+		`\bgit\s+(reset\s+--hard|clean\s+-\S*f)`,    // Dropping local changes
+		`\b(chmod|chown)\s+(-\S*\s+)*-\S*R`,         // Recursive permission changes
+		`>\s*/dev/(sd|nvme|vd|xvd|mmcblk)`,          // Overwriting disks
+		`:\(\)\s*\{`,                                // Fork bomb
+		`\bkill\s+-(9|KILL|SIGKILL)\s+-1\b`,         // Killing all processes
+		`\b(DROP|TRUNCATE)\s+(TABLE|DATABASE)\b`,    // Dropping data in SQL shells
+		`\bkubectl\s+delete\b`,                      // Deleting Kubernetes resources
+		`\bdocker\s+(system\s+prune|volume\s+rm)\b`, // Deleting Docker data
+	},
+	"no-sudo": {
+		`\b(sudo|su|doas|pkexec)\b`,
+	},
+}
+
+// CommandPolicy restricts the commands which can run in a workspace. A command is denied if it
+// matches a deny rule or a rule of a preset, or if there are allow rules and a line of the
+// command matches none of them. The policy is a guard rail against mistakes, not a sandbox:
+// an allowed shell can run any command.
+type CommandPolicy struct {
+	allow []policyRule
+	deny  []policyRule
+}
+
+// ParseCommandPolicy parses the content of a policy file. Each line is one of:
+//
+//	allow <regex>   Commands must match one of the allow rules
+//	deny <regex>    Commands must not match any deny rule
+//	preset <name>   Adds the deny rules of a preset, see PolicyPresetNames
+//
+// Empty lines and lines starting with "#" are ignored.
+func ParseCommandPolicy(content string) (*CommandPolicy, error) {
+	p := &CommandPolicy{}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kind, value, _ := strings.Cut(line, " ")
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, fmt.Errorf("line %d: missing value after %q", i+1, kind)
+		}
+		switch kind {
+		case "allow", "deny":
+			regex, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid regular expression: %w", i+1, err)
+			}
+			rule := policyRule{regex: regex, source: line}
+			if kind == "allow" {
+				p.allow = append(p.allow, rule)
+			} else {
+				p.deny = append(p.deny, rule)
+			}
+		case "preset":
+			patterns, ok := policyPresets[value]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown preset %q, use one of: %s", i+1, value, strings.Join(PolicyPresetNames(), ", "))
+			}
+			for _, pattern := range patterns {
+				p.deny = append(p.deny, policyRule{regex: regexp.MustCompile(pattern), source: line})
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown rule %q, use allow, deny or preset", i+1, kind)
+		}
+	}
+	return p, nil
+}
+
+// PolicyPresetNames returns the names of the presets, sorted.
+func PolicyPresetNames() []string {
+	names := make([]string, 0, len(policyPresets))
+	for name := range policyPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check returns an error which wraps ErrCommandDenied if the policy denies the command.
+func (p *CommandPolicy) Check(command string) error {
+	for _, rule := range p.deny {
+		if rule.regex.MatchString(command) {
+			return fmt.Errorf("%w: %q matches %q", ErrCommandDenied, command, rule.source)
+		}
+	}
+	if len(p.allow) == 0 {
+		return nil
+	}
+	// Each line must be allowed, so that an allowed first line doesn't allow the rest
+	for _, line := range strings.Split(command, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		allowed := false
+		for _, rule := range p.allow {
+			if rule.regex.MatchString(line) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: %q matches no allow rule", ErrCommandDenied, line)
+		}
+	}
+	return nil
+}
+
+// SaveCommandPolicy validates and sets the command policy of the workspace. The empty string
+// removes it.
+func SaveCommandPolicy(ws *Workspace, content string) error {
+	content = strings.TrimSpace(strings.ReplaceAll(content, "\r\n", "\n"))
+	path := filepath.Join(ws.Path, commandPolicyFile)
+	if content == "" {
+		if err := metadata.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s file: %w", commandPolicyFile, err)
+		}
+		ws.CommandPolicy = ""
+		return nil
+	}
+	if _, err := ParseCommandPolicy(content); err != nil {
+		return fmt.Errorf("invalid command policy: %w", err)
+	}
+	if err := metadata.WriteFile(path, []byte(content+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s file: %w", commandPolicyFile, err)
+	}
+	ws.CommandPolicy = content
+	return nil
+}
+
+// CheckCommand returns an error which wraps ErrCommandDenied if the command policy of the
+// workspace denies the command. A policy file which can't be parsed, for example after it was
+// edited by hand, denies all commands. Archived workspaces deny all commands with ErrArchived.
+func (ws *Workspace) CheckCommand(command string) error {
+	if ws.IsArchived() {
+		return ErrArchived
+	}
+	if ws.CommandPolicy == "" {
+		return nil
+	}
+	p, err := ParseCommandPolicy(ws.CommandPolicy)
+	if err != nil {
+		return fmt.Errorf("%w: the policy is invalid: %v", ErrCommandDenied, err)
+	}
+	return p.Check(command)
+}
+
+// loadCommandPolicy reads the command policy file. It is optional.
+func loadCommandPolicy(ws *Workspace) {
+	if data, err := os.ReadFile(filepath.Join(ws.Path, commandPolicyFile)); err == nil {
+		ws.CommandPolicy = strings.TrimSpace(string(data))
+	}
+}
@@ -0,0 +1,75 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandPolicyCheck(t *testing.T) {
+	t.Parallel()
+	p, err := ParseCommandPolicy("# Teammates may only build and look around\nallow ^(make|go|git|ls)\\b\ndeny ^git\\s+push\\b\npreset no-sudo\n")
+	require.NoError(t, err)
+
+	require.NoError(t, p.Check("make test"))
+	require.NoError(t, p.Check("git status\nls -la"))
+	require.ErrorIs(t, p.Check("git push origin main"), ErrCommandDenied)
+	require.ErrorIs(t, p.Check("sudo make install"), ErrCommandDenied)
+	require.ErrorIs(t, p.Check("curl example.com"), ErrCommandDenied)
+	// Each line of a command must be allowed
+	err = p.Check("git status\ncurl example.com")
+	require.ErrorIs(t, err, ErrCommandDenied)
+	require.Contains(t, err.Error(), `"curl example.com" matches no allow rule`)
+}
+
+func TestCommandPolicyNoDestructivePreset(t *testing.T) {
+	t.Parallel()
+	p, err := ParseCommandPolicy("preset no-destructive")
+	require.NoError(t, err)
+	for _, command := range []string{"rm -rf /tmp/x", "rm -v -r build", "git push --force", "git reset --hard HEAD~1", "dd if=x of=/dev/sda", "chmod -R 777 ."} {
+		err := p.Check(command)
+		require.ErrorIs(t, err, ErrCommandDenied, command)
+		require.Contains(t, err.Error(), `"preset no-destructive"`)
+	}
+	for _, command := range []string{"rm file.txt", "git push", "ls -R", "chmod +x run.sh"} {
+		require.NoError(t, p.Check(command), command)
+	}
+}
+
+func TestParseCommandPolicyErrors(t *testing.T) {
+	t.Parallel()
+	for content, message := range map[string]string{
+		"allow (":          "line 1: invalid regular expression",
+		"\npreset unknown": `line 2: unknown preset "unknown"`,
+		"permit ls":        `unknown rule "permit"`,
+		"deny":             `missing value after "deny"`,
+	} {
+		_, err := ParseCommandPolicy(content)
+		require.ErrorContains(t, err, message, content)
+	}
+}
+
+func TestSaveCommandPolicy(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitWorkspaces(stateDir))
+	ws, err := CreateWorkspace(stateDir, "shared", t.TempDir(), "")
+	require.NoError(t, err)
+	require.NoError(t, ws.CheckCommand("rm -rf build"))
+
+	require.Error(t, SaveCommandPolicy(ws, "allow ("))
+	require.NoError(t, SaveCommandPolicy(ws, "preset no-destructive\r\n"))
+	loaded, err := GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Equal(t, "preset no-destructive", loaded.CommandPolicy)
+	require.ErrorIs(t, loaded.CheckCommand("rm -rf build"), ErrCommandDenied)
+
+	// A broken policy file denies everything
+	loaded.CommandPolicy = "allow ("
+	require.ErrorIs(t, loaded.CheckCommand("ls"), ErrCommandDenied)
+
+	require.NoError(t, SaveCommandPolicy(loaded, ""))
+	loaded, err = GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Empty(t, loaded.CommandPolicy)
+}
@@ -0,0 +1,63 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"mobileshell/internal/metadata"
+	"mobileshell/internal/process"
+)
+
+// Files of the default priorities of the processes of the workspace. They are optional, a
+// process which sets no priority of its own gets them.
+const (
+	niceFile       = "nice"
+	ioPriorityFile = "io-priority"
+)
+
+// SavePriority sets the default niceness and IO priority of the processes, see
+// process.Limits. 0 and the empty string remove them.
+func SavePriority(ws *Workspace, nice int, ioPriority string) error {
+	if err := process.ValidatePriority(nice, ioPriority); err != nil {
+		return err
+	}
+	files := map[string]string{niceFile: "", ioPriorityFile: ioPriority}
+	if nice > 0 {
+		files[niceFile] = strconv.Itoa(nice)
+	}
+	for name, content := range files {
+		path := filepath.Join(ws.Path, name)
+		if content == "" {
+			if err := metadata.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove %s file: %w", name, err)
+			}
+		} else if err := metadata.WriteFile(path, []byte(content), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s file: %w", name, err)
+		}
+	}
+	ws.Nice = nice
+	ws.IOPriority = ioPriority
+	return nil
+}
+
+// loadPriority reads the nice and io-priority files. They are optional, invalid values are
+// ignored.
+func loadPriority(ws *Workspace) {
+	var nice int
+	var ioPriority string
+	if data, err := os.ReadFile(filepath.Join(ws.Path, niceFile)); err == nil {
+		nice, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	if data, err := os.ReadFile(filepath.Join(ws.Path, ioPriorityFile)); err == nil {
+		ioPriority = strings.TrimSpace(string(data))
+	}
+	if process.ValidatePriority(nice, "") == nil {
+		ws.Nice = nice
+	}
+	if process.ValidatePriority(0, ioPriority) == nil {
+		ws.IOPriority = ioPriority
+	}
+}
@@ -0,0 +1,31 @@
+package workspace
+
+import (
+	"testing"
+
+	"mobileshell/internal/process"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavePriority(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitWorkspaces(stateDir))
+	ws, err := CreateWorkspace(stateDir, "batch", t.TempDir(), "")
+	require.NoError(t, err)
+
+	require.Error(t, SavePriority(ws, 20, ""))
+	require.Error(t, SavePriority(ws, 0, "realtime"))
+	require.NoError(t, SavePriority(ws, 10, process.IOPriorityIdle))
+	loaded, err := GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Equal(t, 10, loaded.Nice)
+	require.Equal(t, process.IOPriorityIdle, loaded.IOPriority)
+
+	require.NoError(t, SavePriority(loaded, 0, ""))
+	loaded, err = GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Zero(t, loaded.Nice)
+	require.Empty(t, loaded.IOPriority)
+}
@@ -0,0 +1,91 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"mobileshell/internal/metadata"
+)
+
+// profilesDir contains one file per profile. The file name is the profile name, the content
+// is the pre-command.
+const profilesDir = "profiles"
+
+var profileNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_ .-]{0,63}$`)
+
+// SaveProfiles replaces the pre-command profiles of the workspace. Profiles with an empty
+// pre-command are dropped.
+func SaveProfiles(ws *Workspace, profiles map[string]string) error {
+	normalized := make(map[string]string, len(profiles))
+	for name, preCommand := range profiles {
+		if !profileNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid profile name %q: use letters, digits, spaces, '_', '.' and '-'", name)
+		}
+		if preCommand = normalizePreCommand(preCommand); preCommand != "" {
+			normalized[name] = preCommand
+		}
+	}
+
+	dir := filepath.Join(ws.Path, profilesDir)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove profiles directory: %w", err)
+	}
+	if len(normalized) > 0 {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("failed to create profiles directory: %w", err)
+		}
+	}
+	for name, preCommand := range normalized {
+		if err := metadata.WriteFile(filepath.Join(dir, name), []byte(preCommand), 0o600); err != nil {
+			return fmt.Errorf("failed to write profile %q: %w", name, err)
+		}
+	}
+	ws.Profiles = normalized
+	return nil
+}
+
+// loadProfiles reads the profiles directory. It is optional.
+func loadProfiles(ws *Workspace) error {
+	entries, err := os.ReadDir(filepath.Join(ws.Path, profilesDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read profiles directory: %w", err)
+	}
+	ws.Profiles = make(map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(ws.Path, profilesDir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read profile %q: %w", entry.Name(), err)
+		}
+		ws.Profiles[entry.Name()] = string(data)
+	}
+	return nil
+}
+
+// ProfileNames returns the names of the profiles, sorted.
+func (ws *Workspace) ProfileNames() []string {
+	names := make([]string, 0, len(ws.Profiles))
+	for name := range ws.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PreCommandForProfile returns the pre-command of the profile. The empty profile name selects
+// the default pre-command of the workspace.
+func (ws *Workspace) PreCommandForProfile(profile string) (string, error) {
+	if profile == "" {
+		return ws.PreCommand, nil
+	}
+	preCommand, ok := ws.Profiles[profile]
+	if !ok {
+		return "", fmt.Errorf("workspace %q has no profile %q", ws.ID, profile)
+	}
+	return preCommand, nil
+}
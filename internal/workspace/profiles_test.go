@@ -0,0 +1,40 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiles(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitWorkspaces(stateDir))
+	ws, err := CreateWorkspace(stateDir, "profiles", t.TempDir(), "source .env")
+	require.NoError(t, err)
+
+	require.Error(t, SaveProfiles(ws, map[string]string{"../evil": "true"}))
+	require.NoError(t, SaveProfiles(ws, map[string]string{
+		"prod env":    "source .env.prod",
+		"staging env": "source .env.staging",
+		"empty":       "  ",
+	}))
+
+	loaded, err := GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"prod env", "staging env"}, loaded.ProfileNames())
+
+	preCommand, err := loaded.PreCommandForProfile("prod env")
+	require.NoError(t, err)
+	require.Equal(t, "#!/usr/bin/env bash\nsource .env.prod", preCommand)
+	preCommand, err = loaded.PreCommandForProfile("")
+	require.NoError(t, err)
+	require.Equal(t, "#!/usr/bin/env bash\nsource .env", preCommand)
+	_, err = loaded.PreCommandForProfile("unknown")
+	require.Error(t, err)
+
+	require.NoError(t, SaveProfiles(loaded, nil))
+	loaded, err = GetWorkspaceByID(stateDir, ws.ID)
+	require.NoError(t, err)
+	require.Empty(t, loaded.ProfileNames())
+}
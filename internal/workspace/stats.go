@@ -0,0 +1,71 @@
+package workspace
+
+import (
+	"slices"
+	"time"
+
+	"mobileshell/internal/process"
+)
+
+// CommandStats are the statistics of the completed runs of a command in a workspace, see
+// CommandStatistics.
+type CommandStats struct {
+	Runs      int           // Completed runs
+	Succeeded int           // Runs which exited with 0 and were not killed
+	P50       time.Duration // Median duration of the runs
+	P95       time.Duration // 95th percentile of the durations of the runs
+}
+
+// SuccessPercent returns the percentage of the runs which succeeded, rounded down.
+func (s CommandStats) SuccessPercent() int {
+	if s.Runs == 0 {
+		return 0
+	}
+	return s.Succeeded * 100 / s.Runs
+}
+
+// CommandStatistics returns the statistics of the completed processes of ws by command, so
+// that a run can be compared with the previous ones. Orphaned and cancelled processes are
+// skipped, they have no exit status.
+func CommandStatistics(ws *Workspace) (map[string]CommandStats, error) {
+	processes, err := ListProcesses(ws)
+	if err != nil {
+		return nil, err
+	}
+	durations := map[string][]time.Duration{}
+	stats := map[string]CommandStats{}
+	for _, p := range processes {
+		if !p.Completed || p.Orphaned || p.Cancelled || p.StartTime.IsZero() || p.EndTime.IsZero() {
+			continue
+		}
+		s := stats[p.Command]
+		s.Runs++
+		if succeeded(p) {
+			s.Succeeded++
+		}
+		stats[p.Command] = s
+		durations[p.Command] = append(durations[p.Command], max(p.EndTime.Sub(p.StartTime), 0))
+	}
+	for command, d := range durations {
+		slices.Sort(d)
+		s := stats[command]
+		s.P50 = percentile(d, 50)
+		s.P95 = percentile(d, 95)
+		stats[command] = s
+	}
+	return stats, nil
+}
+
+// succeeded returns true if the completed process exited with 0 and was not killed.
+func succeeded(p *process.Process) bool {
+	return p.ExitCode == 0 && p.Signal == "" && !p.TimedOut
+}
+
+// percentile returns the p-th percentile of the sorted durations with the nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,54 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"mobileshell/internal/process"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandStatistics(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws, err := CreateWorkspace(stateDir, "stats", t.TempDir(), "")
+	require.NoError(t, err)
+	base := time.Date(2025, 1, 7, 10, 0, 0, 0, time.UTC)
+	run := func(i int, command string, duration time.Duration, exitCode int) string {
+		start := base.Add(time.Duration(i) * time.Hour)
+		processDir := GetProcessDir(ws, start.Format(time.RFC3339Nano))
+		require.NoError(t, os.MkdirAll(processDir, 0o700))
+		for name, content := range map[string]string{
+			"cmd":         command,
+			"starttime":   start.Format(time.RFC3339Nano),
+			"endtime":     start.Add(duration).Format(time.RFC3339Nano),
+			"exit-status": strconv.Itoa(exitCode),
+			"completed":   "true",
+		} {
+			require.NoError(t, os.WriteFile(filepath.Join(processDir, name), []byte(content), 0o600))
+		}
+		return processDir
+	}
+	// 20 runs of 1 to 20 minutes, the last two failed
+	for i := range 20 {
+		exitCode := 0
+		if i >= 18 {
+			exitCode = 2
+		}
+		run(i, "make test", time.Duration(i+1)*time.Minute, exitCode)
+	}
+	run(20, "ls", 0, 0)
+	require.NoError(t, process.MarkOrphaned(run(21, "ls", time.Hour, 0)))
+	writeTestProcess(t, ws, base.Add(22*time.Hour).Format(time.RFC3339Nano), false, time.Time{})
+
+	stats, err := CommandStatistics(ws)
+	require.NoError(t, err)
+	require.Equal(t, CommandStats{Runs: 20, Succeeded: 18, P50: 10 * time.Minute, P95: 19 * time.Minute}, stats["make test"])
+	require.Equal(t, 90, stats["make test"].SuccessPercent())
+	require.Equal(t, CommandStats{Runs: 1, Succeeded: 1}, stats["ls"])
+	require.Len(t, stats, 2)
+}
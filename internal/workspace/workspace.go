@@ -2,33 +2,50 @@ package workspace
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"mobileshell/internal/metadata"
 	"mobileshell/internal/process"
 	"mobileshell/pkg/outputlog"
 )
 
 // Workspace represents a workspace with a name, directory, and pre-command
 type Workspace struct {
-	ID                     string    `json:"id"`   // URL-safe immutable identifier
-	Name                   string    `json:"name"` // Display name (can be changed)
-	Directory              string    `json:"directory"`
-	PreCommand             string    `json:"pre_command"`
-	DefaultTerminalCommand string    `json:"default_terminal_command"` // Default command for interactive terminal (empty means auto-detect)
-	CreatedAt              time.Time `json:"created_at"`
-	Path                   string    `json:"path"` // Full path to workspace directory
+	ID                     string            `json:"id"`   // URL-safe immutable identifier
+	Name                   string            `json:"name"` // Display name (can be changed)
+	Directory              string            `json:"directory"`
+	PreCommand             string            `json:"pre_command"`
+	DefaultTerminalCommand string            `json:"default_terminal_command"` // Default command for interactive terminal (empty means auto-detect)
+	Profiles               map[string]string `json:"profiles,omitempty"`       // Named pre-commands which can be selected instead of PreCommand
+	Color                  string            `json:"color,omitempty"`          // Accent color "#rrggbb", see SaveIdentity
+	Icon                   string            `json:"icon,omitempty"`           // Emoji shown in front of the name, see SaveIdentity
+	Environment            string            `json:"environment,omitempty"`    // EnvironmentDev, EnvironmentStaging, EnvironmentProd or empty
+	Owner                  string            `json:"owner,omitempty"`          // User who created the workspace, see SaveOwner
+	SharedWith             []string          `json:"shared_with,omitempty"`    // Other users who can access the workspace
+	CommandPolicy          string            `json:"command_policy,omitempty"` // Restricts the commands, see ParseCommandPolicy
+	MaxConcurrent          int               `json:"max_concurrent,omitempty"` // Processes which run at the same time, more get queued, 0: no limit
+	Nice                   int               `json:"nice,omitempty"`           // Default niceness of the processes, 0: unchanged
+	IOPriority             string            `json:"io_priority,omitempty"`    // Default IO priority of the processes, see process.IOPriorityLow
+	ArchivedAt             time.Time         `json:"archived_at,omitzero"`     // Zero if the workspace is not archived, see SaveArchived
+	CreatedAt              time.Time         `json:"created_at"`
+	Path                   string            `json:"path"` // Full path to workspace directory
 }
 
-// InitWorkspaces creates the workspaces directory
+// maxIDLength is the maximum length of a workspace ID.
+const maxIDLength = 50
+
+// InitWorkspaces creates the workspaces directory and migrates the directories of older
+// versions, see migrateWorkspaceDirs.
 func InitWorkspaces(stateDir string) error {
 	workspacesDir := filepath.Join(stateDir, "workspaces")
 	if err := os.MkdirAll(workspacesDir, 0o700); err != nil {
 		return fmt.Errorf("failed to create workspaces directory: %w", err)
 	}
-	return nil
+	return migrateWorkspaceDirs(stateDir)
 }
 
 // CreateWorkspace creates a new workspace with the given name, directory, and pre-command
@@ -41,26 +58,33 @@ func CreateWorkspace(stateDir, name, directory, preCommand string) (*Workspace,
 		return nil, fmt.Errorf("failed to stat directory: %w", err)
 	}
 
-	// Generate URL-safe ID from name
-	id, err := generateWorkspaceID(name)
+	// Generate URL-safe ID from name, with a random suffix if another workspace has or had it
+	slug, err := generateWorkspaceID(name)
+	if err != nil {
+		return nil, err
+	}
+	id, err := issueWorkspaceID(stateDir, slug)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create directory name: ID
-	workspacePath := filepath.Join(stateDir, "workspaces", id)
+	workspacesDir := filepath.Join(stateDir, "workspaces")
+	workspacePath := filepath.Join(workspacesDir, id)
 
-	// Check if workspace with this ID already exists
-	if _, err := os.Stat(workspacePath); err == nil {
-		return nil, fmt.Errorf("workspace with ID '%s' already exists", id)
+	// The workspace is created in a hidden directory, which ListWorkspaces skips, and renamed
+	// when its files are complete
+	if err := os.MkdirAll(workspacesDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create workspaces directory: %w", err)
 	}
-
-	if err := os.MkdirAll(workspacePath, 0o700); err != nil {
+	tmpPath, err := os.MkdirTemp(workspacesDir, "."+id+"-")
+	if err != nil {
 		return nil, fmt.Errorf("failed to create workspace directory: %w", err)
 	}
+	defer func() { _ = os.RemoveAll(tmpPath) }()
 
 	// Create processes subdirectory
-	processesDir := filepath.Join(workspacePath, "processes")
+	processesDir := filepath.Join(tmpPath, "processes")
 	if err := os.MkdirAll(processesDir, 0o700); err != nil {
 		return nil, fmt.Errorf("failed to create processes directory: %w", err)
 	}
@@ -71,7 +95,7 @@ func CreateWorkspace(stateDir, name, directory, preCommand string) (*Workspace,
 		Directory:  directory,
 		PreCommand: normalizePreCommand(preCommand),
 		CreatedAt:  time.Now().UTC(),
-		Path:       workspacePath,
+		Path:       tmpPath,
 	}
 
 	// Save workspace metadata as individual files
@@ -79,6 +103,18 @@ func CreateWorkspace(stateDir, name, directory, preCommand string) (*Workspace,
 		return nil, err
 	}
 
+	// Renaming fails if another workspace with this ID was created in the meantime
+	if err := os.Rename(tmpPath, workspacePath); err != nil {
+		if _, statErr := os.Stat(workspacePath); statErr == nil {
+			return nil, fmt.Errorf("workspace with ID '%s' already exists", id)
+		}
+		return nil, fmt.Errorf("failed to create workspace directory: %w", err)
+	}
+	if err := metadata.SyncDir(workspacesDir); err != nil {
+		return nil, err
+	}
+	ws.Path = workspacePath
+
 	return ws, nil
 }
 
@@ -86,16 +122,8 @@ func CreateWorkspace(stateDir, name, directory, preCommand string) (*Workspace,
 func GetWorkspace(stateDir, dirName string) (*Workspace, error) {
 	workspacePath := filepath.Join(stateDir, "workspaces", dirName)
 
-	ws := &Workspace{
-		Path: workspacePath,
-	}
-
-	// Read individual files
-	if err := loadWorkspaceFiles(ws); err != nil {
-		return nil, err
-	}
-
-	return ws, nil
+	// Read individual files, or take them from the cache
+	return loadWorkspaceCached(workspacePath)
 }
 
 // GetWorkspaceByID retrieves a workspace by its ID
@@ -123,7 +151,7 @@ func UpdateWorkspace(stateDir, id, name, preCommand, defaultTerminalCommand stri
 	return ws, nil
 }
 
-// ListWorkspaces returns all workspaces
+// ListWorkspaces returns all workspaces, also the archived ones, see ListWorkspacesMatching
 func ListWorkspaces(stateDir string) ([]*Workspace, error) {
 	workspacesDir := filepath.Join(stateDir, "workspaces")
 	entries, err := os.ReadDir(workspacesDir)
@@ -135,8 +163,10 @@ func ListWorkspaces(stateDir string) ([]*Workspace, error) {
 	}
 
 	var workspaces []*Workspace
+	paths := map[string]bool{}
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		// Hidden directories are workspaces which are being created, see CreateWorkspace
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
 			continue
 		}
 
@@ -146,7 +176,9 @@ func ListWorkspaces(stateDir string) ([]*Workspace, error) {
 			continue
 		}
 		workspaces = append(workspaces, ws)
+		paths[ws.Path] = true
 	}
+	pruneWorkspaceCache(workspacesDir, paths)
 
 	return workspaces, nil
 }
@@ -159,59 +191,163 @@ func ListProcesses(ws *Workspace) ([]*process.Process, error) {
 		return nil, fmt.Errorf("failed to read processes directory: %w", err)
 	}
 
-	var processes []*process.Process
-	for _, entry := range entries {
-		if !entry.IsDir() {
+	return listProcessesCached(processesDir, entries)
+}
+
+// GetProcessDir returns the directory path for a process
+func GetProcessDir(ws *Workspace, commandId string) string {
+	return filepath.Join(ws.Path, "processes", commandId)
+}
+
+// GetWorkspaceOfProcess returns the state directory and the workspace of the process in
+// processDir, which is stateDir/workspaces/<id>/processes/<commandId>.
+func GetWorkspaceOfProcess(processDir string) (string, *Workspace, error) {
+	workspaceDir := filepath.Dir(filepath.Dir(filepath.Clean(processDir)))
+	stateDir := filepath.Dir(filepath.Dir(workspaceDir))
+	ws, err := GetWorkspace(stateDir, filepath.Base(workspaceDir))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load workspace of process: %w", err)
+	}
+	return stateDir, ws, nil
+}
+
+// FindProcessDir searches the workspaces for the process with the given commandId
+// and returns its directory. If workspaceID is empty, all workspaces get searched.
+func FindProcessDir(stateDir, workspaceID, commandId string) (string, error) {
+	if commandId == "" || filepath.Base(commandId) != commandId {
+		return "", fmt.Errorf("invalid process id: %q", commandId)
+	}
+	workspaces, err := ListWorkspaces(stateDir)
+	if err != nil {
+		return "", err
+	}
+	for _, ws := range workspaces {
+		if workspaceID != "" && ws.ID != workspaceID {
 			continue
 		}
+		processDir := GetProcessDir(ws, commandId)
+		if _, err := os.Stat(filepath.Join(processDir, "cmd")); err == nil {
+			return processDir, nil
+		}
+	}
+	return "", fmt.Errorf("process %q not found", commandId)
+}
 
-		proc, err := process.LoadProcessFromDir(filepath.Join(
-			processesDir, entry.Name()))
+// FindProcessByPermalink searches all workspaces for the process with the given permalink,
+// see process.PermalinkFor, and returns its directory.
+func FindProcessByPermalink(stateDir, permalink string) (string, error) {
+	workspaces, err := ListWorkspaces(stateDir)
+	if err != nil {
+		return "", err
+	}
+	for _, ws := range workspaces {
+		entries, err := os.ReadDir(filepath.Join(ws.Path, "processes"))
 		if err != nil {
-			return nil, err
+			continue
+		}
+		for _, entry := range entries {
+			processDir := GetProcessDir(ws, entry.Name())
+			cmd, err := os.ReadFile(filepath.Join(processDir, "cmd"))
+			if err == nil && process.PermalinkFor(entry.Name(), string(cmd)) == permalink {
+				return processDir, nil
+			}
 		}
-		processes = append(processes, proc)
 	}
+	return "", fmt.Errorf("process with permalink %q not found", permalink)
+}
+
+// DeleteProcess removes the directory of a finished process, including its output.
+// Running processes can't be deleted.
+func DeleteProcess(ws *Workspace, commandId string) error {
+	if commandId == "" || filepath.Base(commandId) != commandId {
+		return fmt.Errorf("invalid process id: %q", commandId)
+	}
+	proc, err := process.LoadProcessFromDir(GetProcessDir(ws, commandId))
+	if err != nil {
+		return err
+	}
+	if !proc.Completed {
+		return fmt.Errorf("process %q is still running", commandId)
+	}
+	if err := os.RemoveAll(proc.ProcessDir); err != nil {
+		return fmt.Errorf("failed to delete process directory: %w", err)
+	}
+	return nil
+}
 
-	return processes, nil
+// DeleteFinishedProcessesBefore deletes all finished processes of the workspace which ended
+// before the given time. It returns the number of deleted processes.
+func DeleteFinishedProcessesBefore(ws *Workspace, before time.Time) (int, error) {
+	processes, err := ListProcesses(ws)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, proc := range processes {
+		if !proc.Completed {
+			continue
+		}
+		if !proc.FinishedAt().Before(before) {
+			continue
+		}
+		if err := DeleteProcess(ws, proc.CommandId); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
 }
 
-// GetProcessDir returns the directory path for a process
-func GetProcessDir(ws *Workspace, commandId string) string {
-	return filepath.Join(ws.Path, "processes", commandId)
+// DeleteWorkspace removes the workspace from the state directory, including its processes
+// and their output. The working directory is not touched. Workspaces with running processes
+// can't be deleted.
+func DeleteWorkspace(ws *Workspace) error {
+	processes, err := ListProcesses(ws)
+	if err != nil {
+		return err
+	}
+	for _, proc := range processes {
+		if !proc.Completed {
+			return fmt.Errorf("process %q of workspace %q is still running", proc.CommandId, ws.ID)
+		}
+	}
+	if err := os.RemoveAll(ws.Path); err != nil {
+		return fmt.Errorf("failed to delete workspace directory: %w", err)
+	}
+	return nil
 }
 
 // saveWorkspaceFiles saves workspace data as individual files
 func saveWorkspaceFiles(ws *Workspace) error {
 	// Write ID file
-	if err := os.WriteFile(filepath.Join(ws.Path, "id"), []byte(ws.ID), 0o600); err != nil {
+	if err := metadata.WriteFile(filepath.Join(ws.Path, "id"), []byte(ws.ID), 0o600); err != nil {
 		return fmt.Errorf("failed to write id file: %w", err)
 	}
 
 	// Write name file
-	if err := os.WriteFile(filepath.Join(ws.Path, "name"), []byte(ws.Name), 0o600); err != nil {
+	if err := metadata.WriteFile(filepath.Join(ws.Path, "name"), []byte(ws.Name), 0o600); err != nil {
 		return fmt.Errorf("failed to write name file: %w", err)
 	}
 
 	// Write directory file
-	if err := os.WriteFile(filepath.Join(ws.Path, "directory"), []byte(ws.Directory), 0o600); err != nil {
+	if err := metadata.WriteFile(filepath.Join(ws.Path, "directory"), []byte(ws.Directory), 0o600); err != nil {
 		return fmt.Errorf("failed to write directory file: %w", err)
 	}
 
 	// Write pre-command file (if not empty), or remove it if empty
 	preCommandPath := filepath.Join(ws.Path, "pre-command")
 	if ws.PreCommand != "" {
-		if err := os.WriteFile(preCommandPath, []byte(ws.PreCommand), 0o600); err != nil {
+		if err := metadata.WriteFile(preCommandPath, []byte(ws.PreCommand), 0o600); err != nil {
 			return fmt.Errorf("failed to write pre-command file: %w", err)
 		}
 	} else {
 		// Remove pre-command file if it exists (ignore error if file doesn't exist)
-		_ = os.Remove(preCommandPath)
+		_ = metadata.Remove(preCommandPath)
 	}
 
 	// Write created-at file
 	createdAt := ws.CreatedAt.Format(outputlog.TimeFormatRFC3339NanoUTC)
-	if err := os.WriteFile(filepath.Join(ws.Path, "created-at"), []byte(createdAt), 0o600); err != nil {
+	if err := metadata.WriteFile(filepath.Join(ws.Path, "created-at"), []byte(createdAt), 0o600); err != nil {
 		return fmt.Errorf("failed to write created-at file: %w", err)
 	}
 
@@ -220,26 +356,29 @@ func saveWorkspaceFiles(ws *Workspace) error {
 
 // loadWorkspaceFiles loads workspace data from individual files
 func loadWorkspaceFiles(ws *Workspace) error {
-	// Read ID file
-	idData, err := os.ReadFile(filepath.Join(ws.Path, "id"))
+	// Read directory file, without it the workspace can't be used
+	dirData, err := os.ReadFile(filepath.Join(ws.Path, "directory"))
 	if err != nil {
-		return fmt.Errorf("failed to read id file: %w", err)
+		return fmt.Errorf("failed to read directory file: %w", err)
 	}
+	ws.Directory = string(dirData)
+
+	// The other required files get repaired if they are missing or broken
+	var broken []string
+
+	// Read ID file
+	idData, err := os.ReadFile(filepath.Join(ws.Path, "id"))
 	ws.ID = strings.TrimSpace(string(idData))
+	if err != nil || ws.ID == "" {
+		broken = append(broken, "id")
+	}
 
 	// Read name file
 	nameData, err := os.ReadFile(filepath.Join(ws.Path, "name"))
-	if err != nil {
-		return fmt.Errorf("failed to read name file: %w", err)
-	}
 	ws.Name = string(nameData)
-
-	// Read directory file
-	dirData, err := os.ReadFile(filepath.Join(ws.Path, "directory"))
 	if err != nil {
-		return fmt.Errorf("failed to read directory file: %w", err)
+		broken = append(broken, "name")
 	}
-	ws.Directory = string(dirData)
 
 	// Read pre-command file (optional)
 	preCommandData, err := os.ReadFile(filepath.Join(ws.Path, "pre-command"))
@@ -249,15 +388,55 @@ func loadWorkspaceFiles(ws *Workspace) error {
 
 	// Read created-at file
 	createdAtData, err := os.ReadFile(filepath.Join(ws.Path, "created-at"))
-	if err != nil {
-		return fmt.Errorf("failed to read created-at file: %w", err)
+	if err == nil {
+		ws.CreatedAt, err = time.Parse(time.RFC3339Nano, string(createdAtData))
 	}
-	createdAt, err := time.Parse(time.RFC3339Nano, string(createdAtData))
 	if err != nil {
-		return fmt.Errorf("failed to parse created-at: %w", err)
+		broken = append(broken, "created-at")
+	}
+
+	if len(broken) > 0 {
+		if err := repairWorkspaceFiles(ws, broken); err != nil {
+			return err
+		}
 	}
-	ws.CreatedAt = createdAt
 
+	loadIdentity(ws)
+	loadOwner(ws)
+	loadCommandPolicy(ws)
+	loadMaxConcurrent(ws)
+	loadPriority(ws)
+	loadArchived(ws)
+	return loadProfiles(ws)
+}
+
+// repairWorkspaceFiles rewrites the broken files of ws, which a crash or an older version left
+// behind. The ID is the name of the workspace directory, the name is the ID and the creation
+// time is the modification time of the directory.
+func repairWorkspaceFiles(ws *Workspace, broken []string) error {
+	for _, name := range broken {
+		var content string
+		switch name {
+		case "id":
+			ws.ID = filepath.Base(ws.Path)
+			content = ws.ID
+		case "name":
+			// The ID is repaired first
+			ws.Name = ws.ID
+			content = ws.Name
+		case "created-at":
+			info, err := os.Stat(ws.Path)
+			if err != nil {
+				return err
+			}
+			ws.CreatedAt = info.ModTime().UTC()
+			content = ws.CreatedAt.Format(outputlog.TimeFormatRFC3339NanoUTC)
+		}
+		if err := metadata.WriteFile(filepath.Join(ws.Path, name), []byte(content), 0o600); err != nil {
+			return fmt.Errorf("failed to repair %s file: %w", name, err)
+		}
+	}
+	slog.Warn("Repaired broken workspace files", "workspace", ws.ID, "files", broken)
 	return nil
 }
 
@@ -355,8 +534,8 @@ func generateWorkspaceID(name string) (string, error) {
 	}
 
 	// Limit length
-	if len(id) > 50 {
-		id = id[:50]
+	if len(id) > maxIDLength {
+		id = strings.TrimRight(id[:maxIDLength], "-")
 	}
 
 	return id, nil
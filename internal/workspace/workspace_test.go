@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"mobileshell/internal/process"
 )
 
 func TestWorkspaceCreation(t *testing.T) {
@@ -235,3 +240,157 @@ func TestPreCommandWithCRLFInWorkspace(t *testing.T) {
 		t.Errorf("Pre-command file should not contain \\r characters, got: %q", string(data))
 	}
 }
+
+func TestFindProcessDir(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitWorkspaces(stateDir))
+	ws, err := CreateWorkspace(stateDir, "find-process", t.TempDir(), "")
+	require.NoError(t, err)
+
+	processDir := GetProcessDir(ws, "2025-01-07T12:34:56.789Z")
+	require.NoError(t, os.MkdirAll(processDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "cmd"), []byte("ls"), 0o600))
+
+	found, err := FindProcessDir(stateDir, "", "2025-01-07T12:34:56.789Z")
+	require.NoError(t, err)
+	require.Equal(t, processDir, found)
+
+	found, err = FindProcessDir(stateDir, "find-process", "2025-01-07T12:34:56.789Z")
+	require.NoError(t, err)
+	require.Equal(t, processDir, found)
+
+	_, err = FindProcessDir(stateDir, "other-workspace", "2025-01-07T12:34:56.789Z")
+	require.Error(t, err)
+
+	_, err = FindProcessDir(stateDir, "", "2000-01-01T00:00:00Z")
+	require.Error(t, err)
+
+	_, err = FindProcessDir(stateDir, "", "../find-process")
+	require.Error(t, err)
+}
+
+func TestFindProcessByPermalink(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitWorkspaces(stateDir))
+	ws, err := CreateWorkspace(stateDir, "permalink", t.TempDir(), "")
+	require.NoError(t, err)
+
+	processDir := GetProcessDir(ws, "2025-01-07T12:34:56.789Z")
+	require.NoError(t, os.MkdirAll(processDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "cmd"), []byte("ls"), 0o600))
+
+	permalink := process.PermalinkFor("2025-01-07T12:34:56.789Z", "ls")
+	require.Len(t, permalink, process.PermalinkLength)
+
+	found, err := FindProcessByPermalink(stateDir, permalink)
+	require.NoError(t, err)
+	require.Equal(t, processDir, found)
+
+	_, err = FindProcessByPermalink(stateDir, process.PermalinkFor("2025-01-07T12:34:56.789Z", "rm"))
+	require.Error(t, err)
+}
+
+// writeTestProcess creates a process directory like executor and nohup would do.
+func writeTestProcess(t *testing.T, ws *Workspace, commandId string, completed bool, endTime time.Time) string {
+	t.Helper()
+	processDir := GetProcessDir(ws, commandId)
+	require.NoError(t, os.MkdirAll(processDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "cmd"), []byte("ls"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "starttime"), []byte(endTime.Add(-time.Second).Format(time.RFC3339Nano)), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(processDir, "completed"), []byte(strconv.FormatBool(completed)), 0o600))
+	if completed {
+		require.NoError(t, os.WriteFile(filepath.Join(processDir, "endtime"), []byte(endTime.Format(time.RFC3339Nano)), 0o600))
+	}
+	return processDir
+}
+
+func TestDeleteProcess(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws, err := CreateWorkspace(stateDir, "delete-process", t.TempDir(), "")
+	require.NoError(t, err)
+	finishedDir := writeTestProcess(t, ws, "2025-01-07T10:00:00Z", true, time.Now().UTC())
+	runningDir := writeTestProcess(t, ws, "2025-01-07T11:00:00Z", false, time.Now().UTC())
+
+	require.NoError(t, DeleteProcess(ws, "2025-01-07T10:00:00Z"))
+	require.NoDirExists(t, finishedDir)
+
+	require.Error(t, DeleteProcess(ws, "2025-01-07T11:00:00Z"))
+	require.DirExists(t, runningDir)
+
+	require.Error(t, DeleteProcess(ws, "../../delete-process"))
+	require.DirExists(t, ws.Path)
+}
+
+func TestDeleteFinishedProcessesBefore(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ws, err := CreateWorkspace(stateDir, "delete-old", t.TempDir(), "")
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	oldDir := writeTestProcess(t, ws, "2025-01-01T00:00:00Z", true, now.AddDate(0, 0, -10))
+	newDir := writeTestProcess(t, ws, "2025-01-02T00:00:00Z", true, now.AddDate(0, 0, -1))
+	runningDir := writeTestProcess(t, ws, "2025-01-03T00:00:00Z", false, now.AddDate(0, 0, -10))
+
+	deleted, err := DeleteFinishedProcessesBefore(ws, now.AddDate(0, 0, -7))
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	require.NoDirExists(t, oldDir)
+	require.DirExists(t, newDir)
+	require.DirExists(t, runningDir)
+}
+
+func TestDeleteWorkspace(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	directory := t.TempDir()
+	ws, err := CreateWorkspace(stateDir, "delete-workspace", directory, "")
+	require.NoError(t, err)
+	runningDir := writeTestProcess(t, ws, "2025-01-07T11:00:00Z", false, time.Now().UTC())
+
+	require.ErrorContains(t, DeleteWorkspace(ws), "still running")
+	require.DirExists(t, ws.Path)
+
+	require.NoError(t, os.WriteFile(filepath.Join(runningDir, "completed"), []byte("true"), 0o600))
+	require.NoError(t, DeleteWorkspace(ws))
+	require.NoDirExists(t, ws.Path)
+	require.DirExists(t, directory)
+	workspaces, err := ListWorkspaces(stateDir)
+	require.NoError(t, err)
+	require.Empty(t, workspaces)
+}
+
+func TestLoadWorkspaceRepairs(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	require.NoError(t, InitWorkspaces(stateDir))
+	ws, err := CreateWorkspace(stateDir, "broken", t.TempDir(), "")
+	require.NoError(t, err)
+
+	// A crash while the workspace was created left an empty id file, and no name and
+	// created-at files
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Path, "id"), nil, 0o600))
+	require.NoError(t, os.Remove(filepath.Join(ws.Path, "name")))
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Path, "created-at"), []byte("2025-01-"), 0o600))
+	// Workspaces which are being created are not listed
+	require.NoError(t, os.MkdirAll(filepath.Join(stateDir, "workspaces", ".new-123"), 0o700))
+
+	workspaces, err := ListWorkspaces(stateDir)
+	require.NoError(t, err)
+	require.Len(t, workspaces, 1)
+	require.Equal(t, "broken", workspaces[0].ID)
+	require.Equal(t, "broken", workspaces[0].Name)
+	require.False(t, workspaces[0].CreatedAt.IsZero())
+	for _, name := range []string{"id", "name", "created-at"} {
+		data, err := os.ReadFile(filepath.Join(ws.Path, name))
+		require.NoError(t, err)
+		require.NotEmpty(t, data, name)
+	}
+
+	// The directory can't be repaired
+	require.NoError(t, os.Remove(filepath.Join(ws.Path, "directory")))
+	_, err = GetWorkspace(stateDir, ws.ID)
+	require.ErrorContains(t, err, "directory")
+}
@@ -0,0 +1,286 @@
+// Package ansihtml converts output with ANSI escape sequences to HTML.
+//
+// SGR sequences (colors, bold, italic, underline) become <span> elements with
+// "ansi-*" classes. Extended colors (38;5;n and 38;2;r;g;b) become inline
+// styles. OSC 8 hyperlinks, like gh and cargo print them, become <a> elements
+// if their scheme is allowed, see allowedSchemes. All other escape sequences,
+// like cursor movement, are removed. The text itself gets HTML escaped, so the
+// result is safe to embed.
+package ansihtml
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const esc = 0x1b
+
+// colorNames are the names of the 8 standard colors, in SGR order.
+var colorNames = [8]string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// allowedSchemes are the URL schemes of hyperlinks which get rendered as links.
+// Links with other schemes, like file: or javascript:, are shown as plain text.
+var allowedSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// escKind is the kind of an escape sequence.
+type escKind int
+
+const (
+	escOther escKind = iota
+	escSGR
+	escOSC
+)
+
+// style is the SGR state which applies to the following text.
+type style struct {
+	fg, bg    string // class suffix like "red" or "bright-red", or a "#rrggbb" color
+	bold      bool
+	dim       bool
+	italic    bool
+	underline bool
+}
+
+// ToHTML converts text with ANSI escape sequences to sanitized HTML.
+func ToHTML(input string) string {
+	var b strings.Builder
+	var cur style
+	link := "" // URL of the open <a>
+	spanOpen := false
+	i := 0
+	for i < len(input) {
+		next := strings.IndexByte(input[i:], esc)
+		if next != 0 {
+			text := input[i:]
+			if next > 0 {
+				text = input[i : i+next]
+			}
+			b.WriteString(html.EscapeString(text))
+			i += len(text)
+			continue
+		}
+
+		var kind escKind
+		var params string
+		kind, params, i = parseEscape(input, i)
+		nextStyle, nextLink := cur, link
+		switch kind {
+		case escSGR:
+			nextStyle = cur.apply(params)
+		case escOSC:
+			target, isLink := hyperlink(params)
+			if !isLink || target == link {
+				continue
+			}
+			nextLink = target
+		default:
+			continue
+		}
+		if spanOpen {
+			b.WriteString("</span>")
+		}
+		if nextLink != link {
+			if link != "" {
+				b.WriteString("</a>")
+			}
+			if nextLink != "" {
+				b.WriteString(`<a href="` + html.EscapeString(nextLink) + `" target="_blank" rel="noopener noreferrer">`)
+			}
+		}
+		cur, link = nextStyle, nextLink
+		tag := cur.openTag()
+		b.WriteString(tag)
+		spanOpen = tag != ""
+	}
+	if spanOpen {
+		b.WriteString("</span>")
+	}
+	if link != "" {
+		b.WriteString("</a>")
+	}
+	return b.String()
+}
+
+// parseEscape parses the escape sequence which starts at input[start]. It
+// returns the kind, the parameters of SGR and OSC sequences, and the index
+// after the sequence. Unterminated sequences consume the rest of the input.
+func parseEscape(input string, start int) (kind escKind, params string, end int) {
+	if start+1 >= len(input) {
+		return escOther, "", len(input)
+	}
+	switch input[start+1] {
+	case '[':
+		// CSI: parameter and intermediate bytes, then a final byte in 0x40-0x7e
+		for j := start + 2; j < len(input); j++ {
+			if input[j] >= 0x40 && input[j] <= 0x7e {
+				if input[j] == 'm' {
+					return escSGR, input[start+2 : j], j + 1
+				}
+				return escOther, "", j + 1
+			}
+		}
+		return escOther, "", len(input)
+	case ']':
+		// OSC, like window titles and hyperlinks: terminated by BEL or ESC \
+		for j := start + 2; j < len(input); j++ {
+			if input[j] == 0x07 {
+				return escOSC, input[start+2 : j], j + 1
+			}
+			if input[j] == esc && j+1 < len(input) && input[j+1] == '\\' {
+				return escOSC, input[start+2 : j], j + 2
+			}
+		}
+		return escOther, "", len(input)
+	}
+	return escOther, "", start + 2
+}
+
+// hyperlink parses the OSC 8 sequence "8;params;URL". The URL is empty at the
+// end of a link, and for links with schemes which are not allowed.
+func hyperlink(params string) (target string, isLink bool) {
+	rest, found := strings.CutPrefix(params, "8;")
+	if !found {
+		return "", false
+	}
+	_, target, found = strings.Cut(rest, ";")
+	if !found {
+		return "", false
+	}
+	u, err := url.Parse(target)
+	if err != nil || !allowedSchemes[u.Scheme] {
+		return "", true
+	}
+	return target, true
+}
+
+// apply returns the style after the SGR parameters got applied.
+func (s style) apply(params string) style {
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil && codes[i] != "" {
+			continue
+		}
+		switch {
+		case code == 0:
+			s = style{}
+		case code == 1:
+			s.bold = true
+		case code == 2:
+			s.dim = true
+		case code == 3:
+			s.italic = true
+		case code == 4:
+			s.underline = true
+		case code == 22:
+			s.bold, s.dim = false, false
+		case code == 23:
+			s.italic = false
+		case code == 24:
+			s.underline = false
+		case code >= 30 && code <= 37:
+			s.fg = colorNames[code-30]
+		case code >= 90 && code <= 97:
+			s.fg = "bright-" + colorNames[code-90]
+		case code == 39:
+			s.fg = ""
+		case code >= 40 && code <= 47:
+			s.bg = colorNames[code-40]
+		case code >= 100 && code <= 107:
+			s.bg = "bright-" + colorNames[code-100]
+		case code == 49:
+			s.bg = ""
+		case code == 38:
+			s.fg, i = extendedColor(codes, i)
+		case code == 48:
+			s.bg, i = extendedColor(codes, i)
+		}
+	}
+	return s
+}
+
+// extendedColor parses "5;n" or "2;r;g;b" after codes[i] and returns the color
+// and the index of the last consumed code.
+func extendedColor(codes []string, i int) (string, int) {
+	if i+1 >= len(codes) {
+		return "", i
+	}
+	switch codes[i+1] {
+	case "5":
+		if i+2 >= len(codes) {
+			return "", len(codes)
+		}
+		n, err := strconv.Atoi(codes[i+2])
+		if err != nil || n < 0 || n > 255 {
+			return "", i + 2
+		}
+		return color256(n), i + 2
+	case "2":
+		if i+4 >= len(codes) {
+			return "", len(codes)
+		}
+		var rgb [3]int
+		for k := range rgb {
+			v, err := strconv.Atoi(codes[i+2+k])
+			if err != nil || v < 0 || v > 255 {
+				return "", i + 4
+			}
+			rgb[k] = v
+		}
+		return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2]), i + 4
+	}
+	return "", i + 1
+}
+
+// color256 returns the color of the xterm 256 color palette.
+func color256(n int) string {
+	switch {
+	case n < 8:
+		return colorNames[n]
+	case n < 16:
+		return "bright-" + colorNames[n-8]
+	case n < 232:
+		// 6x6x6 color cube
+		levels := [6]int{0, 95, 135, 175, 215, 255}
+		n -= 16
+		return fmt.Sprintf("#%02x%02x%02x", levels[n/36], levels[n/6%6], levels[n%6])
+	}
+	gray := 8 + (n-232)*10
+	return fmt.Sprintf("#%02x%02x%02x", gray, gray, gray)
+}
+
+// openTag returns the <span> for the style, or "" for the default style.
+func (s style) openTag() string {
+	var classes, styles []string
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{{s.bold, "bold"}, {s.dim, "dim"}, {s.italic, "italic"}, {s.underline, "underline"}} {
+		if flag.set {
+			classes = append(classes, "ansi-"+flag.name)
+		}
+	}
+	if strings.HasPrefix(s.fg, "#") {
+		styles = append(styles, "color:"+s.fg)
+	} else if s.fg != "" {
+		classes = append(classes, "ansi-fg-"+s.fg)
+	}
+	if strings.HasPrefix(s.bg, "#") {
+		styles = append(styles, "background-color:"+s.bg)
+	} else if s.bg != "" {
+		classes = append(classes, "ansi-bg-"+s.bg)
+	}
+	if len(classes) == 0 && len(styles) == 0 {
+		return ""
+	}
+	tag := "<span"
+	if len(classes) > 0 {
+		tag += ` class="` + strings.Join(classes, " ") + `"`
+	}
+	if len(styles) > 0 {
+		tag += ` style="` + strings.Join(styles, ";") + `"`
+	}
+	return tag + ">"
+}
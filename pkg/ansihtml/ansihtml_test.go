@@ -0,0 +1,50 @@
+package ansihtml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToHTMLColors(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, `<span class="ansi-fg-green">PASS</span> test`, ToHTML("\x1b[32mPASS\x1b[0m test"))
+	require.Equal(t, `<span class="ansi-bold ansi-fg-bright-red">FAIL</span>`, ToHTML("\x1b[1;91mFAIL\x1b[m"))
+	require.Equal(t, `<span class="ansi-bg-yellow">warn</span><span class="ansi-bold ansi-bg-yellow">!</span>`, ToHTML("\x1b[43mwarn\x1b[1m!"))
+	require.Equal(t, `<span class="ansi-underline">a</span>b`, ToHTML("\x1b[4ma\x1b[24mb"))
+}
+
+func TestToHTMLExtendedColors(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, `<span class="ansi-fg-bright-blue">a</span>`, ToHTML("\x1b[38;5;12ma\x1b[0m"))
+	require.Equal(t, `<span style="color:#ff8700">a</span>`, ToHTML("\x1b[38;5;208ma\x1b[0m"))
+	require.Equal(t, `<span style="background-color:#808080">a</span>`, ToHTML("\x1b[48;5;244ma\x1b[0m"))
+	require.Equal(t, `<span class="ansi-bold" style="color:#0a141e">a</span>`, ToHTML("\x1b[38;2;10;20;30;1ma\x1b[0m"))
+	require.Equal(t, "a", ToHTML("\x1b[38;2;999;0;0ma"))
+}
+
+func TestToHTMLSanitizes(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, `<span class="ansi-fg-red">&lt;script&gt;alert(1)&lt;/script&gt;</span>`, ToHTML("\x1b[31m<script>alert(1)</script>"))
+	require.Equal(t, "&#34;x&#34; &amp; y", ToHTML(`"x" & y`))
+}
+
+func TestToHTMLRemovesOtherSequences(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "progress done", ToHTML("progress\x1b[2K\x1b[1G done"))
+	require.Equal(t, "title", ToHTML("\x1b]0;my title\x07title"))
+	require.Equal(t, "link", ToHTML("\x1b]8;;file:///tmp/x\x1b\\link\x1b]8;;\x1b\\"))
+	require.Equal(t, "a", ToHTML("a\x1b[31"))
+	require.Equal(t, "a", ToHTML("a\x1b"))
+}
+
+func TestToHTMLHyperlinks(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, `see <a href="https://example.com/?a=1&amp;b=2" target="_blank" rel="noopener noreferrer">docs</a>!`,
+		ToHTML("see \x1b]8;;https://example.com/?a=1&b=2\x1b\\docs\x1b]8;;\x1b\\!"))
+	require.Equal(t, `<span class="ansi-fg-blue">a</span><a href="https://example.com" target="_blank" rel="noopener noreferrer"><span class="ansi-fg-blue">b</span></a><span class="ansi-fg-blue">c</span>`,
+		ToHTML("\x1b[34ma\x1b]8;id=1;https://example.com\x07b\x1b]8;;\x07c"))
+	require.Equal(t, "run", ToHTML("\x1b]8;;javascript:alert(1)\x07run\x1b]8;;\x07"))
+	require.Equal(t, "main.rs", ToHTML("\x1b]8;;file:///home/user/main.rs\x07main.rs\x1b]8;;\x07"))
+	require.Equal(t, `<a href="mailto:a@example.com" target="_blank" rel="noopener noreferrer">mail</a>`, ToHTML("\x1b]8;;mailto:a@example.com\x07mail"))
+}
@@ -0,0 +1,125 @@
+// Package asciicast converts output logs (see package outputlog) to the asciicast v2 format of
+// asciinema, so that recorded terminal sessions can be replayed with `asciinema play` or the
+// asciinema web player.
+//
+// The format is a JSON header line, followed by one JSON array per event:
+//
+//	{"version": 2, "width": 80, "height": 24, "timestamp": 1736253296}
+//	[0.248848, "o", "$ ls\r\n"]
+//	[1.001376, "i", "exit\r"]
+//	[1.2, "r", "100x30"]
+//
+// See https://docs.asciinema.org/manual/asciicast/v2/
+package asciicast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"mobileshell/pkg/outputlog"
+)
+
+// Event types of asciicast v2.
+const (
+	EventOutput = "o"
+	EventInput  = "i"
+	EventResize = "r"
+)
+
+// Default terminal size, if the log has no resize chunk before the first output.
+const (
+	DefaultWidth  = 80
+	DefaultHeight = 24
+)
+
+// Header is the first line of a cast.
+type Header struct {
+	Version   int    `json:"version"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// Streams maps the streams of an output log to the event types of the cast. Chunks of other
+// streams are skipped. Resize chunks contain the size like "100x30".
+type Streams map[string]string
+
+// Convert reads the output log r and writes it as cast to w. The time of the first chunk is
+// the start of the cast.
+func Convert(r io.Reader, w io.Writer, streams Streams, title string) error {
+	reader, err := outputlog.NewOutputLogReader(r)
+	if err != nil {
+		return err
+	}
+	var chunks []outputlog.Chunk
+	for chunk := range reader.Channel() {
+		if chunk.Error != nil {
+			return chunk.Error
+		}
+		if _, ok := streams[chunk.Stream]; ok {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	header := Header{Version: 2, Width: DefaultWidth, Height: DefaultHeight, Title: title}
+	var start time.Time
+	if len(chunks) > 0 {
+		start = chunks[0].Timestamp
+		header.Timestamp = start.Unix()
+	}
+	// The size before the first output is the initial size of the terminal
+	for _, chunk := range chunks {
+		if streams[chunk.Stream] != EventResize {
+			break
+		}
+		if _, err := fmt.Sscanf(string(chunk.Line), "%dx%d", &header.Width, &header.Height); err != nil {
+			return fmt.Errorf("invalid terminal size %q: %w", chunk.Line, err)
+		}
+	}
+	if err := writeJSON(w, header); err != nil {
+		return err
+	}
+
+	// A chunk can end within a UTF-8 sequence, the rest of it is in the next chunk
+	pending := map[string][]byte{}
+	for _, chunk := range chunks {
+		eventType := streams[chunk.Stream]
+		data := append(pending[chunk.Stream], chunk.Line...)
+		cut := completeUTF8(data)
+		pending[chunk.Stream] = append([]byte(nil), data[cut:]...)
+		if cut == 0 {
+			continue
+		}
+		elapsed := chunk.Timestamp.Sub(start).Seconds()
+		if err := writeJSON(w, []any{elapsed, eventType, string(data[:cut])}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// completeUTF8 returns the length of data without an incomplete UTF-8 sequence at its end.
+func completeUTF8(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if utf8.FullRune(data[i:]) {
+				return len(data)
+			}
+			return i
+		}
+	}
+	return len(data)
+}
+
+func writeJSON(w io.Writer, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,67 @@
+package asciicast
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"mobileshell/pkg/outputlog"
+)
+
+var testStreams = Streams{"out": EventOutput, "in": EventInput, "size": EventResize}
+
+func writeTestLog(chunks ...outputlog.Chunk) *bytes.Buffer {
+	var buf bytes.Buffer
+	for _, chunk := range chunks {
+		buf.Write(outputlog.FormatChunk(chunk))
+	}
+	return &buf
+}
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 7, 12, 0, 0, 0, time.UTC)
+	log := writeTestLog(
+		outputlog.Chunk{Stream: "size", Timestamp: start, Line: []byte("100x30")},
+		outputlog.Chunk{Stream: "out", Timestamp: start.Add(250 * time.Millisecond), Line: []byte("$ ")},
+		outputlog.Chunk{Stream: "stdout", Timestamp: start.Add(300 * time.Millisecond), Line: []byte("skipped")},
+		outputlog.Chunk{Stream: "in", Timestamp: start.Add(time.Second), Line: []byte("exit\r")},
+		outputlog.Chunk{Stream: "size", Timestamp: start.Add(1500 * time.Millisecond), Line: []byte("120x40")},
+	)
+
+	var cast bytes.Buffer
+	require.NoError(t, Convert(log, &cast, testStreams, "bash"))
+	require.Equal(t, `{"version":2,"width":100,"height":30,"timestamp":1736251200,"title":"bash"}
+[0,"r","100x30"]
+[0.25,"o","$ "]
+[1,"i","exit\r"]
+[1.5,"r","120x40"]
+`, cast.String())
+}
+
+func TestConvertDefaultSize(t *testing.T) {
+	t.Parallel()
+	var cast bytes.Buffer
+	require.NoError(t, Convert(strings.NewReader(""), &cast, testStreams, ""))
+	require.Equal(t, `{"version":2,"width":80,"height":24}`+"\n", cast.String())
+}
+
+func TestConvertSplitUTF8(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 7, 12, 0, 0, 0, time.UTC)
+	euro := []byte("€")
+	log := writeTestLog(
+		outputlog.Chunk{Stream: "out", Timestamp: start, Line: append([]byte("a"), euro[:2]...)},
+		outputlog.Chunk{Stream: "out", Timestamp: start.Add(time.Second), Line: append(euro[2:], 'b')},
+	)
+
+	var cast bytes.Buffer
+	require.NoError(t, Convert(log, &cast, testStreams, ""))
+	require.Equal(t, `{"version":2,"width":80,"height":24,"timestamp":1736251200}
+[0,"o","a"]
+[1,"o","€b"]
+`, cast.String())
+}
@@ -0,0 +1,129 @@
+// Package jsonhtml renders JSON output as a collapsible HTML tree.
+//
+// Objects and arrays become <details> elements, so they can be collapsed
+// without JavaScript. The order of object keys is kept. Streams of JSON
+// values, like JSON lines, become one tree per value. All text gets HTML
+// escaped, so the result is safe to embed.
+package jsonhtml
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// openDepth is the nesting depth up to which objects and arrays are expanded.
+const openDepth = 2
+
+// ToHTML renders JSON values as HTML. It fails if the input is not valid JSON,
+// for example if the output got cut off.
+func ToHTML(input string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(input))
+	dec.UseNumber()
+	var b strings.Builder
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(`<div class="json-document">`)
+		if err := writeValue(&b, dec, tok, 0); err != nil {
+			return "", err
+		}
+		b.WriteString("</div>")
+	}
+	if b.Len() == 0 {
+		return "", errors.New("no JSON value found")
+	}
+	return b.String(), nil
+}
+
+// writeValue writes the value which starts with tok. Objects and arrays get
+// read from dec up to their closing delimiter.
+func writeValue(b *strings.Builder, dec *json.Decoder, tok json.Token, depth int) error {
+	switch v := tok.(type) {
+	case json.Delim:
+		return writeContainer(b, dec, v, depth)
+	case string:
+		b.WriteString(`<span class="json-string">` + quote(v) + `</span>`)
+	case json.Number:
+		b.WriteString(`<span class="json-number">` + html.EscapeString(v.String()) + `</span>`)
+	case bool:
+		fmt.Fprintf(b, `<span class="json-boolean">%t</span>`, v)
+	case nil:
+		b.WriteString(`<span class="json-null">null</span>`)
+	default:
+		return fmt.Errorf("unexpected JSON token %v", tok)
+	}
+	return nil
+}
+
+// writeContainer writes an object or array as <details> element.
+func writeContainer(b *strings.Builder, dec *json.Decoder, open json.Delim, depth int) error {
+	closing := "]"
+	if open == '{' {
+		closing = "}"
+	}
+	var entries strings.Builder
+	count := 0
+	for dec.More() {
+		entries.WriteString(`<div class="json-entry">`)
+		if open == '{' {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return fmt.Errorf("unexpected JSON object key %v", key)
+			}
+			entries.WriteString(`<span class="json-key">` + quote(name) + `</span>: `)
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := writeValue(&entries, dec, tok, depth+1); err != nil {
+			return err
+		}
+		entries.WriteString("</div>")
+		count++
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	if count == 0 {
+		b.WriteString(`<span class="json-empty">` + string(open) + closing + `</span>`)
+		return nil
+	}
+	b.WriteString("<details")
+	if depth < openDepth {
+		b.WriteString(" open")
+	}
+	unit := "items"
+	if open == '{' {
+		unit = "keys"
+	}
+	fmt.Fprintf(b, `><summary>%c <span class="json-count">%d %s</span></summary>`, open, count, unit)
+	b.WriteString(entries.String())
+	b.WriteString(closing + "</details>")
+	return nil
+}
+
+// quote returns the JSON string literal of s, HTML escaped.
+func quote(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// Encoding a string can't fail
+	_ = enc.Encode(s)
+	return html.EscapeString(strings.TrimSuffix(buf.String(), "\n"))
+}
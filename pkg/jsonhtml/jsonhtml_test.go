@@ -0,0 +1,45 @@
+package jsonhtml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToHTML(t *testing.T) {
+	t.Parallel()
+	out, err := ToHTML(`{"b": 1.50, "a": ["x", true, null], "c": {}}`)
+	require.NoError(t, err)
+	require.Equal(t, `<div class="json-document"><details open><summary>{ <span class="json-count">3 keys</span></summary>`+
+		`<div class="json-entry"><span class="json-key">&#34;b&#34;</span>: <span class="json-number">1.50</span></div>`+
+		`<div class="json-entry"><span class="json-key">&#34;a&#34;</span>: <details open><summary>[ <span class="json-count">3 items</span></summary>`+
+		`<div class="json-entry"><span class="json-string">&#34;x&#34;</span></div>`+
+		`<div class="json-entry"><span class="json-boolean">true</span></div>`+
+		`<div class="json-entry"><span class="json-null">null</span></div>]</details></div>`+
+		`<div class="json-entry"><span class="json-key">&#34;c&#34;</span>: <span class="json-empty">{}</span></div>}</details></div>`, out)
+}
+
+func TestToHTMLCollapsesDeepLevels(t *testing.T) {
+	t.Parallel()
+	out, err := ToHTML(`[[[1]]]`)
+	require.NoError(t, err)
+	require.Contains(t, out, `<details><summary>[ <span class="json-count">1 items</span></summary><div class="json-entry"><span class="json-number">1</span>`)
+}
+
+func TestToHTMLJSONLines(t *testing.T) {
+	t.Parallel()
+	out, err := ToHTML("{\"msg\":\"<b>\"}\r\n{\"msg\":\"two\"}\r\n")
+	require.NoError(t, err)
+	require.Contains(t, out, `<span class="json-string">&#34;&lt;b&gt;&#34;</span>`)
+	require.Contains(t, out, `</div><div class="json-document">`)
+}
+
+func TestToHTMLInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := ToHTML(`{"a": [1, 2`)
+	require.Error(t, err)
+	_, err = ToHTML("[INFO] starting")
+	require.Error(t, err)
+	_, err = ToHTML("  ")
+	require.Error(t, err)
+}
@@ -0,0 +1,106 @@
+package outputlog
+
+import (
+	"bytes"
+	"slices"
+	"time"
+)
+
+// CoalescePolicy configures how WithCoalescing merges consecutive chunks of a stream. Chatty
+// programs emit many tiny writes, and each of them would be a record with its own header.
+type CoalescePolicy struct {
+	// Streams which get merged, for example StreamStdout. Streams whose chunks are records on
+	// their own, like StreamSignal, must not be merged.
+	Streams []string
+
+	MaxBytes       int           // Flush when the merged content reaches this size, 0 for no limit
+	MaxLatency     time.Duration // Flush this long after the first byte at the latest, 0 for no limit
+	FlushOnNewline bool          // Flush the content up to the last newline when a newline arrives
+}
+
+// coalescer merges chunks according to its policy. It is owned by the goroutine of the
+// writer, so it needs no locking.
+type coalescer struct {
+	policy  *CoalescePolicy // nil: chunks are not merged
+	pending *Chunk          // Merged content which was not written yet
+	timer   *time.Timer     // Fires MaxLatency after the first byte of pending
+}
+
+func newCoalescer(policy *CoalescePolicy) *coalescer {
+	c := &coalescer{policy: policy}
+	if policy != nil && policy.MaxLatency > 0 {
+		c.timer = time.NewTimer(policy.MaxLatency)
+		c.timer.Stop()
+	}
+	return c
+}
+
+// add returns the chunks which are ready to be written, in order. A chunk of another stream
+// flushes the pending content first, so the order of the streams is kept. The timestamp of a
+// merged chunk is the timestamp of its first byte.
+func (c *coalescer) add(chunk Chunk) []Chunk {
+	var ready []Chunk
+	if c.pending != nil && c.pending.Stream != chunk.Stream {
+		ready = c.flush()
+	}
+	if c.policy == nil || !slices.Contains(c.policy.Streams, chunk.Stream) {
+		return append(ready, chunk)
+	}
+	if c.pending == nil {
+		c.start(chunk)
+	} else {
+		c.pending.Line = append(c.pending.Line, chunk.Line...)
+	}
+
+	cut := 0
+	if c.policy.MaxBytes > 0 && len(c.pending.Line) >= c.policy.MaxBytes {
+		cut = len(c.pending.Line)
+	} else if c.policy.FlushOnNewline {
+		// The pending content had no newline before, so the rest is part of chunk
+		cut = bytes.LastIndexByte(c.pending.Line, '\n') + 1
+	}
+	if cut == 0 {
+		return ready
+	}
+	rest := c.pending.Line[cut:]
+	c.pending.Line = c.pending.Line[:cut]
+	ready = append(ready, c.flush()...)
+	if len(rest) > 0 {
+		c.start(Chunk{Stream: chunk.Stream, Timestamp: chunk.Timestamp, Line: rest})
+	}
+	return ready
+}
+
+// start makes chunk the pending content.
+func (c *coalescer) start(chunk Chunk) {
+	c.pending = &Chunk{
+		Stream:    chunk.Stream,
+		Timestamp: chunk.Timestamp,
+		Line:      append([]byte(nil), chunk.Line...),
+	}
+	if c.timer != nil {
+		c.timer.Reset(c.policy.MaxLatency)
+	}
+}
+
+// flush returns the pending content, if any.
+func (c *coalescer) flush() []Chunk {
+	if c.pending == nil {
+		return nil
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	chunk := *c.pending
+	c.pending = nil
+	return []Chunk{chunk}
+}
+
+// deadline fires when the pending content must be flushed. It is nil if there is nothing to
+// flush, or if the latency is not limited.
+func (c *coalescer) deadline() <-chan time.Time {
+	if c.pending == nil || c.timer == nil {
+		return nil
+	}
+	return c.timer.C
+}
@@ -0,0 +1,73 @@
+package outputlog
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalescer(t *testing.T) {
+	t.Parallel()
+	first := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	second := first.Add(time.Second)
+	c := newCoalescer(&CoalescePolicy{Streams: []string{StreamStdout, StreamStderr}, MaxBytes: 10, FlushOnNewline: true})
+
+	require.Empty(t, c.add(Chunk{Stream: StreamStdout, Timestamp: first, Line: []byte("a")}))
+	require.Empty(t, c.add(Chunk{Stream: StreamStdout, Timestamp: second, Line: []byte("b")}))
+
+	// A newline flushes up to the newline, the rest keeps the timestamp of its chunk
+	ready := c.add(Chunk{Stream: StreamStdout, Timestamp: second, Line: []byte("c\nd")})
+	require.Equal(t, []Chunk{{Stream: StreamStdout, Timestamp: first, Line: []byte("abc\n")}}, ready)
+
+	// Another stream flushes the pending content first
+	ready = c.add(Chunk{Stream: StreamStderr, Timestamp: second, Line: []byte("e")})
+	require.Equal(t, []Chunk{{Stream: StreamStdout, Timestamp: second, Line: []byte("d")}}, ready)
+
+	// Streams which are not merged are written at once
+	ready = c.add(Chunk{Stream: StreamSignal, Timestamp: second, Line: []byte("SIGTERM")})
+	require.Equal(t, []Chunk{
+		{Stream: StreamStderr, Timestamp: second, Line: []byte("e")},
+		{Stream: StreamSignal, Timestamp: second, Line: []byte("SIGTERM")},
+	}, ready)
+
+	ready = c.add(Chunk{Stream: StreamStdout, Timestamp: first, Line: []byte("0123456789abc")})
+	require.Equal(t, []Chunk{{Stream: StreamStdout, Timestamp: first, Line: []byte("0123456789abc")}}, ready)
+	require.Empty(t, c.flush())
+	require.Nil(t, c.deadline())
+}
+
+func TestWithCoalescing(t *testing.T) {
+	t.Parallel()
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	file, err := os.Create(filePath)
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	writer := NewOutputLogWriter(file, nil,
+		WithCoalescing(CoalescePolicy{Streams: []string{StreamStdout}, MaxLatency: 10 * time.Millisecond}))
+
+	// One Write call per byte
+	_, err = io.Copy(writer.StreamWriter(StreamStdout), iotest.OneByteReader(strings.NewReader(strings.Repeat(".", 100))))
+	require.NoError(t, err)
+
+	// The latency flushes the pending content without closing the writer
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(filePath)
+		return err == nil && bytes.Contains(data, []byte(" 100: "))
+	}, time.Second, time.Millisecond)
+	writer.Close()
+
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	chunks, rest, err := parseCompleteChunks(data)
+	require.NoError(t, err)
+	require.Empty(t, rest)
+	require.Len(t, chunks, 1)
+	require.Equal(t, strings.Repeat(".", 100), string(chunks[0].Line))
+}
@@ -25,6 +25,32 @@
 //   - content: The actual output bytes (exactly length bytes). Content can contain newlines.
 //   - separator \n:
 //
+// # Stream Names
+//
+// The streams written by mobileshell are constants like StreamStdout and StreamSignalSent.
+// OutputLogWriter drops chunks of streams which are not registered. New subsystems register
+// their streams with RegisterStream, hooks use streams with the prefix StreamHookPrefix.
+// Readers accept every stream name which matches the regex above.
+//
+// By default every Write call becomes a chunk. A writer created with WithCoalescing merges
+// consecutive writes of a stream, the timestamp of the merged chunk is the time of its first
+// byte.
+//
+// # Unfinished Writes
+//
+// A writer created with WithHeartbeat appends an empty StreamHeartbeat chunk periodically, and
+// an empty StreamEnd chunk when it gets closed. ReadStatus uses them to report whether a log
+// ended cleanly, ends within a chunk (truncated), or went silent because its writer died.
+// Validate checks a log for malformed records and reports their offsets.
+//
+// # Index
+//
+// A writer created with WithIndex writes a sidecar index, for example output.log.idx. Every
+// megabyte or so it gets a line with the offset of a chunk boundary, the timestamp of the
+// chunk before it, and the number of lines per stream up to there (see IndexEntry). SeekToTime,
+// SeekToOffset and SeekToLastLines use it, so they parse only a small part of big logs. Without
+// an index they read the log from the start, BuildIndex creates the index afterwards.
+//
 // # Examples
 //
 // Example 1: Line with trailing newline
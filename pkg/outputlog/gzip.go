@@ -0,0 +1,91 @@
+package outputlog
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// GzipSuffix gets appended to the file name of compressed output logs.
+const GzipSuffix = ".gz"
+
+// Open opens an output log for reading. If filePath does not exist, but the compressed file
+// filePath + GzipSuffix does, the compressed file gets decompressed on the fly. For an
+// uncompressed file the returned value is an *os.File.
+func Open(filePath string) (io.ReadCloser, error) {
+	file, err := os.Open(filePath)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return file, err
+	}
+	gzFile, gzErr := os.Open(filePath + GzipSuffix)
+	if gzErr != nil {
+		// Report the error of the uncompressed file, so that callers can check for ErrNotExist.
+		return nil, err
+	}
+	gzReader, err := gzip.NewReader(gzFile)
+	if err != nil {
+		_ = gzFile.Close()
+		return nil, fmt.Errorf("%q: %w", filePath+GzipSuffix, err)
+	}
+	return &gzipReadCloser{Reader: gzReader, file: gzFile}, nil
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipReadCloser) Close() error {
+	return errors.Join(g.Reader.Close(), g.file.Close())
+}
+
+// Size returns the uncompressed size of the output log filePath, also if it was compressed
+// (see Open). A compressed log gets decompressed to count its bytes.
+func Size(filePath string) (int64, error) {
+	info, err := os.Stat(filePath)
+	if err == nil {
+		return info.Size(), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	file, err := Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+	return io.Copy(io.Discard, file)
+}
+
+// Compress replaces filePath by the gzip compressed file filePath + GzipSuffix. The
+// compressed file is complete before the uncompressed file gets removed, so concurrent
+// readers which use Open always see the whole log.
+func Compress(filePath string) error {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	tmpFile := filePath + GzipSuffix + ".tmp"
+	dst, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	gzWriter := gzip.NewWriter(dst)
+	_, err = io.Copy(gzWriter, src)
+	err = errors.Join(err, gzWriter.Close(), dst.Close())
+	if err != nil {
+		_ = os.Remove(tmpFile)
+		return fmt.Errorf("failed to compress %q: %w", filePath, err)
+	}
+
+	if err := os.Rename(tmpFile, filePath+GzipSuffix); err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+	return os.Remove(filePath)
+}
@@ -0,0 +1,108 @@
+package outputlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testTimestamp = time.Date(2025, 1, 2, 3, 4, 5, 123456789, time.UTC)
+
+func writeCompressedLog(t *testing.T, data []byte) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	require.NoError(t, os.WriteFile(filePath, data, 0o600))
+	require.NoError(t, Compress(filePath))
+	return filePath
+}
+
+func firstAndSecondChunk() ([]byte, []byte) {
+	return FormatChunk(Chunk{Stream: "stdout", Timestamp: testTimestamp, Line: []byte("first\n")}),
+		FormatChunk(Chunk{Stream: "stderr", Timestamp: testTimestamp, Line: []byte("second\n")})
+}
+
+func TestCompress(t *testing.T) {
+	t.Parallel()
+	first, second := firstAndSecondChunk()
+	filePath := writeCompressedLog(t, append(first, second...))
+
+	_, err := os.Stat(filePath)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filePath + GzipSuffix)
+	require.NoError(t, err)
+	_, err = os.Stat(filePath + GzipSuffix + ".tmp")
+	require.True(t, os.IsNotExist(err))
+
+	stdout, stderr, err := ReadTwoStreams(filePath, "stdout", "stderr")
+	require.NoError(t, err)
+	require.Equal(t, "first\n", string(stdout))
+	require.Equal(t, "second\n", string(stderr))
+
+	raw, err := ReadRawStdout(filePath)
+	require.NoError(t, err)
+	require.Equal(t, "first\n", string(raw))
+}
+
+func TestReadFrom_Compressed(t *testing.T) {
+	t.Parallel()
+	first, second := firstAndSecondChunk()
+	filePath := writeCompressedLog(t, append(first, second...))
+
+	chunks, next, err := ReadFrom(filePath, int64(len(first)))
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	require.Equal(t, "second\n", string(chunks[0].Line))
+	require.Equal(t, int64(len(first)+len(second)), next)
+}
+
+func TestOpen_Missing(t *testing.T) {
+	t.Parallel()
+	_, err := Open(filepath.Join(t.TempDir(), "output.log"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestTruncateFront_Compressed(t *testing.T) {
+	t.Parallel()
+	first, second := firstAndSecondChunk()
+	var data []byte
+	for range 20 {
+		data = append(data, first...)
+	}
+	filePath := writeCompressedLog(t, append(data, second...))
+
+	removed, err := TruncateFront(filePath, 500)
+	require.NoError(t, err)
+	require.Positive(t, removed)
+
+	// The log stays compressed, the limit is the uncompressed size
+	_, err = os.Stat(filePath)
+	require.True(t, os.IsNotExist(err))
+	size, err := Size(filePath)
+	require.NoError(t, err)
+	require.LessOrEqual(t, size, int64(500))
+	stderr, err := ReadOneStream(filePath, "stderr")
+	require.NoError(t, err)
+	require.Equal(t, "second\n", string(stderr))
+}
+
+func TestSize(t *testing.T) {
+	t.Parallel()
+	first, second := firstAndSecondChunk()
+	data := append(first, second...)
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	require.NoError(t, os.WriteFile(filePath, data, 0o600))
+	size, err := Size(filePath)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), size)
+
+	require.NoError(t, Compress(filePath))
+	size, err = Size(filePath)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), size)
+
+	_, err = Size(filePath + ".missing")
+	require.True(t, os.IsNotExist(err))
+}
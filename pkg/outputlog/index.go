@@ -0,0 +1,314 @@
+package outputlog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"mobileshell/internal/metadata"
+)
+
+// IndexSuffix is appended to the path of an output log to get the path of its index, for
+// example "output.log.idx".
+const IndexSuffix = ".idx"
+
+// DefaultIndexInterval is the distance in bytes between two entries of an index. Seeking
+// parses at most this many bytes of the log.
+const DefaultIndexInterval = 1 << 20
+
+// IndexEntry maps a byte offset of an output log to the time and the line counts at that
+// offset. Offsets of compressed logs (see Open) are offsets of the uncompressed data.
+//
+// In the index file an entry is a line like
+//
+//	1048576 2025-01-07T12:34:56.789Z stderr=3 stdout=120
+type IndexEntry struct {
+	Offset    int64            // Offset of a chunk boundary
+	Timestamp time.Time        // Timestamp of the last chunk before Offset
+	Lines     map[string]int64 // Number of newlines per stream before Offset
+}
+
+// indexer appends an entry to the index every interval bytes of the log. It is owned by the
+// goroutine of the writer, so it needs no locking.
+type indexer struct {
+	writer    io.Writer // nil: no index is written
+	interval  int64
+	offset    int64 // Size of the log
+	indexed   int64 // Offset of the last entry
+	timestamp time.Time
+	lines     map[string]int64
+}
+
+func newIndexer(writer io.Writer, interval int64) *indexer {
+	return &indexer{writer: writer, interval: max(interval, 1), lines: map[string]int64{}}
+}
+
+// record accounts for chunk, which was written as n bytes to the log.
+func (ix *indexer) record(chunk Chunk, n int) {
+	if ix.writer == nil {
+		return
+	}
+	ix.offset += int64(n)
+	ix.timestamp = chunk.Timestamp
+	if count := bytes.Count(chunk.Line, []byte("\n")); count > 0 {
+		ix.lines[chunk.Stream] += int64(count)
+	}
+	if ix.offset-ix.indexed < ix.interval {
+		return
+	}
+	ix.indexed = ix.offset
+	entry := IndexEntry{Offset: ix.offset, Timestamp: ix.timestamp, Lines: ix.lines}
+	if _, err := io.WriteString(ix.writer, formatIndexEntry(entry)); err != nil {
+		// The index is optional, the log stays usable without it
+		ix.writer = nil
+	}
+}
+
+func formatIndexEntry(entry IndexEntry) string {
+	fields := []string{strconv.FormatInt(entry.Offset, 10), entry.Timestamp.UTC().Format(TimeFormatRFC3339NanoUTC)}
+	for _, stream := range slices.Sorted(maps.Keys(entry.Lines)) {
+		fields = append(fields, fmt.Sprintf("%s=%d", stream, entry.Lines[stream]))
+	}
+	return strings.Join(fields, " ") + "\n"
+}
+
+func parseIndexEntry(line string) (IndexEntry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return IndexEntry{}, fmt.Errorf("expected offset and timestamp, got %q", line)
+	}
+	offset, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || offset < 0 {
+		return IndexEntry{}, fmt.Errorf("invalid offset %q", fields[0])
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, fields[1])
+	if err != nil {
+		return IndexEntry{}, fmt.Errorf("invalid timestamp %q", fields[1])
+	}
+	entry := IndexEntry{Offset: offset, Timestamp: timestamp, Lines: map[string]int64{}}
+	for _, field := range fields[2:] {
+		stream, count, ok := strings.Cut(field, "=")
+		lines, err := strconv.ParseInt(count, 10, 64)
+		if !ok || err != nil || !IsValidStreamName(stream) {
+			return IndexEntry{}, fmt.Errorf("invalid line count %q", field)
+		}
+		entry.Lines[stream] = lines
+	}
+	return entry, nil
+}
+
+// ReadIndex reads the index of the output log filePath. It returns no entries if the log has no
+// index. A partially written trailing entry is ignored.
+func ReadIndex(filePath string) ([]IndexEntry, error) {
+	data, err := os.ReadFile(filePath + IndexSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	complete := data[:bytes.LastIndexByte(data, '\n')+1]
+	var entries []IndexEntry
+	for line := range strings.Lines(string(complete)) {
+		entry, err := parseIndexEntry(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", filePath+IndexSuffix, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// BuildIndex writes the index of the output log filePath, for logs which were written without
+// one (see WithIndex). An existing index gets replaced.
+func BuildIndex(filePath string, interval int64) error {
+	var buf bytes.Buffer
+	ix := newIndexer(&buf, interval)
+	_, err := scanChunks(filePath, 0, func(chunk Chunk, _ int64) bool {
+		ix.record(chunk, len(FormatChunk(chunk)))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return metadata.WriteFile(filePath+IndexSuffix, buf.Bytes(), 0o600)
+}
+
+// SeekToOffset returns the offset of the first chunk which starts at or after offset, or the
+// end of the complete chunks if there is none. The result can be passed to ReadFrom.
+func SeekToOffset(filePath string, offset int64) (int64, error) {
+	entries, err := ReadIndex(filePath)
+	if err != nil {
+		return 0, err
+	}
+	start := lastEntryOffset(entries, func(e IndexEntry) bool { return e.Offset <= offset })
+	return seek(filePath, start, func(_ Chunk, chunkOffset int64) bool { return chunkOffset >= offset })
+}
+
+// SeekToTime returns the offset of the first chunk with a timestamp at or after t, or the end of
+// the complete chunks if there is none. The result can be passed to ReadFrom.
+func SeekToTime(filePath string, t time.Time) (int64, error) {
+	entries, err := ReadIndex(filePath)
+	if err != nil {
+		return 0, err
+	}
+	start := lastEntryOffset(entries, func(e IndexEntry) bool { return e.Timestamp.Before(t) })
+	return seek(filePath, start, func(chunk Chunk, _ int64) bool { return !chunk.Timestamp.Before(t) })
+}
+
+// SeekToLastLines returns the offset of the latest chunk from which on the streams contain at
+// least n lines, or 0 if the log has fewer lines. Without streams all streams count.
+func SeekToLastLines(filePath string, n int64, streams ...string) (int64, error) {
+	entries, err := ReadIndex(filePath)
+	if err != nil {
+		return 0, err
+	}
+	sumLines := func(lines map[string]int64) int64 {
+		var sum int64
+		for stream, count := range lines {
+			if matchesStreams(stream, streams) {
+				sum += count
+			}
+		}
+		return sum
+	}
+
+	// The lines after the last entry are not in the index
+	var last IndexEntry
+	if len(entries) > 0 {
+		last = entries[len(entries)-1]
+	}
+	tailLines, err := countNewlines(filePath, last.Offset, streams)
+	if err != nil {
+		return 0, err
+	}
+	total := sumLines(last.Lines) + tailLines
+	start := lastEntryOffset(entries, func(e IndexEntry) bool { return total-sumLines(e.Lines) >= n })
+
+	type boundary struct {
+		offset int64
+		lines  int64
+	}
+	var boundaries []boundary
+	if _, err := scanChunks(filePath, start, func(chunk Chunk, offset int64) bool {
+		var lines int64
+		if matchesStreams(chunk.Stream, streams) {
+			lines = int64(bytes.Count(chunk.Line, []byte("\n")))
+		}
+		boundaries = append(boundaries, boundary{offset, lines})
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	var lines int64
+	for i := len(boundaries) - 1; i >= 0; i-- {
+		lines += boundaries[i].lines
+		if lines >= n {
+			return boundaries[i].offset, nil
+		}
+	}
+	return start, nil
+}
+
+// lastEntryOffset returns the offset of the last entry which matches, or 0.
+func lastEntryOffset(entries []IndexEntry, match func(IndexEntry) bool) int64 {
+	var offset int64
+	for _, entry := range entries {
+		if match(entry) {
+			offset = entry.Offset
+		}
+	}
+	return offset
+}
+
+// seek returns the offset of the first chunk from start on which matches, or the end of the
+// complete chunks.
+func seek(filePath string, start int64, match func(Chunk, int64) bool) (int64, error) {
+	found := int64(-1)
+	end, err := scanChunks(filePath, start, func(chunk Chunk, offset int64) bool {
+		if match(chunk, offset) {
+			found = offset
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if found < 0 {
+		return end, nil
+	}
+	return found, nil
+}
+
+// ReadChunks reads the complete chunks of filePath from offset on, like ReadFrom, but stops
+// before the content exceeds maxBytes. At least one chunk is returned, if there is one. It
+// returns the offset directly after the last returned chunk.
+func ReadChunks(filePath string, offset int64, maxBytes int64) ([]Chunk, int64, error) {
+	var chunks []Chunk
+	var size int64
+	next := offset
+	end, err := scanChunks(filePath, offset, func(chunk Chunk, chunkOffset int64) bool {
+		size += int64(len(chunk.Line))
+		if len(chunks) > 0 && size > maxBytes {
+			next = chunkOffset
+			return false
+		}
+		chunks = append(chunks, chunk)
+		return true
+	})
+	if err != nil {
+		return chunks, offset, err
+	}
+	if next == offset {
+		next = end
+	}
+	return chunks, next, nil
+}
+
+// countingReader counts the bytes which were read.
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// scanChunks calls fn with the complete chunks of filePath from offset on, and the offset of
+// each chunk, until fn returns false. It returns the offset of the chunk for which fn returned
+// false, or the offset after the last complete chunk. Unlike ReadFrom it does not read the whole
+// rest of the log into memory.
+func scanChunks(filePath string, offset int64, fn func(chunk Chunk, offset int64) bool) (int64, error) {
+	file, err := openAt(filePath, offset)
+	if err != nil {
+		return offset, err
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := &countingReader{reader: bufio.NewReader(file)}
+	for {
+		start := offset + reader.n
+		chunk, eof := readToChunk(reader)
+		if chunk.Error != nil {
+			if errors.Is(chunk.Error, io.EOF) || errors.Is(chunk.Error, io.ErrUnexpectedEOF) {
+				return start, nil
+			}
+			return start, fmt.Errorf("%q offset %d: %w", filePath, start, chunk.Error)
+		}
+		if eof || !fn(chunk, start) {
+			return start, nil
+		}
+	}
+}
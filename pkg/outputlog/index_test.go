@@ -0,0 +1,101 @@
+package outputlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeIndexedTestLog(t *testing.T, chunks ...Chunk) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	file, err := os.Create(filePath)
+	require.NoError(t, err)
+	index, err := os.Create(filePath + IndexSuffix)
+	require.NoError(t, err)
+
+	writer := NewOutputLogWriter(file, nil, WithIndex(index, 1))
+	channel := writer.Channel()
+	for _, chunk := range chunks {
+		channel <- chunk
+	}
+	writer.Close()
+	require.NoError(t, file.Close())
+	require.NoError(t, index.Close())
+	return filePath
+}
+
+func TestSeekWithIndex(t *testing.T) {
+	t.Parallel()
+	t0 := time.Date(2025, 1, 7, 14, 30, 0, 0, time.UTC)
+	first := Chunk{Stream: StreamStdout, Timestamp: t0, Line: []byte("a\n")}
+	second := Chunk{Stream: StreamStdout, Timestamp: t0.Add(time.Minute), Line: []byte("b\nc\n")}
+	third := Chunk{Stream: StreamStderr, Timestamp: t0.Add(2 * time.Minute), Line: []byte("e\n")}
+	filePath := writeIndexedTestLog(t, first, second, third)
+
+	entries, err := ReadIndex(filePath)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	secondOffset := int64(len(FormatChunk(first)))
+	require.Equal(t, secondOffset, entries[0].Offset)
+	require.Equal(t, t0, entries[0].Timestamp)
+	require.Equal(t, map[string]int64{StreamStdout: 3, StreamStderr: 1}, entries[2].Lines)
+
+	offset, err := SeekToTime(filePath, t0.Add(30*time.Second))
+	require.NoError(t, err)
+	require.Equal(t, secondOffset, offset)
+	offset, err = SeekToTime(filePath, t0.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, entries[2].Offset, offset)
+
+	offset, err = SeekToOffset(filePath, 1)
+	require.NoError(t, err)
+	require.Equal(t, secondOffset, offset)
+
+	offset, err = SeekToLastLines(filePath, 2, StreamStdout)
+	require.NoError(t, err)
+	require.Equal(t, secondOffset, offset)
+	offset, err = SeekToLastLines(filePath, 3)
+	require.NoError(t, err)
+	require.Equal(t, secondOffset, offset)
+	offset, err = SeekToLastLines(filePath, 100)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), offset)
+
+	chunks, next, err := ReadChunks(filePath, secondOffset, 1)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	require.Equal(t, "b\nc\n", string(chunks[0].Line))
+	require.Equal(t, entries[1].Offset, next)
+}
+
+func TestBuildIndex(t *testing.T) {
+	t.Parallel()
+	t0 := time.Date(2025, 1, 7, 14, 30, 0, 0, time.UTC)
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	first := FormatChunk(Chunk{Stream: StreamStdout, Timestamp: t0, Line: []byte("a\n")})
+	second := FormatChunk(Chunk{Stream: StreamStdout, Timestamp: t0.Add(time.Minute), Line: []byte("b\n")})
+	require.NoError(t, os.WriteFile(filePath, append(first, second...), 0o600))
+
+	offset, err := SeekToTime(filePath, t0.Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(first)), offset)
+
+	require.NoError(t, BuildIndex(filePath, 1))
+	entries, err := ReadIndex(filePath)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, int64(len(first)+len(second)), entries[1].Offset)
+	require.Equal(t, map[string]int64{StreamStdout: 2}, entries[1].Lines)
+
+	// A partially written entry is ignored
+	index, err := os.ReadFile(filePath + IndexSuffix)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filePath+IndexSuffix, append(index, "99 2025"...), 0o600))
+	entries, err = ReadIndex(filePath)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
@@ -0,0 +1,130 @@
+package outputlog
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ReadTimeRange returns the chunks of the streams with a timestamp at or after from and before
+// to. Without streams all streams are returned. It stops before the content exceeds maxBytes,
+// but returns at least one chunk, if there is one. The index of the log (see IndexEntry) is
+// used to find the start.
+func ReadTimeRange(filePath string, from, to time.Time, maxBytes int64, streams ...string) ([]Chunk, error) {
+	offset, err := SeekToTime(filePath, from)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []Chunk
+	var size int64
+	_, err = scanChunks(filePath, offset, func(chunk Chunk, _ int64) bool {
+		if !chunk.Timestamp.Before(to) {
+			return false
+		}
+		if !matchesStreams(chunk.Stream, streams) {
+			return true
+		}
+		size += int64(len(chunk.Line))
+		if len(chunks) > 0 && size > maxBytes {
+			return false
+		}
+		chunks = append(chunks, chunk)
+		return true
+	})
+	return chunks, err
+}
+
+// ReadLines returns the lines first to last of stream. Lines are numbered from 1, the trailing
+// "\n" or "\r\n" is removed. A last line without newline is returned, too. The index of the log
+// (see IndexEntry) is used to find the start.
+func ReadLines(filePath, stream string, first, last int64) ([]string, error) {
+	if first < 1 || last < first {
+		return nil, fmt.Errorf("invalid line range %d-%d", first, last)
+	}
+	entries, err := ReadIndex(filePath)
+	if err != nil {
+		return nil, err
+	}
+	// Start at an entry which is in a line before first, the line at the entry may have
+	// started before it.
+	var start IndexEntry
+	for _, entry := range entries {
+		if entry.Lines[stream]+1 < first {
+			start = entry
+		}
+	}
+
+	lineNumber := start.Lines[stream] + 1
+	var lines []string
+	var current []byte
+	_, err = scanChunks(filePath, start.Offset, func(chunk Chunk, _ int64) bool {
+		if chunk.Stream != stream {
+			return true
+		}
+		rest := chunk.Line
+		for len(rest) > 0 {
+			end := bytes.IndexByte(rest, '\n')
+			if end < 0 {
+				if lineNumber >= first {
+					current = append(current, rest...)
+				}
+				return true
+			}
+			if lineNumber >= first {
+				current = append(current, rest[:end]...)
+				lines = append(lines, strings.TrimSuffix(string(current), "\r"))
+			}
+			current = current[:0]
+			lineNumber++
+			rest = rest[end+1:]
+			if lineNumber > last {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(current) > 0 && lineNumber <= last {
+		lines = append(lines, strings.TrimSuffix(string(current), "\r"))
+	}
+	return lines, nil
+}
+
+// CountLines returns the number of complete lines of stream. A last line without newline is
+// not counted, but ReadLines returns it as line CountLines()+1.
+func CountLines(filePath, stream string) (int64, error) {
+	entries, err := ReadIndex(filePath)
+	if err != nil {
+		return 0, err
+	}
+	var last IndexEntry
+	if len(entries) > 0 {
+		last = entries[len(entries)-1]
+	}
+	newlines, err := countNewlines(filePath, last.Offset, []string{stream})
+	if err != nil {
+		return 0, err
+	}
+	return last.Lines[stream] + newlines, nil
+}
+
+// countNewlines counts the newlines of the streams from offset on.
+func countNewlines(filePath string, offset int64, streams []string) (int64, error) {
+	var newlines int64
+	_, err := scanChunks(filePath, offset, func(chunk Chunk, _ int64) bool {
+		if matchesStreams(chunk.Stream, streams) {
+			newlines += int64(bytes.Count(chunk.Line, []byte("\n")))
+		}
+		return true
+	})
+	return newlines, err
+}
+
+// matchesStreams returns true if stream is one of streams, or if streams is empty.
+func matchesStreams(stream string, streams []string) bool {
+	return len(streams) == 0 || slices.Contains(streams, stream)
+}
@@ -0,0 +1,69 @@
+package outputlog
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTimeRange(t *testing.T) {
+	t.Parallel()
+	t0 := time.Date(2025, 1, 7, 14, 30, 0, 0, time.UTC)
+	filePath := writeIndexedTestLog(t,
+		Chunk{Stream: StreamStdout, Timestamp: t0, Line: []byte("a\n")},
+		Chunk{Stream: StreamStderr, Timestamp: t0.Add(time.Minute), Line: []byte("b\n")},
+		Chunk{Stream: StreamStdout, Timestamp: t0.Add(2 * time.Minute), Line: []byte("c\n")},
+		Chunk{Stream: StreamStdout, Timestamp: t0.Add(3 * time.Minute), Line: []byte("d\n")},
+	)
+
+	chunks, err := ReadTimeRange(filePath, t0.Add(time.Minute), t0.Add(3*time.Minute), 1<<20)
+	require.NoError(t, err)
+	require.Len(t, chunks, 2)
+	require.Equal(t, "b\n", string(chunks[0].Line))
+	require.Equal(t, "c\n", string(chunks[1].Line))
+
+	chunks, err = ReadTimeRange(filePath, t0, t0.Add(time.Hour), 1<<20, StreamStdout)
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+
+	chunks, err = ReadTimeRange(filePath, t0, t0.Add(time.Hour), 1)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+}
+
+func TestReadLines(t *testing.T) {
+	t.Parallel()
+	t0 := time.Date(2025, 1, 7, 14, 30, 0, 0, time.UTC)
+	filePath := writeIndexedTestLog(t,
+		Chunk{Stream: StreamStdout, Timestamp: t0, Line: []byte("one\r\ntw")},
+		Chunk{Stream: StreamStderr, Timestamp: t0, Line: []byte("error\n")},
+		Chunk{Stream: StreamStdout, Timestamp: t0, Line: []byte("o\nthree\nfour\nfi")},
+	)
+
+	lines, err := ReadLines(filePath, StreamStdout, 2, 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"two", "three"}, lines)
+
+	lines, err = ReadLines(filePath, StreamStdout, 4, 100)
+	require.NoError(t, err)
+	require.Equal(t, []string{"four", "fi"}, lines)
+
+	lines, err = ReadLines(filePath, StreamStderr, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"error"}, lines)
+
+	count, err := CountLines(filePath, StreamStdout)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), count)
+
+	_, err = ReadLines(filePath, StreamStdout, 0, 1)
+	require.Error(t, err)
+
+	// Without index the log is read from the start
+	require.NoError(t, os.Remove(filePath+IndexSuffix))
+	lines, err = ReadLines(filePath, StreamStdout, 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"one", "two"}, lines)
+}
@@ -3,9 +3,9 @@
 package outputlog
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"slices"
 	"time"
 )
@@ -130,6 +130,10 @@ func readToChunk(reader io.Reader) (Chunk, bool) {
 		chunk.Error = fmt.Errorf("reading stream: %w", err)
 		return chunk, true
 	}
+	if !IsValidStreamName(stream) {
+		chunk.Error = fmt.Errorf("invalid stream name %q", stream)
+		return chunk, true
+	}
 	chunk.Stream = stream
 
 	// Read timestamp (until space)
@@ -228,7 +232,7 @@ func NewOutputLogReader(reader io.Reader) (OutputLogReader, error) {
 }
 
 func ReadStreams(filePath string, streams ...string) (map[string][]byte, error) {
-	file, err := os.Open(filePath)
+	file, err := Open(filePath)
 	if err != nil {
 		return nil, err
 	}
@@ -263,7 +267,7 @@ func ReadFiveStreams(filePath string, stream1, stream2, stream3, stream4, stream
 
 // ReadRawStdout reads an output.log file and returns only the stdout stream as raw bytes
 func ReadRawStdout(filePath string) ([]byte, error) {
-	file, err := os.Open(filePath)
+	file, err := Open(filePath)
 	if err != nil {
 		return nil, err
 	}
@@ -275,5 +279,78 @@ func ReadRawStdout(filePath string) ([]byte, error) {
 	}
 
 	streams := reader.All()
-	return streams["stdout"], nil
+	return streams[StreamStdout], nil
+}
+
+// Verify checks that filePath is a valid output log. A partially written trailing record is
+// reported as error, so Verify should only be used for logs which are not written anymore.
+func Verify(filePath string) error {
+	file, err := Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	_, rest, err := parseCompleteChunks(data)
+	if err != nil {
+		return fmt.Errorf("%q: %w", filePath, err)
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("%q: incomplete record at offset %d", filePath, len(data)-len(rest))
+	}
+	return nil
+}
+
+// ReadFrom reads all complete chunks of filePath starting at byte offset. It returns the chunks
+// and the offset directly after the last complete chunk, which can be passed to the next call
+// to read only the data which got appended in the meantime. A partially written trailing
+// record is not returned, it gets read by the next call.
+func ReadFrom(filePath string, offset int64) ([]Chunk, int64, error) {
+	if offset < 0 {
+		return nil, offset, fmt.Errorf("invalid offset %d", offset)
+	}
+	file, err := openAt(filePath, offset)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer func() { _ = file.Close() }()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, offset, err
+	}
+	chunks, rest, err := parseCompleteChunks(data)
+	if err != nil {
+		return chunks, offset, fmt.Errorf("%q: %w", filePath, err)
+	}
+	return chunks, offset + int64(len(data)-len(rest)), nil
+}
+
+// openAt opens filePath (see Open) and positions it at the byte offset.
+func openAt(filePath string, offset int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid offset %d", offset)
+	}
+	file, err := Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	// Compressed logs can't seek, the leading bytes get decompressed and skipped.
+	if seeker, ok := file.(io.Seeker); ok {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, file, offset)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
 }
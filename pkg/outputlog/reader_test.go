@@ -5,6 +5,8 @@ package outputlog
 import (
 	"bytes"
 	"io"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -94,6 +96,17 @@ func TestReadToChunk_InvalidLength(t *testing.T) {
 	require.Error(t, chunk.Error)
 }
 
+func TestReadToChunk_InvalidStreamName(t *testing.T) {
+	t.Parallel()
+	input := "std$out 2025-01-07T12:34:56Z 5: hello\n"
+	reader := bytes.NewReader([]byte(input))
+
+	chunk, eof := readToChunk(reader)
+
+	require.True(t, eof)
+	require.ErrorContains(t, chunk.Error, "invalid stream name")
+}
+
 func TestReadToChunk_MissingFinalNewline(t *testing.T) {
 	t.Parallel()
 	input := "stdout 2025-01-07T12:34:56Z 5: hello"
@@ -441,3 +454,43 @@ func TestOutputLogIoReader_All_BinaryData(t *testing.T) {
 	expected := append(binaryData1, binaryData2...)
 	require.Equal(t, expected, result["stdout"])
 }
+
+func TestReadFrom_Offset(t *testing.T) {
+	t.Parallel()
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	first := FormatChunk(Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("first\n")})
+	second := FormatChunk(Chunk{Stream: "stderr", Timestamp: time.Now(), Line: []byte("second\n")})
+	require.NoError(t, os.WriteFile(filePath, append(first, second[:5]...), 0o600))
+
+	chunks, offset, err := ReadFrom(filePath, 0)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	require.Equal(t, "first\n", string(chunks[0].Line))
+	require.Equal(t, int64(len(first)), offset)
+
+	require.NoError(t, os.WriteFile(filePath, append(first, second...), 0o600))
+
+	chunks, offset, err = ReadFrom(filePath, offset)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	require.Equal(t, "stderr", chunks[0].Stream)
+	require.Equal(t, "second\n", string(chunks[0].Line))
+	require.Equal(t, int64(len(first)+len(second)), offset)
+
+	_, _, err = ReadFrom(filePath, -1)
+	require.Error(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	data := FormatChunk(Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("hello\n")})
+	require.NoError(t, os.WriteFile(filePath, data, 0o600))
+	require.NoError(t, Verify(filePath))
+
+	require.NoError(t, os.WriteFile(filePath, data[:len(data)-2], 0o600))
+	require.ErrorContains(t, Verify(filePath), "incomplete record at offset 0")
+
+	require.NoError(t, os.WriteFile(filePath, []byte("stdout 2025-01-07T12:34:56Z x: hello\n"), 0o600))
+	require.Error(t, Verify(filePath))
+}
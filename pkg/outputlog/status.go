@@ -0,0 +1,60 @@
+package outputlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// LogStatus tells how an output log ended. See ReadStatus.
+type LogStatus string
+
+const (
+	LogActive    LogStatus = "active"    // The writer wrote a chunk recently
+	LogClean     LogStatus = "clean"     // The last chunk is the StreamEnd chunk
+	LogTruncated LogStatus = "truncated" // The log ends within a chunk, and the writer stopped
+	LogSilent    LogStatus = "silent"    // The writer stopped without writing StreamEnd
+)
+
+// ReadStatus reports whether the log filePath ended cleanly, was truncated mid-chunk, or went
+// silent. A log is active as long as its last chunk is younger than silentAfter, which should be
+// a few heartbeat intervals (see WithHeartbeat). If the log has no chunks yet, the modification
+// time of the file is used. Logs written without heartbeats are reported as silent once they are
+// older than silentAfter, because they never contain a StreamEnd chunk.
+func ReadStatus(filePath string, silentAfter time.Duration) (LogStatus, error) {
+	file, err := Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	chunks, rest, err := parseCompleteChunks(data)
+	if err != nil {
+		return "", fmt.Errorf("%q: %w", filePath, err)
+	}
+
+	var lastWrite time.Time
+	if len(chunks) > 0 {
+		last := chunks[len(chunks)-1]
+		if last.Stream == StreamEnd && len(rest) == 0 {
+			return LogClean, nil
+		}
+		lastWrite = last.Timestamp
+	} else if info, err := os.Stat(filePath); err == nil {
+		// A compressed log has no uncompressed file, it counts as silent
+		lastWrite = info.ModTime()
+	}
+
+	if time.Since(lastWrite) < silentAfter {
+		return LogActive, nil
+	}
+	if len(rest) > 0 {
+		return LogTruncated, nil
+	}
+	return LogSilent, nil
+}
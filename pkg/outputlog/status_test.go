@@ -0,0 +1,65 @@
+package outputlog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithHeartbeat(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	writer := NewOutputLogWriter(&buf, nil, WithHeartbeat(time.Millisecond))
+	_, err := writer.StreamWriter(StreamStdout).Write([]byte("hello\n"))
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	writer.Close()
+
+	chunks, rest, err := parseCompleteChunks(buf.Bytes())
+	require.NoError(t, err)
+	require.Empty(t, rest)
+	require.Equal(t, StreamStdout, chunks[0].Stream)
+	require.Equal(t, StreamHeartbeat, chunks[1].Stream)
+	require.Equal(t, StreamEnd, chunks[len(chunks)-1].Stream)
+	require.Empty(t, chunks[len(chunks)-1].Line)
+}
+
+func TestReadStatus(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	stdout := FormatChunk(Chunk{Stream: StreamStdout, Timestamp: old, Line: []byte("hello\n")})
+	end := FormatChunk(Chunk{Stream: StreamEnd, Timestamp: old})
+	heartbeat := FormatChunk(Chunk{Stream: StreamHeartbeat, Timestamp: time.Now()})
+
+	clean := filepath.Join(dir, "clean.log")
+	require.NoError(t, os.WriteFile(clean, append(stdout, end...), 0o600))
+	status, err := ReadStatus(clean, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, LogClean, status)
+
+	silent := filepath.Join(dir, "silent.log")
+	require.NoError(t, os.WriteFile(silent, stdout, 0o600))
+	status, err = ReadStatus(silent, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, LogSilent, status)
+
+	truncated := filepath.Join(dir, "truncated.log")
+	require.NoError(t, os.WriteFile(truncated, append(stdout, end[:5]...), 0o600))
+	status, err = ReadStatus(truncated, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, LogTruncated, status)
+
+	active := filepath.Join(dir, "active.log")
+	require.NoError(t, os.WriteFile(active, append(stdout, heartbeat...), 0o600))
+	status, err = ReadStatus(active, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, LogActive, status)
+
+	_, err = ReadStatus(filepath.Join(dir, "missing.log"), time.Minute)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
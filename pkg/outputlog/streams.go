@@ -0,0 +1,70 @@
+package outputlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Stream names which are written by mobileshell.
+const (
+	StreamStdout      = "stdout"
+	StreamStderr      = "stderr"
+	StreamStdin       = "stdin"
+	StreamNohupStdout = "nohup-stdout" // Output of the nohup wrapper itself
+	StreamNohupStderr = "nohup-stderr" // Errors and notices of the nohup wrapper itself
+	StreamSignal      = "signal"       // Signal requests sent to nohup via the Unix domain socket
+	StreamSignalSent  = "signal-sent"  // Signals which were sent to the process
+	StreamStdinClose  = "stdin-close"  // Requests to close stdin sent to nohup via the Unix domain socket
+	StreamEvent       = "event"
+	StreamMetrics     = "metrics"
+	StreamHeartbeat   = "heartbeat" // Empty chunks written periodically, see WithHeartbeat
+	StreamEnd         = "end"       // Empty chunk written when the writer got closed
+
+	// StreamHookPrefix is the prefix of the streams of hooks, for example "hook-post-exit".
+	StreamHookPrefix = "hook-"
+)
+
+// Events of the stream StreamEvent.
+const (
+	EventStdinClosed = "stdin-closed" // The process got EOF on stdin, see StreamStdinClose
+)
+
+var streamNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_./-]{1,64}$`)
+
+// IsValidStreamName returns true if name matches the stream regex documented in doc.go.
+func IsValidStreamName(name string) bool {
+	return streamNameRegex.MatchString(name)
+}
+
+// registeredStreams is only modified by RegisterStream, which must be called during package
+// initialization. Afterwards it is only read, so no locking is needed.
+var registeredStreams = map[string]bool{
+	StreamStdout:      true,
+	StreamStderr:      true,
+	StreamStdin:       true,
+	StreamNohupStdout: true,
+	StreamNohupStderr: true,
+	StreamSignal:      true,
+	StreamSignalSent:  true,
+	StreamStdinClose:  true,
+	StreamEvent:       true,
+	StreamMetrics:     true,
+	StreamHeartbeat:   true,
+	StreamEnd:         true,
+}
+
+// RegisterStream registers a stream name, so that OutputLogWriter accepts chunks for it. New
+// subsystems call it from an init function. It panics if name is not valid.
+func RegisterStream(name string) {
+	if !IsValidStreamName(name) {
+		panic(fmt.Sprintf("outputlog: invalid stream name %q", name))
+	}
+	registeredStreams[name] = true
+}
+
+// IsRegisteredStream returns true if name is valid, and it was registered with RegisterStream
+// or is a hook stream (StreamHookPrefix).
+func IsRegisteredStream(name string) bool {
+	return IsValidStreamName(name) && (registeredStreams[name] || strings.HasPrefix(name, StreamHookPrefix))
+}
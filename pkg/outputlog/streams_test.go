@@ -0,0 +1,39 @@
+package outputlog
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRegisteredStream(t *testing.T) {
+	t.Parallel()
+	require.True(t, IsRegisteredStream(StreamStdout))
+	require.True(t, IsRegisteredStream(StreamSignalSent))
+	require.True(t, IsRegisteredStream(StreamHookPrefix+"post-exit"))
+	require.False(t, IsRegisteredStream("unknown"))
+	require.False(t, IsRegisteredStream("hook-with space"))
+}
+
+// TestRegisterStream is not parallel: RegisterStream must not run concurrently with writers.
+func TestRegisterStream(t *testing.T) {
+	RegisterStream("test-watch")
+	require.True(t, IsRegisteredStream("test-watch"))
+	require.Panics(t, func() { RegisterStream("") })
+}
+
+func TestOutputLogIoWriter_DropsUnregisteredStream(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	writer := NewOutputLogWriter(&buf, nil)
+
+	_, err := writer.StreamWriter("unknown").Write([]byte("dropped\n"))
+	require.NoError(t, err)
+	_, err = writer.StreamWriter(StreamStdout).Write([]byte("kept\n"))
+	require.NoError(t, err)
+	writer.Close()
+
+	require.NotContains(t, buf.String(), "dropped")
+	require.Contains(t, buf.String(), "kept")
+}
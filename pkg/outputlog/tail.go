@@ -0,0 +1,86 @@
+package outputlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Tail reads all chunks of filePath and keeps polling for appended chunks, like `tail -f`.
+//
+// Tailing ends when ctx gets cancelled, or when stop returns true after all data which was
+// available at that moment has been emitted. stop may be nil, then only ctx ends tailing.
+// Partially written trailing records are kept back until they are complete. The returned
+// channel is closed when tailing ends. A malformed record is emitted as Chunk with Error set,
+// and ends tailing.
+func Tail(ctx context.Context, filePath string, pollInterval time.Duration, stop func() bool) <-chan Chunk {
+	channel := make(chan Chunk)
+	go tailToChannel(ctx, filePath, pollInterval, stop, channel)
+	return channel
+}
+
+func tailToChannel(ctx context.Context, filePath string, pollInterval time.Duration, stop func() bool, channel chan<- Chunk) {
+	defer close(channel)
+
+	send := func(chunk Chunk) bool {
+		select {
+		case channel <- chunk:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var offset int64
+	for {
+		// Evaluate stop before reading: if the writer is done now, everything it wrote is on
+		// disk and will be read below.
+		stopAfterRead := stop != nil && stop()
+
+		chunks, newOffset, err := ReadFrom(filePath, offset)
+		offset = newOffset
+		for _, chunk := range chunks {
+			if !send(chunk) {
+				return
+			}
+		}
+		if err != nil {
+			send(Chunk{Error: err})
+			return
+		}
+
+		if stopAfterRead {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// parseCompleteChunks parses all complete records of data. The returned rest contains the bytes
+// of a trailing record which is not complete yet.
+func parseCompleteChunks(data []byte) ([]Chunk, []byte, error) {
+	var chunks []Chunk
+	reader := bytes.NewReader(data)
+	for {
+		start := len(data) - reader.Len()
+		chunk, eof := readToChunk(reader)
+		if chunk.Error != nil {
+			if errors.Is(chunk.Error, io.EOF) || errors.Is(chunk.Error, io.ErrUnexpectedEOF) {
+				return chunks, data[start:], nil
+			}
+			return chunks, nil, fmt.Errorf("offset %d: %w", start, chunk.Error)
+		}
+		if eof {
+			return chunks, data[start:], nil
+		}
+		chunks = append(chunks, chunk)
+	}
+}
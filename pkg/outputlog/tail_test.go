@@ -0,0 +1,94 @@
+package outputlog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTail_ReadsExistingAndStops(t *testing.T) {
+	t.Parallel()
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	data := append(FormatChunk(Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("one\n")}),
+		FormatChunk(Chunk{Stream: "stderr", Timestamp: time.Now(), Line: []byte("two\n")})...)
+	require.NoError(t, os.WriteFile(filePath, data, 0o600))
+
+	channel := Tail(context.Background(), filePath, time.Millisecond, func() bool { return true })
+
+	first := <-channel
+	require.NoError(t, first.Error)
+	require.Equal(t, "stdout", first.Stream)
+	require.Equal(t, "one\n", string(first.Line))
+
+	second := <-channel
+	require.NoError(t, second.Error)
+	require.Equal(t, "stderr", second.Stream)
+	require.Equal(t, "two\n", string(second.Line))
+
+	_, ok := <-channel
+	require.False(t, ok)
+}
+
+func TestTail_FollowsPartialRecords(t *testing.T) {
+	t.Parallel()
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	record := FormatChunk(Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("hello\n")})
+	require.NoError(t, os.WriteFile(filePath, record[:10], 0o600))
+
+	var done atomic.Bool
+	channel := Tail(context.Background(), filePath, time.Millisecond, done.Load)
+
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = file.Write(record[10:])
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	chunk := <-channel
+	require.NoError(t, chunk.Error)
+	require.Equal(t, "hello\n", string(chunk.Line))
+
+	done.Store(true)
+	_, ok := <-channel
+	require.False(t, ok)
+}
+
+func TestTail_ContextCancel(t *testing.T) {
+	t.Parallel()
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	require.NoError(t, os.WriteFile(filePath, nil, 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	channel := Tail(ctx, filePath, time.Millisecond, nil)
+	cancel()
+
+	_, ok := <-channel
+	require.False(t, ok)
+}
+
+func TestTail_MalformedRecord(t *testing.T) {
+	t.Parallel()
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	require.NoError(t, os.WriteFile(filePath, []byte("stdout invalid-timestamp 5: hello\n"), 0o600))
+
+	channel := Tail(context.Background(), filePath, time.Millisecond, nil)
+
+	chunk := <-channel
+	require.Error(t, chunk.Error)
+
+	_, ok := <-channel
+	require.False(t, ok)
+}
+
+func TestTail_MissingFile(t *testing.T) {
+	t.Parallel()
+	channel := Tail(context.Background(), filepath.Join(t.TempDir(), "missing.log"), time.Millisecond, nil)
+
+	chunk := <-channel
+	require.ErrorIs(t, chunk.Error, os.ErrNotExist)
+}
@@ -0,0 +1,81 @@
+package outputlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"mobileshell/internal/metadata"
+)
+
+// TruncateFront removes the oldest chunks of filePath, so that the uncompressed log is at most
+// maxBytes long, see Size. A chunk on the stream "nohup-stderr" gets prepended, which tells the
+// reader that output was removed. It returns the number of removed bytes. The file is replaced
+// atomically, so it must not be written to concurrently. A compressed log (see Open) stays
+// compressed. An index (see BuildIndex) gets rebuilt.
+func TruncateFront(filePath string, maxBytes int64) (int64, error) {
+	_, err := os.Stat(filePath)
+	compressed := errors.Is(err, fs.ErrNotExist)
+	file, err := Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(file)
+	_ = file.Close()
+	if err != nil {
+		return 0, err
+	}
+	if int64(len(data)) <= maxBytes {
+		return 0, nil
+	}
+
+	notice := FormatChunk(Chunk{
+		Stream:    StreamNohupStderr,
+		Timestamp: time.Now().UTC(),
+		Line:      []byte("[mobileshell] older output was removed (retention policy)\n"),
+	})
+	budget := max(maxBytes-int64(len(notice)), 0)
+
+	// Find the first chunk boundary which leaves at most budget bytes.
+	reader := bytes.NewReader(data)
+	start := 0
+	for int64(len(data)-start) > budget {
+		chunk, eof := readToChunk(reader)
+		if chunk.Error != nil {
+			return 0, fmt.Errorf("%q offset %d: %w", filePath, start, chunk.Error)
+		}
+		if eof {
+			break
+		}
+		start = len(data) - reader.Len()
+	}
+
+	truncated := append(notice, data[start:]...)
+	if compressed {
+		var buf bytes.Buffer
+		gzWriter := gzip.NewWriter(&buf)
+		if _, err := gzWriter.Write(truncated); err != nil {
+			return 0, err
+		}
+		if err := gzWriter.Close(); err != nil {
+			return 0, err
+		}
+		if err := metadata.WriteFile(filePath+GzipSuffix, buf.Bytes(), 0o600); err != nil {
+			return 0, err
+		}
+	} else if err := metadata.WriteFile(filePath, truncated, 0o600); err != nil {
+		return 0, err
+	}
+	// The offsets of the index changed
+	if _, err := os.Stat(filePath + IndexSuffix); err == nil {
+		if err := BuildIndex(filePath, DefaultIndexInterval); err != nil {
+			return 0, err
+		}
+	}
+	return int64(start), nil
+}
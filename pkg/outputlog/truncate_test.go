@@ -0,0 +1,49 @@
+package outputlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncateFront(t *testing.T) {
+	t.Parallel()
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	var data []byte
+	for range 100 {
+		data = append(data, FormatChunk(Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("0123456789\n")})...)
+	}
+	data = append(data, FormatChunk(Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("last line\n")})...)
+	require.NoError(t, os.WriteFile(filePath, data, 0o600))
+
+	removed, err := TruncateFront(filePath, 500)
+	require.NoError(t, err)
+	require.Positive(t, removed)
+
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+	require.LessOrEqual(t, info.Size(), int64(500))
+
+	streams, err := ReadStreams(filePath, "stdout", "nohup-stderr")
+	require.NoError(t, err)
+	require.Contains(t, string(streams["nohup-stderr"]), "older output was removed")
+	require.Contains(t, string(streams["stdout"]), "last line\n")
+}
+
+func TestTruncateFront_SmallFileUnchanged(t *testing.T) {
+	t.Parallel()
+	filePath := filepath.Join(t.TempDir(), "output.log")
+	data := FormatChunk(Chunk{Stream: "stdout", Timestamp: time.Now(), Line: []byte("hello\n")})
+	require.NoError(t, os.WriteFile(filePath, data, 0o600))
+
+	removed, err := TruncateFront(filePath, 500)
+	require.NoError(t, err)
+	require.Zero(t, removed)
+
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	require.Equal(t, data, content)
+}
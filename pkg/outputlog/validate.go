@@ -0,0 +1,118 @@
+package outputlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// timestampRegex and lengthRegex are stricter than the parser of the reader, which accepts
+// for example lengths like "+5".
+var (
+	timestampRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d{1,9})?Z$`)
+	lengthRegex    = regexp.MustCompile(`^\d+$`)
+)
+
+// ValidationProblem is a malformed region of an output log.
+type ValidationProblem struct {
+	Offset int64 // Byte offset of the first malformed record
+	Length int64 // Number of bytes which were skipped until the next valid record
+	Err    error // Why the first record is malformed
+}
+
+// ValidationReport is the result of Validate.
+type ValidationReport struct {
+	Records  int   // Number of valid records
+	Bytes    int64 // Size of the log
+	Problems []ValidationProblem
+}
+
+// OK returns true if the log has no malformed records.
+func (r *ValidationReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Validate checks the structural integrity of an output log: the stream names, the timestamp
+// format, the lengths and the separators (see doc.go). Unlike Verify it does not stop at the
+// first malformed record. It skips to the next line which starts a valid record, and reports
+// the skipped region. A partially written trailing record is reported, too. The returned error
+// is only set if reader fails.
+func Validate(reader io.Reader) (*ValidationReport, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	report := &ValidationReport{Bytes: int64(len(data))}
+	var problem *ValidationProblem
+	pos := 0
+	for pos < len(data) {
+		n, err := validateRecord(data[pos:])
+		if err == nil {
+			if problem != nil {
+				problem.Length = int64(pos) - problem.Offset
+				report.Problems = append(report.Problems, *problem)
+				problem = nil
+			}
+			report.Records++
+			pos += n
+			continue
+		}
+		if problem == nil {
+			problem = &ValidationProblem{Offset: int64(pos), Err: err}
+		}
+		// Content can contain newlines, so the next record may start after any of them
+		next := bytes.IndexByte(data[pos:], '\n')
+		if next < 0 {
+			break
+		}
+		pos += next + 1
+	}
+	if problem != nil {
+		problem.Length = int64(len(data)) - problem.Offset
+		report.Problems = append(report.Problems, *problem)
+	}
+	return report, nil
+}
+
+// maxHeaderSize limits the search for the end of the header: a stream name of 64 bytes, a
+// timestamp of 30 bytes, the length and the separators.
+const maxHeaderSize = 128
+
+// validateRecord checks the record at the start of data and returns its size.
+func validateRecord(data []byte) (int, error) {
+	// The header ends with the first ": ", the timestamp has colons, but no spaces after them
+	headerEnd := bytes.Index(data[:min(len(data), maxHeaderSize)], []byte(": "))
+	if headerEnd < 0 {
+		return 0, errors.New("no header separator")
+	}
+	header := string(data[:headerEnd])
+	fields := strings.Split(header, " ")
+	if len(fields) != 3 {
+		return 0, fmt.Errorf("expected stream, timestamp and length, got %q", header)
+	}
+	if !IsValidStreamName(fields[0]) {
+		return 0, fmt.Errorf("invalid stream name %q", fields[0])
+	}
+	if !timestampRegex.MatchString(fields[1]) {
+		return 0, fmt.Errorf("invalid timestamp %q", fields[1])
+	}
+	if !lengthRegex.MatchString(fields[2]) {
+		return 0, fmt.Errorf("invalid length %q", fields[2])
+	}
+	length, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return 0, fmt.Errorf("invalid length %q", fields[2])
+	}
+	end := headerEnd + len(": ") + length
+	if length > len(data) || end >= len(data) {
+		return 0, fmt.Errorf("incomplete record, %d bytes of content are missing", end+1-len(data))
+	}
+	if data[end] != '\n' {
+		return 0, fmt.Errorf("expected newline separator after %d bytes of content, got %q", length, data[end])
+	}
+	return end + 1, nil
+}
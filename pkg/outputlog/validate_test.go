@@ -0,0 +1,44 @@
+package outputlog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	first := FormatChunk(Chunk{Stream: StreamStdout, Timestamp: now, Line: []byte("one\ntwo\n")})
+	second := FormatChunk(Chunk{Stream: StreamStderr, Timestamp: now, Line: []byte("three\n")})
+	log := append(append([]byte{}, first...), second...)
+
+	report, err := Validate(bytes.NewReader(log))
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Equal(t, 2, report.Records)
+	require.Equal(t, int64(len(log)), report.Bytes)
+
+	// A wrong length, garbage and a truncated record
+	badLength := []byte("stdout 2025-01-07T12:34:56Z 2: abc\n")
+	garbage := []byte("garbage\n")
+	corrupted := append(append(append(append([]byte{}, first...), badLength...), second...), garbage...)
+	corrupted = append(corrupted, second[:10]...)
+
+	report, err = Validate(bytes.NewReader(corrupted))
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.Equal(t, 2, report.Records)
+	require.Len(t, report.Problems, 2)
+	require.Equal(t, int64(len(first)), report.Problems[0].Offset)
+	require.Equal(t, int64(len(badLength)), report.Problems[0].Length)
+	require.ErrorContains(t, report.Problems[0].Err, "expected newline separator")
+	require.Equal(t, int64(len(first)+len(badLength)+len(second)), report.Problems[1].Offset)
+	require.Equal(t, int64(len(garbage)+10), report.Problems[1].Length)
+
+	report, err = Validate(bytes.NewReader([]byte("stdout 2025-01-07 12:34:56 -1: \n")))
+	require.NoError(t, err)
+	require.ErrorContains(t, report.Problems[0].Err, "expected stream, timestamp and length")
+}
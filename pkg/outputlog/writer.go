@@ -67,24 +67,100 @@ func (sw *streamWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
+// WriterOption configures an OutputLogWriter, see NewOutputLogWriter.
+type WriterOption func(*writerOptions)
+
+type writerOptions struct {
+	heartbeat     time.Duration
+	coalesce      *CoalescePolicy
+	index         io.Writer
+	indexInterval int64
+}
+
+// WithHeartbeat makes the writer append an empty StreamHeartbeat chunk every interval, and an
+// empty StreamEnd chunk when it gets closed. With them ReadStatus can tell a log which ended
+// cleanly from a log whose writer died.
+func WithHeartbeat(interval time.Duration) WriterOption {
+	return func(o *writerOptions) {
+		o.heartbeat = interval
+	}
+}
+
+// WithCoalescing makes the writer merge consecutive chunks of the streams of policy, instead of
+// writing a record per Write call. onChunk of NewOutputLogWriter still gets every chunk.
+func WithCoalescing(policy CoalescePolicy) WriterOption {
+	return func(o *writerOptions) {
+		o.coalesce = &policy
+	}
+}
+
+// WithIndex makes the writer append an entry to index every interval bytes of the log (see
+// IndexEntry). The index should be the file at the path of the log plus IndexSuffix, then
+// SeekToTime and SeekToLastLines don't need to read the whole log.
+func WithIndex(index io.Writer, interval int64) WriterOption {
+	return func(o *writerOptions) {
+		o.index = index
+		o.indexInterval = interval
+	}
+}
+
 // NewOutputLogWriter creates a new OutputLogWriter that writes to the given io.Writer
-// The internal goroutine will run until Close() is called
-func NewOutputLogWriter(writer io.Writer, onChunk func(*Chunk)) *OutputLogIoWriter {
+// The internal goroutine will run until Close() is called. Chunks of streams which are not
+// registered (see IsRegisteredStream) get dropped.
+func NewOutputLogWriter(writer io.Writer, onChunk func(*Chunk), opts ...WriterOption) *OutputLogIoWriter {
+	var options writerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
 	chunks := make(chan Chunk, 100)
 	done := make(chan struct{})
 
 	// Single goroutine that owns the io.Writer
 	go func() {
-		for chunk := range chunks {
-			if onChunk != nil {
-				onChunk(&chunk)
+		defer close(done)
+		// A nil channel blocks forever, so there are no heartbeats without the option
+		var heartbeats <-chan time.Time
+		if options.heartbeat > 0 {
+			ticker := time.NewTicker(options.heartbeat)
+			defer ticker.Stop()
+			heartbeats = ticker.C
+		}
+		coalescer := newCoalescer(options.coalesce)
+		ix := newIndexer(options.index, options.indexInterval)
+		emit := func(chunk Chunk) {
+			ix.record(chunk, writeChunk(writer, chunk))
+		}
+		write := func(ready []Chunk) {
+			for _, chunk := range ready {
+				emit(chunk)
 			}
-			formatted := FormatChunk(chunk)
-			if _, err := writer.Write(formatted); err != nil {
-				log.Printf("outputlog: failed to write chunk: %v", err)
+		}
+		for {
+			select {
+			case chunk, ok := <-chunks:
+				if !ok {
+					write(coalescer.flush())
+					if options.heartbeat > 0 {
+						emit(Chunk{Stream: StreamEnd, Timestamp: time.Now().UTC()})
+					}
+					return
+				}
+				if !IsRegisteredStream(chunk.Stream) {
+					log.Printf("outputlog: dropping chunk of unregistered stream %q", chunk.Stream)
+					continue
+				}
+				if onChunk != nil {
+					onChunk(&chunk)
+				}
+				write(coalescer.add(chunk))
+			case <-coalescer.deadline():
+				write(coalescer.flush())
+			case now := <-heartbeats:
+				// Flush first, so that the timestamps in the log stay in order
+				write(coalescer.flush())
+				emit(Chunk{Stream: StreamHeartbeat, Timestamp: now.UTC()})
 			}
 		}
-		close(done)
 	}()
 
 	return &OutputLogIoWriter{
@@ -92,3 +168,12 @@ func NewOutputLogWriter(writer io.Writer, onChunk func(*Chunk)) *OutputLogIoWrit
 		done:   done,
 	}
 }
+
+// writeChunk writes chunk and returns the number of written bytes.
+func writeChunk(writer io.Writer, chunk Chunk) int {
+	n, err := writer.Write(FormatChunk(chunk))
+	if err != nil {
+		log.Printf("outputlog: failed to write chunk: %v", err)
+	}
+	return n
+}
@@ -1,6 +1,10 @@
 package outputtype
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
 	"strings"
 )
 
@@ -14,8 +18,13 @@ const (
 	OutputTypeFullscreen OutputType = "fullscreen"
 	OutputTypeInk        OutputType = "ink"
 	OutputTypeMarkdown   OutputType = "markdown"
+	OutputTypeJSON       OutputType = "json"
+	OutputTypeNDJSON     OutputType = "ndjson"
 )
 
+// maxPendingSize is the size from which on output without a newline gets analyzed by Feed
+const maxPendingSize = 1024
+
 // Detector continuously analyzes stdout to detect output type
 // Note: This is accessed only from a single goroutine,
 // so no synchronization is needed
@@ -25,12 +34,14 @@ type Detector struct {
 	detected        bool
 	buffer          []byte
 	maxBufferSize   int
+	pending         []byte // Incomplete line of Feed
 
 	// Counters for heuristics
 	hasAlternateScreen bool
 	hasClearScreen     bool
 	hasCursorMovement  bool
 	hasColorCodes      bool
+	hasHyperlinks      bool
 	lineCount          int
 
 	// Markdown detection counters
@@ -90,34 +101,90 @@ func (d *Detector) AnalyzeLine(line string) bool {
 
 	// If we've seen enough output, make a determination
 	if len(d.buffer) >= d.maxBufferSize || d.lineCount >= 50 {
-		// Check if markdown patterns are strong enough to classify as markdown
-		markdownScore := d.markdownHeaderCount + d.markdownCodeBlockCount +
-			d.markdownListCount + d.markdownLinkCount +
-			d.markdownBoldCount + d.markdownBlockquoteCount
-
-		// If we have at least 3 markdown indicators, classify as markdown
-		// Priority: markdown > ink > text (since markdown can coexist with ANSI codes)
-		if markdownScore >= 3 {
-			d.detectedType = OutputTypeMarkdown
-			d.detectionReason = "significant markdown formatting detected"
-			d.detected = true
+		d.classify()
+		return true
+	}
+
+	return false
+}
+
+// Feed analyzes a chunk of output, as it gets read from a pipe or pseudo-terminal.
+// Chunks don't need to end at line boundaries, an incomplete line is kept until its
+// rest arrives. Returns true if type has been detected (stop calling after this)
+func (d *Detector) Feed(chunk []byte) bool {
+	if d.detected {
+		return true
+	}
+	d.pending = append(d.pending, chunk...)
+	for {
+		i := bytes.IndexByte(d.pending, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(d.pending[:i+1])
+		d.pending = d.pending[i+1:]
+		if d.AnalyzeLine(line) {
+			d.pending = nil
 			return true
 		}
+	}
+
+	// Output without newlines, like progress bars and fullscreen applications
+	if len(d.pending) >= maxPendingSize {
+		return d.flushPending()
+	}
+	return false
+}
+
+// flushPending analyzes the incomplete line of Feed
+func (d *Detector) flushPending() bool {
+	line := string(d.pending)
+	d.pending = nil
+	return d.AnalyzeLine(line)
+}
 
-		if d.hasColorCodes || d.hasCursorMovement {
-			// Ink-based applications use ANSI codes but not fullscreen sequences
-			d.detectedType = OutputTypeInk
-			d.detectionReason = "ANSI color codes or cursor movement without fullscreen sequences"
+// Finish makes a determination from the output analyzed so far. It is called when the
+// output ended before enough lines were analyzed. Without any output, the type stays
+// undetected.
+func (d *Detector) Finish() {
+	if len(d.pending) > 0 && d.flushPending() {
+		return
+	}
+	if d.detected || d.lineCount == 0 {
+		return
+	}
+	d.classify()
+}
+
+// classify sets the detected type from the counters
+func (d *Detector) classify() {
+	// Check if markdown patterns are strong enough to classify as markdown
+	markdownScore := d.markdownHeaderCount + d.markdownCodeBlockCount +
+		d.markdownListCount + d.markdownLinkCount +
+		d.markdownBoldCount + d.markdownBlockquoteCount
+
+	// If we have at least 3 markdown indicators, classify as markdown
+	// Priority: markdown > ink > text (since markdown can coexist with ANSI codes)
+	if jsonType, ok := detectJSON(d.buffer); ok {
+		d.detectedType = jsonType
+		if jsonType == OutputTypeNDJSON {
+			d.detectionReason = "output is a stream of JSON values, like JSON lines"
 		} else {
-			// No special sequences detected, treat as plain text
-			d.detectedType = OutputTypeText
-			d.detectionReason = "no special terminal control sequences detected"
+			d.detectionReason = "output starts with a JSON object or array"
 		}
-		d.detected = true
-		return true
+	} else if markdownScore >= 3 {
+		d.detectedType = OutputTypeMarkdown
+		d.detectionReason = "significant markdown formatting detected"
+	} else if d.hasColorCodes || d.hasCursorMovement || d.hasHyperlinks {
+		// Ink-based applications use ANSI codes but not fullscreen sequences
+		d.detectedType = OutputTypeInk
+		d.detectionReason = "ANSI color codes, cursor movement or hyperlinks without fullscreen sequences"
+	} else {
+		// No special sequences detected, treat as plain text
+		d.detectedType = OutputTypeText
+		d.detectionReason = "no special terminal control sequences detected"
 	}
-
-	return false
+	d.detected = true
 }
 
 // GetDetectedType returns the detected type and reason
@@ -130,6 +197,40 @@ func (d *Detector) IsDetected() bool {
 	return d.detected
 }
 
+// detectJSON checks if the output is a JSON object or array (OutputTypeJSON), or a
+// stream of them like JSON lines (OutputTypeNDJSON). The output may be cut off at the
+// buffer size, so only syntax errors count.
+func detectJSON(output []byte) (OutputType, bool) {
+	trimmed := bytes.TrimSpace(output)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return "", false
+	}
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	depth := 0
+	values := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return "", false
+			}
+			if values > 1 {
+				return OutputTypeNDJSON, true
+			}
+			return OutputTypeJSON, true
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			values++
+		}
+	}
+}
+
 // isBinaryData checks if a line contains binary data
 func (d *Detector) isBinaryData(line string) bool {
 	if len(line) == 0 {
@@ -159,6 +260,11 @@ func (d *Detector) isBinaryData(line string) bool {
 
 // detectANSISequences scans for ANSI escape sequences in the line
 func (d *Detector) detectANSISequences(line string) {
+	// OSC 8 hyperlinks, like gh and cargo print them
+	if strings.Contains(line, "\x1b]8;") {
+		d.hasHyperlinks = true
+	}
+
 	// Look for ESC character (0x1B or \x1b)
 	if !strings.Contains(line, "\x1b[") {
 		return
@@ -752,3 +752,115 @@ func TestDetector_MarkdownEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestDetector_Finish(t *testing.T) {
+	t.Parallel()
+	d := NewDetector()
+	d.Finish()
+	if d.IsDetected() {
+		t.Error("Expected no detection without output")
+	}
+
+	d.AnalyzeLine("\x1b[32mok\x1b[0m\n")
+	if d.IsDetected() {
+		t.Error("Expected no detection after a single line")
+	}
+	d.Finish()
+	outputType, _ := d.GetDetectedType()
+	if outputType != OutputTypeInk {
+		t.Errorf("Expected OutputTypeInk, got %s", outputType)
+	}
+}
+
+func TestDetector_Feed(t *testing.T) {
+	t.Parallel()
+	d := NewDetector()
+	// Lines split across chunks are analyzed once they are complete
+	for _, chunk := range []string{"# Ti", "tle\n- one\n", "- two", "\n"} {
+		if d.Feed([]byte(chunk)) {
+			t.Fatalf("Expected no detection after chunk %q", chunk)
+		}
+	}
+	d.Finish()
+	outputType, _ := d.GetDetectedType()
+	if outputType != OutputTypeMarkdown {
+		t.Errorf("Expected OutputTypeMarkdown, got %s", outputType)
+	}
+
+	// Fullscreen applications don't need to write a newline
+	d = NewDetector()
+	if !d.Feed([]byte("\x1b[?1049h" + strings.Repeat("x", maxPendingSize))) {
+		t.Error("Expected detection of output without newline")
+	}
+	outputType, _ = d.GetDetectedType()
+	if outputType != OutputTypeFullscreen {
+		t.Errorf("Expected OutputTypeFullscreen, got %s", outputType)
+	}
+
+	// The incomplete last line counts when the output ended
+	d = NewDetector()
+	d.Feed([]byte("no newline"))
+	d.Finish()
+	outputType, _ = d.GetDetectedType()
+	if outputType != OutputTypeText {
+		t.Errorf("Expected OutputTypeText, got %s", outputType)
+	}
+}
+
+func TestDetector_JSON(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		output string
+		isJSON bool
+	}{
+		{name: "object", output: "{\n  \"name\": \"mobileshell\",\n  \"tags\": [\"a\", \"b\"]\n}\n", isJSON: true},
+		{name: "array", output: "[1, 2, 3]\n", isJSON: true},
+		{name: "cut off", output: "[{\"id\": 1}, {\"id\": 2", isJSON: true},
+		{name: "log prefix in brackets", output: "[INFO] starting\n", isJSON: false},
+		{name: "progress in brackets", output: "[1/3] Building\n", isJSON: false},
+		{name: "plain text", output: "hello\n", isJSON: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector()
+			d.Feed([]byte(tt.output))
+			d.Finish()
+			outputType, _ := d.GetDetectedType()
+			if (outputType == OutputTypeJSON) != tt.isJSON {
+				t.Errorf("Expected JSON detection: %v, got type %s", tt.isJSON, outputType)
+			}
+		})
+	}
+}
+
+func TestDetector_Hyperlinks(t *testing.T) {
+	t.Parallel()
+	d := NewDetector()
+	d.AnalyzeLine("see \x1b]8;;https://example.com\x1b\\docs\x1b]8;;\x1b\\\n")
+	d.Finish()
+	outputType, _ := d.GetDetectedType()
+	if outputType != OutputTypeInk {
+		t.Errorf("Expected OutputTypeInk, got %s", outputType)
+	}
+}
+
+func TestDetector_NDJSON(t *testing.T) {
+	t.Parallel()
+	d := NewDetector()
+	d.Feed([]byte("{\"level\":\"info\"}\r\n{\"level\":\"warn\",\"tags\":[1]}\r\n"))
+	d.Finish()
+	outputType, _ := d.GetDetectedType()
+	if outputType != OutputTypeNDJSON {
+		t.Errorf("Expected OutputTypeNDJSON, got %s", outputType)
+	}
+
+	d = NewDetector()
+	d.Feed([]byte("{\"items\": [{\"id\": 1}, {\"id\": 2}]}\n"))
+	d.Finish()
+	outputType, _ = d.GetDetectedType()
+	if outputType != OutputTypeJSON {
+		t.Errorf("Expected OutputTypeJSON, got %s", outputType)
+	}
+}
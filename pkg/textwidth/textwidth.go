@@ -0,0 +1,86 @@
+// Package textwidth measures and truncates text by its display width in a
+// terminal or monospace font. East Asian wide characters and emoji take two
+// columns, combining marks and other zero-width characters take none.
+package textwidth
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ellipsis gets appended to truncated text.
+const Ellipsis = "…"
+
+// wideRanges are the ranges of characters which take two columns.
+var wideRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x1100, Hi: 0x115f, Stride: 1}, // Hangul Jamo
+		{Lo: 0x231a, Hi: 0x231b, Stride: 1}, // Watch, hourglass
+		{Lo: 0x23e9, Hi: 0x23ec, Stride: 1},
+		{Lo: 0x25fd, Hi: 0x25fe, Stride: 1},
+		{Lo: 0x2614, Hi: 0x2615, Stride: 1},
+		{Lo: 0x26a1, Hi: 0x26a1, Stride: 1}, // High voltage
+		{Lo: 0x26bd, Hi: 0x26be, Stride: 1},
+		{Lo: 0x2705, Hi: 0x2705, Stride: 1}, // Check mark
+		{Lo: 0x274c, Hi: 0x274c, Stride: 1}, // Cross mark
+		{Lo: 0x2e80, Hi: 0x303e, Stride: 1}, // CJK radicals and punctuation
+		{Lo: 0x3041, Hi: 0x33ff, Stride: 1}, // Hiragana, Katakana, CJK compatibility
+		{Lo: 0x3400, Hi: 0x4dbf, Stride: 1}, // CJK extension A
+		{Lo: 0x4e00, Hi: 0x9fff, Stride: 1}, // CJK unified ideographs
+		{Lo: 0xa000, Hi: 0xa4cf, Stride: 1}, // Yi
+		{Lo: 0xac00, Hi: 0xd7a3, Stride: 1}, // Hangul syllables
+		{Lo: 0xf900, Hi: 0xfaff, Stride: 1}, // CJK compatibility ideographs
+		{Lo: 0xfe30, Hi: 0xfe4f, Stride: 1}, // CJK compatibility forms
+		{Lo: 0xff00, Hi: 0xff60, Stride: 1}, // Fullwidth forms
+		{Lo: 0xffe0, Hi: 0xffe6, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f300, Hi: 0x1f64f, Stride: 1}, // Pictographs and emoticons
+		{Lo: 0x1f680, Hi: 0x1f6ff, Stride: 1}, // Transport and map symbols
+		{Lo: 0x1f900, Hi: 0x1f9ff, Stride: 1}, // Supplemental pictographs
+		{Lo: 0x1fa70, Hi: 0x1faff, Stride: 1},
+		{Lo: 0x20000, Hi: 0x3fffd, Stride: 1}, // CJK extensions B and later
+	},
+}
+
+// runeWidth returns the number of columns of r.
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x20 || (r >= 0x7f && r < 0xa0):
+		return 0
+	case r == 0x200d || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Variation_Selector):
+		return 0
+	case unicode.Is(wideRanges, r):
+		return 2
+	}
+	return 1
+}
+
+// Width returns the number of columns of s.
+func Width(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// Truncate shortens s to at most width columns, including the ellipsis which
+// marks truncated text. Characters are never split.
+func Truncate(s string, width int) string {
+	if Width(s) <= width {
+		return s
+	}
+	limit := width - Width(Ellipsis)
+	used := 0
+	end := 0
+	for end < len(s) {
+		r, size := utf8.DecodeRuneInString(s[end:])
+		if used+runeWidth(r) > limit {
+			break
+		}
+		used += runeWidth(r)
+		end += size
+	}
+	return s[:end] + Ellipsis
+}
@@ -0,0 +1,27 @@
+package textwidth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWidth(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, 5, Width("hello"))
+	require.Equal(t, 4, Width("日本"))
+	require.Equal(t, 2, Width("🚀"))
+	require.Equal(t, 1, Width("é"))
+	require.Equal(t, 0, Width("\x1b"))
+}
+
+func TestTruncate(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "hello", Truncate("hello", 5))
+	require.Equal(t, "hell…", Truncate("hello world", 5))
+	// A wide character which doesn't fit completely is left out
+	require.Equal(t, "日本…", Truncate("日本語のテキスト", 6))
+	require.Equal(t, "ab…", Truncate("ab🚀🚀", 4))
+	require.Equal(t, "é…", Truncate("ééé", 2))
+	require.Equal(t, "…", Truncate("日本語", 1))
+}
@@ -0,0 +1,14 @@
+#!/usr/bin/env bash
+# Bash Strict Mode: https://github.com/guettli/bash-strict-mode
+trap 'echo -e "\n🤷 🚨 🔥 Warning: A command has failed. Exiting the script. Line was ($0:$LINENO): $(sed -n "${LINENO}p" "$0" 2>/dev/null || true) 🔥 🚨 🤷 "; exit 3' ERR
+set -Eeuo pipefail
+
+# Ensure Nix environment is active, or run this script via nix develop
+if [[ -z "${IN_NIX_SHELL:-}" ]]; then
+    echo "Nix environment not active. Running via 'nix develop'..."
+    exec nix develop --command "$0" "$@"
+fi
+
+# The platform specific code has build tags, make sure that the Windows variants compile
+GOOS=windows go build ./...
+GOOS=windows go vet ./...
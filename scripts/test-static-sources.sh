@@ -27,6 +27,8 @@ DOWNLOADED_FILES=(
 
 # Files that are custom/handwritten for this project
 CUSTOM_FILES=(
+    "autocomplete.css"
+    "output.css"
     "url-links.js"
 )
 